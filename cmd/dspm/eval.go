@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/qualys/dspm/internal/classifier"
+	"github.com/qualys/dspm/internal/eval"
+	"github.com/qualys/dspm/internal/mlclassifier"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/rules"
+)
+
+// runEval implements `dspm eval`, which scores the classifiers against a
+// labeled corpus and writes the report as JSON and/or Markdown
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	manifest := fs.String("manifest", "", "Path to the JSONL corpus manifest (required)")
+	packPath := fs.String("rules", "", "Rule pack (YAML or JSON) to evaluate alongside the built-in rules")
+	noML := fs.Bool("no-ml", false, "Evaluate the rules without ML enhancement")
+	minConfidence := fs.Float64("min-confidence", models.DefaultConfidenceThresholds().AutoReject, "Drop matches the ML classifier scores below this")
+	jsonOut := fs.String("json", "", "Write the JSON report to this file (- for stdout)")
+	markdownOut := fs.String("markdown", "-", "Write the Markdown report to this file (- for stdout, empty to skip)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *manifest == "" {
+		fmt.Fprintln(os.Stderr, "eval: -manifest is required")
+		fs.Usage()
+		return 2
+	}
+
+	docs, err := eval.LoadManifest(*manifest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load manifest: %v\n", err)
+		return 1
+	}
+
+	opts := eval.Options{Classifier: classifier.New(), MinConfidence: *minConfidence}
+	if *packPath != "" {
+		data, err := os.ReadFile(*packPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read rule pack: %v\n", err)
+			return 1
+		}
+		pack, err := rules.ParsePack(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse rule pack: %v\n", err)
+			return 1
+		}
+		engine := rules.NewEngine(nil)
+		if err := engine.LoadPack(pack); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load rule pack: %v\n", err)
+			return 1
+		}
+		if opts.Classifier, err = engine.NewClassifier(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to build classifier: %v\n", err)
+			return 1
+		}
+	}
+	if !*noML {
+		opts.ML = mlclassifier.NewService(nil)
+	}
+
+	report, err := eval.Run(context.Background(), docs, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Evaluation failed: %v\n", err)
+		return 1
+	}
+
+	if err := writeReport(*jsonOut, report.WriteJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write JSON report: %v\n", err)
+		return 1
+	}
+	if err := writeReport(*markdownOut, report.WriteMarkdown); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write Markdown report: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func writeReport(path string, write func(io.Writer) error) error {
+	switch path {
+	case "":
+		return nil
+	case "-":
+		return write(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
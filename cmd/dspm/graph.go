@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/config"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/store"
+)
+
+// runGraph implements `dspm graph export` and `dspm graph import`, which
+// dump the access graph for offline analysis and restore such a dump
+func runGraph(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: dspm graph export|import [flags]")
+		return 2
+	}
+	switch args[0] {
+	case "export":
+		return runGraphExport(args[1:])
+	case "import":
+		return runGraphImport(args[1:])
+	}
+	fmt.Fprintf(os.Stderr, "graph: unknown command %q\n", args[0])
+	return 2
+}
+
+func runGraphExport(args []string) int {
+	fs := flag.NewFlagSet("graph export", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	format := fs.String("format", access.FormatJSON, "Export format: json, graphml or cypher")
+	accountID := fs.String("account", "", "Export only this account's part of the graph (account UUID)")
+	minSensitivity := fs.String("min-sensitivity", "", "Leave out data assets less sensitive than this (LOW, MEDIUM, HIGH, CRITICAL)")
+	out := fs.String("out", "-", "Write the export to this file (- for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := access.ExportFilter{MinSensitivity: models.Sensitivity(*minSensitivity)}
+	if *accountID != "" {
+		id, err := uuid.Parse(*accountID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "graph export: invalid account ID: %v\n", err)
+			return 2
+		}
+		filter.AccountID = &id
+	}
+	if err := filter.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "graph export: %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	graph, closeGraph, err := openGraph(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open access graph: %v\n", err)
+		return 1
+	}
+	defer closeGraph()
+
+	snapshot, err := graph.Export(ctx, filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	if err := writeReport(*out, func(w io.Writer) error { return snapshot.Write(w, *format) }); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write export: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d nodes and %d relationships\n", len(snapshot.Nodes), len(snapshot.Links))
+	return 0
+}
+
+func runGraphImport(args []string) int {
+	fs := flag.NewFlagSet("graph import", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	format := fs.String("format", access.FormatJSON, "Snapshot format: json or graphml")
+	in := fs.String("in", "", "Snapshot to import (- for stdin, required)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *in == "" {
+		fmt.Fprintln(os.Stderr, "graph import: -in is required")
+		fs.Usage()
+		return 2
+	}
+
+	r := io.Reader(os.Stdin)
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open snapshot: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		r = f
+	}
+	snapshot, err := access.ReadSnapshot(r, *format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read snapshot: %v\n", err)
+		return 1
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	// An in-memory graph that is not persisted lives only in the API process,
+	// so an import from here would be lost when the command exits
+	if cfg.Graph.Backend == access.BackendMemory && (cfg.Graph.Persistence == "" || cfg.Graph.Persistence == access.PersistNone) {
+		fmt.Fprintln(os.Stderr, "graph import: the in-memory graph is not persisted; import through POST /api/v1/access/import instead")
+		return 1
+	}
+
+	ctx := context.Background()
+	graph, closeGraph, err := openGraph(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open access graph: %v\n", err)
+		return 1
+	}
+	defer closeGraph()
+
+	if err := graph.Import(ctx, snapshot); err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d nodes and %d relationships\n", len(snapshot.Nodes), len(snapshot.Links))
+	return 0
+}
+
+// openGraph opens the graph backend the configuration selects, with the
+// database when the in-memory backend persists to Postgres
+func openGraph(ctx context.Context, cfg *config.Config) (access.GraphStore, func(), error) {
+	storeCfg := access.StoreConfig{
+		Backend: cfg.Graph.Backend,
+		Neo4j: access.Config{
+			URI:      cfg.Neo4j.URI,
+			Username: cfg.Neo4j.User,
+			Password: cfg.Neo4j.Password,
+		},
+		Persistence: cfg.Graph.Persistence,
+		Path:        cfg.Graph.Path,
+	}
+	var st *store.Store
+	var err error
+	if cfg.Graph.Backend == access.BackendMemory && cfg.Graph.Persistence == access.PersistPostgres {
+		st, err = store.New(store.Config{
+			DSN:          cfg.Database.DSN(),
+			MaxOpenConns: cfg.Database.MaxOpenConns,
+			MaxIdleConns: cfg.Database.MaxIdleConns,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("connecting to database: %w", err)
+		}
+		storeCfg.DB = st.DB()
+	}
+
+	graph, err := access.NewStore(ctx, storeCfg)
+	if err != nil {
+		if st != nil {
+			st.Close()
+		}
+		return nil, nil, err
+	}
+	return graph, func() {
+		if err := graph.Close(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close access graph: %v\n", err)
+		}
+		if st != nil {
+			st.Close()
+		}
+	}, nil
+}
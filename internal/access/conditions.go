@@ -0,0 +1,368 @@
+package access
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestContext holds the condition key values of a request, keyed by
+// lowercased condition key
+type requestContext struct {
+	values   map[string][]string
+	complete bool
+}
+
+// principalKeys are the keys filled in from the identity and resource. They
+// are always known, even when the request context is incomplete.
+var principalKeys = []string{
+	"aws:principalarn", "aws:principalaccount", "aws:principalorgid", "aws:principaltype",
+	"aws:principalisawsservice", "aws:principalservicename", "aws:username",
+	"aws:resourceaccount",
+}
+
+func newRequestContext(id *Identity, res *Resource, req Request) *requestContext {
+	c := &requestContext{
+		values:   make(map[string][]string, len(req.Context)+len(principalKeys)),
+		complete: req.Complete,
+	}
+	set := func(key, value string) {
+		if value != "" {
+			c.values[key] = []string{value}
+		}
+	}
+
+	switch {
+	case id.isAnonymous():
+		set("aws:principaltype", "Anonymous")
+	case id.isService():
+		set("aws:principalisawsservice", "true")
+		set("aws:principalservicename", id.ARN)
+	default:
+		set("aws:principalisawsservice", "false")
+		set("aws:principalarn", principalARN(id.ARN))
+		set("aws:principalaccount", id.AccountID)
+		set("aws:principalorgid", id.OrgID)
+		switch {
+		case strings.Contains(id.ARN, ":assumed-role/"):
+			set("aws:principaltype", "AssumedRole")
+		case strings.HasSuffix(id.ARN, ":root"):
+			set("aws:principaltype", "Account")
+		case strings.EqualFold(id.Type, "USER"):
+			set("aws:principaltype", "User")
+			set("aws:username", id.ARN[strings.LastIndex(id.ARN, "/")+1:])
+		}
+		for k, v := range id.Tags {
+			set("aws:principaltag/"+strings.ToLower(k), v)
+		}
+	}
+	set("aws:resourceaccount", res.AccountID)
+
+	for k, v := range req.Context {
+		c.values[strings.ToLower(k)] = v
+	}
+	return c
+}
+
+// principalARN returns the ARN conditions see for a principal: the role
+// rather than the session for assumed roles
+func principalARN(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[2] != "sts" || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return arn
+	}
+	role := strings.Split(parts[5], "/")[1]
+	return "arn:aws:iam::" + parts[4] + ":role/" + role
+}
+
+// lookup returns the values of a key and whether the key is known: present,
+// or known to be absent
+func (c *requestContext) lookup(key string) ([]string, bool) {
+	key = strings.ToLower(key)
+	if v, ok := c.values[key]; ok {
+		return v, true
+	}
+	if c.complete || strings.HasPrefix(key, "aws:principaltag/") {
+		return nil, true
+	}
+	for _, k := range principalKeys {
+		if k == key {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// substitute replaces the policy variables in s, such as ${aws:username},
+// with their values. It reports false when a variable has no single value.
+func (c *requestContext) substitute(s string) (string, bool) {
+	if !strings.Contains(s, "${") {
+		return s, true
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), true
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			b.WriteString(s)
+			return b.String(), true
+		}
+		b.WriteString(s[:start])
+		name := s[start+2 : start+end]
+		switch name {
+		case "*", "?", "$":
+			// Escapes for characters that are otherwise wildcards
+			b.WriteString(name)
+		default:
+			values, _ := c.lookup(name)
+			if len(values) != 1 {
+				return "", false
+			}
+			b.WriteString(values[0])
+		}
+		s = s[start+end+1:]
+	}
+}
+
+// conditionOperator compares a context value with a policy value
+type conditionOperator struct {
+	compare func(value, policy string) bool
+	// negated operators hold when no policy value compares true, and when
+	// the key is absent
+	negated bool
+}
+
+var conditionOperators = map[string]conditionOperator{
+	"stringequals":              {compare: stringEquals},
+	"stringnotequals":           {compare: stringEquals, negated: true},
+	"stringequalsignorecase":    {compare: strings.EqualFold},
+	"stringnotequalsignorecase": {compare: strings.EqualFold, negated: true},
+	"stringlike":                {compare: stringLike},
+	"stringnotlike":             {compare: stringLike, negated: true},
+	"numericequals":             {compare: numeric(func(c int) bool { return c == 0 })},
+	"numericnotequals":          {compare: numeric(func(c int) bool { return c == 0 }), negated: true},
+	"numericlessthan":           {compare: numeric(func(c int) bool { return c < 0 })},
+	"numericlessthanequals":     {compare: numeric(func(c int) bool { return c <= 0 })},
+	"numericgreaterthan":        {compare: numeric(func(c int) bool { return c > 0 })},
+	"numericgreaterthanequals":  {compare: numeric(func(c int) bool { return c >= 0 })},
+	"dateequals":                {compare: date(func(c int) bool { return c == 0 })},
+	"datenotequals":             {compare: date(func(c int) bool { return c == 0 }), negated: true},
+	"datelessthan":              {compare: date(func(c int) bool { return c < 0 })},
+	"datelessthanequals":        {compare: date(func(c int) bool { return c <= 0 })},
+	"dategreaterthan":           {compare: date(func(c int) bool { return c > 0 })},
+	"dategreaterthanequals":     {compare: date(func(c int) bool { return c >= 0 })},
+	"bool":                      {compare: strings.EqualFold},
+	"binaryequals":              {compare: stringEquals},
+	"ipaddress":                 {compare: ipInRange},
+	"notipaddress":              {compare: ipInRange, negated: true},
+	"arnequals":                 {compare: stringLike},
+	"arnlike":                   {compare: stringLike},
+	"arnnotequals":              {compare: stringLike, negated: true},
+	"arnnotlike":                {compare: stringLike, negated: true},
+}
+
+// conditions evaluates a statement's Condition element: every operator and
+// key must hold. Conditions on unknown keys, and operators this evaluator
+// does not implement, may or may not hold.
+func (c *requestContext) conditions(conds map[string]interface{}) tristate {
+	result := yes
+	for op, keys := range conds {
+		byKey, ok := keys.(map[string]interface{})
+		if !ok {
+			return maybe
+		}
+		for key, raw := range byKey {
+			policyValues := conditionValues(raw)
+			for i, v := range policyValues {
+				if s, ok := c.substitute(v); ok {
+					policyValues[i] = s
+				}
+			}
+			result = minOf(result, c.condition(op, key, policyValues))
+			if result == no {
+				return no
+			}
+		}
+	}
+	return result
+}
+
+// condition evaluates one operator against one key
+func (c *requestContext) condition(op, key string, policyValues []string) tristate {
+	name := strings.ToLower(op)
+	forAll := false
+	forAny := false
+	if rest, ok := strings.CutPrefix(name, "forallvalues:"); ok {
+		name, forAll = rest, true
+	} else if rest, ok := strings.CutPrefix(name, "foranyvalue:"); ok {
+		name, forAny = rest, true
+	}
+	ifExists := false
+	if rest, ok := strings.CutSuffix(name, "ifexists"); ok {
+		name, ifExists = rest, true
+	}
+
+	values, known := c.lookup(key)
+	if !known {
+		return maybe
+	}
+
+	if name == "null" {
+		// Null: "true" requires the key to be absent, "false" present
+		for _, v := range policyValues {
+			if strings.EqualFold(v, "true") == (len(values) == 0) {
+				return yes
+			}
+		}
+		return no
+	}
+
+	operator, ok := conditionOperators[name]
+	if !ok {
+		return maybe
+	}
+
+	if len(values) == 0 {
+		switch {
+		case ifExists, forAll:
+			return yes
+		case forAny:
+			return no
+		}
+		return toTristate(operator.negated)
+	}
+
+	// holds reports whether a single context value satisfies the operator
+	holds := func(value string) bool {
+		for _, p := range policyValues {
+			if operator.compare(value, p) {
+				return !operator.negated
+			}
+		}
+		return operator.negated
+	}
+
+	if forAll {
+		for _, v := range values {
+			if !holds(v) {
+				return no
+			}
+		}
+		return yes
+	}
+	for _, v := range values {
+		if holds(v) {
+			return yes
+		}
+	}
+	return no
+}
+
+func toTristate(b bool) tristate {
+	if b {
+		return yes
+	}
+	return no
+}
+
+// conditionValues converts a condition value from policy JSON, a scalar or
+// a list of scalars, to strings
+func conditionValues(raw interface{}) []string {
+	switch v := raw.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+func stringEquals(value, policy string) bool {
+	return value == policy
+}
+
+func stringLike(value, policy string) bool {
+	return newGlob(policy).match(value)
+}
+
+// numeric builds a comparison of two numbers from a test on their ordering
+func numeric(test func(int) bool) func(value, policy string) bool {
+	return func(value, policy string) bool {
+		a, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		b, err := strconv.ParseFloat(policy, 64)
+		if err != nil {
+			return false
+		}
+		return test(compareFloats(a, b))
+	}
+}
+
+// date builds a comparison of two dates from a test on their ordering
+func date(test func(int) bool) func(value, policy string) bool {
+	return func(value, policy string) bool {
+		a, ok := parseConditionDate(value)
+		if !ok {
+			return false
+		}
+		b, ok := parseConditionDate(policy)
+		if !ok {
+			return false
+		}
+		return test(a.Compare(b))
+	}
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// parseConditionDate parses the date forms policies use: ISO 8601 or epoch
+// seconds
+func parseConditionDate(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0), true
+	}
+	return time.Time{}, false
+}
+
+// ipInRange reports whether value is an address within the CIDR or single
+// address policy
+func ipInRange(value, policy string) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	if !strings.Contains(policy, "/") {
+		return ip.Equal(net.ParseIP(policy))
+	}
+	_, network, err := net.ParseCIDR(policy)
+	if err != nil {
+		return false
+	}
+	return network.Contains(ip)
+}
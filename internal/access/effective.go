@@ -0,0 +1,204 @@
+package access
+
+import (
+	"strings"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+// DataAction is an action that reads, changes or controls access to the data
+// held in an asset
+type DataAction struct {
+	Action string
+	Level  models.PermissionLevel
+	// ObjectLevel actions target the objects in a bucket, not the bucket
+	ObjectLevel bool
+	// DataPlane actions are Azure data actions, which roles grant apart
+	// from control plane actions
+	DataPlane bool
+}
+
+// Services of the data assets outside AWS, which have no ARNs
+const (
+	serviceAzureStorage = "Microsoft.Storage"
+	serviceGCS          = "storage.googleapis.com"
+)
+
+// dataActions lists the data actions evaluated for each service's assets
+var dataActions = map[string][]DataAction{
+	"s3": {
+		{Action: "s3:GetObject", Level: models.PermissionRead, ObjectLevel: true},
+		{Action: "s3:GetObjectVersion", Level: models.PermissionRead, ObjectLevel: true},
+		{Action: "s3:ListBucket", Level: models.PermissionRead},
+		{Action: "s3:ListBucketVersions", Level: models.PermissionRead},
+		{Action: "s3:PutObject", Level: models.PermissionWrite, ObjectLevel: true},
+		{Action: "s3:DeleteObject", Level: models.PermissionWrite, ObjectLevel: true},
+		{Action: "s3:DeleteObjectVersion", Level: models.PermissionWrite, ObjectLevel: true},
+		{Action: "s3:RestoreObject", Level: models.PermissionWrite, ObjectLevel: true},
+		{Action: "s3:PutObjectAcl", Level: models.PermissionAdmin, ObjectLevel: true},
+		{Action: "s3:PutBucketPolicy", Level: models.PermissionAdmin},
+		{Action: "s3:DeleteBucketPolicy", Level: models.PermissionAdmin},
+		{Action: "s3:PutBucketAcl", Level: models.PermissionAdmin},
+		{Action: "s3:PutBucketPublicAccessBlock", Level: models.PermissionAdmin},
+		{Action: "s3:PutEncryptionConfiguration", Level: models.PermissionAdmin},
+		{Action: "s3:DeleteBucket", Level: models.PermissionAdmin},
+	},
+	"dynamodb": {
+		{Action: "dynamodb:GetItem", Level: models.PermissionRead},
+		{Action: "dynamodb:BatchGetItem", Level: models.PermissionRead},
+		{Action: "dynamodb:Query", Level: models.PermissionRead},
+		{Action: "dynamodb:Scan", Level: models.PermissionRead},
+		{Action: "dynamodb:ExportTableToPointInTime", Level: models.PermissionRead},
+		{Action: "dynamodb:PutItem", Level: models.PermissionWrite},
+		{Action: "dynamodb:UpdateItem", Level: models.PermissionWrite},
+		{Action: "dynamodb:DeleteItem", Level: models.PermissionWrite},
+		{Action: "dynamodb:BatchWriteItem", Level: models.PermissionWrite},
+		{Action: "dynamodb:UpdateTable", Level: models.PermissionAdmin},
+		{Action: "dynamodb:DeleteTable", Level: models.PermissionAdmin},
+		{Action: "dynamodb:PutResourcePolicy", Level: models.PermissionAdmin},
+		{Action: "dynamodb:DeleteResourcePolicy", Level: models.PermissionAdmin},
+	},
+	serviceAzureStorage: {
+		{Action: "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/read", Level: models.PermissionRead, DataPlane: true},
+		{Action: "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/write", Level: models.PermissionWrite, DataPlane: true},
+		{Action: "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/add/action", Level: models.PermissionWrite, DataPlane: true},
+		{Action: "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/delete", Level: models.PermissionWrite, DataPlane: true},
+		// Account keys and SAS tokens bypass RBAC and open every container
+		{Action: "Microsoft.Storage/storageAccounts/listKeys/action", Level: models.PermissionAdmin},
+		{Action: "Microsoft.Storage/storageAccounts/blobServices/generateUserDelegationKey/action", Level: models.PermissionAdmin},
+		{Action: "Microsoft.Storage/storageAccounts/blobServices/containers/write", Level: models.PermissionAdmin},
+		{Action: "Microsoft.Storage/storageAccounts/blobServices/containers/delete", Level: models.PermissionAdmin},
+		{Action: "Microsoft.Authorization/roleAssignments/write", Level: models.PermissionAdmin},
+	},
+	serviceGCS: {
+		{Action: "storage.objects.get", Level: models.PermissionRead, ObjectLevel: true},
+		{Action: "storage.objects.list", Level: models.PermissionRead},
+		{Action: "storage.objects.create", Level: models.PermissionWrite, ObjectLevel: true},
+		{Action: "storage.objects.update", Level: models.PermissionWrite, ObjectLevel: true},
+		{Action: "storage.objects.delete", Level: models.PermissionWrite, ObjectLevel: true},
+		{Action: "storage.objects.setIamPolicy", Level: models.PermissionAdmin, ObjectLevel: true},
+		{Action: "storage.buckets.setIamPolicy", Level: models.PermissionAdmin},
+		{Action: "storage.buckets.update", Level: models.PermissionAdmin},
+		{Action: "storage.buckets.delete", Level: models.PermissionAdmin},
+	},
+}
+
+// DataActionsFor returns the data actions for a resource, by the service in
+// its ARN, or for Azure resource IDs and gs:// URLs by their provider
+func DataActionsFor(resourceARN string) []DataAction {
+	switch {
+	case strings.HasPrefix(resourceARN, "gs://"):
+		return dataActions[serviceGCS]
+	case strings.Contains(strings.ToLower(resourceARN), "/providers/microsoft.storage/"):
+		return dataActions[serviceAzureStorage]
+	}
+	parts := strings.SplitN(resourceARN, ":", 4)
+	if len(parts) < 3 {
+		return nil
+	}
+	return dataActions[parts[2]]
+}
+
+// defaultContext is assumed for effective access: requests use TLS, so
+// policies denying insecure transport do not make every action conditional
+var defaultContext = map[string][]string{
+	"aws:SecureTransport": {"true"},
+}
+
+// dataRequest is the request evaluated for a data action on a resource.
+// Object actions target every object in it.
+func dataRequest(resourceARN string, action DataAction) Request {
+	req := Request{Action: action.Action, Resource: resourceARN, Context: defaultContext}
+	if action.ObjectLevel {
+		req.Resource = strings.TrimSuffix(resourceARN, "/") + "/*"
+	}
+	return req
+}
+
+// EffectiveAccess is what a principal can do to a data asset once every
+// policy governing its requests is taken into account
+type EffectiveAccess struct {
+	PrincipalARN  string `json:"principal_arn"`
+	PrincipalType string `json:"principal_type"`
+	ResourceARN   string `json:"resource_arn"`
+	// Actions are allowed outright. ConditionalActions are allowed only when
+	// conditions on request context, such as the source IP, hold.
+	Actions            []string `json:"actions"`
+	ConditionalActions []string `json:"conditional_actions,omitempty"`
+	// PermissionLevel is the highest level among the allowed actions, or
+	// FULL when every data action is allowed outright
+	PermissionLevel models.PermissionLevel `json:"permission_level"`
+	IsPublic        bool                   `json:"is_public"`
+	IsCrossAccount  bool                   `json:"is_cross_account"`
+}
+
+// EvaluateAccess evaluates every data action on a resource for a principal.
+// It returns nil when no action is allowed, even conditionally.
+func EvaluateAccess(identity *Identity, resource *Resource) *EffectiveAccess {
+	actions := DataActionsFor(resource.ARN)
+	if len(actions) == 0 {
+		return nil
+	}
+
+	access := &EffectiveAccess{
+		PrincipalARN:  identity.ARN,
+		PrincipalType: identity.Type,
+		ResourceARN:   resource.ARN,
+		IsPublic:      identity.isAnonymous(),
+		IsCrossAccount: identity.AccountID != "" && resource.AccountID != "" &&
+			identity.AccountID != resource.AccountID,
+	}
+
+	levels := make(map[models.PermissionLevel]bool)
+	for _, action := range actions {
+		switch Evaluate(identity, resource, dataRequest(resource.ARN, action)).Decision {
+		case DecisionAllow:
+			access.Actions = append(access.Actions, action.Action)
+			levels[action.Level] = true
+		case DecisionConditional:
+			access.ConditionalActions = append(access.ConditionalActions, action.Action)
+			levels[action.Level] = true
+		}
+	}
+
+	access.PermissionLevel = effectiveLevel(len(actions), len(access.Actions), levels)
+	if access.PermissionLevel == "" {
+		return nil
+	}
+	return access
+}
+
+// effectiveLevel is FULL when all of a resource's data actions are allowed
+// outright, and otherwise the highest level allowed at all
+func effectiveLevel(total, allowed int, levels map[models.PermissionLevel]bool) models.PermissionLevel {
+	switch {
+	case allowed == total:
+		return models.PermissionFull
+	case levels[models.PermissionAdmin]:
+		return models.PermissionAdmin
+	case levels[models.PermissionWrite]:
+		return models.PermissionWrite
+	case levels[models.PermissionRead]:
+		return models.PermissionRead
+	}
+	return ""
+}
+
+// ComputeEffectiveAccess evaluates every principal against every resource,
+// returning the pairs where some data action is allowed. Anonymous access
+// is evaluated for each resource as well.
+func ComputeEffectiveAccess(identities []*Identity, resources []*Resource) []EffectiveAccess {
+	principals := make([]*Identity, 0, len(identities)+1)
+	principals = append(principals, identities...)
+	principals = append(principals, AnonymousIdentity())
+
+	var results []EffectiveAccess
+	for _, resource := range resources {
+		for _, identity := range principals {
+			if access := EvaluateAccess(identity, resource); access != nil {
+				results = append(results, *access)
+			}
+		}
+	}
+	return results
+}
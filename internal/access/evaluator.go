@@ -0,0 +1,494 @@
+package access
+
+import (
+	"strings"
+
+	"github.com/qualys/dspm/internal/connectors"
+)
+
+// Decision is the outcome of evaluating a request against the policies that
+// govern it
+type Decision string
+
+const (
+	DecisionAllow Decision = "ALLOW"
+	// DecisionConditional means the request is allowed only when conditions
+	// on context the evaluation was not given, such as the source IP, hold
+	DecisionConditional  Decision = "CONDITIONAL"
+	DecisionExplicitDeny Decision = "EXPLICIT_DENY"
+	DecisionImplicitDeny Decision = "IMPLICIT_DENY"
+)
+
+// Principal types an Identity can have besides the USER and ROLE principals
+// found in IAM
+const (
+	PrincipalTypeService   = "SERVICE"
+	PrincipalTypeAnonymous = "ANONYMOUS"
+)
+
+// Policy sources reported on matched statements
+const (
+	SourceIdentity = "IDENTITY"
+	SourceResource = "RESOURCE"
+	SourceBoundary = "PERMISSIONS_BOUNDARY"
+	SourceSCP      = "SCP"
+)
+
+// Identity is a principal together with the policies that govern its
+// requests
+type Identity struct {
+	// ARN is the principal's ARN, or the service name such as
+	// "s3.amazonaws.com" for service principals
+	ARN       string
+	AccountID string
+	Type      string // USER, ROLE, SERVICE or ANONYMOUS
+	OrgID     string
+	Tags      map[string]string
+
+	// Policies are the identity-based policies in effect for the principal,
+	// attached directly or through its groups
+	Policies            []*connectors.PolicyDocument
+	PermissionsBoundary *connectors.PolicyDocument
+	// SCPs holds the service control policies attached at each level of the
+	// organization above the principal's account, root first. Every level
+	// must allow a request.
+	SCPs [][]*connectors.PolicyDocument
+}
+
+// AnonymousIdentity returns the identity of unauthenticated requests, which
+// only resource policies granting to "*" allow
+func AnonymousIdentity() *Identity {
+	return &Identity{Type: PrincipalTypeAnonymous}
+}
+
+func (id *Identity) isAnonymous() bool {
+	return id.Type == PrincipalTypeAnonymous
+}
+
+func (id *Identity) isService() bool {
+	return id.Type == PrincipalTypeService
+}
+
+// Resource is a data asset and the resource-based policy attached to it
+type Resource struct {
+	ARN string
+	// AccountID owns the resource. S3 ARNs carry no account, so it must be
+	// set for cross-account requests to be recognized.
+	AccountID string
+	Policy    *connectors.PolicyDocument
+}
+
+// Request is a single action against a resource
+type Request struct {
+	Action string
+	// Resource is the ARN the action targets, defaulting to the resource's
+	// ARN. An ARN ending in "/*" stands for every object under it: a policy
+	// covering only some of them allows the request conditionally.
+	Resource string
+	// Context holds the request's condition key values. Keys are
+	// case-insensitive. Keys describing the principal and the resource
+	// account are filled in from the identity and resource.
+	Context map[string][]string
+	// Complete says Context holds every key the request carries. Otherwise
+	// conditions on absent keys are unknown and make decisions conditional.
+	Complete bool
+}
+
+// MatchedStatement is a policy statement that applied to a request
+type MatchedStatement struct {
+	Source string
+	SID    string
+	Effect string
+	// Conditional is set when the statement applies only if conditions on
+	// unknown context hold
+	Conditional bool
+}
+
+// Evaluation is the result of evaluating a request
+type Evaluation struct {
+	Decision Decision
+	// Statements are the statements behind the decision: the denies for an
+	// explicit deny, otherwise the allows
+	Statements []MatchedStatement
+}
+
+// tristate is the outcome of a check that may depend on unknown context
+type tristate int
+
+const (
+	no tristate = iota
+	maybe
+	yes
+)
+
+func not(t tristate) tristate {
+	return yes - t
+}
+
+func minOf(values ...tristate) tristate {
+	m := yes
+	for _, v := range values {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func maxOf(values ...tristate) tristate {
+	m := no
+	for _, v := range values {
+		if v > m {
+			m = v
+		}
+	}
+	return m
+}
+
+// Evaluate decides a request following AWS policy evaluation logic: an
+// explicit deny in any policy wins; otherwise every SCP level and the
+// permissions boundary must allow, together with the identity policies or,
+// within the resource's account, a resource policy naming the principal.
+// Cross-account requests need both an identity and a resource policy allow.
+// Anonymous and service principals are allowed by resource policies only.
+func Evaluate(identity *Identity, resource *Resource, req Request) Evaluation {
+	if req.Resource == "" {
+		req.Resource = resource.ARN
+	}
+	e := &evaluation{
+		identity: identity,
+		resource: resource,
+		req:      req,
+		ctx:      newRequestContext(identity, resource, req),
+	}
+
+	scopedByAccount := !identity.isAnonymous() && !identity.isService()
+
+	// Explicit denies
+	deny := no
+	var denies []MatchedStatement
+	collectDenies := func(source string, docs ...*connectors.PolicyDocument) {
+		t, matched := e.policies(source, "Deny", docs...)
+		deny = maxOf(deny, t)
+		denies = append(denies, matched...)
+	}
+	if scopedByAccount {
+		collectDenies(SourceIdentity, identity.Policies...)
+		collectDenies(SourceBoundary, identity.PermissionsBoundary)
+		for _, level := range identity.SCPs {
+			collectDenies(SourceSCP, level...)
+		}
+	}
+	collectDenies(SourceResource, resource.Policy)
+	if deny == yes {
+		return Evaluation{Decision: DecisionExplicitDeny, Statements: denies}
+	}
+
+	// Allows
+	var allows []MatchedStatement
+	resourceAllow, matched := e.policies(SourceResource, "Allow", resource.Policy)
+	allows = append(allows, matched...)
+
+	allow := resourceAllow
+	if scopedByAccount {
+		identityAllow, matched := e.policies(SourceIdentity, "Allow", identity.Policies...)
+		allows = append(allows, matched...)
+
+		boundary := yes
+		if identity.PermissionsBoundary != nil {
+			boundary, _ = e.policies(SourceBoundary, "Allow", identity.PermissionsBoundary)
+		}
+		scp := yes
+		for _, level := range identity.SCPs {
+			levelAllow, _ := e.policies(SourceSCP, "Allow", level...)
+			scp = minOf(scp, levelAllow)
+		}
+
+		if e.crossAccount() {
+			allow = minOf(scp, boundary, identityAllow, resourceAllow)
+		} else {
+			allow = minOf(scp, maxOf(minOf(identityAllow, boundary), resourceAllow))
+		}
+	}
+
+	switch {
+	case allow == no:
+		return Evaluation{Decision: DecisionImplicitDeny}
+	case allow == yes && deny == no:
+		return Evaluation{Decision: DecisionAllow, Statements: allows}
+	default:
+		// Either the allow or a deny depends on unknown context
+		return Evaluation{Decision: DecisionConditional, Statements: append(allows, denies...)}
+	}
+}
+
+// evaluation holds the state of a single Evaluate call
+type evaluation struct {
+	identity *Identity
+	resource *Resource
+	req      Request
+	ctx      *requestContext
+}
+
+// crossAccount reports whether the principal and resource are in different
+// accounts. An unknown account on either side counts as the same account.
+func (e *evaluation) crossAccount() bool {
+	return e.identity.AccountID != "" && e.resource.AccountID != "" &&
+		e.identity.AccountID != e.resource.AccountID
+}
+
+// policies returns how far statements with the given effect in docs apply
+// to the request, and the statements that may apply
+func (e *evaluation) policies(source, effect string, docs ...*connectors.PolicyDocument) (tristate, []MatchedStatement) {
+	result := no
+	var matched []MatchedStatement
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		for _, stmt := range doc.Statements {
+			if !strings.EqualFold(stmt.Effect, effect) {
+				continue
+			}
+			t := e.statement(source, effect, &stmt)
+			if t == no {
+				continue
+			}
+			result = maxOf(result, t)
+			matched = append(matched, MatchedStatement{
+				Source:      source,
+				SID:         stmt.SID,
+				Effect:      stmt.Effect,
+				Conditional: t == maybe,
+			})
+		}
+	}
+	return result, matched
+}
+
+// statement returns how far a statement applies to the request
+func (e *evaluation) statement(source, effect string, stmt *connectors.PolicyStatement) tristate {
+	if !e.matchAction(stmt) {
+		return no
+	}
+	t := e.matchResource(stmt)
+	if t == no {
+		return no
+	}
+	if source == SourceResource {
+		switch e.matchPrincipal(stmt) {
+		case principalNone:
+			return no
+		case principalAccount:
+			// Granting to the principal's own account delegates the decision
+			// to its identity policies rather than allowing by itself
+			if effect == "Allow" && !e.crossAccount() {
+				return no
+			}
+		}
+	}
+	return minOf(t, e.ctx.conditions(stmt.Conditions))
+}
+
+func (e *evaluation) matchAction(stmt *connectors.PolicyStatement) bool {
+	action := strings.ToLower(e.req.Action)
+	if len(stmt.NotActions) > 0 {
+		for _, pattern := range stmt.NotActions {
+			if newGlob(strings.ToLower(pattern)).match(action) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, pattern := range stmt.Actions {
+		if newGlob(strings.ToLower(pattern)).match(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchResource matches the statement's Resource or NotResource element. A
+// statement without either applies to the resource its policy is attached
+// to, as resource policies may omit it.
+func (e *evaluation) matchResource(stmt *connectors.PolicyStatement) tristate {
+	if len(stmt.NotResources) > 0 {
+		return not(e.matchResourcePatterns(stmt.NotResources))
+	}
+	if len(stmt.Resources) == 0 {
+		return yes
+	}
+	return e.matchResourcePatterns(stmt.Resources)
+}
+
+func (e *evaluation) matchResourcePatterns(patterns []string) tristate {
+	result := no
+	for _, pattern := range patterns {
+		pattern, ok := e.ctx.substitute(pattern)
+		if !ok {
+			// A policy variable without a value never matches
+			continue
+		}
+		result = maxOf(result, matchARN(pattern, e.req.Resource))
+	}
+	return result
+}
+
+// matchARN matches a resource pattern against the request resource. When
+// the resource ends in "/*" it stands for every object under it, which the
+// pattern covers entirely, partly or not at all.
+func matchARN(pattern, resource string) tristate {
+	g := newGlob(pattern)
+	prefix, isWildcard := strings.CutSuffix(resource, "/*")
+	if !isWildcard {
+		if g.match(resource) {
+			return yes
+		}
+		return no
+	}
+	return g.matchPrefix(prefix + "/")
+}
+
+// principalMatch is how a resource policy statement names the identity
+type principalMatch int
+
+const (
+	principalNone principalMatch = iota
+	// principalAccount: the statement names the identity's account
+	principalAccount
+	// principalDirect: the statement names the identity itself or everyone
+	principalDirect
+)
+
+// matchPrincipal matches the Principal or NotPrincipal element of a
+// resource policy statement against the identity
+func (e *evaluation) matchPrincipal(stmt *connectors.PolicyStatement) principalMatch {
+	id := e.identity
+	if len(stmt.NotPrincipals) > 0 {
+		for _, p := range stmt.NotPrincipals {
+			if matchAWSPrincipal(p, id) != principalNone {
+				return principalNone
+			}
+		}
+		return principalDirect
+	}
+	if id.isService() {
+		for _, p := range stmt.ServicePrincipals {
+			if strings.EqualFold(p, id.ARN) {
+				return principalDirect
+			}
+		}
+	}
+	for _, p := range stmt.FederatedPrincipals {
+		if p == id.ARN {
+			return principalDirect
+		}
+	}
+	result := principalNone
+	for _, p := range stmt.Principals {
+		if m := matchAWSPrincipal(p, id); m > result {
+			result = m
+		}
+	}
+	return result
+}
+
+// matchAWSPrincipal matches an AWS principal: "*" matches everyone, an
+// account ID or root ARN any principal in the account, and a role ARN the
+// role's sessions as well as the role
+func matchAWSPrincipal(principal string, id *Identity) principalMatch {
+	if principal == "*" {
+		return principalDirect
+	}
+	if id.isAnonymous() || id.isService() {
+		return principalNone
+	}
+	if id.AccountID != "" && (principal == id.AccountID || principal == "arn:aws:iam::"+id.AccountID+":root") {
+		return principalAccount
+	}
+	if principal == id.ARN || sessionRoleMatches(principal, id.ARN) {
+		return principalDirect
+	}
+	return principalNone
+}
+
+// sessionRoleMatches reports whether arn is a session of the role roleARN.
+// Session ARNs drop the role's path.
+func sessionRoleMatches(roleARN, arn string) bool {
+	// arn:aws:sts::123456789012:assumed-role/RoleName/session
+	session := strings.SplitN(arn, ":", 6)
+	role := strings.SplitN(roleARN, ":", 6)
+	if len(session) != 6 || len(role) != 6 || session[2] != "sts" || role[2] != "iam" {
+		return false
+	}
+	if session[4] != role[4] {
+		return false
+	}
+	sessionParts := strings.Split(session[5], "/")
+	roleParts := strings.Split(role[5], "/")
+	if len(sessionParts) < 2 || sessionParts[0] != "assumed-role" || roleParts[0] != "role" {
+		return false
+	}
+	return sessionParts[1] == roleParts[len(roleParts)-1]
+}
+
+// glob matches strings against a pattern where "*" matches any run of
+// characters and "?" any single character
+type glob struct {
+	pattern string
+}
+
+func newGlob(pattern string) glob {
+	return glob{pattern: pattern}
+}
+
+func (g glob) match(s string) bool {
+	states := g.run(s)
+	return states[len(g.pattern)]
+}
+
+// matchPrefix returns yes when the pattern matches every string starting
+// with prefix, maybe when it matches some of them and no otherwise
+func (g glob) matchPrefix(prefix string) tristate {
+	states := g.run(prefix)
+	result := no
+	for pos := range states {
+		if pos < len(g.pattern) && strings.Trim(g.pattern[pos:], "*") == "" {
+			return yes
+		}
+		// Any remaining pattern can be completed by some suffix
+		result = maybe
+	}
+	return result
+}
+
+// run returns the pattern positions reachable after consuming s
+func (g glob) run(s string) map[int]bool {
+	states := g.closure(map[int]bool{0: true})
+	for i := 0; i < len(s) && len(states) > 0; i++ {
+		next := make(map[int]bool)
+		for pos := range states {
+			if pos >= len(g.pattern) {
+				continue
+			}
+			switch c := g.pattern[pos]; {
+			case c == '*':
+				next[pos] = true
+			case c == '?' || c == s[i]:
+				next[pos+1] = true
+			}
+		}
+		states = g.closure(next)
+	}
+	return states
+}
+
+// closure adds the positions reachable by letting a "*" match nothing
+func (g glob) closure(states map[int]bool) map[int]bool {
+	for pos := range states {
+		for p := pos; p < len(g.pattern) && g.pattern[p] == '*'; p++ {
+			states[p+1] = true
+		}
+	}
+	return states
+}
@@ -0,0 +1,267 @@
+package access
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// fixture is a policy evaluation scenario in testdata/iam: one identity,
+// one resource and the requests evaluated between them
+type fixture struct {
+	Description string `json:"description"`
+	Identity    struct {
+		ARN                 string              `json:"arn"`
+		AccountID           string              `json:"account_id"`
+		Type                string              `json:"type"`
+		OrgID               string              `json:"org_id"`
+		Tags                map[string]string   `json:"tags"`
+		Policies            []json.RawMessage   `json:"policies"`
+		PermissionsBoundary json.RawMessage     `json:"permissions_boundary"`
+		SCPs                [][]json.RawMessage `json:"scps"`
+	} `json:"identity"`
+	Resource struct {
+		ARN       string          `json:"arn"`
+		AccountID string          `json:"account_id"`
+		Policy    json.RawMessage `json:"policy"`
+	} `json:"resource"`
+	Cases []struct {
+		Name     string              `json:"name"`
+		Action   string              `json:"action"`
+		Resource string              `json:"resource"`
+		Context  map[string][]string `json:"context"`
+		Complete bool                `json:"complete"`
+		Expected Decision            `json:"expected"`
+	} `json:"cases"`
+}
+
+func parsePolicy(t *testing.T, raw json.RawMessage) *connectors.PolicyDocument {
+	t.Helper()
+	if len(raw) == 0 {
+		return nil
+	}
+	doc, err := connectors.ParsePolicyDocument(string(raw))
+	if err != nil {
+		t.Fatalf("ParsePolicyDocument: %v", err)
+	}
+	return doc
+}
+
+func loadFixture(t *testing.T, path string) (*fixture, *Identity, *Resource) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatalf("parsing fixture: %v", err)
+	}
+
+	identity := &Identity{
+		ARN:                 f.Identity.ARN,
+		AccountID:           f.Identity.AccountID,
+		Type:                f.Identity.Type,
+		OrgID:               f.Identity.OrgID,
+		Tags:                f.Identity.Tags,
+		PermissionsBoundary: parsePolicy(t, f.Identity.PermissionsBoundary),
+	}
+	for _, raw := range f.Identity.Policies {
+		identity.Policies = append(identity.Policies, parsePolicy(t, raw))
+	}
+	for _, level := range f.Identity.SCPs {
+		var docs []*connectors.PolicyDocument
+		for _, raw := range level {
+			docs = append(docs, parsePolicy(t, raw))
+		}
+		identity.SCPs = append(identity.SCPs, docs)
+	}
+
+	resource := &Resource{
+		ARN:       f.Resource.ARN,
+		AccountID: f.Resource.AccountID,
+		Policy:    parsePolicy(t, f.Resource.Policy),
+	}
+	return &f, identity, resource
+}
+
+func TestEvaluate_Fixtures(t *testing.T) {
+	paths, err := filepath.Glob("testdata/iam/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("expected fixtures in testdata/iam")
+	}
+
+	for _, path := range paths {
+		f, identity, resource := loadFixture(t, path)
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			for _, tc := range f.Cases {
+				eval := Evaluate(identity, resource, Request{
+					Action:   tc.Action,
+					Resource: tc.Resource,
+					Context:  tc.Context,
+					Complete: tc.Complete,
+				})
+				if eval.Decision != tc.Expected {
+					t.Errorf("%s: expected %s, got %s (%+v)", tc.Name, tc.Expected, eval.Decision, eval.Statements)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluate_MatchedStatements(t *testing.T) {
+	_, identity, resource := loadFixture(t, "testdata/iam/deny_precedence.json")
+
+	eval := Evaluate(identity, resource, Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::customer-data/secret/a"})
+	if len(eval.Statements) != 1 || eval.Statements[0].SID != "DenySecrets" || eval.Statements[0].Source != SourceResource {
+		t.Errorf("expected the DenySecrets resource statement, got %+v", eval.Statements)
+	}
+
+	eval = Evaluate(identity, resource, Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::customer-data/*"})
+	var conditionalDeny bool
+	for _, s := range eval.Statements {
+		if s.SID == "DenySecrets" && s.Conditional {
+			conditionalDeny = true
+		}
+	}
+	if !conditionalDeny {
+		t.Errorf("expected DenySecrets reported as conditional, got %+v", eval.Statements)
+	}
+}
+
+func mustPolicy(t *testing.T, raw string) *connectors.PolicyDocument {
+	t.Helper()
+	doc, err := connectors.ParsePolicyDocument(raw)
+	if err != nil {
+		t.Fatalf("ParsePolicyDocument: %v", err)
+	}
+	return doc
+}
+
+func TestComputeEffectiveAccess(t *testing.T) {
+	bucket := &Resource{
+		ARN:       "arn:aws:s3:::customer-data",
+		AccountID: "111111111111",
+		Policy: mustPolicy(t, `{"Statement": [
+			{"Effect": "Deny", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::customer-data/*",
+			 "Condition": {"Bool": {"aws:SecureTransport": "false"}}},
+			{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::customer-data/public/*"}
+		]}`),
+	}
+	table := &Resource{ARN: "arn:aws:dynamodb:us-east-1:111111111111:table/orders", AccountID: "111111111111"}
+
+	// IAM returns policy versions URL-encoded
+	admin := &Identity{
+		ARN:       "arn:aws:iam::111111111111:role/admin",
+		AccountID: "111111111111",
+		Type:      "ROLE",
+		Policies: []*connectors.PolicyDocument{mustPolicy(t,
+			"%7B%22Statement%22%3A%7B%22Effect%22%3A%22Allow%22%2C%22Action%22%3A%22%2A%22%2C%22Resource%22%3A%22%2A%22%7D%7D")},
+	}
+	reader := &Identity{
+		ARN:       "arn:aws:iam::111111111111:user/analyst",
+		AccountID: "111111111111",
+		Type:      "USER",
+		Policies: []*connectors.PolicyDocument{mustPolicy(t, `{"Statement": [
+			{"Effect": "Allow", "Action": ["s3:GetObject", "s3:ListBucket"], "Resource": ["arn:aws:s3:::customer-data", "arn:aws:s3:::customer-data/*"]},
+			{"Effect": "Allow", "Action": "dynamodb:Query", "Resource": "*", "Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}}
+		]}`)},
+	}
+
+	results := ComputeEffectiveAccess([]*Identity{admin, reader}, []*Resource{bucket, table})
+
+	type key struct{ principal, resource string }
+	byPair := make(map[key]EffectiveAccess)
+	for _, r := range results {
+		byPair[key{r.PrincipalARN, r.ResourceARN}] = r
+	}
+	if len(byPair) != 5 {
+		t.Fatalf("expected 5 principal/resource pairs, got %d: %+v", len(byPair), results)
+	}
+
+	tests := []struct {
+		principal   string
+		resource    string
+		level       models.PermissionLevel
+		actions     int
+		conditional []string
+		public      bool
+	}{
+		{admin.ARN, bucket.ARN, models.PermissionFull, len(dataActions["s3"]), nil, false},
+		{admin.ARN, table.ARN, models.PermissionFull, len(dataActions["dynamodb"]), nil, false},
+		{reader.ARN, bucket.ARN, models.PermissionRead, 2, nil, false},
+		{reader.ARN, table.ARN, models.PermissionRead, 0, []string{"dynamodb:Query"}, false},
+		{"", bucket.ARN, models.PermissionRead, 0, []string{"s3:GetObject"}, true},
+	}
+
+	for _, tt := range tests {
+		access, ok := byPair[key{tt.principal, tt.resource}]
+		if !ok {
+			t.Errorf("expected access for %q on %s", tt.principal, tt.resource)
+			continue
+		}
+		if access.PermissionLevel != tt.level {
+			t.Errorf("%q on %s: expected level %s, got %s", tt.principal, tt.resource, tt.level, access.PermissionLevel)
+		}
+		if len(access.Actions) != tt.actions {
+			t.Errorf("%q on %s: expected %d actions, got %v", tt.principal, tt.resource, tt.actions, access.Actions)
+		}
+		if len(access.ConditionalActions) != len(tt.conditional) ||
+			(len(tt.conditional) > 0 && access.ConditionalActions[0] != tt.conditional[0]) {
+			t.Errorf("%q on %s: expected conditional actions %v, got %v", tt.principal, tt.resource, tt.conditional, access.ConditionalActions)
+		}
+		if access.IsPublic != tt.public {
+			t.Errorf("%q on %s: expected public %v, got %v", tt.principal, tt.resource, tt.public, access.IsPublic)
+		}
+	}
+
+	if _, ok := byPair[key{"", table.ARN}]; ok {
+		t.Error("expected no anonymous access to a table without a resource policy")
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"*", "", true},
+		{"s3:*", "s3:GetObject", true},
+		{"s3:Get*Acl", "s3:GetObjectAcl", true},
+		{"s3:Get*Acl", "s3:GetObject", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"**x", "abx", true},
+		{"arn:aws:s3:::b/*", "arn:aws:s3:::b", false},
+	}
+	for _, tt := range tests {
+		if got := newGlob(tt.pattern).match(tt.value); got != tt.want {
+			t.Errorf("%q matching %q: expected %v, got %v", tt.pattern, tt.value, tt.want, got)
+		}
+	}
+
+	prefixTests := []struct {
+		pattern string
+		prefix  string
+		want    tristate
+	}{
+		{"arn:aws:s3:::b/*", "arn:aws:s3:::b/", yes},
+		{"arn:aws:s3:::*", "arn:aws:s3:::b/", yes},
+		{"arn:aws:s3:::b/public/*", "arn:aws:s3:::b/", maybe},
+		{"arn:aws:s3:::b/?", "arn:aws:s3:::b/", maybe},
+		{"arn:aws:s3:::other/*", "arn:aws:s3:::b/", no},
+	}
+	for _, tt := range prefixTests {
+		if got := newGlob(tt.pattern).matchPrefix(tt.prefix); got != tt.want {
+			t.Errorf("%q under %q: expected %v, got %v", tt.pattern, tt.prefix, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,651 @@
+package access
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Graph export formats
+const (
+	FormatJSON    = "json"
+	FormatGraphML = "graphml"
+	FormatCypher  = "cypher"
+)
+
+// nodeIdentity lists the properties identifying a node of each label, as
+// Neo4j merges them. A node's snapshot ID is its label and their values
+// joined by "|", which is also its key in MemoryGraph.
+var nodeIdentity = map[string][]string{
+	"CloudAccount":   {"id"},
+	"DataAsset":      {"id"},
+	"Principal":      {"arn"},
+	"Policy":         {"arn"},
+	"Classification": {"category", "sensitivity"},
+	"Function":       {"arn"},
+	"DataResource":   {"arn"},
+	"AIModel":        {"arn"},
+	"DataSource":     {"arn"},
+}
+
+// relationshipType matches the relationship types a snapshot may hold,
+// which are written into Cypher unquoted
+var relationshipType = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+
+// GraphSnapshot is the access graph, or part of it, in node-link form: the
+// JSON export format, also read by networkx's node_link_graph. Node IDs are
+// the node's label and identifying properties, such as
+// "Principal|arn:aws:iam::111111111111:role/admin" or
+// "Classification|PII|HIGH", so snapshots of different instances agree.
+type GraphSnapshot struct {
+	Directed   bool           `json:"directed"`
+	Multigraph bool           `json:"multigraph"`
+	Nodes      []SnapshotNode `json:"nodes"`
+	Links      []SnapshotLink `json:"links"`
+}
+
+// SnapshotNode is a node of a graph snapshot
+type SnapshotNode struct {
+	ID         string                 `json:"id"`
+	Label      string                 `json:"label"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// SnapshotLink is a relationship of a graph snapshot, between the nodes
+// with IDs Source and Target
+type SnapshotLink struct {
+	Source     string                 `json:"source"`
+	Target     string                 `json:"target"`
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// ExportFilter scopes a graph export
+type ExportFilter struct {
+	// AccountID keeps the nodes of one account, with the relationships
+	// touching them and the nodes at their other ends, such as principals
+	// of other accounts and classifications
+	AccountID *uuid.UUID
+	// MinSensitivity drops data assets less sensitive than it
+	MinSensitivity models.Sensitivity
+}
+
+// Validate checks the filter's sensitivity floor
+func (f ExportFilter) Validate() error {
+	if f.MinSensitivity != "" && sensitivityRank[string(f.MinSensitivity)] == 0 {
+		return fmt.Errorf("unknown sensitivity %q", f.MinSensitivity)
+	}
+	return nil
+}
+
+// snapshotNodeID returns the ID of a node from its label and properties,
+// or "" if they do not identify it
+func snapshotNodeID(label string, props map[string]interface{}) string {
+	keys, ok := nodeIdentity[label]
+	if !ok {
+		return ""
+	}
+	parts := []string{label}
+	for _, key := range keys {
+		value := fmt.Sprint(props[key])
+		if props[key] == nil || value == "" {
+			return ""
+		}
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, "|")
+}
+
+// filterSnapshot applies an export filter to a whole-graph snapshot
+func filterSnapshot(s *GraphSnapshot, f ExportFilter) *GraphSnapshot {
+	keep := make(map[string]bool, len(s.Nodes))
+	for _, n := range s.Nodes {
+		if f.MinSensitivity != "" && n.Label == "DataAsset" {
+			level, _ := n.Properties["sensitivityLevel"].(string)
+			if sensitivityRank[level] < sensitivityRank[string(f.MinSensitivity)] {
+				continue
+			}
+		}
+		keep[n.ID] = true
+	}
+
+	var links []SnapshotLink
+	for _, l := range s.Links {
+		if keep[l.Source] && keep[l.Target] {
+			links = append(links, l)
+		}
+	}
+
+	if f.AccountID != nil {
+		account := f.AccountID.String()
+		anchors := make(map[string]bool)
+		for _, n := range s.Nodes {
+			if !keep[n.ID] {
+				continue
+			}
+			if id, _ := n.Properties["accountId"].(string); id == account ||
+				(n.Label == "CloudAccount" && n.Properties["id"] == account) {
+				anchors[n.ID] = true
+			}
+		}
+		keep = make(map[string]bool, len(anchors))
+		var scoped []SnapshotLink
+		for _, l := range links {
+			if anchors[l.Source] || anchors[l.Target] {
+				scoped = append(scoped, l)
+				keep[l.Source], keep[l.Target] = true, true
+			}
+		}
+		for id := range anchors {
+			keep[id] = true
+		}
+		links = scoped
+	}
+
+	filtered := &GraphSnapshot{Directed: true, Links: links}
+	for _, n := range s.Nodes {
+		if keep[n.ID] {
+			filtered.Nodes = append(filtered.Nodes, n)
+		}
+	}
+	return filtered
+}
+
+// sortSnapshot orders nodes by ID and links by their ends and type, so
+// exports of the same graph are identical
+func sortSnapshot(s *GraphSnapshot) {
+	sort.Slice(s.Nodes, func(i, j int) bool { return s.Nodes[i].ID < s.Nodes[j].ID })
+	sort.Slice(s.Links, func(i, j int) bool {
+		a, b := s.Links[i], s.Links[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Type < b.Type
+	})
+}
+
+// WriteJSON writes the snapshot in node-link JSON
+func (s *GraphSnapshot) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Write writes the snapshot in one of the export formats
+func (s *GraphSnapshot) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		return s.WriteJSON(w)
+	case FormatGraphML:
+		return s.WriteGraphML(w)
+	case FormatCypher:
+		return s.WriteCypher(w)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// ReadSnapshot reads a snapshot exported as JSON or GraphML. Cypher exports
+// are restored by running them, for example with cypher-shell.
+func ReadSnapshot(r io.Reader, format string) (*GraphSnapshot, error) {
+	var s *GraphSnapshot
+	var err error
+	switch format {
+	case FormatJSON:
+		s, err = readJSONSnapshot(r)
+	case FormatGraphML:
+		s, err = readGraphML(r)
+	case FormatCypher:
+		return nil, fmt.Errorf("cypher exports are imported by running them against Neo4j")
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// validate checks that nodes are identified by their label and properties,
+// and that links join known nodes
+func (s *GraphSnapshot) validate() error {
+	ids := make(map[string]bool, len(s.Nodes))
+	for _, n := range s.Nodes {
+		id := snapshotNodeID(n.Label, n.Properties)
+		if id == "" {
+			return fmt.Errorf("node %q: no identifying properties for label %q", n.ID, n.Label)
+		}
+		if id != n.ID {
+			return fmt.Errorf("node %q: expected ID %q from its properties", n.ID, id)
+		}
+		ids[n.ID] = true
+	}
+	for _, l := range s.Links {
+		if !ids[l.Source] || !ids[l.Target] {
+			return fmt.Errorf("link %s from %q to %q: unknown node", l.Type, l.Source, l.Target)
+		}
+		if !relationshipType.MatchString(l.Type) {
+			return fmt.Errorf("link from %q to %q: invalid type %q", l.Source, l.Target, l.Type)
+		}
+	}
+	return nil
+}
+
+func readJSONSnapshot(r io.Reader) (*GraphSnapshot, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var s GraphSnapshot
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("parsing snapshot: %w", err)
+	}
+	for i := range s.Nodes {
+		s.Nodes[i].Properties = normalizeProps(s.Nodes[i].Properties)
+	}
+	for i := range s.Links {
+		s.Links[i].Properties = normalizeProps(s.Links[i].Properties)
+	}
+	return &s, nil
+}
+
+// normalizeProps converts decoded JSON properties to the types the graph
+// stores: whole numbers to int64 and lists of strings to []string
+func normalizeProps(props map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		out[k] = normalizeValue(v)
+	}
+	return out
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case int:
+		return int64(v)
+	case []interface{}:
+		strs := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				items := make([]interface{}, len(v))
+				for i, item := range v {
+					items[i] = normalizeValue(item)
+				}
+				return items
+			}
+			strs = append(strs, s)
+		}
+		return strs
+	}
+	return v
+}
+
+// =====================================================
+// GraphML
+// =====================================================
+
+// graphmlKey declares a property. Lists are JSON arrays in string data, as
+// attr.list marks them, following Neo4j's APOC exports.
+type graphmlKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+	AttrList string `xml:"attr.list,attr,omitempty"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	ID     string        `xml:"id,attr"`
+	Labels string        `xml:"labels,attr,omitempty"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Label  string        `xml:"label,attr,omitempty"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr,omitempty"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr,omitempty"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphmlNode `xml:"node"`
+		Edges       []graphmlEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// The data keys holding node labels and relationship types
+const (
+	graphmlLabelsKey = "labels"
+	graphmlTypeKey   = "label"
+)
+
+// WriteGraphML writes the snapshot as GraphML. Node labels are in the
+// labels attribute and data, and relationship types in the label attribute
+// and data, as Neo4j and Gephi read them.
+func (s *GraphSnapshot) WriteGraphML(w io.Writer) error {
+	doc := graphmlDocument{XMLNS: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Graph.ID = "G"
+	doc.Graph.EdgeDefault = "directed"
+
+	keys := map[string]graphmlKey{
+		"node " + graphmlLabelsKey: {ID: graphmlLabelsKey, For: "node", AttrName: graphmlLabelsKey, AttrType: "string"},
+		"edge " + graphmlTypeKey:   {ID: graphmlTypeKey, For: "edge", AttrName: graphmlTypeKey, AttrType: "string"},
+	}
+	// data encodes properties, declaring a key for each name and domain
+	data := func(domain string, props map[string]interface{}) ([]graphmlData, error) {
+		var out []graphmlData
+		for _, name := range sortedKeys(props) {
+			value, attrType, list, err := graphmlValue(props[name])
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", name, err)
+			}
+			id := domain + "_" + name
+			if _, ok := keys[domain+" "+name]; !ok {
+				keys[domain+" "+name] = graphmlKey{ID: id, For: domain, AttrName: name, AttrType: attrType, AttrList: list}
+			}
+			out = append(out, graphmlData{Key: id, Value: value})
+		}
+		return out, nil
+	}
+
+	for _, n := range s.Nodes {
+		d, err := data("node", n.Properties)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphmlNode{
+			ID:     n.ID,
+			Labels: ":" + n.Label,
+			Data:   append([]graphmlData{{Key: graphmlLabelsKey, Value: ":" + n.Label}}, d...),
+		})
+	}
+	for _, l := range s.Links {
+		d, err := data("edge", l.Properties)
+		if err != nil {
+			return fmt.Errorf("link %s: %w", l.Type, err)
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{
+			Source: l.Source,
+			Target: l.Target,
+			Label:  l.Type,
+			Data:   append([]graphmlData{{Key: graphmlTypeKey, Value: l.Type}}, d...),
+		})
+	}
+	for _, k := range sortedKeys(keys) {
+		doc.Keys = append(doc.Keys, keys[k])
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// graphmlValue encodes a property value with its GraphML type
+func graphmlValue(v interface{}) (value, attrType, list string, err error) {
+	switch v := v.(type) {
+	case string:
+		return v, "string", "", nil
+	case bool:
+		return strconv.FormatBool(v), "boolean", "", nil
+	case int:
+		return strconv.Itoa(v), "long", "", nil
+	case int64:
+		return strconv.FormatInt(v, 10), "long", "", nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), "double", "", nil
+	case json.Number:
+		return v.String(), "double", "", nil
+	case []string, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", "", "", err
+		}
+		return string(data), "string", "string", nil
+	}
+	return "", "", "", fmt.Errorf("unsupported value %T", v)
+}
+
+// readGraphML reads a snapshot written by WriteGraphML
+func readGraphML(r io.Reader) (*GraphSnapshot, error) {
+	var doc graphmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing graphml: %w", err)
+	}
+
+	keys := make(map[string]graphmlKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		keys[k.ID] = k
+	}
+	props := func(data []graphmlData, skip string) (map[string]interface{}, error) {
+		out := make(map[string]interface{})
+		for _, d := range data {
+			if d.Key == skip {
+				continue
+			}
+			k, ok := keys[d.Key]
+			if !ok {
+				return nil, fmt.Errorf("undeclared key %q", d.Key)
+			}
+			v, err := parseGraphMLValue(k, d.Value)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", d.Key, err)
+			}
+			out[k.AttrName] = v
+		}
+		return out, nil
+	}
+
+	s := &GraphSnapshot{Directed: true}
+	for _, n := range doc.Graph.Nodes {
+		p, err := props(n.Data, graphmlLabelsKey)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		labels := n.Labels
+		for _, d := range n.Data {
+			if d.Key == graphmlLabelsKey && labels == "" {
+				labels = d.Value
+			}
+		}
+		// A node has one label, written ":Label"
+		label, _, _ := strings.Cut(strings.TrimPrefix(labels, ":"), ":")
+		s.Nodes = append(s.Nodes, SnapshotNode{ID: n.ID, Label: label, Properties: p})
+	}
+	for _, e := range doc.Graph.Edges {
+		p, err := props(e.Data, graphmlTypeKey)
+		if err != nil {
+			return nil, fmt.Errorf("edge %s: %w", e.Label, err)
+		}
+		s.Links = append(s.Links, SnapshotLink{Source: e.Source, Target: e.Target, Type: e.Label, Properties: p})
+	}
+	return s, nil
+}
+
+func parseGraphMLValue(k graphmlKey, value string) (interface{}, error) {
+	if k.AttrList != "" {
+		if value == "null" {
+			return nil, nil
+		}
+		var items []interface{}
+		if err := json.Unmarshal([]byte(value), &items); err != nil {
+			return nil, err
+		}
+		return normalizeValue(items), nil
+	}
+	switch k.AttrType {
+	case "boolean":
+		return strconv.ParseBool(value)
+	case "int", "long":
+		return strconv.ParseInt(value, 10, 64)
+	case "float", "double":
+		return strconv.ParseFloat(value, 64)
+	}
+	return value, nil
+}
+
+// =====================================================
+// Cypher
+// =====================================================
+
+// cypherIdentifier matches names used in Cypher unquoted
+var cypherIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// WriteCypher writes the snapshot as Cypher statements that recreate it in
+// Neo4j: a CREATE per node, then a MATCH of each relationship's ends by
+// their identifying properties and a CREATE of the relationship. Run it
+// against an empty database.
+func (s *GraphSnapshot) WriteCypher(w io.Writer) error {
+	var buf bytes.Buffer
+	nodes := make(map[string]SnapshotNode, len(s.Nodes))
+	for _, n := range s.Nodes {
+		if _, ok := nodeIdentity[n.Label]; !ok {
+			return fmt.Errorf("node %s: unknown label %q", n.ID, n.Label)
+		}
+		nodes[n.ID] = n
+		props, err := cypherMap(n.Properties)
+		if err != nil {
+			return fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		fmt.Fprintf(&buf, "CREATE (:%s %s);\n", n.Label, props)
+	}
+
+	// match identifies a node by the properties Neo4j merges it on
+	match := func(id string) (string, error) {
+		n, ok := nodes[id]
+		if !ok {
+			return "", fmt.Errorf("unknown node %q", id)
+		}
+		identity := make(map[string]interface{})
+		for _, key := range nodeIdentity[n.Label] {
+			identity[key] = n.Properties[key]
+		}
+		props, err := cypherMap(identity)
+		if err != nil {
+			return "", err
+		}
+		return ":" + n.Label + " " + props, nil
+	}
+	for _, l := range s.Links {
+		if !relationshipType.MatchString(l.Type) {
+			return fmt.Errorf("link from %s: invalid type %q", l.Source, l.Type)
+		}
+		source, err := match(l.Source)
+		if err != nil {
+			return fmt.Errorf("link %s: %w", l.Type, err)
+		}
+		target, err := match(l.Target)
+		if err != nil {
+			return fmt.Errorf("link %s: %w", l.Type, err)
+		}
+		props, err := cypherMap(l.Properties)
+		if err != nil {
+			return fmt.Errorf("link %s: %w", l.Type, err)
+		}
+		fmt.Fprintf(&buf, "MATCH (a%s), (b%s) CREATE (a)-[:%s %s]->(b);\n", source, target, l.Type, props)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// cypherMap formats properties as a Cypher map literal
+func cypherMap(props map[string]interface{}) (string, error) {
+	parts := make([]string, 0, len(props))
+	for _, k := range sortedKeys(props) {
+		value, err := cypherValue(props[k])
+		if err != nil {
+			return "", fmt.Errorf("property %s: %w", k, err)
+		}
+		name := k
+		if !cypherIdentifier.MatchString(k) {
+			name = "`" + strings.ReplaceAll(k, "`", "``") + "`"
+		}
+		parts = append(parts, name+": "+value)
+	}
+	return "{" + strings.Join(parts, ", ") + "}", nil
+}
+
+// cypherValue formats a property value as a Cypher literal. JSON string
+// escapes are valid in Cypher strings.
+func cypherValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		data, _ := json.Marshal(v)
+		return string(data), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s, nil
+	case json.Number:
+		return v.String(), nil
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, s := range v {
+			items[i] = s
+		}
+		return cypherValue(items)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			s, err := cypherValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("unsupported value %T", v)
+}
@@ -0,0 +1,124 @@
+package access
+
+import (
+	"strings"
+	"testing"
+)
+
+func exportFixture() *GraphSnapshot {
+	return &GraphSnapshot{
+		Directed: true,
+		Nodes: []SnapshotNode{
+			{ID: "Principal|arn:aws:iam::111111111111:role/admin", Label: "Principal", Properties: map[string]interface{}{
+				"arn":  "arn:aws:iam::111111111111:role/admin",
+				"name": "admin",
+				"type": "ROLE",
+			}},
+			{ID: "DataAsset|a1", Label: "DataAsset", Properties: map[string]interface{}{
+				"id":               "a1",
+				"name":             `say "hi"`,
+				"sensitivityLevel": "CRITICAL",
+			}},
+		},
+		Links: []SnapshotLink{{
+			Source: "Principal|arn:aws:iam::111111111111:role/admin",
+			Target: "DataAsset|a1",
+			Type:   "CAN_ACCESS",
+			Properties: map[string]interface{}{
+				"permissions":     []string{"s3:GetObject"},
+				"isCrossAccount":  false,
+				"lastSeen":        int64(7),
+				"confidenceScore": 0.5,
+			},
+		}},
+	}
+}
+
+func TestWriteCypher(t *testing.T) {
+	var buf strings.Builder
+	if err := exportFixture().WriteCypher(&buf); err != nil {
+		t.Fatalf("WriteCypher: %v", err)
+	}
+	expected := `CREATE (:Principal {arn: "arn:aws:iam::111111111111:role/admin", name: "admin", type: "ROLE"});
+CREATE (:DataAsset {id: "a1", name: "say \"hi\"", sensitivityLevel: "CRITICAL"});
+MATCH (a:Principal {arn: "arn:aws:iam::111111111111:role/admin"}), (b:DataAsset {id: "a1"}) CREATE (a)-[:CAN_ACCESS {confidenceScore: 0.5, isCrossAccount: false, lastSeen: 7, permissions: ["s3:GetObject"]}]->(b);
+`
+	if got := buf.String(); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestGraphMLRoundTrip(t *testing.T) {
+	var buf strings.Builder
+	if err := exportFixture().WriteGraphML(&buf); err != nil {
+		t.Fatalf("WriteGraphML: %v", err)
+	}
+	for _, fragment := range []string{
+		`<key id="edge_permissions" for="edge" attr.name="permissions" attr.type="string" attr.list="string"></key>`,
+		`<node id="DataAsset|a1" labels=":DataAsset">`,
+		`<edge source="Principal|arn:aws:iam::111111111111:role/admin" target="DataAsset|a1" label="CAN_ACCESS">`,
+	} {
+		if !strings.Contains(buf.String(), fragment) {
+			t.Errorf("expected GraphML to contain %s, got\n%s", fragment, buf.String())
+		}
+	}
+
+	s, err := ReadSnapshot(strings.NewReader(buf.String()), FormatGraphML)
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+	if len(s.Nodes) != 2 || len(s.Links) != 1 {
+		t.Fatalf("expected 2 nodes and 1 link, got %+v", s)
+	}
+	props := s.Links[0].Properties
+	if props["lastSeen"] != int64(7) || props["confidenceScore"] != 0.5 || props["isCrossAccount"] != false {
+		t.Errorf("expected typed properties, got %#v", props)
+	}
+	if perms, ok := props["permissions"].([]string); !ok || len(perms) != 1 || perms[0] != "s3:GetObject" {
+		t.Errorf("expected the permissions list, got %#v", props["permissions"])
+	}
+	if s.Nodes[1].Label != "DataAsset" || s.Nodes[1].Properties["name"] != `say "hi"` {
+		t.Errorf("expected the asset node, got %+v", s.Nodes[1])
+	}
+}
+
+func TestReadSnapshotValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot string
+		err      string
+	}{
+		{
+			name:     "mismatched id",
+			snapshot: `{"nodes": [{"id": "Principal|x", "label": "Principal", "properties": {"arn": "y"}}]}`,
+			err:      `expected ID "Principal|y"`,
+		},
+		{
+			name:     "unknown label",
+			snapshot: `{"nodes": [{"id": "User|x", "label": "User", "properties": {"arn": "x"}}]}`,
+			err:      "no identifying properties",
+		},
+		{
+			name: "dangling link",
+			snapshot: `{"nodes": [{"id": "Principal|x", "label": "Principal", "properties": {"arn": "x"}}],
+				"links": [{"source": "Principal|x", "target": "Principal|y", "type": "CAN_ASSUME"}]}`,
+			err: "unknown node",
+		},
+		{
+			name: "injected type",
+			snapshot: `{"nodes": [{"id": "Principal|x", "label": "Principal", "properties": {"arn": "x"}}],
+				"links": [{"source": "Principal|x", "target": "Principal|x", "type": "X]->() DETACH DELETE (n"}]}`,
+			err: "invalid type",
+		},
+	}
+	for _, tt := range tests {
+		_, err := ReadSnapshot(strings.NewReader(tt.snapshot), FormatJSON)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+
+	if _, err := ReadSnapshot(strings.NewReader(""), FormatCypher); err == nil {
+		t.Errorf("expected cypher imports to be rejected")
+	}
+}
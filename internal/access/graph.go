@@ -3,6 +3,8 @@ package access
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
@@ -10,6 +12,7 @@ import (
 	"github.com/qualys/dspm/internal/models"
 )
 
+// Graph is the Neo4j GraphStore
 type Graph struct {
 	driver neo4j.DriverWithContext
 }
@@ -103,7 +106,8 @@ func (g *Graph) UpsertAsset(ctx context.Context, asset *models.DataAsset) error
 			a.region = $region,
 			a.sensitivityLevel = $sensitivityLevel,
 			a.encryptionStatus = $encryptionStatus,
-			a.publicAccess = $publicAccess
+			a.publicAccess = $publicAccess,
+			a.accountId = $accountId
 		WITH a
 		MATCH (acc:CloudAccount {id: $accountId})
 		MERGE (a)-[:BELONGS_TO]->(acc)
@@ -133,7 +137,8 @@ func (g *Graph) UpsertPrincipal(ctx context.Context, accountID uuid.UUID, princi
 		SET p.id = $id,
 			p.name = $name,
 			p.type = $type,
-			p.accountId = $accountId
+			p.accountId = $accountId,
+			p.lastSeen = timestamp()
 		WITH p
 		MATCH (acc:CloudAccount {id: $accountId})
 		MERGE (p)-[:BELONGS_TO]->(acc)
@@ -159,7 +164,8 @@ func (g *Graph) UpsertPolicy(ctx context.Context, policy *models.AccessPolicy) e
 		SET p.id = $id,
 			p.name = $name,
 			p.policyType = $policyType,
-			p.allowsPublicAccess = $allowsPublicAccess
+			p.allowsPublicAccess = $allowsPublicAccess,
+			p.lastSeen = timestamp()
 	`
 
 	_, err := session.Run(ctx, query, map[string]interface{}{
@@ -186,7 +192,8 @@ func (g *Graph) CreateAccessEdge(ctx context.Context, edge *models.AccessEdge) e
 			r.permissionLevel = $permissionLevel,
 			r.isDirect = $isDirect,
 			r.isPublic = $isPublic,
-			r.isCrossAccount = $isCrossAccount
+			r.isCrossAccount = $isCrossAccount,
+			r.lastSeen = timestamp()
 	`
 
 	_, err := session.Run(ctx, query, map[string]interface{}{
@@ -213,7 +220,8 @@ func (g *Graph) CreatePublicAccess(ctx context.Context, assetID uuid.UUID, permi
 		MATCH (a:DataAsset {id: $assetId})
 		MERGE (p)-[r:CAN_ACCESS]->(a)
 		SET r.isPublic = true,
-			r.permissions = $permissions
+			r.permissions = $permissions,
+			r.lastSeen = timestamp()
 	`
 
 	_, err := session.Run(ctx, query, map[string]interface{}{
@@ -232,6 +240,7 @@ func (g *Graph) CreateRoleAssumption(ctx context.Context, sourceARN, targetRoleA
 		MATCH (source:Principal {arn: $sourceArn})
 		MATCH (target:Principal {arn: $targetArn, type: 'ROLE'})
 		MERGE (source)-[r:CAN_ASSUME]->(target)
+		SET r.lastSeen = timestamp()
 	`
 
 	_, err := session.Run(ctx, query, map[string]interface{}{
@@ -242,6 +251,27 @@ func (g *Graph) CreateRoleAssumption(ctx context.Context, sourceARN, targetRoleA
 	return err
 }
 
+// CreatePublicRoleAssumption records that anyone can assume a role, as
+// its trust policy admits every principal
+func (g *Graph) CreatePublicRoleAssumption(ctx context.Context, roleARN string) error {
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	query := `
+		MERGE (p:Principal {arn: 'public', type: 'PUBLIC'})
+		WITH p
+		MATCH (target:Principal {arn: $targetArn, type: 'ROLE'})
+		MERGE (p)-[r:CAN_ASSUME]->(target)
+		SET r.lastSeen = timestamp()
+	`
+
+	_, err := session.Run(ctx, query, map[string]interface{}{
+		"targetArn": roleARN,
+	})
+
+	return err
+}
+
 func (g *Graph) CreatePolicyAttachment(ctx context.Context, policyARN, principalARN string) error {
 	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
@@ -250,6 +280,28 @@ func (g *Graph) CreatePolicyAttachment(ctx context.Context, policyARN, principal
 		MATCH (policy:Policy {arn: $policyArn})
 		MATCH (principal:Principal {arn: $principalArn})
 		MERGE (policy)-[r:ATTACHED_TO]->(principal)
+		SET r.lastSeen = timestamp()
+	`
+
+	_, err := session.Run(ctx, query, map[string]interface{}{
+		"policyArn":    policyARN,
+		"principalArn": principalARN,
+	})
+
+	return err
+}
+
+// CreatePermissionsBoundary records a managed policy set as the permissions
+// boundary of a user or role
+func (g *Graph) CreatePermissionsBoundary(ctx context.Context, policyARN, principalARN string) error {
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	query := `
+		MATCH (policy:Policy {arn: $policyArn})
+		MATCH (principal:Principal {arn: $principalArn})
+		MERGE (policy)-[r:BOUNDS]->(principal)
+		SET r.lastSeen = timestamp()
 	`
 
 	_, err := session.Run(ctx, query, map[string]interface{}{
@@ -260,6 +312,26 @@ func (g *Graph) CreatePolicyAttachment(ctx context.Context, policyARN, principal
 	return err
 }
 
+// AddGroupMembership records a user's membership of a group
+func (g *Graph) AddGroupMembership(ctx context.Context, memberARN, groupARN string) error {
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	query := `
+		MATCH (member:Principal {arn: $memberArn})
+		MATCH (group:Principal {arn: $groupArn, type: 'GROUP'})
+		MERGE (member)-[r:MEMBER_OF]->(group)
+		SET r.lastSeen = timestamp()
+	`
+
+	_, err := session.Run(ctx, query, map[string]interface{}{
+		"memberArn": memberARN,
+		"groupArn":  groupARN,
+	})
+
+	return err
+}
+
 func (g *Graph) AddClassification(ctx context.Context, assetID uuid.UUID, category models.Category, sensitivity models.Sensitivity, count int) error {
 	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
@@ -269,7 +341,8 @@ func (g *Graph) AddClassification(ctx context.Context, assetID uuid.UUID, catego
 		WITH c
 		MATCH (a:DataAsset {id: $assetId})
 		MERGE (a)-[r:CONTAINS_DATA]->(c)
-		SET r.count = $count
+		SET r.count = $count,
+			r.lastSeen = timestamp()
 	`
 
 	_, err := session.Run(ctx, query, map[string]interface{}{
@@ -282,6 +355,85 @@ func (g *Graph) AddClassification(ctx context.Context, assetID uuid.UUID, catego
 	return err
 }
 
+// Timestamp returns the database clock in milliseconds. Writes stamp nodes
+// and edges with this clock, so a sync records it when it starts and then
+// removes what it did not write.
+func (g *Graph) Timestamp(ctx context.Context) (int64, error) {
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx, "RETURN timestamp() AS now", nil)
+	if err != nil {
+		return 0, err
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now, _ := record.Get("now")
+	return now.(int64), nil
+}
+
+// RemoveStaleAccess removes the access relationships of an account that
+// were last written before since, together with principals no longer seen
+// and policies left unattached. Shared PUBLIC and SERVICE principals are
+// kept. It returns the number of relationships and nodes removed.
+func (g *Graph) RemoveStaleAccess(ctx context.Context, accountID uuid.UUID, since int64) (int64, error) {
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	queries := []string{
+		`MATCH ()-[r:CAN_ACCESS]->(a:DataAsset {accountId: $accountId})
+		 WHERE coalesce(r.lastSeen, 0) < $since
+		 DELETE r
+		 RETURN count(r) AS removed`,
+		`MATCH (a:DataAsset {accountId: $accountId})-[r:CONTAINS_DATA]->()
+		 WHERE coalesce(r.lastSeen, 0) < $since
+		 DELETE r
+		 RETURN count(r) AS removed`,
+		`MATCH (p:Principal {accountId: $accountId})-[r:CAN_ASSUME|MEMBER_OF|ATTACHED_TO|BOUNDS]-()
+		 WITH DISTINCT r
+		 WHERE coalesce(r.lastSeen, 0) < $since
+		 DELETE r
+		 RETURN count(r) AS removed`,
+		`MATCH (p:Principal {accountId: $accountId})
+		 WHERE coalesce(p.lastSeen, 0) < $since AND NOT p.type IN ['PUBLIC', 'SERVICE', 'EXTERNAL_ACCOUNT']
+		 DETACH DELETE p
+		 RETURN count(p) AS removed`,
+		`MATCH (pol:Policy)
+		 WHERE coalesce(pol.lastSeen, 0) < $since AND NOT (pol)-->()
+		 DELETE pol
+		 RETURN count(pol) AS removed`,
+	}
+
+	params := map[string]interface{}{
+		"accountId": accountID.String(),
+		"since":     since,
+	}
+
+	var total int64
+	for _, query := range queries {
+		result, err := session.Run(ctx, query, params)
+		if err != nil {
+			return total, fmt.Errorf("removing stale access: %w", err)
+		}
+		record, err := result.Single(ctx)
+		if err != nil {
+			return total, fmt.Errorf("removing stale access: %w", err)
+		}
+		removed, _ := record.Get("removed")
+		total += removed.(int64)
+	}
+
+	return total, nil
+}
+
+// Apply writes an account's access graph from an access scan and then
+// removes what earlier scans wrote that this one did not
+func (g *Graph) Apply(ctx context.Context, account *models.CloudAccount, update *GraphUpdate) (int64, error) {
+	return applyUpdate(ctx, g, account, update)
+}
+
 type PathResult struct {
 	Source      string   `json:"source"`
 	Target      string   `json:"target"`
@@ -474,6 +626,10 @@ func (g *Graph) FindOverprivilegedAccess(ctx context.Context, accountID *uuid.UU
 	return records, nil
 }
 
+// FindCrossAccountAccess returns access to an account's assets from
+// outside it: grants to principals of other accounts, and the assets the
+// identity providers and external accounts its roles trust reach by
+// assuming them
 func (g *Graph) FindCrossAccountAccess(ctx context.Context, accountID uuid.UUID) ([]AccessRecord, error) {
 	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
@@ -526,9 +682,40 @@ func (g *Graph) FindCrossAccountAccess(ctx context.Context, accountID uuid.UUID)
 		records = append(records, record)
 	}
 
+	trusted, err := g.runReachQuery(ctx, reachQuery(
+		" WHERE start.type IN ['"+PrincipalTypeIdentityProvider+"', '"+PrincipalTypeExternalAccount+"']"+
+			" AND (start)-[:BELONGS_TO]->(:CloudAccount {id: $accountId})",
+		" {accountId: $accountId}", crossAccountHops,
+	), map[string]interface{}{"accountId": accountID.String()})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range trusted {
+		records = append(records, trustedAccessRecord(r))
+	}
+
 	return records, nil
 }
 
+// crossAccountHops bounds the role chains followed from the identity
+// providers and external accounts an account's roles trust
+const crossAccountHops = 5
+
+// trustedAccessRecord reports the access an identity provider or external
+// account reaches by assuming an account's roles
+func trustedAccessRecord(r ReachableAccess) AccessRecord {
+	return AccessRecord{
+		PrincipalARN:    r.PrincipalARN,
+		PrincipalType:   r.PrincipalType,
+		AssetARN:        r.AssetARN,
+		AssetName:       r.AssetName,
+		Permissions:     r.Permissions,
+		PermissionLevel: r.PermissionLevel,
+		Sensitivity:     r.Sensitivity,
+		CrossAccount:    true,
+	}
+}
+
 func (g *Graph) GetAccessStats(ctx context.Context, accountID *uuid.UUID) (*AccessStats, error) {
 	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
 	defer session.Close(ctx)
@@ -621,6 +808,194 @@ type AccessStats struct {
 	OverprivilegedCount int            `json:"overprivileged_count"`
 }
 
+// =====================================================
+// Blast Radius
+// =====================================================
+
+// ReachableAccess is a data asset a principal can reach, directly, through
+// its groups or by assuming roles
+type ReachableAccess struct {
+	PrincipalARN  string `json:"principal_arn"`
+	PrincipalType string `json:"principal_type"`
+	AssetID       string `json:"asset_id"`
+	AssetARN      string `json:"asset_arn"`
+	AssetName     string `json:"asset_name"`
+	// Permissions are granted to any principal the principal reaches, and
+	// PermissionLevel is the highest level among them
+	Permissions     []string `json:"permissions"`
+	PermissionLevel string   `json:"permission_level,omitempty"`
+	Sensitivity     string   `json:"sensitivity"`
+	Categories      []string `json:"categories"`
+	// RecordCount estimates the sensitive records in the asset from its
+	// classifications
+	RecordCount int `json:"record_count"`
+	// Path is the shortest chain of principals from the principal to one
+	// holding access, followed by the asset. HopCount counts the group
+	// memberships and role assumptions on it.
+	Path     []string `json:"path"`
+	HopCount int      `json:"hop_count"`
+}
+
+// PrincipalForCredential returns the principal whose access a credential
+// carries: the role for an assumed-role session ARN, otherwise the ARN
+// itself. Session ARNs drop the role's path.
+func PrincipalForCredential(arn string) string {
+	return principalARN(arn)
+}
+
+// permissionRank orders permission levels from least to most access
+var permissionRank = map[string]int{
+	string(models.PermissionRead):  1,
+	string(models.PermissionWrite): 2,
+	string(models.PermissionAdmin): 3,
+	string(models.PermissionFull):  4,
+}
+
+// sensitivityRank orders sensitivity levels from least to most sensitive
+var sensitivityRank = map[string]int{
+	string(models.SensitivityLow):      1,
+	string(models.SensitivityMedium):   2,
+	string(models.SensitivityHigh):     3,
+	string(models.SensitivityCritical): 4,
+}
+
+// highestLevel returns the permission level granting the most access
+func highestLevel(levels []string) string {
+	highest := ""
+	for _, level := range levels {
+		if permissionRank[level] > permissionRank[highest] {
+			highest = level
+		}
+	}
+	return highest
+}
+
+// sortReachable orders results most sensitive first, then by asset and
+// principal, so every backend returns them alike
+func sortReachable(results []ReachableAccess) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if sensitivityRank[a.Sensitivity] != sensitivityRank[b.Sensitivity] {
+			return sensitivityRank[a.Sensitivity] > sensitivityRank[b.Sensitivity]
+		}
+		if a.AssetARN != b.AssetARN {
+			return a.AssetARN < b.AssetARN
+		}
+		return a.PrincipalARN < b.PrincipalARN
+	})
+}
+
+// reachQuery finds the assets principals reach over up to maxHops group
+// memberships and role assumptions. Among shortest paths the one through
+// the first accessor by ARN is kept.
+func reachQuery(start, asset string, maxHops int) string {
+	return `
+		MATCH path = (start:Principal` + start + `)-[:MEMBER_OF|CAN_ASSUME*0..` + fmt.Sprintf("%d", maxHops) + `]->(p:Principal)-[r:CAN_ACCESS]->(a:DataAsset` + asset + `)
+		WITH start, a, r, path, p
+		ORDER BY length(path) ASC, p.arn ASC, [n IN nodes(path) | n.arn] ASC
+		WITH start, a, collect(path)[0] AS shortest, collect(r) AS grants
+		OPTIONAL MATCH (a)-[c:CONTAINS_DATA]->(cl:Classification)
+		WITH start, a, shortest, grants, collect(DISTINCT cl.category) AS categories, sum(c.count) AS records
+		RETURN start.arn as principal,
+			   start.type as principalType,
+			   a.id as assetId,
+			   a.arn as asset,
+			   a.name as assetName,
+			   a.sensitivityLevel as sensitivity,
+			   [g IN grants | g.permissions] as permissions,
+			   [g IN grants | g.permissionLevel] as levels,
+			   categories,
+			   records,
+			   [n IN nodes(shortest) | n.arn] as pathNodes,
+			   length(shortest) - 1 as hops
+	`
+}
+
+func (g *Graph) runReachQuery(ctx context.Context, query string, params map[string]interface{}) ([]ReachableAccess, error) {
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx, query, params)
+	if err != nil {
+		return nil, fmt.Errorf("executing query: %w", err)
+	}
+
+	var results []ReachableAccess
+	for result.Next(ctx) {
+		rec := result.Record()
+		principal, _ := rec.Get("principal")
+		principalType, _ := rec.Get("principalType")
+		assetID, _ := rec.Get("assetId")
+		asset, _ := rec.Get("asset")
+		assetName, _ := rec.Get("assetName")
+		sensitivity, _ := rec.Get("sensitivity")
+		permissions, _ := rec.Get("permissions")
+		levels, _ := rec.Get("levels")
+		categories, _ := rec.Get("categories")
+		records, _ := rec.Get("records")
+		pathNodes, _ := rec.Get("pathNodes")
+		hops, _ := rec.Get("hops")
+
+		reach := ReachableAccess{
+			PrincipalARN:  principal.(string),
+			PrincipalType: principalType.(string),
+			AssetID:       assetID.(string),
+			AssetARN:      asset.(string),
+			AssetName:     assetName.(string),
+			Sensitivity:   sensitivity.(string),
+			Categories:    toStrings(categories),
+			RecordCount:   int(records.(int64)),
+			Path:          toStrings(pathNodes),
+			HopCount:      int(hops.(int64)),
+		}
+
+		set := make(map[string]bool)
+		if grants, ok := permissions.([]interface{}); ok {
+			for _, perms := range grants {
+				for _, p := range toStrings(perms) {
+					set[p] = true
+				}
+			}
+		}
+		reach.Permissions = sortedKeys(set)
+		reach.PermissionLevel = highestLevel(toStrings(levels))
+		sort.Strings(reach.Categories)
+
+		results = append(results, reach)
+	}
+
+	sortReachable(results)
+	return results, nil
+}
+
+// toStrings converts a list returned by the driver, skipping nulls
+func toStrings(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// FindBlastRadius returns every data asset a principal can reach over up
+// to maxHops group memberships and role assumptions
+func (g *Graph) FindBlastRadius(ctx context.Context, principalARN string, maxHops int) ([]ReachableAccess, error) {
+	return g.runReachQuery(ctx, reachQuery(" {arn: $arn}", "", maxHops), map[string]interface{}{
+		"arn": principalARN,
+	})
+}
+
+// FindPrincipalsReaching returns every principal that can reach a data
+// asset over up to maxHops group memberships and role assumptions
+func (g *Graph) FindPrincipalsReaching(ctx context.Context, assetARN string, maxHops int) ([]ReachableAccess, error) {
+	return g.runReachQuery(ctx, reachQuery("", " {arn: $arn}", maxHops), map[string]interface{}{
+		"arn": assetARN,
+	})
+}
+
 // =====================================================
 // Phase 2: Data Lineage Relationships
 // =====================================================
@@ -1047,3 +1422,172 @@ type AIModelAccessRecord struct {
 	DataSourceARN    string `json:"data_source_arn"`
 	SensitivityLevel string `json:"sensitivity_level"`
 }
+
+// =====================================================
+// Export and Import
+// =====================================================
+
+// importBatchSize bounds the rows written by one UNWIND
+const importBatchSize = 1000
+
+// Export reads the whole graph and filters it. Nodes without a label and
+// identifying properties the snapshot format knows are left out, with their
+// relationships.
+func (g *Graph) Export(ctx context.Context, filter ExportFilter) (*GraphSnapshot, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx, `
+		MATCH (n)
+		RETURN elementId(n) as id, labels(n) as labels, properties(n) as props
+	`, nil)
+	if err != nil {
+		return nil, fmt.Errorf("executing query: %w", err)
+	}
+
+	snapshot := &GraphSnapshot{Directed: true}
+	ids := make(map[string]string)
+	for result.Next(ctx) {
+		rec := result.Record()
+		elementID, _ := rec.Get("id")
+		labels, _ := rec.Get("labels")
+		props, _ := rec.Get("props")
+
+		p := normalizeProps(props.(map[string]interface{}))
+		for _, label := range toStrings(labels) {
+			if id := snapshotNodeID(label, p); id != "" {
+				ids[elementID.(string)] = id
+				snapshot.Nodes = append(snapshot.Nodes, SnapshotNode{ID: id, Label: label, Properties: p})
+				break
+			}
+		}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("reading nodes: %w", err)
+	}
+
+	result, err = session.Run(ctx, `
+		MATCH (a)-[r]->(b)
+		RETURN elementId(a) as source, elementId(b) as target, type(r) as type, properties(r) as props
+	`, nil)
+	if err != nil {
+		return nil, fmt.Errorf("executing query: %w", err)
+	}
+	for result.Next(ctx) {
+		rec := result.Record()
+		source, _ := rec.Get("source")
+		target, _ := rec.Get("target")
+		relType, _ := rec.Get("type")
+		props, _ := rec.Get("props")
+
+		from, to := ids[source.(string)], ids[target.(string)]
+		if from == "" || to == "" {
+			continue
+		}
+		snapshot.Links = append(snapshot.Links, SnapshotLink{
+			Source:     from,
+			Target:     to,
+			Type:       relType.(string),
+			Properties: normalizeProps(props.(map[string]interface{})),
+		})
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("reading relationships: %w", err)
+	}
+
+	snapshot = filterSnapshot(snapshot, filter)
+	sortSnapshot(snapshot)
+	return snapshot, nil
+}
+
+// Import merges a snapshot's nodes by label and identifying properties,
+// then its relationships between them
+func (g *Graph) Import(ctx context.Context, snapshot *GraphSnapshot) error {
+	if err := snapshot.validate(); err != nil {
+		return err
+	}
+
+	session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+	defer session.Close(ctx)
+
+	// identity returns the properties a node is merged on
+	nodes := make(map[string]SnapshotNode, len(snapshot.Nodes))
+	identity := func(n SnapshotNode) map[string]interface{} {
+		key := make(map[string]interface{})
+		for _, k := range nodeIdentity[n.Label] {
+			key[k] = n.Properties[k]
+		}
+		return key
+	}
+	// pattern matches a node of a label on the identity in row.<field>
+	pattern := func(variable, label, field string) string {
+		var props []string
+		for _, k := range nodeIdentity[label] {
+			props = append(props, k+": row."+field+"."+k)
+		}
+		return "(" + variable + ":" + label + " {" + strings.Join(props, ", ") + "})"
+	}
+
+	byLabel := make(map[string][]map[string]interface{})
+	for _, n := range snapshot.Nodes {
+		nodes[n.ID] = n
+		byLabel[n.Label] = append(byLabel[n.Label], map[string]interface{}{"key": identity(n), "props": n.Properties})
+	}
+	for _, label := range sortedKeys(byLabel) {
+		query := `
+			UNWIND $rows AS row
+			MERGE ` + pattern("n", label, "key") + `
+			SET n += row.props
+		`
+		if err := runBatches(ctx, session, query, byLabel[label]); err != nil {
+			return fmt.Errorf("importing %s nodes: %w", label, err)
+		}
+	}
+
+	byShape := make(map[string][]map[string]interface{})
+	for _, l := range snapshot.Links {
+		source, target := nodes[l.Source], nodes[l.Target]
+		shape := source.Label + " " + l.Type + " " + target.Label
+		byShape[shape] = append(byShape[shape], map[string]interface{}{
+			"source": identity(source),
+			"target": identity(target),
+			"props":  l.Properties,
+		})
+	}
+	for _, shape := range sortedKeys(byShape) {
+		parts := strings.Fields(shape)
+		query := `
+			UNWIND $rows AS row
+			MATCH ` + pattern("a", parts[0], "source") + `
+			MATCH ` + pattern("b", parts[2], "target") + `
+			MERGE (a)-[r:` + parts[1] + `]->(b)
+			SET r += row.props
+		`
+		if err := runBatches(ctx, session, query, byShape[shape]); err != nil {
+			return fmt.Errorf("importing %s relationships: %w", parts[1], err)
+		}
+	}
+	return nil
+}
+
+// runBatches runs an UNWIND query over rows in batches
+func runBatches(ctx context.Context, session neo4j.SessionWithContext, query string, rows []map[string]interface{}) error {
+	for start := 0; start < len(rows); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		result, err := session.Run(ctx, query, map[string]interface{}{"rows": rows[start:end]})
+		if err != nil {
+			return err
+		}
+		if _, err := result.Consume(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
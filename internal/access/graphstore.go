@@ -0,0 +1,189 @@
+package access
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+// GraphStore holds the access and lineage graph. Graph stores it in Neo4j
+// and MemoryGraph in process; both answer the same queries.
+type GraphStore interface {
+	Close(ctx context.Context) error
+
+	UpsertAccount(ctx context.Context, account *models.CloudAccount) error
+	UpsertAsset(ctx context.Context, asset *models.DataAsset) error
+	UpsertPrincipal(ctx context.Context, accountID uuid.UUID, principal *Principal) error
+	UpsertPolicy(ctx context.Context, policy *models.AccessPolicy) error
+	CreateAccessEdge(ctx context.Context, edge *models.AccessEdge) error
+	CreatePublicAccess(ctx context.Context, assetID uuid.UUID, permissions []string) error
+	CreateRoleAssumption(ctx context.Context, sourceARN, targetRoleARN string) error
+	CreatePublicRoleAssumption(ctx context.Context, roleARN string) error
+	CreatePolicyAttachment(ctx context.Context, policyARN, principalARN string) error
+	CreatePermissionsBoundary(ctx context.Context, policyARN, principalARN string) error
+	AddGroupMembership(ctx context.Context, memberARN, groupARN string) error
+	AddClassification(ctx context.Context, assetID uuid.UUID, category models.Category, sensitivity models.Sensitivity, count int) error
+
+	// Timestamp returns the store's clock. Writes are stamped with it, so
+	// anything stamped before a value read here is older than the read.
+	Timestamp(ctx context.Context) (int64, error)
+	RemoveStaleAccess(ctx context.Context, accountID uuid.UUID, since int64) (int64, error)
+	Apply(ctx context.Context, account *models.CloudAccount, update *GraphUpdate) (int64, error)
+
+	FindPublicAccessPaths(ctx context.Context, accountID *uuid.UUID, maxHops int) ([]PathResult, error)
+	FindAccessToPII(ctx context.Context, accountID *uuid.UUID) ([]AccessRecord, error)
+	FindOverprivilegedAccess(ctx context.Context, accountID *uuid.UUID) ([]AccessRecord, error)
+	FindCrossAccountAccess(ctx context.Context, accountID uuid.UUID) ([]AccessRecord, error)
+	GetAccessStats(ctx context.Context, accountID *uuid.UUID) (*AccessStats, error)
+	FindBlastRadius(ctx context.Context, principalARN string, maxHops int) ([]ReachableAccess, error)
+	FindPrincipalsReaching(ctx context.Context, assetARN string, maxHops int) ([]ReachableAccess, error)
+
+	UpsertFunction(ctx context.Context, accountID uuid.UUID, fn *FunctionNode) error
+	CreateLineageEdge(ctx context.Context, edge *LineageEdge) error
+	FindDataFlowPaths(ctx context.Context, sourceARN string, maxHops int) ([]LineagePathResult, error)
+	FindSensitiveDataFlows(ctx context.Context, accountID *uuid.UUID) ([]LineagePathResult, error)
+	GetLineageForAsset(ctx context.Context, assetARN string) (*LineageGraph, error)
+
+	UpsertAIModel(ctx context.Context, accountID uuid.UUID, modelARN, modelName, modelType string) error
+	CreateTrainingDataEdge(ctx context.Context, modelARN, dataSourceARN string, sensitivityLevel string) error
+	FindAIModelsAccessingSensitiveData(ctx context.Context, accountID *uuid.UUID) ([]AIModelAccessRecord, error)
+
+	// Export returns the nodes and relationships passing filter. Import
+	// merges a snapshot into the graph, so an export restores into an empty
+	// store as it was.
+	Export(ctx context.Context, filter ExportFilter) (*GraphSnapshot, error)
+	Import(ctx context.Context, snapshot *GraphSnapshot) error
+}
+
+var (
+	_ GraphStore = (*Graph)(nil)
+	_ GraphStore = (*MemoryGraph)(nil)
+)
+
+// Graph backends
+const (
+	BackendNeo4j  = "neo4j"
+	BackendMemory = "memory"
+)
+
+// Persistence of the in-memory backend
+const (
+	PersistNone     = "none"
+	PersistFile     = "file"
+	PersistPostgres = "postgres"
+)
+
+// StoreConfig selects a graph backend. Neo4j is used by default.
+type StoreConfig struct {
+	Backend string
+	Neo4j   Config
+	// Persistence is where the in-memory backend keeps its graph: a local
+	// file at Path, Postgres through DB, or nowhere
+	Persistence string
+	Path        string
+	DB          *sqlx.DB
+}
+
+// NewStore opens the graph backend selected by cfg
+func NewStore(ctx context.Context, cfg StoreConfig) (GraphStore, error) {
+	switch cfg.Backend {
+	case "", BackendNeo4j:
+		return New(cfg.Neo4j)
+	case BackendMemory:
+		var persister Persister
+		switch cfg.Persistence {
+		case "", PersistNone:
+		case PersistFile:
+			if cfg.Path == "" {
+				return nil, fmt.Errorf("file persistence requires a path")
+			}
+			persister = &FilePersister{Path: cfg.Path}
+		case PersistPostgres:
+			if cfg.DB == nil {
+				return nil, fmt.Errorf("postgres persistence requires a database")
+			}
+			persister = NewPostgresPersister(cfg.DB, "default")
+		default:
+			return nil, fmt.Errorf("unknown graph persistence %q", cfg.Persistence)
+		}
+		return NewMemoryGraph(ctx, persister)
+	default:
+		return nil, fmt.Errorf("unknown graph backend %q", cfg.Backend)
+	}
+}
+
+// applyUpdate writes an account's access graph from an access scan and then
+// removes what earlier scans wrote that this one did not. Nothing is
+// removed if a write fails, so a partial sync never drops valid access.
+// It returns the number of stale relationships and nodes removed.
+func applyUpdate(ctx context.Context, s GraphStore, account *models.CloudAccount, update *GraphUpdate) (int64, error) {
+	since, err := s.Timestamp(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("reading graph clock: %w", err)
+	}
+
+	if err := s.UpsertAccount(ctx, account); err != nil {
+		return 0, fmt.Errorf("upserting account: %w", err)
+	}
+	for _, asset := range update.Assets {
+		if err := s.UpsertAsset(ctx, asset); err != nil {
+			return 0, fmt.Errorf("upserting asset %s: %w", asset.ResourceARN, err)
+		}
+	}
+	for i := range update.Principals {
+		if err := s.UpsertPrincipal(ctx, account.ID, &update.Principals[i]); err != nil {
+			return 0, fmt.Errorf("upserting principal %s: %w", update.Principals[i].ARN, err)
+		}
+	}
+	for i := range update.Policies {
+		if err := s.UpsertPolicy(ctx, &update.Policies[i]); err != nil {
+			return 0, fmt.Errorf("upserting policy %s: %w", update.Policies[i].PolicyARN, err)
+		}
+	}
+	for _, a := range update.Attachments {
+		if a.Boundary {
+			err = s.CreatePermissionsBoundary(ctx, a.PolicyARN, a.PrincipalARN)
+		} else {
+			err = s.CreatePolicyAttachment(ctx, a.PolicyARN, a.PrincipalARN)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("attaching policy %s: %w", a.PolicyARN, err)
+		}
+	}
+	for _, m := range update.Memberships {
+		if err := s.AddGroupMembership(ctx, m.MemberARN, m.GroupARN); err != nil {
+			return 0, fmt.Errorf("adding group membership: %w", err)
+		}
+	}
+	for _, a := range update.Assumptions {
+		if a.SourceARN == PublicPrincipalARN {
+			err = s.CreatePublicRoleAssumption(ctx, a.RoleARN)
+		} else {
+			err = s.CreateRoleAssumption(ctx, a.SourceARN, a.RoleARN)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("creating role assumption: %w", err)
+		}
+	}
+	for i := range update.AccessEdges {
+		if err := s.CreateAccessEdge(ctx, &update.AccessEdges[i]); err != nil {
+			return 0, fmt.Errorf("creating access edge: %w", err)
+		}
+	}
+	for _, p := range update.PublicAccess {
+		if err := s.CreatePublicAccess(ctx, p.AssetID, p.Permissions); err != nil {
+			return 0, fmt.Errorf("creating public access: %w", err)
+		}
+	}
+	for _, c := range update.Classifications {
+		if err := s.AddClassification(ctx, c.AssetID, c.Category, c.Sensitivity, c.Count); err != nil {
+			return 0, fmt.Errorf("adding classification: %w", err)
+		}
+	}
+
+	return s.RemoveStaleAccess(ctx, account.ID, since)
+}
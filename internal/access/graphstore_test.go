@@ -0,0 +1,829 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+// openGraphStore returns an empty graph store for one conformance test
+type openGraphStore func(t *testing.T) GraphStore
+
+func TestGraphStoreConformance_Memory(t *testing.T) {
+	runGraphStoreConformance(t, func(t *testing.T) GraphStore {
+		g, err := NewMemoryGraph(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("NewMemoryGraph: %v", err)
+		}
+		return g
+	})
+}
+
+func TestGraphStoreConformance_MemoryFile(t *testing.T) {
+	runGraphStoreConformance(t, func(t *testing.T) GraphStore {
+		g, err := NewMemoryGraph(context.Background(), &FilePersister{Path: filepath.Join(t.TempDir(), "graph.json")})
+		if err != nil {
+			t.Fatalf("NewMemoryGraph: %v", err)
+		}
+		return g
+	})
+}
+
+// TestGraphStoreConformance_Neo4j runs the suite against the database at
+// TEST_NEO4J_URI, which it empties first
+func TestGraphStoreConformance_Neo4j(t *testing.T) {
+	uri := os.Getenv("TEST_NEO4J_URI")
+	if uri == "" {
+		t.Skip("Skipping test, TEST_NEO4J_URI not set")
+	}
+
+	runGraphStoreConformance(t, func(t *testing.T) GraphStore {
+		g, err := New(Config{URI: uri, Username: os.Getenv("TEST_NEO4J_USER"), Password: os.Getenv("TEST_NEO4J_PASSWORD")})
+		if err != nil {
+			t.Skipf("Skipping test, neo4j not available: %v", err)
+		}
+		ctx := context.Background()
+		session := g.driver.NewSession(ctx, neo4j.SessionConfig{})
+		defer session.Close(ctx)
+		if _, err := session.Run(ctx, "MATCH (n) DETACH DELETE n", nil); err != nil {
+			t.Fatalf("clearing neo4j: %v", err)
+		}
+		t.Cleanup(func() { g.Close(ctx) })
+		return g
+	})
+}
+
+func runGraphStoreConformance(t *testing.T, open openGraphStore) {
+	t.Run("access", func(t *testing.T) { testAccessConformance(t, open(t)) })
+	t.Run("blast_radius", func(t *testing.T) { testBlastRadiusConformance(t, open(t)) })
+	t.Run("trust", func(t *testing.T) { testTrustConformance(t, open(t)) })
+	t.Run("export", func(t *testing.T) { testExportConformance(t, open(t)) })
+	t.Run("lineage", func(t *testing.T) { testLineageConformance(t, open(t)) })
+	t.Run("ai_models", func(t *testing.T) { testAIModelConformance(t, open(t)) })
+}
+
+// accessFixture is two accounts: A, whose scans are applied, and B, whose
+// partner role reaches into A
+type accessFixture struct {
+	accountA, accountB *models.CloudAccount
+	customers, reports *models.DataAsset
+	logs               *models.DataAsset
+	update             *GraphUpdate
+}
+
+const (
+	aliceARN   = "arn:aws:iam::111111111111:user/alice"
+	groupARN   = "arn:aws:iam::111111111111:group/analysts"
+	adminARN   = "arn:aws:iam::111111111111:role/admin"
+	openARN    = "arn:aws:iam::111111111111:role/open"
+	partnerARN = "arn:aws:iam::222222222222:role/partner"
+	readARN    = "arn:aws:iam::111111111111:policy/read-data"
+	boundARN   = "arn:aws:iam::111111111111:policy/boundary"
+	lambdaARN  = "lambda.amazonaws.com"
+)
+
+func newAccessFixture() *accessFixture {
+	f := &accessFixture{
+		accountA: &models.CloudAccount{ID: uuid.New(), Provider: models.ProviderAWS, ExternalID: "111111111111", Status: "active"},
+		accountB: &models.CloudAccount{ID: uuid.New(), Provider: models.ProviderAWS, ExternalID: "222222222222", Status: "active"},
+	}
+	asset := func(name string, sensitivity models.Sensitivity) *models.DataAsset {
+		return &models.DataAsset{
+			ID:               uuid.New(),
+			AccountID:        f.accountA.ID,
+			ResourceType:     models.ResourceTypeS3Bucket,
+			ResourceARN:      "arn:aws:s3:::" + name,
+			Name:             name,
+			SensitivityLevel: sensitivity,
+		}
+	}
+	f.customers = asset("customers", models.SensitivityCritical)
+	f.reports = asset("reports", models.SensitivityHigh)
+	f.logs = asset("logs", models.SensitivityLow)
+
+	principal := func(arn, typ string) Principal {
+		return Principal{ID: principalID(arn), ARN: arn, Name: arn[strings.LastIndex(arn, "/")+1:], Type: typ}
+	}
+	edge := func(source string, target *models.DataAsset, level models.PermissionLevel, permissions ...string) models.AccessEdge {
+		return models.AccessEdge{
+			ID:              uuid.New(),
+			SourceARN:       source,
+			TargetAssetID:   target.ID,
+			PermissionLevel: level,
+			Permissions:     permissions,
+			IsDirect:        true,
+		}
+	}
+
+	f.update = &GraphUpdate{
+		Assets: []*models.DataAsset{f.customers, f.reports, f.logs},
+		Principals: []Principal{
+			principal(aliceARN, "USER"),
+			principal(groupARN, "GROUP"),
+			principal(adminARN, "ROLE"),
+			principal(openARN, "ROLE"),
+			principal(lambdaARN, PrincipalTypeService),
+		},
+		Policies: []models.AccessPolicy{
+			{ID: principalID(readARN), AccountID: f.accountA.ID, PolicyARN: readARN, PolicyName: "read-data", PolicyType: "MANAGED"},
+			{ID: principalID(boundARN), AccountID: f.accountA.ID, PolicyARN: boundARN, PolicyName: "boundary", PolicyType: "MANAGED"},
+		},
+		Attachments: []PolicyAttachment{
+			{PolicyARN: readARN, PrincipalARN: groupARN},
+			{PolicyARN: boundARN, PrincipalARN: adminARN, Boundary: true},
+		},
+		Memberships: []GroupMembership{{MemberARN: aliceARN, GroupARN: groupARN}},
+		Assumptions: []RoleAssumption{
+			{SourceARN: aliceARN, RoleARN: adminARN},
+			{SourceARN: lambdaARN, RoleARN: adminARN},
+			{SourceARN: PublicPrincipalARN, RoleARN: openARN},
+		},
+		AccessEdges: []models.AccessEdge{
+			edge(aliceARN, f.customers, models.PermissionRead, "s3:GetObject"),
+			edge(adminARN, f.customers, models.PermissionFull, "s3:GetObject", "s3:PutObject"),
+			edge(adminARN, f.reports, models.PermissionAdmin, "s3:PutBucketPolicy"),
+			edge(openARN, f.reports, models.PermissionRead, "s3:GetObject"),
+		},
+		PublicAccess: []PublicAccess{{AssetID: f.logs.ID, Permissions: []string{"s3:GetObject"}}},
+		Classifications: []ClassificationRollup{
+			{AssetID: f.customers.ID, Category: models.CategoryPII, Sensitivity: models.SensitivityCritical, Count: 10},
+			{AssetID: f.customers.ID, Category: models.CategoryPCI, Sensitivity: models.SensitivityHigh, Count: 2},
+			{AssetID: f.reports.ID, Category: models.CategoryPII, Sensitivity: models.SensitivityHigh, Count: 3},
+		},
+	}
+	return f
+}
+
+// recordKeys reduces access records to comparable, sorted strings
+func recordKeys(records []AccessRecord) []string {
+	keys := make([]string, 0, len(records))
+	for _, r := range records {
+		keys = append(keys, fmt.Sprintf("%s %s %s %s %s %v %v", r.PrincipalARN, r.PrincipalType, r.AssetARN,
+			r.PermissionLevel, r.Sensitivity, r.Permissions, r.CrossAccount))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// testTrustConformance checks that identity providers and external
+// accounts reach into an account through the roles they can assume
+func testTrustConformance(t *testing.T, g GraphStore) {
+	ctx := context.Background()
+	f := newAccessFixture()
+
+	const (
+		githubARN   = "arn:aws:iam::111111111111:oidc-provider/token.actions.githubusercontent.com"
+		externalARN = "arn:aws:iam::333333333333:root"
+	)
+	update := *f.update
+	update.Principals = append(append([]Principal(nil), update.Principals...),
+		Principal{ID: principalID(githubARN), ARN: githubARN, Name: "token.actions.githubusercontent.com", Type: PrincipalTypeIdentityProvider},
+		Principal{ID: principalID(externalARN), ARN: externalARN, Name: "333333333333", Type: PrincipalTypeExternalAccount},
+	)
+	update.Assumptions = append(append([]RoleAssumption(nil), update.Assumptions...),
+		RoleAssumption{SourceARN: githubARN, RoleARN: adminARN},
+		RoleAssumption{SourceARN: externalARN, RoleARN: openARN},
+	)
+	if _, err := g.Apply(ctx, f.accountA, &update); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	cross, err := g.FindCrossAccountAccess(ctx, f.accountA.ID)
+	if err != nil {
+		t.Fatalf("FindCrossAccountAccess: %v", err)
+	}
+	expected := []string{
+		PublicPrincipalARN + " PUBLIC arn:aws:s3:::logs  LOW [s3:GetObject] true",
+		githubARN + " IDENTITY_PROVIDER arn:aws:s3:::customers FULL CRITICAL [s3:GetObject s3:PutObject] true",
+		githubARN + " IDENTITY_PROVIDER arn:aws:s3:::reports ADMIN HIGH [s3:PutBucketPolicy] true",
+		externalARN + " EXTERNAL_ACCOUNT arn:aws:s3:::reports READ HIGH [s3:GetObject] true",
+	}
+	sort.Strings(expected)
+	if got := recordKeys(cross); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected cross-account access\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// A rescan no longer trusting either removes the provider, but keeps the
+	// external account, which other accounts may trust
+	removed, err := g.Apply(ctx, f.accountA, f.update)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("expected both assumptions and the provider removed, got %d", removed)
+	}
+	cross, _ = g.FindCrossAccountAccess(ctx, f.accountA.ID)
+	if len(cross) != 1 {
+		t.Errorf("expected only public access after rescan, got %v", recordKeys(cross))
+	}
+}
+
+func testAccessConformance(t *testing.T, g GraphStore) {
+	ctx := context.Background()
+	f := newAccessFixture()
+
+	if err := g.UpsertAccount(ctx, f.accountB); err != nil {
+		t.Fatalf("UpsertAccount: %v", err)
+	}
+	removed, err := g.Apply(ctx, f.accountA, f.update)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("expected nothing removed from an empty graph, got %d", removed)
+	}
+
+	// partner belongs to B but can read A's customers
+	if err := g.UpsertPrincipal(ctx, f.accountB.ID, &Principal{ID: uuid.New(), ARN: partnerARN, Name: "partner", Type: "ROLE"}); err != nil {
+		t.Fatalf("UpsertPrincipal: %v", err)
+	}
+	if err := g.CreateAccessEdge(ctx, &models.AccessEdge{
+		ID:              uuid.New(),
+		SourceARN:       partnerARN,
+		TargetAssetID:   f.customers.ID,
+		PermissionLevel: models.PermissionRead,
+		Permissions:     []string{"s3:GetObject"},
+		IsCrossAccount:  true,
+	}); err != nil {
+		t.Fatalf("CreateAccessEdge: %v", err)
+	}
+
+	paths, err := g.FindPublicAccessPaths(ctx, &f.accountA.ID, 3)
+	if err != nil {
+		t.Fatalf("FindPublicAccessPaths: %v", err)
+	}
+	expectedPath := []string{PublicPrincipalARN, openARN, f.reports.ResourceARN}
+	if len(paths) != 1 || !reflect.DeepEqual(paths[0].Path, expectedPath) || paths[0].HopCount != 2 || !paths[0].IsPublic {
+		t.Errorf("expected the public path %v, got %+v", expectedPath, paths)
+	}
+	if paths, _ := g.FindPublicAccessPaths(ctx, &f.accountA.ID, 1); len(paths) != 0 {
+		t.Errorf("expected no public path within 1 hop, got %+v", paths)
+	}
+	if paths, _ := g.FindPublicAccessPaths(ctx, &f.accountB.ID, 3); len(paths) != 0 {
+		t.Errorf("expected no public path to account B, got %+v", paths)
+	}
+
+	pii, err := g.FindAccessToPII(ctx, &f.accountA.ID)
+	if err != nil {
+		t.Fatalf("FindAccessToPII: %v", err)
+	}
+	expected := []string{
+		adminARN + " ROLE arn:aws:s3:::customers  CRITICAL [s3:GetObject s3:PutObject] false",
+		adminARN + " ROLE arn:aws:s3:::reports  HIGH [s3:PutBucketPolicy] false",
+		openARN + " ROLE arn:aws:s3:::reports  HIGH [s3:GetObject] false",
+		partnerARN + " ROLE arn:aws:s3:::customers  CRITICAL [s3:GetObject] false",
+		aliceARN + " USER arn:aws:s3:::customers  CRITICAL [s3:GetObject] false",
+	}
+	sort.Strings(expected)
+	if got := recordKeys(pii); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected PII access\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	for i := 1; i < len(pii); i++ {
+		if pii[i-1].Sensitivity < pii[i].Sensitivity {
+			t.Errorf("expected PII access ordered by sensitivity, got %s before %s", pii[i-1].Sensitivity, pii[i].Sensitivity)
+		}
+	}
+
+	over, err := g.FindOverprivilegedAccess(ctx, &f.accountA.ID)
+	if err != nil {
+		t.Fatalf("FindOverprivilegedAccess: %v", err)
+	}
+	expected = []string{
+		adminARN + " ROLE arn:aws:s3:::customers FULL CRITICAL [] false",
+		adminARN + " ROLE arn:aws:s3:::reports ADMIN HIGH [] false",
+	}
+	if got := recordKeys(over); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected overprivileged access\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	// Both backends order by the sensitivity name, as Cypher does
+	if len(over) == 2 && over[0].Sensitivity < over[1].Sensitivity {
+		t.Errorf("expected overprivileged access ordered by sensitivity, got %+v", over)
+	}
+
+	cross, err := g.FindCrossAccountAccess(ctx, f.accountA.ID)
+	if err != nil {
+		t.Fatalf("FindCrossAccountAccess: %v", err)
+	}
+	// Everyone is outside the account too
+	expected = []string{
+		partnerARN + " ROLE arn:aws:s3:::customers  CRITICAL [s3:GetObject] true",
+		PublicPrincipalARN + " PUBLIC arn:aws:s3:::logs  LOW [s3:GetObject] true",
+	}
+	sort.Strings(expected)
+	if got := recordKeys(cross); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected cross-account access %v, got %v", expected, got)
+	}
+
+	stats, err := g.GetAccessStats(ctx, &f.accountA.ID)
+	if err != nil {
+		t.Fatalf("GetAccessStats: %v", err)
+	}
+	expectedTypes := map[string]int{"USER": 1, "GROUP": 1, "ROLE": 2, PrincipalTypeService: 1}
+	if !reflect.DeepEqual(stats.PrincipalsByType, expectedTypes) {
+		t.Errorf("expected principals %v, got %v", expectedTypes, stats.PrincipalsByType)
+	}
+	if stats.PublicAccessCount != 1 || stats.CrossAccountCount != 1 || stats.OverprivilegedCount != 2 {
+		t.Errorf("expected 1 public, 1 cross-account and 2 overprivileged, got %+v", stats)
+	}
+
+	// A rescan without alice, the read-data policy and the PCI findings
+	rescan := *f.update
+	rescan.Principals = rescan.Principals[1:]
+	rescan.Policies = rescan.Policies[1:]
+	rescan.Attachments = rescan.Attachments[1:]
+	rescan.Memberships = nil
+	rescan.Assumptions = rescan.Assumptions[1:]
+	rescan.AccessEdges = rescan.AccessEdges[1:]
+	rescan.Classifications = []ClassificationRollup{rescan.Classifications[0], rescan.Classifications[2]}
+
+	removed, err = g.Apply(ctx, f.accountA, &rescan)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	// alice's and partner's access, the PCI finding, alice's membership and
+	// assumption, the read-data attachment, alice, and the read-data policy
+	if removed != 8 {
+		t.Errorf("expected 8 stale relationships and nodes removed, got %d", removed)
+	}
+
+	pii, _ = g.FindAccessToPII(ctx, &f.accountA.ID)
+	for _, r := range pii {
+		if r.PrincipalARN == aliceARN || r.PrincipalARN == partnerARN {
+			t.Errorf("expected %s's access removed, got %+v", r.PrincipalARN, r)
+		}
+	}
+	if len(pii) != 3 {
+		t.Errorf("expected 3 PII access records after rescan, got %d", len(pii))
+	}
+	stats, _ = g.GetAccessStats(ctx, &f.accountA.ID)
+	if _, ok := stats.PrincipalsByType["USER"]; ok {
+		t.Errorf("expected no users after rescan, got %v", stats.PrincipalsByType)
+	}
+	paths, _ = g.FindPublicAccessPaths(ctx, nil, 3)
+	if len(paths) != 1 {
+		t.Errorf("expected the public path kept after rescan, got %+v", paths)
+	}
+
+	// Reapplying the same scan removes nothing
+	removed, err = g.Apply(ctx, f.accountA, &rescan)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("expected nothing removed by an identical rescan, got %d", removed)
+	}
+}
+
+func testLineageConformance(t *testing.T, g GraphStore) {
+	ctx := context.Background()
+	account := &models.CloudAccount{ID: uuid.New(), Provider: models.ProviderAWS, ExternalID: "111111111111"}
+	customers := &models.DataAsset{
+		ID:               uuid.New(),
+		AccountID:        account.ID,
+		ResourceType:     models.ResourceTypeS3Bucket,
+		ResourceARN:      "arn:aws:s3:::customers",
+		Name:             "customers",
+		SensitivityLevel: models.SensitivityCritical,
+	}
+	const (
+		etlARN       = "arn:aws:lambda:us-east-1:111111111111:function:etl"
+		warehouseARN = "arn:aws:redshift:us-east-1:111111111111:cluster:warehouse"
+		externalARN  = "arn:aws:s3:::partner-exports"
+		archiveARN   = "arn:aws:s3:::archive"
+	)
+
+	if err := g.UpsertAccount(ctx, account); err != nil {
+		t.Fatalf("UpsertAccount: %v", err)
+	}
+	if err := g.UpsertAsset(ctx, customers); err != nil {
+		t.Fatalf("UpsertAsset: %v", err)
+	}
+	if err := g.UpsertFunction(ctx, account.ID, &FunctionNode{ID: uuid.New(), ARN: etlARN, Name: "etl", Runtime: "python3.12"}); err != nil {
+		t.Fatalf("UpsertFunction: %v", err)
+	}
+	for _, e := range []LineageEdge{
+		{SourceARN: customers.ResourceARN, TargetARN: etlARN, FlowType: "READS_FROM"},
+		{SourceARN: etlARN, TargetARN: warehouseARN, TargetType: "redshift_cluster", FlowType: "WRITES_TO"},
+		{SourceARN: warehouseARN, TargetARN: externalARN, TargetType: "s3_bucket", FlowType: "EXPORTS_TO"},
+		// Unknown flows are stored but not followed
+		{SourceARN: customers.ResourceARN, TargetARN: archiveARN, FlowType: "SYNCS"},
+	} {
+		e.ID = uuid.New()
+		if err := g.CreateLineageEdge(ctx, &e); err != nil {
+			t.Fatalf("CreateLineageEdge: %v", err)
+		}
+	}
+
+	flows, err := g.FindDataFlowPaths(ctx, customers.ResourceARN, 0)
+	if err != nil {
+		t.Fatalf("FindDataFlowPaths: %v", err)
+	}
+	var got []string
+	for _, p := range flows {
+		got = append(got, fmt.Sprintf("%d %v %v", p.HopCount, p.Path, p.FlowTypes))
+	}
+	sort.Strings(got)
+	expected := []string{
+		fmt.Sprintf("1 [%s %s] [READS_FROM]", customers.ResourceARN, etlARN),
+		fmt.Sprintf("2 [%s %s %s] [READS_FROM WRITES_TO]", customers.ResourceARN, etlARN, warehouseARN),
+		fmt.Sprintf("3 [%s %s %s %s] [READS_FROM WRITES_TO EXPORTS_TO]", customers.ResourceARN, etlARN, warehouseARN, externalARN),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected flows\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	if flows, _ := g.FindDataFlowPaths(ctx, customers.ResourceARN, 2); len(flows) != 2 {
+		t.Errorf("expected 2 flows within 2 hops, got %+v", flows)
+	}
+
+	sensitive, err := g.FindSensitiveDataFlows(ctx, &account.ID)
+	if err != nil {
+		t.Fatalf("FindSensitiveDataFlows: %v", err)
+	}
+	if len(sensitive) != 1 || sensitive[0].OriginARN != customers.ResourceARN || sensitive[0].DestinationARN != etlARN {
+		t.Errorf("expected the customers to etl flow, got %+v", sensitive)
+	}
+
+	lineage, err := g.GetLineageForAsset(ctx, externalARN)
+	if err != nil {
+		t.Fatalf("GetLineageForAsset: %v", err)
+	}
+	var nodes []string
+	for _, n := range lineage.Nodes {
+		nodes = append(nodes, n.ARN)
+		if n.ARN == customers.ResourceARN && (n.Name != "customers" || n.Type != string(models.ResourceTypeS3Bucket)) {
+			t.Errorf("expected the customers asset's name and type, got %+v", n)
+		}
+	}
+	sort.Strings(nodes)
+	expectedNodes := []string{customers.ResourceARN, etlARN, externalARN, warehouseARN}
+	sort.Strings(expectedNodes)
+	if !reflect.DeepEqual(nodes, expectedNodes) {
+		t.Errorf("expected lineage nodes %v, got %v", expectedNodes, nodes)
+	}
+	var edges []string
+	for _, e := range lineage.Edges {
+		edges = append(edges, e.Source+" "+e.FlowType+" "+e.Target)
+	}
+	sort.Strings(edges)
+	expectedEdges := []string{
+		customers.ResourceARN + " READS_FROM " + etlARN,
+		etlARN + " WRITES_TO " + warehouseARN,
+		warehouseARN + " EXPORTS_TO " + externalARN,
+	}
+	sort.Strings(expectedEdges)
+	if !reflect.DeepEqual(edges, expectedEdges) {
+		t.Errorf("expected lineage edges %v, got %v", expectedEdges, edges)
+	}
+}
+
+// reachKeys reduces reachable assets to comparable strings, keeping order
+func reachKeys(results []ReachableAccess) []string {
+	keys := make([]string, 0, len(results))
+	for _, r := range results {
+		keys = append(keys, fmt.Sprintf("%s %s %s %v %s %v %d %d %v", r.PrincipalARN, r.AssetARN, r.Sensitivity,
+			r.Permissions, r.PermissionLevel, r.Categories, r.RecordCount, r.HopCount, r.Path))
+	}
+	return keys
+}
+
+// testExportConformance checks export filters, and that an export restores
+// into an empty in-memory graph as it was
+func testExportConformance(t *testing.T, g GraphStore) {
+	ctx := context.Background()
+	f := newAccessFixture()
+
+	if err := g.UpsertAccount(ctx, f.accountB); err != nil {
+		t.Fatalf("UpsertAccount: %v", err)
+	}
+	if _, err := g.Apply(ctx, f.accountA, f.update); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	all, err := g.Export(ctx, ExportFilter{})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	// Two accounts, three assets, six principals with public, two policies
+	// and three classifications
+	if len(all.Nodes) != 16 {
+		t.Errorf("expected 16 nodes, got %d", len(all.Nodes))
+	}
+
+	ids := func(s *GraphSnapshot) map[string]bool {
+		set := make(map[string]bool, len(s.Nodes))
+		for _, n := range s.Nodes {
+			set[n.ID] = true
+		}
+		return set
+	}
+	sensitive, err := g.Export(ctx, ExportFilter{MinSensitivity: models.SensitivityHigh})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if got := ids(sensitive); got["DataAsset|"+f.logs.ID.String()] || !got["DataAsset|"+f.reports.ID.String()] {
+		t.Errorf("expected only high and critical assets, got %v", got)
+	}
+	for _, l := range sensitive.Links {
+		if l.Target == "DataAsset|"+f.logs.ID.String() {
+			t.Errorf("expected no relationships to logs, got %+v", l)
+		}
+	}
+	if len(sensitive.Nodes) != len(all.Nodes)-1 {
+		t.Errorf("expected only logs left out, got %d nodes", len(sensitive.Nodes))
+	}
+
+	scoped, err := g.Export(ctx, ExportFilter{AccountID: &f.accountB.ID})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(scoped.Nodes) != 1 || scoped.Nodes[0].ID != "CloudAccount|"+f.accountB.ID.String() || len(scoped.Links) != 0 {
+		t.Errorf("expected only account B, got %+v", scoped)
+	}
+	if _, err := g.Export(ctx, ExportFilter{MinSensitivity: "SECRET"}); err == nil {
+		t.Errorf("expected an unknown sensitivity to be rejected")
+	}
+
+	// Restore through both readable formats
+	for _, format := range []string{FormatJSON, FormatGraphML} {
+		var buf strings.Builder
+		if err := all.Write(&buf, format); err != nil {
+			t.Fatalf("%s: Write: %v", format, err)
+		}
+		snapshot, err := ReadSnapshot(strings.NewReader(buf.String()), format)
+		if err != nil {
+			t.Fatalf("%s: ReadSnapshot: %v", format, err)
+		}
+		restored, _ := NewMemoryGraph(ctx, nil)
+		if err := restored.Import(ctx, snapshot); err != nil {
+			t.Fatalf("%s: Import: %v", format, err)
+		}
+		again, err := restored.Export(ctx, ExportFilter{})
+		if err != nil {
+			t.Fatalf("%s: Export: %v", format, err)
+		}
+		if expected, got := snapshotJSON(t, all), snapshotJSON(t, again); expected != got {
+			t.Errorf("%s: expected the restored graph to export as the original\n%s\ngot\n%s", format, expected, got)
+		}
+
+		paths, err := restored.FindPublicAccessPaths(ctx, &f.accountA.ID, 3)
+		if err != nil || len(paths) != 1 {
+			t.Errorf("%s: expected the public path restored, got %+v, %v", format, paths, err)
+		}
+	}
+}
+
+// snapshotJSON encodes a snapshot after normalizing it as it is read back
+func snapshotJSON(t *testing.T, s *GraphSnapshot) string {
+	var buf strings.Builder
+	if err := s.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	normalized, err := ReadSnapshot(strings.NewReader(buf.String()), FormatJSON)
+	if err != nil {
+		t.Fatalf("ReadSnapshot: %v", err)
+	}
+	buf.Reset()
+	if err := normalized.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	return buf.String()
+}
+
+func testBlastRadiusConformance(t *testing.T, g GraphStore) {
+	ctx := context.Background()
+	f := newAccessFixture()
+	if _, err := g.Apply(ctx, f.accountA, f.update); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	blast, err := g.FindBlastRadius(ctx, aliceARN, 3)
+	if err != nil {
+		t.Fatalf("FindBlastRadius: %v", err)
+	}
+	// alice reads customers herself and reaches the rest through admin
+	expected := []string{
+		aliceARN + " arn:aws:s3:::customers CRITICAL [s3:GetObject s3:PutObject] FULL [PCI PII] 12 0 [" + aliceARN + " arn:aws:s3:::customers]",
+		aliceARN + " arn:aws:s3:::reports HIGH [s3:PutBucketPolicy] ADMIN [PII] 3 1 [" + aliceARN + " " + adminARN + " arn:aws:s3:::reports]",
+	}
+	if got := reachKeys(blast); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected blast radius\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	if len(blast) > 0 && blast[0].AssetID != f.customers.ID.String() {
+		t.Errorf("expected asset ID %s, got %s", f.customers.ID, blast[0].AssetID)
+	}
+
+	direct, err := g.FindBlastRadius(ctx, aliceARN, 0)
+	if err != nil {
+		t.Fatalf("FindBlastRadius: %v", err)
+	}
+	expected = []string{
+		aliceARN + " arn:aws:s3:::customers CRITICAL [s3:GetObject] READ [PCI PII] 12 0 [" + aliceARN + " arn:aws:s3:::customers]",
+	}
+	if got := reachKeys(direct); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected direct access %v, got %v", expected, got)
+	}
+
+	// A leaked session of the admin role
+	session := PrincipalForCredential("arn:aws:sts::111111111111:assumed-role/admin/incident")
+	if session != adminARN {
+		t.Fatalf("expected the session to resolve to %s, got %s", adminARN, session)
+	}
+	if blast, _ := g.FindBlastRadius(ctx, session, 3); len(blast) != 2 {
+		t.Errorf("expected admin to reach 2 assets, got %v", reachKeys(blast))
+	}
+	if blast, _ := g.FindBlastRadius(ctx, "arn:aws:iam::111111111111:user/nobody", 3); len(blast) != 0 {
+		t.Errorf("expected an unknown principal to reach nothing, got %v", reachKeys(blast))
+	}
+
+	reaching, err := g.FindPrincipalsReaching(ctx, f.reports.ResourceARN, 3)
+	if err != nil {
+		t.Fatalf("FindPrincipalsReaching: %v", err)
+	}
+	expected = []string{
+		adminARN + " arn:aws:s3:::reports HIGH [s3:PutBucketPolicy] ADMIN [PII] 3 0 [" + adminARN + " arn:aws:s3:::reports]",
+		openARN + " arn:aws:s3:::reports HIGH [s3:GetObject] READ [PII] 3 0 [" + openARN + " arn:aws:s3:::reports]",
+		aliceARN + " arn:aws:s3:::reports HIGH [s3:PutBucketPolicy] ADMIN [PII] 3 1 [" + aliceARN + " " + adminARN + " arn:aws:s3:::reports]",
+		lambdaARN + " arn:aws:s3:::reports HIGH [s3:PutBucketPolicy] ADMIN [PII] 3 1 [" + lambdaARN + " " + adminARN + " arn:aws:s3:::reports]",
+		PublicPrincipalARN + " arn:aws:s3:::reports HIGH [s3:GetObject] READ [PII] 3 1 [" + PublicPrincipalARN + " " + openARN + " arn:aws:s3:::reports]",
+	}
+	if got := reachKeys(reaching); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected principals reaching reports\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	if reaching, _ := g.FindPrincipalsReaching(ctx, f.reports.ResourceARN, 0); len(reaching) != 2 {
+		t.Errorf("expected 2 principals with direct access, got %v", reachKeys(reaching))
+	}
+}
+
+func testAIModelConformance(t *testing.T, g GraphStore) {
+	ctx := context.Background()
+	account := &models.CloudAccount{ID: uuid.New(), Provider: models.ProviderAWS, ExternalID: "111111111111"}
+	other := uuid.New()
+	const modelARN = "arn:aws:sagemaker:us-east-1:111111111111:model/churn"
+
+	if err := g.UpsertAccount(ctx, account); err != nil {
+		t.Fatalf("UpsertAccount: %v", err)
+	}
+	if err := g.UpsertAIModel(ctx, account.ID, modelARN, "churn", "sagemaker"); err != nil {
+		t.Fatalf("UpsertAIModel: %v", err)
+	}
+	for _, e := range []struct{ model, source, level string }{
+		{modelARN, "arn:aws:s3:::customers", "CRITICAL"},
+		{modelARN, "arn:aws:s3:::logs", "LOW"},
+		{"arn:aws:sagemaker:us-east-1:111111111111:model/missing", "arn:aws:s3:::customers", "HIGH"},
+	} {
+		if err := g.CreateTrainingDataEdge(ctx, e.model, e.source, e.level); err != nil {
+			t.Fatalf("CreateTrainingDataEdge: %v", err)
+		}
+	}
+
+	records, err := g.FindAIModelsAccessingSensitiveData(ctx, &account.ID)
+	if err != nil {
+		t.Fatalf("FindAIModelsAccessingSensitiveData: %v", err)
+	}
+	expected := []AIModelAccessRecord{{
+		ModelARN:         modelARN,
+		ModelName:        "churn",
+		ModelType:        "sagemaker",
+		DataSourceARN:    "arn:aws:s3:::customers",
+		SensitivityLevel: "CRITICAL",
+	}}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %+v, got %+v", expected, records)
+	}
+	if records, _ := g.FindAIModelsAccessingSensitiveData(ctx, &other); len(records) != 0 {
+		t.Errorf("expected no models in another account, got %+v", records)
+	}
+}
+
+func TestMemoryGraph_Persistence(t *testing.T) {
+	ctx := context.Background()
+	persister := &FilePersister{Path: filepath.Join(t.TempDir(), "graph.json")}
+	f := newAccessFixture()
+
+	g, err := NewMemoryGraph(ctx, persister)
+	if err != nil {
+		t.Fatalf("NewMemoryGraph: %v", err)
+	}
+	if _, err := g.Apply(ctx, f.accountA, f.update); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	before, _ := g.FindAccessToPII(ctx, nil)
+	if err := g.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewMemoryGraph(ctx, persister)
+	if err != nil {
+		t.Fatalf("NewMemoryGraph: %v", err)
+	}
+	after, _ := reopened.FindAccessToPII(ctx, nil)
+	if !reflect.DeepEqual(recordKeys(before), recordKeys(after)) {
+		t.Errorf("expected the same PII access after reopening, got %v and %v", recordKeys(before), recordKeys(after))
+	}
+
+	// The clock survives reopening, so a rescan still finds stale entries
+	rescan := *f.update
+	rescan.AccessEdges = rescan.AccessEdges[1:]
+	removed, err := reopened.Apply(ctx, f.accountA, &rescan)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("expected alice's access removed, got %d removals", removed)
+	}
+}
+
+func TestMemoryGraph_SharedPersister(t *testing.T) {
+	ctx := context.Background()
+	persister := &FilePersister{Path: filepath.Join(t.TempDir(), "graph.json")}
+	f := newAccessFixture()
+
+	open := func() *MemoryGraph {
+		t.Helper()
+		g, err := NewMemoryGraph(ctx, persister)
+		if err != nil {
+			t.Fatalf("NewMemoryGraph: %v", err)
+		}
+		return g
+	}
+	scanner, api := open(), open()
+
+	if _, err := scanner.Apply(ctx, f.accountA, f.update); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want, _ := scanner.FindAccessToPII(ctx, nil)
+
+	// A write based on the snapshot from before the scan is refused
+	if err := api.UpsertAccount(ctx, f.accountB); err != nil {
+		t.Fatalf("UpsertAccount: %v", err)
+	}
+	if err := api.Flush(ctx); !errors.Is(err, ErrStaleSnapshot) {
+		t.Fatalf("expected ErrStaleSnapshot, got %v", err)
+	}
+
+	// Apply picks up the scan before writing on top of it
+	if _, err := api.Apply(ctx, f.accountB, &GraphUpdate{}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if err := scanner.Close(ctx); err != nil {
+		t.Errorf("expected closing an unchanged graph to save nothing, got %v", err)
+	}
+
+	got, _ := open().FindAccessToPII(ctx, nil)
+	if len(want) == 0 || !reflect.DeepEqual(recordKeys(want), recordKeys(got)) {
+		t.Errorf("expected the scan to survive the second writer, got %v and %v", recordKeys(want), recordKeys(got))
+	}
+}
+
+func TestMemoryGraph_ReadsReloadSharedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	persister := &FilePersister{Path: filepath.Join(t.TempDir(), "graph.json")}
+	f := newAccessFixture()
+
+	open := func() *MemoryGraph {
+		t.Helper()
+		g, err := NewMemoryGraph(ctx, persister)
+		if err != nil {
+			t.Fatalf("NewMemoryGraph: %v", err)
+		}
+		return g
+	}
+	scanner, api := open(), open()
+
+	if _, err := scanner.Apply(ctx, f.accountA, f.update); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want, err := scanner.FindAccessToPII(ctx, nil)
+	if err != nil {
+		t.Fatalf("FindAccessToPII: %v", err)
+	}
+
+	// A graph that was open before the scan sees it on its next query
+	got, err := api.FindAccessToPII(ctx, nil)
+	if err != nil {
+		t.Fatalf("FindAccessToPII: %v", err)
+	}
+	if len(want) == 0 || !reflect.DeepEqual(recordKeys(want), recordKeys(got)) {
+		t.Errorf("expected %v, got %v", recordKeys(want), recordKeys(got))
+	}
+
+	snapshot, err := api.Export(ctx, ExportFilter{})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(snapshot.Nodes) == 0 {
+		t.Errorf("expected the export to include the scan")
+	}
+}
@@ -0,0 +1,428 @@
+package access
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// PublicPrincipalARN is the ARN of the graph node standing for everyone
+const PublicPrincipalARN = "public"
+
+// AccountAccess is what an access scan read from an account
+type AccountAccess struct {
+	// AccountID is the provider's ID for the account, such as the 12-digit
+	// AWS account ID
+	AccountID     string
+	Authorization *connectors.AuthorizationDetails
+	// RoleBindings are the Azure role assignments or GCP IAM bindings
+	// governing the account
+	RoleBindings *connectors.RoleBindings
+	Assets       []AssetAccess
+}
+
+// AssetAccess is a data asset with the controls governing access to it
+type AssetAccess struct {
+	Asset             *models.DataAsset
+	Policy            *connectors.PolicyDocument
+	ACL               *connectors.BucketACL
+	PublicAccessBlock *connectors.PublicAccessBlockConfig
+}
+
+// GraphUpdate is the access graph of an account as derived from one access
+// scan. Applying it replaces what earlier scans wrote for the account.
+type GraphUpdate struct {
+	Assets          []*models.DataAsset
+	Principals      []Principal
+	Policies        []models.AccessPolicy
+	Attachments     []PolicyAttachment
+	Memberships     []GroupMembership
+	Assumptions     []RoleAssumption
+	AccessEdges     []models.AccessEdge
+	PublicAccess    []PublicAccess
+	Classifications []ClassificationRollup
+	// Trusts are the identity providers, external accounts and wildcard
+	// principals the account's roles trust. They are reported rather than
+	// written; their nodes and role assumptions are in Principals and
+	// Assumptions.
+	Trusts []TrustRelationship
+}
+
+// PolicyAttachment links a policy to the principal it applies to
+type PolicyAttachment struct {
+	PolicyARN    string
+	PrincipalARN string
+	// Boundary is set when the policy is the principal's permissions
+	// boundary rather than a grant
+	Boundary bool
+}
+
+// GroupMembership links a user to a group
+type GroupMembership struct {
+	MemberARN string
+	GroupARN  string
+}
+
+// RoleAssumption records that a principal may assume a role. SourceARN is
+// PublicPrincipalARN when the role's trust policy admits everyone.
+type RoleAssumption struct {
+	SourceARN string
+	RoleARN   string
+}
+
+// PublicAccess is what anyone can do to an asset, through its resource
+// policy or ACL
+type PublicAccess struct {
+	AssetID     uuid.UUID
+	Permissions []string
+}
+
+// ClassificationRollup is the data of one category found in an asset
+type ClassificationRollup struct {
+	AssetID     uuid.UUID
+	Category    models.Category
+	Sensitivity models.Sensitivity
+	Count       int
+}
+
+// aclPermissions maps bucket ACL permissions to the actions they grant
+var aclPermissions = map[string][]string{
+	"READ":      {"s3:ListBucket", "s3:ListBucketVersions"},
+	"WRITE":     {"s3:PutObject", "s3:DeleteObject"},
+	"READ_ACP":  {"s3:GetBucketAcl"},
+	"WRITE_ACP": {"s3:PutBucketAcl"},
+}
+
+// principalID derives a stable node ID from an ARN, so rescans do not
+// change the IDs of existing principals and policies
+func principalID(arn string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(arn))
+}
+
+// inlinePolicyARN names an inline policy, which has no ARN of its own
+func inlinePolicyARN(principalARN, name string) string {
+	return principalARN + "/inline-policy/" + name
+}
+
+// BuildGraphUpdate evaluates an account's policies and derives its access
+// graph: principals and their policies and groups, which principals can
+// assume which roles, and the effective access of every principal, and of
+// everyone, to every asset. Azure and GCP role bindings yield principals,
+// roles and access edges of the same shape. Identity providers and external
+// accounts that roles trust become principals that can assume those roles.
+func BuildGraphUpdate(accountID uuid.UUID, scan *AccountAccess) *GraphUpdate {
+	update := &GraphUpdate{}
+	auth := scan.Authorization
+	if auth == nil {
+		auth = &connectors.AuthorizationDetails{}
+	}
+
+	managed := make(map[string]*connectors.PolicyDocument, len(auth.Policies))
+	for _, policy := range auth.Policies {
+		managed[policy.ARN] = policy.Document
+	}
+	groups := make(map[string]*connectors.PrincipalDetails, len(auth.Groups))
+	for i := range auth.Groups {
+		groups[auth.Groups[i].Name] = &auth.Groups[i]
+	}
+
+	// Managed policies are added once, when first attached
+	seenPolicies := make(map[string]bool)
+	addManaged := func(arn string) {
+		if seenPolicies[arn] {
+			return
+		}
+		seenPolicies[arn] = true
+		policy := models.AccessPolicy{
+			ID:         principalID(arn),
+			AccountID:  accountID,
+			PolicyARN:  arn,
+			PolicyName: arn[strings.LastIndex(arn, "/")+1:],
+			PolicyType: "MANAGED",
+		}
+		if doc := managed[arn]; doc != nil {
+			policy.PolicyDocument = models.JSONB{"raw": doc.Raw, "statements": doc.Statements}
+		}
+		update.Policies = append(update.Policies, policy)
+	}
+
+	// addPrincipal adds a user, group or role with its policies
+	addPrincipal := func(p *connectors.PrincipalDetails) {
+		update.Principals = append(update.Principals, Principal{
+			ID:   principalID(p.ARN),
+			ARN:  p.ARN,
+			Name: p.Name,
+			Type: p.Type,
+		})
+
+		for _, arn := range p.AttachedPolicies {
+			addManaged(arn)
+			update.Attachments = append(update.Attachments, PolicyAttachment{PolicyARN: arn, PrincipalARN: p.ARN})
+		}
+		for _, name := range sortedKeys(p.InlinePolicies) {
+			doc := p.InlinePolicies[name]
+			arn := inlinePolicyARN(p.ARN, name)
+			update.Policies = append(update.Policies, models.AccessPolicy{
+				ID:             principalID(arn),
+				AccountID:      accountID,
+				PolicyARN:      arn,
+				PolicyName:     name,
+				PolicyType:     "INLINE",
+				PolicyDocument: models.JSONB{"raw": doc.Raw, "statements": doc.Statements},
+			})
+			update.Attachments = append(update.Attachments, PolicyAttachment{PolicyARN: arn, PrincipalARN: p.ARN})
+		}
+		if p.PermissionsBoundary != "" {
+			addManaged(p.PermissionsBoundary)
+			update.Attachments = append(update.Attachments, PolicyAttachment{
+				PolicyARN:    p.PermissionsBoundary,
+				PrincipalARN: p.ARN,
+				Boundary:     true,
+			})
+		}
+	}
+
+	for i := range auth.Groups {
+		addPrincipal(&auth.Groups[i])
+	}
+	for i := range auth.Users {
+		u := &auth.Users[i]
+		addPrincipal(u)
+		for _, name := range u.Groups {
+			if group, ok := groups[name]; ok {
+				update.Memberships = append(update.Memberships, GroupMembership{MemberARN: u.ARN, GroupARN: group.ARN})
+			}
+		}
+	}
+	for i := range auth.Roles {
+		addPrincipal(&auth.Roles[i])
+	}
+
+	resolved := ResolvePrincipals(scan.AccountID, auth)
+	identities := make([]*Identity, len(resolved))
+	for i, p := range resolved {
+		identities[i] = p.Identity
+	}
+
+	update.Assumptions = roleAssumptions(scan.AccountID, auth.Roles, identities, update)
+
+	for _, assetAccess := range scan.Assets {
+		asset := assetAccess.Asset
+		update.Assets = append(update.Assets, asset)
+		resource := &Resource{ARN: asset.ResourceARN, AccountID: scan.AccountID, Policy: assetAccess.Policy}
+
+		for _, id := range identities {
+			access := EvaluateAccess(id, resource)
+			if access == nil {
+				continue
+			}
+			edge := models.AccessEdge{
+				ID:              uuid.New(),
+				SourceType:      id.Type,
+				SourceARN:       id.ARN,
+				SourceName:      id.ARN[strings.LastIndex(id.ARN, "/")+1:],
+				TargetAssetID:   asset.ID,
+				TargetARN:       asset.ResourceARN,
+				PermissionLevel: access.PermissionLevel,
+				Permissions:     append(append([]string(nil), access.Actions...), access.ConditionalActions...),
+				GrantType:       "EFFECTIVE_POLICY",
+				IsDirect:        true,
+				IsCrossAccount:  access.IsCrossAccount,
+			}
+			if len(access.ConditionalActions) > 0 {
+				edge.Conditions = models.JSONB{"conditional_actions": access.ConditionalActions}
+			}
+			update.AccessEdges = append(update.AccessEdges, edge)
+		}
+
+		if permissions := publicPermissions(resource, assetAccess); len(permissions) > 0 {
+			update.PublicAccess = append(update.PublicAccess, PublicAccess{AssetID: asset.ID, Permissions: permissions})
+		}
+	}
+
+	if scan.RoleBindings != nil {
+		addRoleBindings(accountID, scan, update)
+	}
+	addTrust(scan, update)
+
+	return update
+}
+
+// PrincipalPolicies is a principal's identity with the ARNs of the policies
+// in effect for it, in the order of Identity.Policies
+type PrincipalPolicies struct {
+	Identity   *Identity
+	PolicyARNs []string
+}
+
+// ResolvePrincipals returns the users and roles of an account with the
+// policies in effect for each: attached and inline policies, and for users
+// those of their groups
+func ResolvePrincipals(accountID string, auth *connectors.AuthorizationDetails) []PrincipalPolicies {
+	managed := make(map[string]*connectors.PolicyDocument, len(auth.Policies))
+	for _, policy := range auth.Policies {
+		managed[policy.ARN] = policy.Document
+	}
+
+	own := func(p *connectors.PrincipalDetails) ([]*connectors.PolicyDocument, []string) {
+		var docs []*connectors.PolicyDocument
+		var arns []string
+		for _, arn := range p.AttachedPolicies {
+			if doc := managed[arn]; doc != nil {
+				docs = append(docs, doc)
+				arns = append(arns, arn)
+			}
+		}
+		for _, name := range sortedKeys(p.InlinePolicies) {
+			docs = append(docs, p.InlinePolicies[name])
+			arns = append(arns, inlinePolicyARN(p.ARN, name))
+		}
+		return docs, arns
+	}
+
+	// A missing boundary document leaves the principal unbounded, which can
+	// only overstate its access
+	resolve := func(p *connectors.PrincipalDetails, docs []*connectors.PolicyDocument, arns []string) PrincipalPolicies {
+		id := &Identity{
+			ARN:       p.ARN,
+			AccountID: accountID,
+			Type:      p.Type,
+			Tags:      p.Tags,
+			Policies:  docs,
+		}
+		if p.PermissionsBoundary != "" {
+			id.PermissionsBoundary = managed[p.PermissionsBoundary]
+		}
+		return PrincipalPolicies{Identity: id, PolicyARNs: arns}
+	}
+
+	groups := make(map[string]*connectors.PrincipalDetails, len(auth.Groups))
+	for i := range auth.Groups {
+		groups[auth.Groups[i].Name] = &auth.Groups[i]
+	}
+
+	var principals []PrincipalPolicies
+	for i := range auth.Users {
+		u := &auth.Users[i]
+		docs, arns := own(u)
+		for _, name := range u.Groups {
+			group, ok := groups[name]
+			if !ok {
+				continue
+			}
+			groupDocs, groupARNs := own(group)
+			docs = append(docs, groupDocs...)
+			arns = append(arns, groupARNs...)
+		}
+		principals = append(principals, resolve(u, docs, arns))
+	}
+	for i := range auth.Roles {
+		r := &auth.Roles[i]
+		docs, arns := own(r)
+		principals = append(principals, resolve(r, docs, arns))
+	}
+	return principals
+}
+
+// roleAssumptions evaluates each role's trust policy for every principal
+// in the account, for everyone, and for the services it names. Service
+// principals found are added to the update.
+func roleAssumptions(accountID string, roles []connectors.PrincipalDetails, identities []*Identity, update *GraphUpdate) []RoleAssumption {
+	services := make(map[string]bool)
+	for _, role := range roles {
+		if role.TrustPolicy == nil {
+			continue
+		}
+		for _, stmt := range role.TrustPolicy.Statements {
+			for _, service := range stmt.ServicePrincipals {
+				services[service] = true
+			}
+		}
+	}
+
+	candidates := append([]*Identity(nil), identities...)
+	for _, service := range sortedKeys(services) {
+		candidates = append(candidates, &Identity{ARN: service, Type: PrincipalTypeService})
+		update.Principals = append(update.Principals, Principal{
+			ID:   principalID(service),
+			ARN:  service,
+			Name: service,
+			Type: PrincipalTypeService,
+		})
+	}
+	candidates = append(candidates, AnonymousIdentity())
+
+	var assumptions []RoleAssumption
+	for _, role := range roles {
+		if role.TrustPolicy == nil {
+			continue
+		}
+		resource := &Resource{ARN: role.ARN, AccountID: accountID, Policy: role.TrustPolicy}
+		for _, id := range candidates {
+			if id.ARN == role.ARN {
+				continue
+			}
+			switch Evaluate(id, resource, Request{Action: "sts:AssumeRole"}).Decision {
+			case DecisionAllow, DecisionConditional:
+				source := id.ARN
+				if id.isAnonymous() {
+					source = PublicPrincipalARN
+				}
+				assumptions = append(assumptions, RoleAssumption{SourceARN: source, RoleARN: role.ARN})
+			}
+		}
+	}
+	return assumptions
+}
+
+// publicPermissions returns what anyone can do to an asset through its
+// resource policy or ACL, honoring the bucket's public access block
+func publicPermissions(resource *Resource, assetAccess AssetAccess) []string {
+	block := assetAccess.PublicAccessBlock
+	set := make(map[string]bool)
+
+	if block == nil || !block.RestrictPublicBuckets {
+		if access := EvaluateAccess(AnonymousIdentity(), resource); access != nil {
+			for _, action := range access.Actions {
+				set[action] = true
+			}
+			for _, action := range access.ConditionalActions {
+				set[action] = true
+			}
+		}
+	}
+
+	if assetAccess.ACL != nil && (block == nil || !block.IgnorePublicAcls) {
+		for _, grant := range assetAccess.ACL.Grants {
+			if !grant.IsPublic {
+				continue
+			}
+			if grant.Permission == "FULL_CONTROL" {
+				for _, actions := range aclPermissions {
+					for _, action := range actions {
+						set[action] = true
+					}
+				}
+				continue
+			}
+			for _, action := range aclPermissions[grant.Permission] {
+				set[action] = true
+			}
+		}
+	}
+
+	return sortedKeys(set)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
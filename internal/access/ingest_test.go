@@ -0,0 +1,149 @@
+package access
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+func TestBuildGraphUpdate(t *testing.T) {
+	const account = "111111111111"
+	readData := mustPolicy(t, `{"Statement": {"Effect": "Allow", "Action": ["s3:GetObject", "s3:ListBucket"], "Resource": "*"}}`)
+	assume := mustPolicy(t, `{"Statement": {"Effect": "Allow", "Action": "sts:AssumeRole", "Resource": "arn:aws:iam::111111111111:role/admin"}}`)
+	adminAccess := mustPolicy(t, `{"Statement": {"Effect": "Allow", "Action": "*", "Resource": "*"}}`)
+
+	auth := &connectors.AuthorizationDetails{
+		Users: []connectors.PrincipalDetails{
+			{
+				Principal:      connectors.Principal{ARN: "arn:aws:iam::111111111111:user/alice", Name: "alice", Type: "USER"},
+				Groups:         []string{"analysts", "missing"},
+				InlinePolicies: map[string]*connectors.PolicyDocument{"assume-admin": assume},
+			},
+			{
+				Principal: connectors.Principal{ARN: "arn:aws:iam::111111111111:user/bob", Name: "bob", Type: "USER"},
+			},
+		},
+		Groups: []connectors.PrincipalDetails{
+			{
+				Principal:        connectors.Principal{ARN: "arn:aws:iam::111111111111:group/analysts", Name: "analysts", Type: "GROUP"},
+				AttachedPolicies: []string{"arn:aws:iam::111111111111:policy/read-data"},
+			},
+		},
+		Roles: []connectors.PrincipalDetails{
+			{
+				Principal:        connectors.Principal{ARN: "arn:aws:iam::111111111111:role/admin", Name: "admin", Type: "ROLE"},
+				AttachedPolicies: []string{"arn:aws:iam::aws:policy/AdministratorAccess"},
+				TrustPolicy: mustPolicy(t, `{"Statement": [
+					{"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::111111111111:root"}, "Action": "sts:AssumeRole"},
+					{"Effect": "Allow", "Principal": {"Service": "lambda.amazonaws.com"}, "Action": "sts:AssumeRole"}
+				]}`),
+			},
+			{
+				Principal: connectors.Principal{ARN: "arn:aws:iam::111111111111:role/open", Name: "open", Type: "ROLE"},
+				TrustPolicy: mustPolicy(t,
+					`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "sts:AssumeRole"}}`),
+			},
+		},
+		Policies: []connectors.ManagedPolicy{
+			{PolicyInfo: connectors.PolicyInfo{ARN: "arn:aws:iam::111111111111:policy/read-data"}, Document: readData},
+			{PolicyInfo: connectors.PolicyInfo{ARN: "arn:aws:iam::aws:policy/AdministratorAccess"}, Document: adminAccess},
+		},
+	}
+
+	private := &models.DataAsset{ID: uuid.New(), ResourceARN: "arn:aws:s3:::private", Name: "private"}
+	website := &models.DataAsset{ID: uuid.New(), ResourceARN: "arn:aws:s3:::website", Name: "website"}
+	blocked := &models.DataAsset{ID: uuid.New(), ResourceARN: "arn:aws:s3:::blocked", Name: "blocked"}
+	publicACL := &connectors.BucketACL{Grants: []connectors.ACLGrant{
+		{Grantee: "http://acs.amazonaws.com/groups/global/AllUsers", Permission: "READ", IsPublic: true},
+		{Grantee: "owner", Permission: "FULL_CONTROL"},
+	}}
+
+	update := BuildGraphUpdate(uuid.New(), &AccountAccess{
+		AccountID:     account,
+		Authorization: auth,
+		Assets: []AssetAccess{
+			{Asset: private},
+			{
+				Asset: website,
+				Policy: mustPolicy(t, `{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+					"Resource": "arn:aws:s3:::website/*"}}`),
+				ACL: publicACL,
+			},
+			{
+				Asset: blocked,
+				Policy: mustPolicy(t, `{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject",
+					"Resource": "arn:aws:s3:::blocked/*"}}`),
+				ACL:               publicACL,
+				PublicAccessBlock: &connectors.PublicAccessBlockConfig{RestrictPublicBuckets: true, IgnorePublicAcls: true},
+			},
+		},
+	})
+
+	// 2 users, 1 group, 2 roles and the service named in a trust policy
+	if len(update.Principals) != 6 {
+		t.Errorf("expected 6 principals, got %d", len(update.Principals))
+	}
+	// 2 managed policies and alice's inline policy
+	if len(update.Policies) != 3 {
+		t.Errorf("expected 3 policies, got %d", len(update.Policies))
+	}
+	if len(update.Memberships) != 1 || update.Memberships[0].GroupARN != "arn:aws:iam::111111111111:group/analysts" {
+		t.Errorf("expected alice's membership of analysts only, got %+v", update.Memberships)
+	}
+
+	assumptions := make(map[RoleAssumption]bool)
+	for _, a := range update.Assumptions {
+		assumptions[a] = true
+	}
+	expectedAssumptions := []RoleAssumption{
+		{SourceARN: "arn:aws:iam::111111111111:user/alice", RoleARN: "arn:aws:iam::111111111111:role/admin"},
+		{SourceARN: "lambda.amazonaws.com", RoleARN: "arn:aws:iam::111111111111:role/admin"},
+		{SourceARN: PublicPrincipalARN, RoleARN: "arn:aws:iam::111111111111:role/open"},
+		// admin's identity policy allows it to assume any role
+		{SourceARN: "arn:aws:iam::111111111111:role/admin", RoleARN: "arn:aws:iam::111111111111:role/open"},
+		{SourceARN: "arn:aws:iam::111111111111:user/alice", RoleARN: "arn:aws:iam::111111111111:role/open"},
+		{SourceARN: "arn:aws:iam::111111111111:user/bob", RoleARN: "arn:aws:iam::111111111111:role/open"},
+		{SourceARN: "lambda.amazonaws.com", RoleARN: "arn:aws:iam::111111111111:role/open"},
+	}
+	for _, a := range expectedAssumptions {
+		if !assumptions[a] {
+			t.Errorf("expected assumption %+v", a)
+		}
+	}
+	if len(update.Assumptions) != len(expectedAssumptions) {
+		t.Errorf("expected %d assumptions, got %+v", len(expectedAssumptions), update.Assumptions)
+	}
+
+	levels := make(map[string]models.PermissionLevel)
+	for _, e := range update.AccessEdges {
+		if e.TargetAssetID == private.ID {
+			levels[e.SourceARN] = e.PermissionLevel
+		}
+	}
+	if levels["arn:aws:iam::111111111111:user/alice"] != models.PermissionRead {
+		t.Errorf("expected alice to read private through her group, got %q", levels["arn:aws:iam::111111111111:user/alice"])
+	}
+	if levels["arn:aws:iam::111111111111:role/admin"] != models.PermissionFull {
+		t.Errorf("expected admin to have full access to private, got %q", levels["arn:aws:iam::111111111111:role/admin"])
+	}
+	if _, ok := levels["arn:aws:iam::111111111111:user/bob"]; ok {
+		t.Error("expected no access edge for bob")
+	}
+
+	if len(update.PublicAccess) != 1 || update.PublicAccess[0].AssetID != website.ID {
+		t.Fatalf("expected public access to website only, got %+v", update.PublicAccess)
+	}
+	expectedPublic := []string{"s3:GetObject", "s3:ListBucket", "s3:ListBucketVersions"}
+	got := update.PublicAccess[0].Permissions
+	if len(got) != len(expectedPublic) {
+		t.Fatalf("expected public permissions %v, got %v", expectedPublic, got)
+	}
+	for i := range expectedPublic {
+		if got[i] != expectedPublic[i] {
+			t.Errorf("expected public permissions %v, got %v", expectedPublic, got)
+		}
+	}
+}
@@ -0,0 +1,611 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// ObservedAccess is a data event: a principal performing an action on a
+// resource
+type ObservedAccess struct {
+	PrincipalARN string    `json:"principal_arn"`
+	Action       string    `json:"action"`
+	ResourceARN  string    `json:"resource_arn"`
+	Time         time.Time `json:"time"`
+}
+
+// AccessLogSource reads the data events logged for a resource
+type AccessLogSource interface {
+	ObservedAccess(ctx context.Context, resourceARN string, since time.Time) ([]ObservedAccess, error)
+}
+
+// CloudTrailSource reads data events from CloudTrail
+type CloudTrailSource struct {
+	Connector connectors.CloudTrailConnector
+}
+
+func (s *CloudTrailSource) ObservedAccess(ctx context.Context, resourceARN string, since time.Time) ([]ObservedAccess, error) {
+	var events []connectors.CloudTrailEvent
+	var err error
+	if bucket, ok := strings.CutPrefix(resourceARN, "arn:aws:s3:::"); ok {
+		events, err = s.Connector.GetS3DataAccessEvents(ctx, bucket, since)
+	} else {
+		events, err = s.Connector.GetEventsByResource(ctx, resourceARN, since)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading CloudTrail events for %s: %w", resourceARN, err)
+	}
+	return ObservedAccessFromCloudTrail(events, resourceARN), nil
+}
+
+// eventActions maps CloudTrail events to the IAM action authorizing them,
+// where the two differ
+var eventActions = map[string]string{
+	"s3:HeadObject":         "s3:GetObject",
+	"s3:CopyObject":         "s3:PutObject",
+	"s3:ListObjects":        "s3:ListBucket",
+	"s3:ListObjectsV2":      "s3:ListBucket",
+	"s3:HeadBucket":         "s3:ListBucket",
+	"s3:ListObjectVersions": "s3:ListBucketVersions",
+	"s3:DeleteObjects":      "s3:DeleteObject",
+}
+
+// cloudTrailRecord is the part of a CloudTrail record naming the caller
+type cloudTrailRecord struct {
+	EventSource  string `json:"eventSource"`
+	EventName    string `json:"eventName"`
+	UserIdentity struct {
+		Type           string `json:"type"`
+		ARN            string `json:"arn"`
+		SessionContext struct {
+			SessionIssuer struct {
+				ARN string `json:"arn"`
+			} `json:"sessionIssuer"`
+		} `json:"sessionContext"`
+	} `json:"userIdentity"`
+}
+
+// ObservedAccessFromCloudTrail converts CloudTrail events on a resource to
+// data events. Assumed-role sessions are attributed to their role. Events
+// by AWS services and anonymous callers name no IAM principal and are left
+// out.
+func ObservedAccessFromCloudTrail(events []connectors.CloudTrailEvent, resourceARN string) []ObservedAccess {
+	var observed []ObservedAccess
+	for _, event := range events {
+		var record cloudTrailRecord
+		if err := json.Unmarshal([]byte(event.CloudTrailJSON), &record); err != nil {
+			continue
+		}
+
+		var principal string
+		switch record.UserIdentity.Type {
+		case "AssumedRole":
+			principal = record.UserIdentity.SessionContext.SessionIssuer.ARN
+		case "IAMUser", "Root":
+			principal = record.UserIdentity.ARN
+		}
+		if principal == "" {
+			continue
+		}
+
+		source, name := event.EventSource, event.EventName
+		if source == "" {
+			source = record.EventSource
+		}
+		if name == "" {
+			name = record.EventName
+		}
+		service, _, _ := strings.Cut(source, ".")
+		if service == "" || name == "" {
+			continue
+		}
+		action := service + ":" + name
+		if mapped, ok := eventActions[action]; ok {
+			action = mapped
+		}
+
+		observed = append(observed, ObservedAccess{
+			PrincipalARN: principal,
+			Action:       action,
+			ResourceARN:  resourceARN,
+			Time:         event.EventTime,
+		})
+	}
+	return observed
+}
+
+// Recommendation is the data access a principal holds on a sensitive asset
+// but did not use over the lookback window
+type Recommendation struct {
+	PrincipalARN  string                 `json:"principal_arn"`
+	PrincipalType string                 `json:"principal_type"`
+	Asset         *models.DataAsset      `json:"-"`
+	ResourceARN   string                 `json:"resource_arn"`
+	Sensitivity   models.Sensitivity     `json:"sensitivity"`
+	Granted       []string               `json:"granted"`
+	Used          []string               `json:"used"`
+	Unused        []string               `json:"unused"`
+	CurrentLevel  models.PermissionLevel `json:"current_level"`
+	// RecommendedLevel is the level of the actions used, empty when none was
+	RecommendedLevel models.PermissionLevel `json:"recommended_level,omitempty"`
+	// PolicyARNs are the principal's policies with a proposed change
+	PolicyARNs []string `json:"policy_arns,omitempty"`
+}
+
+// PolicyChange is a minimized replacement for a policy granting unused
+// access to sensitive assets
+type PolicyChange struct {
+	PolicyARN  string `json:"policy_arn"`
+	PolicyName string `json:"policy_name"`
+	PolicyType string `json:"policy_type"` // MANAGED or INLINE
+	// PrincipalARN holds an inline policy
+	PrincipalARN     string        `json:"principal_arn,omitempty"`
+	CurrentDocument  string        `json:"current_document"`
+	ProposedDocument string        `json:"proposed_document"`
+	Diff             string        `json:"diff"`
+	Restrictions     []Restriction `json:"restrictions"`
+}
+
+// Restriction is the access a policy change removes from one asset
+type Restriction struct {
+	ResourceARN string   `json:"resource_arn"`
+	Actions     []string `json:"actions"`
+}
+
+// LeastPrivilegeReport is the unused access found in an account and the
+// policy changes removing it
+type LeastPrivilegeReport struct {
+	Recommendations []Recommendation
+	Changes         []PolicyChange
+}
+
+// heldPolicy is a policy and the principals it is in effect for
+type heldPolicy struct {
+	arn       string
+	name      string
+	inline    bool
+	principal string
+	doc       *connectors.PolicyDocument
+	holders   []*Identity
+}
+
+// RecommendLeastPrivilege compares the effective access of an account's
+// principals to its CRITICAL and HIGH sensitivity assets with the access
+// observed, keyed by resource ARN. Assets without observed events are
+// skipped, as their data events are likely not logged.
+//
+// An action is removed from a policy only when no principal holding the
+// policy used it. Allow statements scoped to the asset are narrowed; for
+// broader statements a deny on the asset is added. AWS managed policies
+// cannot be edited and get no change.
+func RecommendLeastPrivilege(scan *AccountAccess, observed map[string][]ObservedAccess) (*LeastPrivilegeReport, error) {
+	auth := scan.Authorization
+	if auth == nil {
+		auth = &connectors.AuthorizationDetails{}
+	}
+	principals := ResolvePrincipals(scan.AccountID, auth)
+	policies := heldPolicies(auth, principals)
+
+	report := &LeastPrivilegeReport{}
+	// removals[policy][resource] are the actions to take out of a policy
+	removals := make(map[string]map[string]map[string]bool)
+
+	for _, assetAccess := range scan.Assets {
+		asset := assetAccess.Asset
+		if asset.SensitivityLevel != models.SensitivityCritical && asset.SensitivityLevel != models.SensitivityHigh {
+			continue
+		}
+		events, ok := observed[asset.ResourceARN]
+		if !ok || len(events) == 0 {
+			continue
+		}
+		used := make(map[string]map[string]bool)
+		for _, event := range events {
+			if used[event.PrincipalARN] == nil {
+				used[event.PrincipalARN] = make(map[string]bool)
+			}
+			used[event.PrincipalARN][strings.ToLower(event.Action)] = true
+		}
+
+		resource := &Resource{ARN: asset.ResourceARN, AccountID: scan.AccountID, Policy: assetAccess.Policy}
+		for _, p := range principals {
+			access := EvaluateAccess(p.Identity, resource)
+			if access == nil {
+				continue
+			}
+			granted := append(append([]string(nil), access.Actions...), access.ConditionalActions...)
+			granted = catalogueOrder(asset.ResourceARN, granted)
+
+			rec := Recommendation{
+				PrincipalARN:  p.Identity.ARN,
+				PrincipalType: p.Identity.Type,
+				Asset:         asset,
+				ResourceARN:   asset.ResourceARN,
+				Sensitivity:   asset.SensitivityLevel,
+				Granted:       granted,
+				CurrentLevel:  access.PermissionLevel,
+			}
+			for _, action := range granted {
+				if used[p.Identity.ARN][strings.ToLower(action)] {
+					rec.Used = append(rec.Used, action)
+				} else {
+					rec.Unused = append(rec.Unused, action)
+				}
+			}
+			if len(rec.Unused) == 0 {
+				continue
+			}
+			rec.RecommendedLevel = permissionLevel(asset.ResourceARN, rec.Used)
+
+			for _, arn := range p.PolicyARNs {
+				policy := policies[arn]
+				if policy == nil || isAWSManaged(arn) {
+					continue
+				}
+				removable := policy.removable(asset.ResourceARN, scan.AccountID, rec.Unused, used)
+				if len(removable) == 0 {
+					continue
+				}
+				rec.PolicyARNs = append(rec.PolicyARNs, arn)
+				if removals[arn] == nil {
+					removals[arn] = make(map[string]map[string]bool)
+				}
+				if removals[arn][asset.ResourceARN] == nil {
+					removals[arn][asset.ResourceARN] = make(map[string]bool)
+				}
+				for _, action := range removable {
+					removals[arn][asset.ResourceARN][action] = true
+				}
+			}
+			report.Recommendations = append(report.Recommendations, rec)
+		}
+	}
+
+	for _, arn := range sortedKeys(removals) {
+		change, err := policies[arn].minimize(removals[arn])
+		if err != nil {
+			return nil, fmt.Errorf("minimizing policy %s: %w", arn, err)
+		}
+		report.Changes = append(report.Changes, *change)
+	}
+	return report, nil
+}
+
+// heldPolicies indexes the managed and inline policies in effect for the
+// principals by ARN
+func heldPolicies(auth *connectors.AuthorizationDetails, principals []PrincipalPolicies) map[string]*heldPolicy {
+	policies := make(map[string]*heldPolicy)
+	for _, policy := range auth.Policies {
+		if policy.Document != nil {
+			name := policy.Name
+			if name == "" {
+				name = policy.ARN[strings.LastIndex(policy.ARN, "/")+1:]
+			}
+			policies[policy.ARN] = &heldPolicy{arn: policy.ARN, name: name, doc: policy.Document}
+		}
+	}
+	details := make([]connectors.PrincipalDetails, 0, len(auth.Users)+len(auth.Groups)+len(auth.Roles))
+	details = append(append(append(details, auth.Users...), auth.Groups...), auth.Roles...)
+	for _, p := range details {
+		for name, doc := range p.InlinePolicies {
+			arn := inlinePolicyARN(p.ARN, name)
+			policies[arn] = &heldPolicy{arn: arn, name: name, inline: true, principal: p.ARN, doc: doc}
+		}
+	}
+	for _, p := range principals {
+		for _, arn := range p.PolicyARNs {
+			if policy := policies[arn]; policy != nil {
+				policy.holders = append(policy.holders, p.Identity)
+			}
+		}
+	}
+	return policies
+}
+
+// isAWSManaged reports whether a policy is managed by AWS
+func isAWSManaged(policyARN string) bool {
+	return strings.HasPrefix(policyARN, "arn:aws:iam::aws:policy/")
+}
+
+// removable returns the unused actions the policy grants on a resource that
+// none of its holders used
+func (p *heldPolicy) removable(resourceARN, accountID string, unused []string, used map[string]map[string]bool) []string {
+	granted := statementGrants(p.holders[0], accountID, p.doc.Statements, resourceARN, unused)
+	var removable []string
+	for _, action := range unused {
+		if !granted[action] {
+			continue
+		}
+		usedByHolder := false
+		for _, holder := range p.holders {
+			if used[holder.ARN][strings.ToLower(action)] {
+				usedByHolder = true
+				break
+			}
+		}
+		if !usedByHolder {
+			removable = append(removable, action)
+		}
+	}
+	return removable
+}
+
+// statementGrants returns the actions among candidates that the statements
+// allow on a resource by themselves, evaluated for a holder of them
+func statementGrants(holder *Identity, accountID string, statements []connectors.PolicyStatement, resourceARN string, candidates []string) map[string]bool {
+	id := &Identity{
+		ARN:       holder.ARN,
+		AccountID: holder.AccountID,
+		Type:      holder.Type,
+		Tags:      holder.Tags,
+		Policies:  []*connectors.PolicyDocument{{Statements: statements}},
+	}
+	resource := &Resource{ARN: resourceARN, AccountID: accountID}
+	granted := make(map[string]bool)
+	for _, action := range candidates {
+		da, ok := dataAction(resourceARN, action)
+		if !ok {
+			continue
+		}
+		switch Evaluate(id, resource, dataRequest(resourceARN, da)).Decision {
+		case DecisionAllow, DecisionConditional:
+			granted[action] = true
+		}
+	}
+	return granted
+}
+
+// minimize writes the policy without the actions removed from each
+// resource
+func (p *heldPolicy) minimize(removed map[string]map[string]bool) (*PolicyChange, error) {
+	resources := sortedKeys(removed)
+	holder := p.holders[0]
+
+	proposed := &connectors.PolicyDocument{Version: p.doc.Version}
+	// denies[resource] are actions granted by statements too broad to narrow
+	denies := make(map[string]map[string]bool)
+
+	for _, stmt := range p.doc.Statements {
+		if stmt.Effect != "Allow" || len(stmt.NotActions) > 0 || len(stmt.NotResources) > 0 {
+			proposed.Statements = append(proposed.Statements, stmt)
+			continue
+		}
+
+		affected := make(map[string][]string)
+		for _, resource := range resources {
+			actions := sortedKeys(removed[resource])
+			granted := statementGrants(holder, holder.AccountID, []connectors.PolicyStatement{stmt}, resource, actions)
+			for _, action := range actions {
+				if granted[action] {
+					affected[resource] = append(affected[resource], action)
+				}
+			}
+		}
+		if len(affected) == 0 {
+			proposed.Statements = append(proposed.Statements, stmt)
+			continue
+		}
+
+		if resource := scopedTo(stmt, resources); resource != "" && len(affected) == 1 && affected[resource] != nil {
+			if narrowed := narrow(stmt, resource, removed[resource]); len(narrowed.Actions) > 0 {
+				proposed.Statements = append(proposed.Statements, narrowed)
+			}
+			continue
+		}
+
+		proposed.Statements = append(proposed.Statements, stmt)
+		for resource, actions := range affected {
+			if denies[resource] == nil {
+				denies[resource] = make(map[string]bool)
+			}
+			for _, action := range actions {
+				denies[resource][action] = true
+			}
+		}
+	}
+
+	for i, resource := range sortedKeys(denies) {
+		targets := []string{resource}
+		if strings.HasPrefix(resource, "arn:aws:s3:::") {
+			targets = append(targets, strings.TrimSuffix(resource, "/")+"/*")
+		}
+		proposed.Statements = append(proposed.Statements, connectors.PolicyStatement{
+			SID:       fmt.Sprintf("DenyUnusedDataAccess%d", i+1),
+			Effect:    "Deny",
+			Actions:   catalogueOrder(resource, sortedKeys(denies[resource])),
+			Resources: targets,
+		})
+	}
+
+	current, err := connectors.FormatPolicyDocument(p.doc)
+	if err != nil {
+		return nil, err
+	}
+	next, err := connectors.FormatPolicyDocument(proposed)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &PolicyChange{
+		PolicyARN:        p.arn,
+		PolicyName:       p.name,
+		PolicyType:       "MANAGED",
+		CurrentDocument:  current,
+		ProposedDocument: next,
+		Diff:             diffLines(current, next),
+	}
+	if p.inline {
+		change.PolicyType = "INLINE"
+		change.PrincipalARN = p.principal
+	}
+	for _, resource := range resources {
+		change.Restrictions = append(change.Restrictions, Restriction{
+			ResourceARN: resource,
+			Actions:     catalogueOrder(resource, sortedKeys(removed[resource])),
+		})
+	}
+	return change, nil
+}
+
+// scopedTo returns the resource a statement's Resource element is confined
+// to: the resource itself or paths under it. It returns "" for statements
+// reaching beyond one of the resources.
+func scopedTo(stmt connectors.PolicyStatement, resources []string) string {
+	if len(stmt.Resources) == 0 {
+		return ""
+	}
+	for _, resource := range resources {
+		prefix := strings.TrimSuffix(resource, "/") + "/"
+		scoped := true
+		for _, pattern := range stmt.Resources {
+			if pattern != resource && (!strings.HasPrefix(pattern, prefix) || len(pattern) == len(prefix)) {
+				scoped = false
+				break
+			}
+		}
+		if scoped {
+			return resource
+		}
+	}
+	return ""
+}
+
+// narrow drops removed actions from a statement scoped to a resource.
+// Wildcards covering a removed action are replaced with the data actions
+// they cover that remain.
+func narrow(stmt connectors.PolicyStatement, resource string, removed map[string]bool) connectors.PolicyStatement {
+	isRemoved := func(action string) bool {
+		for r := range removed {
+			if strings.EqualFold(r, action) {
+				return true
+			}
+		}
+		return false
+	}
+
+	seen := make(map[string]bool)
+	var actions []string
+	keep := func(action string) {
+		if !seen[strings.ToLower(action)] {
+			seen[strings.ToLower(action)] = true
+			actions = append(actions, action)
+		}
+	}
+	for _, pattern := range stmt.Actions {
+		if !strings.ContainsAny(pattern, "*?") {
+			if !isRemoved(pattern) {
+				keep(pattern)
+			}
+			continue
+		}
+		g := newGlob(strings.ToLower(pattern))
+		covers := false
+		for r := range removed {
+			if g.match(strings.ToLower(r)) {
+				covers = true
+				break
+			}
+		}
+		if !covers {
+			keep(pattern)
+			continue
+		}
+		for _, da := range DataActionsFor(resource) {
+			if g.match(strings.ToLower(da.Action)) && !isRemoved(da.Action) {
+				keep(da.Action)
+			}
+		}
+	}
+
+	stmt.Actions = actions
+	return stmt
+}
+
+// dataAction looks up a data action on a resource by name
+func dataAction(resourceARN, action string) (DataAction, bool) {
+	for _, da := range DataActionsFor(resourceARN) {
+		if strings.EqualFold(da.Action, action) {
+			return da, true
+		}
+	}
+	return DataAction{}, false
+}
+
+// catalogueOrder sorts data actions in the order dataActions lists them
+func catalogueOrder(resourceARN string, actions []string) []string {
+	rank := make(map[string]int)
+	for i, da := range DataActionsFor(resourceARN) {
+		rank[strings.ToLower(da.Action)] = i
+	}
+	sorted := append([]string(nil), actions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank[strings.ToLower(sorted[i])] < rank[strings.ToLower(sorted[j])]
+	})
+	return sorted
+}
+
+// permissionLevel is the highest level among data actions on a resource,
+// or empty when there are none
+func permissionLevel(resourceARN string, actions []string) models.PermissionLevel {
+	levels := make(map[models.PermissionLevel]bool)
+	for _, action := range actions {
+		if da, ok := dataAction(resourceARN, action); ok {
+			levels[da.Level] = true
+		}
+	}
+	switch {
+	case levels[models.PermissionAdmin]:
+		return models.PermissionAdmin
+	case levels[models.PermissionWrite]:
+		return models.PermissionWrite
+	case levels[models.PermissionRead]:
+		return models.PermissionRead
+	}
+	return ""
+}
+
+// diffLines compares two texts line by line. Lines only in a are prefixed
+// "- ", lines only in b "+ " and common lines "  ".
+func diffLines(a, b string) string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// lcs[i][j] is the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out.WriteString("  " + x[i] + "\n")
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + x[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + y[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,173 @@
+package access
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+func TestObservedAccessFromCloudTrail(t *testing.T) {
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := []connectors.CloudTrailEvent{
+		{
+			EventName:   "GetObject",
+			EventSource: "s3.amazonaws.com",
+			EventTime:   at,
+			CloudTrailJSON: `{"userIdentity": {"type": "AssumedRole",
+				"arn": "arn:aws:sts::111111111111:assumed-role/app/session",
+				"sessionContext": {"sessionIssuer": {"type": "Role", "arn": "arn:aws:iam::111111111111:role/app"}}}}`,
+		},
+		{
+			EventTime: at,
+			CloudTrailJSON: `{"eventSource": "s3.amazonaws.com", "eventName": "HeadObject",
+				"userIdentity": {"type": "IAMUser", "arn": "arn:aws:iam::111111111111:user/alice"}}`,
+		},
+		{
+			EventName:      "GetObject",
+			EventSource:    "s3.amazonaws.com",
+			CloudTrailJSON: `{"userIdentity": {"type": "AWSService", "invokedBy": "s3.amazonaws.com"}}`,
+		},
+		{EventName: "PutObject", EventSource: "s3.amazonaws.com", CloudTrailJSON: `not json`},
+	}
+
+	got := ObservedAccessFromCloudTrail(events, "arn:aws:s3:::pii")
+	want := []ObservedAccess{
+		{PrincipalARN: "arn:aws:iam::111111111111:role/app", Action: "s3:GetObject", ResourceARN: "arn:aws:s3:::pii", Time: at},
+		{PrincipalARN: "arn:aws:iam::111111111111:user/alice", Action: "s3:GetObject", ResourceARN: "arn:aws:s3:::pii", Time: at},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestRecommendLeastPrivilege(t *testing.T) {
+	const account = "111111111111"
+	const shared = "arn:aws:iam::111111111111:policy/pii-access"
+	const alice = "arn:aws:iam::111111111111:user/alice"
+	const app = "arn:aws:iam::111111111111:role/app"
+	const etl = "arn:aws:iam::111111111111:role/etl"
+
+	auth := &connectors.AuthorizationDetails{
+		Users: []connectors.PrincipalDetails{
+			{
+				Principal: connectors.Principal{ARN: alice, Name: "alice", Type: "USER"},
+				InlinePolicies: map[string]*connectors.PolicyDocument{"reads": mustPolicy(t,
+					`{"Statement": {"Effect": "Allow", "Action": ["s3:GetObject", "s3:DeleteObject"], "Resource": "*"}}`)},
+			},
+		},
+		Roles: []connectors.PrincipalDetails{
+			{Principal: connectors.Principal{ARN: app, Name: "app", Type: "ROLE"}, AttachedPolicies: []string{shared}},
+			{Principal: connectors.Principal{ARN: etl, Name: "etl", Type: "ROLE"}, AttachedPolicies: []string{shared}},
+		},
+		Policies: []connectors.ManagedPolicy{
+			{PolicyInfo: connectors.PolicyInfo{ARN: shared}, Document: mustPolicy(t, `{"Version": "2012-10-17", "Statement": [
+				{"Sid": "Pii", "Effect": "Allow", "Action": ["s3:*", "s3:GetBucketTagging"],
+					"Resource": ["arn:aws:s3:::pii", "arn:aws:s3:::pii/*"]},
+				{"Effect": "Allow", "Action": "kms:Decrypt", "Resource": "*"}
+			]}`)},
+		},
+	}
+
+	pii := &models.DataAsset{ID: uuid.New(), ResourceARN: "arn:aws:s3:::pii", SensitivityLevel: models.SensitivityCritical}
+	hr := &models.DataAsset{ID: uuid.New(), ResourceARN: "arn:aws:s3:::hr", SensitivityLevel: models.SensitivityHigh}
+	logs := &models.DataAsset{ID: uuid.New(), ResourceARN: "arn:aws:s3:::logs", SensitivityLevel: models.SensitivityLow}
+
+	observed := map[string][]ObservedAccess{
+		pii.ResourceARN: {
+			{PrincipalARN: app, Action: "s3:GetObject"},
+			{PrincipalARN: etl, Action: "s3:PutObject"},
+			{PrincipalARN: alice, Action: "s3:GetObject"},
+		},
+		logs.ResourceARN: {{PrincipalARN: alice, Action: "s3:GetObject"}},
+	}
+
+	report, err := RecommendLeastPrivilege(&AccountAccess{
+		AccountID:     account,
+		Authorization: auth,
+		Assets:        []AssetAccess{{Asset: pii}, {Asset: hr}, {Asset: logs}},
+	}, observed)
+	if err != nil {
+		t.Fatalf("RecommendLeastPrivilege failed: %v", err)
+	}
+
+	type rec struct {
+		principal string
+		resource  string
+		used      []string
+		unused    int
+		level     models.PermissionLevel
+		policies  []string
+	}
+	var gotRecs []rec
+	for _, r := range report.Recommendations {
+		gotRecs = append(gotRecs, rec{r.PrincipalARN, r.ResourceARN, r.Used, len(r.Unused), r.RecommendedLevel, r.PolicyARNs})
+	}
+	wantRecs := []rec{
+		{alice, pii.ResourceARN, []string{"s3:GetObject"}, 1, models.PermissionRead, []string{inlinePolicyARN(alice, "reads")}},
+		{app, pii.ResourceARN, []string{"s3:GetObject"}, 14, models.PermissionRead, []string{shared}},
+		{etl, pii.ResourceARN, []string{"s3:PutObject"}, 14, models.PermissionWrite, []string{shared}},
+	}
+	if !reflect.DeepEqual(gotRecs, wantRecs) {
+		t.Errorf("expected recommendations %+v, got %+v", wantRecs, gotRecs)
+	}
+
+	if len(report.Changes) != 2 {
+		t.Fatalf("expected 2 policy changes, got %d", len(report.Changes))
+	}
+
+	inline := report.Changes[1]
+	if inline.PolicyType != "INLINE" || inline.PrincipalARN != alice || inline.PolicyName != "reads" {
+		t.Errorf("expected alice's inline policy second, got %+v", inline)
+	}
+	proposed, err := connectors.ParsePolicyDocument(inline.ProposedDocument)
+	if err != nil {
+		t.Fatalf("parsing proposed document: %v", err)
+	}
+	// The statement grants on every resource, so it stays and a deny is added
+	wantStatements := []connectors.PolicyStatement{
+		{Effect: "Allow", Actions: []string{"s3:GetObject", "s3:DeleteObject"}, Resources: []string{"*"}},
+		{SID: "DenyUnusedDataAccess1", Effect: "Deny", Actions: []string{"s3:DeleteObject"},
+			Resources: []string{"arn:aws:s3:::pii", "arn:aws:s3:::pii/*"}},
+	}
+	if !reflect.DeepEqual(proposed.Statements, wantStatements) {
+		t.Errorf("expected statements %+v, got %+v", wantStatements, proposed.Statements)
+	}
+
+	managed := report.Changes[0]
+	if managed.PolicyARN != shared || managed.PolicyType != "MANAGED" || managed.PolicyName != "pii-access" {
+		t.Errorf("expected the shared managed policy, got %+v", managed)
+	}
+	proposed, err = connectors.ParsePolicyDocument(managed.ProposedDocument)
+	if err != nil {
+		t.Fatalf("parsing proposed document: %v", err)
+	}
+	// Neither holder's use is removed, and non-data actions stay
+	wantStatements = []connectors.PolicyStatement{
+		{SID: "Pii", Effect: "Allow", Actions: []string{"s3:GetObject", "s3:PutObject", "s3:GetBucketTagging"},
+			Resources: []string{"arn:aws:s3:::pii", "arn:aws:s3:::pii/*"}},
+		{Effect: "Allow", Actions: []string{"kms:Decrypt"}, Resources: []string{"*"}},
+	}
+	if !reflect.DeepEqual(proposed.Statements, wantStatements) {
+		t.Errorf("expected statements %+v, got %+v", wantStatements, proposed.Statements)
+	}
+	if len(managed.Restrictions) != 1 || len(managed.Restrictions[0].Actions) != 13 {
+		t.Errorf("expected 13 actions restricted on pii, got %+v", managed.Restrictions)
+	}
+	if !strings.Contains(managed.Diff, `-         "s3:*",`) || !strings.Contains(managed.Diff, `+         "s3:PutObject",`) {
+		t.Errorf("expected the diff to replace s3:*, got\n%s", managed.Diff)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	got := diffLines("a\nb\nc", "a\nc\nd")
+	want := "  a\n- b\n  c\n+ d\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
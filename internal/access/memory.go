@@ -0,0 +1,1421 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+// MemoryGraph is a GraphStore held in process as adjacency lists, for
+// deployments without Neo4j. Nodes and relationships mirror the Neo4j
+// graph; paths are found by breadth-first search bounded by hop count.
+// With a Persister the graph is loaded on open and saved by Flush, Close
+// and Apply. Several processes may share a persister: reads, Apply and
+// Import first reload a snapshot another process saved, and a save that
+// would overwrite one fails with ErrStaleSnapshot.
+type MemoryGraph struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode
+	out   map[string][]*memEdge
+	in    map[string][]*memEdge
+	byARN map[string][]string
+	// clock is a logical clock: it advances on every read and write, so
+	// stamps order writes without relying on wall time
+	clock int64
+	// saved is the clock of the snapshot last loaded or saved
+	saved int64
+	// dirty marks changes made since then
+	dirty     bool
+	persister Persister
+	// saveMu serializes saves, so each replaces the snapshot the last one wrote
+	saveMu sync.Mutex
+}
+
+type memNode struct {
+	Key   string                 `json:"key"`
+	Label string                 `json:"label"`
+	Props map[string]interface{} `json:"props"`
+}
+
+type memEdge struct {
+	Type  string                 `json:"type"`
+	From  string                 `json:"from"`
+	To    string                 `json:"to"`
+	Props map[string]interface{} `json:"props,omitempty"`
+}
+
+type memSnapshot struct {
+	Clock int64      `json:"clock"`
+	Nodes []*memNode `json:"nodes"`
+	Edges []*memEdge `json:"edges"`
+}
+
+// flowTypes are the relationships followed by lineage queries
+var flowTypes = []string{"READS_FROM", "WRITES_TO", "EXPORTS_TO", "REPLICATES_TO"}
+
+// NewMemoryGraph opens an in-memory graph, loading the last snapshot saved
+// by persister. A nil persister keeps the graph in memory only.
+func NewMemoryGraph(ctx context.Context, persister Persister) (*MemoryGraph, error) {
+	g := &MemoryGraph{persister: persister}
+	g.reset()
+	if persister == nil {
+		return g, nil
+	}
+
+	data, err := persister.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading graph: %w", err)
+	}
+	if data == nil {
+		return g, nil
+	}
+	if err := g.load(data); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *MemoryGraph) reset() {
+	g.nodes = make(map[string]*memNode)
+	g.out = make(map[string][]*memEdge)
+	g.in = make(map[string][]*memEdge)
+	g.byARN = make(map[string][]string)
+	g.clock = 0
+	g.saved = 0
+	g.dirty = false
+}
+
+// load replaces the graph with a saved snapshot
+func (g *MemoryGraph) load(data []byte) error {
+	var snapshot memSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("parsing graph snapshot: %w", err)
+	}
+	g.reset()
+	g.clock = snapshot.Clock
+	g.saved = snapshot.Clock
+	for _, n := range snapshot.Nodes {
+		if n.Props == nil {
+			n.Props = make(map[string]interface{})
+		}
+		g.nodes[n.Key] = n
+		if arn, ok := n.Props["arn"].(string); ok {
+			g.byARN[arn] = append(g.byARN[arn], n.Key)
+		}
+	}
+	for _, e := range snapshot.Edges {
+		if g.nodes[e.From] == nil || g.nodes[e.To] == nil {
+			continue
+		}
+		if e.Props == nil {
+			e.Props = make(map[string]interface{})
+		}
+		g.out[e.From] = append(g.out[e.From], e)
+		g.in[e.To] = append(g.in[e.To], e)
+	}
+	return nil
+}
+
+// reload replaces the graph with the stored snapshot if another process
+// saved one since this graph last loaded or saved. Unsaved changes are
+// dropped, since they could no longer be saved.
+func (g *MemoryGraph) reload(ctx context.Context) error {
+	return g.sync(ctx, false)
+}
+
+// refresh reloads the graph ahead of a read, so queries see what other
+// processes saved. Unsaved changes are kept: they belong to a write still
+// in progress, whose save reports the conflict.
+func (g *MemoryGraph) refresh(ctx context.Context) error {
+	return g.sync(ctx, true)
+}
+
+func (g *MemoryGraph) sync(ctx context.Context, keepUnsaved bool) error {
+	if g.persister == nil {
+		return nil
+	}
+	g.saveMu.Lock()
+	defer g.saveMu.Unlock()
+
+	// The stored clock is checked first, so an unchanged graph is not reread
+	clock, err := g.persister.Clock(ctx)
+	if err != nil {
+		return fmt.Errorf("loading graph: %w", err)
+	}
+	g.mu.RLock()
+	current := clock == g.saved || (keepUnsaved && g.dirty)
+	g.mu.RUnlock()
+	if current {
+		return nil
+	}
+
+	data, err := g.persister.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("loading graph: %w", err)
+	}
+	if data == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if keepUnsaved && g.dirty {
+		return nil
+	}
+	return g.load(data)
+}
+
+// Flush saves the graph through its persister if it has unsaved changes.
+// If another process saved the graph since it was loaded, nothing is saved
+// and the error wraps ErrStaleSnapshot; the next Apply or Import reloads
+// the stored graph, dropping the changes.
+func (g *MemoryGraph) Flush(ctx context.Context) error {
+	if g.persister == nil {
+		return nil
+	}
+	g.saveMu.Lock()
+	defer g.saveMu.Unlock()
+
+	g.mu.Lock()
+	if !g.dirty {
+		g.mu.Unlock()
+		return nil
+	}
+	// Every save advances the clock, so no two saves share a clock
+	snapshot := memSnapshot{Clock: g.tick()}
+	for _, key := range g.sortedNodeKeys("") {
+		snapshot.Nodes = append(snapshot.Nodes, g.nodes[key])
+		snapshot.Edges = append(snapshot.Edges, g.out[key]...)
+	}
+	base := g.saved
+	data, err := json.Marshal(snapshot)
+	g.dirty = false
+	g.mu.Unlock()
+
+	if err == nil {
+		err = g.persister.Save(ctx, data, base)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err != nil {
+		g.dirty = true
+		return fmt.Errorf("saving graph: %w", err)
+	}
+	g.saved = snapshot.Clock
+	return nil
+}
+
+func (g *MemoryGraph) Close(ctx context.Context) error {
+	return g.Flush(ctx)
+}
+
+func (g *MemoryGraph) Export(ctx context.Context, filter ExportFilter) (*GraphSnapshot, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	g.mu.RLock()
+	snapshot := &GraphSnapshot{Directed: true}
+	for _, key := range g.sortedNodeKeys("") {
+		n := g.nodes[key]
+		snapshot.Nodes = append(snapshot.Nodes, SnapshotNode{ID: n.Key, Label: n.Label, Properties: copyProps(n.Props)})
+		for _, e := range g.out[key] {
+			snapshot.Links = append(snapshot.Links, SnapshotLink{
+				Source:     e.From,
+				Target:     e.To,
+				Type:       e.Type,
+				Properties: copyProps(e.Props),
+			})
+		}
+	}
+	g.mu.RUnlock()
+
+	snapshot = filterSnapshot(snapshot, filter)
+	sortSnapshot(snapshot)
+	return snapshot, nil
+}
+
+// Import merges a snapshot into the graph. The clock advances past the
+// snapshot's stamps, so imported entries are not newer than later writes.
+func (g *MemoryGraph) Import(ctx context.Context, snapshot *GraphSnapshot) error {
+	if err := snapshot.validate(); err != nil {
+		return err
+	}
+	if err := g.reload(ctx); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	nodes := make(map[string]*memNode, len(snapshot.Nodes))
+	for _, sn := range snapshot.Nodes {
+		n := g.mergeNode(sn.Label, strings.TrimPrefix(sn.ID, sn.Label+"|"))
+		g.set(n, copyProps(sn.Properties))
+		g.advanceClock(n.Props)
+		nodes[sn.ID] = n
+	}
+	for _, l := range snapshot.Links {
+		e := g.mergeEdge(l.Type, nodes[l.Source], nodes[l.Target])
+		for k, v := range l.Properties {
+			e.Props[k] = v
+		}
+		g.advanceClock(e.Props)
+	}
+	g.mu.Unlock()
+
+	return g.Flush(ctx)
+}
+
+// advanceClock moves the clock to a stamp read from elsewhere
+func (g *MemoryGraph) advanceClock(props map[string]interface{}) {
+	if stamp := propInt(props, "lastSeen"); stamp > g.clock {
+		g.clock = stamp
+	}
+}
+
+func copyProps(props map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		out[k] = v
+	}
+	return out
+}
+
+func nodeKey(label, id string) string {
+	return label + "|" + id
+}
+
+func (g *MemoryGraph) tick() int64 {
+	g.clock++
+	g.dirty = true
+	return g.clock
+}
+
+// mergeNode returns the node with a label and identity, creating it if needed
+func (g *MemoryGraph) mergeNode(label, id string) *memNode {
+	key := nodeKey(label, id)
+	if n, ok := g.nodes[key]; ok {
+		return n
+	}
+	n := &memNode{Key: key, Label: label, Props: make(map[string]interface{})}
+	g.nodes[key] = n
+	g.dirty = true
+	return n
+}
+
+// set updates a node's properties, keeping the ARN index current
+func (g *MemoryGraph) set(n *memNode, props map[string]interface{}) {
+	if arn, ok := props["arn"].(string); ok {
+		if old, _ := n.Props["arn"].(string); old != arn {
+			g.unindex(n)
+			g.byARN[arn] = append(g.byARN[arn], n.Key)
+		}
+	}
+	for k, v := range props {
+		n.Props[k] = v
+	}
+	g.dirty = true
+}
+
+func (g *MemoryGraph) unindex(n *memNode) {
+	arn, ok := n.Props["arn"].(string)
+	if !ok {
+		return
+	}
+	keys := g.byARN[arn]
+	for i, key := range keys {
+		if key == n.Key {
+			g.byARN[arn] = append(keys[:i:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(g.byARN[arn]) == 0 {
+		delete(g.byARN, arn)
+	}
+}
+
+// match returns the node with a label and identity, if any
+func (g *MemoryGraph) match(label, id string) *memNode {
+	return g.nodes[nodeKey(label, id)]
+}
+
+// mergeEdge returns the relationship of a type between two nodes, creating
+// it if needed
+func (g *MemoryGraph) mergeEdge(typ string, from, to *memNode) *memEdge {
+	for _, e := range g.out[from.Key] {
+		if e.Type == typ && e.To == to.Key {
+			return e
+		}
+	}
+	e := &memEdge{Type: typ, From: from.Key, To: to.Key, Props: make(map[string]interface{})}
+	g.out[from.Key] = append(g.out[from.Key], e)
+	g.in[to.Key] = append(g.in[to.Key], e)
+	g.dirty = true
+	return e
+}
+
+func (g *MemoryGraph) hasEdge(typ string, from, to *memNode) bool {
+	for _, e := range g.out[from.Key] {
+		if e.Type == typ && e.To == to.Key {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *MemoryGraph) removeEdge(e *memEdge) {
+	g.out[e.From] = without(g.out[e.From], e)
+	g.in[e.To] = without(g.in[e.To], e)
+	g.dirty = true
+}
+
+// removeNode deletes a node with its relationships
+func (g *MemoryGraph) removeNode(n *memNode) {
+	for _, e := range append(append([]*memEdge(nil), g.out[n.Key]...), g.in[n.Key]...) {
+		g.removeEdge(e)
+	}
+	g.unindex(n)
+	delete(g.out, n.Key)
+	delete(g.in, n.Key)
+	delete(g.nodes, n.Key)
+	g.dirty = true
+}
+
+func without(edges []*memEdge, e *memEdge) []*memEdge {
+	for i, other := range edges {
+		if other == e {
+			return append(edges[:i:i], edges[i+1:]...)
+		}
+	}
+	return edges
+}
+
+// sortedNodeKeys returns the keys of nodes with a label, or of all nodes,
+// in a stable order
+func (g *MemoryGraph) sortedNodeKeys(label string) []string {
+	var keys []string
+	for key, n := range g.nodes {
+		if label == "" || n.Label == label {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// belongTo links a node to its account, if the account is in the graph
+func (g *MemoryGraph) belongTo(n *memNode, accountID string) {
+	if acc := g.match("CloudAccount", accountID); acc != nil {
+		g.mergeEdge("BELONGS_TO", n, acc)
+	}
+}
+
+func (g *MemoryGraph) UpsertAccount(ctx context.Context, account *models.CloudAccount) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.mergeNode("CloudAccount", account.ID.String())
+	g.set(n, map[string]interface{}{
+		"id":          account.ID.String(),
+		"provider":    string(account.Provider),
+		"externalId":  account.ExternalID,
+		"displayName": account.DisplayName,
+		"status":      account.Status,
+	})
+	return nil
+}
+
+func (g *MemoryGraph) UpsertAsset(ctx context.Context, asset *models.DataAsset) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.mergeNode("DataAsset", asset.ID.String())
+	g.set(n, map[string]interface{}{
+		"id":               asset.ID.String(),
+		"arn":              asset.ResourceARN,
+		"resourceType":     string(asset.ResourceType),
+		"name":             asset.Name,
+		"region":           asset.Region,
+		"sensitivityLevel": string(asset.SensitivityLevel),
+		"encryptionStatus": string(asset.EncryptionStatus),
+		"publicAccess":     asset.PublicAccess,
+		"accountId":        asset.AccountID.String(),
+	})
+	g.belongTo(n, asset.AccountID.String())
+	return nil
+}
+
+func (g *MemoryGraph) UpsertPrincipal(ctx context.Context, accountID uuid.UUID, principal *Principal) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.mergeNode("Principal", principal.ARN)
+	g.set(n, map[string]interface{}{
+		"id":        principal.ID.String(),
+		"arn":       principal.ARN,
+		"name":      principal.Name,
+		"type":      principal.Type,
+		"accountId": accountID.String(),
+		"lastSeen":  g.tick(),
+	})
+	g.belongTo(n, accountID.String())
+	return nil
+}
+
+func (g *MemoryGraph) UpsertPolicy(ctx context.Context, policy *models.AccessPolicy) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.mergeNode("Policy", policy.PolicyARN)
+	g.set(n, map[string]interface{}{
+		"id":                 policy.ID.String(),
+		"arn":                policy.PolicyARN,
+		"name":               policy.PolicyName,
+		"policyType":         policy.PolicyType,
+		"allowsPublicAccess": policy.AllowsPublicAccess,
+		"lastSeen":           g.tick(),
+	})
+	return nil
+}
+
+func (g *MemoryGraph) CreateAccessEdge(ctx context.Context, edge *models.AccessEdge) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.match("Principal", edge.SourceARN)
+	a := g.match("DataAsset", edge.TargetAssetID.String())
+	if p == nil || a == nil {
+		return nil
+	}
+	e := g.mergeEdge("CAN_ACCESS", p, a)
+	e.Props["id"] = edge.ID.String()
+	e.Props["permissions"] = edge.Permissions
+	e.Props["permissionLevel"] = string(edge.PermissionLevel)
+	e.Props["isDirect"] = edge.IsDirect
+	e.Props["isPublic"] = edge.IsPublic
+	e.Props["isCrossAccount"] = edge.IsCrossAccount
+	e.Props["lastSeen"] = g.tick()
+	return nil
+}
+
+// publicPrincipal returns the node standing for everyone
+func (g *MemoryGraph) publicPrincipal() *memNode {
+	n := g.mergeNode("Principal", PublicPrincipalARN)
+	if len(n.Props) == 0 {
+		g.set(n, map[string]interface{}{"arn": PublicPrincipalARN, "type": "PUBLIC"})
+	}
+	return n
+}
+
+func (g *MemoryGraph) CreatePublicAccess(ctx context.Context, assetID uuid.UUID, permissions []string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.publicPrincipal()
+	a := g.match("DataAsset", assetID.String())
+	if a == nil {
+		return nil
+	}
+	e := g.mergeEdge("CAN_ACCESS", p, a)
+	e.Props["isPublic"] = true
+	e.Props["permissions"] = permissions
+	e.Props["lastSeen"] = g.tick()
+	return nil
+}
+
+// relate stamps a relationship between two existing nodes, the target
+// restricted to a principal type if one is given
+func (g *MemoryGraph) relate(typ string, from *memNode, to *memNode, toType string) {
+	if from == nil || to == nil {
+		return
+	}
+	if toType != "" && propString(to.Props, "type") != toType {
+		return
+	}
+	g.mergeEdge(typ, from, to).Props["lastSeen"] = g.tick()
+}
+
+func (g *MemoryGraph) CreateRoleAssumption(ctx context.Context, sourceARN, targetRoleARN string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.relate("CAN_ASSUME", g.match("Principal", sourceARN), g.match("Principal", targetRoleARN), "ROLE")
+	return nil
+}
+
+func (g *MemoryGraph) CreatePublicRoleAssumption(ctx context.Context, roleARN string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.relate("CAN_ASSUME", g.publicPrincipal(), g.match("Principal", roleARN), "ROLE")
+	return nil
+}
+
+func (g *MemoryGraph) CreatePolicyAttachment(ctx context.Context, policyARN, principalARN string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.relate("ATTACHED_TO", g.match("Policy", policyARN), g.match("Principal", principalARN), "")
+	return nil
+}
+
+func (g *MemoryGraph) CreatePermissionsBoundary(ctx context.Context, policyARN, principalARN string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.relate("BOUNDS", g.match("Policy", policyARN), g.match("Principal", principalARN), "")
+	return nil
+}
+
+func (g *MemoryGraph) AddGroupMembership(ctx context.Context, memberARN, groupARN string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.relate("MEMBER_OF", g.match("Principal", memberARN), g.match("Principal", groupARN), "GROUP")
+	return nil
+}
+
+func (g *MemoryGraph) AddClassification(ctx context.Context, assetID uuid.UUID, category models.Category, sensitivity models.Sensitivity, count int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c := g.mergeNode("Classification", string(category)+"|"+string(sensitivity))
+	g.set(c, map[string]interface{}{
+		"category":    string(category),
+		"sensitivity": string(sensitivity),
+	})
+	a := g.match("DataAsset", assetID.String())
+	if a == nil {
+		return nil
+	}
+	e := g.mergeEdge("CONTAINS_DATA", a, c)
+	e.Props["count"] = count
+	e.Props["lastSeen"] = g.tick()
+	return nil
+}
+
+func (g *MemoryGraph) Timestamp(ctx context.Context) (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.tick(), nil
+}
+
+func (g *MemoryGraph) RemoveStaleAccess(ctx context.Context, accountID uuid.UUID, since int64) (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	account := accountID.String()
+	stale := func(props map[string]interface{}) bool {
+		return propInt(props, "lastSeen") < since
+	}
+
+	var removed int64
+	for _, key := range g.sortedNodeKeys("DataAsset") {
+		if propString(g.nodes[key].Props, "accountId") != account {
+			continue
+		}
+		for _, e := range append([]*memEdge(nil), g.in[key]...) {
+			if e.Type == "CAN_ACCESS" && stale(e.Props) {
+				g.removeEdge(e)
+				removed++
+			}
+		}
+		for _, e := range append([]*memEdge(nil), g.out[key]...) {
+			if e.Type == "CONTAINS_DATA" && stale(e.Props) {
+				g.removeEdge(e)
+				removed++
+			}
+		}
+	}
+
+	principals := g.sortedNodeKeys("Principal")
+	for _, key := range principals {
+		if propString(g.nodes[key].Props, "accountId") != account {
+			continue
+		}
+		for _, e := range append(append([]*memEdge(nil), g.out[key]...), g.in[key]...) {
+			switch e.Type {
+			case "CAN_ASSUME", "MEMBER_OF", "ATTACHED_TO", "BOUNDS":
+			default:
+				continue
+			}
+			if stale(e.Props) {
+				g.removeEdge(e)
+				removed++
+			}
+		}
+	}
+
+	for _, key := range principals {
+		n := g.nodes[key]
+		if propString(n.Props, "accountId") != account || !stale(n.Props) {
+			continue
+		}
+		if t := propString(n.Props, "type"); t == "PUBLIC" || t == PrincipalTypeService || t == PrincipalTypeExternalAccount {
+			continue
+		}
+		g.removeNode(n)
+		removed++
+	}
+
+	for _, key := range g.sortedNodeKeys("Policy") {
+		n := g.nodes[key]
+		if stale(n.Props) && len(g.out[key]) == 0 {
+			g.removeNode(n)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// Apply writes an account's access graph from an access scan, removes what
+// earlier scans wrote that this one did not, and saves the graph
+func (g *MemoryGraph) Apply(ctx context.Context, account *models.CloudAccount, update *GraphUpdate) (int64, error) {
+	if err := g.reload(ctx); err != nil {
+		return 0, err
+	}
+	removed, err := applyUpdate(ctx, g, account, update)
+	if err != nil {
+		return removed, err
+	}
+	return removed, g.Flush(ctx)
+}
+
+// inAccount reports whether a node passes an optional account filter
+func inAccount(n *memNode, accountID *uuid.UUID) bool {
+	return accountID == nil || propString(n.Props, "accountId") == accountID.String()
+}
+
+func isSensitive(level string) bool {
+	return level == string(models.SensitivityCritical) || level == string(models.SensitivityHigh)
+}
+
+// memPath is a path found by search, as node keys and the relationships
+// between them
+type memPath struct {
+	nodes []string
+	edges []*memEdge
+}
+
+func (p memPath) visits(key string) bool {
+	for _, k := range p.nodes {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (p memPath) extend(e *memEdge, key string) memPath {
+	return memPath{
+		nodes: append(append([]string(nil), p.nodes...), key),
+		edges: append(append([]*memEdge(nil), p.edges...), e),
+	}
+}
+
+// paths searches breadth first from start for paths of 1 to maxHops
+// relationships of the given types, not revisiting nodes. Relationships
+// are followed backwards if reverse is set. visit is called with each path
+// in order of length and stops the search by returning false.
+func (g *MemoryGraph) paths(start string, types []string, maxHops int, reverse bool, visit func(memPath) bool) {
+	follow := make(map[string]bool, len(types))
+	for _, t := range types {
+		follow[t] = true
+	}
+
+	frontier := []memPath{{nodes: []string{start}}}
+	for hop := 1; hop <= maxHops && len(frontier) > 0; hop++ {
+		var next []memPath
+		for _, path := range frontier {
+			last := path.nodes[len(path.nodes)-1]
+			edges, end := g.out[last], func(e *memEdge) string { return e.To }
+			if reverse {
+				edges, end = g.in[last], func(e *memEdge) string { return e.From }
+			}
+			for _, e := range edges {
+				if !follow[e.Type] || path.visits(end(e)) {
+					continue
+				}
+				extended := path.extend(e, end(e))
+				if !visit(extended) {
+					return
+				}
+				next = append(next, extended)
+			}
+		}
+		frontier = next
+	}
+}
+
+func (g *MemoryGraph) FindPublicAccessPaths(ctx context.Context, accountID *uuid.UUID, maxHops int) ([]PathResult, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var results []PathResult
+	for _, key := range g.sortedNodeKeys("Principal") {
+		source := g.nodes[key]
+		if propString(source.Props, "type") != "PUBLIC" {
+			continue
+		}
+		g.paths(key, []string{"CAN_ACCESS", "CAN_ASSUME"}, maxHops, false, func(p memPath) bool {
+			target := g.nodes[p.nodes[len(p.nodes)-1]]
+			if target.Label != "DataAsset" || !isSensitive(propString(target.Props, "sensitivityLevel")) || !inAccount(target, accountID) {
+				return true
+			}
+			result := PathResult{
+				Source:   propString(source.Props, "arn"),
+				Target:   propString(target.Props, "arn"),
+				IsPublic: true,
+				HopCount: len(p.edges),
+			}
+			for _, k := range p.nodes {
+				n := g.nodes[k]
+				if name := propString(n.Props, "arn"); name != "" {
+					result.Path = append(result.Path, name)
+				} else if name := propString(n.Props, "name"); name != "" {
+					result.Path = append(result.Path, name)
+				}
+			}
+			results = append(results, result)
+			return true
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].HopCount < results[j].HopCount })
+	if len(results) > 100 {
+		results = results[:100]
+	}
+	return results, nil
+}
+
+// accessRecords lists CAN_ACCESS relationships from principals to data
+// assets that pass an optional account filter
+func (g *MemoryGraph) accessRecords(accountID *uuid.UUID, visit func(p, a *memNode, e *memEdge)) {
+	for _, key := range g.sortedNodeKeys("Principal") {
+		p := g.nodes[key]
+		for _, e := range g.out[key] {
+			a := g.nodes[e.To]
+			if e.Type != "CAN_ACCESS" || a.Label != "DataAsset" || !inAccount(a, accountID) {
+				continue
+			}
+			visit(p, a, e)
+		}
+	}
+}
+
+func (g *MemoryGraph) FindAccessToPII(ctx context.Context, accountID *uuid.UUID) ([]AccessRecord, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var records []AccessRecord
+	g.accessRecords(accountID, func(p, a *memNode, r *memEdge) {
+		for _, e := range g.out[a.Key] {
+			c := g.nodes[e.To]
+			if e.Type != "CONTAINS_DATA" || c.Label != "Classification" || propString(c.Props, "category") != string(models.CategoryPII) {
+				continue
+			}
+			records = append(records, AccessRecord{
+				PrincipalARN:  propString(p.Props, "arn"),
+				PrincipalType: propString(p.Props, "type"),
+				AssetARN:      propString(a.Props, "arn"),
+				AssetName:     propString(a.Props, "name"),
+				Permissions:   propStrings(r.Props, "permissions"),
+				Sensitivity:   propString(c.Props, "sensitivity"),
+			})
+		}
+	})
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Sensitivity > records[j].Sensitivity })
+	return records, nil
+}
+
+func (g *MemoryGraph) FindOverprivilegedAccess(ctx context.Context, accountID *uuid.UUID) ([]AccessRecord, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var records []AccessRecord
+	g.accessRecords(accountID, func(p, a *memNode, r *memEdge) {
+		level := propString(r.Props, "permissionLevel")
+		if (level != string(models.PermissionAdmin) && level != string(models.PermissionFull)) ||
+			!isSensitive(propString(a.Props, "sensitivityLevel")) {
+			return
+		}
+		records = append(records, AccessRecord{
+			PrincipalARN:    propString(p.Props, "arn"),
+			PrincipalType:   propString(p.Props, "type"),
+			AssetARN:        propString(a.Props, "arn"),
+			AssetName:       propString(a.Props, "name"),
+			PermissionLevel: level,
+			Sensitivity:     propString(a.Props, "sensitivityLevel"),
+		})
+	})
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Sensitivity != records[j].Sensitivity {
+			return records[i].Sensitivity > records[j].Sensitivity
+		}
+		return records[i].PermissionLevel > records[j].PermissionLevel
+	})
+	return records, nil
+}
+
+func (g *MemoryGraph) FindCrossAccountAccess(ctx context.Context, accountID uuid.UUID) ([]AccessRecord, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	acc := g.match("CloudAccount", accountID.String())
+	if acc == nil {
+		return nil, nil
+	}
+
+	var records []AccessRecord
+	for _, belongs := range g.in[acc.Key] {
+		a := g.nodes[belongs.From]
+		if belongs.Type != "BELONGS_TO" || a.Label != "DataAsset" {
+			continue
+		}
+		for _, r := range g.in[a.Key] {
+			p := g.nodes[r.From]
+			if r.Type != "CAN_ACCESS" || p.Label != "Principal" {
+				continue
+			}
+			if !propBool(r.Props, "isCrossAccount") && g.hasEdge("BELONGS_TO", p, acc) {
+				continue
+			}
+			records = append(records, AccessRecord{
+				PrincipalARN:  propString(p.Props, "arn"),
+				PrincipalType: propString(p.Props, "type"),
+				AssetARN:      propString(a.Props, "arn"),
+				AssetName:     propString(a.Props, "name"),
+				Permissions:   propStrings(r.Props, "permissions"),
+				Sensitivity:   propString(a.Props, "sensitivityLevel"),
+				CrossAccount:  true,
+			})
+		}
+	}
+
+	var trusted []ReachableAccess
+	for _, key := range g.sortedNodeKeys("Principal") {
+		p := g.nodes[key]
+		if t := propString(p.Props, "type"); t != PrincipalTypeIdentityProvider && t != PrincipalTypeExternalAccount {
+			continue
+		}
+		if !g.hasEdge("BELONGS_TO", p, acc) {
+			continue
+		}
+		for assetKey, r := range g.reach(key, crossAccountHops) {
+			if a := g.nodes[assetKey]; g.hasEdge("BELONGS_TO", a, acc) {
+				trusted = append(trusted, g.reachable(p, a, r))
+			}
+		}
+	}
+	sortReachable(trusted)
+	for _, r := range trusted {
+		records = append(records, trustedAccessRecord(r))
+	}
+	return records, nil
+}
+
+func (g *MemoryGraph) GetAccessStats(ctx context.Context, accountID *uuid.UUID) (*AccessStats, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	stats := &AccessStats{PrincipalsByType: make(map[string]int)}
+	for _, key := range g.sortedNodeKeys("Principal") {
+		if p := g.nodes[key]; inAccount(p, accountID) {
+			stats.PrincipalsByType[propString(p.Props, "type")]++
+		}
+	}
+
+	g.accessRecords(accountID, func(p, a *memNode, r *memEdge) {
+		if propString(p.Props, "type") == "PUBLIC" {
+			stats.PublicAccessCount++
+		}
+	})
+
+	// As in Neo4j, cross-account and overprivileged counts cover all accounts
+	for _, edges := range g.out {
+		for _, r := range edges {
+			if r.Type != "CAN_ACCESS" {
+				continue
+			}
+			if propBool(r.Props, "isCrossAccount") {
+				stats.CrossAccountCount++
+			}
+			level := propString(r.Props, "permissionLevel")
+			a := g.nodes[r.To]
+			if a.Label == "DataAsset" && (level == string(models.PermissionAdmin) || level == string(models.PermissionFull)) &&
+				isSensitive(propString(a.Props, "sensitivityLevel")) {
+				stats.OverprivilegedCount++
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// memReach is how a principal reaches an asset: the shortest path and the
+// CAN_ACCESS relationships held by every principal reached
+type memReach struct {
+	path   []string
+	grants []*memEdge
+}
+
+// arnPath returns the ARNs of a path's nodes
+func (g *MemoryGraph) arnPath(keys []string) []string {
+	arns := make([]string, len(keys))
+	for i, k := range keys {
+		arns[i] = propString(g.nodes[k].Props, "arn")
+	}
+	return arns
+}
+
+// shorterPath orders paths as the Neo4j query does: by length, then by the
+// accessor's ARN, then by the ARNs along the path
+func shorterPath(a, b []string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	if a[len(a)-2] != b[len(b)-2] {
+		return a[len(a)-2] < b[len(b)-2]
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// reach returns the assets a principal reaches over up to maxHops MEMBER_OF
+// and CAN_ASSUME relationships, by node key
+func (g *MemoryGraph) reach(start string, maxHops int) map[string]*memReach {
+	// accessors holds the principals reached with the best path to each
+	accessors := map[string][]string{start: {start}}
+	g.paths(start, []string{"MEMBER_OF", "CAN_ASSUME"}, maxHops, false, func(p memPath) bool {
+		last := p.nodes[len(p.nodes)-1]
+		if g.nodes[last].Label != "Principal" {
+			return true
+		}
+		if best, ok := accessors[last]; !ok || len(p.nodes) < len(best) ||
+			(len(p.nodes) == len(best) && strings.Join(g.arnPath(p.nodes), "\x00") < strings.Join(g.arnPath(best), "\x00")) {
+			accessors[last] = p.nodes
+		}
+		return true
+	})
+
+	reached := make(map[string]*memReach)
+	for key, nodes := range accessors {
+		for _, e := range g.out[key] {
+			if e.Type != "CAN_ACCESS" || g.nodes[e.To].Label != "DataAsset" {
+				continue
+			}
+			r := reached[e.To]
+			if r == nil {
+				r = &memReach{}
+				reached[e.To] = r
+			}
+			r.grants = append(r.grants, e)
+			path := g.arnPath(append(append([]string(nil), nodes...), e.To))
+			if r.path == nil || shorterPath(path, r.path) {
+				r.path = path
+			}
+		}
+	}
+	return reached
+}
+
+// reachable builds the result for a principal reaching an asset
+func (g *MemoryGraph) reachable(p, a *memNode, r *memReach) ReachableAccess {
+	result := ReachableAccess{
+		PrincipalARN:  propString(p.Props, "arn"),
+		PrincipalType: propString(p.Props, "type"),
+		AssetID:       propString(a.Props, "id"),
+		AssetARN:      propString(a.Props, "arn"),
+		AssetName:     propString(a.Props, "name"),
+		Sensitivity:   propString(a.Props, "sensitivityLevel"),
+		Path:          r.path,
+		HopCount:      len(r.path) - 2,
+	}
+
+	permissions := make(map[string]bool)
+	var levels []string
+	for _, e := range r.grants {
+		for _, perm := range propStrings(e.Props, "permissions") {
+			permissions[perm] = true
+		}
+		levels = append(levels, propString(e.Props, "permissionLevel"))
+	}
+	result.Permissions = sortedKeys(permissions)
+	result.PermissionLevel = highestLevel(levels)
+
+	categories := make(map[string]bool)
+	for _, e := range g.out[a.Key] {
+		if e.Type != "CONTAINS_DATA" {
+			continue
+		}
+		categories[propString(g.nodes[e.To].Props, "category")] = true
+		result.RecordCount += int(propInt(e.Props, "count"))
+	}
+	if len(categories) > 0 {
+		result.Categories = sortedKeys(categories)
+	}
+	return result
+}
+
+func (g *MemoryGraph) FindBlastRadius(ctx context.Context, principalARN string, maxHops int) ([]ReachableAccess, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var results []ReachableAccess
+	for _, key := range g.byARN[principalARN] {
+		p := g.nodes[key]
+		if p.Label != "Principal" {
+			continue
+		}
+		for assetKey, r := range g.reach(key, maxHops) {
+			results = append(results, g.reachable(p, g.nodes[assetKey], r))
+		}
+	}
+
+	sortReachable(results)
+	return results, nil
+}
+
+func (g *MemoryGraph) FindPrincipalsReaching(ctx context.Context, assetARN string, maxHops int) ([]ReachableAccess, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var results []ReachableAccess
+	for _, assetKey := range g.byARN[assetARN] {
+		a := g.nodes[assetKey]
+		if a.Label != "DataAsset" {
+			continue
+		}
+		for _, key := range g.sortedNodeKeys("Principal") {
+			if r := g.reach(key, maxHops)[assetKey]; r != nil {
+				results = append(results, g.reachable(g.nodes[key], a, r))
+			}
+		}
+	}
+
+	sortReachable(results)
+	return results, nil
+}
+
+func (g *MemoryGraph) UpsertFunction(ctx context.Context, accountID uuid.UUID, fn *FunctionNode) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.mergeNode("Function", fn.ARN)
+	g.set(n, map[string]interface{}{
+		"id":            fn.ID.String(),
+		"arn":           fn.ARN,
+		"name":          fn.Name,
+		"runtime":       fn.Runtime,
+		"executionRole": fn.ExecutionRole,
+		"accountId":     accountID.String(),
+	})
+	g.belongTo(n, accountID.String())
+	return nil
+}
+
+// resources returns the nodes with an ARN, whatever their label, creating
+// a DataResource if there are none
+func (g *MemoryGraph) resources(arn, resourceType string) []*memNode {
+	var nodes []*memNode
+	for _, key := range g.byARN[arn] {
+		nodes = append(nodes, g.nodes[key])
+	}
+	if len(nodes) > 0 {
+		return nodes
+	}
+	n := g.mergeNode("DataResource", arn)
+	g.set(n, map[string]interface{}{"arn": arn, "resourceType": resourceType})
+	return []*memNode{n}
+}
+
+func (g *MemoryGraph) CreateLineageEdge(ctx context.Context, edge *LineageEdge) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	relType := "DATA_FLOW"
+	for _, t := range flowTypes {
+		if edge.FlowType == t {
+			relType = t
+		}
+	}
+
+	sources := g.resources(edge.SourceARN, edge.SourceType)
+	targets := g.resources(edge.TargetARN, edge.TargetType)
+	for _, source := range sources {
+		for _, target := range targets {
+			e := g.mergeEdge(relType, source, target)
+			e.Props["id"] = edge.ID.String()
+			e.Props["flowType"] = edge.FlowType
+			e.Props["accessMethod"] = edge.AccessMethod
+			e.Props["inferredFrom"] = edge.InferredFrom
+			e.Props["confidenceScore"] = edge.ConfidenceScore
+		}
+	}
+	return nil
+}
+
+func (g *MemoryGraph) FindDataFlowPaths(ctx context.Context, sourceARN string, maxHops int) ([]LineagePathResult, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if maxHops <= 0 {
+		maxHops = 5
+	}
+
+	var results []LineagePathResult
+	for _, start := range g.byARN[sourceARN] {
+		g.paths(start, flowTypes, maxHops, false, func(p memPath) bool {
+			result := LineagePathResult{
+				OriginARN:      sourceARN,
+				DestinationARN: propString(g.nodes[p.nodes[len(p.nodes)-1]].Props, "arn"),
+				HopCount:       len(p.edges),
+			}
+			for _, k := range p.nodes {
+				if arn := propString(g.nodes[k].Props, "arn"); arn != "" {
+					result.Path = append(result.Path, arn)
+				}
+			}
+			for _, e := range p.edges {
+				result.FlowTypes = append(result.FlowTypes, e.Type)
+			}
+			results = append(results, result)
+			return len(results) < 100
+		})
+		if len(results) >= 100 {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (g *MemoryGraph) FindSensitiveDataFlows(ctx context.Context, accountID *uuid.UUID) ([]LineagePathResult, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var results []LineagePathResult
+	for _, key := range g.sortedNodeKeys("DataAsset") {
+		source := g.nodes[key]
+		if !isSensitive(propString(source.Props, "sensitivityLevel")) || !inAccount(source, accountID) {
+			continue
+		}
+		for _, e := range g.out[key] {
+			if !isFlow(e.Type) {
+				continue
+			}
+			results = append(results, LineagePathResult{
+				OriginARN:      propString(source.Props, "arn"),
+				DestinationARN: propString(g.nodes[e.To].Props, "arn"),
+				Sensitive:      true,
+				HopCount:       1,
+			})
+			if len(results) == 100 {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+func isFlow(relType string) bool {
+	for _, t := range flowTypes {
+		if relType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *MemoryGraph) GetLineageForAsset(ctx context.Context, assetARN string) (*LineageGraph, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	graph := &LineageGraph{
+		Nodes: []LineageNode{},
+		Edges: []LineageGraphEdge{},
+	}
+
+	nodeSet := make(map[string]bool)
+	edgeSet := make(map[*memEdge]bool)
+	for _, target := range g.byARN[assetARN] {
+		// Upstream paths of up to 3 hops, searched back from the asset
+		g.paths(target, flowTypes, 3, true, func(p memPath) bool {
+			for _, k := range p.nodes {
+				n := g.nodes[k]
+				arn := propString(n.Props, "arn")
+				if arn == "" || nodeSet[arn] {
+					continue
+				}
+				nodeSet[arn] = true
+				graph.Nodes = append(graph.Nodes, LineageNode{
+					ARN:  arn,
+					Name: fmt.Sprintf("%v", n.Props["name"]),
+					Type: fmt.Sprintf("%v", n.Props["resourceType"]),
+				})
+			}
+			for _, e := range p.edges {
+				if edgeSet[e] {
+					continue
+				}
+				edgeSet[e] = true
+				graph.Edges = append(graph.Edges, LineageGraphEdge{
+					Source:   propString(g.nodes[e.From].Props, "arn"),
+					Target:   propString(g.nodes[e.To].Props, "arn"),
+					FlowType: e.Type,
+				})
+			}
+			return true
+		})
+	}
+	return graph, nil
+}
+
+func (g *MemoryGraph) UpsertAIModel(ctx context.Context, accountID uuid.UUID, modelARN, modelName, modelType string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := g.mergeNode("AIModel", modelARN)
+	g.set(n, map[string]interface{}{
+		"arn":       modelARN,
+		"name":      modelName,
+		"modelType": modelType,
+		"accountId": accountID.String(),
+	})
+	g.belongTo(n, accountID.String())
+	return nil
+}
+
+func (g *MemoryGraph) CreateTrainingDataEdge(ctx context.Context, modelARN, dataSourceARN string, sensitivityLevel string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	m := g.match("AIModel", modelARN)
+	if m == nil {
+		return nil
+	}
+	d := g.mergeNode("DataSource", dataSourceARN)
+	g.set(d, map[string]interface{}{"arn": dataSourceARN})
+	g.mergeEdge("TRAINED_ON", m, d).Props["sensitivityLevel"] = sensitivityLevel
+	return nil
+}
+
+func (g *MemoryGraph) FindAIModelsAccessingSensitiveData(ctx context.Context, accountID *uuid.UUID) ([]AIModelAccessRecord, error) {
+	if err := g.refresh(ctx); err != nil {
+		return nil, err
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var records []AIModelAccessRecord
+	for _, key := range g.sortedNodeKeys("AIModel") {
+		m := g.nodes[key]
+		if !inAccount(m, accountID) {
+			continue
+		}
+		for _, e := range g.out[key] {
+			level := propString(e.Props, "sensitivityLevel")
+			if e.Type != "TRAINED_ON" || !isSensitive(level) {
+				continue
+			}
+			records = append(records, AIModelAccessRecord{
+				ModelARN:         propString(m.Props, "arn"),
+				ModelName:        propString(m.Props, "name"),
+				ModelType:        propString(m.Props, "modelType"),
+				DataSourceARN:    propString(g.nodes[e.To].Props, "arn"),
+				SensitivityLevel: level,
+			})
+		}
+	}
+	return records, nil
+}
+
+// Property values read back from a snapshot are JSON types, so accessors
+// accept both the written and the decoded forms
+
+func propString(props map[string]interface{}, key string) string {
+	s, _ := props[key].(string)
+	return s
+}
+
+func propBool(props map[string]interface{}, key string) bool {
+	b, _ := props[key].(bool)
+	return b
+}
+
+func propInt(props map[string]interface{}, key string) int64 {
+	switch v := props[key].(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+func propStrings(props map[string]interface{}, key string) []string {
+	switch v := props[key].(type) {
+	case []string:
+		if len(v) == 0 {
+			return nil
+		}
+		return append([]string(nil), v...)
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
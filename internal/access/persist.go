@@ -0,0 +1,147 @@
+package access
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrStaleSnapshot is returned when saving a graph that another process
+// saved after this one loaded it
+var ErrStaleSnapshot = errors.New("graph snapshot was saved by another process")
+
+// Persister stores snapshots of a MemoryGraph
+type Persister interface {
+	// Load returns the last snapshot saved, or nil if there is none
+	Load(ctx context.Context) ([]byte, error)
+	// Clock returns the clock of the stored snapshot, or 0 if there is none
+	Clock(ctx context.Context) (int64, error)
+	// Save replaces the stored snapshot with data if the stored one is still
+	// at clock base (0 for none), and returns ErrStaleSnapshot otherwise
+	Save(ctx context.Context, data []byte, base int64) error
+}
+
+// snapshotClock reads the clock a saved snapshot was taken at
+func snapshotClock(data []byte) (int64, error) {
+	var snapshot struct {
+		Clock int64 `json:"clock"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return 0, fmt.Errorf("parsing graph snapshot: %w", err)
+	}
+	return snapshot.Clock, nil
+}
+
+// FilePersister keeps the snapshot in a local file
+type FilePersister struct {
+	Path string
+}
+
+func (p *FilePersister) Load(ctx context.Context) ([]byte, error) {
+	data, err := os.ReadFile(p.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (p *FilePersister) Clock(ctx context.Context) (int64, error) {
+	data, err := p.Load(ctx)
+	if err != nil || data == nil {
+		return 0, err
+	}
+	return snapshotClock(data)
+}
+
+// Save writes the snapshot to a temporary file and renames it into place,
+// so a crash never leaves a truncated graph behind. The stored clock is
+// checked before the rename but not atomically with it, so processes that
+// write the graph concurrently should persist it to Postgres instead.
+func (p *FilePersister) Save(ctx context.Context, data []byte, base int64) error {
+	clock, err := p.Clock(ctx)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	if clock != base {
+		return ErrStaleSnapshot
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.Path), filepath.Base(p.Path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return os.Rename(tmp.Name(), p.Path)
+}
+
+// PostgresPersister keeps the snapshot in the graph_snapshots table
+type PostgresPersister struct {
+	db   *sqlx.DB
+	name string
+}
+
+// NewPostgresPersister stores snapshots under name, so several graphs can
+// share the table
+func NewPostgresPersister(db *sqlx.DB, name string) *PostgresPersister {
+	return &PostgresPersister{db: db, name: name}
+}
+
+func (p *PostgresPersister) Load(ctx context.Context) ([]byte, error) {
+	var data []byte
+	err := p.db.GetContext(ctx, &data, `SELECT data FROM graph_snapshots WHERE name = $1`, p.name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading graph snapshot: %w", err)
+	}
+	return data, nil
+}
+
+func (p *PostgresPersister) Clock(ctx context.Context) (int64, error) {
+	var clock int64
+	err := p.db.GetContext(ctx, &clock, `SELECT COALESCE((data->>'clock')::bigint, 0) FROM graph_snapshots WHERE name = $1`, p.name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("loading graph snapshot clock: %w", err)
+	}
+	return clock, nil
+}
+
+// Save compares the stored clock and replaces the snapshot in one statement
+func (p *PostgresPersister) Save(ctx context.Context, data []byte, base int64) error {
+	query := `
+		INSERT INTO graph_snapshots (name, data, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (name) DO UPDATE SET data = EXCLUDED.data, updated_at = NOW()
+		WHERE COALESCE((graph_snapshots.data->>'clock')::bigint, 0) = $3
+	`
+	result, err := p.db.ExecContext(ctx, query, p.name, string(data), base)
+	if err != nil {
+		return fmt.Errorf("saving graph snapshot: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrStaleSnapshot
+	}
+	return nil
+}
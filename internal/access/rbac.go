@@ -0,0 +1,340 @@
+package access
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// memberPublic is the member type of GCP's allUsers and
+// allAuthenticatedUsers, which the graph records as public access
+const memberPublic = "PUBLIC"
+
+// RoleAccess is the data access a member holds on an asset through Azure
+// role assignments or GCP IAM bindings
+type RoleAccess struct {
+	EffectiveAccess
+	AssetID uuid.UUID `json:"asset_id"`
+	// Conditions are those of the bindings granting ConditionalActions
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+// EvaluateRoleBindings expands role bindings into the data access each
+// member holds on each asset. A binding covers its scope and everything
+// below it: Azure scopes by resource ID prefix, from management groups down
+// to containers, and GCP scopes from the organization and folders through
+// the project to the bucket. Azure roles grant data actions only through
+// their DataActions, so an Owner reads blobs only by listing account keys.
+//
+// Actions granted by conditional bindings are conditional, unless a GCP
+// condition restricts resource names to other buckets. Azure conditions are
+// not evaluated.
+func EvaluateRoleBindings(bindings *connectors.RoleBindings, assets []*models.DataAsset) []RoleAccess {
+	roles := make(map[string]*connectors.RoleDefinition, len(bindings.Roles))
+	for i := range bindings.Roles {
+		roles[roleKey(bindings.Roles[i].ID)] = &bindings.Roles[i]
+	}
+	ancestors := make(map[string]bool, len(bindings.Ancestors))
+	for _, scope := range bindings.Ancestors {
+		ancestors[strings.ToLower(scope)] = true
+	}
+
+	type memberGrants struct {
+		memberType  string
+		allowed     map[string]bool
+		conditional map[string]bool
+		conditions  []string
+	}
+
+	var results []RoleAccess
+	for _, asset := range assets {
+		actions := DataActionsFor(asset.ResourceARN)
+		if len(actions) == 0 {
+			continue
+		}
+
+		grants := make(map[string]*memberGrants)
+		for _, b := range bindings.Bindings {
+			role := roles[roleKey(b.RoleID)]
+			if role == nil || !scopeCovers(ancestors, b.Scope, asset.ResourceARN) {
+				continue
+			}
+			conditional := b.Condition != ""
+			if conditional && conditionExcludes(b.Condition, asset.ResourceARN) {
+				continue
+			}
+
+			g := grants[b.Member]
+			if g == nil {
+				g = &memberGrants{
+					memberType:  b.MemberType,
+					allowed:     make(map[string]bool),
+					conditional: make(map[string]bool),
+				}
+				grants[b.Member] = g
+			}
+			granted := false
+			for _, action := range actions {
+				if !roleAllows(role, action) {
+					continue
+				}
+				granted = true
+				if !conditional {
+					g.allowed[action.Action] = true
+				} else if !g.allowed[action.Action] {
+					g.conditional[action.Action] = true
+				}
+			}
+			if granted && conditional && !containsString(g.conditions, b.Condition) {
+				g.conditions = append(g.conditions, b.Condition)
+			}
+		}
+
+		for _, member := range sortedKeys(grants) {
+			g := grants[member]
+			access := RoleAccess{
+				EffectiveAccess: EffectiveAccess{
+					PrincipalARN:  member,
+					PrincipalType: g.memberType,
+					ResourceARN:   asset.ResourceARN,
+					IsPublic:      g.memberType == memberPublic,
+				},
+				AssetID: asset.ID,
+			}
+			if access.IsPublic {
+				access.PrincipalType = PrincipalTypeAnonymous
+			}
+
+			levels := make(map[models.PermissionLevel]bool)
+			for _, action := range actions {
+				switch {
+				case g.allowed[action.Action]:
+					access.Actions = append(access.Actions, action.Action)
+					levels[action.Level] = true
+				case g.conditional[action.Action]:
+					access.ConditionalActions = append(access.ConditionalActions, action.Action)
+					levels[action.Level] = true
+				}
+			}
+			access.PermissionLevel = effectiveLevel(len(actions), len(access.Actions), levels)
+			if access.PermissionLevel == "" {
+				continue
+			}
+			if len(access.ConditionalActions) > 0 {
+				access.Conditions = g.conditions
+			}
+			results = append(results, access)
+		}
+	}
+	return results
+}
+
+// roleKey identifies a role. Azure role definition IDs vary with the scope
+// they are read at, so those are keyed by the definition's GUID.
+func roleKey(id string) string {
+	lower := strings.ToLower(id)
+	if i := strings.LastIndex(lower, "/roledefinitions/"); i >= 0 {
+		return lower[i+len("/roledefinitions/"):]
+	}
+	return id
+}
+
+// scopeCovers reports whether a grant at scope applies to a resource: the
+// scope is above the account, or is the resource or one of its parents
+func scopeCovers(ancestors map[string]bool, scope, resourceID string) bool {
+	scope = strings.ToLower(scope)
+	if ancestors[scope] {
+		return true
+	}
+	scope = strings.TrimSuffix(scope, "/")
+	resourceID = strings.ToLower(resourceID)
+	return resourceID == scope || strings.HasPrefix(resourceID, scope+"/")
+}
+
+// roleAllows reports whether a role permits an action. Azure data actions
+// are matched against the role's DataActions, everything else against its
+// Actions, with wildcards.
+func roleAllows(role *connectors.RoleDefinition, action DataAction) bool {
+	allow, deny := role.Actions, role.NotActions
+	if action.DataPlane {
+		allow, deny = role.DataActions, role.NotDataActions
+	}
+	return matchesAnyAction(allow, action.Action) && !matchesAnyAction(deny, action.Action)
+}
+
+func matchesAnyAction(patterns []string, action string) bool {
+	action = strings.ToLower(action)
+	for _, pattern := range patterns {
+		if newGlob(strings.ToLower(pattern)).match(action) {
+			return true
+		}
+	}
+	return false
+}
+
+// celResourceName matches a CEL test of resource.name against a literal,
+// by equality or prefix
+var celResourceName = regexp.MustCompile(`^\(*\s*resource\.name\s*(==|\.startsWith\()\s*"([^"]*)"\s*\)*$`)
+
+// conditionExcludes reports whether a GCP condition restricts its binding
+// to resources other than a bucket and its objects. Only disjunctions of
+// resource.name tests are recognized; any other condition may hold.
+func conditionExcludes(condition, resourceARN string) bool {
+	bucket, ok := strings.CutPrefix(resourceARN, "gs://")
+	if !ok {
+		return false
+	}
+	name := "projects/_/buckets/" + bucket
+	for _, term := range strings.Split(condition, "||") {
+		m := celResourceName.FindStringSubmatch(strings.TrimSpace(term))
+		if m == nil {
+			return false
+		}
+		literal := m[2]
+		if literal == name || strings.HasPrefix(literal, name+"/") {
+			return false
+		}
+		if m[1] != "==" && strings.HasPrefix(name, literal) {
+			return false
+		}
+	}
+	return true
+}
+
+// addRoleBindings adds the members of an account's role bindings, the roles
+// granted to them and their access to the scanned assets
+func addRoleBindings(accountID uuid.UUID, scan *AccountAccess, update *GraphUpdate) {
+	bindings := scan.RoleBindings
+	roles := make(map[string]*connectors.RoleDefinition, len(bindings.Roles))
+	for i := range bindings.Roles {
+		roles[roleKey(bindings.Roles[i].ID)] = &bindings.Roles[i]
+	}
+
+	seenPrincipals := make(map[string]bool)
+	seenPolicies := make(map[string]bool)
+	seenAttachments := make(map[PolicyAttachment]bool)
+	for _, b := range bindings.Bindings {
+		if b.MemberType == memberPublic {
+			continue
+		}
+		if !seenPrincipals[b.Member] {
+			seenPrincipals[b.Member] = true
+			update.Principals = append(update.Principals, Principal{
+				ID:   principalID(b.Member),
+				ARN:  b.Member,
+				Name: memberName(b.Member),
+				Type: b.MemberType,
+			})
+		}
+
+		role := roles[roleKey(b.RoleID)]
+		if role == nil {
+			continue
+		}
+		if !seenPolicies[role.ID] {
+			seenPolicies[role.ID] = true
+			update.Policies = append(update.Policies, models.AccessPolicy{
+				ID:         principalID(role.ID),
+				AccountID:  accountID,
+				PolicyARN:  role.ID,
+				PolicyName: role.Name,
+				PolicyType: "ROLE",
+				PolicyDocument: models.JSONB{
+					"actions":          role.Actions,
+					"not_actions":      role.NotActions,
+					"data_actions":     role.DataActions,
+					"not_data_actions": role.NotDataActions,
+				},
+			})
+		}
+		attachment := PolicyAttachment{PolicyARN: role.ID, PrincipalARN: b.Member}
+		if !seenAttachments[attachment] {
+			seenAttachments[attachment] = true
+			update.Attachments = append(update.Attachments, attachment)
+		}
+	}
+
+	assets := make([]*models.DataAsset, len(scan.Assets))
+	for i, assetAccess := range scan.Assets {
+		assets[i] = assetAccess.Asset
+	}
+	public := make(map[uuid.UUID]int)
+	for i, p := range update.PublicAccess {
+		public[p.AssetID] = i
+	}
+
+	for _, access := range EvaluateRoleBindings(bindings, assets) {
+		permissions := append(append([]string(nil), access.Actions...), access.ConditionalActions...)
+		if access.IsPublic {
+			i, ok := public[access.AssetID]
+			if !ok {
+				i = len(update.PublicAccess)
+				public[access.AssetID] = i
+				update.PublicAccess = append(update.PublicAccess, PublicAccess{AssetID: access.AssetID})
+			}
+			update.PublicAccess[i].Permissions = mergeStrings(update.PublicAccess[i].Permissions, permissions)
+			continue
+		}
+
+		edge := models.AccessEdge{
+			ID:              uuid.New(),
+			SourceType:      access.PrincipalType,
+			SourceARN:       access.PrincipalARN,
+			SourceName:      memberName(access.PrincipalARN),
+			TargetAssetID:   access.AssetID,
+			TargetARN:       access.ResourceARN,
+			PermissionLevel: access.PermissionLevel,
+			Permissions:     permissions,
+			GrantType:       "ROLE_BINDING",
+			IsDirect:        true,
+		}
+		if len(access.ConditionalActions) > 0 {
+			edge.Conditions = models.JSONB{
+				"conditional_actions": access.ConditionalActions,
+				"conditions":          access.Conditions,
+			}
+		}
+		update.AccessEdges = append(update.AccessEdges, edge)
+	}
+}
+
+// memberName strips the type prefix of a GCP member such as
+// "user:alice@example.com". Azure members are object IDs.
+func memberName(member string) string {
+	for _, prefix := range []string{"user:", "group:", "serviceAccount:", "domain:"} {
+		if name, ok := strings.CutPrefix(member, prefix); ok {
+			return name
+		}
+	}
+	return member
+}
+
+func mergeStrings(a, b []string) []string {
+	set := make(map[string]bool, len(a)+len(b))
+	for _, s := range a {
+		set[s] = true
+	}
+	for _, s := range b {
+		set[s] = true
+	}
+	merged := make([]string, 0, len(set))
+	for s := range set {
+		merged = append(merged, s)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package access
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+const (
+	azureSub       = "/subscriptions/sub-1"
+	azureAccount   = azureSub + "/resourceGroups/data/providers/Microsoft.Storage/storageAccounts/acct"
+	azureContainer = azureAccount + "/blobServices/default/containers/customers"
+	azureOther     = azureSub + "/resourceGroups/web/providers/Microsoft.Storage/storageAccounts/site/blobServices/default/containers/assets"
+	blobRead       = "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/read"
+	blobWrite      = "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/write"
+	listKeys       = "Microsoft.Storage/storageAccounts/listKeys/action"
+)
+
+// ownerActions are the catalogued control plane actions, which Owner's "*"
+// matches
+var ownerActions = []string{
+	listKeys,
+	"Microsoft.Storage/storageAccounts/blobServices/generateUserDelegationKey/action",
+	"Microsoft.Storage/storageAccounts/blobServices/containers/write",
+	"Microsoft.Storage/storageAccounts/blobServices/containers/delete",
+	"Microsoft.Authorization/roleAssignments/write",
+}
+
+func azureBindings() *connectors.RoleBindings {
+	return &connectors.RoleBindings{
+		Ancestors: []string{"/providers/Microsoft.Management/managementGroups/corp", azureSub},
+		Roles: []connectors.RoleDefinition{
+			{
+				ID:          azureSub + "/providers/Microsoft.Authorization/roleDefinitions/reader-guid",
+				Name:        "Storage Blob Data Reader",
+				Actions:     []string{"Microsoft.Storage/storageAccounts/blobServices/containers/read"},
+				DataActions: []string{blobRead},
+			},
+			{
+				ID:      azureSub + "/providers/Microsoft.Authorization/roleDefinitions/owner-guid",
+				Name:    "Owner",
+				Actions: []string{"*"},
+			},
+			{
+				ID:             azureSub + "/providers/Microsoft.Authorization/roleDefinitions/contrib-guid",
+				Name:           "Storage Blob Data Contributor",
+				DataActions:    []string{"Microsoft.Storage/storageAccounts/blobServices/containers/blobs/*"},
+				NotDataActions: []string{"Microsoft.Storage/storageAccounts/blobServices/containers/blobs/delete"},
+			},
+		},
+		Bindings: []connectors.RoleBinding{
+			// Assigned at the management group, read back with its own ID
+			{
+				Scope:      "/providers/Microsoft.Management/managementGroups/corp",
+				RoleID:     "/providers/Microsoft.Management/managementGroups/corp/providers/Microsoft.Authorization/roleDefinitions/owner-guid",
+				Member:     "admin-oid",
+				MemberType: "USER",
+			},
+			{Scope: azureContainer, RoleID: azureSub + "/providers/Microsoft.Authorization/roleDefinitions/reader-guid", Member: "analyst-oid", MemberType: "USER"},
+			{Scope: azureAccount, RoleID: azureSub + "/providers/Microsoft.Authorization/roleDefinitions/contrib-guid", Member: "etl-oid", MemberType: "SERVICE"},
+			// Resource group scopes are matched regardless of case
+			{
+				Scope:      "/subscriptions/sub-1/resourcegroups/data",
+				RoleID:     azureSub + "/providers/Microsoft.Authorization/roleDefinitions/reader-guid",
+				Member:     "auditors-oid",
+				MemberType: "GROUP",
+				Condition:  "@Resource[Microsoft.Storage/storageAccounts/blobServices/containers:name] StringEquals 'customers'",
+			},
+		},
+	}
+}
+
+func TestEvaluateRoleBindingsAzure(t *testing.T) {
+	customers := &models.DataAsset{ID: uuid.New(), ResourceARN: azureContainer}
+	assets := &models.DataAsset{ID: uuid.New(), ResourceARN: azureOther}
+
+	access := make(map[string]RoleAccess)
+	for _, a := range EvaluateRoleBindings(azureBindings(), []*models.DataAsset{customers, assets}) {
+		access[a.PrincipalARN+" "+a.ResourceARN] = a
+	}
+
+	tests := []struct {
+		key         string
+		level       models.PermissionLevel
+		actions     []string
+		conditional []string
+	}{
+		// Owner has no data actions, but may list the account keys
+		{key: "admin-oid " + azureContainer, level: models.PermissionAdmin, actions: ownerActions},
+		{key: "admin-oid " + azureOther, level: models.PermissionAdmin, actions: ownerActions},
+		{key: "analyst-oid " + azureContainer, level: models.PermissionRead, actions: []string{blobRead}},
+		{key: "etl-oid " + azureContainer, level: models.PermissionWrite, actions: []string{
+			blobRead, blobWrite, "Microsoft.Storage/storageAccounts/blobServices/containers/blobs/add/action",
+		}},
+		{key: "auditors-oid " + azureContainer, level: models.PermissionRead, conditional: []string{blobRead}},
+	}
+	for _, tt := range tests {
+		a, ok := access[tt.key]
+		if !ok {
+			t.Errorf("expected access for %s", tt.key)
+			continue
+		}
+		if a.PermissionLevel != tt.level {
+			t.Errorf("%s: expected level %s, got %s", tt.key, tt.level, a.PermissionLevel)
+		}
+		if !equalStrings(a.Actions, tt.actions) {
+			t.Errorf("%s: expected actions %v, got %v", tt.key, tt.actions, a.Actions)
+		}
+		if !equalStrings(a.ConditionalActions, tt.conditional) {
+			t.Errorf("%s: expected conditional actions %v, got %v", tt.key, tt.conditional, a.ConditionalActions)
+		}
+	}
+	if len(access) != len(tests) {
+		t.Errorf("expected %d grants, got %d", len(tests), len(access))
+	}
+	if c := access["auditors-oid "+azureContainer].Conditions; len(c) != 1 {
+		t.Errorf("expected the auditors' condition, got %v", c)
+	}
+}
+
+func TestEvaluateRoleBindingsGCP(t *testing.T) {
+	bindings := &connectors.RoleBindings{
+		Ancestors: []string{"organizations/1", "folders/2", "projects/p"},
+		Roles: []connectors.RoleDefinition{
+			{ID: "roles/storage.objectViewer", Actions: []string{"storage.objects.get", "storage.objects.list"}},
+			{ID: "roles/storage.admin", Actions: []string{
+				"storage.objects.get", "storage.objects.list", "storage.objects.create", "storage.objects.update",
+				"storage.objects.delete", "storage.objects.setIamPolicy", "storage.buckets.setIamPolicy",
+				"storage.buckets.update", "storage.buckets.delete",
+			}},
+		},
+		Bindings: []connectors.RoleBinding{
+			{Scope: "organizations/1", RoleID: "roles/storage.admin", Member: "group:admins@example.com", MemberType: "GROUP"},
+			{Scope: "gs://reports", RoleID: "roles/storage.objectViewer", Member: "allUsers", MemberType: "PUBLIC"},
+			{Scope: "folders/2", RoleID: "roles/storage.objectViewer", Member: "user:alice@example.com", MemberType: "USER",
+				Condition: `resource.name.startsWith("projects/_/buckets/reports")`},
+			{Scope: "projects/p", RoleID: "roles/storage.objectViewer", Member: "user:bob@example.com", MemberType: "USER",
+				Condition: `request.time < timestamp("2030-01-01T00:00:00Z")`},
+			// Bound at another project's scope, which covers nothing here
+			{Scope: "projects/other", RoleID: "roles/storage.admin", Member: "user:mallory@example.com", MemberType: "USER"},
+		},
+	}
+	customers := &models.DataAsset{ID: uuid.New(), ResourceARN: "gs://customers"}
+	reports := &models.DataAsset{ID: uuid.New(), ResourceARN: "gs://reports"}
+
+	access := make(map[string]RoleAccess)
+	for _, a := range EvaluateRoleBindings(bindings, []*models.DataAsset{customers, reports}) {
+		access[a.PrincipalARN+" "+a.ResourceARN] = a
+	}
+
+	expected := map[string]models.PermissionLevel{
+		"group:admins@example.com gs://customers": models.PermissionFull,
+		"group:admins@example.com gs://reports":   models.PermissionFull,
+		"allUsers gs://reports":                   models.PermissionRead,
+		"user:alice@example.com gs://reports":     models.PermissionRead,
+		"user:bob@example.com gs://customers":     models.PermissionRead,
+		"user:bob@example.com gs://reports":       models.PermissionRead,
+	}
+	for key, level := range expected {
+		if access[key].PermissionLevel != level {
+			t.Errorf("%s: expected level %s, got %q", key, level, access[key].PermissionLevel)
+		}
+	}
+	if len(access) != len(expected) {
+		t.Errorf("expected %d grants, got %d", len(expected), len(access))
+	}
+	if a := access["allUsers gs://reports"]; !a.IsPublic || a.PrincipalType != PrincipalTypeAnonymous {
+		t.Errorf("expected allUsers to be public, got %+v", a)
+	}
+	if a := access["user:bob@example.com gs://customers"]; len(a.Actions) != 0 || len(a.ConditionalActions) != 2 {
+		t.Errorf("expected bob's access to be conditional, got %+v", a)
+	}
+}
+
+func TestConditionExcludes(t *testing.T) {
+	tests := []struct {
+		condition string
+		resource  string
+		expected  bool
+	}{
+		{`resource.name.startsWith("projects/_/buckets/reports")`, "gs://reports", false},
+		{`resource.name.startsWith("projects/_/buckets/reports")`, "gs://customers", true},
+		{`resource.name.startsWith("projects/_/buckets/rep")`, "gs://reports", false},
+		{`resource.name.startsWith("projects/_/buckets/reports/objects/2024/")`, "gs://reports", false},
+		{`resource.name.startsWith("projects/_/buckets/reports-archive/objects/")`, "gs://reports", true},
+		{`resource.name == "projects/_/buckets/reports"`, "gs://reports", false},
+		{`resource.name == "projects/_/buckets/reports"`, "gs://reportsx", true},
+		{`(resource.name == "projects/_/buckets/a") || (resource.name.startsWith("projects/_/buckets/b/"))`, "gs://c", true},
+		{`resource.name == "projects/_/buckets/a" || resource.name.startsWith("projects/_/buckets/b/")`, "gs://b", false},
+		{`resource.name.startsWith("projects/_/buckets/a") && request.time < timestamp("2030-01-01T00:00:00Z")`, "gs://b", false},
+		{`resource.type == "storage.googleapis.com/Bucket"`, "gs://b", false},
+		{`@Resource[Microsoft.Storage/storageAccounts/blobServices/containers:name] StringEquals 'x'`, azureContainer, false},
+	}
+	for _, tt := range tests {
+		if got := conditionExcludes(tt.condition, tt.resource); got != tt.expected {
+			t.Errorf("conditionExcludes(%q, %q): expected %v, got %v", tt.condition, tt.resource, tt.expected, got)
+		}
+	}
+}
+
+func TestBuildGraphUpdateRoleBindings(t *testing.T) {
+	customers := &models.DataAsset{ID: uuid.New(), ResourceARN: azureContainer, Name: "acct/customers"}
+	update := BuildGraphUpdate(uuid.New(), &AccountAccess{
+		AccountID:    "sub-1",
+		RoleBindings: azureBindings(),
+		Assets:       []AssetAccess{{Asset: customers}},
+	})
+
+	if len(update.Principals) != 4 {
+		t.Errorf("expected 4 principals, got %d", len(update.Principals))
+	}
+	if len(update.Policies) != 3 || len(update.Attachments) != 4 {
+		t.Errorf("expected 3 roles attached 4 times, got %d and %d", len(update.Policies), len(update.Attachments))
+	}
+	if len(update.AccessEdges) != 4 {
+		t.Fatalf("expected 4 access edges, got %d", len(update.AccessEdges))
+	}
+	for _, e := range update.AccessEdges {
+		if e.TargetAssetID != customers.ID || e.GrantType != "ROLE_BINDING" {
+			t.Errorf("unexpected edge %+v", e)
+		}
+		if e.SourceARN == "auditors-oid" && e.Conditions["conditional_actions"] == nil {
+			t.Errorf("expected the auditors' edge to be conditional, got %+v", e.Conditions)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,415 @@
+package access
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// ReadAccountAccess reads what an access scan needs from an account: its
+// IAM policies or role bindings, and the policy, ACL and public access
+// block of each S3 bucket among assets
+func ReadAccountAccess(ctx context.Context, conn connectors.Connector, accountID string, assets []models.DataAsset) (*AccountAccess, error) {
+	scan := &AccountAccess{AccountID: accountID}
+	if c, ok := conn.(interface{ AccountID() string }); ok && c.AccountID() != "" {
+		scan.AccountID = c.AccountID()
+	}
+
+	// AWS accounts are read as IAM policies, Azure subscriptions and GCP
+	// projects as role bindings
+	switch c := conn.(type) {
+	case connectors.AuthorizationConnector:
+		details, err := c.GetAuthorizationDetails(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading authorization details: %w", err)
+		}
+		scan.Authorization = details
+	case connectors.RoleBindingConnector:
+		bindings, err := c.GetRoleBindings(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("reading role bindings: %w", err)
+		}
+		scan.RoleBindings = bindings
+	default:
+		return nil, fmt.Errorf("connector does not support access analysis")
+	}
+
+	storageConn, _ := conn.(connectors.StorageConnector)
+	for i := range assets {
+		asset := &assets[i]
+		assetAccess := AssetAccess{Asset: asset}
+		if storageConn != nil && asset.ResourceType == models.ResourceTypeS3Bucket {
+			// A bucket without a policy returns an error, which is not a failure
+			if policy, err := storageConn.GetBucketPolicy(ctx, asset.Name); err == nil && policy != nil {
+				assetAccess.Policy = policy.PolicyDocument
+			}
+			if acl, err := storageConn.GetBucketACL(ctx, asset.Name); err == nil {
+				assetAccess.ACL = acl
+			} else {
+				log.Printf("Error reading ACL of %s: %v", asset.Name, err)
+			}
+			if metadata, err := storageConn.GetBucketMetadata(ctx, asset.Name); err == nil {
+				assetAccess.PublicAccessBlock = &metadata.PublicAccessBlock
+			}
+		}
+		scan.Assets = append(scan.Assets, assetAccess)
+	}
+
+	return scan, nil
+}
+
+// ProposedChange is a change to an account's policies to simulate. It either
+// targets the bucket named by AssetARN, replacing its policy or public
+// access block, or replaces an identity policy: a managed policy named by
+// PolicyARN, or the inline policy PolicyName of PrincipalARN.
+type ProposedChange struct {
+	AssetARN     string
+	BucketPolicy *connectors.PolicyDocument
+	// RemoveBucketPolicy deletes the bucket's policy
+	RemoveBucketPolicy bool
+	PublicAccessBlock  *connectors.PublicAccessBlockConfig
+
+	PolicyARN      string
+	PrincipalARN   string
+	PolicyName     string
+	IdentityPolicy *connectors.PolicyDocument
+}
+
+// Validate checks that the change names one target and one new control
+func (c *ProposedChange) Validate() error {
+	if c.AssetARN != "" {
+		controls := 0
+		for _, set := range []bool{c.BucketPolicy != nil, c.RemoveBucketPolicy, c.PublicAccessBlock != nil} {
+			if set {
+				controls++
+			}
+		}
+		if controls != 1 || c.IdentityPolicy != nil {
+			return fmt.Errorf("a bucket change needs exactly one of a bucket policy, its removal or a public access block")
+		}
+		return nil
+	}
+	if c.IdentityPolicy == nil {
+		return fmt.Errorf("a bucket or an identity policy change is required")
+	}
+	if c.PolicyARN == "" && (c.PrincipalARN == "" || c.PolicyName == "") {
+		return fmt.Errorf("an identity policy change needs a policy ARN, or a principal ARN and policy name")
+	}
+	return nil
+}
+
+// apply returns a copy of scan with the change made. Only what the change
+// touches is copied; the rest is shared with scan.
+func (c *ProposedChange) apply(scan *AccountAccess) (*AccountAccess, error) {
+	changed := *scan
+
+	if c.AssetARN != "" {
+		changed.Assets = append([]AssetAccess(nil), scan.Assets...)
+		for i := range changed.Assets {
+			assetAccess := &changed.Assets[i]
+			if assetAccess.Asset.ResourceARN != c.AssetARN {
+				continue
+			}
+			switch {
+			case c.RemoveBucketPolicy:
+				assetAccess.Policy = nil
+			case c.BucketPolicy != nil:
+				assetAccess.Policy = c.BucketPolicy
+			case c.PublicAccessBlock != nil:
+				assetAccess.PublicAccessBlock = c.PublicAccessBlock
+			}
+			return &changed, nil
+		}
+		return nil, fmt.Errorf("asset %s is not in the account", c.AssetARN)
+	}
+
+	if scan.Authorization == nil {
+		return nil, fmt.Errorf("account has no IAM policies")
+	}
+	auth := *scan.Authorization
+	changed.Authorization = &auth
+
+	// Inline policies are added when the principal does not have them yet
+	if c.PrincipalARN != "" && c.PolicyName != "" {
+		for _, principals := range []*[]connectors.PrincipalDetails{&auth.Users, &auth.Groups, &auth.Roles} {
+			for i, p := range *principals {
+				if p.ARN != c.PrincipalARN {
+					continue
+				}
+				copied := append([]connectors.PrincipalDetails(nil), (*principals)...)
+				inline := make(map[string]*connectors.PolicyDocument, len(p.InlinePolicies)+1)
+				for name, doc := range p.InlinePolicies {
+					inline[name] = doc
+				}
+				inline[c.PolicyName] = c.IdentityPolicy
+				copied[i].InlinePolicies = inline
+				*principals = copied
+				return &changed, nil
+			}
+		}
+		return nil, fmt.Errorf("principal %s is not in the account", c.PrincipalARN)
+	}
+
+	auth.Policies = append([]connectors.ManagedPolicy(nil), scan.Authorization.Policies...)
+	for i := range auth.Policies {
+		if auth.Policies[i].ARN == c.PolicyARN {
+			auth.Policies[i].Document = c.IdentityPolicy
+			return &changed, nil
+		}
+	}
+	return nil, fmt.Errorf("policy %s is not in the account", c.PolicyARN)
+}
+
+// Simulation is the difference a policy change makes to effective access to
+// sensitive assets
+type Simulation struct {
+	// Changes are the principals gaining or losing actions on sensitive
+	// assets. Anonymous access is listed under PublicPrincipalARN.
+	Changes []AccessChange `json:"changes"`
+	// PublicPathsOpened are the sensitive assets anyone can reach after the
+	// change but not before, directly or by assuming roles, and
+	// PublicPathsClosed those no longer reachable
+	PublicPathsOpened []PublicPath `json:"public_paths_opened"`
+	PublicPathsClosed []PublicPath `json:"public_paths_closed"`
+	PrincipalsGaining int          `json:"principals_gaining"`
+	PrincipalsLosing  int          `json:"principals_losing"`
+}
+
+// AccessChange is how one principal's access to one asset changes
+type AccessChange struct {
+	PrincipalARN  string                 `json:"principal_arn"`
+	PrincipalType string                 `json:"principal_type"`
+	AssetID       string                 `json:"asset_id"`
+	AssetARN      string                 `json:"asset_arn"`
+	AssetName     string                 `json:"asset_name"`
+	Sensitivity   string                 `json:"sensitivity"`
+	Categories    []string               `json:"categories"`
+	Gained        []string               `json:"gained"`
+	Lost          []string               `json:"lost"`
+	LevelBefore   models.PermissionLevel `json:"level_before,omitempty"`
+	LevelAfter    models.PermissionLevel `json:"level_after,omitempty"`
+}
+
+// PublicPath is how anyone reaches an asset. Via lists the roles assumed on
+// the way, and is empty when the asset itself admits everyone.
+type PublicPath struct {
+	AssetID     string   `json:"asset_id"`
+	AssetARN    string   `json:"asset_arn"`
+	AssetName   string   `json:"asset_name"`
+	Sensitivity string   `json:"sensitivity"`
+	Via         []string `json:"via"`
+	Permissions []string `json:"permissions"`
+}
+
+// Simulate evaluates an account's access before and after a policy change
+// and reports the difference on sensitive assets: those with a sensitivity
+// level or a classification among classifications
+func Simulate(scan *AccountAccess, change ProposedChange, classifications []ClassificationRollup) (*Simulation, error) {
+	if err := change.Validate(); err != nil {
+		return nil, err
+	}
+	changed, err := change.apply(scan)
+	if err != nil {
+		return nil, err
+	}
+	before := BuildGraphUpdate(uuid.Nil, scan)
+	after := BuildGraphUpdate(uuid.Nil, changed)
+
+	categories := make(map[uuid.UUID][]string)
+	for _, c := range classifications {
+		categories[c.AssetID] = append(categories[c.AssetID], string(c.Category))
+	}
+	sensitive := make(map[uuid.UUID]*models.DataAsset)
+	for _, assetAccess := range scan.Assets {
+		asset := assetAccess.Asset
+		if sensitivityRank[string(asset.SensitivityLevel)] > 0 || len(categories[asset.ID]) > 0 {
+			sensitive[asset.ID] = asset
+			categories[asset.ID] = append([]string{}, categories[asset.ID]...)
+			sort.Strings(categories[asset.ID])
+		}
+	}
+
+	sim := &Simulation{Changes: []AccessChange{}}
+	grants := func(update *GraphUpdate) map[[2]string]map[string]bool {
+		granted := make(map[[2]string]map[string]bool)
+		add := func(principalARN string, assetID uuid.UUID, permissions []string) {
+			if sensitive[assetID] == nil {
+				return
+			}
+			key := [2]string{principalARN, assetID.String()}
+			if granted[key] == nil {
+				granted[key] = make(map[string]bool)
+			}
+			for _, p := range permissions {
+				granted[key][p] = true
+			}
+		}
+		for _, edge := range update.AccessEdges {
+			add(edge.SourceARN, edge.TargetAssetID, edge.Permissions)
+		}
+		for _, pa := range update.PublicAccess {
+			add(PublicPrincipalARN, pa.AssetID, pa.Permissions)
+		}
+		return granted
+	}
+	types := map[string]string{PublicPrincipalARN: "PUBLIC"}
+	for _, update := range []*GraphUpdate{before, after} {
+		for _, p := range update.Principals {
+			types[p.ARN] = p.Type
+		}
+	}
+
+	was, is := grants(before), grants(after)
+	keys := make(map[[2]string]bool)
+	for key := range was {
+		keys[key] = true
+	}
+	for key := range is {
+		keys[key] = true
+	}
+	gaining, losing := make(map[string]bool), make(map[string]bool)
+	for key := range keys {
+		gained, lost := setDifference(is[key], was[key]), setDifference(was[key], is[key])
+		if len(gained) == 0 && len(lost) == 0 {
+			continue
+		}
+		asset := sensitive[uuid.MustParse(key[1])]
+		sim.Changes = append(sim.Changes, AccessChange{
+			PrincipalARN:  key[0],
+			PrincipalType: types[key[0]],
+			AssetID:       key[1],
+			AssetARN:      asset.ResourceARN,
+			AssetName:     asset.Name,
+			Sensitivity:   string(asset.SensitivityLevel),
+			Categories:    categories[asset.ID],
+			Gained:        gained,
+			Lost:          lost,
+			LevelBefore:   permissionLevel(asset.ResourceARN, sortedKeys(was[key])),
+			LevelAfter:    permissionLevel(asset.ResourceARN, sortedKeys(is[key])),
+		})
+		if len(gained) > 0 {
+			gaining[key[0]] = true
+		}
+		if len(lost) > 0 {
+			losing[key[0]] = true
+		}
+	}
+	sort.Slice(sim.Changes, func(i, j int) bool {
+		a, b := sim.Changes[i], sim.Changes[j]
+		if a.AssetARN != b.AssetARN {
+			return a.AssetARN < b.AssetARN
+		}
+		return a.PrincipalARN < b.PrincipalARN
+	})
+	sim.PrincipalsGaining, sim.PrincipalsLosing = len(gaining), len(losing)
+
+	publicBefore, publicAfter := PublicPaths(before, sensitive), PublicPaths(after, sensitive)
+	sim.PublicPathsOpened, sim.PublicPathsClosed = []PublicPath{}, []PublicPath{}
+	for _, asset := range sortedAssets(sensitive) {
+		path, wasPublic := publicBefore[asset.ID.String()]
+		if after, isPublic := publicAfter[asset.ID.String()]; isPublic && !wasPublic {
+			sim.PublicPathsOpened = append(sim.PublicPathsOpened, after)
+		} else if wasPublic && !isPublic {
+			sim.PublicPathsClosed = append(sim.PublicPathsClosed, path)
+		}
+	}
+
+	return sim, nil
+}
+
+// PublicPaths finds the shortest way anyone reaches each of assets, by asset
+// ID: its own public access, or the access of a role reached by assuming
+// roles from the public principal
+func PublicPaths(update *GraphUpdate, assets map[uuid.UUID]*models.DataAsset) map[string]PublicPath {
+	paths := make(map[string]PublicPath)
+	newPath := func(asset *models.DataAsset, via, permissions []string) PublicPath {
+		return PublicPath{
+			AssetID:     asset.ID.String(),
+			AssetARN:    asset.ResourceARN,
+			AssetName:   asset.Name,
+			Sensitivity: string(asset.SensitivityLevel),
+			Via:         append([]string{}, via...),
+			Permissions: permissions,
+		}
+	}
+	for _, pa := range update.PublicAccess {
+		if asset := assets[pa.AssetID]; asset != nil {
+			paths[asset.ID.String()] = newPath(asset, nil, pa.Permissions)
+		}
+	}
+
+	via := AssumptionPaths(update, PublicPrincipalARN)
+	for _, edge := range update.AccessEdges {
+		roles, ok := via[edge.SourceARN]
+		asset := assets[edge.TargetAssetID]
+		if !ok || len(roles) == 0 || asset == nil {
+			continue
+		}
+		current, found := paths[asset.ID.String()]
+		if found && (len(current.Via) < len(roles) || len(current.Via) == len(roles) && current.Via[len(current.Via)-1] <= edge.SourceARN) {
+			continue
+		}
+		paths[asset.ID.String()] = newPath(asset, roles, edge.Permissions)
+	}
+	return paths
+}
+
+// AssumptionPaths finds the principals reachable from sources by assuming
+// roles, with the shortest chain of roles assumed to reach each. Sources
+// reach themselves through no roles.
+func AssumptionPaths(update *GraphUpdate, sources ...string) map[string][]string {
+	assumable := make(map[string][]string)
+	for _, a := range update.Assumptions {
+		assumable[a.SourceARN] = append(assumable[a.SourceARN], a.RoleARN)
+	}
+
+	via := make(map[string][]string)
+	var queue []string
+	for _, source := range sources {
+		if _, seen := via[source]; !seen {
+			via[source] = []string{}
+			queue = append(queue, source)
+		}
+	}
+	for len(queue) > 0 {
+		source := queue[0]
+		queue = queue[1:]
+		roles := append([]string(nil), assumable[source]...)
+		sort.Strings(roles)
+		for _, role := range roles {
+			if _, seen := via[role]; seen {
+				continue
+			}
+			via[role] = append(append([]string{}, via[source]...), role)
+			queue = append(queue, role)
+		}
+	}
+	return via
+}
+
+// setDifference lists the keys of a missing from b, sorted
+func setDifference(a, b map[string]bool) []string {
+	diff := []string{}
+	for k := range a {
+		if !b[k] {
+			diff = append(diff, k)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func sortedAssets(assets map[uuid.UUID]*models.DataAsset) []*models.DataAsset {
+	sorted := make([]*models.DataAsset, 0, len(assets))
+	for _, asset := range assets {
+		sorted = append(sorted, asset)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ResourceARN < sorted[j].ResourceARN })
+	return sorted
+}
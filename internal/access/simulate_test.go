@@ -0,0 +1,178 @@
+package access
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+const (
+	simAccount  = "111111111111"
+	simReader   = "arn:aws:iam::111111111111:role/reader"
+	simPolicy   = "arn:aws:iam::111111111111:policy/data-access"
+	simCustomer = "arn:aws:s3:::customers"
+)
+
+func allow(principals []string, actions ...string) connectors.PolicyStatement {
+	return connectors.PolicyStatement{
+		Effect:     "Allow",
+		Principals: principals,
+		Actions:    actions,
+		Resources:  []string{simCustomer, simCustomer + "/*"},
+	}
+}
+
+// simulationFixture is an account with a critical bucket, an unclassified
+// one, and a role granted read and write on the critical bucket by a
+// managed policy
+func simulationFixture() (*AccountAccess, *models.DataAsset) {
+	customers := &models.DataAsset{
+		ID:               uuid.New(),
+		ResourceARN:      simCustomer,
+		Name:             "customers",
+		ResourceType:     models.ResourceTypeS3Bucket,
+		SensitivityLevel: models.SensitivityCritical,
+	}
+	logs := &models.DataAsset{
+		ID:           uuid.New(),
+		ResourceARN:  "arn:aws:s3:::logs",
+		Name:         "logs",
+		ResourceType: models.ResourceTypeS3Bucket,
+	}
+	reader := connectors.PrincipalDetails{
+		Principal:        connectors.Principal{ARN: simReader, Name: "reader", Type: "ROLE"},
+		AttachedPolicies: []string{simPolicy},
+		TrustPolicy: &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{{
+			Effect: "Allow", Actions: []string{"sts:AssumeRole"}, ServicePrincipals: []string{"lambda.amazonaws.com"},
+		}}},
+	}
+	scan := &AccountAccess{
+		AccountID: simAccount,
+		Authorization: &connectors.AuthorizationDetails{
+			Roles: []connectors.PrincipalDetails{reader},
+			Policies: []connectors.ManagedPolicy{{
+				PolicyInfo: connectors.PolicyInfo{ARN: simPolicy, Name: "data-access"},
+				Document: &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{
+					allow(nil, "s3:GetObject", "s3:PutObject"),
+				}},
+			}},
+		},
+		Assets: []AssetAccess{{Asset: customers}, {Asset: logs}},
+	}
+	return scan, customers
+}
+
+func TestSimulateBucketPolicy(t *testing.T) {
+	scan, customers := simulationFixture()
+	public := &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{allow([]string{"*"}, "s3:GetObject")}}
+
+	sim, err := Simulate(scan, ProposedChange{AssetARN: simCustomer, BucketPolicy: public}, nil)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if len(sim.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", sim.Changes)
+	}
+	change := sim.Changes[0]
+	if change.PrincipalARN != PublicPrincipalARN || !equalStrings(change.Gained, []string{"s3:GetObject"}) || len(change.Lost) != 0 {
+		t.Errorf("expected public to gain s3:GetObject, got %+v", change)
+	}
+	if change.LevelBefore != "" || change.LevelAfter != models.PermissionRead {
+		t.Errorf("expected no access before and READ after, got %q and %q", change.LevelBefore, change.LevelAfter)
+	}
+	if len(sim.PublicPathsOpened) != 1 || sim.PublicPathsOpened[0].AssetID != customers.ID.String() || len(sim.PublicPathsOpened[0].Via) != 0 {
+		t.Errorf("expected a direct public path to customers, got %+v", sim.PublicPathsOpened)
+	}
+	if sim.PrincipalsGaining != 1 || sim.PrincipalsLosing != 0 {
+		t.Errorf("expected 1 principal gaining and none losing, got %d and %d", sim.PrincipalsGaining, sim.PrincipalsLosing)
+	}
+
+	// Blocking public access on the now public bucket closes the path again
+	scan.Assets[0].Policy = public
+	block := &connectors.PublicAccessBlockConfig{BlockPublicAcls: true, IgnorePublicAcls: true, BlockPublicPolicy: true, RestrictPublicBuckets: true}
+	sim, err = Simulate(scan, ProposedChange{AssetARN: simCustomer, PublicAccessBlock: block}, nil)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if len(sim.PublicPathsClosed) != 1 || len(sim.PublicPathsOpened) != 0 {
+		t.Errorf("expected the public path to close, got %+v", sim)
+	}
+	if len(sim.Changes) != 1 || !equalStrings(sim.Changes[0].Lost, []string{"s3:GetObject"}) {
+		t.Errorf("expected public to lose s3:GetObject, got %+v", sim.Changes)
+	}
+	if scan.Assets[0].PublicAccessBlock != nil {
+		t.Errorf("expected the simulation to leave the scan unchanged")
+	}
+}
+
+func TestSimulateIdentityPolicy(t *testing.T) {
+	scan, customers := simulationFixture()
+	classifications := []ClassificationRollup{
+		{AssetID: customers.ID, Category: models.CategoryPII, Sensitivity: models.SensitivityCritical, Count: 10},
+	}
+	restricted := &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{allow(nil, "s3:GetObject")}}
+
+	sim, err := Simulate(scan, ProposedChange{PolicyARN: simPolicy, IdentityPolicy: restricted}, classifications)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if len(sim.Changes) != 1 {
+		t.Fatalf("expected 1 change, got %+v", sim.Changes)
+	}
+	change := sim.Changes[0]
+	if change.PrincipalARN != simReader || change.PrincipalType != "ROLE" || !equalStrings(change.Lost, []string{"s3:PutObject"}) {
+		t.Errorf("expected reader to lose s3:PutObject, got %+v", change)
+	}
+	if change.LevelBefore != models.PermissionWrite || change.LevelAfter != models.PermissionRead {
+		t.Errorf("expected WRITE to READ, got %q to %q", change.LevelBefore, change.LevelAfter)
+	}
+	if !equalStrings(change.Categories, []string{string(models.CategoryPII)}) {
+		t.Errorf("expected the PII category, got %v", change.Categories)
+	}
+	if scan.Authorization.Policies[0].Document == restricted {
+		t.Errorf("expected the simulation to leave the scan unchanged")
+	}
+
+	// An inline policy on a role anyone can assume opens a path through it
+	scan.Authorization.Roles[0].TrustPolicy = &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{{
+		Effect: "Allow", Actions: []string{"sts:AssumeRole"}, Principals: []string{"*"},
+	}}}
+	scan.Authorization.Policies[0].Document = &connectors.PolicyDocument{}
+	sim, err = Simulate(scan, ProposedChange{PrincipalARN: simReader, PolicyName: "debug", IdentityPolicy: restricted}, classifications)
+	if err != nil {
+		t.Fatalf("Simulate: %v", err)
+	}
+	if len(sim.PublicPathsOpened) != 1 || !equalStrings(sim.PublicPathsOpened[0].Via, []string{simReader}) {
+		t.Errorf("expected a public path through reader, got %+v", sim.PublicPathsOpened)
+	}
+	if _, ok := scan.Authorization.Roles[0].InlinePolicies["debug"]; ok {
+		t.Errorf("expected the simulation to leave the scan unchanged")
+	}
+}
+
+func TestSimulateInvalidChange(t *testing.T) {
+	scan, _ := simulationFixture()
+	doc := &connectors.PolicyDocument{}
+	tests := []struct {
+		name   string
+		change ProposedChange
+		err    string
+	}{
+		{name: "empty", change: ProposedChange{}, err: "is required"},
+		{name: "two controls", change: ProposedChange{AssetARN: simCustomer, BucketPolicy: doc, RemoveBucketPolicy: true}, err: "exactly one"},
+		{name: "no target", change: ProposedChange{IdentityPolicy: doc}, err: "needs a policy ARN"},
+		{name: "unknown asset", change: ProposedChange{AssetARN: "arn:aws:s3:::other", RemoveBucketPolicy: true}, err: "not in the account"},
+		{name: "unknown policy", change: ProposedChange{PolicyARN: "arn:aws:iam::111111111111:policy/other", IdentityPolicy: doc}, err: "not in the account"},
+		{name: "unknown principal", change: ProposedChange{PrincipalARN: "arn:aws:iam::111111111111:role/other", PolicyName: "x", IdentityPolicy: doc}, err: "not in the account"},
+	}
+	for _, tt := range tests {
+		_, err := Simulate(scan, tt.change, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
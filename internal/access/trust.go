@@ -0,0 +1,365 @@
+package access
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Principal types of the parties outside an account that its roles trust.
+// An external account node stands for every principal in that account.
+const (
+	PrincipalTypeIdentityProvider = "IDENTITY_PROVIDER"
+	PrincipalTypeExternalAccount  = "EXTERNAL_ACCOUNT"
+)
+
+// Kinds of trust a role's trust policy grants outside its account
+const (
+	TrustFederated       = "FEDERATED"
+	TrustExternalAccount = "EXTERNAL_ACCOUNT"
+	// TrustWildcard admits any AWS principal, in any account
+	TrustWildcard = "WILDCARD"
+)
+
+// Well-known identity providers
+const (
+	ProviderGitHubActions = "GitHub Actions"
+	ProviderEKS           = "EKS"
+	ProviderCognito       = "Cognito"
+	ProviderSAML          = "SAML"
+	ProviderOIDC          = "OIDC"
+)
+
+// githubIssuer is the OIDC issuer of GitHub Actions workflow tokens
+const githubIssuer = "token.actions.githubusercontent.com"
+
+// webIdentityProviders are the identity providers named by domain rather
+// than by an IAM provider ARN. Their tokens are issued to many
+// applications, so trusting one requires an audience condition.
+var webIdentityProviders = map[string]string{
+	"cognito-identity.amazonaws.com": ProviderCognito,
+	"accounts.google.com":            "Google",
+	"graph.facebook.com":             "Facebook",
+	"www.amazon.com":                 "Login with Amazon",
+}
+
+// assumeActions are the actions that assume a role
+var assumeActions = []string{"sts:AssumeRole", "sts:AssumeRoleWithWebIdentity", "sts:AssumeRoleWithSAML"}
+
+// restrictingKeys are condition keys that confine a wildcard principal to
+// known accounts or organizations
+var restrictingKeys = []string{
+	"aws:principalorgid", "aws:principalorgpaths", "aws:principalaccount", "aws:principalarn",
+	"aws:sourceaccount", "aws:sourcearn", "aws:sourceorgid",
+}
+
+// TrustRelationship is a party outside an account that a role's trust
+// policy allows to assume the role
+type TrustRelationship struct {
+	RoleARN string `json:"role_arn"`
+	Kind    string `json:"kind"`
+	// Trusted is the identity provider, the external principal, or "*"
+	Trusted string `json:"trusted"`
+	// Provider names the identity provider of federated trust
+	Provider  string `json:"provider,omitempty"`
+	AccountID string `json:"account_id,omitempty"`
+	// Subjects are the token subjects the conditions admit, as patterns
+	// when matched with StringLike. Empty when subjects are unconstrained.
+	Subjects   []string               `json:"subjects,omitempty"`
+	Conditions map[string]interface{} `json:"conditions,omitempty"`
+	// Issues explain why the trust is broader than it should be
+	Issues []string `json:"issues,omitempty"`
+	// SensitiveAssets are the critical and high sensitivity assets the role
+	// can access, directly or through roles it can assume
+	SensitiveAssets []string `json:"sensitive_assets,omitempty"`
+}
+
+// Broad reports whether the trust admits more than it should
+func (t *TrustRelationship) Broad() bool {
+	return len(t.Issues) > 0
+}
+
+// NodeARN is the graph node standing for the trusted party: the provider,
+// or the external account's root. Wildcard trust is the public node.
+func (t *TrustRelationship) NodeARN() string {
+	switch t.Kind {
+	case TrustExternalAccount:
+		return "arn:aws:iam::" + t.AccountID + ":root"
+	case TrustWildcard:
+		return PublicPrincipalARN
+	}
+	return t.Trusted
+}
+
+// TrustRelationships parses the trust policies of an account's roles for
+// the identity providers, external accounts and wildcard principals they
+// admit, and checks each for broad trust
+func TrustRelationships(accountID string, roles []connectors.PrincipalDetails) []TrustRelationship {
+	var trusts []TrustRelationship
+	for _, role := range roles {
+		if role.TrustPolicy == nil {
+			continue
+		}
+		for _, stmt := range role.TrustPolicy.Statements {
+			if !strings.EqualFold(stmt.Effect, "Allow") || !allowsAssume(&stmt) {
+				continue
+			}
+			for _, provider := range stmt.FederatedPrincipals {
+				trusts = append(trusts, federatedTrust(role.ARN, provider, stmt.Conditions))
+			}
+			for _, p := range stmt.Principals {
+				if t, ok := awsTrust(accountID, role.ARN, p, stmt.Conditions); ok {
+					trusts = append(trusts, t)
+				}
+			}
+		}
+	}
+	return trusts
+}
+
+func allowsAssume(stmt *connectors.PolicyStatement) bool {
+	for _, action := range assumeActions {
+		if matchesAnyAction(stmt.Actions, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// federatedTrust checks the conditions a role places on the tokens of an
+// identity provider
+func federatedTrust(roleARN, provider string, conds map[string]interface{}) TrustRelationship {
+	t := TrustRelationship{
+		RoleARN:    roleARN,
+		Kind:       TrustFederated,
+		Trusted:    provider,
+		Conditions: conds,
+	}
+
+	issuer := provider
+	if i := strings.Index(provider, ":oidc-provider/"); i >= 0 {
+		issuer = provider[i+len(":oidc-provider/"):]
+	}
+	subjects, like := conditionKeyValues(conds, issuer+":sub")
+	t.Subjects = subjects
+
+	switch {
+	case strings.Contains(provider, ":saml-provider/"):
+		// Sign-in through SAML is confined by the assertions the IdP issues
+		t.Provider = ProviderSAML
+	case webIdentityProviders[provider] != "":
+		t.Provider = webIdentityProviders[provider]
+		if audiences, _ := conditionKeyValues(conds, issuer+":aud"); len(audiences) == 0 {
+			t.Issues = append(t.Issues, fmt.Sprintf("no %s:aud condition: any application using %s can assume the role", issuer, t.Provider))
+		}
+	case issuer == githubIssuer:
+		t.Provider = ProviderGitHubActions
+		if len(subjects) == 0 {
+			t.Issues = append(t.Issues, "no "+githubIssuer+":sub condition: any GitHub repository's workflows can assume the role")
+		}
+		if like {
+			t.Issues = append(t.Issues, githubSubjectIssues(subjects)...)
+		}
+	case strings.HasPrefix(issuer, "oidc.eks."):
+		t.Provider = ProviderEKS
+		if len(subjects) == 0 {
+			t.Issues = append(t.Issues, "no "+issuer+":sub condition: any service account in the cluster can assume the role")
+		}
+		if like {
+			t.Issues = append(t.Issues, eksSubjectIssues(subjects)...)
+		}
+	default:
+		t.Provider = ProviderOIDC
+		if len(subjects) == 0 {
+			t.Issues = append(t.Issues, "no "+issuer+":sub condition: any identity the provider issues tokens to can assume the role")
+		}
+	}
+	return t
+}
+
+// githubSubjectIssues flags subject patterns admitting every repository of
+// an owner, or of every owner. Subjects read "repo:owner/name:ref".
+func githubSubjectIssues(subjects []string) []string {
+	var issues []string
+	for _, sub := range subjects {
+		rest, ok := strings.CutPrefix(sub, "repo:")
+		if !ok {
+			if strings.HasPrefix(sub, "*") {
+				issues = append(issues, fmt.Sprintf("subject %q admits any GitHub repository", sub))
+			}
+			continue
+		}
+		owner, repo, _ := strings.Cut(rest, "/")
+		repo, _, _ = strings.Cut(repo, ":")
+		switch {
+		case strings.ContainsAny(owner, "*?"):
+			issues = append(issues, fmt.Sprintf("subject %q admits any GitHub repository", sub))
+		case repo == "" || strings.ContainsAny(repo, "*?"):
+			issues = append(issues, fmt.Sprintf("subject %q admits any repository of %s", sub, owner))
+		}
+	}
+	return issues
+}
+
+// eksSubjectIssues flags subject patterns admitting every namespace, or
+// every service account of a namespace. Subjects read
+// "system:serviceaccount:namespace:name".
+func eksSubjectIssues(subjects []string) []string {
+	var issues []string
+	for _, sub := range subjects {
+		rest, ok := strings.CutPrefix(sub, "system:serviceaccount:")
+		if !ok {
+			if strings.ContainsAny(sub, "*?") {
+				issues = append(issues, fmt.Sprintf("subject %q admits any service account in the cluster", sub))
+			}
+			continue
+		}
+		namespace, name, _ := strings.Cut(rest, ":")
+		switch {
+		case strings.ContainsAny(namespace, "*?"):
+			issues = append(issues, fmt.Sprintf("subject %q admits service accounts in any namespace", sub))
+		case name == "" || strings.ContainsAny(name, "*?"):
+			issues = append(issues, fmt.Sprintf("subject %q admits any service account in namespace %s", sub, namespace))
+		}
+	}
+	return issues
+}
+
+// awsTrust returns the trust an AWS principal element grants outside the
+// account, if any
+func awsTrust(accountID, roleARN, principal string, conds map[string]interface{}) (TrustRelationship, bool) {
+	t := TrustRelationship{RoleARN: roleARN, Trusted: principal, Conditions: conds}
+
+	account := principal
+	if parts := strings.SplitN(principal, ":", 6); len(parts) == 6 {
+		account = parts[4]
+	}
+	switch {
+	case principal == "*" || strings.ContainsAny(account, "*?"):
+		t.Kind = TrustWildcard
+		restricted := false
+		for _, key := range restrictingKeys {
+			if values, _ := conditionKeyValues(conds, key); len(values) > 0 {
+				restricted = true
+			}
+		}
+		if !restricted {
+			t.Issues = append(t.Issues, "any AWS principal in any account can assume the role")
+		}
+	case account != accountID:
+		t.Kind = TrustExternalAccount
+		t.AccountID = account
+	default:
+		return t, false
+	}
+	return t, true
+}
+
+// conditionKeyValues returns the values a statement's conditions test a
+// key against, under any operator, and whether any is a StringLike pattern
+func conditionKeyValues(conds map[string]interface{}, key string) ([]string, bool) {
+	var values []string
+	like := false
+	for op, keys := range conds {
+		byKey, ok := keys.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k, raw := range byKey {
+			if !strings.EqualFold(k, key) {
+				continue
+			}
+			values = append(values, conditionValues(raw)...)
+			if strings.Contains(strings.ToLower(op), "stringlike") {
+				like = true
+			}
+		}
+	}
+	return values, like
+}
+
+// addTrust adds the identity providers and external accounts an account's
+// roles trust, and their role assumptions, to the update, and records each
+// trust with the sensitive assets its role reaches
+func addTrust(scan *AccountAccess, update *GraphUpdate) {
+	if scan.Authorization == nil {
+		return
+	}
+	trusts := TrustRelationships(scan.AccountID, scan.Authorization.Roles)
+	if len(trusts) == 0 {
+		return
+	}
+
+	sensitive := make(map[string]bool)
+	for _, a := range scan.Assets {
+		switch a.Asset.SensitivityLevel {
+		case models.SensitivityCritical, models.SensitivityHigh:
+			sensitive[a.Asset.ResourceARN] = true
+		}
+	}
+	assumes := make(map[string][]string)
+	for _, a := range update.Assumptions {
+		assumes[a.SourceARN] = append(assumes[a.SourceARN], a.RoleARN)
+	}
+	accesses := make(map[string][]string)
+	for _, e := range update.AccessEdges {
+		if sensitive[e.TargetARN] {
+			accesses[e.SourceARN] = append(accesses[e.SourceARN], e.TargetARN)
+		}
+	}
+	// reaches returns the sensitive assets a role accesses, itself or
+	// through the roles it can assume
+	reaches := func(roleARN string) []string {
+		seen := map[string]bool{roleARN: true}
+		queue := []string{roleARN}
+		assets := make(map[string]bool)
+		for len(queue) > 0 {
+			arn := queue[0]
+			queue = queue[1:]
+			for _, asset := range accesses[arn] {
+				assets[asset] = true
+			}
+			for _, next := range assumes[arn] {
+				if !seen[next] {
+					seen[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+		return sortedKeys(assets)
+	}
+
+	seenNodes := make(map[string]bool)
+	seenAssumptions := make(map[RoleAssumption]bool)
+	for _, a := range update.Assumptions {
+		seenAssumptions[a] = true
+	}
+	for i := range trusts {
+		t := &trusts[i]
+		t.SensitiveAssets = reaches(t.RoleARN)
+
+		// Wildcard trust is evaluated as public role assumption already
+		if t.Kind == TrustWildcard {
+			continue
+		}
+		node := t.NodeARN()
+		if !seenNodes[node] {
+			seenNodes[node] = true
+			p := Principal{ID: principalID(node), ARN: node}
+			if t.Kind == TrustExternalAccount {
+				p.Name, p.Type = t.AccountID, PrincipalTypeExternalAccount
+			} else {
+				p.Name, p.Type = node[strings.LastIndex(node, "/")+1:], PrincipalTypeIdentityProvider
+			}
+			update.Principals = append(update.Principals, p)
+		}
+		assumption := RoleAssumption{SourceARN: node, RoleARN: t.RoleARN}
+		if !seenAssumptions[assumption] {
+			seenAssumptions[assumption] = true
+			update.Assumptions = append(update.Assumptions, assumption)
+		}
+	}
+	update.Trusts = trusts
+}
@@ -0,0 +1,190 @@
+package access
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+const (
+	githubProvider = "arn:aws:iam::111111111111:oidc-provider/token.actions.githubusercontent.com"
+	eksProvider    = "arn:aws:iam::111111111111:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/ABC"
+	samlProvider   = "arn:aws:iam::111111111111:saml-provider/okta"
+)
+
+// trustRole is a role whose trust policy has one statement
+func trustRole(name string, stmt connectors.PolicyStatement) connectors.PrincipalDetails {
+	return connectors.PrincipalDetails{
+		Principal:   connectors.Principal{ARN: "arn:aws:iam::111111111111:role/" + name, Name: name, Type: "ROLE"},
+		TrustPolicy: &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{stmt}},
+	}
+}
+
+func TestTrustRelationships(t *testing.T) {
+	federated := func(provider string, conds map[string]interface{}) connectors.PolicyStatement {
+		return connectors.PolicyStatement{
+			Effect:              "Allow",
+			Actions:             []string{"sts:AssumeRoleWithWebIdentity"},
+			FederatedPrincipals: []string{provider},
+			Conditions:          conds,
+		}
+	}
+	aws := func(principal string, conds map[string]interface{}) connectors.PolicyStatement {
+		return connectors.PolicyStatement{
+			Effect:     "Allow",
+			Actions:    []string{"sts:AssumeRole"},
+			Principals: []string{principal},
+			Conditions: conds,
+		}
+	}
+	githubSub := func(op, sub string) map[string]interface{} {
+		return map[string]interface{}{op: map[string]interface{}{
+			"token.actions.githubusercontent.com:aud": "sts.amazonaws.com",
+			"token.actions.githubusercontent.com:sub": sub,
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		stmt     connectors.PolicyStatement
+		kind     string
+		provider string
+		issues   int
+		issue    string
+	}{
+		{name: "github-repo", stmt: federated(githubProvider, githubSub("StringEquals", "repo:acme/app:ref:refs/heads/main")),
+			kind: TrustFederated, provider: ProviderGitHubActions},
+		{name: "github-branches", stmt: federated(githubProvider, githubSub("StringLike", "repo:acme/app:*")),
+			kind: TrustFederated, provider: ProviderGitHubActions},
+		{name: "github-org", stmt: federated(githubProvider, githubSub("StringLike", "repo:acme/*")),
+			kind: TrustFederated, provider: ProviderGitHubActions, issues: 1, issue: "any repository of acme"},
+		{name: "github-any-org", stmt: federated(githubProvider, githubSub("StringLike", "repo:*")),
+			kind: TrustFederated, provider: ProviderGitHubActions, issues: 1, issue: "any GitHub repository"},
+		{name: "github-no-sub", stmt: federated(githubProvider, map[string]interface{}{
+			"StringEquals": map[string]interface{}{"token.actions.githubusercontent.com:aud": "sts.amazonaws.com"},
+		}), kind: TrustFederated, provider: ProviderGitHubActions, issues: 1, issue: "no token.actions.githubusercontent.com:sub"},
+		{name: "eks-namespace", stmt: federated(eksProvider, map[string]interface{}{
+			"StringLike": map[string]interface{}{"oidc.eks.us-east-1.amazonaws.com/id/ABC:sub": "system:serviceaccount:etl:*"},
+		}), kind: TrustFederated, provider: ProviderEKS, issues: 1, issue: "any service account in namespace etl"},
+		{name: "eks-no-sub", stmt: federated(eksProvider, nil), kind: TrustFederated, provider: ProviderEKS, issues: 1},
+		{name: "saml", stmt: connectors.PolicyStatement{
+			Effect:              "Allow",
+			Actions:             []string{"sts:AssumeRoleWithSAML"},
+			FederatedPrincipals: []string{samlProvider},
+		}, kind: TrustFederated, provider: ProviderSAML},
+		{name: "cognito-no-aud", stmt: federated("cognito-identity.amazonaws.com", nil),
+			kind: TrustFederated, provider: ProviderCognito, issues: 1, issue: "cognito-identity.amazonaws.com:aud"},
+		{name: "external", stmt: aws("arn:aws:iam::222222222222:root", nil), kind: TrustExternalAccount},
+		{name: "external-account-id", stmt: aws("333333333333", nil), kind: TrustExternalAccount},
+		{name: "wildcard", stmt: aws("*", nil), kind: TrustWildcard, issues: 1},
+		{name: "wildcard-org", stmt: aws("*", map[string]interface{}{
+			"StringEquals": map[string]interface{}{"aws:PrincipalOrgID": "o-abc"},
+		}), kind: TrustWildcard},
+	}
+
+	for _, tt := range tests {
+		trusts := TrustRelationships("111111111111", []connectors.PrincipalDetails{trustRole(tt.name, tt.stmt)})
+		if len(trusts) != 1 {
+			t.Errorf("%s: expected 1 trust relationship, got %d", tt.name, len(trusts))
+			continue
+		}
+		got := trusts[0]
+		if got.Kind != tt.kind || got.Provider != tt.provider {
+			t.Errorf("%s: expected %s trust in %q, got %s in %q", tt.name, tt.kind, tt.provider, got.Kind, got.Provider)
+		}
+		if len(got.Issues) != tt.issues {
+			t.Errorf("%s: expected %d issues, got %v", tt.name, tt.issues, got.Issues)
+		}
+		if tt.issue != "" && len(got.Issues) > 0 && !strings.Contains(got.Issues[0], tt.issue) {
+			t.Errorf("%s: expected an issue about %q, got %v", tt.name, tt.issue, got.Issues)
+		}
+	}
+
+	// Principals of the account and services are not trust outside it
+	local := TrustRelationships("111111111111", []connectors.PrincipalDetails{
+		trustRole("local", aws("arn:aws:iam::111111111111:root", nil)),
+		trustRole("service", connectors.PolicyStatement{
+			Effect: "Allow", Actions: []string{"sts:AssumeRole"}, ServicePrincipals: []string{"lambda.amazonaws.com"},
+		}),
+		trustRole("denied", connectors.PolicyStatement{
+			Effect: "Deny", Actions: []string{"sts:AssumeRole"}, Principals: []string{"*"},
+		}),
+	})
+	if len(local) != 0 {
+		t.Errorf("expected no trust outside the account, got %+v", local)
+	}
+}
+
+func TestBuildGraphUpdateTrust(t *testing.T) {
+	customers := &models.DataAsset{
+		ID:               uuid.New(),
+		ResourceARN:      "arn:aws:s3:::customers",
+		Name:             "customers",
+		SensitivityLevel: models.SensitivityCritical,
+	}
+	deploy := trustRole("deploy", connectors.PolicyStatement{
+		Effect:              "Allow",
+		Actions:             []string{"sts:AssumeRoleWithWebIdentity"},
+		FederatedPrincipals: []string{githubProvider},
+		Conditions: map[string]interface{}{
+			"StringLike": map[string]interface{}{"token.actions.githubusercontent.com:sub": "repo:acme/*"},
+		},
+	})
+	deploy.InlinePolicies = map[string]*connectors.PolicyDocument{
+		"read": {Statements: []connectors.PolicyStatement{
+			{Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws:s3:::customers/*"}},
+		}},
+	}
+	audit := trustRole("audit", connectors.PolicyStatement{
+		Effect:     "Allow",
+		Actions:    []string{"sts:AssumeRole"},
+		Principals: []string{"arn:aws:iam::222222222222:root"},
+	})
+
+	update := BuildGraphUpdate(uuid.New(), &AccountAccess{
+		AccountID:     "111111111111",
+		Authorization: &connectors.AuthorizationDetails{Roles: []connectors.PrincipalDetails{deploy, audit}},
+		Assets:        []AssetAccess{{Asset: customers}},
+	})
+
+	types := make(map[string]string)
+	for _, p := range update.Principals {
+		types[p.ARN] = p.Type
+	}
+	if types[githubProvider] != PrincipalTypeIdentityProvider || types["arn:aws:iam::222222222222:root"] != PrincipalTypeExternalAccount {
+		t.Errorf("expected provider and external account principals, got %v", types)
+	}
+
+	assumptions := make(map[RoleAssumption]bool)
+	for _, a := range update.Assumptions {
+		assumptions[a] = true
+	}
+	for _, a := range []RoleAssumption{
+		{SourceARN: githubProvider, RoleARN: deploy.ARN},
+		{SourceARN: "arn:aws:iam::222222222222:root", RoleARN: audit.ARN},
+	} {
+		if !assumptions[a] {
+			t.Errorf("expected %s to assume %s, got %v", a.SourceARN, a.RoleARN, update.Assumptions)
+		}
+	}
+
+	if len(update.Trusts) != 2 {
+		t.Fatalf("expected 2 trust relationships, got %d", len(update.Trusts))
+	}
+	for _, trust := range update.Trusts {
+		switch trust.RoleARN {
+		case deploy.ARN:
+			if !trust.Broad() || !equalStrings(trust.SensitiveAssets, []string{customers.ResourceARN}) {
+				t.Errorf("expected broad trust in deploy reaching customers, got %+v", trust)
+			}
+		case audit.ARN:
+			if trust.Broad() || len(trust.SensitiveAssets) != 0 {
+				t.Errorf("expected narrow trust in audit reaching nothing, got %+v", trust)
+			}
+		}
+	}
+}
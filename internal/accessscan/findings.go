@@ -0,0 +1,375 @@
+package accessscan
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/anomaly"
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/correlation"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/remediation"
+	"github.com/qualys/dspm/internal/store"
+)
+
+// Least-privilege findings and the remediation actions proposed for them
+const (
+	findingUnusedDataAccess = "UNUSED_DATA_ACCESS"
+	leastPrivilegeSource    = "least_privilege"
+)
+
+// recommendLeastPrivilege compares an access scan with the data events
+// logged for sensitive assets. Each principal holding access it did not use
+// gets a finding, keyed on the principal and asset, and each policy granting
+// it a RESTRICT_IAM_POLICY proposal, which replaces those of the previous scan.
+func (s *Scanner) recommendLeastPrivilege(ctx context.Context, account *models.CloudAccount, scan *access.AccountAccess, source access.AccessLogSource) error {
+	lookback := s.lookback
+	since := time.Now().Add(-lookback)
+
+	observed := make(map[string][]access.ObservedAccess)
+	for _, assetAccess := range scan.Assets {
+		asset := assetAccess.Asset
+		if asset.SensitivityLevel != models.SensitivityCritical && asset.SensitivityLevel != models.SensitivityHigh {
+			continue
+		}
+		events, err := source.ObservedAccess(ctx, asset.ResourceARN, since)
+		if err != nil {
+			s.logger.Error("failed to read data events", "asset", asset.Name, "error", err)
+			continue
+		}
+		observed[asset.ResourceARN] = events
+	}
+
+	report, err := access.RecommendLeastPrivilege(scan, observed)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.DeletePendingRemediationActions(ctx, account.ID, remediation.ActionRestrictIAMPolicy, leastPrivilegeSource); err != nil {
+		return err
+	}
+
+	changes := make(map[string]*access.PolicyChange, len(report.Changes))
+	for i := range report.Changes {
+		changes[report.Changes[i].PolicyARN] = &report.Changes[i]
+	}
+
+	days := int(lookback.Hours() / 24)
+	var raised []*models.Finding
+	// findings[policy] is the first finding a policy change resolves
+	findings := make(map[string]*models.Finding)
+	for _, rec := range report.Recommendations {
+		var policyChanges []map[string]interface{}
+		for _, arn := range rec.PolicyARNs {
+			policyChanges = append(policyChanges, map[string]interface{}{
+				"policy_arn": arn,
+				"diff":       changes[arn].Diff,
+			})
+		}
+
+		severity := models.SeverityMedium
+		if rec.Sensitivity == models.SensitivityCritical {
+			severity = models.SeverityHigh
+		}
+		now := time.Now()
+		finding := &models.Finding{
+			ID:          uuid.New(),
+			AccountID:   account.ID,
+			AssetID:     &rec.Asset.ID,
+			FindingType: findingUnusedDataAccess,
+			Severity:    severity,
+			Title:       fmt.Sprintf("Unused data access to %s", rec.Asset.Name),
+			Description: fmt.Sprintf("%s can perform %d actions on %s sensitive data that it has not used in the last %d days: %s.",
+				rec.PrincipalARN, len(rec.Unused), strings.ToLower(string(rec.Sensitivity)), days, strings.Join(rec.Unused, ", ")),
+			Remediation: "Remove the unused actions from the principal's policies. The proposed policy changes keep the access it used.",
+			Status:      models.FindingStatusOpen,
+			ComplianceFrameworks: []string{
+				"GDPR-Art25", "HIPAA-164.312", "PCI-DSS-7.2", "SOC2-CC6.3",
+			},
+			Evidence: models.JSONB{
+				"principal_arn":     rec.PrincipalARN,
+				"principal_type":    rec.PrincipalType,
+				"granted":           rec.Granted,
+				"used":              rec.Used,
+				"unused":            rec.Unused,
+				"current_level":     rec.CurrentLevel,
+				"recommended_level": rec.RecommendedLevel,
+				"lookback_days":     days,
+				"policy_changes":    policyChanges,
+			},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			FirstSeenAt: now,
+			LastSeenAt:  now,
+		}
+		raised = append(raised, finding)
+		for _, arn := range rec.PolicyARNs {
+			if findings[arn] == nil {
+				findings[arn] = finding
+			}
+		}
+	}
+	if err := s.saveFindings(ctx, account.ID, []string{findingUnusedDataAccess}, raised, evidenceKey("principal_arn")); err != nil {
+		return err
+	}
+
+	var definition remediation.ActionDefinition
+	for _, def := range remediation.GetActionDefinitions() {
+		if def.ActionType == remediation.ActionRestrictIAMPolicy {
+			definition = def
+		}
+	}
+	for _, change := range report.Changes {
+		finding := findings[change.PolicyARN]
+		params := map[string]interface{}{
+			"policy_arn":          change.PolicyARN,
+			"new_policy_document": change.ProposedDocument,
+			"diff":                change.Diff,
+			"restrictions":        change.Restrictions,
+			"source":              leastPrivilegeSource,
+		}
+		if change.PolicyType == "INLINE" {
+			params["principal_arn"] = change.PrincipalARN
+			params["policy_name"] = change.PolicyName
+		}
+
+		var resources []string
+		for _, r := range change.Restrictions {
+			resources = append(resources, r.ResourceARN)
+		}
+		now := time.Now()
+		action := &remediation.Action{
+			ID:                uuid.New(),
+			AccountID:         account.ID,
+			AssetID:           *finding.AssetID,
+			FindingID:         &finding.ID,
+			ActionType:        remediation.ActionRestrictIAMPolicy,
+			Status:            remediation.StatusPending,
+			RiskLevel:         definition.RiskLevel,
+			Description:       fmt.Sprintf("Remove unused data access to %s from policy %s", strings.Join(resources, ", "), change.PolicyName),
+			Parameters:        params,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+			RollbackAvailable: definition.RollbackAvailable,
+		}
+		if err := s.store.CreateRemediationAction(ctx, action); err != nil {
+			return fmt.Errorf("proposing policy change for %s: %w", change.PolicyARN, err)
+		}
+	}
+
+	s.logger.Info("least-privilege analysis complete",
+		"account_id", account.ID,
+		"principals_with_unused_access", len(report.Recommendations),
+		"policy_changes", len(report.Changes))
+	return nil
+}
+
+// findingKey identifies the same finding across scans
+type findingKey func(finding *models.Finding) string
+
+// evidenceKey keys findings on their type, asset and the given evidence fields
+func evidenceKey(fields ...string) findingKey {
+	return func(finding *models.Finding) string {
+		parts := []string{finding.FindingType}
+		if finding.AssetID != nil {
+			parts = append(parts, finding.AssetID.String())
+		}
+		for _, field := range fields {
+			parts = append(parts, fmt.Sprint(finding.Evidence[field]))
+		}
+		return strings.Join(parts, "|")
+	}
+}
+
+// saveFindings records the findings of the given types that a scan raised.
+// A finding stored with the same key is updated in place, keeping its ID,
+// first sighting and triage status, and is reopened if it was resolved.
+// Open findings of those types that the scan no longer raises are resolved.
+func (s *Scanner) saveFindings(ctx context.Context, accountID uuid.UUID, findingTypes []string, raised []*models.Finding, key findingKey) error {
+	var stored []models.Finding
+	for _, findingType := range findingTypes {
+		findings, _, err := s.store.ListFindings(ctx, store.ListFindingFilters{AccountID: &accountID, FindingType: &findingType})
+		if err != nil {
+			return fmt.Errorf("listing previous findings: %w", err)
+		}
+		stored = append(stored, findings...)
+	}
+	byKey := make(map[string]*models.Finding, len(stored))
+	for i := range stored {
+		byKey[key(&stored[i])] = &stored[i]
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	for _, finding := range raised {
+		previous := byKey[key(finding)]
+		if previous == nil || seen[previous.ID] {
+			if err := s.store.CreateFinding(ctx, finding); err != nil {
+				return fmt.Errorf("creating finding: %w", err)
+			}
+			continue
+		}
+		seen[previous.ID] = true
+
+		finding.ID = previous.ID
+		finding.CreatedAt = previous.CreatedAt
+		finding.FirstSeenAt = previous.FirstSeenAt
+		finding.AssignedTo = previous.AssignedTo
+		finding.Status = previous.Status
+		finding.StatusReason = previous.StatusReason
+		finding.ResolvedAt = previous.ResolvedAt
+		if previous.Status == models.FindingStatusResolved {
+			finding.Status = models.FindingStatusOpen
+			finding.StatusReason = ""
+			finding.ResolvedAt = nil
+		}
+		if err := s.store.RefreshFinding(ctx, finding); err != nil {
+			return fmt.Errorf("updating finding: %w", err)
+		}
+	}
+
+	for _, previous := range stored {
+		if seen[previous.ID] {
+			continue
+		}
+		if previous.Status != models.FindingStatusOpen && previous.Status != models.FindingStatusInProgress {
+			continue
+		}
+		if err := s.store.UpdateFindingStatus(ctx, previous.ID, models.FindingStatusResolved, "No longer detected by access analysis"); err != nil {
+			return fmt.Errorf("resolving finding: %w", err)
+		}
+	}
+	return nil
+}
+
+const findingBroadRoleTrust = "BROAD_ROLE_TRUST"
+
+// reportBroadTrust raises a finding for each role trusting an identity
+// provider or external principal more broadly than it should, keyed on the
+// role and the principal it trusts. Roles reaching sensitive data rate HIGH.
+func (s *Scanner) reportBroadTrust(ctx context.Context, account *models.CloudAccount, trusts []access.TrustRelationship) error {
+	var raised []*models.Finding
+	for _, t := range trusts {
+		if !t.Broad() {
+			continue
+		}
+		severity := models.SeverityMedium
+		if len(t.SensitiveAssets) > 0 {
+			severity = models.SeverityHigh
+		}
+		trusted := t.Trusted
+		if t.Provider != "" {
+			trusted = t.Provider + " (" + t.Trusted + ")"
+		}
+		description := fmt.Sprintf("The trust policy of %s allows %s to assume it: %s.",
+			t.RoleARN, trusted, strings.Join(t.Issues, "; "))
+		if len(t.SensitiveAssets) > 0 {
+			description += fmt.Sprintf(" The role can access %d sensitive assets.", len(t.SensitiveAssets))
+		}
+
+		now := time.Now()
+		finding := &models.Finding{
+			ID:          uuid.New(),
+			AccountID:   account.ID,
+			FindingType: findingBroadRoleTrust,
+			Severity:    severity,
+			Title:       fmt.Sprintf("Overly broad trust in role %s", t.RoleARN[strings.LastIndex(t.RoleARN, "/")+1:]),
+			Description: description,
+			Remediation: "Restrict the role's trust policy with conditions on the token subject and audience, or on the principal's organization or account.",
+			Status:      models.FindingStatusOpen,
+			ComplianceFrameworks: []string{
+				"PCI-DSS-7.2", "SOC2-CC6.1", "SOC2-CC6.3",
+			},
+			Evidence: models.JSONB{
+				"role_arn":         t.RoleARN,
+				"kind":             t.Kind,
+				"trusted":          t.Trusted,
+				"provider":         t.Provider,
+				"account_id":       t.AccountID,
+				"subjects":         t.Subjects,
+				"conditions":       t.Conditions,
+				"issues":           t.Issues,
+				"sensitive_assets": t.SensitiveAssets,
+			},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			FirstSeenAt: now,
+			LastSeenAt:  now,
+		}
+		raised = append(raised, finding)
+	}
+	return s.saveFindings(ctx, account.ID, []string{findingBroadRoleTrust}, raised, evidenceKey("role_arn", "kind", "trusted"))
+}
+
+// maxCorrelatedAnomalies bounds the anomalies read for correlation
+const maxCorrelatedAnomalies = 1000
+
+// reportToxicCombinations correlates an access scan with the account's
+// classifications, encryption keys, functions, anomalies and findings, and
+// raises a composite finding for each toxic combination, keyed on the asset
+// and combination. Findings are ranked by risk in their evidence.
+func (s *Scanner) reportToxicCombinations(ctx context.Context, account *models.CloudAccount, conn connectors.Connector, update *access.GraphUpdate) error {
+	input := &correlation.Input{Access: update, KeyManagers: make(map[string]string)}
+
+	keys, err := s.store.ListEncryptionKeys(ctx, account.ID)
+	if err != nil {
+		return fmt.Errorf("listing encryption keys: %w", err)
+	}
+	for _, key := range keys {
+		input.KeyManagers[key.KeyARN] = key.KeyManager
+	}
+
+	if serverless, ok := conn.(connectors.ServerlessConnector); ok {
+		functions, err := serverless.ListFunctions(ctx)
+		if err != nil {
+			s.logger.Error("failed to list functions", "account_id", account.ID, "error", err)
+		}
+		for _, fn := range functions {
+			fnConfig, err := serverless.GetFunctionConfig(ctx, fn.Name)
+			if err != nil {
+				s.logger.Error("failed to read function configuration", "function", fn.Name, "error", err)
+				continue
+			}
+			input.Functions = append(input.Functions, *fnConfig)
+		}
+	}
+
+	anomalies, _, err := s.store.ListAnomalies(ctx, account.ID, nil, nil, maxCorrelatedAnomalies, 0)
+	if err != nil {
+		return fmt.Errorf("listing anomalies: %w", err)
+	}
+	for _, a := range anomalies {
+		if a.Status != anomaly.StatusResolved && a.Status != anomaly.StatusFalsePositive {
+			input.Anomalies = append(input.Anomalies, a)
+		}
+	}
+
+	open := models.FindingStatusOpen
+	input.Findings, _, err = s.store.ListFindings(ctx, store.ListFindingFilters{AccountID: &account.ID, Status: &open})
+	if err != nil {
+		return fmt.Errorf("listing findings: %w", err)
+	}
+
+	combinations := correlation.DefaultRules()
+	findingTypes := make([]string, 0, len(combinations))
+	for _, rule := range combinations {
+		findingTypes = append(findingTypes, rule.FindingType)
+	}
+
+	matches := correlation.Evaluate(combinations, input)
+	now := time.Now()
+	raised := make([]*models.Finding, 0, len(matches))
+	for i := range matches {
+		raised = append(raised, matches[i].Finding(account.ID, i+1, now))
+	}
+	if err := s.saveFindings(ctx, account.ID, findingTypes, raised, evidenceKey()); err != nil {
+		return err
+	}
+
+	s.logger.Info("correlation complete", "account_id", account.ID, "toxic_combinations", len(matches))
+	return nil
+}
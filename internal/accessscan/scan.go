@@ -0,0 +1,171 @@
+// Package accessscan runs access-analysis scans: it reads who can reach an
+// account's data assets, stores the result in the access graph, and raises
+// the least-privilege, role trust and toxic-combination findings derived
+// from it. The API's scan executor runs it.
+package accessscan
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/anomaly"
+	"github.com/qualys/dspm/internal/connectors"
+	awsconn "github.com/qualys/dspm/internal/connectors/aws"
+	azureconn "github.com/qualys/dspm/internal/connectors/azure"
+	gcpconn "github.com/qualys/dspm/internal/connectors/gcp"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/remediation"
+	"github.com/qualys/dspm/internal/store"
+)
+
+// Store is the persistence an access scan reads and writes
+type Store interface {
+	ListAssets(ctx context.Context, filters store.ListAssetFilters) ([]models.DataAsset, int, error)
+	ListCategoryRollups(ctx context.Context, accountID uuid.UUID) ([]store.CategoryRollup, error)
+	UpdateScanJobProgress(ctx context.Context, id uuid.UUID, scanned, findings, classifications int) error
+
+	ListFindings(ctx context.Context, filters store.ListFindingFilters) ([]models.Finding, int, error)
+	CreateFinding(ctx context.Context, finding *models.Finding) error
+	RefreshFinding(ctx context.Context, finding *models.Finding) error
+	UpdateFindingStatus(ctx context.Context, id uuid.UUID, status models.FindingStatus, reason string) error
+
+	CreateRemediationAction(ctx context.Context, action *remediation.Action) error
+	DeletePendingRemediationActions(ctx context.Context, accountID uuid.UUID, actionType remediation.ActionType, source string) error
+
+	ListEncryptionKeys(ctx context.Context, accountID uuid.UUID) ([]*models.EncryptionKey, error)
+	ListAnomalies(ctx context.Context, accountID uuid.UUID, status *anomaly.AnomalyStatus, anomalyType *anomaly.AnomalyType, limit, offset int) ([]anomaly.Anomaly, int, error)
+}
+
+// Scanner runs access-analysis scans
+type Scanner struct {
+	store Store
+	// graph receives the results; without it they are evaluated but not stored
+	graph access.GraphStore
+	// lookback is how far back data events are read for least privilege
+	lookback time.Duration
+	logger   *slog.Logger
+}
+
+// New creates a scanner storing findings in st and access in graph, which may be nil
+func New(st Store, graph access.GraphStore, lookback time.Duration, logger *slog.Logger) *Scanner {
+	return &Scanner{
+		store:    st,
+		graph:    graph,
+		lookback: lookback,
+		logger:   logger,
+	}
+}
+
+// Run scans the access to an account's known assets through conn, which
+// must be validated, and records the result against the scan job jobID
+func (s *Scanner) Run(ctx context.Context, jobID uuid.UUID, account *models.CloudAccount, conn connectors.Connector) error {
+	assets, _, err := s.store.ListAssets(ctx, store.ListAssetFilters{AccountID: &account.ID})
+	if err != nil {
+		return fmt.Errorf("listing assets: %w", err)
+	}
+	scan, err := access.ReadAccountAccess(ctx, conn, account.ExternalID, assets)
+	if err != nil {
+		return err
+	}
+
+	update := access.BuildGraphUpdate(account.ID, scan)
+
+	rollups, err := s.store.ListCategoryRollups(ctx, account.ID)
+	if err != nil {
+		s.logger.Error("failed to roll up classifications", "account_id", account.ID, "error", err)
+	}
+	for _, r := range rollups {
+		update.Classifications = append(update.Classifications, access.ClassificationRollup{
+			AssetID:     r.AssetID,
+			Category:    r.Category,
+			Sensitivity: r.Sensitivity,
+			Count:       r.Count,
+		})
+	}
+
+	s.logger.Info("access scan read",
+		"job_id", jobID,
+		"principals", len(update.Principals),
+		"policies", len(update.Policies),
+		"access_edges", len(update.AccessEdges),
+		"public_assets", len(update.PublicAccess))
+
+	if err := s.store.UpdateScanJobProgress(ctx, jobID, len(scan.Assets), 0, 0); err != nil {
+		s.logger.Error("failed to update scan job progress", "job_id", jobID, "error", err)
+	}
+
+	if trail, ok := conn.(connectors.CloudTrailConnector); ok {
+		if err := s.recommendLeastPrivilege(ctx, account, scan, &access.CloudTrailSource{Connector: trail}); err != nil {
+			s.logger.Error("failed to recommend least-privilege policies", "job_id", jobID, "error", err)
+		}
+	}
+
+	if err := s.reportBroadTrust(ctx, account, update.Trusts); err != nil {
+		s.logger.Error("failed to report broad role trust", "job_id", jobID, "error", err)
+	}
+
+	if err := s.reportToxicCombinations(ctx, account, conn, update); err != nil {
+		s.logger.Error("failed to correlate findings", "job_id", jobID, "error", err)
+	}
+
+	if s.graph == nil {
+		s.logger.Warn("no access graph configured, access scan results not stored", "job_id", jobID)
+		return nil
+	}
+
+	removed, err := s.graph.Apply(ctx, account, update)
+	if err != nil {
+		return fmt.Errorf("updating access graph: %w", err)
+	}
+	s.logger.Info("access graph updated", "job_id", jobID, "stale_removed", removed)
+
+	return nil
+}
+
+// Connect creates the connector for an account of any supported provider
+func Connect(ctx context.Context, account *models.CloudAccount) (connectors.Connector, error) {
+	switch account.Provider {
+	case models.ProviderAWS:
+		cfg := awsconn.Config{
+			Region: configString(account.ConnectorConfig, "region", "us-east-1"),
+		}
+		if roleArn, ok := account.ConnectorConfig["role_arn"].(string); ok {
+			cfg.AssumeRoleARN = roleArn
+		}
+		if extID, ok := account.ConnectorConfig["external_id"].(string); ok {
+			cfg.ExternalID = extID
+		}
+		return awsconn.New(ctx, cfg)
+
+	case models.ProviderAzure:
+		cfg := azureconn.Config{
+			TenantID:       configString(account.ConnectorConfig, "tenant_id", ""),
+			ClientID:       configString(account.ConnectorConfig, "client_id", ""),
+			ClientSecret:   configString(account.ConnectorConfig, "client_secret", ""),
+			SubscriptionID: configString(account.ConnectorConfig, "subscription_id", ""),
+		}
+		return azureconn.New(ctx, cfg)
+
+	case models.ProviderGCP:
+		cfg := gcpconn.Config{
+			ProjectID:       configString(account.ConnectorConfig, "project_id", ""),
+			CredentialsFile: configString(account.ConnectorConfig, "credentials_file", ""),
+		}
+		return gcpconn.New(ctx, cfg)
+
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", account.Provider)
+	}
+}
+
+func configString(cfg models.JSONB, key, defaultVal string) string {
+	if val, ok := cfg[key].(string); ok && val != "" {
+		return val
+	}
+	return defaultVal
+}
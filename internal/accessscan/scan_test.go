@@ -0,0 +1,315 @@
+package accessscan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/anomaly"
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/correlation"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/remediation"
+	"github.com/qualys/dspm/internal/store"
+)
+
+const (
+	readerRole = "arn:aws:iam::111111111111:role/reader"
+	bucketARN  = "arn:aws:s3:::customers"
+)
+
+// fakeStore keeps an account's assets and findings in memory
+type fakeStore struct {
+	assets   []models.DataAsset
+	rollups  []store.CategoryRollup
+	findings []models.Finding
+	actions  []remediation.Action
+	progress int
+}
+
+func (f *fakeStore) ListAssets(ctx context.Context, filters store.ListAssetFilters) ([]models.DataAsset, int, error) {
+	return f.assets, len(f.assets), nil
+}
+
+func (f *fakeStore) ListCategoryRollups(ctx context.Context, accountID uuid.UUID) ([]store.CategoryRollup, error) {
+	return f.rollups, nil
+}
+
+func (f *fakeStore) UpdateScanJobProgress(ctx context.Context, id uuid.UUID, scanned, findings, classifications int) error {
+	f.progress = scanned
+	return nil
+}
+
+func (f *fakeStore) ListFindings(ctx context.Context, filters store.ListFindingFilters) ([]models.Finding, int, error) {
+	var result []models.Finding
+	for _, finding := range f.findings {
+		if filters.Status != nil && finding.Status != *filters.Status {
+			continue
+		}
+		if filters.FindingType != nil && finding.FindingType != *filters.FindingType {
+			continue
+		}
+		result = append(result, finding)
+	}
+	return result, len(result), nil
+}
+
+func (f *fakeStore) CreateFinding(ctx context.Context, finding *models.Finding) error {
+	f.findings = append(f.findings, *finding)
+	return nil
+}
+
+func (f *fakeStore) RefreshFinding(ctx context.Context, finding *models.Finding) error {
+	for i := range f.findings {
+		if f.findings[i].ID == finding.ID {
+			f.findings[i] = *finding
+			return nil
+		}
+	}
+	return fmt.Errorf("finding not found: %s", finding.ID)
+}
+
+func (f *fakeStore) UpdateFindingStatus(ctx context.Context, id uuid.UUID, status models.FindingStatus, reason string) error {
+	for i := range f.findings {
+		if f.findings[i].ID == id {
+			f.findings[i].Status = status
+			f.findings[i].StatusReason = reason
+			return nil
+		}
+	}
+	return fmt.Errorf("finding not found: %s", id)
+}
+
+func (f *fakeStore) CreateRemediationAction(ctx context.Context, action *remediation.Action) error {
+	f.actions = append(f.actions, *action)
+	return nil
+}
+
+func (f *fakeStore) DeletePendingRemediationActions(ctx context.Context, accountID uuid.UUID, actionType remediation.ActionType, source string) error {
+	return nil
+}
+
+func (f *fakeStore) ListEncryptionKeys(ctx context.Context, accountID uuid.UUID) ([]*models.EncryptionKey, error) {
+	return nil, nil
+}
+
+func (f *fakeStore) ListAnomalies(ctx context.Context, accountID uuid.UUID, status *anomaly.AnomalyStatus, anomalyType *anomaly.AnomalyType, limit, offset int) ([]anomaly.Anomaly, int, error) {
+	return nil, 0, nil
+}
+
+// fakeConnector serves fixed authorization details
+type fakeConnector struct {
+	details *connectors.AuthorizationDetails
+}
+
+func (c *fakeConnector) Provider() models.Provider          { return models.ProviderAWS }
+func (c *fakeConnector) Validate(ctx context.Context) error { return nil }
+func (c *fakeConnector) Close() error                       { return nil }
+func (c *fakeConnector) GetAuthorizationDetails(ctx context.Context) (*connectors.AuthorizationDetails, error) {
+	return c.details, nil
+}
+
+// scanFixture is an account with a bucket of critical PII that a role
+// anyone can assume reads
+func scanFixture() (*models.CloudAccount, *fakeStore, *fakeConnector) {
+	account := &models.CloudAccount{ID: uuid.New(), Provider: models.ProviderAWS, ExternalID: "111111111111"}
+	customers := models.DataAsset{
+		ID:               uuid.New(),
+		AccountID:        account.ID,
+		ResourceARN:      bucketARN,
+		Name:             "customers",
+		ResourceType:     models.ResourceTypeS3Bucket,
+		SensitivityLevel: models.SensitivityCritical,
+	}
+	st := &fakeStore{
+		assets: []models.DataAsset{customers},
+		rollups: []store.CategoryRollup{
+			{AssetID: customers.ID, Category: models.CategoryPII, Sensitivity: models.SensitivityCritical, Count: 25},
+		},
+	}
+	conn := &fakeConnector{details: &connectors.AuthorizationDetails{Roles: []connectors.PrincipalDetails{{
+		Principal: connectors.Principal{ARN: readerRole, Name: "reader", Type: "ROLE"},
+		InlinePolicies: map[string]*connectors.PolicyDocument{"read": {Statements: []connectors.PolicyStatement{{
+			Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{bucketARN + "/*"},
+		}}}},
+		TrustPolicy: &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{{
+			Effect: "Allow", Actions: []string{"sts:AssumeRole"}, Principals: []string{"*"},
+		}}},
+	}}}}
+	return account, st, conn
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	account, st, conn := scanFixture()
+	graph, err := access.NewMemoryGraph(ctx, nil)
+	if err != nil {
+		t.Fatalf("NewMemoryGraph: %v", err)
+	}
+	scanner := New(st, graph, 90*24*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := scanner.Run(ctx, uuid.New(), account, conn); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if st.progress != 1 {
+		t.Errorf("expected 1 asset scanned, got %d", st.progress)
+	}
+
+	reachable, err := graph.FindBlastRadius(ctx, readerRole, 3)
+	if err != nil {
+		t.Fatalf("FindBlastRadius: %v", err)
+	}
+	if len(reachable) != 1 || reachable[0].AssetARN != bucketARN {
+		t.Errorf("expected reader to reach customers, got %+v", reachable)
+	}
+
+	var trust *models.Finding
+	for i := range st.findings {
+		if st.findings[i].FindingType == findingBroadRoleTrust {
+			trust = &st.findings[i]
+		}
+	}
+	if trust == nil {
+		t.Fatalf("expected a broad trust finding, got %+v", st.findings)
+	}
+	if trust.Severity != models.SeverityHigh || trust.Evidence["role_arn"] != readerRole {
+		t.Errorf("expected a HIGH finding for reader, got %s for %v", trust.Severity, trust.Evidence["role_arn"])
+	}
+
+	// Rescanning keeps the finding and its triage
+	trust.Status = models.FindingStatusSuppressed
+	id := trust.ID
+	if err := scanner.Run(ctx, uuid.New(), account, conn); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var trusts []models.Finding
+	for _, finding := range st.findings {
+		if finding.FindingType == findingBroadRoleTrust {
+			trusts = append(trusts, finding)
+		}
+	}
+	if len(trusts) != 1 || trusts[0].ID != id || trusts[0].Status != models.FindingStatusSuppressed {
+		t.Errorf("expected the suppressed finding %s to be kept, got %+v", id, trusts)
+	}
+}
+
+func TestSaveFindings(t *testing.T) {
+	ctx := context.Background()
+	account, st, _ := scanFixture()
+	scanner := New(st, nil, 90*24*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	assetID := st.assets[0].ID
+
+	raise := func(principals ...string) []*models.Finding {
+		var findings []*models.Finding
+		for _, principal := range principals {
+			findings = append(findings, &models.Finding{
+				ID:          uuid.New(),
+				AccountID:   account.ID,
+				AssetID:     &assetID,
+				FindingType: findingUnusedDataAccess,
+				Severity:    models.SeverityMedium,
+				Status:      models.FindingStatusOpen,
+				Evidence:    models.JSONB{"principal_arn": principal},
+			})
+		}
+		return findings
+	}
+	save := func(findings []*models.Finding) {
+		t.Helper()
+		if err := scanner.saveFindings(ctx, account.ID, []string{findingUnusedDataAccess}, findings, evidenceKey("principal_arn")); err != nil {
+			t.Fatalf("saveFindings: %v", err)
+		}
+	}
+	status := func(principal string) models.FindingStatus {
+		for _, finding := range st.findings {
+			if finding.Evidence["principal_arn"] == principal {
+				return finding.Status
+			}
+		}
+		return ""
+	}
+
+	const writer = "arn:aws:iam::111111111111:role/writer"
+	first := raise(readerRole, writer)
+	save(first)
+
+	// Triage survives a rescan that raises the finding again
+	st.findings[0].Status = models.FindingStatusInProgress
+	st.findings[0].AssignedTo = "analyst@example.com"
+	again := raise(readerRole)
+	save(again)
+
+	if len(st.findings) != 2 {
+		t.Fatalf("expected 2 findings, got %d", len(st.findings))
+	}
+	if again[0].ID != first[0].ID {
+		t.Errorf("expected the finding to keep ID %s, got %s", first[0].ID, again[0].ID)
+	}
+	if st.findings[0].Status != models.FindingStatusInProgress || st.findings[0].AssignedTo != "analyst@example.com" {
+		t.Errorf("expected triage to be kept, got status %s assigned to %q", st.findings[0].Status, st.findings[0].AssignedTo)
+	}
+	if status(writer) != models.FindingStatusResolved {
+		t.Errorf("expected the finding no longer raised to be resolved, got %s", status(writer))
+	}
+
+	// A resolved finding raised again is reopened under its old ID
+	save(raise(readerRole, writer))
+	if len(st.findings) != 2 || status(writer) != models.FindingStatusOpen {
+		t.Errorf("expected the writer finding to be reopened, got %d findings and status %s", len(st.findings), status(writer))
+	}
+}
+
+func TestRun_KeepsToxicCombinations(t *testing.T) {
+	ctx := context.Background()
+	account, st, conn := scanFixture()
+	// The reader role anyone can assume makes the unencrypted PII public
+	st.assets[0].EncryptionStatus = models.EncryptionNone
+	scanner := New(st, nil, 90*24*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	toxic := func() []models.Finding {
+		var findings []models.Finding
+		for _, finding := range st.findings {
+			if finding.FindingType == correlation.FindingPublicUnprotectedPII {
+				findings = append(findings, finding)
+			}
+		}
+		return findings
+	}
+
+	if err := scanner.Run(ctx, uuid.New(), account, conn); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	first := toxic()
+	if len(first) != 1 {
+		t.Fatalf("expected a toxic combination for customers, got %+v", first)
+	}
+
+	for i := range st.findings {
+		if st.findings[i].ID == first[0].ID {
+			st.findings[i].Status = models.FindingStatusInProgress
+		}
+	}
+	if err := scanner.Run(ctx, uuid.New(), account, conn); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	again := toxic()
+	if len(again) != 1 || again[0].ID != first[0].ID || again[0].Status != models.FindingStatusInProgress {
+		t.Errorf("expected finding %s to be kept in progress, got %+v", first[0].ID, again)
+	}
+
+	// Once the PII is gone the combination is resolved
+	st.rollups = nil
+	if err := scanner.Run(ctx, uuid.New(), account, conn); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if closed := toxic(); len(closed) != 1 || closed[0].Status != models.FindingStatusResolved {
+		t.Errorf("expected the combination to be resolved, got %+v", closed)
+	}
+}
@@ -207,6 +207,15 @@ func (s *Service) calculateModelRisk(ctx context.Context, model *models.AIModel)
 		}
 	}
 
+	// Check for GDPR special category data
+	for _, data := range trainingData {
+		if hasSpecialCategory(data.SensitivityCategories) {
+			summary.RiskScore += 25
+			summary.RiskFactors = append(summary.RiskFactors, "Accessing GDPR special category data")
+			break
+		}
+	}
+
 	// Get recent events
 	events, _ := s.store.ListAIProcessingEventsByModel(ctx, model.ID)
 	if len(events) > 0 {
@@ -251,9 +260,27 @@ func (s *Service) generateRecommendations(report *AIRiskReport) []string {
 			"Ensure HIPAA compliance for AI models processing protected health information")
 	}
 
+	for _, category := range models.SpecialCategories {
+		if report.RiskByCategory[string(category)] > 0 {
+			recommendations = append(recommendations,
+				"Confirm an Article 9 condition such as explicit consent for AI models processing GDPR special category data")
+			break
+		}
+	}
+
 	return recommendations
 }
 
+// hasSpecialCategory reports whether categories include a GDPR special category
+func hasSpecialCategory(categories []string) bool {
+	for _, category := range categories {
+		if models.Category(category).IsSpecial() {
+			return true
+		}
+	}
+	return false
+}
+
 // GetModelTrainingDataAnalysis analyzes training data for a specific model
 func (s *Service) GetModelTrainingDataAnalysis(ctx context.Context, modelID uuid.UUID) (*TrainingDataAnalysis, error) {
 	trainingData, err := s.store.GetAITrainingDataByModel(ctx, modelID)
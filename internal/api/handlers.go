@@ -10,6 +10,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"github.com/qualys/dspm/internal/auth"
 	"github.com/qualys/dspm/internal/models"
 	"github.com/qualys/dspm/internal/store"
 )
@@ -262,6 +263,9 @@ func (s *Server) getAssetClassifications(w http.ResponseWriter, r *http.Request)
 		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
 		return
 	}
+	for i := range classifications {
+		stripSealedOriginals(&classifications[i])
+	}
 
 	respondJSON(w, http.StatusOK, classifications)
 }
@@ -286,6 +290,9 @@ func (s *Server) listAllClassifications(w http.ResponseWriter, r *http.Request)
 		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
 		return
 	}
+	for i := range classifications {
+		stripSealedOriginals(&classifications[i].Classification)
+	}
 
 	respondJSONWithMeta(w, http.StatusOK, classifications, &apiMeta{
 		Total:  total,
@@ -294,6 +301,133 @@ func (s *Server) listAllClassifications(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// stripSealedOriginals drops encrypted originals from a listed classification's
+// samples; reviewers read them through getClassificationOriginals
+func stripSealedOriginals(classification *models.Classification) {
+	samples, _ := classification.SampleMatches["samples"].([]interface{})
+	for _, raw := range samples {
+		if sample, ok := raw.(map[string]interface{}); ok {
+			delete(sample, "sealed_original")
+		}
+	}
+}
+
+// reviewerRoles are the roles allowed to view encrypted original sample values
+func (s *Server) reviewerRoles() []auth.Role {
+	roles := make([]auth.Role, 0, len(s.cfg.Redaction.ReviewerRoles))
+	for _, role := range s.cfg.Redaction.ReviewerRoles {
+		roles = append(roles, auth.Role(role))
+	}
+	return roles
+}
+
+type originalSample struct {
+	Line     interface{} `json:"line"`
+	Column   interface{} `json:"column,omitempty"`
+	Masked   interface{} `json:"masked_value"`
+	Original string      `json:"original_value"`
+}
+
+// getClassificationOriginals decrypts the original values kept for a classification's
+// samples. Each access must give a reason and is recorded in the sample access log.
+func (s *Server) getClassificationOriginals(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "classificationID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_id", "Invalid classification ID")
+		return
+	}
+
+	reason := strings.TrimSpace(r.URL.Query().Get("reason"))
+	if reason == "" {
+		respondError(w, http.StatusBadRequest, "validation_error", "reason is required to view original values")
+		return
+	}
+
+	if s.redactionPolicy == nil || s.redactionPolicy.Sealer == nil {
+		respondError(w, http.StatusNotFound, "not_configured", "Original values are not stored (redaction.encryption_key is not set)")
+		return
+	}
+
+	classification, err := s.store.GetClassification(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
+		return
+	}
+	if classification == nil {
+		respondError(w, http.StatusNotFound, "not_found", "Classification not found")
+		return
+	}
+
+	samples, _ := classification.SampleMatches["samples"].([]interface{})
+	originals := make([]originalSample, 0, len(samples))
+	for _, raw := range samples {
+		sample, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		sealed, _ := sample["sealed_original"].(string)
+		if sealed == "" {
+			continue
+		}
+		original, err := s.redactionPolicy.Sealer.Open(sealed, classification.ID.String())
+		if err != nil {
+			s.logger.Error("failed to decrypt sample original", "classification_id", id, "error", err)
+			respondError(w, http.StatusInternalServerError, "decryption_error", "Failed to decrypt original values")
+			return
+		}
+		originals = append(originals, originalSample{
+			Line:     sample["line"],
+			Column:   sample["column"],
+			Masked:   sample["value"],
+			Original: original,
+		})
+	}
+
+	if len(originals) == 0 {
+		respondError(w, http.StatusNotFound, "not_found", "No original values are stored for this classification")
+		return
+	}
+
+	claims, _ := auth.GetUserFromContext(r.Context())
+	entry := &models.SampleAccessLog{
+		ClassificationID: id,
+		UserID:           claims.UserID,
+		UserEmail:        claims.Email,
+		UserRole:         string(claims.Role),
+		Reason:           reason,
+		SampleCount:      len(originals),
+	}
+	// Originals are only returned once the access has been recorded
+	if err := s.store.LogSampleAccess(r.Context(), entry); err != nil {
+		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
+		return
+	}
+	s.logger.Info("original sample values accessed", "classification_id", id, "user", claims.Email, "samples", len(originals))
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"classification_id": id,
+		"rule_name":         classification.RuleName,
+		"object_path":       classification.ObjectPath,
+		"samples":           originals,
+		"access_id":         entry.ID,
+	})
+}
+
+func (s *Server) getSampleAccessLog(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "classificationID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_id", "Invalid classification ID")
+		return
+	}
+
+	entries, err := s.store.ListSampleAccessLog(r.Context(), &id, 100)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, entries)
+}
+
 func (s *Server) listFindings(w http.ResponseWriter, r *http.Request) {
 	filters := store.ListFindingFilters{
 		Limit:  100,
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/remediation"
+	"github.com/qualys/dspm/internal/store"
+)
+
+const defaultBlastRadiusHops = 5
+
+// blastRadiusResponse lists what a principal can reach, or who can reach an
+// asset, with the shortest assumption path for each pair
+type blastRadiusResponse struct {
+	Principal string                   `json:"principal,omitempty"`
+	Asset     string                   `json:"asset,omitempty"`
+	MaxHops   int                      `json:"max_hops"`
+	Reachable []access.ReachableAccess `json:"reachable"`
+	Total     int                      `json:"total"`
+}
+
+func (s *Server) getBlastRadius(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	principal := r.URL.Query().Get("principal")
+	asset := r.URL.Query().Get("asset")
+	if (principal == "") == (asset == "") {
+		respondError(w, http.StatusBadRequest, "invalid_param", "exactly one of principal or asset is required")
+		return
+	}
+
+	maxHops := defaultBlastRadiusHops
+	if hopsStr := r.URL.Query().Get("max_hops"); hopsStr != "" {
+		parsed, err := strconv.Atoi(hopsStr)
+		if err != nil || parsed < 0 {
+			respondError(w, http.StatusBadRequest, "invalid_param", "max_hops must be a non-negative integer")
+			return
+		}
+		maxHops = parsed
+	}
+
+	if s.graph == nil {
+		respondError(w, http.StatusServiceUnavailable, "graph_unavailable", "access graph is not configured")
+		return
+	}
+
+	resp := blastRadiusResponse{MaxHops: maxHops}
+	var err error
+	if principal != "" {
+		// Session credentials resolve to the role they were issued for
+		resp.Principal = access.PrincipalForCredential(principal)
+		resp.Reachable, err = s.graph.FindBlastRadius(ctx, resp.Principal, maxHops)
+	} else {
+		resp.Asset = asset
+		resp.Reachable, err = s.graph.FindPrincipalsReaching(ctx, asset, maxHops)
+	}
+	if err != nil {
+		s.logger.Error("failed to compute blast radius", "error", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to compute blast radius")
+		return
+	}
+	if resp.Reachable == nil {
+		resp.Reachable = []access.ReachableAccess{}
+	}
+	resp.Total = len(resp.Reachable)
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// maxGraphImportSize bounds the snapshots accepted by importAccessGraph
+const maxGraphImportSize = 256 << 20
+
+// graphContentTypes are the media types of the graph export formats
+var graphContentTypes = map[string]string{
+	access.FormatJSON:    "application/json",
+	access.FormatGraphML: "application/graphml+xml",
+	access.FormatCypher:  "text/plain; charset=utf-8",
+}
+
+// exportAccessGraph returns the access graph, optionally scoped to an
+// account and a sensitivity floor, as node-link JSON, GraphML or Cypher
+func (s *Server) exportAccessGraph(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = access.FormatJSON
+	}
+	contentType, ok := graphContentTypes[format]
+	if !ok {
+		respondError(w, http.StatusBadRequest, "invalid_format", "format must be json, graphml or cypher")
+		return
+	}
+
+	var filter access.ExportFilter
+	if accountID := r.URL.Query().Get("account_id"); accountID != "" {
+		id, err := uuid.Parse(accountID)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "invalid_param", "account_id must be a UUID")
+			return
+		}
+		filter.AccountID = &id
+	}
+	filter.MinSensitivity = models.Sensitivity(r.URL.Query().Get("min_sensitivity"))
+	if err := filter.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_param", err.Error())
+		return
+	}
+
+	if s.graph == nil {
+		respondError(w, http.StatusServiceUnavailable, "graph_unavailable", "access graph is not configured")
+		return
+	}
+
+	snapshot, err := s.graph.Export(r.Context(), filter)
+	if err != nil {
+		s.logger.Error("failed to export access graph", "error", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to export access graph")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=access-graph."+format)
+	w.WriteHeader(http.StatusOK)
+	if err := snapshot.Write(w, format); err != nil {
+		s.logger.Error("failed to write access graph export", "error", err)
+	}
+}
+
+// importAccessGraph merges a JSON or GraphML snapshot into the access graph
+func (s *Server) importAccessGraph(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = access.FormatJSON
+	}
+	if format != access.FormatJSON && format != access.FormatGraphML {
+		respondError(w, http.StatusBadRequest, "invalid_format", "format must be json or graphml")
+		return
+	}
+
+	if s.graph == nil {
+		respondError(w, http.StatusServiceUnavailable, "graph_unavailable", "access graph is not configured")
+		return
+	}
+
+	snapshot, err := access.ReadSnapshot(io.LimitReader(r.Body, maxGraphImportSize), format)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_snapshot", err.Error())
+		return
+	}
+	if err := s.graph.Import(r.Context(), snapshot); err != nil {
+		s.logger.Error("failed to import access graph", "error", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to import access graph")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"nodes": len(snapshot.Nodes),
+		"links": len(snapshot.Links),
+	})
+}
+
+// simulateAccessRequest proposes a bucket or identity policy change. A
+// bucket change names asset_arn and one of bucket_policy,
+// remove_bucket_policy or public_access_block; an identity policy change
+// sets policy_document with policy_arn, or principal_arn and policy_name for
+// an inline policy. Documents may be JSON objects or strings.
+type simulateAccessRequest struct {
+	AccountID          uuid.UUID                 `json:"account_id"`
+	AssetARN           string                    `json:"asset_arn"`
+	BucketPolicy       json.RawMessage           `json:"bucket_policy"`
+	RemoveBucketPolicy bool                      `json:"remove_bucket_policy"`
+	PublicAccessBlock  *publicAccessBlockRequest `json:"public_access_block"`
+	PolicyARN          string                    `json:"policy_arn"`
+	PrincipalARN       string                    `json:"principal_arn"`
+	PolicyName         string                    `json:"policy_name"`
+	PolicyDocument     json.RawMessage           `json:"policy_document"`
+}
+
+type publicAccessBlockRequest struct {
+	BlockPublicAcls       bool `json:"block_public_acls"`
+	IgnorePublicAcls      bool `json:"ignore_public_acls"`
+	BlockPublicPolicy     bool `json:"block_public_policy"`
+	RestrictPublicBuckets bool `json:"restrict_public_buckets"`
+}
+
+// simulateAccess reports how a proposed policy change would change
+// effective access to the account's sensitive assets, against its policies
+// as they are now
+func (s *Server) simulateAccess(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req simulateAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+
+	change := access.ProposedChange{
+		AssetARN:           req.AssetARN,
+		RemoveBucketPolicy: req.RemoveBucketPolicy,
+		PolicyARN:          req.PolicyARN,
+		PrincipalARN:       req.PrincipalARN,
+		PolicyName:         req.PolicyName,
+	}
+	var err error
+	if change.BucketPolicy, err = parseSimulatedPolicy(req.BucketPolicy); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_policy", err.Error())
+		return
+	}
+	if change.IdentityPolicy, err = parseSimulatedPolicy(req.PolicyDocument); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_policy", err.Error())
+		return
+	}
+	if b := req.PublicAccessBlock; b != nil {
+		change.PublicAccessBlock = &connectors.PublicAccessBlockConfig{
+			BlockPublicAcls:       b.BlockPublicAcls,
+			IgnorePublicAcls:      b.IgnorePublicAcls,
+			BlockPublicPolicy:     b.BlockPublicPolicy,
+			RestrictPublicBuckets: b.RestrictPublicBuckets,
+		}
+	}
+	if err := change.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_change", err.Error())
+		return
+	}
+
+	account, err := s.store.GetAccount(ctx, req.AccountID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "not_found", "account not found")
+		return
+	}
+	scan, classifications, err := s.readAccountAccess(ctx, account)
+	if err != nil {
+		s.logger.Error("failed to read account access", "error", err, "account_id", account.ID)
+		respondError(w, http.StatusBadGateway, "account_unreadable", "failed to read the account's policies")
+		return
+	}
+
+	simulation, err := access.Simulate(scan, change, classifications)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_change", err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, simulation)
+}
+
+// parseSimulatedPolicy parses a policy document given as a JSON object or a
+// string holding one. An absent document is nil.
+func parseSimulatedPolicy(raw json.RawMessage) (*connectors.PolicyDocument, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	document := string(raw)
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &document); err != nil {
+			return nil, err
+		}
+	}
+	return connectors.ParsePolicyDocument(document)
+}
+
+// readAccountAccess reads an account's policies live, since the graph does
+// not keep policy documents in a form that can be re-evaluated, along with
+// the classifications of its assets
+func (s *Server) readAccountAccess(ctx context.Context, account *models.CloudAccount) (*access.AccountAccess, []access.ClassificationRollup, error) {
+	conn, err := s.scanExecutor.connect(ctx, account)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating connector: %w", err)
+	}
+	defer conn.Close()
+	assets, _, err := s.store.ListAssets(ctx, store.ListAssetFilters{AccountID: &account.ID})
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing assets: %w", err)
+	}
+	scan, err := access.ReadAccountAccess(ctx, conn, account.ExternalID, assets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rollups, err := s.store.ListCategoryRollups(ctx, account.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rolling up classifications: %w", err)
+	}
+	classifications := make([]access.ClassificationRollup, 0, len(rollups))
+	for _, r := range rollups {
+		classifications = append(classifications, access.ClassificationRollup{
+			AssetID:     r.AssetID,
+			Category:    r.Category,
+			Sensitivity: r.Sensitivity,
+			Count:       r.Count,
+		})
+	}
+	return scan, classifications, nil
+}
+
+// remediationActionResponse is a remediation action with, while it awaits
+// approval, the simulated effect of the policy change it makes
+type remediationActionResponse struct {
+	*remediation.Action
+	Simulation      *access.Simulation `json:"simulation,omitempty"`
+	SimulationError string             `json:"simulation_error,omitempty"`
+}
+
+// simulateRemediation simulates a pending BLOCK_PUBLIC_ACCESS or
+// RESTRICT_IAM_POLICY action. Other actions are returned as they are, and a
+// failed simulation is reported alongside the action rather than failing
+// the request.
+func (s *Server) simulateRemediation(ctx context.Context, action *remediation.Action) *remediationActionResponse {
+	resp := &remediationActionResponse{Action: action}
+	if action.Status != remediation.StatusPending {
+		return resp
+	}
+
+	var change access.ProposedChange
+	switch action.ActionType {
+	case remediation.ActionBlockPublicAccess:
+		bucketName, _ := action.Parameters["bucket_name"].(string)
+		change.AssetARN = "arn:aws:s3:::" + bucketName
+		change.PublicAccessBlock = &connectors.PublicAccessBlockConfig{
+			BlockPublicAcls:       true,
+			IgnorePublicAcls:      true,
+			BlockPublicPolicy:     true,
+			RestrictPublicBuckets: true,
+		}
+	case remediation.ActionRestrictIAMPolicy:
+		change.PolicyARN, _ = action.Parameters["policy_arn"].(string)
+		change.PrincipalARN, _ = action.Parameters["principal_arn"].(string)
+		change.PolicyName, _ = action.Parameters["policy_name"].(string)
+		document, _ := action.Parameters["new_policy_document"].(string)
+		policy, err := connectors.ParsePolicyDocument(document)
+		if err != nil {
+			resp.SimulationError = err.Error()
+			return resp
+		}
+		change.IdentityPolicy = policy
+	default:
+		return resp
+	}
+
+	account, err := s.store.GetAccount(ctx, action.AccountID)
+	if err != nil {
+		resp.SimulationError = "account not found"
+		return resp
+	}
+	scan, classifications, err := s.readAccountAccess(ctx, account)
+	if err != nil {
+		s.logger.Error("failed to read account access", "error", err, "account_id", account.ID)
+		resp.SimulationError = "failed to read the account's policies"
+		return resp
+	}
+	if resp.Simulation, err = access.Simulate(scan, change, classifications); err != nil {
+		resp.SimulationError = err.Error()
+	}
+	return resp
+}
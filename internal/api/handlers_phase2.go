@@ -1,15 +1,20 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/auth"
 	"github.com/qualys/dspm/internal/lineage"
 	"github.com/qualys/dspm/internal/mlclassifier"
 	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/notifications"
 	"github.com/qualys/dspm/internal/remediation"
 )
 
@@ -195,6 +200,142 @@ func (s *Server) getMLModel(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, model)
 }
 
+// respondModelLifecycleError maps model registry errors onto HTTP statuses
+func respondModelLifecycleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, mlclassifier.ErrModelNotFound):
+		respondError(w, http.StatusNotFound, "not_found", "ML model not found")
+	case errors.Is(err, mlclassifier.ErrInvalidTransition):
+		respondError(w, http.StatusConflict, "invalid_transition", err.Error())
+	case errors.Is(err, mlclassifier.ErrNoPreviousVersion):
+		respondError(w, http.StatusConflict, "no_previous_version", err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
+// promotionGate reads optional min_labeled and margin overrides of the
+// configured promotion gate from the query string
+func (s *Server) promotionGate(r *http.Request) (mlclassifier.PromotionGate, error) {
+	gate := s.mlClassifier.PromotionGate()
+	if v := r.URL.Query().Get("min_labeled"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return gate, errors.New("min_labeled must be a non-negative integer")
+		}
+		gate.MinLabeled = n
+	}
+	if v := r.URL.Query().Get("margin"); v != "" {
+		m, err := strconv.ParseFloat(v, 64)
+		if err != nil || m < 0 || m > 1 {
+			return gate, errors.New("margin must be between 0 and 1")
+		}
+		gate.Margin = m
+	}
+	return gate, nil
+}
+
+func (s *Server) shadowMLModel(w http.ResponseWriter, r *http.Request) {
+	modelID, err := uuid.Parse(chi.URLParam(r, "modelID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_param", "invalid modelID format")
+		return
+	}
+
+	model, err := s.mlClassifier.ShadowModel(r.Context(), modelID)
+	if err != nil {
+		s.logger.Error("failed to shadow ML model", "error", err, "modelID", modelID)
+		respondModelLifecycleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, model)
+}
+
+func (s *Server) evaluateMLModel(w http.ResponseWriter, r *http.Request) {
+	modelID, err := uuid.Parse(chi.URLParam(r, "modelID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_param", "invalid modelID format")
+		return
+	}
+	gate, err := s.promotionGate(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_param", err.Error())
+		return
+	}
+
+	eval, err := s.mlClassifier.EvaluateShadow(r.Context(), modelID, gate)
+	if err != nil {
+		s.logger.Error("failed to evaluate ML model", "error", err, "modelID", modelID)
+		respondModelLifecycleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, eval)
+}
+
+func (s *Server) promoteMLModel(w http.ResponseWriter, r *http.Request) {
+	modelID, err := uuid.Parse(chi.URLParam(r, "modelID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_param", "invalid modelID format")
+		return
+	}
+	gate, err := s.promotionGate(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_param", err.Error())
+		return
+	}
+
+	eval, err := s.mlClassifier.PromoteModel(r.Context(), modelID, gate)
+	if errors.Is(err, mlclassifier.ErrPromotionBlocked) {
+		// The evaluation shows what the shadow model fell short on
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(apiResponse{
+			Success: false,
+			Data:    eval,
+			Error:   &apiError{Code: "promotion_blocked", Message: err.Error()},
+		})
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to promote ML model", "error", err, "modelID", modelID)
+		respondModelLifecycleError(w, err)
+		return
+	}
+
+	model, err := s.store.GetMLModel(r.Context(), modelID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to load promoted model")
+		return
+	}
+	s.logger.Info("promoted ML model", "modelID", modelID, "type", model.ModelType, "version", model.Version)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"model":      model,
+		"evaluation": eval,
+	})
+}
+
+func (s *Server) rollbackMLModel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ModelType models.MLModelType `json:"model_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ModelType == "" {
+		respondError(w, http.StatusBadRequest, "invalid_request", "model_type is required")
+		return
+	}
+
+	model, err := s.mlClassifier.RollbackModel(r.Context(), req.ModelType)
+	if err != nil {
+		s.logger.Error("failed to roll back ML model", "error", err, "type", req.ModelType)
+		respondModelLifecycleError(w, err)
+		return
+	}
+	s.logger.Info("rolled back ML model", "type", model.ModelType, "version", model.Version)
+
+	respondJSON(w, http.StatusOK, model)
+}
+
 func (s *Server) getReviewQueue(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -231,15 +372,47 @@ func (s *Server) getReviewItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	item, err := s.store.GetReviewQueueItem(ctx, itemID)
-	if err != nil {
-		s.logger.Error("failed to get review item", "error", err, "itemID", itemID)
+	if err != nil || item == nil {
+		if err != nil {
+			s.logger.Error("failed to get review item", "error", err, "itemID", itemID)
+		}
 		respondError(w, http.StatusNotFound, "not_found", "review item not found")
 		return
 	}
+	// The second reviewer decides independently of the first
+	if item.Status != models.ReviewQueueStatusResolved {
+		item.FirstResolution = ""
+	}
 
 	respondJSON(w, http.StatusOK, item)
 }
 
+// reviewerID returns the authenticated user's ID, or uuid.Nil
+func reviewerID(r *http.Request) uuid.UUID {
+	claims, _ := auth.GetUserFromContext(r.Context())
+	if claims == nil {
+		return uuid.Nil
+	}
+	id, _ := uuid.Parse(claims.UserID)
+	return id
+}
+
+// respondReviewError maps review workflow errors onto HTTP statuses
+func respondReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, mlclassifier.ErrReviewItemNotFound):
+		respondError(w, http.StatusNotFound, "not_found", "review item not found")
+	case errors.Is(err, mlclassifier.ErrInvalidResolution),
+		errors.Is(err, mlclassifier.ErrInvalidBulkResolution),
+		errors.Is(err, mlclassifier.ErrInvalidRoutingRule):
+		respondError(w, http.StatusBadRequest, "invalid_request", err.Error())
+	case errors.Is(err, mlclassifier.ErrReviewItemResolved), errors.Is(err, mlclassifier.ErrSameReviewer):
+		respondError(w, http.StatusConflict, "review_conflict", err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
 func (s *Server) resolveReviewItem(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -256,16 +429,124 @@ func (s *Server) resolveReviewItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req.ItemID = itemID
+	if req.ReviewedBy == uuid.Nil {
+		req.ReviewedBy = reviewerID(r)
+	}
 
-	if err := s.mlClassifier.ResolveReviewItem(ctx, &req); err != nil {
+	item, err := s.mlClassifier.ResolveReviewItem(ctx, &req)
+	if err != nil {
 		s.logger.Error("failed to resolve review item", "error", err, "itemID", itemID)
-		respondError(w, http.StatusInternalServerError, "internal_error", "failed to resolve review item")
+		respondReviewError(w, err)
 		return
 	}
+	if item.Status != models.ReviewQueueStatusResolved {
+		item.FirstResolution = ""
+	}
 
-	respondJSON(w, http.StatusOK, map[string]string{
-		"message": "Review item resolved",
-	})
+	respondJSON(w, http.StatusOK, item)
+}
+
+func (s *Server) bulkResolveReviewItems(w http.ResponseWriter, r *http.Request) {
+	var req mlclassifier.BulkResolution
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	if req.ReviewedBy == uuid.Nil {
+		req.ReviewedBy = reviewerID(r)
+	}
+
+	result, err := s.mlClassifier.BulkResolveReviewItems(r.Context(), &req)
+	if err != nil {
+		s.logger.Error("failed to bulk resolve review items", "error", err, "rule", req.RuleName)
+		respondReviewError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) listReviewRoutingRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.mlClassifier.ListRoutingRules(r.Context())
+	if err != nil {
+		s.logger.Error("failed to list review routing rules", "error", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to list review routing rules")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) createReviewRoutingRule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string          `json:"name"`
+		Priority  int             `json:"priority"`
+		AccountID *uuid.UUID      `json:"account_id,omitempty"`
+		Category  models.Category `json:"category,omitempty"`
+		DataOwner string          `json:"data_owner,omitempty"`
+		Assignees []string        `json:"assignees"`
+		SLAHours  int             `json:"sla_hours,omitempty"`
+		Enabled   *bool           `json:"enabled,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+
+	rule := &models.ReviewRoutingRule{
+		Name:      req.Name,
+		Priority:  req.Priority,
+		AccountID: req.AccountID,
+		Category:  req.Category,
+		DataOwner: req.DataOwner,
+		Assignees: req.Assignees,
+		SLAHours:  req.SLAHours,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+	}
+	if err := s.mlClassifier.CreateRoutingRule(r.Context(), rule); err != nil {
+		s.logger.Error("failed to create review routing rule", "error", err)
+		respondReviewError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Server) deleteReviewRoutingRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := uuid.Parse(chi.URLParam(r, "ruleID"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_param", "invalid ruleID format")
+		return
+	}
+
+	if err := s.mlClassifier.DeleteRoutingRule(r.Context(), ruleID); err != nil {
+		s.logger.Error("failed to delete review routing rule", "error", err, "ruleID", ruleID)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to delete review routing rule")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (s *Server) getReviewMetrics(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondError(w, http.StatusBadRequest, "invalid_param", "days must be a positive integer")
+			return
+		}
+		days = n
+	}
+
+	metrics, err := s.mlClassifier.ReviewMetrics(r.Context(), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		s.logger.Error("failed to compute review metrics", "error", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to compute review metrics")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, metrics)
 }
 
 func (s *Server) assignReviewItem(w http.ResponseWriter, r *http.Request) {
@@ -287,12 +568,14 @@ func (s *Server) assignReviewItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	item, err := s.store.GetReviewQueueItem(ctx, itemID)
-	if err != nil {
+	if err != nil || item == nil {
 		respondError(w, http.StatusNotFound, "not_found", "review item not found")
 		return
 	}
 
+	now := time.Now()
 	item.AssignedTo = &req.AssignedTo
+	item.AssignedAt = &now
 	item.Status = models.ReviewQueueStatusInReview
 
 	if err := s.store.UpdateReviewQueueItem(ctx, item); err != nil {
@@ -339,6 +622,140 @@ func (s *Server) getFeedbackStats(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, stats)
 }
 
+func (s *Server) trainFeedbackFilter(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	run, err := s.mlClassifier.TrainFeedbackFilter(ctx, mlclassifier.DefaultFeedbackTrainerConfig())
+	if err != nil {
+		s.logger.Error("failed to train feedback filter", "error", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to train feedback filter")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, run)
+}
+
+// trainFeedbackFilterJob runs scheduled train_feedback_filter jobs
+func (s *Server) trainFeedbackFilterJob(ctx context.Context) error {
+	run, err := s.mlClassifier.TrainFeedbackFilter(ctx, mlclassifier.DefaultFeedbackTrainerConfig())
+	if err != nil {
+		return err
+	}
+	s.logger.Info("trained feedback filter",
+		"run_id", run.RunID,
+		"version", run.Version,
+		"incorporated", run.Incorporated,
+		"rules", len(run.RulesTrained))
+	return nil
+}
+
+func (s *Server) getCalibration(w http.ResponseWriter, r *http.Request) {
+	calibration := s.mlClassifier.Calibration()
+	if calibration == nil {
+		respondError(w, http.StatusNotFound, "not_found", "no calibration has been fitted")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"model_id": calibration.ModelID,
+		"version":  calibration.Version,
+		"global":   calibration.Global,
+		"rules":    calibration.Rules,
+	})
+}
+
+func (s *Server) fitCalibration(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	config := mlclassifier.DefaultCalibrationConfig()
+	if method := r.URL.Query().Get("method"); method != "" {
+		switch method {
+		case mlclassifier.CalibrationAuto, mlclassifier.CalibrationPlatt, mlclassifier.CalibrationIsotonic:
+			config.Method = method
+		default:
+			respondError(w, http.StatusBadRequest, "invalid_request", "method must be auto, platt or isotonic")
+			return
+		}
+	}
+
+	run, err := s.mlClassifier.FitCalibration(ctx, config)
+	if err != nil {
+		s.logger.Error("failed to fit calibration", "error", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to fit calibration")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, run)
+}
+
+// fitCalibrationJob runs scheduled fit_calibration jobs
+func (s *Server) fitCalibrationJob(ctx context.Context) error {
+	run, err := s.mlClassifier.FitCalibration(ctx, mlclassifier.DefaultCalibrationConfig())
+	if err != nil {
+		return err
+	}
+	s.logger.Info("fitted confidence calibration",
+		"version", run.Version,
+		"samples", run.Samples,
+		"rules", len(run.RulesCalibrated))
+	return nil
+}
+
+// escalateReviewsJob runs scheduled escalate_reviews jobs
+func (s *Server) escalateReviewsJob(ctx context.Context) error {
+	entries, err := s.mlClassifier.EscalateOverdueReviews(ctx)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("escalated overdue reviews", "count", len(entries))
+	return nil
+}
+
+// notifyReviewEscalation reports escalated review items through the
+// configured notification channels
+func (s *Server) notifyReviewEscalation(ctx context.Context, entries []*models.ReviewQueueEntry) error {
+	stats := notifications.ReviewEscalationStats{
+		Overdue:    len(entries),
+		ByReason:   make(map[string]int),
+		ByReviewer: make(map[string]int),
+	}
+	for _, entry := range entries {
+		stats.ByReason[entry.Reason]++
+		if entry.AssignedTo == nil {
+			stats.Unassigned++
+		} else {
+			stats.ByReviewer[entry.AssignedTo.String()]++
+		}
+		if entry.DueBy != nil && (stats.OldestDue.IsZero() || entry.DueBy.Before(stats.OldestDue)) {
+			stats.OldestDue = *entry.DueBy
+		}
+	}
+	return s.notificationService.NotifyReviewEscalation(ctx, stats)
+}
+
+func (s *Server) getReliabilityDiagram(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	bins := 10
+	if v := r.URL.Query().Get("bins"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			respondError(w, http.StatusBadRequest, "invalid_request", "bins must be between 1 and 100")
+			return
+		}
+		bins = n
+	}
+
+	diagram, err := s.mlClassifier.ReliabilityDiagram(ctx, r.URL.Query().Get("rule"), bins)
+	if err != nil {
+		s.logger.Error("failed to build reliability diagram", "error", err)
+		respondError(w, http.StatusInternalServerError, "internal_error", "failed to build reliability diagram")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, diagram)
+}
+
 // =====================================================
 // AI Source Tracking Handlers
 // =====================================================
@@ -991,7 +1408,7 @@ func (s *Server) getRemediationAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, action)
+	respondJSON(w, http.StatusOK, s.simulateRemediation(ctx, action))
 }
 
 func (s *Server) approveRemediationAction(w http.ResponseWriter, r *http.Request) {
@@ -250,6 +250,12 @@ const dashboardHTML = `<!DOCTYPE html>
                             <option value="PCI">PCI</option>
                             <option value="PHI">PHI</option>
                             <option value="SECRETS">Secrets</option>
+                            <option value="HEALTH">Health (GDPR Art. 9)</option>
+                            <option value="RELIGION">Religion (GDPR Art. 9)</option>
+                            <option value="ETHNICITY">Ethnicity (GDPR Art. 9)</option>
+                            <option value="SEXUAL_ORIENTATION">Sexual Orientation (GDPR Art. 9)</option>
+                            <option value="BIOMETRIC">Biometric (GDPR Art. 9)</option>
+                            <option value="TRADE_UNION">Trade Union (GDPR Art. 9)</option>
                         </select>
                         <select id="classification-sensitivity-filter" onchange="filterClassifications()" class="px-3 py-2 text-sm border border-qualys-border rounded">
                             <option value="">All Sensitivities</option>
@@ -1082,7 +1088,8 @@ const dashboardHTML = `<!DOCTYPE html>
                 }
                 // Infer from data categories
                 const categories = asset.data_categories || [];
-                if (categories.includes('PHI') || categories.includes('SECRETS')) return 'CRITICAL';
+                const specialCategories = ['HEALTH', 'RELIGION', 'ETHNICITY', 'SEXUAL_ORIENTATION', 'BIOMETRIC', 'TRADE_UNION'];
+                if (categories.includes('PHI') || categories.includes('SECRETS') || categories.some(c => specialCategories.includes(c))) return 'CRITICAL';
                 if (categories.includes('PII') || categories.includes('PCI')) return 'HIGH';
                 if (categories.length > 0) return 'MEDIUM';
                 return 'LOW';
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	"github.com/qualys/dspm/internal/auth"
+	"github.com/qualys/dspm/internal/classifier"
 	"github.com/qualys/dspm/internal/models"
 	"github.com/qualys/dspm/internal/reports"
 	"github.com/qualys/dspm/internal/rules"
@@ -279,15 +284,19 @@ func (s *Server) listRules(w http.ResponseWriter, r *http.Request) {
 }
 
 type createRuleRequest struct {
-	Name            string             `json:"name"`
-	Description     string             `json:"description"`
-	Category        models.Category    `json:"category"`
-	Sensitivity     models.Sensitivity `json:"sensitivity"`
-	Patterns        []string           `json:"patterns"`
-	ContextPatterns []string           `json:"context_patterns"`
-	ContextRequired bool               `json:"context_required"`
-	Priority        int                `json:"priority"`
-	Enabled         bool               `json:"enabled"`
+	Name             string              `json:"name"`
+	Description      string              `json:"description"`
+	Category         models.Category     `json:"category"`
+	Sensitivity      models.Sensitivity  `json:"sensitivity"`
+	Patterns         []string            `json:"patterns"`
+	ContextPatterns  []string            `json:"context_patterns"`
+	NegativePatterns []string            `json:"negative_patterns"`
+	Validators       []string            `json:"validators"`
+	TestCases        rules.RuleTestCases `json:"test_cases"`
+	Condition        string              `json:"condition"`
+	ContextRequired  bool                `json:"context_required"`
+	Priority         int                 `json:"priority"`
+	Enabled          bool                `json:"enabled"`
 }
 
 func (s *Server) createRule(w http.ResponseWriter, r *http.Request) {
@@ -316,23 +325,35 @@ func (s *Server) createRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rule := &rules.CustomRule{
-		Name:            req.Name,
-		Description:     req.Description,
-		Category:        req.Category,
-		Sensitivity:     req.Sensitivity,
-		Patterns:        req.Patterns,
-		ContextPatterns: req.ContextPatterns,
-		ContextRequired: req.ContextRequired,
-		Priority:        req.Priority,
-		Enabled:         req.Enabled,
-		CreatedBy:       createdBy,
+		Name:             req.Name,
+		Description:      req.Description,
+		Category:         req.Category,
+		Sensitivity:      req.Sensitivity,
+		Patterns:         req.Patterns,
+		ContextPatterns:  req.ContextPatterns,
+		NegativePatterns: req.NegativePatterns,
+		Validators:       req.Validators,
+		TestCases:        req.TestCases,
+		Condition:        req.Condition,
+		ContextRequired:  req.ContextRequired,
+		Priority:         req.Priority,
+		Enabled:          req.Enabled,
+		CreatedBy:        createdBy,
 	}
 
 	if err := s.rulesEngine.CreateRule(r.Context(), rule); err != nil {
+		if errors.Is(err, rules.ErrFixturesFailed) {
+			respondError(w, http.StatusUnprocessableEntity, "test_cases_failed", err.Error())
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
 		return
 	}
 
+	if rule.Enabled {
+		s.rescanForRuleChange(r.Context(), "rule:"+rule.ID, []string{rule.Name}, []string{string(rule.Category)}, true)
+	}
+
 	respondJSON(w, http.StatusCreated, rule)
 }
 
@@ -362,6 +383,7 @@ func (s *Server) updateRule(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusNotFound, "not_found", "Rule not found")
 		return
 	}
+	before := *existing
 
 	existing.Name = req.Name
 	existing.Description = req.Description
@@ -369,32 +391,78 @@ func (s *Server) updateRule(w http.ResponseWriter, r *http.Request) {
 	existing.Sensitivity = req.Sensitivity
 	existing.Patterns = req.Patterns
 	existing.ContextPatterns = req.ContextPatterns
+	existing.NegativePatterns = req.NegativePatterns
+	existing.Validators = req.Validators
+	existing.TestCases = req.TestCases
+	existing.Condition = req.Condition
 	existing.ContextRequired = req.ContextRequired
 	existing.Priority = req.Priority
 	existing.Enabled = req.Enabled
 
 	if err := s.rulesEngine.UpdateRule(r.Context(), existing); err != nil {
+		if errors.Is(err, rules.ErrFixturesFailed) {
+			respondError(w, http.StatusUnprocessableEntity, "test_cases_failed", err.Error())
+			return
+		}
 		respondError(w, http.StatusBadRequest, "validation_error", err.Error())
 		return
 	}
 
+	categories := []string{string(before.Category)}
+	if existing.Enabled {
+		categories = append(categories, string(existing.Category))
+	}
+	s.rescanForRuleChange(r.Context(), "rule:"+existing.ID, []string{before.Name, existing.Name}, categories, rules.Widens(&before, existing))
+
 	respondJSON(w, http.StatusOK, existing)
 }
 
 func (s *Server) deleteRule(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "ruleID")
 
+	existing, err := s.rulesEngine.GetRule(r.Context(), id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "not_found", "Rule not found")
+		return
+	}
+
 	if err := s.rulesEngine.DeleteRule(r.Context(), id); err != nil {
 		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
 		return
 	}
 
+	// Objects the rule matched are rescanned so its classifications are dropped
+	s.rescanForRuleChange(r.Context(), "rule:"+existing.ID, []string{existing.Name}, nil, false)
+
 	respondJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// rescanForRuleChange re-classifies objects affected by a rule change so stored
+// classifications reflect the current rule set. Failures are logged, not returned,
+// since the rule change itself has already been saved. When rules were added or
+// widened the affected objects are unknown, so every asset is rescanned.
+func (s *Server) rescanForRuleChange(ctx context.Context, triggeredBy string, ruleNames, categories []string, added bool) {
+	jobs, err := s.scanExecutor.RescanForRuleChange(ctx, ruleNames, categories, added, triggeredBy)
+	if err != nil {
+		s.logger.Error("failed to start rescan for rule change", "triggered_by", triggeredBy, "error", err)
+		return
+	}
+	if len(jobs) > 0 {
+		s.logger.Info("started rescans for rule change", "triggered_by", triggeredBy, "jobs", len(jobs))
+	}
+}
+
 type testRuleRequest struct {
-	Rule    createRuleRequest `json:"rule"`
-	Content string            `json:"content"`
+	Rule     createRuleRequest `json:"rule"`
+	Content  string            `json:"content"`
+	Metadata *testRuleMetadata `json:"metadata,omitempty"` // Object the content came from, for conditions
+}
+
+type testRuleMetadata struct {
+	Bucket string            `json:"bucket"`
+	Path   string            `json:"path"`
+	Size   int64             `json:"size"`
+	Tags   map[string]string `json:"tags"`
 }
 
 func (s *Server) testRule(w http.ResponseWriter, r *http.Request) {
@@ -405,15 +473,28 @@ func (s *Server) testRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rule := &rules.CustomRule{
-		Name:            req.Rule.Name,
-		Patterns:        req.Rule.Patterns,
-		ContextPatterns: req.Rule.ContextPatterns,
-		ContextRequired: req.Rule.ContextRequired,
-		Category:        req.Rule.Category,
-		Sensitivity:     req.Rule.Sensitivity,
+		Name:             req.Rule.Name,
+		Patterns:         req.Rule.Patterns,
+		ContextPatterns:  req.Rule.ContextPatterns,
+		NegativePatterns: req.Rule.NegativePatterns,
+		Validators:       req.Rule.Validators,
+		Condition:        req.Rule.Condition,
+		ContextRequired:  req.Rule.ContextRequired,
+		Category:         req.Rule.Category,
+		Sensitivity:      req.Rule.Sensitivity,
+	}
+
+	var meta *classifier.ObjectMetadata
+	if req.Metadata != nil {
+		meta = &classifier.ObjectMetadata{
+			Bucket:     req.Metadata.Bucket,
+			Path:       req.Metadata.Path,
+			Size:       req.Metadata.Size,
+			BucketTags: req.Metadata.Tags,
+		}
 	}
 
-	match, err := s.rulesEngine.TestRule(r.Context(), rule, req.Content)
+	match, err := s.rulesEngine.TestRule(r.Context(), rule, req.Content, meta)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "validation_error", err.Error())
 		return
@@ -430,6 +511,125 @@ func (s *Server) getRuleTemplates(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, templates)
 }
 
+// runRuleRegression runs every enabled rule against every rule fixture and
+// reports precision and recall per rule
+func (s *Server) runRuleRegression(w http.ResponseWriter, r *http.Request) {
+	if err := s.rulesEngine.LoadRules(r.Context()); err != nil {
+		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
+		return
+	}
+
+	report, err := s.rulesEngine.EvaluateFixtures()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "evaluation_error", err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+// maxRulePackSize bounds the request body accepted by importRulePack
+const maxRulePackSize = 5 << 20
+
+// importRulePack installs a YAML or JSON rule pack. With ?dry_run=true it only
+// returns the diff against the installed pack, for review before promotion.
+func (s *Server) importRulePack(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRulePackSize))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+
+	pack, err := rules.ParsePack(data)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid_pack", err.Error())
+		return
+	}
+
+	opts := rules.ImportOptions{
+		DryRun:         r.URL.Query().Get("dry_run") == "true",
+		AllowDowngrade: r.URL.Query().Get("allow_downgrade") == "true",
+	}
+	if claims, _ := auth.GetUserFromContext(r.Context()); claims != nil {
+		opts.ImportedBy = claims.UserID
+	}
+
+	diff, err := s.rulesEngine.ImportPack(r.Context(), pack, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, rules.ErrPackDowngrade), errors.Is(err, rules.ErrPackVersionNotBump):
+			respondError(w, http.StatusConflict, "version_conflict", err.Error())
+		case errors.Is(err, rules.ErrPackRuleConflict):
+			respondError(w, http.StatusConflict, "rule_conflict", err.Error())
+		case errors.Is(err, rules.ErrInvalidPack):
+			respondError(w, http.StatusBadRequest, "validation_error", err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "db_error", err.Error())
+		}
+		return
+	}
+
+	if !opts.DryRun && diff.HasChanges() {
+		var names, categories []string
+		widens := len(diff.Added) > 0
+		for _, change := range diff.Updated {
+			widens = widens || change.Widens
+		}
+		for _, changes := range [][]rules.RuleDiff{diff.Added, diff.Updated, diff.Removed} {
+			for _, change := range changes {
+				names = append(names, change.Name)
+				categories = append(categories, string(change.Category))
+				if change.PreviousCategory != "" {
+					categories = append(categories, string(change.PreviousCategory))
+				}
+			}
+		}
+		s.rescanForRuleChange(r.Context(), "pack:"+pack.Name+"@"+pack.Version, names, categories, widens)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"applied": !opts.DryRun,
+		"diff":    diff,
+	})
+}
+
+// exportRulePack returns a pack (or, without ?pack=, the rules outside any pack) as YAML or JSON
+func (s *Server) exportRulePack(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "yaml"
+	}
+	if format != "yaml" && format != "json" {
+		respondError(w, http.StatusBadRequest, "invalid_format", "format must be yaml or json")
+		return
+	}
+
+	pack, err := s.rulesEngine.ExportPack(r.Context(), r.URL.Query().Get("pack"))
+	if err != nil {
+		if errors.Is(err, rules.ErrPackNotFound) {
+			respondError(w, http.StatusNotFound, "not_found", "Rule pack not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "db_error", err.Error())
+		return
+	}
+
+	data, err := rules.MarshalPack(pack, format)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "export_error", err.Error())
+		return
+	}
+
+	contentType := "application/yaml"
+	if format == "json" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", pack.Name+"."+format))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
 type generateReportRequest struct {
 	Type       reports.ReportType   `json:"type"`
 	Format     reports.ReportFormat `json:"format"`
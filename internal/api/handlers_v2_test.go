@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/rules"
+)
+
+// storageConnector serves one bucket holding fixed objects
+type storageConnector struct {
+	bucket  string
+	objects map[string]string
+}
+
+func (c *storageConnector) Provider() models.Provider          { return models.ProviderAWS }
+func (c *storageConnector) Validate(ctx context.Context) error { return nil }
+func (c *storageConnector) Close() error                       { return nil }
+
+func (c *storageConnector) ListBuckets(ctx context.Context) ([]connectors.BucketInfo, error) {
+	return []connectors.BucketInfo{{Name: c.bucket, Region: "us-east-1", ARN: "arn:aws:s3:::" + c.bucket}}, nil
+}
+
+func (c *storageConnector) GetBucketMetadata(ctx context.Context, bucketName string) (*connectors.BucketMetadata, error) {
+	return &connectors.BucketMetadata{Name: bucketName, Region: "us-east-1", ARN: "arn:aws:s3:::" + bucketName}, nil
+}
+
+func (c *storageConnector) ListObjects(ctx context.Context, bucketName, prefix string, maxKeys int) ([]connectors.ObjectInfo, error) {
+	var objects []connectors.ObjectInfo
+	for key, content := range c.objects {
+		objects = append(objects, connectors.ObjectInfo{Key: key, Size: int64(len(content))})
+	}
+	return objects, nil
+}
+
+func (c *storageConnector) GetObject(ctx context.Context, bucketName, objectKey string, byteRange *connectors.ByteRange) (io.ReadCloser, error) {
+	content, ok := c.objects[objectKey]
+	if !ok {
+		return nil, fmt.Errorf("object not found: %s", objectKey)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (c *storageConnector) GetBucketPolicy(ctx context.Context, bucketName string) (*connectors.BucketPolicy, error) {
+	return nil, nil
+}
+
+func (c *storageConnector) GetBucketACL(ctx context.Context, bucketName string) (*connectors.BucketACL, error) {
+	return nil, nil
+}
+
+func TestUpdateRule_RescansObjectsTheRuleNowMatches(t *testing.T) {
+	st := skipIfNoTestDB(t)
+	defer st.Close()
+	ctx := context.Background()
+
+	account := &models.CloudAccount{
+		Provider:        models.ProviderAWS,
+		ExternalID:      "test-rescan-" + uuid.New().String()[:8],
+		ConnectorConfig: models.JSONB{},
+	}
+	if err := st.CreateAccount(ctx, account); err != nil {
+		t.Fatalf("CreateAccount failed: %v", err)
+	}
+	defer func() { _ = st.DeleteAccount(ctx, account.ID) }()
+
+	conn := &storageConnector{bucket: account.ExternalID, objects: map[string]string{
+		"old.txt": "employee EMP-123456 joined",
+		"new.txt": "employee EMP-1234567 joined",
+	}}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	engine := rules.NewEngine(rules.NewPostgresStore(st.DB()))
+	executor := NewScanExecutor(st, logger)
+	executor.SetRulesEngine(engine)
+	executor.connect = func(ctx context.Context, a *models.CloudAccount) (connectors.Connector, error) {
+		if a.ID != account.ID {
+			return nil, fmt.Errorf("no connector for account %s", a.ID)
+		}
+		return conn, nil
+	}
+	s := &Server{logger: logger, rulesEngine: engine, scanExecutor: executor}
+
+	rule := &rules.CustomRule{
+		Name:        "Employee ID " + account.ExternalID,
+		Category:    models.CategoryCustom,
+		Sensitivity: models.SensitivityMedium,
+		Patterns:    []string{`\bEMP-\d{6}\b`},
+		Enabled:     true,
+	}
+	if err := engine.CreateRule(ctx, rule); err != nil {
+		t.Fatalf("CreateRule failed: %v", err)
+	}
+	defer func() { _ = engine.DeleteRule(ctx, rule.ID) }()
+
+	job := &models.ScanJob{AccountID: account.ID, ScanType: models.ScanTypeClassification, TriggeredBy: "test"}
+	if err := st.CreateScanJob(ctx, job); err != nil {
+		t.Fatalf("CreateScanJob failed: %v", err)
+	}
+	if err := executor.runScan(ctx, job, account); err != nil {
+		t.Fatalf("runScan failed: %v", err)
+	}
+
+	asset, err := st.GetAssetByARN(ctx, "arn:aws:s3:::"+account.ExternalID)
+	if err != nil || asset == nil {
+		t.Fatalf("GetAssetByARN failed: %v", err)
+	}
+	classified := func(object string) bool {
+		t.Helper()
+		ids, err := st.ClassificationIDs(ctx, asset.ID, object)
+		if err != nil {
+			t.Fatalf("ClassificationIDs failed: %v", err)
+		}
+		_, ok := ids[rule.Name]
+		return ok
+	}
+	if !classified("old.txt") || classified("new.txt") {
+		t.Fatalf("Expected only old.txt to be classified before the edit")
+	}
+
+	// Widening the pattern must reach new.txt, which the rule never classified
+	body, _ := json.Marshal(createRuleRequest{
+		Name:        rule.Name,
+		Category:    rule.Category,
+		Sensitivity: rule.Sensitivity,
+		Patterns:    []string{`\bEMP-\d{6,7}\b`},
+		Enabled:     true,
+	})
+	router := chi.NewRouter()
+	router.Put("/rules/{ruleID}", s.updateRule)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/rules/"+rule.ID, bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	deadline := time.Now().Add(30 * time.Second)
+	for !classified("new.txt") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected new.txt to be classified after the edit")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Let the rescans finish before the account is deleted
+	for {
+		executor.mu.Lock()
+		running := len(executor.running)
+		executor.mu.Unlock()
+		if running == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
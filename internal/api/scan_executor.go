@@ -8,13 +8,19 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/qualys/dspm/internal/accessscan"
 	"github.com/qualys/dspm/internal/classifier"
-	awsconn "github.com/qualys/dspm/internal/connectors/aws"
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/mlclassifier"
 	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/rules"
 	"github.com/qualys/dspm/internal/scanner"
 	"github.com/qualys/dspm/internal/store"
 )
 
+// rescanObjectLimit caps how many objects a single rule change can queue for rescanning
+const rescanObjectLimit = 10000
+
 // assetClassificationUpdate tracks classification summary for an asset
 type assetClassificationUpdate struct {
 	maxSensitivity models.Sensitivity
@@ -27,14 +33,31 @@ type ScanExecutor struct {
 	store      *store.Store
 	scanner    *scanner.Scanner
 	classifier *classifier.Classifier
-	logger     *slog.Logger
-	mu         sync.Mutex
-	running    map[uuid.UUID]context.CancelFunc
+	// Custom rules compiled into each scan's classifier (optional)
+	rulesEngine *rules.Engine
+	logger      *slog.Logger
+	mu          sync.Mutex
+	running     map[uuid.UUID]context.CancelFunc
 	// Map scanner-generated asset IDs to actual database IDs
 	assetIDMap   map[uuid.UUID]uuid.UUID
 	assetIDMapMu sync.RWMutex
 	// Batch size for bulk inserts (10K rows = ~100x faster than individual inserts)
 	batchSize int
+	// Per-category redaction of stored samples (nil = partial masking)
+	redaction *classifier.RedactionPolicy
+	// Scores matches and fills the review queue (optional)
+	mlClassifier *mlclassifier.Service
+	// Runs access-analysis scans (optional)
+	accessScanner *accessscan.Scanner
+	// connect creates the connector of an account's scan
+	connect func(ctx context.Context, account *models.CloudAccount) (connectors.Connector, error)
+}
+
+// pendingPredictions holds an object's ML result until its classifications are
+// saved and have IDs; classifications[i] corresponds to result.Matches[i]
+type pendingPredictions struct {
+	result          *mlclassifier.MLResult
+	classifications []*models.Classification
 }
 
 // NewScanExecutor creates a new scan executor
@@ -47,9 +70,53 @@ func NewScanExecutor(st *store.Store, logger *slog.Logger) *ScanExecutor {
 		running:    make(map[uuid.UUID]context.CancelFunc),
 		assetIDMap: make(map[uuid.UUID]uuid.UUID),
 		batchSize:  1000, // Batch 1000 classifications before bulk insert
+		connect:    accessscan.Connect,
 	}
 }
 
+// SetRulesEngine enables custom rules in scans started by this executor
+func (e *ScanExecutor) SetRulesEngine(engine *rules.Engine) {
+	e.rulesEngine = engine
+}
+
+// SetMLClassifier enables ML confidence scoring and automatic review queueing in scans
+func (e *ScanExecutor) SetMLClassifier(svc *mlclassifier.Service) {
+	e.mlClassifier = svc
+}
+
+// SetAccessScanner enables access-analysis scans
+func (e *ScanExecutor) SetAccessScanner(scanner *accessscan.Scanner) {
+	e.accessScanner = scanner
+}
+
+// SetRedactionPolicy sets how matched values are redacted before they are stored
+func (e *ScanExecutor) SetRedactionPolicy(policy *classifier.RedactionPolicy) {
+	e.redaction = policy
+}
+
+// newClassifier compiles the built-in rules together with the current custom rules,
+// so every scan runs against the latest rule versions
+func (e *ScanExecutor) newClassifier(ctx context.Context) *classifier.Classifier {
+	c := e.compileClassifier(ctx)
+	c.SetRedactionPolicy(e.redaction)
+	return c
+}
+
+func (e *ScanExecutor) compileClassifier(ctx context.Context) *classifier.Classifier {
+	if e.rulesEngine == nil {
+		return classifier.New()
+	}
+	if err := e.rulesEngine.LoadRules(ctx); err != nil {
+		e.logger.Warn("failed to reload custom rules, using last loaded set", "error", err)
+	}
+	c, err := e.rulesEngine.NewClassifier()
+	if err != nil {
+		e.logger.Error("failed to compile custom rules, using built-in rules only", "error", err)
+		return classifier.New()
+	}
+	return c
+}
+
 // ExecuteScan starts a scan in the background
 func (e *ScanExecutor) ExecuteScan(ctx context.Context, job *models.ScanJob, account *models.CloudAccount) {
 	e.mu.Lock()
@@ -99,7 +166,7 @@ func (e *ScanExecutor) runScan(ctx context.Context, job *models.ScanJob, account
 
 	e.logger.Info("runScan: creating connector", "job_id", job.ID, "region", account.ConnectorConfig["region"])
 	// Create connector
-	conn, err := e.createConnector(ctx, account)
+	conn, err := e.connect(ctx, account)
 	if err != nil {
 		return fmt.Errorf("creating connector: %w", err)
 	}
@@ -113,49 +180,27 @@ func (e *ScanExecutor) runScan(ctx context.Context, job *models.ScanJob, account
 	}
 	e.logger.Info("runScan: connection validated", "job_id", job.ID)
 
-	// Run storage scan
-	e.logger.Info("runScan: starting storage scan", "job_id", job.ID)
-	return e.runStorageScan(ctx, job, account, conn)
-}
-
-func (e *ScanExecutor) createConnector(ctx context.Context, account *models.CloudAccount) (*awsconn.Connector, error) {
-	if account.Provider != models.ProviderAWS {
-		return nil, fmt.Errorf("unsupported provider: %s", account.Provider)
+	if job.ScanType == models.ScanTypeAccessAnalysis {
+		if e.accessScanner == nil {
+			return fmt.Errorf("access analysis is not enabled")
+		}
+		e.logger.Info("runScan: starting access scan", "job_id", job.ID)
+		return e.accessScanner.Run(ctx, job.ID, account, conn)
 	}
 
-	cfg := awsconn.Config{
-		Region: getStringFromConfig(account.ConnectorConfig, "region", "us-east-1"),
-	}
-	if roleArn, ok := account.ConnectorConfig["role_arn"].(string); ok {
-		cfg.AssumeRoleARN = roleArn
-	}
-	if extID, ok := account.ConnectorConfig["external_id"].(string); ok {
-		cfg.ExternalID = extID
+	storageConn, ok := conn.(connectors.StorageConnector)
+	if !ok {
+		return fmt.Errorf("connector does not support storage operations")
 	}
 
-	return awsconn.New(ctx, cfg)
+	// Run storage scan
+	e.logger.Info("runScan: starting storage scan", "job_id", job.ID)
+	return e.runStorageScan(ctx, job, account, storageConn)
 }
 
-func (e *ScanExecutor) runStorageScan(ctx context.Context, job *models.ScanJob, account *models.CloudAccount, conn *awsconn.Connector) error {
+func (e *ScanExecutor) runStorageScan(ctx context.Context, job *models.ScanJob, account *models.CloudAccount, conn connectors.StorageConnector) error {
 	// Parse scope from job
-	var scope *scanner.ScanScope
-	if job.ScanScope != nil {
-		scope = &scanner.ScanScope{}
-		if buckets, ok := job.ScanScope["buckets"].([]interface{}); ok {
-			for _, b := range buckets {
-				if bs, ok := b.(string); ok {
-					scope.Buckets = append(scope.Buckets, bs)
-				}
-			}
-		}
-		if regions, ok := job.ScanScope["regions"].([]interface{}); ok {
-			for _, r := range regions {
-				if rs, ok := r.(string); ok {
-					scope.Regions = append(scope.Regions, rs)
-				}
-			}
-		}
-	}
+	scope := parseScanScope(job.ScanScope)
 
 	scannerJob := &scanner.ScanJob{
 		ID:        job.ID,
@@ -166,7 +211,7 @@ func (e *ScanExecutor) runStorageScan(ctx context.Context, job *models.ScanJob,
 
 	// Create a new scanner for this job
 	e.logger.Info("runStorageScan: creating scanner instance", "job_id", job.ID)
-	scannerInstance := scanner.New(scanner.DefaultConfig())
+	scannerInstance := scanner.NewWithClassifier(scanner.DefaultConfig(), e.newClassifier(ctx))
 	assetCh, classifyCh, findingCh, errorCh := scannerInstance.Results()
 
 	// Collect results in a goroutine
@@ -175,7 +220,7 @@ func (e *ScanExecutor) runStorageScan(ctx context.Context, job *models.ScanJob,
 	go func() {
 		defer wg.Done()
 		e.logger.Info("collectResults: starting", "job_id", job.ID)
-		e.collectResults(ctx, job.ID, account.ID, assetCh, classifyCh, findingCh, errorCh)
+		e.collectResults(ctx, job.ID, account.ID, scope, assetCh, classifyCh, findingCh, errorCh)
 		e.logger.Info("collectResults: finished", "job_id", job.ID)
 	}()
 
@@ -212,7 +257,140 @@ func (e *ScanExecutor) runStorageScan(ctx context.Context, job *models.ScanJob,
 	return err
 }
 
-func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid.UUID,
+// parseScanScope converts a job's stored scope into a scanner scope
+func parseScanScope(raw models.JSONB) *scanner.ScanScope {
+	if raw == nil {
+		return nil
+	}
+	scope := &scanner.ScanScope{
+		Buckets: toStringSlice(raw["buckets"]),
+		Regions: toStringSlice(raw["regions"]),
+	}
+	switch objects := raw["objects"].(type) {
+	case map[string][]string:
+		scope.Objects = objects
+	case map[string]interface{}:
+		scope.Objects = make(map[string][]string, len(objects))
+		for bucket, keys := range objects {
+			scope.Objects[bucket] = toStringSlice(keys)
+		}
+	}
+	return scope
+}
+
+// toStringSlice handles both in-process ([]string) and JSON-decoded ([]interface{}) values
+func toStringSlice(v interface{}) []string {
+	switch vals := v.(type) {
+	case []string:
+		return vals
+	case []interface{}:
+		result := make([]string, 0, len(vals))
+		for _, val := range vals {
+			if str, ok := val.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// RescanForRuleChange starts targeted classification scans after a rule change.
+// It rescans objects previously classified by any of ruleNames (which may no longer
+// match) and objects holding data in any of categories (which may now match).
+// A new or widened rule may match objects it never classified, so with fullScan
+// every account is rescanned whole instead, as it is when the targets exceed
+// rescanObjectLimit.
+func (e *ScanExecutor) RescanForRuleChange(ctx context.Context, ruleNames, categories []string, fullScan bool, triggeredBy string) ([]*models.ScanJob, error) {
+	if fullScan {
+		return e.rescanAllAccounts(ctx, triggeredBy)
+	}
+
+	// One more target than the limit is read to tell whether any were left out
+	targets, err := e.store.ListRescanTargets(ctx, ruleNames, categories, rescanObjectLimit+1)
+	if err != nil {
+		return nil, fmt.Errorf("listing rescan targets: %w", err)
+	}
+	if len(targets) > rescanObjectLimit {
+		e.logger.Warn("rule change affects more objects than a targeted rescan covers, rescanning all accounts",
+			"limit", rescanObjectLimit, "triggered_by", triggeredBy)
+		return e.rescanAllAccounts(ctx, triggeredBy)
+	}
+
+	// Group objects by account, then bucket
+	byAccount := make(map[uuid.UUID]map[string][]string)
+	for _, t := range targets {
+		if byAccount[t.AccountID] == nil {
+			byAccount[t.AccountID] = make(map[string][]string)
+		}
+		byAccount[t.AccountID][t.BucketName] = append(byAccount[t.AccountID][t.BucketName], t.ObjectPath)
+	}
+
+	var jobs []*models.ScanJob
+	for accountID, objects := range byAccount {
+		account, err := e.store.GetAccount(ctx, accountID)
+		if err != nil {
+			return jobs, fmt.Errorf("getting account %s: %w", accountID, err)
+		}
+		if account == nil {
+			continue
+		}
+
+		buckets := make([]string, 0, len(objects))
+		for bucket := range objects {
+			buckets = append(buckets, bucket)
+		}
+
+		job := &models.ScanJob{
+			AccountID: accountID,
+			ScanType:  models.ScanTypeClassification,
+			ScanScope: models.JSONB{
+				"buckets": buckets,
+				"objects": objects,
+			},
+			TriggeredBy: triggeredBy,
+		}
+		if err := e.store.CreateScanJob(ctx, job); err != nil {
+			return jobs, fmt.Errorf("creating rescan job: %w", err)
+		}
+
+		e.logger.Info("starting targeted rescan", "job_id", job.ID, "account_id", accountID,
+			"buckets", len(buckets), "triggered_by", triggeredBy)
+		e.ExecuteScan(ctx, job, account)
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// rescanAllAccounts starts a classification scan of every asset in every account
+func (e *ScanExecutor) rescanAllAccounts(ctx context.Context, triggeredBy string) ([]*models.ScanJob, error) {
+	accounts, err := e.store.ListAccounts(ctx, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("listing accounts: %w", err)
+	}
+
+	var jobs []*models.ScanJob
+	for i := range accounts {
+		account := &accounts[i]
+		job := &models.ScanJob{
+			AccountID:   account.ID,
+			ScanType:    models.ScanTypeClassification,
+			TriggeredBy: triggeredBy,
+		}
+		if err := e.store.CreateScanJob(ctx, job); err != nil {
+			return jobs, fmt.Errorf("creating rescan job: %w", err)
+		}
+
+		e.logger.Info("starting full rescan", "job_id", job.ID, "account_id", account.ID, "triggered_by", triggeredBy)
+		e.ExecuteScan(ctx, job, account)
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid.UUID, scope *scanner.ScanScope,
 	assetCh <-chan *scanner.AssetResult,
 	classifyCh <-chan *scanner.ClassificationResult,
 	findingCh <-chan *scanner.FindingResult,
@@ -224,6 +402,12 @@ func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid
 	assetUpdates := make(map[uuid.UUID]*assetClassificationUpdate)
 	// Queue findings to save after all assets are processed
 	var findingsQueue []*scanner.FindingResult
+	// Targeted rescans replace only some of an asset's classifications, so the
+	// summaries of touched assets are recomputed from the table instead
+	targeted := scope != nil && scope.Objects != nil
+	touchedAssets := make(map[uuid.UUID]bool)
+	// ML results for classifications in the current batch
+	var predictionBatch []pendingPredictions
 
 	flushBatch := func() {
 		if len(classificationBatch) == 0 {
@@ -243,6 +427,9 @@ func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid
 
 		// Update asset classification summaries
 		for assetID, update := range assetUpdates {
+			if targeted {
+				continue
+			}
 			categories := make([]string, 0, len(update.categories))
 			for cat := range update.categories {
 				categories = append(categories, cat)
@@ -251,7 +438,13 @@ func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid
 				e.logger.Error("failed to update asset classification", "asset_id", assetID, "error", err)
 			}
 		}
+		// Predictions reference the saved classifications, so they are recorded after the insert
+		for _, pending := range predictionBatch {
+			e.recordPredictions(ctx, pending)
+		}
+
 		classificationBatch = nil
+		predictionBatch = nil
 		assetUpdates = make(map[uuid.UUID]*assetClassificationUpdate)
 	}
 
@@ -263,12 +456,21 @@ func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid
 		findingsQueue = nil
 	}
 
+	refreshTouchedAssets := func() {
+		for assetID := range touchedAssets {
+			if err := e.store.RefreshAssetClassificationSummary(ctx, assetID); err != nil {
+				e.logger.Error("failed to refresh asset classification summary", "asset_id", assetID, "error", err)
+			}
+		}
+	}
+
 	for {
 		// Check exit condition BEFORE entering select to avoid blocking on nil channels
 		if assetCh == nil && classifyCh == nil && findingCh == nil && errorCh == nil {
 			e.logger.Info("collectResults: all channels closed, exiting", "job_id", jobID)
 			// Save all queued findings now that assets are processed
 			saveQueuedFindings()
+			refreshTouchedAssets()
 			return
 		}
 
@@ -276,6 +478,7 @@ func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid
 		case <-ctx.Done():
 			flushBatch()
 			saveQueuedFindings()
+			refreshTouchedAssets()
 			return
 
 		case asset, ok := <-assetCh:
@@ -285,7 +488,10 @@ func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid
 				continue
 			}
 			if asset != nil {
-				e.saveAsset(ctx, accountID, asset)
+				e.saveAsset(ctx, accountID, asset, scope)
+				if targeted && asset.Asset != nil {
+					touchedAssets[asset.Asset.ID] = true
+				}
 			}
 
 		case classification, ok := <-classifyCh:
@@ -296,7 +502,10 @@ func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid
 				continue
 			}
 			if classification != nil {
-				batch := e.convertClassificationResult(classification)
+				batch := e.convertClassificationResult(ctx, classification)
+				if pending := e.enhanceClassifications(ctx, classification, batch); pending != nil {
+					predictionBatch = append(predictionBatch, *pending)
+				}
 				classificationBatch = append(classificationBatch, batch...)
 
 				// Track asset summary updates
@@ -345,8 +554,35 @@ func (e *ScanExecutor) collectResults(ctx context.Context, jobID, accountID uuid
 	}
 }
 
+// enhanceClassifications scores an object's matches with the ML classifier and sets
+// the combined confidence on the classifications converted from them
+func (e *ScanExecutor) enhanceClassifications(ctx context.Context, result *scanner.ClassificationResult, classifications []*models.Classification) *pendingPredictions {
+	if e.mlClassifier == nil || len(classifications) == 0 {
+		return nil
+	}
+	mlResult, err := e.mlClassifier.EnhanceScanMatches(ctx, result.ObjectPath, result.Matches)
+	if err != nil {
+		e.logger.Warn("ML enhancement failed", "object", result.ObjectPath, "error", err)
+		return nil
+	}
+	for i, c := range classifications {
+		c.ConfidenceScore = mlResult.Matches[i].CombinedConfidence
+	}
+	return &pendingPredictions{result: mlResult, classifications: classifications}
+}
+
+func (e *ScanExecutor) recordPredictions(ctx context.Context, pending pendingPredictions) {
+	ids := make([]uuid.UUID, len(pending.classifications))
+	for i, c := range pending.classifications {
+		ids[i] = c.ID
+	}
+	if err := e.mlClassifier.RecordScanPredictions(ctx, pending.result, ids); err != nil {
+		e.logger.Error("failed to record ML predictions", "object", pending.classifications[0].ObjectPath, "error", err)
+	}
+}
+
 // convertClassificationResult converts a scanner result to model classifications
-func (e *ScanExecutor) convertClassificationResult(result *scanner.ClassificationResult) []*models.Classification {
+func (e *ScanExecutor) convertClassificationResult(ctx context.Context, result *scanner.ClassificationResult) []*models.Classification {
 	if len(result.Matches) == 0 {
 		return nil
 	}
@@ -359,52 +595,18 @@ func (e *ScanExecutor) convertClassificationResult(result *scanner.Classificatio
 	}
 	e.assetIDMapMu.RUnlock()
 
-	var classifications []*models.Classification
-	for _, match := range result.Matches {
-		// Build sample matches for the API/UI
-		var sampleMatches []map[string]interface{}
-		for _, sm := range match.SampleMatches {
-			sampleMatches = append(sampleMatches, map[string]interface{}{
-				"line":        sm.LineNumber,
-				"column":      sm.ColumnNumber,
-				"column_name": sm.ColumnName,
-				"value":       sm.MaskedValue,
-				"context":     sm.Context,
-			})
-		}
-
-		// Build match locations (line numbers)
-		var matchLocations []map[string]interface{}
-		for i, lineNum := range match.LineNumbers {
-			loc := map[string]interface{}{
-				"line": lineNum,
-			}
-			if i < len(match.SampleMatches) {
-				loc["column"] = match.SampleMatches[i].ColumnNumber
-				if match.SampleMatches[i].ColumnName != "" {
-					loc["column_name"] = match.SampleMatches[i].ColumnName
-				}
-			}
-			matchLocations = append(matchLocations, loc)
+	// Originals are sealed to the ID their classification is stored under
+	var existing map[string]uuid.UUID
+	if result.HasOriginals() {
+		var err error
+		if existing, err = e.store.ClassificationIDs(ctx, assetID, result.ObjectPath); err != nil {
+			e.logger.Error("failed to look up classification IDs", "object", result.ObjectPath, "error", err)
 		}
-
-		classifications = append(classifications, &models.Classification{
-			AssetID:         assetID,
-			ObjectPath:      result.ObjectPath,
-			ObjectSize:      result.ObjectSize,
-			RuleName:        match.RuleName,
-			Category:        match.Category,
-			Sensitivity:     match.Sensitivity,
-			FindingCount:    match.Count,
-			ConfidenceScore: match.Confidence,
-			SampleMatches:   models.JSONB{"samples": sampleMatches},
-			MatchLocations:  models.JSONB{"locations": matchLocations},
-		})
 	}
-	return classifications
+	return result.Classifications(assetID, existing, e.redaction)
 }
 
-func (e *ScanExecutor) saveAsset(ctx context.Context, accountID uuid.UUID, result *scanner.AssetResult) {
+func (e *ScanExecutor) saveAsset(ctx context.Context, accountID uuid.UUID, result *scanner.AssetResult, scope *scanner.ScanScope) {
 	if result.Asset == nil {
 		return
 	}
@@ -420,11 +622,23 @@ func (e *ScanExecutor) saveAsset(ctx context.Context, accountID uuid.UUID, resul
 
 	// Clear old classifications and findings for this asset before adding new scan results
 	// This ensures we only show data from the latest scan
-	if err := e.store.DeleteClassificationsForAsset(ctx, asset.ID); err != nil {
-		e.logger.Error("failed to clear old classifications", "asset_id", asset.ID, "error", err)
-	}
-	if err := e.store.DeleteFindingsForAsset(ctx, asset.ID); err != nil {
-		e.logger.Error("failed to clear old findings", "asset_id", asset.ID, "error", err)
+	if scope != nil && scope.Objects != nil {
+		// Targeted rescan: only the rescanned objects are replaced, along with the
+		// bucket findings the scanner raises again for every bucket it visits
+		objects := scope.Objects[asset.Name]
+		if err := e.store.DeleteClassificationsForObjects(ctx, asset.ID, objects); err != nil {
+			e.logger.Error("failed to clear old object classifications", "asset_id", asset.ID, "error", err)
+		}
+		if err := e.store.DeleteFindingsForObjects(ctx, asset.ID, scanner.BucketFindingTypes, objects); err != nil {
+			e.logger.Error("failed to clear old object findings", "asset_id", asset.ID, "error", err)
+		}
+	} else {
+		if err := e.store.DeleteClassificationsForAsset(ctx, asset.ID); err != nil {
+			e.logger.Error("failed to clear old classifications", "asset_id", asset.ID, "error", err)
+		}
+		if err := e.store.DeleteFindingsForAsset(ctx, asset.ID); err != nil {
+			e.logger.Error("failed to clear old findings", "asset_id", asset.ID, "error", err)
+		}
 	}
 
 	// Track the mapping from scanner-generated ID to actual database ID
@@ -461,6 +675,7 @@ func (e *ScanExecutor) saveClassification(ctx context.Context, result *scanner.C
 			ObjectPath:      result.ObjectPath,
 			ObjectSize:      result.ObjectSize,
 			RuleName:        match.RuleName,
+			RuleVersion:     match.RuleVersion,
 			Category:        match.Category,
 			Sensitivity:     match.Sensitivity,
 			FindingCount:    match.Count,
@@ -523,13 +738,3 @@ func (e *ScanExecutor) saveFinding(ctx context.Context, accountID uuid.UUID, res
 		e.logger.Error("failed to save finding", "title", finding.Title, "error", err)
 	}
 }
-
-func getStringFromConfig(config models.JSONB, key, defaultVal string) string {
-	if config == nil {
-		return defaultVal
-	}
-	if val, ok := config[key].(string); ok && val != "" {
-		return val
-	}
-	return defaultVal
-}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/accessscan"
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/store"
+)
+
+// skipIfNoTestDB skips the test if no test database is available
+func skipIfNoTestDB(t *testing.T) *store.Store {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		dsn = "host=localhost port=5432 user=dspm password=dspm_password dbname=dspm_test sslmode=disable"
+	}
+	st, err := store.New(store.Config{DSN: dsn, MaxOpenConns: 5, MaxIdleConns: 2})
+	if err != nil {
+		t.Skipf("Skipping test, database not available: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := st.Ping(ctx); err != nil {
+		st.Close()
+		t.Skipf("Skipping test, database not reachable: %v", err)
+	}
+	return st
+}
+
+// authorizationConnector serves fixed authorization details
+type authorizationConnector struct {
+	details *connectors.AuthorizationDetails
+}
+
+func (c *authorizationConnector) Provider() models.Provider          { return models.ProviderAWS }
+func (c *authorizationConnector) Validate(ctx context.Context) error { return nil }
+func (c *authorizationConnector) Close() error                       { return nil }
+func (c *authorizationConnector) GetAuthorizationDetails(ctx context.Context) (*connectors.AuthorizationDetails, error) {
+	return c.details, nil
+}
+
+func TestScanExecutor_AccessAnalysis(t *testing.T) {
+	st := skipIfNoTestDB(t)
+	defer st.Close()
+	ctx := context.Background()
+
+	account := &models.CloudAccount{
+		Provider:        models.ProviderAWS,
+		ExternalID:      "test-access-" + uuid.New().String()[:8],
+		ConnectorConfig: models.JSONB{},
+	}
+	if err := st.CreateAccount(ctx, account); err != nil {
+		t.Fatalf("CreateAccount failed: %v", err)
+	}
+	defer func() { _ = st.DeleteAccount(ctx, account.ID) }()
+
+	bucket := &models.DataAsset{
+		AccountID:        account.ID,
+		ResourceType:     models.ResourceTypeS3Bucket,
+		ResourceARN:      "arn:aws:s3:::" + account.ExternalID,
+		Region:           "us-east-1",
+		Name:             account.ExternalID,
+		SensitivityLevel: models.SensitivityHigh,
+	}
+	if err := st.UpsertAsset(ctx, bucket); err != nil {
+		t.Fatalf("UpsertAsset failed: %v", err)
+	}
+
+	job := &models.ScanJob{AccountID: account.ID, ScanType: models.ScanTypeAccessAnalysis, TriggeredBy: "test"}
+	if err := st.CreateScanJob(ctx, job); err != nil {
+		t.Fatalf("CreateScanJob failed: %v", err)
+	}
+
+	const reader = "arn:aws:iam::111111111111:role/reader"
+	conn := &authorizationConnector{details: &connectors.AuthorizationDetails{Roles: []connectors.PrincipalDetails{{
+		Principal: connectors.Principal{ARN: reader, Name: "reader", Type: "ROLE"},
+		InlinePolicies: map[string]*connectors.PolicyDocument{"read": {Statements: []connectors.PolicyStatement{{
+			Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{bucket.ResourceARN + "/*"},
+		}}}},
+	}}}}
+
+	graph, err := access.NewMemoryGraph(ctx, nil)
+	if err != nil {
+		t.Fatalf("NewMemoryGraph failed: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	executor := NewScanExecutor(st, logger)
+	executor.SetAccessScanner(accessscan.New(st, graph, 90*24*time.Hour, logger))
+	executor.connect = func(ctx context.Context, account *models.CloudAccount) (connectors.Connector, error) {
+		return conn, nil
+	}
+
+	if err := executor.runScan(ctx, job, account); err != nil {
+		t.Fatalf("runScan failed: %v", err)
+	}
+
+	reachable, err := graph.FindBlastRadius(ctx, reader, 3)
+	if err != nil {
+		t.Fatalf("FindBlastRadius failed: %v", err)
+	}
+	if len(reachable) != 1 || reachable[0].AssetARN != bucket.ResourceARN {
+		t.Errorf("Expected reader to reach %s, got %+v", bucket.ResourceARN, reachable)
+	}
+
+	retrieved, err := st.GetScanJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetScanJob failed: %v", err)
+	}
+	if retrieved.ScannedAssets != 1 {
+		t.Errorf("Expected scanned_assets 1, got %d", retrieved.ScannedAssets)
+	}
+}
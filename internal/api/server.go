@@ -13,8 +13,11 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
 
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/accessscan"
 	"github.com/qualys/dspm/internal/aitracking"
 	"github.com/qualys/dspm/internal/auth"
+	"github.com/qualys/dspm/internal/classifier"
 	"github.com/qualys/dspm/internal/config"
 	"github.com/qualys/dspm/internal/encryption"
 	"github.com/qualys/dspm/internal/lineage"
@@ -65,6 +68,12 @@ type Server struct {
 
 	// Scan executor for background scanning
 	scanExecutor *ScanExecutor
+
+	// Redaction of stored match samples; its sealer opens originals for reviewers
+	redactionPolicy *classifier.RedactionPolicy
+
+	// Access graph for blast-radius queries; nil when no backend is reachable
+	graph access.GraphStore
 }
 
 type ServerOption func(*Server)
@@ -75,6 +84,13 @@ func WithLogger(logger *slog.Logger) ServerOption {
 	}
 }
 
+// WithGraph uses g as the access graph instead of opening the configured backend
+func WithGraph(g access.GraphStore) ServerOption {
+	return func(s *Server) {
+		s.graph = g
+	}
+}
+
 func NewServer(cfg *config.Config, opts ...ServerOption) (*Server, error) {
 	st, err := store.New(store.Config{
 		DSN:          cfg.Database.DSN(),
@@ -138,10 +154,45 @@ func NewServer(cfg *config.Config, opts ...ServerOption) (*Server, error) {
 	s.lineageService = lineage.NewService(st)
 	s.aiTrackingService = aitracking.NewService(st)
 	s.mlClassifier = mlclassifier.NewService(st)
+	s.mlClassifier.SetEscalationNotifier(s.notifyReviewEscalation)
+
+	s.redactionPolicy, err = cfg.Redaction.Policy()
+	if err != nil {
+		return nil, fmt.Errorf("initializing redaction: %w", err)
+	}
 	s.remediationService = remediation.NewService(&remediationStoreAdapter{st}, s.logger)
 
+	if s.graph == nil {
+		s.graph, err = access.NewStore(context.Background(), access.StoreConfig{
+			Backend: cfg.Graph.Backend,
+			Neo4j: access.Config{
+				URI:      cfg.Neo4j.URI,
+				Username: cfg.Neo4j.User,
+				Password: cfg.Neo4j.Password,
+			},
+			Persistence: cfg.Graph.Persistence,
+			Path:        cfg.Graph.Path,
+			DB:          st.DB(),
+		})
+		if err != nil {
+			s.logger.Warn("access graph unavailable", "backend", cfg.Graph.Backend, "error", err)
+			s.graph = nil
+		}
+	}
+
 	// Initialize scan executor
 	s.scanExecutor = NewScanExecutor(st, s.logger)
+	s.scanExecutor.SetRulesEngine(s.rulesEngine)
+	s.scanExecutor.SetRedactionPolicy(s.redactionPolicy)
+	s.scanExecutor.SetMLClassifier(s.mlClassifier)
+	s.scanExecutor.SetAccessScanner(accessscan.New(st, s.graph, cfg.Scanner.AccessLookback, s.logger))
+
+	handlers := &scheduler.DefaultHandlers{
+		TrainFunc:     s.trainFeedbackFilterJob,
+		CalibrateFunc: s.fitCalibrationJob,
+		EscalateFunc:  s.escalateReviewsJob,
+	}
+	handlers.Register(s.scheduler)
 
 	s.setupMiddleware()
 	s.setupRoutes()
@@ -244,6 +295,11 @@ func (s *Server) setupRoutes() {
 
 			r.Route("/classifications", func(r chi.Router) {
 				r.Get("/", s.listAllClassifications)
+				r.Group(func(r chi.Router) {
+					r.Use(auth.RequireRole(s.reviewerRoles()...))
+					r.Get("/{classificationID}/originals", s.getClassificationOriginals)
+				})
+				r.With(auth.RequireRole(auth.RoleAdmin)).Get("/{classificationID}/originals/access-log", s.getSampleAccessLog)
 			})
 
 			r.Route("/scans", func(r chi.Router) {
@@ -275,6 +331,9 @@ func (s *Server) setupRoutes() {
 				r.Post("/", s.createRule)
 				r.Get("/templates", s.getRuleTemplates)
 				r.Post("/test", s.testRule)
+				r.Get("/regression", s.runRuleRegression)
+				r.Post("/import", s.importRulePack)
+				r.Get("/export", s.exportRulePack)
 				r.Get("/{ruleID}", s.getRule)
 				r.Put("/{ruleID}", s.updateRule)
 				r.Delete("/{ruleID}", s.deleteRule)
@@ -306,15 +365,33 @@ func (s *Server) setupRoutes() {
 			r.Route("/ml", func(r chi.Router) {
 				r.Get("/models", s.listMLModels)
 				r.Get("/models/{modelID}", s.getMLModel)
+				r.Get("/models/{modelID}/evaluation", s.evaluateMLModel)
+				r.Group(func(r chi.Router) {
+					r.Use(auth.RequireRole(auth.RoleAdmin))
+					r.Post("/models/rollback", s.rollbackMLModel)
+					r.Post("/models/{modelID}/shadow", s.shadowMLModel)
+					r.Post("/models/{modelID}/promote", s.promoteMLModel)
+				})
 				r.Route("/review", func(r chi.Router) {
 					r.Get("/queue", s.getReviewQueue)
+					r.Post("/queue/bulk-resolve", s.bulkResolveReviewItems)
 					r.Get("/queue/{itemID}", s.getReviewItem)
 					r.Post("/queue/{itemID}/resolve", s.resolveReviewItem)
 					r.Post("/queue/{itemID}/assign", s.assignReviewItem)
+					r.Get("/routing-rules", s.listReviewRoutingRules)
+					r.Post("/routing-rules", s.createReviewRoutingRule)
+					r.Delete("/routing-rules/{ruleID}", s.deleteReviewRoutingRule)
+					r.Get("/metrics", s.getReviewMetrics)
 				})
 				r.Route("/feedback", func(r chi.Router) {
 					r.Post("/", s.submitTrainingFeedback)
 					r.Get("/stats", s.getFeedbackStats)
+					r.Post("/train", s.trainFeedbackFilter)
+				})
+				r.Route("/calibration", func(r chi.Router) {
+					r.Get("/", s.getCalibration)
+					r.Post("/fit", s.fitCalibration)
+					r.Get("/reliability", s.getReliabilityDiagram)
 				})
 			})
 
@@ -353,6 +430,17 @@ func (s *Server) setupRoutes() {
 				r.Post("/scan", s.triggerEncryptionScan)
 			})
 
+			// Access Graph Routes
+			r.Route("/access", func(r chi.Router) {
+				r.Get("/blast-radius", s.getBlastRadius)
+				r.Post("/simulate", s.simulateAccess)
+				r.Group(func(r chi.Router) {
+					r.Use(auth.RequireRole(auth.RoleAdmin))
+					r.Get("/export", s.exportAccessGraph)
+					r.Post("/import", s.importAccessGraph)
+				})
+			})
+
 			// Remediation Routes
 			r.Route("/remediation", func(r chi.Router) {
 				r.Get("/", s.listRemediationActions)
@@ -396,7 +484,13 @@ func (s *Server) Run(ctx context.Context) error {
 		s.scheduler.Stop()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		return s.http.Shutdown(shutdownCtx)
+		err := s.http.Shutdown(shutdownCtx)
+		if s.graph != nil {
+			if cerr := s.graph.Close(shutdownCtx); cerr != nil {
+				s.logger.Error("failed to close access graph", "error", cerr)
+			}
+		}
+		return err
 	}
 }
 
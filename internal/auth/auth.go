@@ -37,6 +37,8 @@ const (
 	RoleAdmin  Role = "admin"
 	RoleUser   Role = "user"
 	RoleViewer Role = "viewer"
+	// RoleReviewer may view encrypted originals of matched values (see config redaction.reviewer_roles)
+	RoleReviewer Role = "reviewer"
 )
 
 type Claims struct {
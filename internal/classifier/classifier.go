@@ -2,6 +2,7 @@ package classifier
 
 import (
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -19,12 +20,34 @@ type Rule struct {
 	ContextRequired  bool             // If true, requires context pattern match
 	ContextDistance  int              // Max chars from match to check for context (0 = whole file)
 	Validators       []Validator      // Additional validation functions
+	Version          string           // Identifies the rule revision that produced a match
+	Fixtures         Fixtures         // Examples checked by the regression harness
+	Condition        Condition        // Optional predicate over the whole object (nil = none)
 }
 
 type Validator func(match string) bool
 
+// ObjectMetadata describes the object being classified, for rules with conditions
+type ObjectMetadata struct {
+	Bucket     string
+	Path       string
+	Size       int64
+	BucketTags map[string]string
+}
+
+// Condition is an additional predicate a rule must satisfy before its matches are
+// reported. It sees the whole content and, when known, the object's metadata.
+type Condition interface {
+	Evaluate(content string, meta *ObjectMetadata) bool
+}
+
+// BuiltinRulesVersion is recorded on matches produced by DefaultRules.
+// Bump it whenever a built-in pattern, validator or exclusion changes.
+const BuiltinRulesVersion = "builtin@1"
+
 type Match struct {
 	RuleName    string
+	RuleVersion string
 	Category    models.Category
 	Sensitivity models.Sensitivity
 	Value       string // Redacted value
@@ -43,6 +66,11 @@ type SampleMatch struct {
 	ColumnName   string // Header/field name if available
 	MaskedValue  string // The matched value, masked for security
 	Context      string // Surrounding text (also masked)
+	// Encrypted original value, set by RedactionPolicy.SealOriginals when the
+	// category's policy stores originals
+	SealedOriginal string
+	// original is the unredacted value, held only until it is sealed
+	original string
 }
 
 type Result struct {
@@ -53,7 +81,8 @@ type Result struct {
 }
 
 type Classifier struct {
-	rules []*Rule
+	rules     []*Rule
+	redaction *RedactionPolicy
 }
 
 func New() *Classifier {
@@ -72,7 +101,22 @@ func (c *Classifier) AddRule(rule *Rule) {
 	c.rules = append(c.rules, rule)
 }
 
+// SetRedactionPolicy sets how matched values are redacted per category.
+// Without a policy all values are partially masked.
+func (c *Classifier) SetRedactionPolicy(policy *RedactionPolicy) {
+	c.redaction = policy
+}
+
 func (c *Classifier) Classify(content string) *Result {
+	return c.ClassifyObject(content, nil)
+}
+
+// ClassifyObject classifies content read from an object, making the object's
+// metadata available to rule conditions. meta may be nil.
+func (c *Classifier) ClassifyObject(content string, meta *ObjectMetadata) *Result {
+	if meta == nil {
+		meta = &ObjectMetadata{}
+	}
 	result := &Result{
 		MaxSensitivity: models.SensitivityUnknown,
 	}
@@ -81,20 +125,25 @@ func (c *Classifier) Classify(content string) *Result {
 	lines := strings.Split(content, "\n")
 
 	for _, rule := range c.rules {
+		if rule.Condition != nil && !rule.Condition.Evaluate(content, meta) {
+			continue
+		}
 		matches := c.findMatches(content, lines, rule)
 		if len(matches) > 0 {
 			match := Match{
 				RuleName:    rule.Name,
+				RuleVersion: ruleVersion(rule),
 				Category:    rule.Category,
 				Sensitivity: rule.Sensitivity,
 				Count:       len(matches),
 				Confidence:  1.0, // Default confidence
 			}
 
-			// Build sample matches with full context (up to 5)
+			// Build sample matches with full context (up to 5); values are
+			// redacted below according to the category's policy
+			var originals []string
 			for i, m := range matches {
 				if i == 0 {
-					match.Value = redact(m.value)
 					if m.colName != "" {
 						match.ColumnName = m.colName
 					}
@@ -107,10 +156,10 @@ func (c *Classifier) Classify(content string) *Result {
 						LineNumber:   m.lineNum,
 						ColumnNumber: m.colNum,
 						ColumnName:   m.colName,
-						MaskedValue:  redact(m.value),
-						Context:      redactContext(m.context, m.value),
+						Context:      m.context,
 					}
 					match.SampleMatches = append(match.SampleMatches, sample)
+					originals = append(originals, m.value)
 				}
 
 				if len(match.LineNumbers) >= 10 {
@@ -118,6 +167,8 @@ func (c *Classifier) Classify(content string) *Result {
 				}
 			}
 
+			c.redaction.redactSamples(rule.Category, &match, originals)
+
 			result.Matches = append(result.Matches, match)
 			result.TotalFindings += match.Count
 			categorySet[rule.Category] = true
@@ -135,6 +186,13 @@ func (c *Classifier) Classify(content string) *Result {
 	return result
 }
 
+func ruleVersion(rule *Rule) string {
+	if rule.Version == "" {
+		return BuiltinRulesVersion
+	}
+	return rule.Version
+}
+
 type rawMatch struct {
 	value      string
 	lineNum    int
@@ -183,8 +241,7 @@ func (c *Classifier) findMatches(content string, lines []string, rule *Rule) []r
 
 	for lineNum, line := range lines {
 		for _, pattern := range rule.Patterns {
-			foundIndexes := pattern.FindAllStringIndex(line, -1)
-			for _, idx := range foundIndexes {
+			for _, idx := range findValueIndexes(pattern, line) {
 				matchValue := line[idx[0]:idx[1]]
 
 				valid := true
@@ -289,7 +346,32 @@ func (c *Classifier) findMatches(content string, lines []string, rule *Rule) []r
 	return matches
 }
 
+// findValueIndexes returns the spans of pattern's matches in line. For a
+// pattern with a group named "value" the span is that group's, so a pattern
+// can match surrounding text it does not report.
+func findValueIndexes(pattern *regexp.Regexp, line string) [][]int {
+	group := pattern.SubexpIndex("value")
+	if group < 0 {
+		return pattern.FindAllStringIndex(line, -1)
+	}
+	var indexes [][]int
+	for _, m := range pattern.FindAllStringSubmatchIndex(line, -1) {
+		if m[2*group] >= 0 {
+			indexes = append(indexes, m[2*group:2*group+2])
+		}
+	}
+	return indexes
+}
+
 func DefaultRules() []*Rule {
+	rules := append(defaultRules(), specialCategoryRules()...)
+	for _, rule := range rules {
+		rule.Fixtures = builtinFixtures[rule.Name]
+	}
+	return rules
+}
+
+func defaultRules() []*Rule {
 	return []*Rule{
 		{
 			Name:        "SSN",
@@ -602,6 +684,31 @@ func DefaultRules() []*Rule {
 	}
 }
 
+// namedValidators exposes the built-in validators to declarative rule definitions
+var namedValidators = map[string]Validator{
+	"us_phone":    ValidateUSPhone,
+	"ssn":         ValidateSSN,
+	"luhn":        ValidateLuhn,
+	"aba_routing": ValidateABARouting,
+	"iban":        ValidateIBAN,
+}
+
+// ValidatorByName returns the built-in validator registered under name
+func ValidatorByName(name string) (Validator, bool) {
+	v, ok := namedValidators[name]
+	return v, ok
+}
+
+// ValidatorNames lists the names accepted by ValidatorByName, sorted
+func ValidatorNames() []string {
+	names := make([]string, 0, len(namedValidators))
+	for name := range namedValidators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func ValidateUSPhone(phone string) bool {
 	// Extract digits only
 	var digits strings.Builder
@@ -782,16 +889,26 @@ var sensitiveContextPatterns = []*regexp.Regexp{
 
 // redactContext masks the sensitive value AND any other potentially sensitive patterns in the context string
 func redactContext(context, sensitiveValue string) string {
+	return maskContext(context, sensitiveValue, redact(sensitiveValue))
+}
+
+// valuePlaceholder stands in for the matched value while the rest of the context is
+// masked. It contains an asterisk so patterns overlapping it are left alone, and it
+// keeps replacements such as HMAC tokens from being masked a second time.
+const valuePlaceholder = "*\x00*"
+
+// maskContext replaces the sensitive value with masked and masks any other
+// potentially sensitive patterns in the context string
+func maskContext(context, sensitiveValue, masked string) string {
 	if context == "" {
 		return context
 	}
 
 	result := context
 
-	// First, mask the primary sensitive value
+	// First, set aside the primary sensitive value
 	if sensitiveValue != "" {
-		masked := redact(sensitiveValue)
-		result = strings.ReplaceAll(result, sensitiveValue, masked)
+		result = strings.ReplaceAll(result, sensitiveValue, valuePlaceholder)
 	}
 
 	// Then, mask any other sensitive patterns found in the context
@@ -805,7 +922,7 @@ func redactContext(context, sensitiveValue string) string {
 		})
 	}
 
-	return result
+	return strings.ReplaceAll(result, valuePlaceholder, masked)
 }
 
 func compareSensitivity(a, b models.Sensitivity) int {
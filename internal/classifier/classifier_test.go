@@ -470,3 +470,51 @@ func BenchmarkClassifier(b *testing.B) {
 		c.Classify(content)
 	}
 }
+
+func TestClassifier_SpecialCategories(t *testing.T) {
+	c := New()
+
+	tests := []struct {
+		name     string
+		content  string
+		rule     string
+		expected bool
+	}{
+		{"english health", "Patient: John Smith, diagnosis: type 2 diabetes", "GDPR_HEALTH", true},
+		{"german religion", "Mitarbeiter Hans Müller, Konfession: römisch-katholisch", "GDPR_RELIGION", true},
+		{"french ethnicity", "Nom: Dupont, Prénom: Marie, origine ethnique: maghrébine", "GDPR_ETHNICITY", true},
+		{"spanish trade union", "Empleado: Juan García, afiliación sindical: CCOO", "GDPR_TRADE_UNION", true},
+		{"biometric field name", "employee_id=4411 fingerprint_template=8f3a91", "GDPR_BIOMETRIC", true},
+		{"no identifiable person", "Diabetes is a chronic condition affecting millions", "GDPR_HEALTH", false},
+		{"policy text", "Employee sick leave policy: notify your manager", "GDPR_HEALTH", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := c.Classify(tt.content)
+			found := false
+			for _, m := range result.Matches {
+				if m.RuleName == tt.rule {
+					found = true
+					if m.Sensitivity != models.SensitivityCritical || !m.Category.IsSpecial() {
+						t.Errorf("expected a critical special category, got %s %s", m.Sensitivity, m.Category)
+					}
+				}
+			}
+			if found != tt.expected {
+				t.Errorf("expected %s found=%v, got %v", tt.rule, tt.expected, found)
+			}
+		})
+	}
+
+	// The value span excludes the boundary characters around the term
+	pattern := SpecialCategoryLexicon(models.CategoryReligion).Pattern()
+	line := "religion=(katholisch)"
+	var values []string
+	for _, idx := range findValueIndexes(pattern, line) {
+		values = append(values, line[idx[0]:idx[1]])
+	}
+	if strings.Join(values, ",") != "religion,katholisch" {
+		t.Errorf("expected values religion,katholisch, got %v", values)
+	}
+}
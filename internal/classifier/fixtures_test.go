@@ -0,0 +1,89 @@
+package classifier
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+func TestBuiltinRuleFixtures(t *testing.T) {
+	for _, rule := range DefaultRules() {
+		if rule.Fixtures.Empty() {
+			t.Errorf("built-in rule %s has no fixtures", rule.Name)
+			continue
+		}
+		if err := CheckFixtures(rule); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestEvaluateFixtures_ReportsFailures(t *testing.T) {
+	rules := DefaultRules()
+	for _, rule := range rules {
+		if rule.Name == "SSN" {
+			// Dropping the validator lets invalid area numbers through
+			rule.Validators = nil
+		}
+	}
+
+	report := EvaluateFixtures(rules)
+	if report.Passed {
+		t.Fatal("expected report to fail")
+	}
+
+	for _, result := range report.Results {
+		if result.Rule != "SSN" {
+			if !result.Passed() {
+				t.Errorf("rule %s unexpectedly failed: %+v", result.Rule, result.Failures)
+			}
+			continue
+		}
+		if result.FalsePositives != 3 || result.TruePositives != 2 {
+			t.Errorf("unexpected SSN counts: %+v", result)
+		}
+		if result.Precision != 0.4 || result.Recall != 1 {
+			t.Errorf("expected precision 0.4 and recall 1, got %.2f and %.2f", result.Precision, result.Recall)
+		}
+	}
+}
+
+func TestEvaluateFixtures_CrossMatchesLowerPrecision(t *testing.T) {
+	// Any 9 digits is an employee ID, which also catches the account numbers
+	employee := &Rule{
+		Name:        "EMPLOYEE_ID",
+		Category:    models.CategoryPII,
+		Sensitivity: models.SensitivityMedium,
+		Patterns:    []*regexp.Regexp{regexp.MustCompile(`\b\d{9}\b`)},
+		Fixtures:    Fixtures{Positive: []string{"employee 482910375"}, Negative: []string{"employee E-4829"}},
+	}
+	account := &Rule{
+		Name:        "ACCOUNT_NUMBER",
+		Category:    models.CategoryPCI,
+		Sensitivity: models.SensitivityHigh,
+		Patterns:    []*regexp.Regexp{regexp.MustCompile(`\bACCT-\d{9}\b`)},
+		Fixtures:    Fixtures{Positive: []string{"ACCT-123456789", "ACCT-987654321"}},
+	}
+
+	report := EvaluateFixtures([]*Rule{employee, account})
+	if !report.Passed {
+		t.Fatal("expected cross matches not to fail the report")
+	}
+
+	result := report.Results[0]
+	if !reflect.DeepEqual(result.CrossMatches, []string{"ACCOUNT_NUMBER"}) {
+		t.Errorf("expected a cross match on ACCOUNT_NUMBER, got %v", result.CrossMatches)
+	}
+	if result.TruePositives != 1 || result.FalsePositives != 2 {
+		t.Errorf("expected 1 true and 2 false positives, got %d and %d", result.TruePositives, result.FalsePositives)
+	}
+	if want := 1.0 / 3; result.Precision != want || result.Recall != 1 {
+		t.Errorf("expected precision %.2f and recall 1, got %.2f and %.2f", want, result.Precision, result.Recall)
+	}
+
+	if other := report.Results[1]; other.Precision != 1 || len(other.CrossMatches) != 0 {
+		t.Errorf("expected ACCOUNT_NUMBER to keep precision 1, got %.2f with cross matches %v", other.Precision, other.CrossMatches)
+	}
+}
@@ -0,0 +1,88 @@
+package classifier
+
+import (
+	"github.com/qualys/dspm/internal/metadata"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// metadataRules are the rules reported for personal data found in image and
+// document metadata rather than in text content
+var metadataRules = map[metadata.Kind]*Rule{
+	metadata.KindGPS: {
+		Name:        "METADATA_GPS_LOCATION",
+		Category:    models.CategoryPII,
+		Sensitivity: models.SensitivityHigh,
+	},
+	metadata.KindDeviceSerial: {
+		Name:        "METADATA_DEVICE_SERIAL",
+		Category:    models.CategoryPII,
+		Sensitivity: models.SensitivityMedium,
+	},
+	metadata.KindAuthor: {
+		Name:        "METADATA_AUTHOR_NAME",
+		Category:    models.CategoryPII,
+		Sensitivity: models.SensitivityMedium,
+	},
+	metadata.KindFaceRegion: {
+		Name:        "METADATA_FACE_REGION",
+		Category:    models.CategoryPII,
+		Sensitivity: models.SensitivityHigh,
+	},
+}
+
+// ClassifyMetadata turns the personal data found in a file's metadata into
+// matches, one per kind of field. The tag a value came from is used as its
+// column name and context, and values are redacted like content matches.
+func (c *Classifier) ClassifyMetadata(fields []metadata.Field) *Result {
+	result := &Result{
+		MaxSensitivity: models.SensitivityUnknown,
+	}
+
+	categorySet := make(map[models.Category]bool)
+	for _, kind := range metadata.Kinds {
+		rule := metadataRules[kind]
+		var originals []string
+		match := Match{
+			RuleName:    rule.Name,
+			RuleVersion: ruleVersion(rule),
+			Category:    rule.Category,
+			Sensitivity: rule.Sensitivity,
+			Confidence:  1.0,
+		}
+		for _, f := range fields {
+			if f.Kind != kind {
+				continue
+			}
+			match.Count++
+			if match.ColumnName == "" {
+				match.ColumnName = f.Tag
+			}
+			if len(match.SampleMatches) < 5 {
+				match.SampleMatches = append(match.SampleMatches, SampleMatch{
+					ColumnName: f.Tag,
+					Context:    f.Tag + ": " + f.Value,
+				})
+				originals = append(originals, f.Value)
+			}
+		}
+		if match.Count == 0 {
+			continue
+		}
+
+		c.redaction.redactSamples(rule.Category, &match, originals)
+
+		result.Matches = append(result.Matches, match)
+		result.TotalFindings += match.Count
+		categorySet[rule.Category] = true
+
+		if compareSensitivity(rule.Sensitivity, result.MaxSensitivity) > 0 {
+			result.MaxSensitivity = rule.Sensitivity
+		}
+	}
+
+	for cat := range categorySet {
+		result.Categories = append(result.Categories, cat)
+	}
+
+	return result
+}
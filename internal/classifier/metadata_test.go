@@ -0,0 +1,57 @@
+package classifier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qualys/dspm/internal/metadata"
+	"github.com/qualys/dspm/internal/models"
+)
+
+func TestClassifier_ClassifyMetadata(t *testing.T) {
+	c := New()
+	fields := []metadata.Field{
+		{Kind: metadata.KindAuthor, Tag: "EXIF:Artist", Value: "Jane Doe"},
+		{Kind: metadata.KindGPS, Tag: "EXIF:GPSLatitude/GPSLongitude", Value: "37.774900, -122.419400"},
+		{Kind: metadata.KindAuthor, Tag: "XMP:dc:creator", Value: "Pierre Martin"},
+	}
+
+	result := c.ClassifyMetadata(fields)
+	if len(result.Matches) != 2 || result.TotalFindings != 3 {
+		t.Fatalf("expected 2 matches for 3 fields, got %d for %d", len(result.Matches), result.TotalFindings)
+	}
+	if result.MaxSensitivity != models.SensitivityHigh {
+		t.Errorf("expected max sensitivity HIGH, got %s", result.MaxSensitivity)
+	}
+
+	gps := result.Matches[0]
+	if gps.RuleName != "METADATA_GPS_LOCATION" || gps.Category != models.CategoryPII || gps.ColumnName != "EXIF:GPSLatitude/GPSLongitude" {
+		t.Errorf("unexpected GPS match %+v", gps)
+	}
+	authors := result.Matches[1]
+	if authors.RuleName != "METADATA_AUTHOR_NAME" || authors.Count != 2 || len(authors.SampleMatches) != 2 {
+		t.Fatalf("unexpected author match %+v", authors)
+	}
+	for _, sample := range authors.SampleMatches {
+		if strings.Contains(sample.Context, "Jane Doe") || strings.Contains(sample.Context, "Pierre Martin") {
+			t.Errorf("context leaks the original value: %q", sample.Context)
+		}
+		if !strings.HasPrefix(sample.Context, sample.ColumnName+": ") {
+			t.Errorf("expected the tag as context, got %q", sample.Context)
+		}
+	}
+
+	// Suppressed categories keep counts but no values
+	c.SetRedactionPolicy(&RedactionPolicy{
+		Categories: map[models.Category]CategoryRedaction{models.CategoryPII: {Strategy: RedactSuppress}},
+	})
+	for _, m := range c.ClassifyMetadata(fields).Matches {
+		if m.Value != "" || m.SampleMatches != nil {
+			t.Errorf("expected suppressed values, got %+v", m)
+		}
+	}
+
+	if result := c.ClassifyMetadata(nil); len(result.Matches) != 0 || result.MaxSensitivity != models.SensitivityUnknown {
+		t.Errorf("expected no matches without fields, got %+v", result)
+	}
+}
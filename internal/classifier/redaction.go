@@ -0,0 +1,269 @@
+package classifier
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+// RedactionStrategy controls how matched values are written to Match.Value and SampleMatch
+type RedactionStrategy string
+
+const (
+	// RedactSuppress stores no value or samples, only counts and locations
+	RedactSuppress RedactionStrategy = "suppress"
+	// RedactPartial keeps the first and last two characters ("12*******89")
+	RedactPartial RedactionStrategy = "partial"
+	// RedactFormatPreserving keeps length, separators and character classes,
+	// and the last four characters of longer values ("999-99-6789")
+	RedactFormatPreserving RedactionStrategy = "format_preserving"
+	// RedactHMAC replaces the value with a keyed token, so equal values can be
+	// correlated across assets without revealing them ("hmac:3f9a...")
+	RedactHMAC RedactionStrategy = "hmac"
+)
+
+// ValidRedactionStrategy reports whether s is a known strategy
+func ValidRedactionStrategy(s RedactionStrategy) bool {
+	switch s {
+	case RedactSuppress, RedactPartial, RedactFormatPreserving, RedactHMAC:
+		return true
+	}
+	return false
+}
+
+// CategoryRedaction is the redaction setting for one category
+type CategoryRedaction struct {
+	Strategy RedactionStrategy
+	// StoreOriginal keeps an encrypted copy of each sample's original value for
+	// authorized reviewers. It requires RedactionPolicy.Sealer.
+	StoreOriginal bool
+}
+
+// Sealer encrypts original values kept for reviewers. A value is sealed to
+// associated data naming the record that holds it, and opening it with any
+// other associated data fails, so sealed values cannot be moved between records.
+type Sealer interface {
+	Seal(plaintext, associatedData string) (string, error)
+	Open(sealed, associatedData string) (string, error)
+}
+
+// RedactionPolicy chooses a redaction strategy per category. A nil policy
+// applies partial masking to every category.
+type RedactionPolicy struct {
+	Default    CategoryRedaction
+	Categories map[models.Category]CategoryRedaction
+	HMACKey    []byte
+	Sealer     Sealer
+}
+
+// Validate checks that every strategy is known and that the keys its settings need are present
+func (p *RedactionPolicy) Validate() error {
+	settings := map[string]CategoryRedaction{"default": p.Default}
+	for cat, setting := range p.Categories {
+		settings[string(cat)] = setting
+	}
+	for name, setting := range settings {
+		if setting.Strategy != "" && !ValidRedactionStrategy(setting.Strategy) {
+			return fmt.Errorf("%s: unknown redaction strategy %q", name, setting.Strategy)
+		}
+		if setting.Strategy == RedactHMAC && len(p.HMACKey) == 0 {
+			return fmt.Errorf("%s: hmac redaction requires an HMAC key", name)
+		}
+		if setting.StoreOriginal && p.Sealer == nil {
+			return fmt.Errorf("%s: storing originals requires an encryption key", name)
+		}
+	}
+	return nil
+}
+
+func (p *RedactionPolicy) forCategory(cat models.Category) CategoryRedaction {
+	if p == nil {
+		return CategoryRedaction{Strategy: RedactPartial}
+	}
+	setting, ok := p.Categories[cat]
+	if !ok {
+		setting = p.Default
+	}
+	if setting.Strategy == "" {
+		setting.Strategy = RedactPartial
+	}
+	return setting
+}
+
+// mask redacts a matched value with the category's strategy
+func (p *RedactionPolicy) mask(setting CategoryRedaction, value string) string {
+	switch setting.Strategy {
+	case RedactSuppress:
+		return ""
+	case RedactFormatPreserving:
+		return formatPreservingMask(value)
+	case RedactHMAC:
+		return p.token(value)
+	default:
+		return redact(value)
+	}
+}
+
+// token is a deterministic keyed fingerprint of value
+func (p *RedactionPolicy) token(value string) string {
+	mac := hmac.New(sha256.New, p.HMACKey)
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// formatPreservingMask replaces digits with 9 and letters with X/x, keeping
+// separators and, for values with more than eight letters or digits, the last four
+func formatPreservingMask(value string) string {
+	runes := []rune(value)
+	alnum := 0
+	for _, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			alnum++
+		}
+	}
+	keep := 0
+	if alnum > 8 {
+		keep = 4
+	}
+
+	seen := 0
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		seen++
+		if seen > alnum-keep {
+			continue
+		}
+		switch {
+		case unicode.IsDigit(r):
+			runes[i] = '9'
+		case unicode.IsUpper(r):
+			runes[i] = 'X'
+		default:
+			runes[i] = 'x'
+		}
+	}
+	return string(runes)
+}
+
+// redactSamples applies the category's strategy to a match and its samples.
+// Suppressed categories keep counts and line numbers but no values or samples.
+func (p *RedactionPolicy) redactSamples(cat models.Category, match *Match, originals []string) {
+	setting := p.forCategory(cat)
+	if setting.Strategy == RedactSuppress {
+		match.Value = ""
+		match.SampleMatches = nil
+		return
+	}
+
+	match.Value = p.mask(setting, originals[0])
+	for i := range match.SampleMatches {
+		sample := &match.SampleMatches[i]
+		original := originals[i]
+		masked := p.mask(setting, original)
+		sample.MaskedValue = masked
+		sample.Context = maskContext(sample.Context, original, masked)
+
+		if setting.StoreOriginal && p != nil && p.Sealer != nil {
+			sample.original = original
+		}
+	}
+}
+
+// HasOriginals reports whether any of the match's samples has an original
+// waiting for SealOriginals
+func (m *Match) HasOriginals() bool {
+	for _, sample := range m.SampleMatches {
+		if sample.original != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// SealOriginals encrypts the originals kept for a match's samples to the ID
+// of the classification that stores them, and drops the plaintext
+func (p *RedactionPolicy) SealOriginals(match *Match, classificationID string) {
+	for i := range match.SampleMatches {
+		sample := &match.SampleMatches[i]
+		if sample.original == "" {
+			continue
+		}
+		if p != nil && p.Sealer != nil {
+			if sealed, err := p.Sealer.Seal(sample.original, classificationID); err == nil {
+				sample.SealedOriginal = sealed
+			}
+		}
+		sample.original = ""
+	}
+}
+
+// AESSealer encrypts originals with AES-256-GCM. Sealed values are base64
+// encoded and carry their nonce.
+type AESSealer struct {
+	aead cipher.AEAD
+}
+
+// NewAESSealer creates a sealer from a 32-byte key
+func NewAESSealer(key []byte) (*AESSealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESSealer{aead: aead}, nil
+}
+
+func (s *AESSealer) Seal(plaintext, associatedData string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), []byte(associatedData))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *AESSealer) Open(sealed, associatedData string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < s.aead.NonceSize() {
+		return "", errors.New("sealed value too short")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// DecodeKey accepts a 32-byte key encoded as hex or base64
+func DecodeKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := hex.DecodeString(encoded); err == nil {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("key must be hex or base64 encoded")
+}
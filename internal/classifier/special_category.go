@@ -0,0 +1,174 @@
+package classifier
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Lexicon holds the terms revealing a category, keyed by language code
+type Lexicon map[string][]string
+
+// LexiconLanguages are the languages every special-category lexicon covers
+var LexiconLanguages = []string{"en", "de", "fr", "es"}
+
+// specialCategoryLexicons are the terms that reveal a GDPR Article 9 special
+// category about a person: field labels as well as the values stored in them
+var specialCategoryLexicons = map[models.Category]Lexicon{
+	models.CategoryHealth: {
+		"en": {"diagnosis", "diagnosed with", "medical condition", "chronic illness", "sick leave", "sick note",
+			"disability", "pregnant", "pregnancy", "diabetes", "cancer", "chemotherapy", "hiv positive",
+			"hepatitis", "tuberculosis", "epilepsy", "asthma", "depression", "anxiety disorder", "bipolar disorder",
+			"schizophrenia", "dementia", "multiple sclerosis", "mental health"},
+		"de": {"diagnose", "erkrankung", "krankheit", "krankmeldung", "arbeitsunfähigkeit", "arbeitsunfähig",
+			"behinderung", "schwerbehindert", "schwerbehinderung", "schwanger", "schwangerschaft", "diabetes",
+			"krebserkrankung", "chemotherapie", "hiv-positiv", "epilepsie", "depression", "psychische erkrankung"},
+		"fr": {"diagnostic", "maladie", "arrêt maladie", "arrêt de travail", "handicap", "handicapé", "handicapée",
+			"enceinte", "grossesse", "diabète", "cancer", "chimiothérapie", "séropositif", "séropositive",
+			"épilepsie", "dépression", "trouble bipolaire", "santé mentale"},
+		"es": {"diagnóstico", "enfermedad", "baja médica", "baja por enfermedad", "incapacidad temporal",
+			"discapacidad", "minusvalía", "embarazada", "embarazo", "diabetes", "cáncer", "quimioterapia",
+			"seropositivo", "seropositiva", "epilepsia", "depresión", "trastorno bipolar", "salud mental"},
+	},
+	models.CategoryReligion: {
+		"en": {"religion", "religious affiliation", "religious belief", "denomination", "catholic",
+			"protestant", "evangelical", "muslim", "islamic", "jewish", "hindu", "buddhist", "sikh", "atheist",
+			"mormon", "jehovah's witness"},
+		"de": {"religion", "religionszugehörigkeit", "konfession", "glaubensbekenntnis", "kirchensteuer",
+			"katholisch", "evangelisch", "römisch-katholisch", "muslimisch", "jüdisch", "buddhistisch",
+			"konfessionslos"},
+		"fr": {"religion", "confession religieuse", "appartenance religieuse", "croyance religieuse", "catholique",
+			"protestante", "musulman", "musulmane", "juif", "juive", "bouddhiste", "athée"},
+		"es": {"religión", "confesión religiosa", "creencia religiosa", "católico", "católica", "protestante",
+			"evangélico", "musulmán", "musulmana", "judío", "judía", "budista", "ateo", "atea"},
+	},
+	models.CategoryEthnicity: {
+		"en": {"ethnicity", "ethnic origin", "ethnic background", "ethnic group", "racial origin", "race/ethnicity",
+			"hispanic", "latino", "latina", "caucasian", "african american", "asian american", "native american",
+			"pacific islander"},
+		"de": {"ethnische herkunft", "ethnische zugehörigkeit", "ethnie", "volkszugehörigkeit",
+			"rassische herkunft", "migrationshintergrund"},
+		"fr": {"origine ethnique", "appartenance ethnique", "origine raciale", "ethnie"},
+		"es": {"origen étnico", "origen racial", "grupo étnico", "etnia", "hispano", "hispana", "gitano", "gitana"},
+	},
+	models.CategorySexualOrientation: {
+		"en": {"sexual orientation", "sexual preference", "sex life", "gay", "lesbian", "bisexual", "homosexual",
+			"heterosexual", "asexual", "pansexual", "queer", "lgbt", "lgbtq", "same-sex partner"},
+		"de": {"sexuelle orientierung", "sexuelle ausrichtung", "sexualleben", "schwul", "lesbisch", "bisexuell",
+			"homosexuell", "heterosexuell", "gleichgeschlechtlich"},
+		"fr": {"orientation sexuelle", "vie sexuelle", "homosexuel", "homosexuelle", "lesbienne", "bisexuel",
+			"bisexuelle", "hétérosexuel", "hétérosexuelle"},
+		"es": {"orientación sexual", "vida sexual", "homosexual", "lesbiana", "bisexual", "heterosexual",
+			"pareja del mismo sexo"},
+	},
+	models.CategoryBiometric: {
+		"en": {"biometric", "biometrics", "biometric template", "fingerprint", "fingerprint template",
+			"facial recognition", "face template", "faceprint", "face geometry", "iris scan", "retina scan",
+			"voiceprint", "palm print", "palm vein"},
+		"de": {"biometrisch", "biometrische daten", "fingerabdruck", "fingerabdrücke", "gesichtserkennung",
+			"gesichtsbild", "iris-scan", "irisscan", "stimmabdruck", "handvenen"},
+		"fr": {"biométrique", "données biométriques", "empreinte digitale", "empreintes digitales",
+			"reconnaissance faciale", "gabarit facial", "empreinte vocale", "scan de l'iris"},
+		"es": {"biométrico", "biométrica", "datos biométricos", "huella dactilar", "huellas dactilares",
+			"reconocimiento facial", "plantilla facial", "huella de voz", "escaneo de iris"},
+	},
+	models.CategoryTradeUnion: {
+		"en": {"trade union", "labor union", "labour union", "union membership", "union dues",
+			"union representative", "shop steward", "teamsters"},
+		"de": {"gewerkschaft", "gewerkschaftsmitglied", "gewerkschaftsmitgliedschaft", "gewerkschaftszugehörigkeit",
+			"gewerkschaftsbeitrag", "ig metall", "ver.di"},
+		"fr": {"syndicat", "syndiqué", "syndiquée", "adhésion syndicale", "appartenance syndicale",
+			"cotisation syndicale", "délégué syndical", "déléguée syndicale"},
+		"es": {"sindicato", "afiliación sindical", "afiliado al sindicato", "afiliada al sindicato",
+			"cuota sindical", "delegado sindical", "delegada sindical"},
+	},
+}
+
+// SpecialCategoryLexicon returns the lexicon for a special category, nil for
+// other categories
+func SpecialCategoryLexicon(category models.Category) Lexicon {
+	return specialCategoryLexicons[category]
+}
+
+// Terms returns the lexicon's terms in all languages, longest first and
+// without duplicates
+func (l Lexicon) Terms() []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, lang := range LexiconLanguages {
+		for _, term := range l[lang] {
+			term = strings.ToLower(term)
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	sort.SliceStable(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	return terms
+}
+
+// Pattern compiles the lexicon into a case-insensitive pattern matching whole
+// terms, with words also separated by underscores as in field names. Go's \b
+// only knows ASCII word characters, so the boundaries are matched explicitly
+// and the term itself is captured as the value group.
+func (l Lexicon) Pattern() *regexp.Regexp {
+	terms := l.Terms()
+	alternatives := make([]string, len(terms))
+	for i, term := range terms {
+		alternatives[i] = strings.ReplaceAll(regexp.QuoteMeta(term), " ", `[\s_]+`)
+	}
+	return regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}])(?P<value>` + strings.Join(alternatives, "|") + `)(?:[^\p{L}\p{N}]|$)`)
+}
+
+// identifiablePersonPatterns indicate a record is about an identifiable
+// person: name fields, roles, salutations, birth dates and email addresses
+var identifiablePersonPatterns = []*regexp.Regexp{
+	// English
+	regexp.MustCompile(`(?i)(\bname\b|full.?name|first.?name|last.?name|surname|\bpatient|\bemployee|\bstaff\b|\bcustomer|\bclient\b|\bmember\b|\bapplicant|\bcandidate|\b(mr|mrs|ms)\.?\s|date.of.birth|\bdob\b)`),
+	// German
+	regexp.MustCompile(`(?i)(vorname|nachname|patientin|mitarbeiter|angestellte|\bkunde|\bkundin|\bmitglied|bewerber|\bherr\b|\bfrau\b|geburtsdatum|personalnummer)`),
+	// French
+	regexp.MustCompile(`(?i)(\bnom\b|prénom|employé|salarié|\bmembre\b|\bcandidat|\bmme\b|\bm\.\s|date de naissance)`),
+	// Spanish
+	regexp.MustCompile(`(?i)(\bnombre|apellido|paciente|empleado|empleada|trabajador|\bcliente|\bmiembro|solicitante|\b(sr|sra)\.?\s|fecha de nacimiento)`),
+	regexp.MustCompile(`(?i)[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}`),
+}
+
+// specialCategoryExclusions suppress terms in text about people in general
+// rather than a particular person, such as policies and statistics
+var specialCategoryExclusions = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(policy|policies|guideline|statistic|survey results|richtlinie|statistik|politique|statistique|política|estadística)`),
+}
+
+// specialCategoryRuleNames names the built-in rule for each special category
+var specialCategoryRuleNames = map[models.Category]string{
+	models.CategoryHealth:            "GDPR_HEALTH",
+	models.CategoryReligion:          "GDPR_RELIGION",
+	models.CategoryEthnicity:         "GDPR_ETHNICITY",
+	models.CategorySexualOrientation: "GDPR_SEXUAL_ORIENTATION",
+	models.CategoryBiometric:         "GDPR_BIOMETRIC",
+	models.CategoryTradeUnion:        "GDPR_TRADE_UNION",
+}
+
+// specialCategoryRules returns a rule per special category. A lexicon term
+// only matches near something identifying a person, since Article 9 covers
+// data revealing the attribute about an identifiable individual.
+func specialCategoryRules() []*Rule {
+	rules := make([]*Rule, 0, len(models.SpecialCategories))
+	for _, category := range models.SpecialCategories {
+		rules = append(rules, &Rule{
+			Name:             specialCategoryRuleNames[category],
+			Category:         category,
+			Sensitivity:      models.SensitivityCritical,
+			Patterns:         []*regexp.Regexp{specialCategoryLexicons[category].Pattern()},
+			ContextPatterns:  identifiablePersonPatterns,
+			NegativePatterns: specialCategoryExclusions,
+			ContextRequired:  true,
+			ContextDistance:  200,
+		})
+	}
+	return rules
+}
@@ -7,6 +7,7 @@ import (
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/qualys/dspm/internal/classifier"
 	"github.com/qualys/dspm/internal/models"
 )
 
@@ -15,12 +16,14 @@ type Config struct {
 	Database      DatabaseConfig      `yaml:"database"`
 	Redis         RedisConfig         `yaml:"redis"`
 	Neo4j         Neo4jConfig         `yaml:"neo4j"`
+	Graph         GraphConfig         `yaml:"graph"`
 	Scanner       ScannerConfig       `yaml:"scanner"`
 	AWS           AWSConfig           `yaml:"aws"`
 	Azure         AzureConfig         `yaml:"azure"`
 	GCP           GCPConfig           `yaml:"gcp"`
 	Auth          AuthConfig          `yaml:"auth"`
 	Notifications NotificationsConfig `yaml:"notifications"`
+	Redaction     RedactionConfig     `yaml:"redaction"`
 }
 
 type AuthConfig struct {
@@ -29,6 +32,60 @@ type AuthConfig struct {
 	RefreshTokenExpiry time.Duration `yaml:"refresh_token_expiry"`
 }
 
+// RedactionConfig controls how matched values are stored on classifications.
+// Categories not listed use Default; strategies are suppress, partial,
+// format_preserving and hmac.
+type RedactionConfig struct {
+	Default    RedactionSetting            `yaml:"default"`
+	Categories map[string]RedactionSetting `yaml:"categories"`
+	// Key for hmac tokens; any non-empty string
+	HMACKey string `yaml:"hmac_key"`
+	// 32-byte AES key, hex or base64 encoded, required for store_original
+	EncryptionKey string `yaml:"encryption_key"`
+	// Roles allowed to view stored originals
+	ReviewerRoles []string `yaml:"reviewer_roles"`
+}
+
+type RedactionSetting struct {
+	Strategy      string `yaml:"strategy"`
+	StoreOriginal bool   `yaml:"store_original"`
+}
+
+// Policy builds the classifier redaction policy described by the config
+func (c RedactionConfig) Policy() (*classifier.RedactionPolicy, error) {
+	policy := &classifier.RedactionPolicy{
+		Default: classifier.CategoryRedaction{
+			Strategy:      classifier.RedactionStrategy(c.Default.Strategy),
+			StoreOriginal: c.Default.StoreOriginal,
+		},
+		Categories: make(map[models.Category]classifier.CategoryRedaction, len(c.Categories)),
+		HMACKey:    []byte(c.HMACKey),
+	}
+	for cat, setting := range c.Categories {
+		policy.Categories[models.Category(cat)] = classifier.CategoryRedaction{
+			Strategy:      classifier.RedactionStrategy(setting.Strategy),
+			StoreOriginal: setting.StoreOriginal,
+		}
+	}
+
+	if c.EncryptionKey != "" {
+		key, err := classifier.DecodeKey(c.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("redaction encryption key: %w", err)
+		}
+		sealer, err := classifier.NewAESSealer(key)
+		if err != nil {
+			return nil, fmt.Errorf("redaction encryption key: %w", err)
+		}
+		policy.Sealer = sealer
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("redaction: %w", err)
+	}
+	return policy, nil
+}
+
 type NotificationsConfig struct {
 	MinSeverity models.Sensitivity `yaml:"min_severity"`
 	Slack       SlackNotifyConfig  `yaml:"slack"`
@@ -94,6 +151,15 @@ type Neo4jConfig struct {
 	Password string `yaml:"password"`
 }
 
+// GraphConfig selects where the access graph is kept: neo4j, or memory for
+// the embedded backend, which persists to postgres, a local file at Path,
+// or none
+type GraphConfig struct {
+	Backend     string `yaml:"backend"`
+	Persistence string `yaml:"persistence"`
+	Path        string `yaml:"path"`
+}
+
 type ScannerConfig struct {
 	Workers          int           `yaml:"workers"`
 	BatchSize        int           `yaml:"batch_size"`
@@ -103,6 +169,9 @@ type ScannerConfig struct {
 	FilesPerBucket   int           `yaml:"files_per_bucket"`
 	RandomSamplePct  float64       `yaml:"random_sample_pct"`
 	EnabledProviders []string      `yaml:"enabled_providers"`
+	// AccessLookback is how far back access scans read data events when
+	// recommending least-privilege policies
+	AccessLookback time.Duration `yaml:"access_lookback"`
 }
 
 type AWSConfig struct {
@@ -195,6 +264,13 @@ func (c *Config) applyDefaults() {
 		c.Neo4j.URI = "bolt://localhost:7687"
 	}
 
+	if c.Graph.Backend == "" {
+		c.Graph.Backend = "neo4j"
+	}
+	if c.Graph.Backend == "memory" && c.Graph.Persistence == "" {
+		c.Graph.Persistence = "postgres"
+	}
+
 	if c.Scanner.Workers == 0 {
 		c.Scanner.Workers = 10
 	}
@@ -216,6 +292,9 @@ func (c *Config) applyDefaults() {
 	if c.Scanner.RandomSamplePct == 0 {
 		c.Scanner.RandomSamplePct = 0.10
 	}
+	if c.Scanner.AccessLookback == 0 {
+		c.Scanner.AccessLookback = 90 * 24 * time.Hour
+	}
 
 	if c.Auth.JWTSecret == "" {
 		c.Auth.JWTSecret = "change-me-in-production"
@@ -235,4 +314,8 @@ func (c *Config) applyDefaults() {
 	if c.Notifications.Email.SMTPPort == 0 {
 		c.Notifications.Email.SMTPPort = 587
 	}
+
+	if len(c.Redaction.ReviewerRoles) == 0 {
+		c.Redaction.ReviewerRoles = []string{"admin", "reviewer"}
+	}
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
 	cloudtrailTypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -452,12 +453,11 @@ func (c *Connector) GetPolicy(ctx context.Context, policyARN string) (*connector
 		return nil, fmt.Errorf("getting policy version: %w", err)
 	}
 
-	doc := &connectors.PolicyDocument{
-		Raw: aws.ToString(versionOutput.PolicyVersion.Document),
-	}
-
-	if err := json.Unmarshal([]byte(doc.Raw), doc); err != nil {
-		return doc, nil
+	// Policy versions are returned URL-encoded
+	raw := aws.ToString(versionOutput.PolicyVersion.Document)
+	doc, err := connectors.ParsePolicyDocument(raw)
+	if err != nil {
+		return &connectors.PolicyDocument{Raw: raw}, nil
 	}
 
 	return doc, nil
@@ -515,6 +515,146 @@ func (c *Connector) GetServiceAccounts(ctx context.Context) ([]connectors.Princi
 	return serviceRoles, nil
 }
 
+// GetAuthorizationDetails reads every user, group, role and managed policy
+// in the account with GetAccountAuthorizationDetails. AWS managed policies
+// are included only when attached.
+func (c *Connector) GetAuthorizationDetails(ctx context.Context) (*connectors.AuthorizationDetails, error) {
+	details := &connectors.AuthorizationDetails{}
+	paginator := iam.NewGetAccountAuthorizationDetailsPaginator(c.iamClient, &iam.GetAccountAuthorizationDetailsInput{
+		Filter: []iamtypes.EntityType{
+			iamtypes.EntityTypeUser,
+			iamtypes.EntityTypeGroup,
+			iamtypes.EntityTypeRole,
+			iamtypes.EntityTypeLocalManagedPolicy,
+			iamtypes.EntityTypeAWSManagedPolicy,
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting account authorization details: %w", err)
+		}
+
+		for _, user := range page.UserDetailList {
+			p := connectors.PrincipalDetails{
+				Principal: connectors.Principal{
+					ARN:  aws.ToString(user.Arn),
+					Name: aws.ToString(user.UserName),
+					Type: "USER",
+					Tags: iamTags(user.Tags),
+				},
+				Groups:           user.GroupList,
+				AttachedPolicies: attachedPolicyARNs(user.AttachedManagedPolicies),
+				InlinePolicies:   inlinePolicies(user.UserPolicyList),
+			}
+			if user.CreateDate != nil {
+				p.CreatedAt = user.CreateDate.String()
+			}
+			if user.PermissionsBoundary != nil {
+				p.PermissionsBoundary = aws.ToString(user.PermissionsBoundary.PermissionsBoundaryArn)
+			}
+			details.Users = append(details.Users, p)
+		}
+
+		for _, group := range page.GroupDetailList {
+			p := connectors.PrincipalDetails{
+				Principal: connectors.Principal{
+					ARN:  aws.ToString(group.Arn),
+					Name: aws.ToString(group.GroupName),
+					Type: "GROUP",
+				},
+				AttachedPolicies: attachedPolicyARNs(group.AttachedManagedPolicies),
+				InlinePolicies:   inlinePolicies(group.GroupPolicyList),
+			}
+			if group.CreateDate != nil {
+				p.CreatedAt = group.CreateDate.String()
+			}
+			details.Groups = append(details.Groups, p)
+		}
+
+		for _, role := range page.RoleDetailList {
+			p := connectors.PrincipalDetails{
+				Principal: connectors.Principal{
+					ARN:  aws.ToString(role.Arn),
+					Name: aws.ToString(role.RoleName),
+					Type: "ROLE",
+					Tags: iamTags(role.Tags),
+				},
+				AttachedPolicies: attachedPolicyARNs(role.AttachedManagedPolicies),
+				InlinePolicies:   inlinePolicies(role.RolePolicyList),
+			}
+			if role.CreateDate != nil {
+				p.CreatedAt = role.CreateDate.String()
+			}
+			if role.PermissionsBoundary != nil {
+				p.PermissionsBoundary = aws.ToString(role.PermissionsBoundary.PermissionsBoundaryArn)
+			}
+			if role.AssumeRolePolicyDocument != nil {
+				if doc, err := connectors.ParsePolicyDocument(aws.ToString(role.AssumeRolePolicyDocument)); err == nil {
+					p.TrustPolicy = doc
+				}
+			}
+			details.Roles = append(details.Roles, p)
+		}
+
+		for _, policy := range page.Policies {
+			mp := connectors.ManagedPolicy{
+				PolicyInfo: connectors.PolicyInfo{
+					ARN:         aws.ToString(policy.Arn),
+					Name:        aws.ToString(policy.PolicyName),
+					Type:        "MANAGED",
+					Description: aws.ToString(policy.Description),
+					IsAttached:  aws.ToInt32(policy.AttachmentCount) > 0,
+					AttachCount: int(aws.ToInt32(policy.AttachmentCount)),
+				},
+			}
+			for _, version := range policy.PolicyVersionList {
+				if !version.IsDefaultVersion {
+					continue
+				}
+				if doc, err := connectors.ParsePolicyDocument(aws.ToString(version.Document)); err == nil {
+					mp.Document = doc
+				}
+			}
+			details.Policies = append(details.Policies, mp)
+		}
+	}
+
+	return details, nil
+}
+
+func iamTags(tags []iamtypes.Tag) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
+
+func attachedPolicyARNs(policies []iamtypes.AttachedPolicy) []string {
+	arns := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		arns = append(arns, aws.ToString(policy.PolicyArn))
+	}
+	return arns
+}
+
+// inlinePolicies parses inline policy documents, which IAM returns
+// URL-encoded. Documents that fail to parse are dropped.
+func inlinePolicies(policies []iamtypes.PolicyDetail) map[string]*connectors.PolicyDocument {
+	docs := make(map[string]*connectors.PolicyDocument, len(policies))
+	for _, policy := range policies {
+		if doc, err := connectors.ParsePolicyDocument(aws.ToString(policy.PolicyDocument)); err == nil {
+			docs[aws.ToString(policy.PolicyName)] = doc
+		}
+	}
+	return docs
+}
+
 func (c *Connector) ListFunctions(ctx context.Context) ([]connectors.FunctionInfo, error) {
 	var functions []connectors.FunctionInfo
 	paginator := lambda.NewListFunctionsPaginator(c.lambdaClient, &lambda.ListFunctionsInput{})
@@ -546,6 +546,102 @@ func (c *Connector) GetServiceAccounts(ctx context.Context) ([]connectors.Princi
 	return principals, nil
 }
 
+// GetRoleBindings reads the role assignments that apply to the subscription,
+// at every scope from the management groups above it down to individual
+// containers, with the definitions of the roles they assign
+func (c *Connector) GetRoleBindings(ctx context.Context) (*connectors.RoleBindings, error) {
+	roleDefsClient, err := armauthorization.NewRoleDefinitionsClient(c.credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating role definitions client: %w", err)
+	}
+
+	subscriptionScope := fmt.Sprintf("/subscriptions/%s", c.subscriptionID)
+	bindings := &connectors.RoleBindings{}
+
+	// Custom roles defined at a management group are assignable in the
+	// subscription, so listing at its scope returns them too
+	defPager := roleDefsClient.NewListPager(subscriptionScope, nil)
+	for defPager.More() {
+		page, err := defPager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing role definitions: %w", err)
+		}
+		for _, role := range page.Value {
+			if role.ID == nil || role.Properties == nil {
+				continue
+			}
+			def := connectors.RoleDefinition{
+				ID:   *role.ID,
+				Name: ptrToString(role.Properties.RoleName),
+			}
+			for _, perm := range role.Properties.Permissions {
+				def.Actions = appendStrings(def.Actions, perm.Actions)
+				def.NotActions = appendStrings(def.NotActions, perm.NotActions)
+				def.DataActions = appendStrings(def.DataActions, perm.DataActions)
+				def.NotDataActions = appendStrings(def.NotDataActions, perm.NotDataActions)
+			}
+			bindings.Roles = append(bindings.Roles, def)
+		}
+	}
+
+	// Listing for the subscription returns the assignments inherited from
+	// the management groups above it as well as those made below it
+	ancestors := make(map[string]bool)
+	pager := c.authClient.NewListForSubscriptionPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing role assignments: %w", err)
+		}
+		for _, assignment := range page.Value {
+			props := assignment.Properties
+			if props == nil || props.PrincipalID == nil || props.RoleDefinitionID == nil || props.Scope == nil {
+				continue
+			}
+			scope := *props.Scope
+			if !strings.HasPrefix(strings.ToLower(scope), "/subscriptions/") && !ancestors[scope] {
+				ancestors[scope] = true
+				bindings.Ancestors = append(bindings.Ancestors, scope)
+			}
+			binding := connectors.RoleBinding{
+				Scope:     scope,
+				RoleID:    *props.RoleDefinitionID,
+				Member:    *props.PrincipalID,
+				Condition: ptrToString(props.Condition),
+			}
+			if props.PrincipalType != nil {
+				binding.MemberType = principalType(*props.PrincipalType)
+			}
+			bindings.Bindings = append(bindings.Bindings, binding)
+		}
+	}
+	bindings.Ancestors = append(bindings.Ancestors, subscriptionScope)
+
+	return bindings, nil
+}
+
+// principalType maps an Azure principal type to the graph's principal types
+func principalType(t armauthorization.PrincipalType) string {
+	switch t {
+	case armauthorization.PrincipalTypeUser:
+		return "USER"
+	case armauthorization.PrincipalTypeGroup, armauthorization.PrincipalTypeForeignGroup:
+		return "GROUP"
+	case armauthorization.PrincipalTypeServicePrincipal:
+		return "SERVICE"
+	}
+	return strings.ToUpper(string(t))
+}
+
+func appendStrings(dst []string, src []*string) []string {
+	for _, s := range src {
+		if s != nil {
+			dst = append(dst, *s)
+		}
+	}
+	return dst
+}
+
 func extractResourceGroup(resourceID string) string {
 	parts := strings.Split(resourceID, "/")
 	for i, part := range parts {
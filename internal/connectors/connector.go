@@ -48,6 +48,23 @@ type IAMConnector interface {
 	GetServiceAccounts(ctx context.Context) ([]Principal, error)
 }
 
+// AuthorizationConnector reads an account's complete IAM configuration in
+// one pass, as needed to evaluate effective permissions
+type AuthorizationConnector interface {
+	Connector
+
+	GetAuthorizationDetails(ctx context.Context) (*AuthorizationDetails, error)
+}
+
+// RoleBindingConnector reads the role-based access control governing an
+// Azure subscription or GCP project: the roles in use and every scope each
+// is granted at
+type RoleBindingConnector interface {
+	Connector
+
+	GetRoleBindings(ctx context.Context) (*RoleBindings, error)
+}
+
 type ServerlessConnector interface {
 	Connector
 
@@ -174,10 +191,76 @@ type PolicyDocument struct {
 type PolicyStatement struct {
 	SID        string
 	Effect     string
-	Principals []string
+	Principals []string // AWS principals: "*", account IDs and ARNs
 	Actions    []string
 	Resources  []string
-	Conditions map[string]interface{}
+	Conditions map[string]interface{} // operator -> condition key -> value(s)
+
+	NotPrincipals       []string
+	ServicePrincipals   []string // such as "s3.amazonaws.com"
+	FederatedPrincipals []string // SAML and OIDC providers
+	NotActions          []string
+	NotResources        []string
+}
+
+// AuthorizationDetails is an account's IAM configuration: its principals
+// with their policies, and the managed policies they reference
+type AuthorizationDetails struct {
+	Users    []PrincipalDetails
+	Groups   []PrincipalDetails
+	Roles    []PrincipalDetails
+	Policies []ManagedPolicy
+}
+
+// PrincipalDetails is a user, group or role with its policies
+type PrincipalDetails struct {
+	Principal
+	Groups              []string                   // names of the groups a user belongs to
+	AttachedPolicies    []string                   // managed policy ARNs
+	InlinePolicies      map[string]*PolicyDocument // by policy name
+	PermissionsBoundary string                     // managed policy ARN
+	TrustPolicy         *PolicyDocument            // roles only
+}
+
+// ManagedPolicy is a managed policy with the document of its default version
+type ManagedPolicy struct {
+	PolicyInfo
+	Document *PolicyDocument
+}
+
+// RoleBindings are the role grants that apply to an account's resources
+type RoleBindings struct {
+	// Ancestors are the scopes above the account, such as management groups,
+	// folders and the organization, followed by the account's own scope.
+	// Grants made at any of them apply to every resource in the account.
+	Ancestors []string
+	Roles     []RoleDefinition
+	Bindings  []RoleBinding
+}
+
+// RoleDefinition is a role with the actions it permits. Azure roles
+// separate control plane Actions from DataActions, each with exclusions;
+// GCP roles list their permissions as Actions.
+type RoleDefinition struct {
+	ID             string
+	Name           string
+	Actions        []string
+	NotActions     []string
+	DataActions    []string
+	NotDataActions []string
+}
+
+// RoleBinding grants a role to a member at a scope, covering the scope and
+// every resource below it
+type RoleBinding struct {
+	Scope      string // Azure resource ID, GCP resource name or gs:// bucket
+	RoleID     string
+	Member     string
+	MemberType string // USER, GROUP, SERVICE or PUBLIC
+	// Condition restricts the grant: an Azure ABAC condition or a GCP CEL
+	// expression
+	Condition      string
+	ConditionTitle string
 }
 
 type FunctionInfo struct {
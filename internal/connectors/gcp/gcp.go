@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
 
 	"cloud.google.com/go/storage"
 	"google.golang.org/api/cloudfunctions/v1"
 	"google.golang.org/api/cloudresourcemanager/v1"
+	crmv3 "google.golang.org/api/cloudresourcemanager/v3"
+	iamv1 "google.golang.org/api/iam/v1"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
@@ -22,6 +25,8 @@ type Connector struct {
 
 	storageClient   *storage.Client
 	crmClient       *cloudresourcemanager.Service
+	crmV3Client     *crmv3.Service
+	iamClient       *iamv1.Service
 	functionsClient *cloudfunctions.Service
 }
 
@@ -46,6 +51,16 @@ func New(ctx context.Context, cfg Config) (*Connector, error) {
 		return nil, fmt.Errorf("creating resource manager client: %w", err)
 	}
 
+	crmV3Client, err := crmv3.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating resource manager v3 client: %w", err)
+	}
+
+	iamClient, err := iamv1.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating IAM client: %w", err)
+	}
+
 	functionsClient, err := cloudfunctions.NewService(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("creating functions client: %w", err)
@@ -56,6 +71,8 @@ func New(ctx context.Context, cfg Config) (*Connector, error) {
 		credentialsFile: cfg.CredentialsFile,
 		storageClient:   storageClient,
 		crmClient:       crmClient,
+		crmV3Client:     crmV3Client,
+		iamClient:       iamClient,
 		functionsClient: functionsClient,
 	}, nil
 }
@@ -443,6 +460,149 @@ func (c *Connector) GetServiceAccounts(ctx context.Context) ([]connectors.Princi
 	return principals, nil
 }
 
+// conditionalPolicyVersion requests IAM policies with their conditional
+// bindings; older versions omit the conditions
+const conditionalPolicyVersion = 3
+
+// GetRoleBindings reads the IAM bindings that apply to the project's
+// buckets: those of the organization and folders above the project, of the
+// project, and of each bucket, with the permissions of every role they grant.
+// Ancestors whose policy cannot be read are skipped.
+func (c *Connector) GetRoleBindings(ctx context.Context) (*connectors.RoleBindings, error) {
+	ancestry, err := c.crmClient.Projects.GetAncestry(c.projectID, &cloudresourcemanager.GetAncestryRequest{}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("getting project ancestry: %w", err)
+	}
+
+	bindings := &connectors.RoleBindings{}
+	projectScope := "projects/" + c.projectID
+
+	// Ancestry lists the project first and the organization last
+	for i := len(ancestry.Ancestor) - 1; i >= 0; i-- {
+		id := ancestry.Ancestor[i].ResourceId
+		if id == nil || id.Type == "project" {
+			continue
+		}
+		scope := id.Type + "s/" + id.Id
+		bindings.Ancestors = append(bindings.Ancestors, scope)
+
+		req := &crmv3.GetIamPolicyRequest{Options: &crmv3.GetPolicyOptions{RequestedPolicyVersion: conditionalPolicyVersion}}
+		var policy *crmv3.Policy
+		switch id.Type {
+		case "organization":
+			policy, err = c.crmV3Client.Organizations.GetIamPolicy(scope, req).Context(ctx).Do()
+		case "folder":
+			policy, err = c.crmV3Client.Folders.GetIamPolicy(scope, req).Context(ctx).Do()
+		default:
+			continue
+		}
+		if err != nil {
+			continue // Skip ancestors we can't read
+		}
+		for _, b := range policy.Bindings {
+			var title, expression string
+			if b.Condition != nil {
+				title, expression = b.Condition.Title, b.Condition.Expression
+			}
+			bindings.Bindings = appendBindings(bindings.Bindings, scope, b.Role, b.Members, expression, title)
+		}
+	}
+	bindings.Ancestors = append(bindings.Ancestors, projectScope)
+
+	policy, err := c.crmClient.Projects.GetIamPolicy(c.projectID, &cloudresourcemanager.GetIamPolicyRequest{
+		Options: &cloudresourcemanager.GetPolicyOptions{RequestedPolicyVersion: conditionalPolicyVersion},
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("getting IAM policy: %w", err)
+	}
+	for _, b := range policy.Bindings {
+		var title, expression string
+		if b.Condition != nil {
+			title, expression = b.Condition.Title, b.Condition.Expression
+		}
+		bindings.Bindings = appendBindings(bindings.Bindings, projectScope, b.Role, b.Members, expression, title)
+	}
+
+	buckets, err := c.ListBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range buckets {
+		policy, err := c.storageClient.Bucket(bucket.Name).IAM().V3().Policy(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("getting IAM policy of bucket %s: %w", bucket.Name, err)
+		}
+		for _, b := range policy.Bindings {
+			bindings.Bindings = appendBindings(bindings.Bindings, bucket.ARN, b.GetRole(), b.GetMembers(),
+				b.GetCondition().GetExpression(), b.GetCondition().GetTitle())
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, b := range bindings.Bindings {
+		if seen[b.RoleID] {
+			continue
+		}
+		seen[b.RoleID] = true
+		role, err := c.getRole(ctx, b.RoleID)
+		if err != nil {
+			return nil, fmt.Errorf("getting role %s: %w", b.RoleID, err)
+		}
+		bindings.Roles = append(bindings.Roles, connectors.RoleDefinition{
+			ID:      b.RoleID,
+			Name:    role.Title,
+			Actions: role.IncludedPermissions,
+		})
+	}
+
+	return bindings, nil
+}
+
+// getRole reads a predefined role, or a custom role of a project or
+// organization
+func (c *Connector) getRole(ctx context.Context, name string) (*iamv1.Role, error) {
+	switch {
+	case strings.HasPrefix(name, "projects/"):
+		return c.iamClient.Projects.Roles.Get(name).Context(ctx).Do()
+	case strings.HasPrefix(name, "organizations/"):
+		return c.iamClient.Organizations.Roles.Get(name).Context(ctx).Do()
+	}
+	return c.iamClient.Roles.Get(name).Context(ctx).Do()
+}
+
+// appendBindings adds a binding for each member of an IAM policy binding.
+// Deleted members, which keep their bindings until removed, grant nothing.
+func appendBindings(dst []connectors.RoleBinding, scope, role string, members []string, condition, title string) []connectors.RoleBinding {
+	for _, member := range members {
+		if strings.HasPrefix(member, "deleted:") {
+			continue
+		}
+		dst = append(dst, connectors.RoleBinding{
+			Scope:          scope,
+			RoleID:         role,
+			Member:         member,
+			MemberType:     memberType(member),
+			Condition:      condition,
+			ConditionTitle: title,
+		})
+	}
+	return dst
+}
+
+// memberType maps an IAM policy member to the graph's principal types
+func memberType(member string) string {
+	switch {
+	case member == "allUsers" || member == "allAuthenticatedUsers":
+		return "PUBLIC"
+	case strings.HasPrefix(member, "user:"):
+		return "USER"
+	case strings.HasPrefix(member, "serviceAccount:"):
+		return "SERVICE"
+	}
+	// Groups, domains and workload identity pools stand for sets of users
+	return "GROUP"
+}
+
 func (c *Connector) ListFunctions(ctx context.Context) ([]connectors.FunctionInfo, error) {
 	var functions []connectors.FunctionInfo
 
@@ -574,7 +734,8 @@ func splitFunctionName(fullName string) []string {
 }
 
 var (
-	_ connectors.StorageConnector    = (*Connector)(nil)
-	_ connectors.IAMConnector        = (*Connector)(nil)
-	_ connectors.ServerlessConnector = (*Connector)(nil)
+	_ connectors.StorageConnector     = (*Connector)(nil)
+	_ connectors.IAMConnector         = (*Connector)(nil)
+	_ connectors.ServerlessConnector  = (*Connector)(nil)
+	_ connectors.RoleBindingConnector = (*Connector)(nil)
 )
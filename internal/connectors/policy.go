@@ -0,0 +1,225 @@
+package connectors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ParsePolicyDocument parses an AWS policy document. IAM returns policy
+// versions URL-encoded, so encoded documents are decoded first; Raw holds
+// the decoded JSON.
+func ParsePolicyDocument(raw string) (*PolicyDocument, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "%7B") || strings.HasPrefix(raw, "%7b") {
+		decoded, err := url.QueryUnescape(raw)
+		if err != nil {
+			return nil, fmt.Errorf("decoding policy document: %w", err)
+		}
+		raw = decoded
+	}
+	doc := &PolicyDocument{}
+	if err := json.Unmarshal([]byte(raw), doc); err != nil {
+		return nil, fmt.Errorf("parsing policy document: %w", err)
+	}
+	doc.Raw = raw
+	return doc, nil
+}
+
+// policyDocumentJSON is the wire form of a policy document, where Statement
+// and most statement elements may be a single value or a list
+type policyDocumentJSON struct {
+	Version   string          `json:"Version"`
+	Statement json.RawMessage `json:"Statement"`
+}
+
+type policyStatementJSON struct {
+	Sid          string                 `json:"Sid"`
+	Effect       string                 `json:"Effect"`
+	Principal    json.RawMessage        `json:"Principal"`
+	NotPrincipal json.RawMessage        `json:"NotPrincipal"`
+	Action       stringOrList           `json:"Action"`
+	NotAction    stringOrList           `json:"NotAction"`
+	Resource     stringOrList           `json:"Resource"`
+	NotResource  stringOrList           `json:"NotResource"`
+	Condition    map[string]interface{} `json:"Condition"`
+}
+
+// UnmarshalJSON decodes the AWS policy grammar. Raw is left untouched.
+func (d *PolicyDocument) UnmarshalJSON(data []byte) error {
+	var doc policyDocumentJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	var statements []policyStatementJSON
+	switch trimmed := strings.TrimSpace(string(doc.Statement)); {
+	case trimmed == "" || trimmed == "null":
+	case strings.HasPrefix(trimmed, "["):
+		if err := json.Unmarshal(doc.Statement, &statements); err != nil {
+			return fmt.Errorf("statement: %w", err)
+		}
+	default:
+		var single policyStatementJSON
+		if err := json.Unmarshal(doc.Statement, &single); err != nil {
+			return fmt.Errorf("statement: %w", err)
+		}
+		statements = []policyStatementJSON{single}
+	}
+
+	d.Version = doc.Version
+	d.Statements = make([]PolicyStatement, 0, len(statements))
+	for i, s := range statements {
+		stmt := PolicyStatement{
+			SID:          s.Sid,
+			Effect:       s.Effect,
+			Actions:      s.Action,
+			NotActions:   s.NotAction,
+			Resources:    s.Resource,
+			NotResources: s.NotResource,
+			Conditions:   s.Condition,
+		}
+		principals, err := parsePrincipal(s.Principal)
+		if err != nil {
+			return fmt.Errorf("statement %d Principal: %w", i, err)
+		}
+		stmt.Principals = principals["AWS"]
+		stmt.ServicePrincipals = principals["Service"]
+		stmt.FederatedPrincipals = principals["Federated"]
+
+		notPrincipals, err := parsePrincipal(s.NotPrincipal)
+		if err != nil {
+			return fmt.Errorf("statement %d NotPrincipal: %w", i, err)
+		}
+		stmt.NotPrincipals = notPrincipals["AWS"]
+		d.Statements = append(d.Statements, stmt)
+	}
+	return nil
+}
+
+// parsePrincipal decodes a Principal element: "*" or a map from principal
+// type to one or more principals. "*" is returned as the AWS principal "*".
+func parsePrincipal(data json.RawMessage) (map[string][]string, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return nil, fmt.Errorf("unexpected principal %q", wildcard)
+		}
+		return map[string][]string{"AWS": {"*"}}, nil
+	}
+	var byType map[string]stringOrList
+	if err := json.Unmarshal(data, &byType); err != nil {
+		return nil, err
+	}
+	principals := make(map[string][]string, len(byType))
+	for typ, values := range byType {
+		// CanonicalUser principals identify S3 account owners and are
+		// matched like AWS principals
+		if typ == "CanonicalUser" {
+			typ = "AWS"
+		}
+		principals[typ] = append(principals[typ], values...)
+	}
+	for _, values := range principals {
+		sort.Strings(values)
+	}
+	return principals, nil
+}
+
+// stringOrList decodes a JSON string or list of strings
+type stringOrList []string
+
+func (s *stringOrList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = []string{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// policyStatementOut is the wire form written by FormatPolicyDocument,
+// with empty elements omitted
+type policyStatementOut struct {
+	Sid          string                 `json:"Sid,omitempty"`
+	Effect       string                 `json:"Effect"`
+	Principal    interface{}            `json:"Principal,omitempty"`
+	NotPrincipal interface{}            `json:"NotPrincipal,omitempty"`
+	Action       []string               `json:"Action,omitempty"`
+	NotAction    []string               `json:"NotAction,omitempty"`
+	Resource     []string               `json:"Resource,omitempty"`
+	NotResource  []string               `json:"NotResource,omitempty"`
+	Condition    map[string]interface{} `json:"Condition,omitempty"`
+}
+
+// FormatPolicyDocument writes a policy document in the AWS policy grammar,
+// indented, with lists for every element. Documents without a version get
+// the current policy language version.
+func FormatPolicyDocument(doc *PolicyDocument) (string, error) {
+	version := doc.Version
+	if version == "" {
+		version = "2012-10-17"
+	}
+	out := struct {
+		Version   string               `json:"Version"`
+		Statement []policyStatementOut `json:"Statement"`
+	}{Version: version, Statement: make([]policyStatementOut, 0, len(doc.Statements))}
+
+	for _, stmt := range doc.Statements {
+		s := policyStatementOut{
+			Sid:         stmt.SID,
+			Effect:      stmt.Effect,
+			Action:      stmt.Actions,
+			NotAction:   stmt.NotActions,
+			Resource:    stmt.Resources,
+			NotResource: stmt.NotResources,
+			Condition:   stmt.Conditions,
+		}
+		if p := formatPrincipal(map[string][]string{
+			"AWS":       stmt.Principals,
+			"Service":   stmt.ServicePrincipals,
+			"Federated": stmt.FederatedPrincipals,
+		}); p != nil {
+			s.Principal = p
+		}
+		if p := formatPrincipal(map[string][]string{"AWS": stmt.NotPrincipals}); p != nil {
+			s.NotPrincipal = p
+		}
+		out.Statement = append(out.Statement, s)
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("formatting policy document: %w", err)
+	}
+	return string(data), nil
+}
+
+// formatPrincipal is the inverse of parsePrincipal. A lone AWS principal
+// "*" is written as "*".
+func formatPrincipal(byType map[string][]string) interface{} {
+	principals := make(map[string][]string)
+	for typ, values := range byType {
+		if len(values) > 0 {
+			principals[typ] = values
+		}
+	}
+	if len(principals) == 0 {
+		return nil
+	}
+	if aws := principals["AWS"]; len(principals) == 1 && len(aws) == 1 && aws[0] == "*" {
+		return "*"
+	}
+	return principals
+}
@@ -0,0 +1,453 @@
+// Package correlation raises composite findings where several weaknesses of
+// one data asset combine into a far greater risk than each alone, such as
+// critical PII that is publicly readable and not under a customer-managed
+// key.
+package correlation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/anomaly"
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Signal kinds
+const (
+	SignalSensitiveData  = "SENSITIVE_DATA"
+	SignalPublicRead     = "PUBLIC_READ"
+	SignalNoCustomerKey  = "NO_CUSTOMER_MANAGED_KEY"
+	SignalExternalAccess = "EXTERNAL_ACCESS"
+	SignalEgressFunction = "INTERNET_EGRESS_FUNCTION"
+	SignalAnomaly        = "ACCESS_ANOMALY"
+)
+
+// Single-signal findings that signals refer back to
+const (
+	findingPublicBucket = "PUBLIC_BUCKET"
+	findingUnencrypted  = "UNENCRYPTED_STORAGE"
+)
+
+// keyManagerCustomer marks keys the customer manages, as opposed to keys a
+// cloud service manages on its behalf
+const keyManagerCustomer = "CUSTOMER"
+
+var sensitivityRank = map[models.Sensitivity]int{
+	models.SensitivityLow:      1,
+	models.SensitivityMedium:   2,
+	models.SensitivityHigh:     3,
+	models.SensitivityCritical: 4,
+}
+
+// Signal is one fact about a data asset that rules combine
+type Signal struct {
+	Kind    string `json:"kind"`
+	Summary string `json:"summary"`
+	// Category and Sensitivity describe the data of SENSITIVE_DATA signals
+	Category    models.Category    `json:"category,omitempty"`
+	Sensitivity models.Sensitivity `json:"sensitivity,omitempty"`
+	// PrincipalARN is who holds the access, and Via the roles it assumes to
+	// get it
+	PrincipalARN string   `json:"principal_arn,omitempty"`
+	Via          []string `json:"via,omitempty"`
+	// FindingID and AnomalyID refer to the finding or anomaly the signal
+	// comes from, if any
+	FindingID *uuid.UUID `json:"finding_id,omitempty"`
+	AnomalyID *uuid.UUID `json:"anomaly_id,omitempty"`
+}
+
+// Input is what is known about an account's assets
+type Input struct {
+	// Access is the account's access graph update, with its assets and
+	// classification rollups
+	Access *access.GraphUpdate
+	// KeyManagers maps KMS key ARNs to who manages them, AWS or CUSTOMER
+	KeyManagers map[string]string
+	Functions   []connectors.FunctionConfig
+	// Anomalies are the account's unresolved access anomalies
+	Anomalies []anomaly.Anomaly
+	// Findings are the account's open findings, which signals refer to
+	Findings []models.Finding
+}
+
+// Condition is met by a signal of one of Kinds. Categories and
+// MinSensitivity further restrict SENSITIVE_DATA signals.
+type Condition struct {
+	Kinds          []string
+	Categories     []models.Category
+	MinSensitivity models.Sensitivity
+}
+
+func (c Condition) matches(s Signal) bool {
+	if !contains(c.Kinds, s.Kind) {
+		return false
+	}
+	if len(c.Categories) > 0 && !contains(c.Categories, s.Category) {
+		return false
+	}
+	if c.MinSensitivity != "" && sensitivityRank[s.Sensitivity] < sensitivityRank[c.MinSensitivity] {
+		return false
+	}
+	return true
+}
+
+// Rule is a composite condition, met by an asset when each of its
+// conditions is met by one of the asset's signals
+type Rule struct {
+	FindingType string
+	Severity    models.FindingSeverity
+	// Title is formatted with the asset name
+	Title                string
+	Description          string
+	Remediation          string
+	ComplianceFrameworks []string
+	Conditions           []Condition
+}
+
+// Match is a rule met by an asset, with the signals meeting it
+type Match struct {
+	Rule    *Rule
+	Asset   *models.DataAsset
+	Signals []Signal
+	// Score orders matches by risk: the rule's severity, the sensitivity of
+	// the data and any anomalous access to it
+	Score int
+}
+
+var severityScore = map[models.FindingSeverity]int{
+	models.SeverityCritical: 40,
+	models.SeverityHigh:     30,
+	models.SeverityMedium:   20,
+	models.SeverityLow:      10,
+}
+
+// Evaluate matches rules against the signals of every asset, riskiest first
+func Evaluate(rules []Rule, input *Input) []Match {
+	signals := Signals(input)
+
+	var matches []Match
+	for _, asset := range input.Access.Assets {
+		assetSignals := signals[asset.ID]
+		for i := range rules {
+			rule := &rules[i]
+			matched, ok := match(rule, assetSignals)
+			if !ok {
+				continue
+			}
+			m := Match{Rule: rule, Asset: asset, Signals: matched, Score: severityScore[rule.Severity]}
+			for _, s := range assetSignals {
+				// Anomalous access aggravates any combination
+				if s.Kind == SignalAnomaly && !containsSignal(m.Signals, s) {
+					m.Signals = append(m.Signals, s)
+				}
+			}
+			highest := 0
+			for _, s := range m.Signals {
+				highest = max(highest, sensitivityRank[s.Sensitivity])
+				if s.Kind == SignalAnomaly {
+					m.Score += 15
+				}
+			}
+			m.Score += 10 * highest
+			matches = append(matches, m)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Asset.ResourceARN < matches[j].Asset.ResourceARN
+	})
+	return matches
+}
+
+// match collects the signals meeting each condition of a rule
+func match(rule *Rule, signals []Signal) ([]Signal, bool) {
+	var matched []Signal
+	for _, cond := range rule.Conditions {
+		met := false
+		for _, s := range signals {
+			if cond.matches(s) {
+				met = true
+				if !containsSignal(matched, s) {
+					matched = append(matched, s)
+				}
+			}
+		}
+		if !met {
+			return nil, false
+		}
+	}
+	return matched, true
+}
+
+// Finding is the composite finding for a match. Priority is its rank among
+// the account's matches, 1 being the riskiest.
+func (m *Match) Finding(accountID uuid.UUID, priority int, now time.Time) *models.Finding {
+	var contributing []string
+	for _, s := range m.Signals {
+		if s.FindingID != nil && !contains(contributing, s.FindingID.String()) {
+			contributing = append(contributing, s.FindingID.String())
+		}
+	}
+	var summaries []string
+	for _, s := range m.Signals {
+		summaries = append(summaries, "- "+s.Summary)
+	}
+
+	return &models.Finding{
+		ID:                   uuid.New(),
+		AccountID:            accountID,
+		AssetID:              &m.Asset.ID,
+		FindingType:          m.Rule.FindingType,
+		Severity:             m.Rule.Severity,
+		Title:                fmt.Sprintf(m.Rule.Title, m.Asset.Name),
+		Description:          m.Rule.Description + "\n\nContributing signals:\n" + strings.Join(summaries, "\n"),
+		Remediation:          m.Rule.Remediation,
+		Status:               models.FindingStatusOpen,
+		ComplianceFrameworks: m.Rule.ComplianceFrameworks,
+		Evidence: models.JSONB{
+			"asset_arn":             m.Asset.ResourceARN,
+			"priority":              priority,
+			"risk_score":            m.Score,
+			"signals":               m.Signals,
+			"contributing_findings": contributing,
+		},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+}
+
+// Signals derives the signals of every asset from classifications,
+// encryption, the access graph, functions and anomalies
+func Signals(input *Input) map[uuid.UUID][]Signal {
+	update := input.Access
+	signals := make(map[uuid.UUID][]Signal)
+	assets := make(map[uuid.UUID]*models.DataAsset, len(update.Assets))
+	for _, asset := range update.Assets {
+		assets[asset.ID] = asset
+	}
+	add := func(assetID uuid.UUID, s Signal) {
+		if assets[assetID] != nil && !containsSignal(signals[assetID], s) {
+			signals[assetID] = append(signals[assetID], s)
+		}
+	}
+
+	findings := make(map[string]*uuid.UUID)
+	for i := range input.Findings {
+		f := &input.Findings[i]
+		if f.AssetID != nil {
+			findings[f.AssetID.String()+"|"+f.FindingType] = &f.ID
+		}
+	}
+	findingOf := func(asset *models.DataAsset, findingType string) *uuid.UUID {
+		return findings[asset.ID.String()+"|"+findingType]
+	}
+
+	// Classification rollups, or the asset's own categories when there are
+	// none
+	classified := make(map[uuid.UUID]bool)
+	for _, c := range update.Classifications {
+		classified[c.AssetID] = true
+		add(c.AssetID, Signal{
+			Kind:        SignalSensitiveData,
+			Summary:     fmt.Sprintf("%s %s data (%d matches)", c.Sensitivity, c.Category, c.Count),
+			Category:    c.Category,
+			Sensitivity: c.Sensitivity,
+		})
+	}
+	for _, asset := range update.Assets {
+		if classified[asset.ID] || asset.SensitivityLevel == "" {
+			continue
+		}
+		for _, category := range asset.DataCategories {
+			add(asset.ID, Signal{
+				Kind:        SignalSensitiveData,
+				Summary:     fmt.Sprintf("%s %s data", asset.SensitivityLevel, category),
+				Category:    models.Category(category),
+				Sensitivity: asset.SensitivityLevel,
+			})
+		}
+	}
+
+	for _, asset := range update.Assets {
+		if s, ok := keySignal(asset, input.KeyManagers); ok {
+			s.FindingID = findingOf(asset, findingUnencrypted)
+			add(asset.ID, s)
+		}
+	}
+
+	public := access.PublicPaths(update, assets)
+	for _, asset := range update.Assets {
+		path, ok := public[asset.ID.String()]
+		switch {
+		case ok && readable(asset.ResourceARN, path.Permissions):
+			s := Signal{Kind: SignalPublicRead, Summary: "Readable by anyone", PrincipalARN: access.PublicPrincipalARN, Via: path.Via}
+			if len(path.Via) > 0 {
+				s.Summary = "Readable by anyone through role " + strings.Join(path.Via, " -> ")
+			}
+			s.FindingID = findingOf(asset, findingPublicBucket)
+			add(asset.ID, s)
+		case !ok && asset.PublicAccess:
+			add(asset.ID, Signal{
+				Kind:         SignalPublicRead,
+				Summary:      "Public access enabled",
+				PrincipalARN: access.PublicPrincipalARN,
+				FindingID:    findingOf(asset, findingPublicBucket),
+			})
+		}
+	}
+
+	// readers lists the readable assets each principal holds access edges to
+	readers := make(map[string][]models.AccessEdge)
+	for _, edge := range update.AccessEdges {
+		if asset := assets[edge.TargetAssetID]; asset != nil && readable(asset.ResourceARN, edge.Permissions) {
+			readers[edge.SourceARN] = append(readers[edge.SourceARN], edge)
+		}
+	}
+	// reach adds a signal per asset readable by a principal reached from
+	// source, through the fewest roles
+	reach := func(source string, via []string, signal func(principal string, roles []string) Signal) {
+		paths := access.AssumptionPaths(update, source)
+		for _, principal := range sortedKeys(paths) {
+			for _, edge := range readers[principal] {
+				roles := append(append([]string{}, via...), paths[principal]...)
+				add(edge.TargetAssetID, signal(principal, roles))
+			}
+		}
+	}
+
+	for _, p := range update.Principals {
+		if p.Type != access.PrincipalTypeExternalAccount {
+			continue
+		}
+		reach(p.ARN, nil, func(principal string, roles []string) Signal {
+			return Signal{
+				Kind:         SignalExternalAccess,
+				Summary:      fmt.Sprintf("Readable from external account %s through role %s", p.ARN, strings.Join(roles, " -> ")),
+				PrincipalARN: p.ARN,
+				Via:          roles,
+			}
+		})
+	}
+	for _, edge := range update.AccessEdges {
+		if edge.IsCrossAccount && readable(edge.TargetARN, edge.Permissions) {
+			add(edge.TargetAssetID, Signal{
+				Kind:         SignalExternalAccess,
+				Summary:      fmt.Sprintf("Readable by %s in another account", edge.SourceARN),
+				PrincipalARN: edge.SourceARN,
+			})
+		}
+	}
+
+	for _, fn := range input.Functions {
+		if fn.Role == "" || !internetEgress(fn) {
+			continue
+		}
+		reach(fn.Role, nil, func(principal string, roles []string) Signal {
+			return Signal{
+				Kind:         SignalEgressFunction,
+				Summary:      fmt.Sprintf("Readable by function %s, which has internet egress, through role %s", fn.Name, strings.Join(append([]string{fn.Role}, roles...), " -> ")),
+				PrincipalARN: fn.ARN,
+				Via:          append([]string{fn.Role}, roles...),
+			}
+		})
+	}
+
+	for i := range input.Anomalies {
+		a := &input.Anomalies[i]
+		s := Signal{
+			Kind:         SignalAnomaly,
+			Summary:      fmt.Sprintf("%s anomaly: %s", a.Severity, a.Title),
+			PrincipalARN: a.PrincipalID,
+			AnomalyID:    &a.ID,
+		}
+		if a.AssetID != nil {
+			add(*a.AssetID, s)
+			continue
+		}
+		// An anomaly of a principal concerns every asset it can read
+		for _, edge := range readers[a.PrincipalID] {
+			add(edge.TargetAssetID, s)
+		}
+	}
+
+	return signals
+}
+
+// keySignal reports an asset not encrypted under a customer-managed key
+func keySignal(asset *models.DataAsset, keyManagers map[string]string) (Signal, bool) {
+	s := Signal{Kind: SignalNoCustomerKey}
+	switch asset.EncryptionStatus {
+	case models.EncryptionNone:
+		s.Summary = "Not encrypted at rest"
+	case models.EncryptionSSE:
+		s.Summary = "Encrypted with provider-managed keys"
+	case models.EncryptionSSEKMS:
+		if keyManagers[asset.EncryptionKeyARN] == keyManagerCustomer {
+			return s, false
+		}
+		s.Summary = "Encrypted with a KMS key the customer does not manage"
+	default:
+		return s, false
+	}
+	return s, true
+}
+
+// internetEgress reports whether a function can reach the internet.
+// Functions outside a VPC always can; for those in one it depends on NAT
+// routes, which are not read, so they are not counted.
+func internetEgress(fn connectors.FunctionConfig) bool {
+	return fn.VPCConfig == nil || len(fn.VPCConfig.SubnetIDs) == 0
+}
+
+// readable reports whether actions include reading data of a resource
+func readable(resourceARN string, actions []string) bool {
+	for _, da := range access.DataActionsFor(resourceARN) {
+		if da.Level != models.PermissionRead {
+			continue
+		}
+		for _, action := range actions {
+			if strings.EqualFold(action, da.Action) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsSignal(signals []Signal, s Signal) bool {
+	for _, other := range signals {
+		if other.Kind == s.Kind && other.Summary == s.Summary {
+			return true
+		}
+	}
+	return false
+}
+
+func contains[T comparable](list []T, v T) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,190 @@
+package correlation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/access"
+	"github.com/qualys/dspm/internal/anomaly"
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/models"
+)
+
+const (
+	auditRole    = "arn:aws:iam::111111111111:role/audit"
+	exporterRole = "arn:aws:iam::111111111111:role/exporter"
+	workerRole   = "arn:aws:iam::111111111111:role/worker"
+	kmsKey       = "arn:aws:kms:us-east-1:111111111111:key/abc"
+)
+
+func bucket(name string, sensitivity models.Sensitivity, encryption models.EncryptionStatus) *models.DataAsset {
+	return &models.DataAsset{
+		ID:               uuid.New(),
+		ResourceARN:      "arn:aws:s3:::" + name,
+		Name:             name,
+		ResourceType:     models.ResourceTypeS3Bucket,
+		SensitivityLevel: sensitivity,
+		EncryptionStatus: encryption,
+	}
+}
+
+// readPolicy grants read on buckets
+func readPolicy(buckets ...string) map[string]*connectors.PolicyDocument {
+	var resources []string
+	for _, b := range buckets {
+		resources = append(resources, "arn:aws:s3:::"+b, "arn:aws:s3:::"+b+"/*")
+	}
+	return map[string]*connectors.PolicyDocument{"read": {Statements: []connectors.PolicyStatement{
+		{Effect: "Allow", Actions: []string{"s3:GetObject", "s3:ListBucket"}, Resources: resources},
+	}}}
+}
+
+func role(arn string, trusted connectors.PolicyStatement, buckets ...string) connectors.PrincipalDetails {
+	trusted.Effect = "Allow"
+	trusted.Actions = []string{"sts:AssumeRole"}
+	return connectors.PrincipalDetails{
+		Principal:      connectors.Principal{ARN: arn, Name: arn[len("arn:aws:iam::111111111111:role/"):], Type: "ROLE"},
+		InlinePolicies: readPolicy(buckets...),
+		TrustPolicy:    &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{trusted}},
+	}
+}
+
+// fixture is an account with a public bucket of critical PII, a PHI bucket
+// a role of another account can read, and a bucket of secrets a function
+// outside any VPC can read
+func fixture() (*Input, map[string]*models.DataAsset) {
+	assets := map[string]*models.DataAsset{
+		"customers": bucket("customers", models.SensitivityCritical, models.EncryptionSSEKMS),
+		"patients":  bucket("patients", models.SensitivityHigh, models.EncryptionSSE),
+		"secrets":   bucket("secrets", models.SensitivityCritical, models.EncryptionSSE),
+		"logs":      bucket("logs", "", models.EncryptionNone),
+	}
+	assets["customers"].EncryptionKeyARN = kmsKey
+
+	lambda := connectors.PolicyStatement{ServicePrincipals: []string{"lambda.amazonaws.com"}}
+	scan := &access.AccountAccess{
+		AccountID: "111111111111",
+		Authorization: &connectors.AuthorizationDetails{Roles: []connectors.PrincipalDetails{
+			role(auditRole, connectors.PolicyStatement{Principals: []string{"arn:aws:iam::222222222222:root"}}, "patients"),
+			role(exporterRole, lambda, "secrets"),
+			role(workerRole, lambda, "secrets"),
+		}},
+		Assets: []access.AssetAccess{
+			{Asset: assets["customers"], Policy: &connectors.PolicyDocument{Statements: []connectors.PolicyStatement{
+				{Effect: "Allow", Principals: []string{"*"}, Actions: []string{"s3:GetObject"}, Resources: []string{"arn:aws:s3:::customers/*"}},
+			}}},
+			{Asset: assets["patients"]},
+			{Asset: assets["secrets"]},
+			{Asset: assets["logs"]},
+		},
+	}
+	update := access.BuildGraphUpdate(uuid.New(), scan)
+	update.Classifications = []access.ClassificationRollup{
+		{AssetID: assets["customers"].ID, Category: models.CategoryPII, Sensitivity: models.SensitivityCritical, Count: 40},
+		{AssetID: assets["patients"].ID, Category: models.CategoryPHI, Sensitivity: models.SensitivityHigh, Count: 12},
+		{AssetID: assets["secrets"].ID, Category: models.CategorySecrets, Sensitivity: models.SensitivityCritical, Count: 3},
+	}
+
+	return &Input{
+		Access:      update,
+		KeyManagers: map[string]string{kmsKey: "AWS"},
+		Functions: []connectors.FunctionConfig{
+			{FunctionInfo: connectors.FunctionInfo{ARN: "arn:aws:lambda:us-east-1:111111111111:function:export", Name: "export"}, Role: exporterRole},
+			{FunctionInfo: connectors.FunctionInfo{ARN: "arn:aws:lambda:us-east-1:111111111111:function:worker", Name: "worker"}, Role: workerRole,
+				VPCConfig: &connectors.VPCConfig{SubnetIDs: []string{"subnet-1"}}},
+		},
+	}, assets
+}
+
+func TestEvaluate(t *testing.T) {
+	input, assets := fixture()
+	publicFinding := models.Finding{ID: uuid.New(), AssetID: &assets["customers"].ID, FindingType: findingPublicBucket}
+	input.Findings = []models.Finding{publicFinding}
+
+	matches := Evaluate(DefaultRules(), input)
+	found := make(map[string]*Match)
+	for i := range matches {
+		found[matches[i].Rule.FindingType+"|"+matches[i].Asset.Name] = &matches[i]
+	}
+	if len(matches) != 3 {
+		t.Errorf("expected 3 matches, got %d: %v", len(matches), found)
+	}
+
+	pii := found[FindingPublicUnprotectedPII+"|customers"]
+	if pii == nil {
+		t.Fatalf("expected public unprotected PII in customers, got %v", found)
+	}
+	kinds := make(map[string]bool)
+	for _, s := range pii.Signals {
+		kinds[s.Kind] = true
+	}
+	for _, kind := range []string{SignalSensitiveData, SignalPublicRead, SignalNoCustomerKey} {
+		if !kinds[kind] {
+			t.Errorf("expected a %s signal, got %+v", kind, pii.Signals)
+		}
+	}
+
+	phi := found[FindingExternalPHI+"|patients"]
+	if phi == nil {
+		t.Errorf("expected external PHI access to patients, got %v", found)
+	} else if s := phi.Signals[1]; s.PrincipalARN != "arn:aws:iam::222222222222:root" || len(s.Via) != 1 || s.Via[0] != auditRole {
+		t.Errorf("expected access from 222222222222 through audit, got %+v", s)
+	}
+
+	secrets := found[FindingSecretsEgress+"|secrets"]
+	if secrets == nil {
+		t.Fatalf("expected secrets readable by a function with egress, got %v", found)
+	}
+	if len(secrets.Signals) != 2 || secrets.Signals[1].PrincipalARN != "arn:aws:lambda:us-east-1:111111111111:function:export" {
+		t.Errorf("expected only the function outside a VPC, got %+v", secrets.Signals)
+	}
+
+	finding := pii.Finding(uuid.New(), 1, time.Now())
+	if finding.FindingType != FindingPublicUnprotectedPII || finding.Title != "Critical PII in customers is publicly readable without a customer-managed key" {
+		t.Errorf("expected the composite finding, got %s: %s", finding.FindingType, finding.Title)
+	}
+	if refs := finding.Evidence["contributing_findings"].([]string); len(refs) != 1 || refs[0] != publicFinding.ID.String() {
+		t.Errorf("expected a reference to the public bucket finding, got %v", refs)
+	}
+
+	// A customer-managed key breaks the combination
+	input.KeyManagers[kmsKey] = keyManagerCustomer
+	for _, m := range Evaluate(DefaultRules(), input) {
+		if m.Rule.FindingType == FindingPublicUnprotectedPII {
+			t.Errorf("expected no match under a customer-managed key, got %+v", m)
+		}
+	}
+}
+
+func TestEvaluateAnomalies(t *testing.T) {
+	input, assets := fixture()
+	input.Anomalies = []anomaly.Anomaly{
+		{ID: uuid.New(), AssetID: &assets["customers"].ID, Severity: anomaly.SeverityHigh, Title: "Bulk download"},
+		{ID: uuid.New(), PrincipalID: auditRole, Severity: anomaly.SeverityMedium, Title: "Off-hours access"},
+	}
+
+	matches := Evaluate(DefaultRules(), input)
+	if len(matches) != 5 {
+		t.Fatalf("expected 5 matches, got %d", len(matches))
+	}
+	// Anomalies raise exposed assets above the secrets reachable by a function
+	if last := matches[len(matches)-1]; last.Rule.FindingType != FindingSecretsEgress {
+		t.Errorf("expected the secrets combination last, got %s", last.Rule.FindingType)
+	}
+	for _, m := range matches[:len(matches)-1] {
+		anomalous := false
+		for _, s := range m.Signals {
+			anomalous = anomalous || s.Kind == SignalAnomaly && s.AnomalyID != nil
+		}
+		if !anomalous {
+			t.Errorf("expected %s on %s to reference an anomaly, got %+v", m.Rule.FindingType, m.Asset.Name, m.Signals)
+		}
+	}
+	for i := 1; i < len(matches); i++ {
+		if matches[i].Score > matches[i-1].Score {
+			t.Errorf("expected matches by descending score, got %d after %d", matches[i].Score, matches[i-1].Score)
+		}
+	}
+}
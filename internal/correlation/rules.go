@@ -0,0 +1,75 @@
+package correlation
+
+import "github.com/qualys/dspm/internal/models"
+
+// Composite finding types
+const (
+	FindingPublicUnprotectedPII = "TOXIC_PUBLIC_UNPROTECTED_PII"
+	FindingExternalPHI          = "TOXIC_EXTERNAL_PHI_ACCESS"
+	FindingSecretsEgress        = "TOXIC_SECRETS_EGRESS"
+	FindingAnomalousExposure    = "TOXIC_ANOMALOUS_EXPOSURE"
+)
+
+// DefaultRules returns the built-in toxic combinations
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			FindingType: FindingPublicUnprotectedPII,
+			Severity:    models.SeverityCritical,
+			Title:       "Critical PII in %s is publicly readable without a customer-managed key",
+			Description: "This asset holds critical personal data, anyone can read it, and it is not encrypted " +
+				"under a key the organization controls, so neither access control nor key policy stands between " +
+				"the data and the internet.",
+			Remediation: "Block public access to the asset first, then encrypt it with a customer-managed KMS key " +
+				"whose key policy limits decryption to the principals that need it.",
+			ComplianceFrameworks: []string{"GDPR-Art32", "CCPA-1798.150", "SOC2-CC6.1"},
+			Conditions: []Condition{
+				{Kinds: []string{SignalSensitiveData}, Categories: []models.Category{models.CategoryPII}, MinSensitivity: models.SensitivityCritical},
+				{Kinds: []string{SignalPublicRead}},
+				{Kinds: []string{SignalNoCustomerKey}},
+			},
+		},
+		{
+			FindingType: FindingExternalPHI,
+			Severity:    models.SeverityCritical,
+			Title:       "PHI in %s is readable from an external account",
+			Description: "This asset holds protected health information that principals of another account can " +
+				"read, directly or by assuming a role that trusts the other account.",
+			Remediation: "Remove the external account from the role's trust policy or the asset's policy, or " +
+				"restrict the trust with aws:PrincipalOrgID or an external ID and narrow the role's data access.",
+			ComplianceFrameworks: []string{"HIPAA-164.312(a)(1)", "HIPAA-164.308(a)(4)", "SOC2-CC6.1"},
+			Conditions: []Condition{
+				{Kinds: []string{SignalSensitiveData}, Categories: []models.Category{models.CategoryPHI, models.CategoryHealth}},
+				{Kinds: []string{SignalExternalAccess}},
+			},
+		},
+		{
+			FindingType: FindingSecretsEgress,
+			Severity:    models.SeverityHigh,
+			Title:       "Secrets in %s are readable by a function with internet egress",
+			Description: "This asset holds secrets that a serverless function can read while it can also reach " +
+				"the internet, so a compromised or malicious dependency of the function could exfiltrate them.",
+			Remediation: "Move the secrets to a secrets manager, and narrow the function role's access or place " +
+				"the function in a VPC without a route to the internet.",
+			ComplianceFrameworks: []string{"PCI-DSS-3.5", "SOC2-CC6.1"},
+			Conditions: []Condition{
+				{Kinds: []string{SignalSensitiveData}, Categories: []models.Category{models.CategorySecrets}},
+				{Kinds: []string{SignalEgressFunction}},
+			},
+		},
+		{
+			FindingType: FindingAnomalousExposure,
+			Severity:    models.SeverityCritical,
+			Title:       "Anomalous access to exposed sensitive data in %s",
+			Description: "This asset holds highly sensitive data readable by anyone or from an external account, " +
+				"and its access shows anomalies, which may mean the exposure is being exploited.",
+			Remediation:          "Investigate the anomalies and close the exposure; rotate any credentials found in the data.",
+			ComplianceFrameworks: []string{"GDPR-Art33", "HIPAA-164.308(a)(6)", "SOC2-CC7.3"},
+			Conditions: []Condition{
+				{Kinds: []string{SignalSensitiveData}, MinSensitivity: models.SensitivityHigh},
+				{Kinds: []string{SignalPublicRead, SignalExternalAccess}},
+				{Kinds: []string{SignalAnomaly}},
+			},
+		},
+	}
+}
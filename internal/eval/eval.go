@@ -0,0 +1,413 @@
+// Package eval measures classifier quality end to end against a labeled corpus.
+//
+// A corpus is a JSONL manifest with one document per line:
+//
+//	{"file": "records/patient.txt", "categories": ["PHI"], "spans": [{"rule": "SSN", "category": "PII", "line": 3}]}
+//
+// Documents are classified with the built-in and custom rules, scored by the
+// ML classifier, and compared with the expected spans (per rule) and
+// categories (per document).
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qualys/dspm/internal/classifier"
+	"github.com/qualys/dspm/internal/mlclassifier"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Document is one labeled entry of a corpus manifest
+type Document struct {
+	File       string            `json:"file,omitempty"`    // Relative to the manifest
+	Content    string            `json:"content,omitempty"` // Inline content, used when File is empty
+	Bucket     string            `json:"bucket,omitempty"`  // Object metadata for rule conditions
+	Path       string            `json:"path,omitempty"`
+	Categories []models.Category `json:"categories,omitempty"` // Expected in addition to the spans' categories
+	Spans      []Span            `json:"spans,omitempty"`
+}
+
+// Span is an expected finding. Rule and Line locate it for per-rule metrics;
+// Line may be omitted when Start gives the byte offset of the value. A span
+// without a rule only contributes its category.
+type Span struct {
+	Rule     string          `json:"rule,omitempty"`
+	Category models.Category `json:"category"`
+	Line     int             `json:"line,omitempty"` // 1-based
+	Start    int             `json:"start,omitempty"`
+	End      int             `json:"end,omitempty"`
+}
+
+// LoadManifest reads a JSONL manifest and the documents it references
+func LoadManifest(path string) ([]*Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	var docs []*Document
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		doc := &Document{}
+		if err := json.Unmarshal([]byte(line), doc); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if err := doc.load(dir); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		docs = append(docs, doc)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// load reads the document's file and resolves span lines
+func (d *Document) load(dir string) error {
+	if d.File != "" {
+		data, err := os.ReadFile(filepath.Join(dir, d.File))
+		if err != nil {
+			return err
+		}
+		d.Content = string(data)
+	}
+	for i := range d.Spans {
+		span := &d.Spans[i]
+		if span.Category == "" {
+			return fmt.Errorf("span %d: category is required", i)
+		}
+		if span.Line == 0 && span.End > 0 {
+			if span.Start < 0 || span.End > len(d.Content) || span.Start >= span.End {
+				return fmt.Errorf("span %d: offsets [%d,%d) outside the document", i, span.Start, span.End)
+			}
+			span.Line = strings.Count(d.Content[:span.Start], "\n") + 1
+		}
+	}
+	return nil
+}
+
+func (d *Document) name() string {
+	if d.File != "" {
+		return d.File
+	}
+	return d.Path
+}
+
+// Options configure an evaluation run
+type Options struct {
+	// Classifier runs the rules; rules.Engine.NewClassifier adds custom rules
+	// to the built-in ones. Defaults to the built-in rules.
+	Classifier *classifier.Classifier
+	// ML scores each match; nil evaluates the rules alone
+	ML *mlclassifier.Service
+	// Matches the ML classifier scores below MinConfidence are dropped, as
+	// scans auto-reject them
+	MinConfidence float64
+}
+
+// Metrics are detection counts and the scores derived from them. When a
+// denominator is zero the score is reported as 1, as in fixture reports.
+type Metrics struct {
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+}
+
+func (m *Metrics) score() {
+	m.Precision = ratio(m.TruePositives, m.TruePositives+m.FalsePositives)
+	m.Recall = ratio(m.TruePositives, m.TruePositives+m.FalseNegatives)
+	if m.Precision+m.Recall > 0 {
+		m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+	}
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 1
+	}
+	return float64(a) / float64(b)
+}
+
+// RuleMetrics are span-level results for one rule. Matches are located by
+// the line numbers the classifier reports, at most ten per rule and document.
+type RuleMetrics struct {
+	Rule     string          `json:"rule"`
+	Category models.Category `json:"category"`
+	Metrics
+	// Detections the ML classifier dropped below MinConfidence
+	MLDroppedTrue  int `json:"ml_dropped_true"`
+	MLDroppedFalse int `json:"ml_dropped_false"`
+}
+
+// CategoryMetrics are document-level results for one category
+type CategoryMetrics struct {
+	Category models.Category `json:"category"`
+	Metrics
+}
+
+// Confusion counts expected spans of one rule found only by another rule on
+// the same line
+type Confusion struct {
+	Expected  string `json:"expected"`
+	Predicted string `json:"predicted"`
+	Count     int    `json:"count"`
+}
+
+// Percentiles summarize per-document latencies in milliseconds
+type Percentiles struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+// Latency covers rule matching, ML enhancement and both together
+type Latency struct {
+	Classify Percentiles `json:"classify"`
+	Enhance  Percentiles `json:"enhance"`
+	Total    Percentiles `json:"total"`
+}
+
+// Report is the outcome of an evaluation run
+type Report struct {
+	GeneratedAt   time.Time         `json:"generated_at"`
+	Documents     int               `json:"documents"`
+	ExpectedSpans int               `json:"expected_spans"`
+	MLEnabled     bool              `json:"ml_enabled"`
+	MinConfidence float64           `json:"min_confidence"`
+	Overall       Metrics           `json:"overall"` // Micro-averaged over rules
+	Rules         []RuleMetrics     `json:"rules"`
+	Categories    []CategoryMetrics `json:"categories"`
+	Confusions    []Confusion       `json:"confusions"`
+	Latency       Latency           `json:"latency"`
+}
+
+// location is a rule finding on one line of a document
+type location struct {
+	rule string
+	line int
+}
+
+// Run classifies every document and compares the results with its labels
+func Run(ctx context.Context, docs []*Document, opts Options) (*Report, error) {
+	if len(docs) == 0 {
+		return nil, errors.New("no documents to evaluate")
+	}
+	c := opts.Classifier
+	if c == nil {
+		c = classifier.New()
+	}
+
+	report := &Report{
+		GeneratedAt:   time.Now().UTC(),
+		Documents:     len(docs),
+		MLEnabled:     opts.ML != nil,
+		MinConfidence: opts.MinConfidence,
+	}
+	rules := map[string]*RuleMetrics{}
+	categories := map[models.Category]*CategoryMetrics{}
+	confusions := map[[2]string]int{}
+	var classifyTimes, enhanceTimes, totalTimes []time.Duration
+
+	ruleMetrics := func(name string, category models.Category) *RuleMetrics {
+		if rules[name] == nil {
+			rules[name] = &RuleMetrics{Rule: name, Category: category}
+		}
+		return rules[name]
+	}
+	categoryMetrics := func(category models.Category) *CategoryMetrics {
+		if categories[category] == nil {
+			categories[category] = &CategoryMetrics{Category: category}
+		}
+		return categories[category]
+	}
+
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		result := c.ClassifyObject(doc.Content, &classifier.ObjectMetadata{
+			Bucket: doc.Bucket,
+			Path:   doc.Path,
+			Size:   int64(len(doc.Content)),
+		})
+		classified := time.Now()
+
+		kept := make([]bool, len(result.Matches))
+		for i := range kept {
+			kept[i] = true
+		}
+		if opts.ML != nil && len(result.Matches) > 0 {
+			enhanced, err := opts.ML.EnhanceScanMatches(ctx, doc.name(), result.Matches)
+			if err != nil {
+				return nil, fmt.Errorf("enhancing %s: %w", doc.name(), err)
+			}
+			for i, m := range enhanced.Matches {
+				kept[i] = m.DecisionConfidence() >= opts.MinConfidence
+			}
+		}
+		done := time.Now()
+		classifyTimes = append(classifyTimes, classified.Sub(start))
+		enhanceTimes = append(enhanceTimes, done.Sub(classified))
+		totalTimes = append(totalTimes, done.Sub(start))
+
+		// Expected findings
+		expected := map[location]bool{}
+		expectedCategories := map[models.Category]bool{}
+		for _, category := range doc.Categories {
+			expectedCategories[category] = true
+		}
+		for _, span := range doc.Spans {
+			expectedCategories[span.Category] = true
+			if span.Rule != "" && span.Line > 0 {
+				expected[location{span.Rule, span.Line}] = true
+				ruleMetrics(span.Rule, span.Category)
+				report.ExpectedSpans++
+			}
+		}
+
+		// Predicted findings; dropped ones are tracked to show what the ML
+		// classifier filtered out
+		predicted := map[location]bool{}
+		predictedCategories := map[models.Category]bool{}
+		for i, match := range result.Matches {
+			rm := ruleMetrics(match.RuleName, match.Category)
+			for _, line := range match.LineNumbers {
+				loc := location{match.RuleName, line}
+				switch {
+				case kept[i]:
+					predicted[loc] = true
+				case expected[loc]:
+					rm.MLDroppedTrue++
+				default:
+					rm.MLDroppedFalse++
+				}
+			}
+			if kept[i] {
+				predictedCategories[match.Category] = true
+			}
+		}
+
+		for loc := range predicted {
+			rm := rules[loc.rule]
+			if expected[loc] {
+				rm.TruePositives++
+			} else {
+				rm.FalsePositives++
+			}
+		}
+		for loc := range expected {
+			if predicted[loc] {
+				continue
+			}
+			rules[loc.rule].FalseNegatives++
+			for other := range predicted {
+				if other.line == loc.line && other.rule != loc.rule {
+					confusions[[2]string{loc.rule, other.rule}]++
+				}
+			}
+		}
+
+		for category := range expectedCategories {
+			cm := categoryMetrics(category)
+			if predictedCategories[category] {
+				cm.TruePositives++
+			} else {
+				cm.FalseNegatives++
+			}
+		}
+		for category := range predictedCategories {
+			if !expectedCategories[category] {
+				categoryMetrics(category).FalsePositives++
+			}
+		}
+	}
+
+	for _, rm := range rules {
+		rm.score()
+		report.Overall.TruePositives += rm.TruePositives
+		report.Overall.FalsePositives += rm.FalsePositives
+		report.Overall.FalseNegatives += rm.FalseNegatives
+		report.Rules = append(report.Rules, *rm)
+	}
+	report.Overall.score()
+	sort.Slice(report.Rules, func(i, j int) bool { return report.Rules[i].Rule < report.Rules[j].Rule })
+
+	for _, cm := range categories {
+		cm.score()
+		report.Categories = append(report.Categories, *cm)
+	}
+	sort.Slice(report.Categories, func(i, j int) bool { return report.Categories[i].Category < report.Categories[j].Category })
+
+	report.Confusions = []Confusion{}
+	for pair, count := range confusions {
+		report.Confusions = append(report.Confusions, Confusion{Expected: pair[0], Predicted: pair[1], Count: count})
+	}
+	sort.Slice(report.Confusions, func(i, j int) bool {
+		a, b := report.Confusions[i], report.Confusions[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Expected != b.Expected {
+			return a.Expected < b.Expected
+		}
+		return a.Predicted < b.Predicted
+	})
+
+	report.Latency = Latency{
+		Classify: percentiles(classifyTimes),
+		Enhance:  percentiles(enhanceTimes),
+		Total:    percentiles(totalTimes),
+	}
+	return report, nil
+}
+
+// percentiles uses the nearest-rank method
+func percentiles(durations []time.Duration) Percentiles {
+	if len(durations) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return milliseconds(sorted[i])
+	}
+	return Percentiles{
+		P50: rank(50),
+		P90: rank(90),
+		P99: rank(99),
+		Max: milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
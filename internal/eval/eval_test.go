@@ -0,0 +1,199 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/qualys/dspm/internal/mlclassifier"
+	"github.com/qualys/dspm/internal/models"
+	"github.com/qualys/dspm/internal/rules"
+)
+
+const employeePack = `
+name: hr
+version: 1.0.0
+rules:
+  - name: Employee ID
+    category: PII
+    sensitivity: HIGH
+    patterns: ['\bEMP-\d{6}\b']
+    context_patterns: [employee]
+    context_required: true
+    tests:
+      match: ["employee EMP-123456"]
+      no_match: ["ticket EMP-123456"]
+`
+
+func loadCorpus(t *testing.T) []*Document {
+	t.Helper()
+	docs, err := LoadManifest("testdata/corpus/manifest.jsonl")
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	return docs
+}
+
+func ruleResult(t *testing.T, report *Report, rule string) RuleMetrics {
+	t.Helper()
+	for _, rm := range report.Rules {
+		if rm.Rule == rule {
+			return rm
+		}
+	}
+	t.Fatalf("no result for rule %s", rule)
+	return RuleMetrics{}
+}
+
+func TestLoadManifest(t *testing.T) {
+	docs := loadCorpus(t)
+	if len(docs) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(docs))
+	}
+	if !strings.HasPrefix(docs[0].Content, "Patient record") {
+		t.Errorf("expected file content to be loaded, got %q", docs[0].Content)
+	}
+	// Offsets resolve to the line of the value
+	if got := docs[0].Spans[2].Line; got != 4 {
+		t.Errorf("expected PHONE_US span on line 4, got %d", got)
+	}
+	if docs[2].Path != "hr/cards.txt" || docs[2].Content == "" {
+		t.Errorf("expected inline content, got %+v", docs[2])
+	}
+
+	if _, err := LoadManifest("testdata/missing.jsonl"); err == nil {
+		t.Error("expected error for a missing manifest")
+	}
+}
+
+func TestRun_RulesOnly(t *testing.T) {
+	report, err := Run(context.Background(), loadCorpus(t), Options{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	tests := []struct {
+		rule       string
+		tp, fp, fn int
+	}{
+		{"SSN", 1, 0, 0},
+		{"EMAIL", 1, 0, 0},
+		{"PHONE_US", 1, 0, 0},
+		{"BANK_ACCOUNT", 1, 1, 0},
+		{"CREDIT_CARD", 0, 1, 0},
+		{"CORPORATE_CARD", 0, 0, 1},
+		{"Employee ID", 0, 0, 1},
+	}
+	for _, tt := range tests {
+		rm := ruleResult(t, report, tt.rule)
+		if rm.TruePositives != tt.tp || rm.FalsePositives != tt.fp || rm.FalseNegatives != tt.fn {
+			t.Errorf("%s: expected tp=%d fp=%d fn=%d, got %+v", tt.rule, tt.tp, tt.fp, tt.fn, rm.Metrics)
+		}
+	}
+	if bank := ruleResult(t, report, "BANK_ACCOUNT"); bank.Precision != 0.5 || bank.Recall != 1 {
+		t.Errorf("expected BANK_ACCOUNT precision 0.5 and recall 1, got %+v", bank.Metrics)
+	}
+
+	if report.ExpectedSpans != 6 || report.Overall.TruePositives != 4 || report.Overall.FalsePositives != 2 || report.Overall.FalseNegatives != 2 {
+		t.Errorf("unexpected overall %+v from %d spans", report.Overall, report.ExpectedSpans)
+	}
+
+	wantConfusions := []Confusion{{Expected: "CORPORATE_CARD", Predicted: "CREDIT_CARD", Count: 1}}
+	if !reflect.DeepEqual(report.Confusions, wantConfusions) {
+		t.Errorf("expected confusions %+v, got %+v", wantConfusions, report.Confusions)
+	}
+
+	// The employee ID is missed, so PII is expected but not found in the third document
+	for _, cm := range report.Categories {
+		switch cm.Category {
+		case models.CategoryPII:
+			if cm.TruePositives != 1 || cm.FalseNegatives != 1 || cm.FalsePositives != 0 {
+				t.Errorf("unexpected PII metrics %+v", cm.Metrics)
+			}
+		case models.CategoryPCI:
+			if cm.TruePositives != 2 || cm.FalseNegatives != 0 || cm.FalsePositives != 0 {
+				t.Errorf("unexpected PCI metrics %+v", cm.Metrics)
+			}
+		}
+	}
+
+	if report.Latency.Total.Max < report.Latency.Total.P50 {
+		t.Errorf("expected max latency at least p50, got %+v", report.Latency.Total)
+	}
+}
+
+func TestRun_CustomRulesAndML(t *testing.T) {
+	pack, err := rules.ParsePack([]byte(employeePack))
+	if err != nil {
+		t.Fatalf("ParsePack: %v", err)
+	}
+	engine := rules.NewEngine(nil)
+	if err := engine.LoadPack(pack); err != nil {
+		t.Fatalf("LoadPack: %v", err)
+	}
+	c, err := engine.NewClassifier()
+	if err != nil {
+		t.Fatalf("NewClassifier: %v", err)
+	}
+
+	report, err := Run(context.Background(), loadCorpus(t), Options{Classifier: c, ML: mlclassifier.NewService(nil)})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if rm := ruleResult(t, report, "Employee ID"); rm.TruePositives != 1 || rm.FalseNegatives != 0 {
+		t.Errorf("expected the pack rule to find the employee ID, got %+v", rm.Metrics)
+	}
+	if !report.MLEnabled {
+		t.Error("expected ML enhancement to be reported")
+	}
+
+	// Above every possible confidence, the ML classifier drops all matches
+	report, err = Run(context.Background(), loadCorpus(t), Options{Classifier: c, ML: mlclassifier.NewService(nil), MinConfidence: 1.01})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	bank := ruleResult(t, report, "BANK_ACCOUNT")
+	if bank.TruePositives != 0 || bank.FalseNegatives != 1 || bank.MLDroppedTrue != 1 || bank.MLDroppedFalse != 1 {
+		t.Errorf("expected both BANK_ACCOUNT detections to be dropped, got %+v", bank)
+	}
+	if report.Overall.TruePositives != 0 || report.Overall.Recall != 0 {
+		t.Errorf("expected nothing found, got %+v", report.Overall)
+	}
+}
+
+func TestReport_Formats(t *testing.T) {
+	report, err := Run(context.Background(), loadCorpus(t), Options{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("decoding JSON report: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Rules, report.Rules) {
+		t.Error("expected rule metrics to round-trip through JSON")
+	}
+
+	buf.Reset()
+	if err := report.WriteMarkdown(&buf); err != nil {
+		t.Fatalf("WriteMarkdown: %v", err)
+	}
+	md := buf.String()
+	for _, want := range []string{
+		"| BANK_ACCOUNT | PCI | 1 | 1 | 0 | 0.500 | 1.000 | 0.667 | 0/0 |",
+		"| CORPORATE_CARD | CREDIT_CARD | 1 |",
+		"ML enhancement off.",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected Markdown to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as Markdown tables, suitable for release
+// notes and for diffing between releases
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("# Classifier evaluation\n\n")
+	fmt.Fprintf(&b, "Generated %s from %d documents with %d expected spans.", r.GeneratedAt.Format("2006-01-02 15:04 MST"), r.Documents, r.ExpectedSpans)
+	if r.MLEnabled {
+		fmt.Fprintf(&b, " ML enhancement on, matches below %.2f confidence dropped.\n\n", r.MinConfidence)
+	} else {
+		b.WriteString(" ML enhancement off.\n\n")
+	}
+
+	b.WriteString("## Overall\n\n")
+	b.WriteString("| TP | FP | FN | Precision | Recall | F1 |\n")
+	b.WriteString("|---:|---:|---:|---:|---:|---:|\n")
+	fmt.Fprintf(&b, "| %s |\n\n", metricCells(r.Overall))
+
+	b.WriteString("## Rules\n\n")
+	b.WriteString("| Rule | Category | TP | FP | FN | Precision | Recall | F1 | ML dropped (true/false) |\n")
+	b.WriteString("|---|---|---:|---:|---:|---:|---:|---:|---:|\n")
+	for _, rm := range r.Rules {
+		fmt.Fprintf(&b, "| %s | %s | %s | %d/%d |\n", escape(rm.Rule), rm.Category, metricCells(rm.Metrics), rm.MLDroppedTrue, rm.MLDroppedFalse)
+	}
+
+	b.WriteString("\n## Categories\n\n")
+	b.WriteString("| Category | TP | FP | FN | Precision | Recall | F1 |\n")
+	b.WriteString("|---|---:|---:|---:|---:|---:|---:|\n")
+	for _, cm := range r.Categories {
+		fmt.Fprintf(&b, "| %s | %s |\n", cm.Category, metricCells(cm.Metrics))
+	}
+
+	b.WriteString("\n## Confusions\n\n")
+	if len(r.Confusions) == 0 {
+		b.WriteString("No expected span was found only by a different rule.\n")
+	} else {
+		b.WriteString("| Expected | Found instead | Count |\n")
+		b.WriteString("|---|---|---:|\n")
+		for _, c := range r.Confusions {
+			fmt.Fprintf(&b, "| %s | %s | %d |\n", escape(c.Expected), escape(c.Predicted), c.Count)
+		}
+	}
+
+	b.WriteString("\n## Latency per document (ms)\n\n")
+	b.WriteString("| Stage | p50 | p90 | p99 | max |\n")
+	b.WriteString("|---|---:|---:|---:|---:|\n")
+	for _, stage := range []struct {
+		name string
+		p    Percentiles
+	}{
+		{"classify", r.Latency.Classify},
+		{"enhance", r.Latency.Enhance},
+		{"total", r.Latency.Total},
+	} {
+		fmt.Fprintf(&b, "| %s | %.3f | %.3f | %.3f | %.3f |\n", stage.name, stage.p.P50, stage.p.P90, stage.p.P99, stage.p.Max)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func metricCells(m Metrics) string {
+	return fmt.Sprintf("%d | %d | %d | %.3f | %.3f | %.3f",
+		m.TruePositives, m.FalsePositives, m.FalseNegatives, m.Precision, m.Recall, m.F1)
+}
+
+// escape keeps rule names containing pipes from breaking table rows
+func escape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,227 @@
+package metadata
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// documentParts are the parts of Office and OpenDocument packages holding
+// the people who wrote or commented on a document, with the element or
+// attribute naming each of them
+var documentParts = map[string][]struct {
+	tag     string
+	pattern *regexp.Regexp
+}{
+	"docProps/core.xml": {
+		{"OOXML:creator", regexp.MustCompile(`(?s)<dc:creator>(.*?)</dc:creator>`)},
+		{"OOXML:lastModifiedBy", regexp.MustCompile(`(?s)<cp:lastModifiedBy>(.*?)</cp:lastModifiedBy>`)},
+	},
+	"docProps/app.xml": {
+		{"OOXML:Manager", regexp.MustCompile(`(?s)<Manager>(.*?)</Manager>`)},
+	},
+	"word/comments.xml": {
+		{"OOXML:commentAuthor", regexp.MustCompile(`\sw:author="([^"]*)"`)},
+	},
+	"ppt/commentAuthors.xml": {
+		{"OOXML:commentAuthor", regexp.MustCompile(`<p:cmAuthor\s[^>]*name="([^"]*)"`)},
+	},
+	"meta.xml": {
+		{"ODF:initial-creator", regexp.MustCompile(`(?s)<meta:initial-creator>(.*?)</meta:initial-creator>`)},
+		{"ODF:creator", regexp.MustCompile(`(?s)<dc:creator>(.*?)</dc:creator>`)},
+	},
+}
+
+// parseZipDocument reads the document properties of an Office Open XML or
+// OpenDocument package. Only the central directory and the property parts
+// are read, not the document body.
+func parseZipDocument(r io.ReaderAt, size int64, m *Metadata) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if f.Name == "meta.xml" {
+			m.Format = FormatODF
+		}
+	}
+
+	for _, f := range zr.File {
+		fields, ok := documentParts[f.Name]
+		if !ok {
+			continue
+		}
+		if f.UncompressedSize64 > maxBlockSize {
+			return fmt.Errorf("%s is %d bytes", f.Name, f.UncompressedSize64)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		part, err := io.ReadAll(io.LimitReader(rc, maxBlockSize))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			for _, match := range field.pattern.FindAllSubmatch(part, -1) {
+				m.add(KindAuthor, field.tag, xmpText(string(match[1])))
+			}
+		}
+	}
+	return nil
+}
+
+// pdfWindow is how much of the start and end of a PDF is searched. The
+// document information dictionary and the XMP packet sit near one end in
+// practice: linearized files write them first, incremental saves last.
+const pdfWindow = 256 * 1024
+
+var (
+	pdfAuthor    = regexp.MustCompile(`/Author\s*([(<])`)
+	pdfXMPPacket = regexp.MustCompile(`(?s)<x:xmpmeta.*?</x:xmpmeta>`)
+)
+
+// parsePDF reads the Author entry of the document information dictionary
+// and the XMP packet. Dictionaries inside compressed object streams are not
+// visible to this search.
+func parsePDF(r *io.SectionReader, m *Metadata) error {
+	size := r.Size()
+	head, err := readBlock(r, 0, min(size, pdfWindow))
+	if err != nil {
+		return err
+	}
+	windows := [][]byte{head}
+	if size > pdfWindow {
+		tailStart := max(pdfWindow, size-pdfWindow)
+		tail, err := readBlock(r, tailStart, size-tailStart)
+		if err != nil {
+			return err
+		}
+		windows = append(windows, tail)
+	}
+
+	for _, data := range windows {
+		for _, loc := range pdfAuthor.FindAllSubmatchIndex(data, -1) {
+			if value, ok := readPDFString(data[loc[2]:]); ok {
+				m.add(KindAuthor, "PDF:Author", value)
+			}
+		}
+		for _, packet := range pdfXMPPacket.FindAll(data, -1) {
+			parseXMP(string(packet), m)
+		}
+	}
+	return nil
+}
+
+// readPDFString decodes the literal "(...)" or hex "<...>" string at the
+// start of data
+func readPDFString(data []byte) (string, bool) {
+	var raw []byte
+	switch data[0] {
+	case '(':
+		var ok bool
+		if raw, ok = readPDFLiteral(data[1:]); !ok {
+			return "", false
+		}
+	case '<':
+		end := bytes.IndexByte(data, '>')
+		if end < 0 {
+			return "", false
+		}
+		digits := bytes.Map(func(r rune) rune {
+			if strings.ContainsRune(" \t\r\n", r) {
+				return -1
+			}
+			return r
+		}, data[1:end])
+		if len(digits)%2 != 0 {
+			digits = append(digits, '0')
+		}
+		raw = make([]byte, len(digits)/2)
+		if _, err := hex.Decode(raw, digits); err != nil {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return decodePDFText(raw), true
+}
+
+// readPDFLiteral reads a literal string up to its closing parenthesis,
+// resolving escapes and balanced nested parentheses
+func readPDFLiteral(data []byte) ([]byte, bool) {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(data) {
+				return nil, false
+			}
+			switch e := data[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					j := i
+					for ; j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7'; j++ {
+						v = v*8 + int(data[j]-'0')
+					}
+					out = append(out, byte(v))
+					i = j - 1
+				} else {
+					out = append(out, e)
+				}
+			}
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			if depth == 0 {
+				return out, true
+			}
+			depth--
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return nil, false
+}
+
+// decodePDFText decodes a PDF text string: UTF-16BE when it starts with a
+// byte order mark, otherwise PDFDocEncoding, read as Latin-1
+func decodePDFText(raw []byte) string {
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		units := make([]uint16, 0, len(raw)/2)
+		for i := 2; i+1 < len(raw); i += 2 {
+			units = append(units, binary.BigEndian.Uint16(raw[i:]))
+		}
+		return string(utf16.Decode(units))
+	}
+	runes := make([]rune, len(raw))
+	for i, c := range raw {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
@@ -0,0 +1,226 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// TIFF tags holding personal data or pointing at the IFDs that do
+const (
+	tagArtist             = 0x013B
+	tagXMP                = 0x02BC
+	tagIPTC               = 0x83BB
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagXPAuthor           = 0x9C9D
+	tagCameraOwnerName    = 0xA430
+	tagBodySerialNumber   = 0xA431
+	tagLensSerialNumber   = 0xA435
+	tagCameraSerialNumber = 0xC62F
+
+	tagGPSLatitudeRef  = 1
+	tagGPSLatitude     = 2
+	tagGPSLongitudeRef = 3
+	tagGPSLongitude    = 4
+)
+
+// maxIFDEntries bounds the entries read from one IFD
+const maxIFDEntries = 1024
+
+var errBadTIFF = errors.New("invalid TIFF header")
+
+// tiffTypeSizes are the byte sizes of the TIFF field types
+var tiffTypeSizes = map[uint16]int64{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// tiffEntry is an IFD entry with its value bytes read
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// tiffReader reads IFDs from a TIFF structure, as found in TIFF files, JPEG
+// APP1 segments, PNG eXIf chunks and HEIF Exif items
+type tiffReader struct {
+	r       *io.SectionReader
+	order   binary.ByteOrder
+	visited map[int64]bool
+}
+
+// parseTIFF reads the EXIF, GPS, XMP and IPTC data of a TIFF structure
+func parseTIFF(r *io.SectionReader, m *Metadata) error {
+	header, err := readBlock(r, 0, 8)
+	if err != nil {
+		return err
+	}
+	t := &tiffReader{r: r, visited: make(map[int64]bool)}
+	switch string(header[:4]) {
+	case "II*\x00":
+		t.order = binary.LittleEndian
+	case "MM\x00*":
+		t.order = binary.BigEndian
+	default:
+		return errBadTIFF
+	}
+
+	ifd0, err := t.readIFD(int64(t.order.Uint32(header[4:])))
+	if err != nil {
+		return err
+	}
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagArtist:
+			m.add(KindAuthor, "EXIF:Artist", string(e.value))
+		case tagXPAuthor:
+			m.add(KindAuthor, "EXIF:XPAuthor", decodeUTF16LE(e.value))
+		case tagCameraSerialNumber:
+			m.add(KindDeviceSerial, "EXIF:CameraSerialNumber", string(e.value))
+		case tagXMP:
+			parseXMP(string(e.value), m)
+		case tagIPTC:
+			parseIPTC(e.value, m)
+		}
+	}
+
+	if off, ok := t.pointer(ifd0, tagExifIFD); ok {
+		exif, err := t.readIFD(off)
+		if err != nil {
+			return err
+		}
+		for _, e := range exif {
+			switch e.tag {
+			case tagCameraOwnerName:
+				m.add(KindAuthor, "EXIF:CameraOwnerName", string(e.value))
+			case tagBodySerialNumber:
+				m.add(KindDeviceSerial, "EXIF:BodySerialNumber", string(e.value))
+			case tagLensSerialNumber:
+				m.add(KindDeviceSerial, "EXIF:LensSerialNumber", string(e.value))
+			}
+		}
+	}
+
+	if off, ok := t.pointer(ifd0, tagGPSIFD); ok {
+		gps, err := t.readIFD(off)
+		if err != nil {
+			return err
+		}
+		t.parseGPS(gps, m)
+	}
+	return nil
+}
+
+// readIFD reads the entries of the IFD at off
+func (t *tiffReader) readIFD(off int64) ([]tiffEntry, error) {
+	if t.visited[off] {
+		return nil, errors.New("IFD loop")
+	}
+	t.visited[off] = true
+
+	countBytes, err := readBlock(t.r, off, 2)
+	if err != nil {
+		return nil, err
+	}
+	count := int64(t.order.Uint16(countBytes))
+	if count > maxIFDEntries {
+		return nil, errors.New("too many IFD entries")
+	}
+	raw, err := readBlock(t.r, off+2, count*12)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]tiffEntry, 0, count)
+	for i := int64(0); i < count; i++ {
+		b := raw[i*12 : i*12+12]
+		e := tiffEntry{
+			tag:   t.order.Uint16(b[0:]),
+			typ:   t.order.Uint16(b[2:]),
+			count: t.order.Uint32(b[4:]),
+		}
+		size, ok := tiffTypeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		n := size * int64(e.count)
+		if n <= 4 {
+			e.value = b[8 : 8+n]
+		} else if e.value, err = readBlock(t.r, int64(t.order.Uint32(b[8:])), n); err != nil {
+			// A bad offset loses this value, not the rest of the IFD
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// pointer returns the offset held by the IFD pointer tag
+func (t *tiffReader) pointer(entries []tiffEntry, tag uint16) (int64, bool) {
+	for _, e := range entries {
+		if e.tag == tag && len(e.value) >= 4 {
+			return int64(t.order.Uint32(e.value)), true
+		}
+	}
+	return 0, false
+}
+
+// parseGPS records the position in a GPS IFD
+func (t *tiffReader) parseGPS(entries []tiffEntry, m *Metadata) {
+	var latRef, lonRef string
+	var lat, lon []float64
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = strings.TrimRight(string(e.value), "\x00")
+		case tagGPSLongitudeRef:
+			lonRef = strings.TrimRight(string(e.value), "\x00")
+		case tagGPSLatitude:
+			lat = t.rationals(e)
+		case tagGPSLongitude:
+			lon = t.rationals(e)
+		}
+	}
+	if len(lat) != 3 || len(lon) != 3 {
+		return
+	}
+	latitude := lat[0] + lat[1]/60 + lat[2]/3600
+	longitude := lon[0] + lon[1]/60 + lon[2]/3600
+	if latRef == "S" {
+		latitude = -latitude
+	}
+	if lonRef == "W" {
+		longitude = -longitude
+	}
+	m.addGPS("EXIF:GPSLatitude/GPSLongitude", latitude, longitude)
+}
+
+// rationals decodes an entry of unsigned rationals
+func (t *tiffReader) rationals(e tiffEntry) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	values := make([]float64, 0, e.count)
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		num := t.order.Uint32(e.value[i:])
+		den := t.order.Uint32(e.value[i+4:])
+		if den == 0 {
+			return nil
+		}
+		values = append(values, float64(num)/float64(den))
+	}
+	return values
+}
+
+// decodeUTF16LE decodes the UTF-16LE strings Windows writes to XP tags
+func decodeUTF16LE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(b[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
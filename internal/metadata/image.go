@@ -0,0 +1,422 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// JPEG segment identifiers
+var (
+	jpegExifID      = []byte("Exif\x00\x00")
+	jpegXMPID       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegPhotoshopID = []byte("Photoshop 3.0\x00")
+)
+
+// parseJPEG reads the APP1 (EXIF, XMP) and APP13 (IPTC) segments before
+// the image data
+func parseJPEG(r *io.SectionReader, m *Metadata) error {
+	off := int64(2)
+	for {
+		header, err := readBlock(r, off, 4)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if header[0] != 0xFF {
+			return errors.New("invalid JPEG marker")
+		}
+		marker := header[1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before a marker
+			off++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			off += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			// Start of scan: metadata segments come before the image data
+			return nil
+		}
+
+		length := int64(binary.BigEndian.Uint16(header[2:]))
+		if length < 2 {
+			return errors.New("invalid JPEG segment length")
+		}
+		if marker == 0xE1 || marker == 0xED {
+			segment, err := readBlock(r, off+4, length-2)
+			if err != nil {
+				return err
+			}
+			switch {
+			case marker == 0xE1 && bytes.HasPrefix(segment, jpegExifID):
+				data := segment[len(jpegExifID):]
+				if err := parseTIFF(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), m); err != nil {
+					return err
+				}
+			case marker == 0xE1 && bytes.HasPrefix(segment, jpegXMPID):
+				parseXMP(string(segment[len(jpegXMPID):]), m)
+			case marker == 0xED && bytes.HasPrefix(segment, jpegPhotoshopID):
+				parsePhotoshopResources(segment[len(jpegPhotoshopID):], m)
+			}
+		}
+		off += 2 + length
+	}
+}
+
+// parsePNG reads the eXIf chunk, the XMP iTXt chunk and the Author text
+// chunks. Encoders write these before the image data, and walking the IDAT
+// chunks of a large image would mean fetching most of it, so the walk stops
+// at the first IDAT.
+func parsePNG(r *io.SectionReader, m *Metadata) error {
+	off := int64(len(pngSignature))
+	for {
+		header, err := readBlock(r, off, 8)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		if typ == "IDAT" || typ == "IEND" {
+			return nil
+		}
+		if typ == "eXIf" || typ == "iTXt" || typ == "tEXt" || typ == "zTXt" {
+			data, err := readBlock(r, off+8, length)
+			if err != nil {
+				return err
+			}
+			if typ == "eXIf" {
+				if err := parseTIFF(io.NewSectionReader(bytes.NewReader(data), 0, length), m); err != nil {
+					return err
+				}
+			} else {
+				parsePNGText(typ, data, m)
+			}
+		}
+		off += 12 + length
+	}
+}
+
+// parsePNGText records the Author keyword and XMP packet of a text chunk
+func parsePNGText(typ string, data []byte, m *Metadata) {
+	keyword, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return
+	}
+	var text string
+	switch typ {
+	case "tEXt":
+		text = string(rest)
+	case "zTXt":
+		if len(rest) < 1 {
+			return
+		}
+		text = inflate(rest[1:])
+	case "iTXt":
+		// compression flag, compression method, language tag, translated keyword
+		if len(rest) < 2 {
+			return
+		}
+		compressed := rest[0] == 1
+		fields := bytes.SplitN(rest[2:], []byte{0}, 3)
+		if len(fields) != 3 {
+			return
+		}
+		text = string(fields[2])
+		if compressed {
+			text = inflate(fields[2])
+		}
+	}
+
+	switch string(keyword) {
+	case "Author":
+		m.add(KindAuthor, "PNG:Author", text)
+	case "XML:com.adobe.xmp":
+		parseXMP(text, m)
+	}
+}
+
+// inflate decompresses zlib data, returning "" when it is invalid
+func inflate(data []byte) string {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxBlockSize))
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// heifBrands are the ftyp brands of HEIF images
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true, "hevc": true, "hevx": true,
+	"mif1": true, "msf1": true, "avif": true,
+}
+
+func isHEIFBrand(brand string) bool {
+	return heifBrands[brand]
+}
+
+// isoBox is an ISO base media file format box
+type isoBox struct {
+	typ    string
+	offset int64 // start of the box payload
+	size   int64 // payload size
+}
+
+// readBoxes lists the boxes in [off, end)
+func readBoxes(r *io.SectionReader, off, end int64) ([]isoBox, error) {
+	var boxes []isoBox
+	for off+8 <= end {
+		header, err := readBlock(r, off, 8)
+		if err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			large, err := readBlock(r, off+8, 8)
+			if err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(large))
+			headerSize = 16
+		}
+		if size < headerSize || off+size > end {
+			return nil, errors.New("invalid box size")
+		}
+		boxes = append(boxes, isoBox{typ: typ, offset: off + headerSize, size: size - headerSize})
+		off += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []isoBox, typ string) (isoBox, bool) {
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true
+		}
+	}
+	return isoBox{}, false
+}
+
+// heifItem is an item of a HEIF meta box with its file extents
+type heifItem struct {
+	typ         string
+	contentType string
+	extents     [][2]int64 // offset, length
+}
+
+// parseHEIF reads the Exif and XMP items listed in the meta box
+func parseHEIF(r *io.SectionReader, m *Metadata) error {
+	top, err := readBoxes(r, 0, r.Size())
+	if err != nil {
+		return err
+	}
+	meta, ok := findBox(top, "meta")
+	if !ok {
+		return nil
+	}
+	// meta is a full box: version and flags precede its children
+	children, err := readBoxes(r, meta.offset+4, meta.offset+meta.size)
+	if err != nil {
+		return err
+	}
+	iinf, okInf := findBox(children, "iinf")
+	iloc, okLoc := findBox(children, "iloc")
+	if !okInf || !okLoc {
+		return nil
+	}
+	items, err := readItemInfo(r, iinf)
+	if err != nil {
+		return err
+	}
+	if err := readItemLocations(r, iloc, items); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if len(item.extents) == 0 {
+			continue
+		}
+		var data []byte
+		for _, extent := range item.extents {
+			chunk, err := readBlock(r, extent[0], extent[1])
+			if err != nil {
+				return err
+			}
+			data = append(data, chunk...)
+		}
+		switch {
+		case item.typ == "Exif" && len(data) >= 4:
+			// The item starts with the offset of the TIFF header
+			start := 4 + int64(binary.BigEndian.Uint32(data))
+			if start >= int64(len(data)) {
+				continue
+			}
+			tiff := data[start:]
+			if err := parseTIFF(io.NewSectionReader(bytes.NewReader(tiff), 0, int64(len(tiff))), m); err != nil {
+				return err
+			}
+		case item.typ == "mime" && strings.Contains(item.contentType, "rdf+xml"):
+			parseXMP(string(data), m)
+		}
+	}
+	return nil
+}
+
+// readItemInfo reads the item types from an iinf box
+func readItemInfo(r *io.SectionReader, iinf isoBox) (map[uint32]*heifItem, error) {
+	data, err := readBlock(r, iinf.offset, iinf.size)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 6 {
+		return nil, errors.New("invalid iinf box")
+	}
+	pos := int64(6)
+	if data[0] != 0 {
+		pos = 8
+	}
+	entries, err := readBoxes(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), pos, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(map[uint32]*heifItem)
+	for _, e := range entries {
+		if e.typ != "infe" || e.size < 4 {
+			continue
+		}
+		infe := data[e.offset : e.offset+e.size]
+		version := infe[0]
+		if version < 2 {
+			continue
+		}
+		p := 4
+		var id uint32
+		if version == 2 {
+			if len(infe) < p+8 {
+				continue
+			}
+			id = uint32(binary.BigEndian.Uint16(infe[p:]))
+			p += 2
+		} else {
+			if len(infe) < p+10 {
+				continue
+			}
+			id = binary.BigEndian.Uint32(infe[p:])
+			p += 4
+		}
+		p += 2 // item_protection_index
+		item := &heifItem{typ: string(infe[p : p+4])}
+		p += 4
+		if item.typ == "mime" {
+			// item_name then content_type, both null terminated
+			if _, rest, ok := bytes.Cut(infe[p:], []byte{0}); ok {
+				contentType, _, _ := bytes.Cut(rest, []byte{0})
+				item.contentType = string(contentType)
+			}
+		}
+		items[id] = item
+	}
+	return items, nil
+}
+
+// readItemLocations reads the file extents of items from an iloc box. Only
+// items stored at file offsets are located; those stored in an idat box are
+// image data, not metadata, in practice.
+func readItemLocations(r *io.SectionReader, iloc isoBox, items map[uint32]*heifItem) error {
+	data, err := readBlock(r, iloc.offset, iloc.size)
+	if err != nil {
+		return err
+	}
+	b := &byteCursor{data: data}
+	version := b.uint(1)
+	b.skip(3)
+	sizes := b.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0x0F)
+	sizes = b.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0x0F)
+	}
+	var count uint64
+	if version < 2 {
+		count = b.uint(2)
+	} else {
+		count = b.uint(4)
+	}
+
+	for i := uint64(0); i < count && b.err == nil; i++ {
+		var id uint32
+		if version < 2 {
+			id = uint32(b.uint(2))
+		} else {
+			id = uint32(b.uint(4))
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = b.uint(2) & 0x0F
+		}
+		b.skip(2) // data_reference_index
+		base := int64(b.uint(baseOffsetSize))
+		extentCount := b.uint(2)
+		var extents [][2]int64
+		for j := uint64(0); j < extentCount && b.err == nil; j++ {
+			b.skip(indexSize)
+			extentOffset := int64(b.uint(offsetSize))
+			extentLength := int64(b.uint(lengthSize))
+			extents = append(extents, [2]int64{base + extentOffset, extentLength})
+		}
+		if item, ok := items[id]; ok && method == 0 {
+			item.extents = extents
+		}
+	}
+	return b.err
+}
+
+// byteCursor reads big-endian integers of variable width from a buffer
+type byteCursor struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (b *byteCursor) uint(n int) uint64 {
+	if b.err != nil || n == 0 {
+		return 0
+	}
+	if b.pos+n > len(b.data) {
+		b.err = errors.New("truncated box")
+		return 0
+	}
+	var v uint64
+	for _, c := range b.data[b.pos : b.pos+n] {
+		v = v<<8 | uint64(c)
+	}
+	b.pos += n
+	return v
+}
+
+func (b *byteCursor) skip(n int) {
+	b.uint(n)
+}
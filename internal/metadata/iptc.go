@@ -0,0 +1,78 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// IPTC-IIM application record datasets naming people
+const (
+	iptcRecordApplication = 2
+	iptcByline            = 80
+	iptcWriter            = 122
+)
+
+// photoshopIPTCResource is the Photoshop image resource holding IPTC-IIM data
+const photoshopIPTCResource = 0x0404
+
+// parseIPTC records the author datasets in IPTC-IIM data
+func parseIPTC(data []byte, m *Metadata) {
+	for i := 0; i+5 <= len(data); {
+		if data[i] != 0x1C {
+			i++
+			continue
+		}
+		record, dataset := data[i+1], data[i+2]
+		size := int(binary.BigEndian.Uint16(data[i+3:]))
+		if size&0x8000 != 0 {
+			// Extended datasets are only used for large binary values
+			return
+		}
+		start := i + 5
+		if start+size > len(data) {
+			return
+		}
+		value := string(data[start : start+size])
+		if record == iptcRecordApplication {
+			switch dataset {
+			case iptcByline:
+				m.add(KindAuthor, "IPTC:By-line", value)
+			case iptcWriter:
+				m.add(KindAuthor, "IPTC:Writer-Editor", value)
+			}
+		}
+		i = start + size
+	}
+}
+
+// parsePhotoshopResources finds the IPTC-IIM resource in Photoshop image
+// resources, as stored in JPEG APP13 segments
+func parsePhotoshopResources(data []byte, m *Metadata) {
+	for i := 0; i+8 <= len(data); {
+		if !bytes.Equal(data[i:i+4], []byte("8BIM")) {
+			return
+		}
+		id := binary.BigEndian.Uint16(data[i+4:])
+		// The resource name is a Pascal string padded to an even length
+		nameLen := int(data[i+6])
+		pos := i + 6 + nameLen + 1
+		if pos%2 != 0 {
+			pos++
+		}
+		if pos+4 > len(data) {
+			return
+		}
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			return
+		}
+		if id == photoshopIPTCResource {
+			parseIPTC(data[pos:pos+size], m)
+		}
+		i = pos + size
+		if i%2 != 0 {
+			i++
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package metadata extracts personal data from the metadata of images and
+// documents: EXIF, XMP and IPTC in JPEG, PNG, TIFF and HEIC files, and the
+// document properties of Office and PDF files.
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ErrUnsupportedFormat is returned for content in none of the supported formats
+var ErrUnsupportedFormat = errors.New("unsupported metadata format")
+
+// maxBlockSize caps how much of a single metadata block is read, so a corrupt
+// length field cannot force a huge allocation
+const maxBlockSize = 1 << 20
+
+// Kind is the kind of personal data a metadata field reveals
+type Kind string
+
+const (
+	KindGPS          Kind = "GPS_LOCATION"
+	KindDeviceSerial Kind = "DEVICE_SERIAL"
+	KindAuthor       Kind = "AUTHOR_NAME"
+	KindFaceRegion   Kind = "FACE_REGION"
+)
+
+// Kinds lists every kind of field Extract reports
+var Kinds = []Kind{KindGPS, KindDeviceSerial, KindAuthor, KindFaceRegion}
+
+// Format names the container a file's metadata was read from
+type Format string
+
+const (
+	FormatJPEG  Format = "JPEG"
+	FormatPNG   Format = "PNG"
+	FormatTIFF  Format = "TIFF"
+	FormatHEIC  Format = "HEIC"
+	FormatOOXML Format = "OOXML"
+	FormatODF   Format = "ODF"
+	FormatPDF   Format = "PDF"
+)
+
+// Field is a metadata value revealing personal data
+type Field struct {
+	Kind Kind
+	// Tag says where the value was found, such as "EXIF:GPSLatitude" or "PDF:Author"
+	Tag   string
+	Value string
+}
+
+// Metadata holds the personal data found in a file's metadata
+type Metadata struct {
+	Format Format
+	Fields []Field
+}
+
+// FieldsOf returns the fields of the given kind
+func (m *Metadata) FieldsOf(kind Kind) []Field {
+	var fields []Field
+	for _, f := range m.Fields {
+		if f.Kind == kind {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// add records a field, dropping empty values, values that do not look like
+// personal data for their kind and values already recorded for the kind
+func (m *Metadata) add(kind Kind, tag, value string) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	switch kind {
+	case KindAuthor, KindFaceRegion:
+		if !isPersonalName(value) {
+			return
+		}
+	case KindDeviceSerial:
+		if !isSerialNumber(value) {
+			return
+		}
+	}
+	if value == "" {
+		return
+	}
+	for _, f := range m.Fields {
+		if f.Kind == kind && f.Value == value {
+			return
+		}
+	}
+	m.Fields = append(m.Fields, Field{Kind: kind, Tag: tag, Value: value})
+}
+
+// addGPS records a position unless it is the 0,0 placeholder some devices
+// write when they have no fix
+func (m *Metadata) addGPS(tag string, lat, lon float64) {
+	if lat == 0 && lon == 0 {
+		return
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return
+	}
+	m.add(KindGPS, tag, fmt.Sprintf("%.6f, %.6f", lat, lon))
+}
+
+// imageExtensions and documentExtensions are the file types Extract handles
+var (
+	imageExtensions = map[string]bool{
+		".jpg": true, ".jpeg": true, ".png": true, ".tif": true, ".tiff": true,
+		".dng": true, ".heic": true, ".heif": true,
+	}
+	documentExtensions = map[string]bool{
+		".docx": true, ".docm": true, ".xlsx": true, ".xlsm": true, ".pptx": true, ".pptm": true,
+		".odt": true, ".ods": true, ".odp": true, ".pdf": true,
+	}
+)
+
+// Supported reports whether the file named name is scanned for metadata
+// rather than text content
+func Supported(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return imageExtensions[ext] || documentExtensions[ext]
+}
+
+// Extract reads the metadata of a file of size bytes from r. The format is
+// recognized from the content; only the blocks holding metadata are read, so
+// r can be backed by ranged reads of a remote object.
+func Extract(r io.ReaderAt, size int64) (*Metadata, error) {
+	magic := make([]byte, 12)
+	n, err := r.ReadAt(magic, 0)
+	if n < len(magic) && err != nil && err != io.EOF {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	magic = magic[:n]
+
+	m := &Metadata{}
+	section := io.NewSectionReader(r, 0, size)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0xFF, 0xD8}):
+		m.Format = FormatJPEG
+		err = parseJPEG(section, m)
+	case bytes.HasPrefix(magic, pngSignature):
+		m.Format = FormatPNG
+		err = parsePNG(section, m)
+	case bytes.HasPrefix(magic, []byte("II*\x00")) || bytes.HasPrefix(magic, []byte("MM\x00*")):
+		m.Format = FormatTIFF
+		err = parseTIFF(section, m)
+	case len(magic) >= 12 && string(magic[4:8]) == "ftyp" && isHEIFBrand(string(magic[8:12])):
+		m.Format = FormatHEIC
+		err = parseHEIF(section, m)
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		m.Format = FormatOOXML
+		err = parseZipDocument(r, size, m)
+	case bytes.HasPrefix(magic, []byte("%PDF-")):
+		m.Format = FormatPDF
+		err = parsePDF(section, m)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s metadata: %w", strings.ToLower(string(m.Format)), err)
+	}
+	return m, nil
+}
+
+// readBlock reads n bytes at off, capped at maxBlockSize
+func readBlock(r io.ReaderAt, off, n int64) ([]byte, error) {
+	if n < 0 || n > maxBlockSize {
+		return nil, fmt.Errorf("block of %d bytes at offset %d exceeds limit", n, off)
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// genericNames are placeholder author values set by tools and default
+// installs rather than by a person
+var genericNames = map[string]bool{
+	"admin": true, "administrator": true, "user": true, "owner": true, "author": true,
+	"unknown": true, "default": true, "guest": true, "root": true, "test": true, "none": true,
+	"microsoft office user": true, "windows user": true, "office user": true, "apple": true,
+	"apache poi": true, "python-docx": true, "openpyxl": true, "phpword": true, "phpspreadsheet": true,
+	"camscanner": true, "picasa": true, "copyright": true, "all rights reserved": true,
+}
+
+// isPersonalName reports whether value could name a person: it has letters,
+// is not a known placeholder and is not a URL
+func isPersonalName(value string) bool {
+	if value == "" || len(value) > 128 {
+		return false
+	}
+	if genericNames[strings.ToLower(value)] || strings.Contains(value, "://") {
+		return false
+	}
+	for _, r := range value {
+		if unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSerialNumber reports whether value looks like a real serial number
+// rather than an all-zero placeholder
+func isSerialNumber(value string) bool {
+	if len(value) < 4 || len(value) > 64 {
+		return false
+	}
+	for _, r := range value {
+		if (unicode.IsLetter(r) || unicode.IsDigit(r)) && r != '0' {
+			return true
+		}
+	}
+	return false
+}
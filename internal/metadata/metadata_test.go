@@ -0,0 +1,348 @@
+package metadata
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// testEntry is a TIFF entry written by buildTIFF
+type testEntry struct {
+	tag  uint16
+	typ  uint16
+	data []byte
+}
+
+func asciiEntry(tag uint16, s string) testEntry {
+	return testEntry{tag, 2, append([]byte(s), 0)}
+}
+
+func rationalEntry(tag uint16, values ...uint32) testEntry {
+	data := make([]byte, 0, len(values)*4)
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, v)
+	}
+	return testEntry{tag, 5, data}
+}
+
+// buildTIFF writes a little-endian TIFF structure with IFD0 and, when
+// given, an Exif and a GPS IFD linked from it
+func buildTIFF(ifd0, exif, gps []testEntry) []byte {
+	ifds := [][]testEntry{ifd0, exif, gps}
+	if exif != nil {
+		ifds[0] = append(ifds[0], testEntry{tagExifIFD, 4, make([]byte, 4)})
+	}
+	if gps != nil {
+		ifds[0] = append(ifds[0], testEntry{tagGPSIFD, 4, make([]byte, 4)})
+	}
+
+	offsets := make([]uint32, len(ifds))
+	next := uint32(8)
+	for i, ifd := range ifds {
+		if ifd == nil {
+			continue
+		}
+		offsets[i] = next
+		next += uint32(2 + 12*len(ifd) + 4)
+	}
+	for i, e := range ifds[0] {
+		switch e.tag {
+		case tagExifIFD:
+			binary.LittleEndian.PutUint32(ifds[0][i].data, offsets[1])
+		case tagGPSIFD:
+			binary.LittleEndian.PutUint32(ifds[0][i].data, offsets[2])
+		}
+	}
+
+	out := []byte("II*\x00")
+	out = binary.LittleEndian.AppendUint32(out, 8)
+	var values []byte
+	for _, ifd := range ifds {
+		if ifd == nil {
+			continue
+		}
+		out = binary.LittleEndian.AppendUint16(out, uint16(len(ifd)))
+		for _, e := range ifd {
+			count := uint32(int64(len(e.data)) / tiffTypeSizes[e.typ])
+			out = binary.LittleEndian.AppendUint16(out, e.tag)
+			out = binary.LittleEndian.AppendUint16(out, e.typ)
+			out = binary.LittleEndian.AppendUint32(out, count)
+			if len(e.data) <= 4 {
+				out = append(out, e.data...)
+				out = append(out, make([]byte, 4-len(e.data))...)
+			} else {
+				out = binary.LittleEndian.AppendUint32(out, next+uint32(len(values)))
+				values = append(values, e.data...)
+			}
+		}
+		out = binary.LittleEndian.AppendUint32(out, 0)
+	}
+	return append(out, values...)
+}
+
+// sampleTIFF carries an author, a body serial and a position of 37°46'29.64"N
+// 122°25'9.84"W
+func sampleTIFF() []byte {
+	return buildTIFF(
+		[]testEntry{asciiEntry(tagArtist, "Jane Doe")},
+		[]testEntry{asciiEntry(tagBodySerialNumber, "SN-48213377")},
+		[]testEntry{
+			asciiEntry(tagGPSLatitudeRef, "N"),
+			rationalEntry(tagGPSLatitude, 37, 1, 46, 1, 2964, 100),
+			asciiEntry(tagGPSLongitudeRef, "W"),
+			rationalEntry(tagGPSLongitude, 122, 1, 25, 1, 984, 100),
+		},
+	)
+}
+
+const sampleXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF>
+<rdf:Description aux:SerialNumber="0000000000" exif:GPSLatitude="48,51.4N" exif:GPSLongitude="2,21.05E">
+<dc:creator><rdf:Seq><rdf:li>Pierre Martin</rdf:li></rdf:Seq></dc:creator>
+<mwg-rs:Regions rdf:parseType="Resource"><mwg-rs:RegionList><rdf:Bag>
+<rdf:li><rdf:Description mwg-rs:Name="Anna Schmidt" mwg-rs:Type="Face"/></rdf:li>
+<rdf:li rdf:parseType="Resource"><mwg-rs:Name>Rex</mwg-rs:Name><mwg-rs:Type>Pet</mwg-rs:Type></rdf:li>
+</rdf:Bag></mwg-rs:RegionList></mwg-rs:Regions>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	out := []byte{0xFF, marker}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	return append(out, payload...)
+}
+
+func buildJPEG() []byte {
+	iptc := []byte{0x1C, 2, iptcByline}
+	iptc = binary.BigEndian.AppendUint16(iptc, uint16(len("Carlos Ruiz")))
+	iptc = append(iptc, "Carlos Ruiz"...)
+	irb := append([]byte("8BIM\x04\x04\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(iptc)))...)
+	irb = append(irb, iptc...)
+
+	out := []byte{0xFF, 0xD8}
+	out = append(out, jpegSegment(0xE0, []byte("JFIF\x00\x01\x02"))...)
+	out = append(out, jpegSegment(0xE1, append(append([]byte{}, jpegExifID...), sampleTIFF()...))...)
+	out = append(out, jpegSegment(0xE1, append(append([]byte{}, jpegXMPID...), sampleXMP...))...)
+	out = append(out, jpegSegment(0xED, append(append([]byte{}, jpegPhotoshopID...), irb...))...)
+	out = append(out, jpegSegment(0xDA, []byte{1, 2, 3})...)
+	return append(out, 0xFF, 0xD9)
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	out = append(out, typ...)
+	out = append(out, data...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+}
+
+func buildPNG() []byte {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte(sampleXMP))
+	zw.Close()
+	itxt := append([]byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00"), compressed.Bytes()...)
+
+	out := append([]byte{}, pngSignature...)
+	out = append(out, pngChunk("IHDR", make([]byte, 13))...)
+	out = append(out, pngChunk("tEXt", []byte("Author\x00Li Wei"))...)
+	out = append(out, pngChunk("iTXt", itxt)...)
+	out = append(out, pngChunk("IDAT", []byte{0})...)
+	// Text after the image data is not read
+	out = append(out, pngChunk("tEXt", []byte("Author\x00Late Author"))...)
+	return append(out, pngChunk("IEND", nil)...)
+}
+
+func isoBoxBytes(typ string, payload []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, typ...), payload...)
+}
+
+// buildHEIC writes a HEIF file whose Exif item is stored in mdat
+func buildHEIC() []byte {
+	exif := append([]byte{0, 0, 0, 0}, sampleTIFF()...)
+	ftyp := isoBoxBytes("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	infe := isoBoxBytes("infe", append([]byte{2, 0, 0, 0, 0, 1, 0, 0}, "Exif"...))
+	iinf := isoBoxBytes("iinf", append([]byte{0, 0, 0, 0, 0, 1}, infe...))
+
+	// iloc version 0, 4-byte offsets and lengths, no base offset; the offset
+	// is patched once the layout is known
+	iloc := []byte{0, 0, 0, 0, 0x44, 0x00, 0, 1, 0, 1, 0, 0, 0, 1}
+	iloc = binary.BigEndian.AppendUint32(iloc, 0)
+	iloc = binary.BigEndian.AppendUint32(iloc, uint32(len(exif)))
+	ilocBox := isoBoxBytes("iloc", iloc)
+
+	meta := isoBoxBytes("meta", append(append([]byte{0, 0, 0, 0}, iinf...), ilocBox...))
+	out := append(ftyp, meta...)
+	exifOffset := len(out) + 8
+	out = append(out, isoBoxBytes("mdat", exif)...)
+
+	// Patch the extent offset: the last 8 bytes of the iloc payload
+	ilocEnd := len(ftyp) + len(meta)
+	binary.BigEndian.PutUint32(out[ilocEnd-8:], uint32(exifOffset))
+	return out
+}
+
+func buildDOCX(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := [][2]string{
+		{"word/document.xml", `<w:document><w:body>Quarterly plan</w:body></w:document>`},
+		{"docProps/core.xml", `<cp:coreProperties><dc:creator>Maria Garc&#237;a</dc:creator>` +
+			`<cp:lastModifiedBy>Microsoft Office User</cp:lastModifiedBy></cp:coreProperties>`},
+		{"word/comments.xml", `<w:comments><w:comment w:id="0" w:author="Tom Baker" w:initials="TB"/></w:comments>`},
+	}
+	for _, part := range parts {
+		w, err := zw.Create(part[0])
+		if err != nil {
+			t.Fatalf("creating %s: %v", part[0], err)
+		}
+		w.Write([]byte(part[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func buildPDF() []byte {
+	body := "%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n" +
+		strings.Repeat("% filler\n", pdfWindow/9+10) +
+		"2 0 obj\n<< /Title (Report \\(draft\\)) /Author <FEFF004A00FC00720067 0065006E> /Creator (Microsoft Word) >>\nendobj\n" +
+		"3 0 obj\n<< /Author (Ana \\\nCosta) >>\nendobj\ntrailer\n<< /Info 2 0 R >>\n%%EOF\n"
+	return []byte(body)
+}
+
+func fieldValues(m *Metadata, kind Kind) []string {
+	var values []string
+	for _, f := range m.FieldsOf(kind) {
+		values = append(values, f.Value)
+	}
+	return values
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		format  Format
+		gps     []string
+		serials []string
+		authors []string
+		faces   []string
+	}{
+		{
+			name:    "tiff",
+			data:    sampleTIFF(),
+			format:  FormatTIFF,
+			gps:     []string{"37.774900, -122.419400"},
+			serials: []string{"SN-48213377"},
+			authors: []string{"Jane Doe"},
+		},
+		{
+			name:    "jpeg with exif, xmp and iptc",
+			data:    buildJPEG(),
+			format:  FormatJPEG,
+			gps:     []string{"37.774900, -122.419400", "48.856667, 2.350833"},
+			serials: []string{"SN-48213377"},
+			authors: []string{"Jane Doe", "Pierre Martin", "Carlos Ruiz"},
+			faces:   []string{"Anna Schmidt"},
+		},
+		{
+			name:    "png with compressed xmp",
+			data:    buildPNG(),
+			format:  FormatPNG,
+			gps:     []string{"48.856667, 2.350833"},
+			authors: []string{"Li Wei", "Pierre Martin"},
+			faces:   []string{"Anna Schmidt"},
+		},
+		{
+			name:    "heic exif item",
+			data:    buildHEIC(),
+			format:  FormatHEIC,
+			gps:     []string{"37.774900, -122.419400"},
+			serials: []string{"SN-48213377"},
+			authors: []string{"Jane Doe"},
+		},
+		{
+			name:    "docx properties and comments",
+			data:    buildDOCX(t),
+			format:  FormatOOXML,
+			authors: []string{"Maria García", "Tom Baker"},
+		},
+		{
+			name:    "pdf info dictionary",
+			data:    buildPDF(),
+			format:  FormatPDF,
+			authors: []string{"Jürgen", "Ana Costa"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Extract(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if m.Format != tt.format {
+				t.Errorf("expected format %s, got %s", tt.format, m.Format)
+			}
+			checks := []struct {
+				kind Kind
+				want []string
+			}{
+				{KindGPS, tt.gps}, {KindDeviceSerial, tt.serials}, {KindAuthor, tt.authors}, {KindFaceRegion, tt.faces},
+			}
+			for _, c := range checks {
+				got := fieldValues(m, c.kind)
+				if strings.Join(got, "|") != strings.Join(c.want, "|") {
+					t.Errorf("expected %s %v, got %v", c.kind, c.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_Errors(t *testing.T) {
+	if _, err := Extract(strings.NewReader("name,email\n"), 11); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+
+	// An Exif IFD pointer back at IFD0 must not loop
+	loop := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	loop = binary.LittleEndian.AppendUint16(loop, tagExifIFD)
+	loop = append(loop, 4, 0, 1, 0, 0, 0, 8, 0, 0, 0, 0, 0, 0, 0)
+	if _, err := Extract(bytes.NewReader(loop), int64(len(loop))); err == nil {
+		t.Error("expected an error for an IFD loop")
+	}
+
+	truncated := buildJPEG()[:40]
+	if _, err := Extract(bytes.NewReader(truncated), int64(len(truncated))); err == nil {
+		t.Error("expected an error for a truncated segment")
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for name, want := range map[string]bool{
+		"photos/IMG_0001.JPG": true, "scan.heic": true, "report.docx": true, "deck.pptx": true,
+		"contract.pdf": true, "data.csv": false, "legacy.doc": false, "anim.gif": false,
+	} {
+		if got := Supported(name); got != want {
+			t.Errorf("Supported(%q): expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestIsPersonalName(t *testing.T) {
+	for value, want := range map[string]bool{
+		"Jane Doe": true, "j.doe@example.com": true, "Administrator": false,
+		"Microsoft Office User": false, "12345": false, "https://example.com": false, "": false,
+	} {
+		if got := isPersonalName(value); got != want {
+			t.Errorf("isPersonalName(%q): expected %v, got %v", value, want, got)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package metadata
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// xmpProperties maps the XMP properties holding personal data to their kind
+var xmpProperties = []struct {
+	name string
+	kind Kind
+}{
+	{"dc:creator", KindAuthor},
+	{"pdf:Author", KindAuthor},
+	{"xmpRights:Owner", KindAuthor},
+	{"aux:SerialNumber", KindDeviceSerial},
+	{"aux:LensSerialNumber", KindDeviceSerial},
+	{"exifEX:BodySerialNumber", KindDeviceSerial},
+	{"exifEX:LensSerialNumber", KindDeviceSerial},
+	{"exifEX:CameraOwnerName", KindAuthor},
+	{"Iptc4xmpExt:PersonInImage", KindFaceRegion},
+	{"MPReg:PersonDisplayName", KindFaceRegion},
+}
+
+var (
+	xmpListItem   = regexp.MustCompile(`(?s)<rdf:li[^>]*>(.*?)</rdf:li>`)
+	xmpTag        = regexp.MustCompile(`<[^>]+>`)
+	xmpCoordinate = regexp.MustCompile(`^(\d+),(\d+(?:\.\d+)?)(?:,(\d+(?:\.\d+)?))?([NSEW])$`)
+)
+
+// parseXMP records the personal data in an XMP packet
+func parseXMP(packet string, m *Metadata) {
+	if !strings.Contains(packet, "xmpmeta") && !strings.Contains(packet, "rdf:RDF") {
+		return
+	}
+	for _, p := range xmpProperties {
+		for _, v := range xmpValues(packet, p.name) {
+			m.add(p.kind, "XMP:"+p.name, v)
+		}
+	}
+
+	lat := xmpValues(packet, "exif:GPSLatitude")
+	lon := xmpValues(packet, "exif:GPSLongitude")
+	if len(lat) > 0 && len(lon) > 0 {
+		latitude, okLat := parseXMPCoordinate(lat[0])
+		longitude, okLon := parseXMPCoordinate(lon[0])
+		if okLat && okLon {
+			m.addGPS("XMP:exif:GPSLatitude/GPSLongitude", latitude, longitude)
+		}
+	}
+
+	parseXMPFaceRegions(packet, m)
+}
+
+// xmpValues returns the values of property name, written either as an
+// attribute, as a simple element or as an element holding an rdf list
+func xmpValues(packet, name string) []string {
+	quoted := regexp.QuoteMeta(name)
+	var values []string
+	attr := regexp.MustCompile(`\s` + quoted + `\s*=\s*"([^"]*)"`)
+	for _, m := range attr.FindAllStringSubmatch(packet, -1) {
+		values = append(values, html.UnescapeString(m[1]))
+	}
+	elem := regexp.MustCompile(`(?s)<` + quoted + `(?:\s[^>]*)?>(.*?)</` + quoted + `>`)
+	for _, m := range elem.FindAllStringSubmatch(packet, -1) {
+		items := xmpListItem.FindAllStringSubmatch(m[1], -1)
+		if len(items) == 0 {
+			values = append(values, xmpText(m[1]))
+			continue
+		}
+		for _, item := range items {
+			values = append(values, xmpText(item[1]))
+		}
+	}
+	return values
+}
+
+// xmpText returns the text of an element's content without markup
+func xmpText(s string) string {
+	return strings.TrimSpace(html.UnescapeString(xmpTag.ReplaceAllString(s, "")))
+}
+
+// parseXMPFaceRegions records the names of MWG regions of type Face, the
+// way photo managers store people tagged in a picture
+func parseXMPFaceRegions(packet string, m *Metadata) {
+	start := strings.Index(packet, "mwg-rs:RegionList")
+	if start < 0 {
+		return
+	}
+	for _, item := range xmpListItem.FindAllString(packet[start:], -1) {
+		types := xmpValues(item, "mwg-rs:Type")
+		if len(types) == 0 || types[0] != "Face" {
+			continue
+		}
+		for _, name := range xmpValues(item, "mwg-rs:Name") {
+			m.add(KindFaceRegion, "XMP:mwg-rs:Name", name)
+		}
+	}
+}
+
+// parseXMPCoordinate parses XMP GPS coordinates, written "DDD,MM,SSk" or
+// "DDD,MM.mmk" with k one of N, S, E or W
+func parseXMPCoordinate(s string) (float64, bool) {
+	parts := xmpCoordinate.FindStringSubmatch(strings.TrimSpace(s))
+	if parts == nil {
+		return 0, false
+	}
+	degrees, _ := strconv.ParseFloat(parts[1], 64)
+	minutes, _ := strconv.ParseFloat(parts[2], 64)
+	var seconds float64
+	if parts[3] != "" {
+		seconds, _ = strconv.ParseFloat(parts[3], 64)
+	}
+	value := degrees + minutes/60 + seconds/3600
+	if parts[4] == "S" || parts[4] == "W" {
+		value = -value
+	}
+	return value, true
+}
@@ -0,0 +1,591 @@
+package mlclassifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Calibration methods
+const (
+	CalibrationAuto     = "auto"
+	CalibrationPlatt    = "platt"
+	CalibrationIsotonic = "isotonic"
+)
+
+const calibrationName = "confidence-calibration"
+
+// Calibration maps the raw combined confidence of a match onto the
+// probability that a reviewer confirms it. Rules with enough resolved review
+// items have their own calibrator; other rules use the global one.
+type Calibration struct {
+	ModelID uuid.UUID              `json:"-"`
+	Version string                 `json:"-"`
+	Rules   map[string]*Calibrator `json:"rules"`
+	Global  *Calibrator            `json:"global"`
+}
+
+// Calibrator is a monotone mapping from raw to calibrated confidence, either
+// a Platt sigmoid or an isotonic step function interpolated between the
+// points (X, Y)
+type Calibrator struct {
+	Method    string    `json:"method"`
+	A         float64   `json:"a,omitempty"`
+	B         float64   `json:"b,omitempty"`
+	X         []float64 `json:"x,omitempty"`
+	Y         []float64 `json:"y,omitempty"`
+	Samples   int       `json:"samples"`
+	Positives int       `json:"positives"`
+}
+
+// Calibrate returns the calibrated confidence for a match of ruleName. ok is
+// false when there is no calibrator for the rule and no global calibrator.
+func (c *Calibration) Calibrate(ruleName string, raw float64) (float64, bool) {
+	if cal, ok := c.Rules[ruleName]; ok {
+		return cal.Apply(raw), true
+	}
+	if c.Global != nil {
+		return c.Global.Apply(raw), true
+	}
+	return 0, false
+}
+
+// Apply maps a raw confidence onto a calibrated one
+func (c *Calibrator) Apply(raw float64) float64 {
+	if c.Method == CalibrationPlatt {
+		return sigmoid(c.A*raw + c.B)
+	}
+
+	n := len(c.X)
+	switch {
+	case n == 0:
+		return raw
+	case raw <= c.X[0]:
+		return c.Y[0]
+	case raw >= c.X[n-1]:
+		return c.Y[n-1]
+	}
+	i := sort.SearchFloat64s(c.X, raw)
+	if c.X[i] == raw {
+		return c.Y[i]
+	}
+	x0, x1, y0, y1 := c.X[i-1], c.X[i], c.Y[i-1], c.Y[i]
+	return y0 + (y1-y0)*(raw-x0)/(x1-x0)
+}
+
+// CalibrationConfig controls calibration fitting
+type CalibrationConfig struct {
+	// Method is platt, isotonic or auto. Auto uses isotonic regression for
+	// calibrators with at least IsotonicMinSamples items and Platt scaling
+	// otherwise, since isotonic regression overfits small samples.
+	Method             string
+	IsotonicMinSamples int
+	// A rule gets its own calibrator once it has MinSamples resolved items
+	// including both confirmations and rejections. The global calibrator
+	// needs the same.
+	MinSamples int
+	// Only the most recently resolved MaxSamples items are used
+	MaxSamples int
+}
+
+// DefaultCalibrationConfig returns default calibration settings
+func DefaultCalibrationConfig() CalibrationConfig {
+	return CalibrationConfig{
+		Method:             CalibrationAuto,
+		IsotonicMinSamples: 200,
+		MinSamples:         30,
+		MaxSamples:         10000,
+	}
+}
+
+// CalibrationRun summarizes one calibration fit. ModelID is nil when there
+// were too few resolved review items to fit the global calibrator.
+type CalibrationRun struct {
+	ModelID         *uuid.UUID `json:"model_id,omitempty"`
+	Version         string     `json:"version,omitempty"`
+	Samples         int        `json:"samples"`
+	Global          string     `json:"global_method,omitempty"`
+	RulesCalibrated []string   `json:"rules_calibrated"`
+	RulesSkipped    []string   `json:"rules_skipped,omitempty"`
+}
+
+type calibrationPoint struct {
+	raw       float64
+	confirmed bool
+}
+
+// confirmedResolution reports whether a resolved review item confirmed the
+// match. MODIFIED items changed the label but kept the data sensitive.
+func confirmedResolution(resolution string) bool {
+	return resolution == ResolutionConfirmed || resolution == ResolutionModified
+}
+
+// recordCalibrationSample keeps the outcome of a resolved review item that
+// confirmed or rejected a rule match, so calibration can still learn from it
+// after a rescan deletes the item with its classification
+func (s *Service) recordCalibrationSample(ctx context.Context, item *models.ClassificationReviewQueue) error {
+	switch item.Resolution {
+	case ResolutionConfirmed, ResolutionModified, ResolutionRejected:
+	default:
+		return nil
+	}
+	classification, err := s.store.GetClassification(ctx, item.ClassificationID)
+	if err != nil || classification == nil || item.ResolvedAt == nil {
+		return nil
+	}
+	itemID := item.ID
+	return s.store.CreateCalibrationSample(ctx, &models.CalibrationSample{
+		ID:              uuid.New(),
+		ReviewItemID:    &itemID,
+		RuleName:        classification.RuleName,
+		RawConfidence:   item.OriginalConfidence,
+		Resolution:      item.Resolution,
+		FinalLabel:      item.FinalLabel,
+		FinalConfidence: item.FinalConfidence,
+		ResolvedAt:      *item.ResolvedAt,
+	})
+}
+
+// FitCalibration fits per-rule and global calibrators on resolved review
+// outcomes, which record the raw confidence each match was queued with. The fit
+// is registered as a new calibration model version and activated directly,
+// retiring the previous version so it can be rolled back to. Calibration is
+// monotone, so it moves thresholds without reordering matches.
+func (s *Service) FitCalibration(ctx context.Context, config CalibrationConfig) (*CalibrationRun, error) {
+	switch config.Method {
+	case CalibrationAuto, CalibrationPlatt, CalibrationIsotonic:
+	default:
+		return nil, fmt.Errorf("unknown calibration method %q", config.Method)
+	}
+
+	samples, err := s.store.ListCalibrationSamples(ctx, config.MaxSamples)
+	if err != nil {
+		return nil, fmt.Errorf("listing resolved review items: %w", err)
+	}
+
+	run := &CalibrationRun{Samples: len(samples), RulesCalibrated: []string{}}
+	byRule := make(map[string][]calibrationPoint)
+	all := make([]calibrationPoint, 0, len(samples))
+	for _, sample := range samples {
+		p := calibrationPoint{raw: sample.RawConfidence, confirmed: confirmedResolution(sample.Resolution)}
+		byRule[sample.RuleName] = append(byRule[sample.RuleName], p)
+		all = append(all, p)
+	}
+
+	if !calibratable(all, config.MinSamples) {
+		return run, nil
+	}
+	calibration := &Calibration{
+		Rules:  make(map[string]*Calibrator),
+		Global: fitCalibrator(all, config),
+	}
+	run.Global = calibration.Global.Method
+	for rule, points := range byRule {
+		if !calibratable(points, config.MinSamples) {
+			run.RulesSkipped = append(run.RulesSkipped, rule)
+			continue
+		}
+		calibration.Rules[rule] = fitCalibrator(points, config)
+		run.RulesCalibrated = append(run.RulesCalibrated, rule)
+	}
+	sort.Strings(run.RulesCalibrated)
+	sort.Strings(run.RulesSkipped)
+
+	model, err := s.registerCalibration(ctx, calibration, len(all))
+	if err != nil {
+		return nil, err
+	}
+	run.ModelID = &model.ID
+	run.Version = model.Version
+
+	s.loadCalibration(ctx)
+	return run, nil
+}
+
+// calibratable reports whether points are enough to fit a calibrator: at
+// least minSamples of them, with both outcomes present
+func calibratable(points []calibrationPoint, minSamples int) bool {
+	if len(points) == 0 || len(points) < minSamples {
+		return false
+	}
+	positives := 0
+	for _, p := range points {
+		if p.confirmed {
+			positives++
+		}
+	}
+	return positives > 0 && positives < len(points)
+}
+
+func fitCalibrator(points []calibrationPoint, config CalibrationConfig) *Calibrator {
+	method := config.Method
+	if method == CalibrationAuto {
+		method = CalibrationPlatt
+		if len(points) >= config.IsotonicMinSamples {
+			method = CalibrationIsotonic
+		}
+	}
+
+	var cal *Calibrator
+	if method == CalibrationIsotonic {
+		cal = fitIsotonic(points)
+	} else {
+		cal = fitPlatt(points)
+	}
+	cal.Samples = len(points)
+	for _, p := range points {
+		if p.confirmed {
+			cal.Positives++
+		}
+	}
+	return cal
+}
+
+// fitPlatt fits p = sigmoid(A*raw + B) by Newton's method with a backtracking
+// line search, using Platt's smoothed targets so the fit stays finite when the
+// outcomes are separable (Lin, Lin and Weng, 2007)
+func fitPlatt(points []calibrationPoint) *Calibrator {
+	var positives, negatives float64
+	for _, p := range points {
+		if p.confirmed {
+			positives++
+		} else {
+			negatives++
+		}
+	}
+	hi := (positives + 1) / (positives + 2)
+	lo := 1 / (negatives + 2)
+	targets := make([]float64, len(points))
+	for i, p := range points {
+		targets[i] = lo
+		if p.confirmed {
+			targets[i] = hi
+		}
+	}
+
+	loss := func(a, b float64) float64 {
+		var l float64
+		for i, p := range points {
+			z := a*p.raw + b
+			l += log1pExp(z) - targets[i]*z
+		}
+		return l
+	}
+
+	const (
+		maxIterations = 100
+		minStep       = 1e-10
+		sigma         = 1e-12 // Keeps the Hessian positive definite
+		epsilon       = 1e-5
+	)
+	a, b := 0.0, math.Log((positives+1)/(negatives+1))
+	current := loss(a, b)
+	for iter := 0; iter < maxIterations; iter++ {
+		var ga, gb float64
+		haa, hab, hbb := sigma, 0.0, sigma
+		for i, p := range points {
+			q := sigmoid(a*p.raw + b)
+			d := q - targets[i]
+			w := q * (1 - q)
+			ga += d * p.raw
+			gb += d
+			haa += w * p.raw * p.raw
+			hab += w * p.raw
+			hbb += w
+		}
+		if math.Abs(ga) < epsilon && math.Abs(gb) < epsilon {
+			break
+		}
+
+		det := haa*hbb - hab*hab
+		da := -(hbb*ga - hab*gb) / det
+		db := -(haa*gb - hab*ga) / det
+		descent := ga*da + gb*db
+
+		step := 1.0
+		for step >= minStep {
+			na, nb := a+step*da, b+step*db
+			if next := loss(na, nb); next < current+1e-4*step*descent {
+				a, b, current = na, nb, next
+				break
+			}
+			step /= 2
+		}
+		if step < minStep {
+			break
+		}
+	}
+	return &Calibrator{Method: CalibrationPlatt, A: a, B: b}
+}
+
+// log1pExp computes log(1 + e^z) without overflow
+func log1pExp(z float64) float64 {
+	if z > 0 {
+		return z + math.Log1p(math.Exp(-z))
+	}
+	return math.Log1p(math.Exp(z))
+}
+
+// fitIsotonic fits a non-decreasing step function with the pool adjacent
+// violators algorithm. Each pooled block contributes its lowest and highest
+// raw confidence as points, and Apply interpolates between blocks.
+func fitIsotonic(points []calibrationPoint) *Calibrator {
+	sorted := append([]calibrationPoint(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].raw < sorted[j].raw })
+
+	type block struct {
+		minX, maxX float64
+		sum, n     float64
+	}
+	var blocks []block
+	for _, p := range sorted {
+		y := 0.0
+		if p.confirmed {
+			y = 1
+		}
+		// Equal raw confidences start in the same block so each x has one value
+		if k := len(blocks) - 1; k >= 0 && blocks[k].maxX == p.raw {
+			blocks[k].sum += y
+			blocks[k].n++
+		} else {
+			blocks = append(blocks, block{minX: p.raw, maxX: p.raw, sum: y, n: 1})
+		}
+		for k := len(blocks) - 1; k > 0 && blocks[k-1].sum/blocks[k-1].n > blocks[k].sum/blocks[k].n; k-- {
+			blocks[k-1].maxX = blocks[k].maxX
+			blocks[k-1].sum += blocks[k].sum
+			blocks[k-1].n += blocks[k].n
+			blocks = blocks[:k]
+		}
+	}
+
+	cal := &Calibrator{Method: CalibrationIsotonic}
+	for _, b := range blocks {
+		mean := b.sum / b.n
+		cal.X = append(cal.X, b.minX)
+		cal.Y = append(cal.Y, mean)
+		if b.maxX > b.minX {
+			cal.X = append(cal.X, b.maxX)
+			cal.Y = append(cal.Y, mean)
+		}
+	}
+	return cal
+}
+
+// registerCalibration stores the calibration as the active calibration model
+// and retires the one it replaces
+func (s *Service) registerCalibration(ctx context.Context, calibration *Calibration, samples int) (*models.MLModel, error) {
+	existing, err := s.store.ListMLModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing models: %w", err)
+	}
+	versions := 0
+	for _, m := range existing {
+		if m.ModelType == models.MLModelCalibrator {
+			versions++
+		}
+	}
+	previous, err := s.store.GetDefaultMLModel(ctx, models.MLModelCalibrator)
+	if err != nil {
+		return nil, fmt.Errorf("getting active calibration: %w", err)
+	}
+
+	var config models.JSONB
+	data, err := json.Marshal(calibration)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	model := &models.MLModel{
+		ID:               uuid.New(),
+		Name:             calibrationName,
+		ModelType:        models.MLModelCalibrator,
+		Version:          fmt.Sprintf("1.0.%d", versions),
+		Description:      fmt.Sprintf("Confidence calibration for %d rules fitted on resolved review items", len(calibration.Rules)),
+		Framework:        "builtin",
+		Config:           config,
+		Status:           models.MLModelStatusCandidate,
+		TrainedOnSamples: samples,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := s.store.CreateMLModel(ctx, model); err != nil {
+		return nil, fmt.Errorf("registering calibration: %w", err)
+	}
+
+	model.Status = models.MLModelStatusActive
+	model.IsDefault = true
+	model.PromotedAt = &now
+	if previous != nil {
+		previous.Status = models.MLModelStatusRetired
+		previous.IsDefault = false
+		previous.RetiredAt = &now
+	}
+	if err := s.store.ReplaceActiveMLModel(ctx, model, previous); err != nil {
+		return nil, fmt.Errorf("activating calibration %s: %w", model.Version, err)
+	}
+	return model, nil
+}
+
+// CalibrationFromModel decodes the calibrators stored in a registered model
+func CalibrationFromModel(model *models.MLModel) (*Calibration, error) {
+	data, err := json.Marshal(model.Config)
+	if err != nil {
+		return nil, err
+	}
+	calibration := &Calibration{}
+	if err := json.Unmarshal(data, calibration); err != nil {
+		return nil, fmt.Errorf("decoding calibration %s: %w", model.Version, err)
+	}
+	calibration.ModelID, calibration.Version = model.ID, model.Version
+	return calibration, nil
+}
+
+// Calibration returns the active calibration, or nil if none has been fitted
+func (s *Service) Calibration() *Calibration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calibration
+}
+
+// loadCalibration installs the active calibration. Failures keep the current
+// one; scoring must not depend on the store being reachable.
+func (s *Service) loadCalibration(ctx context.Context) {
+	model, err := s.store.GetDefaultMLModel(ctx, models.MLModelCalibrator)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case model == nil:
+		s.calibration = nil
+	case s.calibration == nil || s.calibration.ModelID != model.ID:
+		if calibration, err := CalibrationFromModel(model); err == nil {
+			s.calibration = calibration
+		}
+	}
+}
+
+// ReliabilityBin is one confidence bin of a reliability diagram
+type ReliabilityBin struct {
+	Lower          float64 `json:"lower"`
+	Upper          float64 `json:"upper"`
+	Count          int     `json:"count"`
+	MeanConfidence float64 `json:"mean_confidence"`
+	ObservedRate   float64 `json:"observed_rate"`
+}
+
+// ReliabilityCurve compares predicted confidence with the observed rate of
+// confirmation in equal-width bins. ECE is the expected calibration error,
+// the count-weighted mean gap between the two; Brier is the mean squared
+// error of the confidences.
+type ReliabilityCurve struct {
+	Bins  []ReliabilityBin `json:"bins"`
+	ECE   float64          `json:"ece"`
+	Brier float64          `json:"brier"`
+}
+
+// ReliabilityDiagram reports how well raw and calibrated confidence match
+// reviewer outcomes
+type ReliabilityDiagram struct {
+	Rule               string            `json:"rule,omitempty"`
+	Samples            int               `json:"samples"`
+	Positives          int               `json:"positives"`
+	CalibrationModelID *uuid.UUID        `json:"calibration_model_id,omitempty"`
+	CalibrationVersion string            `json:"calibration_version,omitempty"`
+	Raw                ReliabilityCurve  `json:"raw"`
+	Calibrated         *ReliabilityCurve `json:"calibrated,omitempty"`
+}
+
+// ReliabilityDiagram bins resolved review items for ruleName, or all rules
+// when ruleName is empty, by raw confidence and by the confidence the active
+// calibration gives them. Items the calibration was fitted on are included,
+// so the calibrated curve is optimistic until new reviews come in.
+func (s *Service) ReliabilityDiagram(ctx context.Context, ruleName string, bins int) (*ReliabilityDiagram, error) {
+	if bins <= 0 {
+		bins = 10
+	}
+	samples, err := s.store.ListCalibrationSamples(ctx, DefaultCalibrationConfig().MaxSamples)
+	if err != nil {
+		return nil, fmt.Errorf("listing resolved review items: %w", err)
+	}
+
+	calibration := s.Calibration()
+	diagram := &ReliabilityDiagram{Rule: ruleName}
+	var raw, calibrated []calibrationPoint
+	for _, sample := range samples {
+		if ruleName != "" && sample.RuleName != ruleName {
+			continue
+		}
+		confirmed := confirmedResolution(sample.Resolution)
+		diagram.Samples++
+		if confirmed {
+			diagram.Positives++
+		}
+		raw = append(raw, calibrationPoint{raw: sample.RawConfidence, confirmed: confirmed})
+		if calibration != nil {
+			if p, ok := calibration.Calibrate(sample.RuleName, sample.RawConfidence); ok {
+				calibrated = append(calibrated, calibrationPoint{raw: p, confirmed: confirmed})
+			}
+		}
+	}
+
+	diagram.Raw = reliabilityCurve(raw, bins)
+	if calibration != nil {
+		diagram.CalibrationModelID = &calibration.ModelID
+		diagram.CalibrationVersion = calibration.Version
+		curve := reliabilityCurve(calibrated, bins)
+		diagram.Calibrated = &curve
+	}
+	return diagram, nil
+}
+
+func reliabilityCurve(points []calibrationPoint, bins int) ReliabilityCurve {
+	curve := ReliabilityCurve{Bins: make([]ReliabilityBin, bins)}
+	sums := make([]float64, bins)
+	confirmed := make([]int, bins)
+	for i := range curve.Bins {
+		curve.Bins[i].Lower = float64(i) / float64(bins)
+		curve.Bins[i].Upper = float64(i+1) / float64(bins)
+	}
+
+	for _, p := range points {
+		i := int(p.raw * float64(bins))
+		i = max(0, min(i, bins-1))
+		curve.Bins[i].Count++
+		sums[i] += p.raw
+		y := 0.0
+		if p.confirmed {
+			confirmed[i]++
+			y = 1
+		}
+		curve.Brier += (p.raw - y) * (p.raw - y)
+	}
+	if len(points) == 0 {
+		return curve
+	}
+
+	n := float64(len(points))
+	curve.Brier /= n
+	for i := range curve.Bins {
+		bin := &curve.Bins[i]
+		if bin.Count == 0 {
+			continue
+		}
+		bin.MeanConfidence = sums[i] / float64(bin.Count)
+		bin.ObservedRate = float64(confirmed[i]) / float64(bin.Count)
+		curve.ECE += float64(bin.Count) / n * math.Abs(bin.MeanConfidence-bin.ObservedRate)
+	}
+	return curve
+}
@@ -0,0 +1,265 @@
+package mlclassifier
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// addResolvedReviews queues review items for rule at raw confidence and
+// resolves them, confirmed of them confirmed by the reviewer and rejected
+// rejected
+func addResolvedReviews(t *testing.T, svc *Service, store *memStore, rule string, raw float64, confirmed, rejected int) {
+	t.Helper()
+	for i := 0; i < confirmed+rejected; i++ {
+		classification := &models.Classification{ID: uuid.New(), RuleName: rule}
+		store.classifications[classification.ID] = classification
+		resolution := ResolutionRejected
+		if i < confirmed {
+			resolution = ResolutionConfirmed
+		}
+		item := &models.ClassificationReviewQueue{
+			ID:                 uuid.New(),
+			ClassificationID:   classification.ID,
+			OriginalConfidence: raw,
+			Status:             models.ReviewQueueStatusPending,
+		}
+		store.reviewQueue = append(store.reviewQueue, item)
+		if _, err := svc.ResolveReviewItem(context.Background(), &ReviewResolution{ItemID: item.ID, Resolution: resolution}); err != nil {
+			t.Fatalf("ResolveReviewItem: %v", err)
+		}
+	}
+}
+
+func TestFitIsotonic(t *testing.T) {
+	points := []calibrationPoint{
+		{0.3, false}, {0.1, false}, {0.2, true}, {0.5, true}, {0.4, true},
+	}
+	cal := fitIsotonic(points)
+
+	// 0.2 and 0.3 violate the ordering and are pooled
+	wantX := []float64{0.1, 0.2, 0.3, 0.4, 0.5}
+	wantY := []float64{0, 0.5, 0.5, 1, 1}
+	if len(cal.X) != len(wantX) {
+		t.Fatalf("expected breakpoints %v, got %v", wantX, cal.X)
+	}
+	for i := range wantX {
+		if cal.X[i] != wantX[i] || cal.Y[i] != wantY[i] {
+			t.Errorf("expected point (%v, %v), got (%v, %v)", wantX[i], wantY[i], cal.X[i], cal.Y[i])
+		}
+	}
+
+	tests := []struct {
+		raw  float64
+		want float64
+	}{
+		{0.0, 0},
+		{0.15, 0.25},
+		{0.25, 0.5},
+		{0.35, 0.75},
+		{0.9, 1},
+	}
+	for _, tt := range tests {
+		if got := cal.Apply(tt.raw); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Apply(%v): expected %v, got %v", tt.raw, tt.want, got)
+		}
+	}
+}
+
+func TestFitPlatt(t *testing.T) {
+	var points []calibrationPoint
+	for i := 0; i < 100; i++ {
+		points = append(points, calibrationPoint{0.9, i < 50}, calibrationPoint{0.6, i < 10})
+	}
+	cal := fitPlatt(points)
+
+	if cal.A <= 0 {
+		t.Errorf("expected an increasing sigmoid, got A=%v", cal.A)
+	}
+	for _, tt := range []struct{ raw, want float64 }{{0.9, 0.5}, {0.6, 0.1}} {
+		if got := cal.Apply(tt.raw); math.Abs(got-tt.want) > 0.02 {
+			t.Errorf("Apply(%v): expected about %v, got %v", tt.raw, tt.want, got)
+		}
+	}
+
+	// Separable outcomes still give a finite fit
+	separable := []calibrationPoint{{0.2, false}, {0.3, false}, {0.7, true}, {0.8, true}}
+	cal = fitPlatt(separable)
+	if math.IsNaN(cal.A) || math.IsInf(cal.A, 0) || cal.Apply(0.8) >= 1 {
+		t.Errorf("expected a finite fit on separable outcomes, got %+v", cal)
+	}
+}
+
+func TestService_FitCalibration(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+
+	run, err := svc.FitCalibration(ctx, DefaultCalibrationConfig())
+	if err != nil {
+		t.Fatalf("FitCalibration: %v", err)
+	}
+	if run.ModelID != nil || svc.Calibration() != nil {
+		t.Fatalf("expected no calibration without resolved reviews, got %+v", run)
+	}
+
+	// SSN matches are confirmed far less often than their raw confidence says
+	addResolvedReviews(t, svc, store, "SSN", 0.9, 20, 20)
+	addResolvedReviews(t, svc, store, "SSN", 0.6, 4, 36)
+	addResolvedReviews(t, svc, store, "EMAIL", 0.9, 4, 1)
+
+	run, err = svc.FitCalibration(ctx, DefaultCalibrationConfig())
+	if err != nil {
+		t.Fatalf("FitCalibration: %v", err)
+	}
+	if run.ModelID == nil || run.Samples != 85 || run.Global != CalibrationPlatt {
+		t.Fatalf("expected a Platt calibration from 85 samples, got %+v", run)
+	}
+	if len(run.RulesCalibrated) != 1 || run.RulesCalibrated[0] != "SSN" || len(run.RulesSkipped) != 1 || run.RulesSkipped[0] != "EMAIL" {
+		t.Errorf("expected SSN calibrated and EMAIL skipped, got %+v", run)
+	}
+	first := *run.ModelID
+	if model := store.models[first]; model.Status != models.MLModelStatusActive || !model.IsDefault || model.PromotedAt == nil {
+		t.Errorf("expected the calibration to be active, got %+v", model)
+	}
+
+	calibration := svc.Calibration()
+	if calibration == nil || calibration.ModelID != first {
+		t.Fatalf("expected the service to use the new calibration, got %+v", calibration)
+	}
+	if p, ok := calibration.Calibrate("SSN", 0.9); !ok || math.Abs(p-0.5) > 0.05 {
+		t.Errorf("expected SSN at 0.9 to calibrate to about 0.5, got %v", p)
+	}
+	if _, ok := calibration.Calibrate("EMAIL", 0.9); !ok {
+		t.Error("expected EMAIL to fall back to the global calibrator")
+	}
+
+	// Thresholds apply to calibrated confidence, the queue keeps the raw one
+	result, err := svc.EnhanceClassification(ctx, "employee ssn 123-45-6789",
+		[]EnhancedMatch{{RuleName: "SSN", Category: models.CategoryPII, Value: "123-45-6789", Count: 1, RegexConfidence: 0.95}})
+	if err != nil {
+		t.Fatalf("EnhanceClassification: %v", err)
+	}
+	match := result.Matches[0]
+	want, _ := calibration.Calibrate("SSN", match.CombinedConfidence)
+	if match.CalibratedConfidence == nil || *match.CalibratedConfidence != want || match.DecisionConfidence() != want {
+		t.Fatalf("expected calibrated confidence %v, got %+v", want, match)
+	}
+	if err := svc.RecordScanPredictions(ctx, result, []uuid.UUID{uuid.New()}); err != nil {
+		t.Fatalf("RecordScanPredictions: %v", err)
+	}
+	for _, prediction := range store.predictions {
+		if prediction.ConfidenceScore != match.CombinedConfidence || prediction.CalibratedConfidence == nil || *prediction.CalibratedConfidence != want {
+			t.Errorf("expected raw %v and calibrated %v to be stored, got %+v", match.CombinedConfidence, want, prediction)
+		}
+	}
+	if queued := store.reviewQueue[len(store.reviewQueue)-1]; queued.Status != models.ReviewQueueStatusPending || queued.OriginalConfidence != match.CombinedConfidence {
+		t.Errorf("expected the match to be queued with its raw confidence, got %+v", queued)
+	}
+
+	// Refitting retires the previous version, which rollback restores
+	addResolvedReviews(t, svc, store, "SSN", 0.9, 10, 10)
+	run, err = svc.FitCalibration(ctx, DefaultCalibrationConfig())
+	if err != nil {
+		t.Fatalf("FitCalibration: %v", err)
+	}
+	if run.Version != "1.0.1" || store.models[first].Status != models.MLModelStatusRetired {
+		t.Errorf("expected version 1.0.1 to replace the first fit, got %+v", run)
+	}
+	if _, err := svc.RollbackModel(ctx, models.MLModelCalibrator); err != nil {
+		t.Fatalf("RollbackModel: %v", err)
+	}
+	if calibration := svc.Calibration(); calibration == nil || calibration.ModelID != first {
+		t.Errorf("expected rollback to restore the first calibration, got %+v", calibration)
+	}
+
+	if _, err := svc.FitCalibration(ctx, CalibrationConfig{Method: "spline"}); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
+
+func TestService_FitCalibration_AfterRescan(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+	addResolvedReviews(t, svc, store, "SSN", 0.9, 20, 20)
+	addResolvedReviews(t, svc, store, "SSN", 0.6, 4, 36)
+
+	// A rescan deletes the classifications and, with them, their review items
+	store.classifications = make(map[uuid.UUID]*models.Classification)
+	store.reviewQueue = nil
+
+	run, err := svc.FitCalibration(ctx, DefaultCalibrationConfig())
+	if err != nil {
+		t.Fatalf("FitCalibration: %v", err)
+	}
+	if run.ModelID == nil || run.Samples != 80 {
+		t.Fatalf("expected a calibration from 80 samples, got %+v", run)
+	}
+}
+
+func TestService_ReliabilityDiagram(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+	addResolvedReviews(t, svc, store, "SSN", 0.9, 20, 20)
+	addResolvedReviews(t, svc, store, "SSN", 0.6, 4, 36)
+	addResolvedReviews(t, svc, store, "EMAIL", 0.9, 9, 1)
+
+	diagram, err := svc.ReliabilityDiagram(ctx, "SSN", 10)
+	if err != nil {
+		t.Fatalf("ReliabilityDiagram: %v", err)
+	}
+	if diagram.Samples != 80 || diagram.Positives != 24 || diagram.Calibrated != nil {
+		t.Fatalf("unexpected uncalibrated diagram %+v", diagram)
+	}
+	if len(diagram.Raw.Bins) != 10 {
+		t.Fatalf("expected 10 bins, got %d", len(diagram.Raw.Bins))
+	}
+	if bin := diagram.Raw.Bins[9]; bin.Count != 40 || bin.ObservedRate != 0.5 || math.Abs(bin.MeanConfidence-0.9) > 1e-9 {
+		t.Errorf("unexpected top bin %+v", bin)
+	}
+	// (40*0.4 + 40*0.5) / 80
+	if math.Abs(diagram.Raw.ECE-0.45) > 1e-9 {
+		t.Errorf("expected raw ECE 0.45, got %v", diagram.Raw.ECE)
+	}
+
+	if _, err := svc.FitCalibration(ctx, DefaultCalibrationConfig()); err != nil {
+		t.Fatalf("FitCalibration: %v", err)
+	}
+	diagram, err = svc.ReliabilityDiagram(ctx, "SSN", 10)
+	if err != nil {
+		t.Fatalf("ReliabilityDiagram: %v", err)
+	}
+	if diagram.Calibrated == nil || diagram.CalibrationModelID == nil {
+		t.Fatalf("expected a calibrated curve, got %+v", diagram)
+	}
+	if diagram.Calibrated.ECE > 0.05 || diagram.Calibrated.Brier >= diagram.Raw.Brier {
+		t.Errorf("expected calibration to reduce error, raw %+v calibrated %+v", diagram.Raw, diagram.Calibrated)
+	}
+
+	all, err := svc.ReliabilityDiagram(ctx, "", 5)
+	if err != nil {
+		t.Fatalf("ReliabilityDiagram: %v", err)
+	}
+	if all.Samples != 90 || len(all.Raw.Bins) != 5 {
+		t.Errorf("expected all 90 samples in 5 bins, got %d in %d", all.Samples, len(all.Raw.Bins))
+	}
+}
+
+func TestReviewDecision_UsesCalibratedConfidence(t *testing.T) {
+	svc := NewService(nil)
+	calibrated := 0.4
+	match := EnhancedMatch{RuleName: "SSN", Sensitivity: models.SensitivityHigh, CombinedConfidence: 0.9}
+
+	if status, _ := svc.reviewDecision(match, false); status != models.ReviewStatusApproved {
+		t.Errorf("expected raw 0.9 to be approved, got %s", status)
+	}
+	match.CalibratedConfidence = &calibrated
+	if status, reason := svc.reviewDecision(match, false); status != models.ReviewStatusPending || reason != "LOW_CONFIDENCE" {
+		t.Errorf("expected calibrated 0.4 to be queued, got %s %s", status, reason)
+	}
+}
@@ -3,6 +3,9 @@ package mlclassifier
 import (
 	"math"
 	"strings"
+	"sync/atomic"
+
+	"github.com/qualys/dspm/internal/models"
 )
 
 // ConfidenceScorer calculates refined confidence scores
@@ -11,6 +14,10 @@ type ConfidenceScorer struct {
 	patternWeight   float64
 	frequencyWeight float64
 	nerWeight       float64
+
+	// Learned false-positive filter, blended in for rules it covers
+	feedbackWeight float64
+	feedback       atomic.Pointer[FeedbackFilter]
 }
 
 // NewConfidenceScorer creates a new confidence scorer with default weights
@@ -20,11 +27,29 @@ func NewConfidenceScorer() *ConfidenceScorer {
 		patternWeight:   0.35,
 		frequencyWeight: 0.15,
 		nerWeight:       0.25,
+		feedbackWeight:  0.35,
 	}
 }
 
+// SetFeedbackFilter installs filters trained from reviewer feedback. It is
+// safe to call while other goroutines are scoring.
+func (cs *ConfidenceScorer) SetFeedbackFilter(filter *FeedbackFilter) {
+	cs.feedback.Store(filter)
+}
+
+// FeedbackFilter returns the installed feedback filter, if any
+func (cs *ConfidenceScorer) FeedbackFilter() *FeedbackFilter {
+	return cs.feedback.Load()
+}
+
 // CalculateConfidence computes a weighted confidence score
 func (cs *ConfidenceScorer) CalculateConfidence(params ConfidenceParams) float64 {
+	return cs.calculateWithFilter(params, cs.feedback.Load())
+}
+
+// calculateWithFilter scores params using filter in place of the installed
+// feedback filter, so shadow filters can be compared against it
+func (cs *ConfidenceScorer) calculateWithFilter(params ConfidenceParams, filter *FeedbackFilter) float64 {
 	// Pattern match quality (Luhn check passed, format valid, etc.)
 	patternScore := cs.calculatePatternScore(params)
 
@@ -42,9 +67,23 @@ func (cs *ConfidenceScorer) CalculateConfidence(params ConfidenceParams) float64
 		frequencyScore*cs.frequencyWeight +
 		nerScore*cs.nerWeight
 
+	// Reviewer feedback for this rule, when a filter has been trained
+	if score, ok := cs.calculateFeedbackScore(params, filter); ok {
+		combined = combined*(1-cs.feedbackWeight) + score*cs.feedbackWeight
+	}
+
 	return math.Min(combined, 1.0)
 }
 
+// calculateFeedbackScore scores how likely the match is a true positive
+// according to the filter learned from reviewer feedback
+func (cs *ConfidenceScorer) calculateFeedbackScore(params ConfidenceParams, filter *FeedbackFilter) (float64, bool) {
+	if filter == nil || params.Match == nil {
+		return 0, false
+	}
+	return filter.Score(params.Match.RuleName, params.DocumentType, params.Context)
+}
+
 // calculatePatternScore scores based on pattern match quality
 func (cs *ConfidenceScorer) calculatePatternScore(params ConfidenceParams) float64 {
 	score := 0.5 // Base score for regex match
@@ -171,6 +210,15 @@ func getContextKeywords(category string) []string {
 			"key", "secret", "token", "password", "credential",
 			"api", "auth", "access", "private", "connection",
 		}
+	case "HEALTH", "RELIGION", "ETHNICITY", "SEXUAL_ORIENTATION", "BIOMETRIC", "TRADE_UNION":
+		// Special categories only count when about a person, in any of the
+		// lexicon languages
+		return []string{
+			"name", "patient", "employee", "member", "customer", "applicant",
+			"vorname", "nachname", "mitarbeiter", "mitglied", "patientin",
+			"nom", "prénom", "employé", "salarié", "membre",
+			"nombre", "apellido", "paciente", "empleado", "miembro",
+		}
 	default:
 		return []string{}
 	}
@@ -196,6 +244,15 @@ func AdjustForDocumentType(confidence float64, docType, category string) float64
 		return math.Min(confidence*1.15, 1.0)
 	}
 
+	// Medical records reveal health data, and personal documents any
+	// special category, about the person they describe
+	if docType == "MEDICAL_RECORD" && category == string(models.CategoryHealth) {
+		return math.Min(confidence*1.15, 1.0)
+	}
+	if docType == "PII_DOCUMENT" && models.Category(category).IsSpecial() {
+		return math.Min(confidence*1.1, 1.0)
+	}
+
 	// Financial documents should have higher confidence for PCI
 	if docType == "FINANCIAL_STATEMENT" && category == "PCI" {
 		return math.Min(confidence*1.15, 1.0)
@@ -1,6 +1,7 @@
 package mlclassifier
 
 import (
+	"math"
 	"testing"
 
 	"github.com/qualys/dspm/internal/models"
@@ -548,3 +549,31 @@ func BenchmarkCombineConfidenceScores(b *testing.B) {
 		_ = CombineConfidenceScores(0.85, 0.75, 0.4)
 	}
 }
+
+func TestAdjustForSpecialCategory(t *testing.T) {
+	person := []Entity{{Text: "jane@example.com", Type: "EMAIL", StartOffset: 10, EndOffset: 26}}
+
+	tests := []struct {
+		name     string
+		category models.Category
+		offset   int
+		entities []Entity
+		nerRan   bool
+		expected float64
+	}{
+		{"identifier nearby", models.CategoryHealth, 40, person, true, 0.69},
+		{"identifier too far", models.CategoryHealth, 200, person, true, 0.42},
+		{"no identifier", models.CategoryReligion, 40, nil, true, 0.42},
+		{"ner not run", models.CategoryReligion, 40, nil, false, 0.6},
+		{"not a special category", models.CategoryPII, 200, person, true, 0.6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AdjustForSpecialCategory(0.6, tt.category, tt.offset, 50, tt.entities, tt.nerRan)
+			if math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
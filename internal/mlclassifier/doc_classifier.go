@@ -38,9 +38,11 @@ type documentPattern struct {
 
 // DocumentClassifierConfig contains configuration for the document classifier
 type DocumentClassifierConfig struct {
-	ModelPath    string
-	VocabPath    string
-	MaxSeqLength int
+	ModelPath     string
+	VocabPath     string
+	// TokenizerPath is the model's HuggingFace tokenizer.json
+	TokenizerPath string
+	MaxSeqLength  int
 }
 
 // NewONNXDocumentClassifier creates a new document classifier
@@ -62,8 +64,9 @@ func NewONNXDocumentClassifier(config DocumentClassifierConfig, runtime *ONNXRun
 
 	// Initialize tokenizer
 	tokConfig := TokenizerConfig{
-		VocabFile: config.VocabPath,
-		MaxLength: config.MaxSeqLength,
+		VocabFile:     config.VocabPath,
+		TokenizerFile: config.TokenizerPath,
+		MaxLength:     config.MaxSeqLength,
 	}
 	if tokConfig.MaxLength == 0 {
 		tokConfig.MaxLength = 512
@@ -169,7 +172,7 @@ func (dc *ONNXDocumentClassifier) Classify(ctx context.Context, text string) (*D
 	ruleResult := dc.classifyWithRules(text)
 
 	// If ONNX model is loaded, combine with ML classification
-	if dc.modelLoaded && dc.runtime != nil && dc.runtime.IsAvailable() {
+	if dc.modelLoaded && dc.runtime != nil && dc.runtime.IsAvailable() && dc.tokenizer != nil {
 		mlResult, err := dc.classifyWithONNX(ctx, text)
 		if err != nil {
 			dc.logger.Warn("ONNX classification failed, using rule-based result", "error", err)
@@ -240,24 +243,10 @@ func (dc *ONNXDocumentClassifier) classifyWithRules(text string) *DocumentClassi
 // classifyWithONNX performs ONNX model-based classification
 func (dc *ONNXDocumentClassifier) classifyWithONNX(ctx context.Context, text string) (*DocumentClassification, error) {
 	// Tokenize
-	inputIDs, attentionMask := dc.tokenizer.Encode(text)
-
-	// Prepare inputs
-	inputs := []InferenceInput{
-		{
-			Name:  "input_ids",
-			Data:  Int32ToFloat32(inputIDs),
-			Shape: []int64{1, int64(len(inputIDs))},
-		},
-		{
-			Name:  "attention_mask",
-			Data:  Int32ToFloat32(attentionMask),
-			Shape: []int64{1, int64(len(attentionMask))},
-		},
-	}
+	enc := dc.tokenizer.EncodeWithOffsets(text)
 
 	// Run inference
-	outputs, err := dc.runtime.RunInference(ctx, "doc_classifier", inputs)
+	outputs, err := dc.runtime.RunInference(ctx, "doc_classifier", dc.runtime.encodingInputs("doc_classifier", enc))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,476 @@
+package mlclassifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Feedback types submitted by reviewers
+const (
+	FeedbackCorrection    = "CORRECTION"
+	FeedbackConfirmation  = "CONFIRMATION"
+	FeedbackFalsePositive = "FALSE_POSITIVE"
+	FeedbackFalseNegative = "FALSE_NEGATIVE"
+)
+
+const feedbackFilterName = "feedback-false-positive-filter"
+
+// modelRefresh is how often a service checks the store for a newer filter
+// or calibration, so scanners in other processes pick up retrained versions
+const modelRefresh = 5 * time.Minute
+
+// FeedbackFilter holds per-rule false-positive filters learned from reviewer
+// feedback. Each rule has its own logistic regression over the words and word
+// pairs around the match and the document type.
+type FeedbackFilter struct {
+	ModelID uuid.UUID              `json:"-"`
+	Version string                 `json:"-"`
+	Rules   map[string]*RuleFilter `json:"rules"`
+}
+
+// RuleFilter is a logistic regression model for one rule. It predicts the
+// probability that a match is a true positive.
+type RuleFilter struct {
+	Bias           float64            `json:"bias"`
+	Weights        map[string]float64 `json:"weights"`
+	Examples       int                `json:"examples"`
+	FalsePositives int                `json:"false_positives"`
+}
+
+// Score returns the probability that a match of ruleName is a true positive.
+// ok is false when no filter has been trained for the rule.
+func (f *FeedbackFilter) Score(ruleName, docType, window string) (float64, bool) {
+	rule, ok := f.Rules[ruleName]
+	if !ok {
+		return 0, false
+	}
+	return rule.predict(feedbackFeatures(docType, window)), true
+}
+
+func (r *RuleFilter) predict(features []string) float64 {
+	z := r.Bias
+	for _, f := range features {
+		z += r.Weights[f]
+	}
+	return sigmoid(z)
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
+
+var featureWordRe = regexp.MustCompile(`\p{L}{2,}`)
+
+// feedbackFeatures extracts the document type and the lowercased words and
+// adjacent word pairs of a context window. Digits and masked values carry no
+// signal across samples and are ignored.
+func feedbackFeatures(docType, window string) []string {
+	words := featureWordRe.FindAllString(strings.ToLower(window), -1)
+	seen := make(map[string]bool, 2*len(words)+1)
+	features := make([]string, 0, 2*len(words)+1)
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			features = append(features, f)
+		}
+	}
+
+	if docType != "" {
+		add("doc:" + docType)
+	}
+	for i, w := range words {
+		add("w:" + w)
+		if i > 0 {
+			add("b:" + words[i-1] + " " + w)
+		}
+	}
+	return features
+}
+
+// FeedbackTrainerConfig controls feedback filter training
+type FeedbackTrainerConfig struct {
+	// A rule is trained once it has MinExamples labeled matches, including
+	// at least MinFalsePositives false positives and one confirmation
+	MinExamples       int
+	MinFalsePositives int
+	Epochs            int
+	LearningRate      float64
+	L2                float64
+}
+
+// DefaultFeedbackTrainerConfig returns default training settings
+func DefaultFeedbackTrainerConfig() FeedbackTrainerConfig {
+	return FeedbackTrainerConfig{
+		MinExamples:       10,
+		MinFalsePositives: 3,
+		Epochs:            300,
+		LearningRate:      0.5,
+		L2:                0.01,
+	}
+}
+
+// FeedbackTrainingRun summarizes one training run. ModelID is nil when
+// there was no new feedback or no rule had enough examples.
+type FeedbackTrainingRun struct {
+	RunID        string               `json:"run_id"`
+	ModelID      *uuid.UUID           `json:"model_id,omitempty"`
+	Version      string               `json:"version,omitempty"`
+	Status       models.MLModelStatus `json:"status,omitempty"` // shadow when an active filter already exists
+	Examples     int                  `json:"examples"`
+	Incorporated int                  `json:"incorporated"`
+	RulesTrained []string             `json:"rules_trained"`
+	RulesSkipped []string             `json:"rules_skipped,omitempty"`
+}
+
+type feedbackExample struct {
+	features []string
+	truePos  bool
+}
+
+// TrainFeedbackFilter retrains the per-rule false-positive filters from all
+// reviewer feedback on scan predictions. FALSE_POSITIVE and CORRECTION
+// feedback are negative examples, CONFIRMATION feedback positive ones. When
+// new feedback is available and at least one rule can be trained, the
+// filters are registered as a new default model version, the new feedback
+// is marked incorporated with the run ID, and the service starts using them.
+func (s *Service) TrainFeedbackFilter(ctx context.Context, config FeedbackTrainerConfig) (*FeedbackTrainingRun, error) {
+	run := &FeedbackTrainingRun{RunID: uuid.New().String(), RulesTrained: []string{}}
+
+	scorerID, err := s.scanScorerModel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting scorer model: %w", err)
+	}
+
+	pending, err := s.store.ListTrainingFeedback(ctx, scorerID, false)
+	if err != nil {
+		return nil, fmt.Errorf("listing new feedback: %w", err)
+	}
+	incorporated, err := s.store.ListTrainingFeedback(ctx, scorerID, true)
+	if err != nil {
+		return nil, fmt.Errorf("listing incorporated feedback: %w", err)
+	}
+
+	// Models are retrained on all feedback so earlier corrections still count
+	byRule := make(map[string][]feedbackExample)
+	newByRule := make(map[string][]uuid.UUID)
+	for i, feedback := range append(pending, incorporated...) {
+		rule, example, ok := exampleFromFeedback(feedback)
+		if !ok {
+			continue
+		}
+		byRule[rule] = append(byRule[rule], example)
+		run.Examples++
+		if i < len(pending) {
+			newByRule[rule] = append(newByRule[rule], feedback.ID)
+		}
+	}
+
+	filter := &FeedbackFilter{Rules: make(map[string]*RuleFilter)}
+	var all []feedbackExample
+	var newIDs []uuid.UUID
+	for rule, examples := range byRule {
+		falsePositives := 0
+		for _, ex := range examples {
+			if !ex.truePos {
+				falsePositives++
+			}
+		}
+		if len(examples) < config.MinExamples || falsePositives < config.MinFalsePositives || falsePositives == len(examples) {
+			run.RulesSkipped = append(run.RulesSkipped, rule)
+			continue
+		}
+		filter.Rules[rule] = trainRuleFilter(examples, config)
+		run.RulesTrained = append(run.RulesTrained, rule)
+		all = append(all, examples...)
+		newIDs = append(newIDs, newByRule[rule]...)
+	}
+	sort.Strings(run.RulesTrained)
+	sort.Strings(run.RulesSkipped)
+
+	// Without new feedback for a trainable rule the current model stands.
+	// Feedback for rules that cannot be trained yet stays pending.
+	if len(newIDs) == 0 {
+		run.RulesTrained = []string{}
+		return run, nil
+	}
+
+	if _, err := s.registerFeedbackFilter(ctx, filter, byRule, run, len(all)); err != nil {
+		return nil, err
+	}
+	if err := s.store.MarkFeedbackIncorporated(ctx, newIDs, run.RunID); err != nil {
+		return nil, fmt.Errorf("marking feedback incorporated: %w", err)
+	}
+	run.Incorporated = len(newIDs)
+
+	s.loadFeedbackFilters(ctx)
+	return run, nil
+}
+
+// exampleFromFeedback turns a feedback record into a training example for the
+// rule whose prediction it reviews. ok is false for feedback that does not
+// label a rule match.
+func exampleFromFeedback(feedback *models.TrainingFeedback) (string, feedbackExample, bool) {
+	var truePos bool
+	switch feedback.FeedbackType {
+	case FeedbackFalsePositive, FeedbackCorrection:
+		truePos = false
+	case FeedbackConfirmation:
+		truePos = true
+	default:
+		return "", feedbackExample{}, false
+	}
+	if feedback.RuleName == "" {
+		return "", feedbackExample{}, false
+	}
+
+	window := feedback.ContextWindow
+	if window == "" {
+		window = feedback.SampleContent
+	}
+	return feedback.RuleName, feedbackExample{
+		features: feedbackFeatures(feedback.DocumentType, window),
+		truePos:  truePos,
+	}, true
+}
+
+// trainRuleFilter fits a logistic regression with batch gradient descent and
+// L2 regularization. Classes are weighted so a rule with few confirmations
+// is not simply predicted as always false positive.
+func trainRuleFilter(examples []feedbackExample, config FeedbackTrainerConfig) *RuleFilter {
+	n := float64(len(examples))
+	positives := 0
+	for _, ex := range examples {
+		if ex.truePos {
+			positives++
+		}
+	}
+	posWeight := n / (2 * float64(positives))
+	negWeight := n / (2 * float64(len(examples)-positives))
+
+	filter := &RuleFilter{
+		Weights:        make(map[string]float64),
+		Examples:       len(examples),
+		FalsePositives: len(examples) - positives,
+	}
+	gradients := make(map[string]float64)
+	for epoch := 0; epoch < config.Epochs; epoch++ {
+		clear(gradients)
+		var biasGradient float64
+		for _, ex := range examples {
+			label, weight := 0.0, negWeight
+			if ex.truePos {
+				label, weight = 1.0, posWeight
+			}
+			g := (filter.predict(ex.features) - label) * weight
+			biasGradient += g
+			for _, f := range ex.features {
+				gradients[f] += g
+			}
+		}
+
+		filter.Bias -= config.LearningRate * biasGradient / n
+		for f, g := range gradients {
+			w := filter.Weights[f]
+			filter.Weights[f] = w - config.LearningRate*(g/n+config.L2*w)
+		}
+	}
+
+	// Drop weights too small to matter to keep the stored model compact
+	for f, w := range filter.Weights {
+		if math.Abs(w) < 1e-3 {
+			delete(filter.Weights, f)
+		}
+	}
+	return filter
+}
+
+// registerFeedbackFilter stores the filters as a new model version. The
+// first version becomes the active default; later versions are shadowed
+// against the active filter until promoted, replacing any older shadow.
+func (s *Service) registerFeedbackFilter(ctx context.Context, filter *FeedbackFilter, byRule map[string][]feedbackExample, run *FeedbackTrainingRun, samples int) (*models.MLModel, error) {
+	existing, err := s.store.ListMLModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing models: %w", err)
+	}
+	versions := 0
+	hasActive := false
+	var shadows []*models.MLModel
+	for _, m := range existing {
+		if m.ModelType != models.MLModelFeedbackFilter {
+			continue
+		}
+		versions++
+		switch {
+		case m.IsDefault && m.Status == models.MLModelStatusActive:
+			hasActive = true
+		case m.Status == models.MLModelStatusShadow:
+			shadows = append(shadows, m)
+		}
+	}
+
+	var config models.JSONB
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	// Metrics are measured on the training data, treating a false positive
+	// as the positive class the filter detects
+	var tp, fp, fn, correct int
+	for rule, rf := range filter.Rules {
+		for _, ex := range byRule[rule] {
+			flagged := rf.predict(ex.features) < 0.5
+			switch {
+			case flagged && !ex.truePos:
+				tp++
+				correct++
+			case flagged && ex.truePos:
+				fp++
+			case !flagged && !ex.truePos:
+				fn++
+			default:
+				correct++
+			}
+		}
+	}
+	precision := ratio(tp, tp+fp)
+	recall := ratio(tp, tp+fn)
+	f1 := 0.0
+	if precision+recall > 0 {
+		f1 = 2 * precision * recall / (precision + recall)
+	}
+
+	now := time.Now()
+	model := &models.MLModel{
+		ID:                  uuid.New(),
+		Name:                feedbackFilterName,
+		ModelType:           models.MLModelFeedbackFilter,
+		Version:             fmt.Sprintf("1.0.%d", versions),
+		Description:         fmt.Sprintf("Per-rule false-positive filters for %d rules trained from reviewer feedback", len(filter.Rules)),
+		Framework:           "builtin",
+		Config:              config,
+		Accuracy:            ratio(correct, samples),
+		PrecisionScore:      precision,
+		RecallScore:         recall,
+		F1Score:             f1,
+		Status:              models.MLModelStatusShadow,
+		TrainedOnSamples:    samples,
+		TrainingDataVersion: run.RunID,
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+	if !hasActive {
+		model.Status = models.MLModelStatusActive
+		model.IsDefault = true
+		model.PromotedAt = &now
+	}
+	if err := s.store.CreateMLModel(ctx, model); err != nil {
+		return nil, fmt.Errorf("registering model: %w", err)
+	}
+
+	// Never promoted, so retired shadows are not rollback targets
+	for _, shadow := range shadows {
+		shadow.Status = models.MLModelStatusRetired
+		shadow.RetiredAt = &now
+		if err := s.store.UpdateMLModel(ctx, shadow); err != nil {
+			return nil, fmt.Errorf("retiring shadow model %s: %w", shadow.Version, err)
+		}
+	}
+
+	run.ModelID = &model.ID
+	run.Version = model.Version
+	run.Status = model.Status
+	return model, nil
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// FeedbackFilterFromModel decodes the filters stored in a registered model
+func FeedbackFilterFromModel(model *models.MLModel) (*FeedbackFilter, error) {
+	data, err := json.Marshal(model.Config)
+	if err != nil {
+		return nil, err
+	}
+	filter := &FeedbackFilter{}
+	if err := json.Unmarshal(data, filter); err != nil {
+		return nil, fmt.Errorf("decoding feedback filter %s: %w", model.Version, err)
+	}
+	filter.ModelID, filter.Version = model.ID, model.Version
+	return filter, nil
+}
+
+// refreshModels reloads the active and shadow feedback filters and the active
+// calibration at most once per modelRefresh, so scanners in other processes
+// pick up retrained and promoted versions
+func (s *Service) refreshModels(ctx context.Context) {
+	if s.store == nil {
+		return
+	}
+	s.mu.Lock()
+	if time.Since(s.modelsCheckedAt) < modelRefresh {
+		s.mu.Unlock()
+		return
+	}
+	s.modelsCheckedAt = time.Now()
+	s.mu.Unlock()
+
+	s.loadFeedbackFilters(ctx)
+	s.loadCalibration(ctx)
+}
+
+// loadFeedbackFilters installs the active feedback filter and the shadow
+// filters scored alongside it. Failures keep the current filters; scoring
+// must not depend on the store being reachable.
+func (s *Service) loadFeedbackFilters(ctx context.Context) {
+	registered, err := s.store.ListMLModels(ctx)
+	if err != nil {
+		return
+	}
+
+	var active *models.MLModel
+	var shadows []*FeedbackFilter
+	for _, m := range registered {
+		if m.ModelType != models.MLModelFeedbackFilter {
+			continue
+		}
+		switch {
+		case m.IsDefault && m.Status == models.MLModelStatusActive:
+			active = m
+		case m.Status == models.MLModelStatusShadow:
+			if filter, err := FeedbackFilterFromModel(m); err == nil {
+				shadows = append(shadows, filter)
+			}
+		}
+	}
+	sort.Slice(shadows, func(i, j int) bool { return shadows[i].Version < shadows[j].Version })
+
+	s.mu.Lock()
+	s.shadowFilters = shadows
+	s.mu.Unlock()
+
+	switch current := s.scorer.FeedbackFilter(); {
+	case active == nil:
+		s.scorer.SetFeedbackFilter(nil)
+	case current == nil || current.ModelID != active.ID:
+		if filter, err := FeedbackFilterFromModel(active); err == nil {
+			s.scorer.SetFeedbackFilter(filter)
+		}
+	}
+}
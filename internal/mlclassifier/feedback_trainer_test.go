@@ -0,0 +1,244 @@
+package mlclassifier
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// submitReview records a scan prediction for rule and reviewer feedback on it
+func submitReview(t *testing.T, svc *Service, store *memStore, rule, feedbackType, window string) {
+	t.Helper()
+	ctx := context.Background()
+	scorerID, err := svc.scanScorerModel(ctx)
+	if err != nil {
+		t.Fatalf("scanScorerModel: %v", err)
+	}
+	prediction := &models.MLPrediction{
+		ID:               uuid.New(),
+		ClassificationID: uuid.New(),
+		ModelID:          scorerID,
+		PredictionType:   PredictionTypeConfidence,
+		RawOutput:        models.JSONB{"rule_name": rule, "document_type": "GENERAL"},
+	}
+	if err := store.CreateMLPrediction(ctx, prediction); err != nil {
+		t.Fatalf("CreateMLPrediction: %v", err)
+	}
+	err = svc.SubmitFeedback(ctx, &FeedbackSubmission{
+		PredictionID:  prediction.ID,
+		FeedbackType:  feedbackType,
+		ContextWindow: window,
+		SubmittedBy:   uuid.New(),
+	})
+	if err != nil {
+		t.Fatalf("SubmitFeedback: %v", err)
+	}
+}
+
+const (
+	fixtureContext  = "unit test fixture: sample ssn ***-**-6789 in mock data"
+	employeeContext = "employee onboarding form, payroll ssn ***-**-6789"
+)
+
+func seedSSNFeedback(t *testing.T, svc *Service, store *memStore) {
+	t.Helper()
+	for i := 0; i < 6; i++ {
+		submitReview(t, svc, store, "SSN", FeedbackFalsePositive, fixtureContext)
+		submitReview(t, svc, store, "SSN", FeedbackConfirmation, employeeContext)
+	}
+}
+
+func TestTrainFeedbackFilter(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+
+	seedSSNFeedback(t, svc, store)
+	// Too little feedback to train a filter for EMAIL
+	submitReview(t, svc, store, "EMAIL", FeedbackFalsePositive, "noreply example")
+	submitReview(t, svc, store, "EMAIL", FeedbackCorrection, "noreply example")
+	// Feedback that does not label a match is ignored
+	submitReview(t, svc, store, "SSN", FeedbackFalseNegative, employeeContext)
+
+	run, err := svc.TrainFeedbackFilter(ctx, DefaultFeedbackTrainerConfig())
+	if err != nil {
+		t.Fatalf("TrainFeedbackFilter: %v", err)
+	}
+	if run.ModelID == nil {
+		t.Fatal("expected a model to be registered")
+	}
+	if run.Version != "1.0.0" {
+		t.Errorf("expected version 1.0.0, got %s", run.Version)
+	}
+	if run.Examples != 14 || run.Incorporated != 12 {
+		t.Errorf("expected 14 examples and 12 incorporated, got %d and %d", run.Examples, run.Incorporated)
+	}
+	if !reflect.DeepEqual(run.RulesTrained, []string{"SSN"}) || !reflect.DeepEqual(run.RulesSkipped, []string{"EMAIL"}) {
+		t.Errorf("expected SSN trained and EMAIL skipped, got %v and %v", run.RulesTrained, run.RulesSkipped)
+	}
+
+	model := store.models[*run.ModelID]
+	if model.ModelType != models.MLModelFeedbackFilter || !model.IsDefault || model.TrainedOnSamples != 12 {
+		t.Errorf("unexpected model %+v", model)
+	}
+	if model.TrainingDataVersion != run.RunID {
+		t.Errorf("expected training data version %s, got %s", run.RunID, model.TrainingDataVersion)
+	}
+
+	for _, f := range store.feedback {
+		rule := store.predictions[*f.PredictionID].RawOutput["rule_name"]
+		wantIncorporated := rule == "SSN" && f.FeedbackType != FeedbackFalseNegative
+		if f.IncorporatedInTraining != wantIncorporated {
+			t.Errorf("%s %s feedback: expected incorporated=%v", rule, f.FeedbackType, wantIncorporated)
+		}
+		if wantIncorporated && f.TrainingRunID != run.RunID {
+			t.Errorf("expected training run %s, got %q", run.RunID, f.TrainingRunID)
+		}
+	}
+
+	filter := svc.scorer.FeedbackFilter()
+	if filter == nil || filter.ModelID != *run.ModelID {
+		t.Fatal("expected the service to use the new filter")
+	}
+	if p, _ := filter.Score("SSN", "GENERAL", "mock fixture for a unit test"); p >= 0.5 {
+		t.Errorf("expected fixture context to look like a false positive, got %v", p)
+	}
+	if p, _ := filter.Score("SSN", "GENERAL", "payroll record for the employee"); p <= 0.5 {
+		t.Errorf("expected employee context to look like a true positive, got %v", p)
+	}
+	if _, ok := filter.Score("EMAIL", "GENERAL", "noreply example"); ok {
+		t.Error("expected no filter for EMAIL")
+	}
+
+	// Filters survive the round trip through the model registry
+	loaded, err := FeedbackFilterFromModel(model)
+	if err != nil {
+		t.Fatalf("FeedbackFilterFromModel: %v", err)
+	}
+	want, _ := filter.Score("SSN", "GENERAL", fixtureContext)
+	if got, _ := loaded.Score("SSN", "GENERAL", fixtureContext); got != want {
+		t.Errorf("expected loaded filter to score %v, got %v", want, got)
+	}
+}
+
+func TestTrainFeedbackFilter_Versions(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+	seedSSNFeedback(t, svc, store)
+
+	first, err := svc.TrainFeedbackFilter(ctx, DefaultFeedbackTrainerConfig())
+	if err != nil {
+		t.Fatalf("TrainFeedbackFilter: %v", err)
+	}
+
+	// Nothing new to learn from
+	again, err := svc.TrainFeedbackFilter(ctx, DefaultFeedbackTrainerConfig())
+	if err != nil {
+		t.Fatalf("TrainFeedbackFilter: %v", err)
+	}
+	if again.ModelID != nil || again.Examples != 12 {
+		t.Errorf("expected no new model from 12 examples, got %+v", again)
+	}
+
+	submitReview(t, svc, store, "SSN", FeedbackFalsePositive, fixtureContext)
+	second, err := svc.TrainFeedbackFilter(ctx, DefaultFeedbackTrainerConfig())
+	if err != nil {
+		t.Fatalf("TrainFeedbackFilter: %v", err)
+	}
+	if second.ModelID == nil || second.Version != "1.0.1" || second.Incorporated != 1 || second.Examples != 13 {
+		t.Fatalf("expected version 1.0.1 trained on 13 examples, got %+v", second)
+	}
+
+	// Retrained versions are shadowed until promoted
+	if second.Status != models.MLModelStatusShadow || store.models[*second.ModelID].IsDefault {
+		t.Errorf("expected version 1.0.1 to be a shadow, got %+v", store.models[*second.ModelID])
+	}
+	current, _ := store.GetDefaultMLModel(ctx, models.MLModelFeedbackFilter)
+	if current == nil || current.ID != *first.ModelID || first.Status != models.MLModelStatusActive {
+		t.Error("expected version 1.0.0 to stay the default")
+	}
+
+	// A newer shadow replaces the older one
+	submitReview(t, svc, store, "SSN", FeedbackConfirmation, employeeContext)
+	third, err := svc.TrainFeedbackFilter(ctx, DefaultFeedbackTrainerConfig())
+	if err != nil {
+		t.Fatalf("TrainFeedbackFilter: %v", err)
+	}
+	if third.Version != "1.0.2" || third.Status != models.MLModelStatusShadow {
+		t.Fatalf("expected shadow version 1.0.2, got %+v", third)
+	}
+	if older := store.models[*second.ModelID]; older.Status != models.MLModelStatusRetired || older.PromotedAt != nil {
+		t.Errorf("expected version 1.0.1 to be retired unpromoted, got status=%s", older.Status)
+	}
+}
+
+func TestTrainFeedbackFilter_DeletedPredictions(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+	seedSSNFeedback(t, svc, store)
+
+	// A rescan deletes the reviewed classifications and their predictions
+	for _, f := range store.feedback {
+		delete(store.predictions, *f.PredictionID)
+		f.PredictionID = nil
+	}
+
+	run, err := svc.TrainFeedbackFilter(ctx, DefaultFeedbackTrainerConfig())
+	if err != nil {
+		t.Fatalf("TrainFeedbackFilter: %v", err)
+	}
+	if run.ModelID == nil || run.Examples != 12 || !reflect.DeepEqual(run.RulesTrained, []string{"SSN"}) {
+		t.Errorf("expected SSN trained on 12 examples, got %+v", run)
+	}
+}
+
+func TestConfidenceScorer_FeedbackFilter(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	trainer := NewService(store)
+	seedSSNFeedback(t, trainer, store)
+	if _, err := trainer.TrainFeedbackFilter(ctx, DefaultFeedbackTrainerConfig()); err != nil {
+		t.Fatalf("TrainFeedbackFilter: %v", err)
+	}
+
+	// A service in another process picks the filter up from the store
+	svc := NewService(store)
+	matches := []EnhancedMatch{{RuleName: "SSN", Category: models.CategoryPII, Value: "***-**-6789", Count: 1, RegexConfidence: 0.9}}
+	fixture, err := svc.EnhanceClassification(ctx, fixtureContext, matches)
+	if err != nil {
+		t.Fatalf("EnhanceClassification: %v", err)
+	}
+	if svc.scorer.FeedbackFilter() == nil {
+		t.Fatal("expected the filter to be loaded from the store")
+	}
+
+	unfiltered := NewConfidenceScorer()
+	params := ConfidenceParams{Match: &matches[0], Context: fixtureContext, RegexValidated: true, FrequencyCount: 1}
+	if got, base := svc.scorer.CalculateConfidence(params), unfiltered.CalculateConfidence(params); got >= base {
+		t.Errorf("expected the filter to lower confidence for fixture context, got %v (unfiltered %v)", got, base)
+	}
+	params.Context = employeeContext
+	if got, base := svc.scorer.CalculateConfidence(params), unfiltered.CalculateConfidence(params); got <= base {
+		t.Errorf("expected the filter to raise confidence for employee context, got %v (unfiltered %v)", got, base)
+	}
+
+	employee, err := svc.EnhanceClassification(ctx, employeeContext, matches)
+	if err != nil {
+		t.Fatalf("EnhanceClassification: %v", err)
+	}
+	if fixture.Matches[0].CombinedConfidence >= employee.Matches[0].CombinedConfidence {
+		t.Errorf("expected fixture match below employee match, got %v and %v",
+			fixture.Matches[0].CombinedConfidence, employee.Matches[0].CombinedConfidence)
+	}
+
+	// Rules without a filter score as before
+	params.Match = &EnhancedMatch{RuleName: "EMAIL", Category: models.CategoryPII}
+	if got, base := svc.scorer.CalculateConfidence(params), unfiltered.CalculateConfidence(params); got != base {
+		t.Errorf("expected unchanged confidence for EMAIL, got %v (unfiltered %v)", got, base)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,6 +19,16 @@ type Service struct {
 	config           ClassifierConfig
 	entityRecognizer EntityRecognizer
 	docClassifier    DocumentClassifier
+
+	mu              sync.Mutex
+	scorerModelID   uuid.UUID         // Model that scan predictions are recorded against
+	modelsCheckedAt time.Time         // Last check for newer filters and calibration
+	shadowFilters   []*FeedbackFilter // Scored alongside the active filter
+	calibration     *Calibration      // Active calibration, nil until one is fitted
+	routing         []*models.ReviewRoutingRule
+	routingLoadedAt time.Time
+
+	escalationNotifier EscalationNotifier
 }
 
 // Store defines the interface for ML classifier data persistence
@@ -29,6 +40,11 @@ type Store interface {
 	GetDefaultMLModel(ctx context.Context, modelType models.MLModelType) (*models.MLModel, error)
 	ListMLModels(ctx context.Context) ([]*models.MLModel, error)
 
+	// Model lifecycle and shadow evaluation
+	ReplaceActiveMLModel(ctx context.Context, next, previous *models.MLModel) error
+	CreateShadowResult(ctx context.Context, result *models.MLShadowResult) error
+	ListShadowResults(ctx context.Context, shadowModelID uuid.UUID) ([]*models.MLShadowResult, error)
+
 	// ML Predictions
 	CreateMLPrediction(ctx context.Context, prediction *models.MLPrediction) error
 	UpdateMLPrediction(ctx context.Context, prediction *models.MLPrediction) error
@@ -39,13 +55,28 @@ type Store interface {
 	CreateReviewQueueItem(ctx context.Context, item *models.ClassificationReviewQueue) error
 	UpdateReviewQueueItem(ctx context.Context, item *models.ClassificationReviewQueue) error
 	GetReviewQueueItem(ctx context.Context, id uuid.UUID) (*models.ClassificationReviewQueue, error)
+	// GetOpenReviewQueueItem returns the pending or in-review item of a classification, or nil
+	GetOpenReviewQueueItem(ctx context.Context, classificationID uuid.UUID) (*models.ClassificationReviewQueue, error)
 	ListReviewQueue(ctx context.Context, status models.ReviewQueueStatus, limit int) ([]*models.ClassificationReviewQueue, error)
 	GetReviewQueueStats(ctx context.Context) (map[string]int, error)
+	CreateCalibrationSample(ctx context.Context, sample *models.CalibrationSample) error
+	ListCalibrationSamples(ctx context.Context, limit int) ([]*models.CalibrationSample, error)
+
+	// Review workflow
+	GetReviewSubject(ctx context.Context, classificationID uuid.UUID, ownerTag string) (*models.ReviewSubject, error)
+	ListOpenReviewEntries(ctx context.Context, ruleName, ownerTag string, limit int) ([]*models.ReviewQueueEntry, error)
+	ListOverdueReviewEntries(ctx context.Context, now time.Time, ownerTag string, limit int) ([]*models.ReviewQueueEntry, error)
+	ListReviewItemsReviewedSince(ctx context.Context, since time.Time) ([]*models.ClassificationReviewQueue, error)
+	ListReviewerWorkloads(ctx context.Context, now time.Time) ([]*models.ReviewerWorkload, error)
+	CreateReviewRoutingRule(ctx context.Context, rule *models.ReviewRoutingRule) error
+	ListReviewRoutingRules(ctx context.Context) ([]*models.ReviewRoutingRule, error)
+	DeleteReviewRoutingRule(ctx context.Context, id uuid.UUID) error
 
 	// Training Feedback
 	CreateTrainingFeedback(ctx context.Context, feedback *models.TrainingFeedback) error
 	ListTrainingFeedback(ctx context.Context, modelID uuid.UUID, incorporated bool) ([]*models.TrainingFeedback, error)
 	MarkFeedbackIncorporated(ctx context.Context, feedbackIDs []uuid.UUID, trainingRunID string) error
+	ListFeedbackForPredictions(ctx context.Context, predictionIDs []uuid.UUID) ([]*models.TrainingFeedback, error)
 
 	// Classifications (for lookups)
 	GetClassification(ctx context.Context, id uuid.UUID) (*models.Classification, error)
@@ -101,6 +132,12 @@ func (s *Service) EnhanceClassification(ctx context.Context, content string, reg
 		RequiresReview:    false,
 	}
 
+	s.refreshModels(ctx)
+	s.mu.Lock()
+	shadows := s.shadowFilters
+	calibration := s.calibration
+	s.mu.Unlock()
+
 	// Get document classification if enabled
 	var docType string
 	if s.config.EnableDocClassifier && s.docClassifier != nil {
@@ -124,7 +161,12 @@ func (s *Service) EnhanceClassification(ctx context.Context, content string, reg
 	// Enhance each match with ML confidence
 	var totalConfidence float64
 	for _, match := range regexMatches {
-		enhanced := s.enhanceMatch(content, match, entities, docType)
+		enhanced := s.enhanceMatch(content, match, entities, docType, shadows)
+		if calibration != nil {
+			if p, ok := calibration.Calibrate(enhanced.RuleName, enhanced.CombinedConfidence); ok {
+				enhanced.CalibratedConfidence = &p
+			}
+		}
 		result.Matches = append(result.Matches, enhanced)
 		totalConfidence += enhanced.CombinedConfidence
 	}
@@ -140,8 +182,9 @@ func (s *Service) EnhanceClassification(ctx context.Context, content string, reg
 	return result, nil
 }
 
-// enhanceMatch enhances a single match with ML confidence
-func (s *Service) enhanceMatch(content string, match EnhancedMatch, entities []Entity, docType string) EnhancedMatch {
+// enhanceMatch enhances a single match with ML confidence. Each shadow filter
+// scores the match too; those scores are kept for evaluation only.
+func (s *Service) enhanceMatch(content string, match EnhancedMatch, entities []Entity, docType string, shadows []*FeedbackFilter) EnhancedMatch {
 	// Extract context around the match
 	contextWindow := s.extractContext(content, match.Value)
 
@@ -165,8 +208,11 @@ func (s *Service) enhanceMatch(content string, match EnhancedMatch, entities []E
 
 	mlConfidence := s.scorer.CalculateConfidence(params)
 
-	// Adjust for document type
+	// Adjust for document type and, for special categories, identifiability
+	offset := findSubstringIndex(content, match.Value)
+	nerRan := s.config.EnableNER && s.entityRecognizer != nil
 	mlConfidence = AdjustForDocumentType(mlConfidence, docType, string(match.Category))
+	mlConfidence = AdjustForSpecialCategory(mlConfidence, match.Category, offset, s.config.ContextWindowSize, entities, nerRan)
 
 	// Combine regex and ML confidence
 	combinedConfidence := CombineConfidenceScores(match.RegexConfidence, mlConfidence, 0.4)
@@ -178,6 +224,23 @@ func (s *Service) enhanceMatch(content string, match EnhancedMatch, entities []E
 	}
 	match.EntityType = entityType
 
+	match.shadow = nil
+	if len(shadows) > 0 {
+		var activeID *uuid.UUID
+		if active := s.scorer.FeedbackFilter(); active != nil {
+			activeID = &active.ModelID
+		}
+		for _, filter := range shadows {
+			shadowML := AdjustForDocumentType(s.scorer.calculateWithFilter(params, filter), docType, string(match.Category))
+			shadowML = AdjustForSpecialCategory(shadowML, match.Category, offset, s.config.ContextWindowSize, entities, nerRan)
+			match.shadow = append(match.shadow, shadowScore{
+				modelID:       filter.ModelID,
+				activeModelID: activeID,
+				confidence:    CombineConfidenceScores(match.RegexConfidence, shadowML, 0.4),
+			})
+		}
+	}
+
 	return match
 }
 
@@ -222,8 +285,8 @@ func (s *Service) shouldRequireReview(result *MLResult) (bool, string) {
 
 	// Check if any match is below auto-approve but above auto-reject
 	for _, match := range result.Matches {
-		if match.CombinedConfidence < thresholds.AutoApprove &&
-			match.CombinedConfidence >= thresholds.RequireReview {
+		if confidence := match.DecisionConfidence(); confidence < thresholds.AutoApprove &&
+			confidence >= thresholds.RequireReview {
 			return true, "LOW_CONFIDENCE"
 		}
 	}
@@ -236,7 +299,7 @@ func (s *Service) shouldRequireReview(result *MLResult) (bool, string) {
 	// Check for high sensitivity data
 	for _, match := range result.Matches {
 		if match.Sensitivity == models.SensitivityCritical &&
-			match.CombinedConfidence < thresholds.AutoApprove {
+			match.DecisionConfidence() < thresholds.AutoApprove {
 			return true, "SENSITIVE_DATA"
 		}
 	}
@@ -257,8 +320,19 @@ func (s *Service) hasConflictingTypes(matches []EnhancedMatch) bool {
 	return len(categories) > 2
 }
 
-// QueueForReview adds a classification to the review queue
+// QueueForReview adds a classification to the review queue. The item is
+// assigned by the routing rules, due within its SLA, and sampled for double
+// review at the configured rate. A classification already awaiting review
+// is not queued again.
 func (s *Service) QueueForReview(ctx context.Context, classificationID uuid.UUID, predictionID *uuid.UUID, reason string, confidence float64) error {
+	open, err := s.store.GetOpenReviewQueueItem(ctx, classificationID)
+	if err != nil {
+		return err
+	}
+	if open != nil {
+		return nil
+	}
+
 	item := &models.ClassificationReviewQueue{
 		ID:                 uuid.New(),
 		ClassificationID:   classificationID,
@@ -270,6 +344,14 @@ func (s *Service) QueueForReview(ctx context.Context, classificationID uuid.UUID
 		CreatedAt:          time.Now(),
 	}
 
+	rule, err := s.routeReview(ctx, item, nil)
+	if err != nil {
+		return err
+	}
+	due := item.CreatedAt.Add(s.reviewSLA(reason, rule))
+	item.DueBy = &due
+	item.DoubleReview = sampledForDoubleReview(item.ID, s.config.Review.DoubleReviewRate)
+
 	return s.store.CreateReviewQueueItem(ctx, item)
 }
 
@@ -336,34 +418,27 @@ func (s *Service) GetReviewQueue(ctx context.Context, status models.ReviewQueueS
 	return result, nil
 }
 
-// ResolveReviewItem resolves a review queue item
-func (s *Service) ResolveReviewItem(ctx context.Context, resolution *ReviewResolution) error {
+// ResolveReviewItem records a reviewer's decision on a review queue item and
+// returns the updated item. An item sampled for double review stays open
+// after its first decision until a different reviewer decides it too.
+func (s *Service) ResolveReviewItem(ctx context.Context, resolution *ReviewResolution) (*models.ClassificationReviewQueue, error) {
+	if !validResolution(resolution.Resolution) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidResolution, resolution.Resolution)
+	}
+
 	// Get the queue item
 	item, err := s.store.GetReviewQueueItem(ctx, resolution.ItemID)
 	if err != nil {
-		return fmt.Errorf("getting review item: %w", err)
+		return nil, fmt.Errorf("getting review item: %w", err)
 	}
-
-	// Update queue item
-	now := time.Now()
-	item.Status = models.ReviewQueueStatusResolved
-	item.ResolvedAt = &now
-	item.Resolution = resolution.Resolution
-	item.FinalLabel = resolution.FinalLabel
-	item.FinalConfidence = resolution.FinalConfidence
-
-	if err := s.store.UpdateReviewQueueItem(ctx, item); err != nil {
-		return fmt.Errorf("updating review item: %w", err)
+	if item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrReviewItemNotFound, resolution.ItemID)
 	}
 
-	// Update classification confidence if confirmed
-	if resolution.Resolution == "CONFIRMED" || resolution.Resolution == "MODIFIED" {
-		if err := s.store.UpdateClassificationConfidence(ctx, item.ClassificationID, resolution.FinalConfidence, true); err != nil {
-			return fmt.Errorf("updating classification: %w", err)
-		}
+	if err := s.resolveItem(ctx, item, resolution); err != nil {
+		return nil, err
 	}
-
-	return nil
+	return item, nil
 }
 
 // SubmitFeedback submits training feedback from human review
@@ -374,7 +449,6 @@ func (s *Service) SubmitFeedback(ctx context.Context, submission *FeedbackSubmis
 
 	feedback := &models.TrainingFeedback{
 		ID:                 uuid.New(),
-		PredictionID:       &submission.PredictionID,
 		OriginalPrediction: submission.OriginalPrediction,
 		CorrectedLabel:     submission.CorrectedLabel,
 		FeedbackType:       submission.FeedbackType,
@@ -385,6 +459,25 @@ func (s *Service) SubmitFeedback(ctx context.Context, submission *FeedbackSubmis
 		SubmittedAt:        time.Now(),
 	}
 
+	// Feedback is attributed to the model that made the prediction, which is
+	// how the trainer finds it
+	if submission.PredictionID != uuid.Nil {
+		prediction, err := s.store.GetMLPrediction(ctx, submission.PredictionID)
+		if err != nil {
+			return fmt.Errorf("getting prediction: %w", err)
+		}
+		if prediction == nil {
+			return fmt.Errorf("prediction %s not found", submission.PredictionID)
+		}
+		feedback.PredictionID = &prediction.ID
+		if prediction.ModelID != uuid.Nil {
+			feedback.ModelID = &prediction.ModelID
+		}
+		feedback.RuleName, _ = prediction.RawOutput["rule_name"].(string)
+		feedback.DocumentType, _ = prediction.RawOutput["document_type"].(string)
+		feedback.Confidence = prediction.ConfidenceScore
+	}
+
 	return s.store.CreateTrainingFeedback(ctx, feedback)
 }
 
@@ -4,6 +4,9 @@ import (
 	"context"
 	"regexp"
 	"strings"
+
+	"github.com/qualys/dspm/internal/classifier"
+	"github.com/qualys/dspm/internal/models"
 )
 
 // RuleBasedNER implements EntityRecognizer using pattern matching
@@ -134,6 +137,17 @@ func (n *RuleBasedNER) initializePatterns() {
 		Validators:  []func(string) bool{validateIBAN},
 		Description: "International Bank Account Number",
 	}
+
+	// GDPR special-category terms from the classifier's multilingual lexicons
+	for _, category := range models.SpecialCategories {
+		entityType := SpecialCategoryEntityType(category)
+		n.patterns[entityType] = &EntityPattern{
+			Regex:       classifier.SpecialCategoryLexicon(category).Pattern(),
+			EntityType:  entityType,
+			Confidence:  0.75,
+			Description: "GDPR special category term",
+		}
+	}
 }
 
 // RecognizeEntities extracts named entities from text
@@ -141,9 +155,7 @@ func (n *RuleBasedNER) RecognizeEntities(ctx context.Context, text string) ([]En
 	var entities []Entity
 
 	for _, pattern := range n.patterns {
-		matches := pattern.Regex.FindAllStringIndex(text, -1)
-
-		for _, match := range matches {
+		for _, match := range findEntityIndexes(pattern.Regex, text) {
 			value := text[match[0]:match[1]]
 
 			// Apply validators if present
@@ -175,6 +187,22 @@ func (n *RuleBasedNER) RecognizeEntities(ctx context.Context, text string) ([]En
 	return entities, nil
 }
 
+// findEntityIndexes returns the spans of re's matches in text, using the
+// group named "value" as the span when re has one
+func findEntityIndexes(re *regexp.Regexp, text string) [][]int {
+	group := re.SubexpIndex("value")
+	if group < 0 {
+		return re.FindAllStringIndex(text, -1)
+	}
+	var indexes [][]int
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		if m[2*group] >= 0 {
+			indexes = append(indexes, m[2*group:2*group+2])
+		}
+	}
+	return indexes
+}
+
 // deduplicateEntities removes overlapping entities, keeping highest confidence
 func (n *RuleBasedNER) deduplicateEntities(entities []Entity) []Entity {
 	if len(entities) == 0 {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log/slog"
 	"strings"
+	"unicode"
 )
 
 // ONNXEntityRecognizer implements NER using ONNX models
@@ -18,11 +19,14 @@ type ONNXEntityRecognizer struct {
 
 // ONNXNERConfig contains configuration for ONNX NER
 type ONNXNERConfig struct {
-	ModelPath    string
-	VocabPath    string
-	MergesPath   string
-	MaxSeqLength int
-	Labels       []string
+	ModelPath  string
+	VocabPath  string
+	MergesPath string
+	// TokenizerPath is the model's HuggingFace tokenizer.json; when set,
+	// VocabPath and MergesPath are ignored
+	TokenizerPath string
+	MaxSeqLength  int
+	Labels        []string
 }
 
 // DefaultONNXNERConfig returns default configuration
@@ -65,9 +69,10 @@ func NewONNXEntityRecognizer(config ONNXNERConfig, runtime *ONNXRuntime, logger
 
 	// Initialize tokenizer
 	tokConfig := TokenizerConfig{
-		VocabFile:  config.VocabPath,
-		MergesFile: config.MergesPath,
-		MaxLength:  config.MaxSeqLength,
+		VocabFile:     config.VocabPath,
+		MergesFile:    config.MergesPath,
+		TokenizerFile: config.TokenizerPath,
+		MaxLength:     config.MaxSeqLength,
 	}
 
 	var err error
@@ -97,7 +102,7 @@ func (n *ONNXEntityRecognizer) RecognizeEntities(ctx context.Context, text strin
 	}
 
 	// If ONNX model is not available, return rule-based results
-	if !n.modelLoaded || n.runtime == nil || !n.runtime.IsAvailable() {
+	if !n.modelLoaded || n.runtime == nil || !n.runtime.IsAvailable() || n.tokenizer == nil {
 		return ruleEntities, nil
 	}
 
@@ -116,25 +121,11 @@ func (n *ONNXEntityRecognizer) RecognizeEntities(ctx context.Context, text strin
 
 // runONNXInference runs the ONNX NER model
 func (n *ONNXEntityRecognizer) runONNXInference(ctx context.Context, text string) ([]Entity, error) {
-	// Tokenize text
-	inputIDs, attentionMask := n.tokenizer.Encode(text)
-
-	// Prepare inputs
-	inputs := []InferenceInput{
-		{
-			Name:  "input_ids",
-			Data:  Int32ToFloat32(inputIDs),
-			Shape: []int64{1, int64(len(inputIDs))},
-		},
-		{
-			Name:  "attention_mask",
-			Data:  Int32ToFloat32(attentionMask),
-			Shape: []int64{1, int64(len(attentionMask))},
-		},
-	}
+	// Tokenize text, keeping each token's position in the original text
+	enc := n.tokenizer.EncodeWithOffsets(text)
 
 	// Run inference
-	outputs, err := n.runtime.RunInference(ctx, "ner", inputs)
+	outputs, err := n.runtime.RunInference(ctx, "ner", n.runtime.encodingInputs("ner", enc))
 	if err != nil {
 		return nil, err
 	}
@@ -144,13 +135,13 @@ func (n *ONNXEntityRecognizer) runONNXInference(ctx context.Context, text string
 	}
 
 	// Parse NER output
-	entities := n.parseNEROutput(text, outputs[0].Data, outputs[0].Shape)
+	entities := n.parseNEROutput(text, enc, outputs[0].Data, outputs[0].Shape)
 
 	return entities, nil
 }
 
 // parseNEROutput converts ONNX NER output to entities
-func (n *ONNXEntityRecognizer) parseNEROutput(text string, logits []float32, shape []int64) []Entity {
+func (n *ONNXEntityRecognizer) parseNEROutput(text string, enc *Encoding, logits []float32, shape []int64) []Entity {
 	var entities []Entity
 
 	if len(shape) < 3 {
@@ -163,6 +154,7 @@ func (n *ONNXEntityRecognizer) parseNEROutput(text string, logits []float32, sha
 	if len(logits) != seqLen*numLabels {
 		return entities
 	}
+	seqLen = min(seqLen, enc.Len())
 
 	// Track current entity being built
 	var currentEntity *struct {
@@ -186,9 +178,9 @@ func (n *ONNXEntityRecognizer) parseNEROutput(text string, logits []float32, sha
 			predLabel = 0 // O tag
 		}
 
-		// Get label name
+		// Get label name; special tokens never belong to an entity
 		labelName := "O"
-		if predLabel < len(n.labels) {
+		if predLabel < len(n.labels) && enc.SpecialTokensMask[pos] == 0 {
 			labelName = n.labels[predLabel]
 		}
 
@@ -196,7 +188,7 @@ func (n *ONNXEntityRecognizer) parseNEROutput(text string, logits []float32, sha
 		if labelName == "O" {
 			// End current entity if any
 			if currentEntity != nil {
-				entity := n.buildEntity(text, currentEntity.entityType, currentEntity.startIdx, pos, confidence)
+				entity := n.buildEntity(text, enc, currentEntity.entityType, currentEntity.startIdx, pos, confidence)
 				if entity != nil {
 					entities = append(entities, *entity)
 				}
@@ -205,7 +197,7 @@ func (n *ONNXEntityRecognizer) parseNEROutput(text string, logits []float32, sha
 		} else if strings.HasPrefix(labelName, "B-") {
 			// Begin new entity
 			if currentEntity != nil {
-				entity := n.buildEntity(text, currentEntity.entityType, currentEntity.startIdx, pos, confidence)
+				entity := n.buildEntity(text, enc, currentEntity.entityType, currentEntity.startIdx, pos, confidence)
 				if entity != nil {
 					entities = append(entities, *entity)
 				}
@@ -228,7 +220,7 @@ func (n *ONNXEntityRecognizer) parseNEROutput(text string, logits []float32, sha
 					currentEntity.tokens = append(currentEntity.tokens, pos)
 				} else {
 					// Type mismatch, end current and start new
-					entity := n.buildEntity(text, currentEntity.entityType, currentEntity.startIdx, pos, confidence)
+					entity := n.buildEntity(text, enc, currentEntity.entityType, currentEntity.startIdx, pos, confidence)
 					if entity != nil {
 						entities = append(entities, *entity)
 					}
@@ -260,7 +252,7 @@ func (n *ONNXEntityRecognizer) parseNEROutput(text string, logits []float32, sha
 
 	// Handle final entity
 	if currentEntity != nil {
-		entity := n.buildEntity(text, currentEntity.entityType, currentEntity.startIdx, seqLen, 0.5)
+		entity := n.buildEntity(text, enc, currentEntity.entityType, currentEntity.startIdx, seqLen, 0.5)
 		if entity != nil {
 			entities = append(entities, *entity)
 		}
@@ -269,45 +261,40 @@ func (n *ONNXEntityRecognizer) parseNEROutput(text string, logits []float32, sha
 	return entities
 }
 
-// buildEntity creates an entity from token positions
-func (n *ONNXEntityRecognizer) buildEntity(text, entityType string, startToken, endToken int, confidence float64) *Entity {
-	// Map token positions to character positions
-	// This is a simplified mapping; in production, use the tokenizer's offset mapping
-	words := strings.Fields(text)
-	if startToken >= len(words) {
+// buildEntity creates an entity from token positions [startToken, endToken),
+// using the tokenizer's offsets. An entity that starts or ends inside a word
+// split into subwords is widened to the whole word.
+func (n *ONNXEntityRecognizer) buildEntity(text string, enc *Encoding, entityType string, startToken, endToken int, confidence float64) *Entity {
+	if startToken >= endToken || endToken > enc.Len() {
 		return nil
 	}
 
-	// Find character offsets
-	charPos := 0
-	startChar := 0
-	endChar := len(text)
-
-	for i, word := range words {
-		wordStart := strings.Index(text[charPos:], word)
-		if wordStart == -1 {
-			break
-		}
-		wordStart += charPos
-
-		if i == startToken {
-			startChar = wordStart
-		}
-		if i == endToken-1 || i == len(words)-1 {
-			endChar = wordStart + len(word)
-		}
-
-		charPos = wordStart + len(word)
+	first, last := startToken, endToken-1
+	for first > 0 && enc.WordIDs[first] >= 0 && enc.WordIDs[first-1] == enc.WordIDs[first] {
+		first--
 	}
-
-	if startChar >= endChar || startChar >= len(text) {
-		return nil
+	for last < enc.Len()-1 && enc.WordIDs[last] >= 0 && enc.WordIDs[last+1] == enc.WordIDs[last] {
+		last++
 	}
 
+	startChar := enc.Offsets[first][0]
+	endChar := enc.Offsets[last][1]
 	if endChar > len(text) {
 		endChar = len(text)
 	}
 
+	// Trim whitespace that normalization folded into a token
+	for startChar < endChar && unicode.IsSpace(rune(text[startChar])) {
+		startChar++
+	}
+	for endChar > startChar && unicode.IsSpace(rune(text[endChar-1])) {
+		endChar--
+	}
+
+	if startChar >= endChar {
+		return nil
+	}
+
 	return &Entity{
 		Text:        text[startChar:endChar],
 		Type:        n.mapEntityType(entityType),
@@ -334,6 +321,8 @@ func (n *ONNXEntityRecognizer) mapEntityType(labelType string) string {
 		return "MEDICAL_TERM"
 	case "FINANCIAL":
 		return "FINANCIAL_TERM"
+	case "HEALTH":
+		return "HEALTH_CONDITION"
 	default:
 		return labelType
 	}
@@ -234,6 +234,46 @@ func TestRuleBasedNER_EntityOffsets(t *testing.T) {
 	}
 }
 
+func TestRuleBasedNER_SpecialCategories(t *testing.T) {
+	ner := NewRuleBasedNER()
+	ctx := context.Background()
+
+	tests := []struct {
+		text         string
+		expectedType string
+		expectedText string
+	}{
+		{"Krankmeldung wegen Depression", "HEALTH_CONDITION", "Krankmeldung"},
+		{"religión: católica", "RELIGION", "religión"},
+		{"orientation sexuelle déclarée", "SEXUAL_ORIENTATION", "orientation sexuelle"},
+		{"face_template=ab12", "BIOMETRIC", "face_template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expectedType, func(t *testing.T) {
+			entities, err := ner.RecognizeEntities(ctx, tt.text)
+			if err != nil {
+				t.Fatalf("RecognizeEntities() error = %v", err)
+			}
+			found := false
+			for _, entity := range entities {
+				if entity.Type == tt.expectedType && entity.Text == tt.expectedText {
+					found = true
+				}
+				if tt.text[entity.StartOffset:entity.EndOffset] != entity.Text {
+					t.Errorf("Offset mismatch for %q", entity.Text)
+				}
+			}
+			if !found {
+				t.Errorf("expected %s entity %q, got %+v", tt.expectedType, tt.expectedText, entities)
+			}
+			if category := EntityTypeToCategory(tt.expectedType); !category.IsSpecial() {
+				t.Errorf("expected %s to map to a special category, got %s", tt.expectedType, category)
+			}
+		})
+	}
+}
+
 func TestRuleBasedNER_Confidence(t *testing.T) {
 	ner := NewRuleBasedNER()
 	ctx := context.Background()
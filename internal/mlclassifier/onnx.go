@@ -4,26 +4,37 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"runtime"
 	"sync"
 )
 
-// ONNXRuntime provides an interface to ONNX model inference
-// This is a wrapper that can work with or without the actual ONNX runtime
+// ONNXRuntime runs ONNX models on the CPU with a pure Go executor, so no
+// shared library or cgo is required. It implements the operator subset used
+// by BERT-style token and sequence classifiers; models using other operators
+// fail to load with the list of what is missing.
 type ONNXRuntime struct {
 	mu        sync.RWMutex
 	models    map[string]*ONNXModel
 	logger    *slog.Logger
 	available bool
+	modelsDir string
+	threads   int
 }
 
-// ONNXModel represents a loaded ONNX model
+// ONNXModel represents a loaded ONNX model. Shapes are as declared in the
+// model file; dynamic dimensions such as batch size and sequence length are -1.
 type ONNXModel struct {
-	Name        string
-	Path        string
-	InputNames  []string
-	OutputNames []string
-	InputShapes map[string][]int64
-	Loaded      bool
+	Name         string
+	Path         string
+	InputNames   []string
+	OutputNames  []string
+	InputShapes  map[string][]int64
+	OutputShapes map[string][]int64
+	Opset        int64
+	Loaded       bool
+
+	graph *onnxGraph
 }
 
 // ONNXConfig contains configuration for the ONNX runtime
@@ -35,7 +46,9 @@ type ONNXConfig struct {
 	EnableProfiling bool
 }
 
-// InferenceInput represents input to an ONNX model
+// InferenceInput represents input to an ONNX model. Data is converted to the
+// element type the model declares for the input. The leading dimension is the
+// batch: several sequences padded to the same length run in one call.
 type InferenceInput struct {
 	Name  string
 	Data  interface{} // []float32 or []int32 or []int64
@@ -51,55 +64,87 @@ type InferenceOutput struct {
 
 // NewONNXRuntime creates a new ONNX runtime instance
 func NewONNXRuntime(config ONNXConfig, logger *slog.Logger) (*ONNXRuntime, error) {
+	threads := config.NumThreads
+	if threads <= 0 {
+		threads = runtime.NumCPU()
+	}
+
 	runtime := &ONNXRuntime{
 		models:    make(map[string]*ONNXModel),
 		logger:    logger,
-		available: false, // Set to true when actual ONNX runtime is available
+		available: true,
+		modelsDir: config.ModelsDir,
+		threads:   threads,
 	}
 
-	// Note: In a production implementation, this would initialize the ONNX runtime
-	// using github.com/yalue/onnxruntime_go or similar
-	//
-	// Example initialization (requires CGO and onnxruntime shared library):
-	// err := ort.SetSharedLibraryPath("/path/to/onnxruntime.so")
-	// err = ort.InitializeEnvironment()
+	if config.UseGPU {
+		logger.Warn("GPU inference is not supported, running ONNX models on the CPU")
+	}
 
 	logger.Info("ONNX runtime initialized",
 		"available", runtime.available,
-		"models_dir", config.ModelsDir)
+		"models_dir", config.ModelsDir,
+		"threads", threads)
 
 	return runtime, nil
 }
 
-// LoadModel loads an ONNX model from disk
+// LoadModel loads an ONNX model from disk. Relative paths are resolved
+// against the configured models directory. Input and output names and shapes
+// are read from the model file.
 func (r *ONNXRuntime) LoadModel(name, path string) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if _, exists := r.models[name]; exists {
+	r.mu.RLock()
+	_, exists := r.models[name]
+	r.mu.RUnlock()
+	if exists {
 		return fmt.Errorf("model %s already loaded", name)
 	}
 
+	if !filepath.IsAbs(path) && r.modelsDir != "" {
+		path = filepath.Join(r.modelsDir, path)
+	}
+
+	proto, err := readONNXModel(path)
+	if err != nil {
+		return fmt.Errorf("loading model %s: %w", name, err)
+	}
+	graph, err := newONNXGraph(proto, r.threads)
+	if err != nil {
+		return fmt.Errorf("loading model %s: %w", name, err)
+	}
+
 	model := &ONNXModel{
-		Name:        name,
-		Path:        path,
-		InputNames:  []string{"input_ids", "attention_mask"},
-		OutputNames: []string{"logits"},
-		InputShapes: map[string][]int64{
-			"input_ids":      {1, 512},
-			"attention_mask": {1, 512},
-		},
-		Loaded: true,
+		Name:         name,
+		Path:         path,
+		InputShapes:  make(map[string][]int64),
+		OutputShapes: make(map[string][]int64),
+		Opset:        graph.exec.opset,
+		Loaded:       true,
+		graph:        graph,
+	}
+	for _, input := range graph.inputs {
+		model.InputNames = append(model.InputNames, input.name)
+		model.InputShapes[input.name] = input.shape
+	}
+	for _, output := range graph.outputs {
+		model.OutputNames = append(model.OutputNames, output.name)
+		model.OutputShapes[output.name] = output.shape
 	}
 
-	// Note: In production, this would actually load the ONNX model
-	// session, err := ort.NewAdvancedSession(path, inputNames, outputNames, options)
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
+	if _, exists := r.models[name]; exists {
+		return fmt.Errorf("model %s already loaded", name)
+	}
 	r.models[name] = model
 
 	r.logger.Info("loaded ONNX model",
 		"name", name,
-		"path", path)
+		"path", path,
+		"inputs", model.InputNames,
+		"outputs", model.OutputNames,
+		"opset", model.Opset)
 
 	return nil
 }
@@ -130,37 +175,39 @@ func (r *ONNXRuntime) RunInference(ctx context.Context, modelName string, inputs
 		return nil, fmt.Errorf("model %s not loaded", modelName)
 	}
 
-	if !model.Loaded {
+	if !model.Loaded || model.graph == nil {
 		return nil, fmt.Errorf("model %s not properly loaded", modelName)
 	}
 
-	// Note: In production, this would run actual ONNX inference
-	// outputs, err := session.Run(inputs)
+	feeds := make(map[string]*tensor, len(inputs))
+	for _, input := range inputs {
+		info, ok := model.graph.input(input.Name)
+		if !ok {
+			return nil, fmt.Errorf("model %s has no input %s", modelName, input.Name)
+		}
+		t, err := inputTensor(input, info.elemType)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", input.Name, err)
+		}
+		feeds[input.Name] = t
+	}
+
+	results, err := model.graph.run(ctx, feeds)
+	if err != nil {
+		return nil, fmt.Errorf("running model %s: %w", modelName, err)
+	}
 
-	// For now, return simulated outputs
+	// Outputs are returned in the order the model declares them
 	outputs := make([]InferenceOutput, len(model.OutputNames))
 	for i, name := range model.OutputNames {
-		// Simulate output shape based on model type
-		var shape []int64
-		var data []float32
-
-		switch modelName {
-		case "ner":
-			// NER model: [batch, seq_len, num_labels]
-			shape = []int64{1, 512, 9} // 9 entity types
-			data = make([]float32, 512*9)
-		case "doc_classifier":
-			// Document classifier: [batch, num_classes]
-			shape = []int64{1, 6} // 6 document types
-			data = make([]float32, 6)
-		default:
-			shape = []int64{1, 512}
-			data = make([]float32, 512)
+		t := results[name]
+		shape := make([]int64, len(t.shape))
+		for d, size := range t.shape {
+			shape[d] = int64(size)
 		}
-
 		outputs[i] = InferenceOutput{
 			Name:  name,
-			Data:  data,
+			Data:  t.floats(),
 			Shape: shape,
 		}
 	}
@@ -168,6 +215,78 @@ func (r *ONNXRuntime) RunInference(ctx context.Context, modelName string, inputs
 	return outputs, nil
 }
 
+// inputTensor converts caller data to the element type the model declares
+func inputTensor(input InferenceInput, elemType int64) (*tensor, error) {
+	shape := make([]int, len(input.Shape))
+	for d, size := range input.Shape {
+		if size < 0 {
+			return nil, fmt.Errorf("invalid shape %v", input.Shape)
+		}
+		shape[d] = int(size)
+	}
+
+	var values []float32
+	var ints []int64
+	switch data := input.Data.(type) {
+	case []float32:
+		values = data
+	case []int32:
+		ints = make([]int64, len(data))
+		for i, v := range data {
+			ints[i] = int64(v)
+		}
+	case []int64:
+		ints = data
+	default:
+		return nil, fmt.Errorf("unsupported data type %T", input.Data)
+	}
+	if n := max(len(values), len(ints)); n != shapeSize(shape) {
+		return nil, fmt.Errorf("%d values do not fill shape %v", n, input.Shape)
+	}
+
+	switch elemType {
+	case onnxFloat, onnxDouble:
+		if values == nil {
+			values = Int64ToFloat32(ints)
+		}
+		return &tensor{dtype: onnxFloat, shape: shape, f: values}, nil
+	case onnxInt64, onnxInt32, onnxInt8, onnxUint8, onnxBool:
+		if ints == nil {
+			ints = Float32ToInt64(values)
+		}
+		dtype := int64(onnxInt64)
+		if elemType == onnxBool {
+			dtype = onnxBool
+		}
+		return &tensor{dtype: dtype, shape: shape, i: ints}, nil
+	default:
+		return nil, fmt.Errorf("unsupported model input type %d", elemType)
+	}
+}
+
+// encodingInputs builds the inputs for a single encoded sequence. Models
+// exported from BERT-style checkpoints often also take token_type_ids, which
+// are all zero for one sequence.
+func (r *ONNXRuntime) encodingInputs(modelName string, enc *Encoding) []InferenceInput {
+	shape := []int64{1, int64(enc.Len())}
+	inputs := []InferenceInput{
+		{Name: "input_ids", Data: enc.IDs, Shape: shape},
+		{Name: "attention_mask", Data: enc.AttentionMask, Shape: shape},
+	}
+
+	r.mu.RLock()
+	model, exists := r.models[modelName]
+	r.mu.RUnlock()
+	if exists {
+		for _, name := range model.InputNames {
+			if name == "token_type_ids" {
+				inputs = append(inputs, InferenceInput{Name: name, Data: make([]int32, enc.Len()), Shape: shape})
+			}
+		}
+	}
+	return inputs
+}
+
 // IsAvailable returns whether the ONNX runtime is available
 func (r *ONNXRuntime) IsAvailable() bool {
 	return r.available
@@ -0,0 +1,158 @@
+package mlclassifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// onnxGraph is a loaded model ready for execution. It is immutable after
+// loading, so one graph can serve concurrent RunInference calls.
+type onnxGraph struct {
+	exec         execContext
+	nodes        []*onnxNode
+	initializers map[string]*tensor
+	inputs       []onnxValueInfo
+	outputs      []onnxValueInfo
+}
+
+// newONNXGraph prepares a decoded model for execution. It fails up front if
+// the graph uses operators the executor does not implement.
+func newONNXGraph(m *onnxModelProto, threads int) (*onnxGraph, error) {
+	opset, ok := m.opsets[""]
+	if !ok {
+		opset = m.opsets["ai.onnx"]
+	}
+	if missing := unsupportedOps(m.graph.nodes); len(missing) > 0 {
+		return nil, fmt.Errorf("unsupported operators: %s", strings.Join(missing, ", "))
+	}
+
+	g := &onnxGraph{
+		exec:         execContext{opset: opset, threads: threads},
+		nodes:        m.graph.nodes,
+		initializers: make(map[string]*tensor, len(m.graph.initializers)),
+		outputs:      m.graph.outputs,
+	}
+	for _, p := range m.graph.initializers {
+		t, err := tensorFromProto(p)
+		if err != nil {
+			return nil, err
+		}
+		g.initializers[p.name] = t
+	}
+
+	// Older exporters also list initializers as graph inputs
+	for _, input := range m.graph.inputs {
+		if _, ok := g.initializers[input.name]; !ok {
+			g.inputs = append(g.inputs, input)
+		}
+	}
+	if len(g.outputs) == 0 {
+		return nil, errors.New("model has no outputs")
+	}
+	return g, nil
+}
+
+// run executes the graph. Nodes are stored in topological order, as the ONNX
+// format requires, so a single pass evaluates every output.
+func (g *onnxGraph) run(ctx context.Context, feeds map[string]*tensor) (map[string]*tensor, error) {
+	values := make(map[string]*tensor, len(g.initializers)+len(feeds)+len(g.nodes))
+	for name, t := range g.initializers {
+		values[name] = t
+	}
+
+	for _, input := range g.inputs {
+		t, ok := feeds[input.name]
+		if !ok {
+			return nil, fmt.Errorf("missing input %s", input.name)
+		}
+		if err := input.check(t); err != nil {
+			return nil, err
+		}
+		values[input.name] = t
+	}
+	for name := range feeds {
+		if !g.hasInput(name) {
+			return nil, fmt.Errorf("model has no input %s", name)
+		}
+	}
+
+	for _, node := range g.nodes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		in := make([]*tensor, len(node.inputs))
+		for k, name := range node.inputs {
+			if name == "" {
+				continue
+			}
+			t, ok := values[name]
+			if !ok {
+				return nil, fmt.Errorf("node %s: input %s has not been computed", node.label(), name)
+			}
+			in[k] = t
+		}
+
+		out, err := onnxOps[node.opType](&g.exec, node, in)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", node.label(), err)
+		}
+		for k, name := range node.outputs {
+			if name != "" && k < len(out) {
+				values[name] = out[k]
+			}
+		}
+	}
+
+	results := make(map[string]*tensor, len(g.outputs))
+	for _, output := range g.outputs {
+		t, ok := values[output.name]
+		if !ok {
+			return nil, fmt.Errorf("output %s was not produced", output.name)
+		}
+		results[output.name] = t
+	}
+	return results, nil
+}
+
+func (g *onnxGraph) hasInput(name string) bool {
+	for _, input := range g.inputs {
+		if input.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *onnxGraph) input(name string) (onnxValueInfo, bool) {
+	for _, input := range g.inputs {
+		if input.name == name {
+			return input, true
+		}
+	}
+	return onnxValueInfo{}, false
+}
+
+// check verifies a fed tensor against the declared rank and static dimensions
+func (v onnxValueInfo) check(t *tensor) error {
+	if v.shape == nil {
+		return nil
+	}
+	if len(v.shape) != t.rank() {
+		return fmt.Errorf("input %s: expected rank %d, got shape %v", v.name, len(v.shape), t.shape)
+	}
+	for d, want := range v.shape {
+		if want >= 0 && int64(t.shape[d]) != want {
+			return fmt.Errorf("input %s: dimension %d must be %d, got %d", v.name, d, want, t.shape[d])
+		}
+	}
+	return nil
+}
+
+func (n *onnxNode) label() string {
+	if n.name != "" {
+		return n.name + " (" + n.opType + ")"
+	}
+	return n.opType
+}
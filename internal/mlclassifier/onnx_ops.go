@@ -0,0 +1,1197 @@
+package mlclassifier
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// onnxOpFunc executes one node. Absent optional inputs are nil. Ops must not
+// modify their inputs: initializers are shared between concurrent runs.
+type onnxOpFunc func(ec *execContext, node *onnxNode, in []*tensor) ([]*tensor, error)
+
+// execContext carries per-model settings into ops
+type execContext struct {
+	opset   int64
+	threads int
+}
+
+// onnxOps lists the operators the executor supports. It covers the graphs
+// produced when exporting BERT-style token and sequence classifiers.
+var onnxOps = map[string]onnxOpFunc{
+	"Add":                binaryOp(func(a, b float32) float32 { return a + b }, func(a, b int64) int64 { return a + b }),
+	"Sub":                binaryOp(func(a, b float32) float32 { return a - b }, func(a, b int64) int64 { return a - b }),
+	"Mul":                binaryOp(func(a, b float32) float32 { return a * b }, func(a, b int64) int64 { return a * b }),
+	"Div":                binaryOp(func(a, b float32) float32 { return a / b }, intDiv),
+	"Pow":                binaryOp(func(a, b float32) float32 { return float32(math.Pow(float64(a), float64(b))) }, intPow),
+	"Equal":              compareOp(func(c int) bool { return c == 0 }),
+	"Less":               compareOp(func(c int) bool { return c < 0 }),
+	"Greater":            compareOp(func(c int) bool { return c > 0 }),
+	"And":                logicalOp(func(a, b bool) bool { return a && b }),
+	"Or":                 logicalOp(func(a, b bool) bool { return a || b }),
+	"Not":                opNot,
+	"Where":              opWhere,
+	"Sqrt":               unaryOp(func(x float64) float64 { return math.Sqrt(x) }),
+	"Exp":                unaryOp(math.Exp),
+	"Erf":                unaryOp(math.Erf),
+	"Tanh":               unaryOp(math.Tanh),
+	"Reciprocal":         unaryOp(func(x float64) float64 { return 1 / x }),
+	"Sigmoid":            unaryOp(func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }),
+	"Relu":               unaryOp(func(x float64) float64 { return math.Max(x, 0) }),
+	"Neg":                opNeg,
+	"Gelu":               opGelu,
+	"Clip":               opClip,
+	"Identity":           opIdentity,
+	"Dropout":            opDropout,
+	"Cast":               opCast,
+	"Constant":           opConstant,
+	"ConstantOfShape":    opConstantOfShape,
+	"Shape":              opShape,
+	"Gather":             opGather,
+	"Unsqueeze":          opUnsqueeze,
+	"Squeeze":            opSqueeze,
+	"Concat":             opConcat,
+	"Reshape":            opReshape,
+	"Flatten":            opFlatten,
+	"Transpose":          opTranspose,
+	"Slice":              opSlice,
+	"Expand":             opExpand,
+	"Range":              opRange,
+	"MatMul":             opMatMul,
+	"Gemm":               opGemm,
+	"Softmax":            opSoftmax,
+	"ReduceMean":         reduceOp(func(sum float32, n int) float32 { return sum / float32(n) }),
+	"ReduceSum":          reduceOp(func(sum float32, _ int) float32 { return sum }),
+	"LayerNormalization": opLayerNorm,
+	"ArgMax":             opArgMax,
+}
+
+// Attribute accessors
+
+func (n *onnxNode) attrInt(name string, def int64) int64 {
+	if a, ok := n.attrs[name]; ok {
+		return a.i
+	}
+	return def
+}
+
+func (n *onnxNode) attrFloat(name string, def float32) float32 {
+	if a, ok := n.attrs[name]; ok {
+		return a.f
+	}
+	return def
+}
+
+func (n *onnxNode) attrInts(name string) ([]int64, bool) {
+	a, ok := n.attrs[name]
+	if !ok {
+		return nil, false
+	}
+	return a.ints, true
+}
+
+// axesInput returns axes given as an attribute (older opsets) or as the
+// input at index idx (newer opsets)
+func axesInput(node *onnxNode, in []*tensor, idx int) ([]int64, bool) {
+	if axes, ok := node.attrInts("axes"); ok {
+		return axes, true
+	}
+	if idx < len(in) && in[idx] != nil {
+		return in[idx].ints(), true
+	}
+	return nil, false
+}
+
+func requireInputs(in []*tensor, n int) error {
+	if len(in) < n {
+		return fmt.Errorf("expected %d inputs, got %d", n, len(in))
+	}
+	for k := 0; k < n; k++ {
+		if in[k] == nil {
+			return fmt.Errorf("input %d is required", k)
+		}
+	}
+	return nil
+}
+
+// Elementwise ops
+
+func intDiv(a, b int64) int64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func intPow(a, b int64) int64 {
+	return int64(math.Pow(float64(a), float64(b)))
+}
+
+func binaryOp(ff func(a, b float32) float32, fi func(a, b int64) int64) onnxOpFunc {
+	return func(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+		if err := requireInputs(in, 2); err != nil {
+			return nil, err
+		}
+		a, b := in[0], in[1]
+		shape, err := broadcastShapes(a.shape, b.shape)
+		if err != nil {
+			return nil, err
+		}
+		strides := [][]int{broadcastStrides(a.shape, shape), broadcastStrides(b.shape, shape)}
+
+		// A float base may take an integer operand (as Pow exponents do);
+		// integer results need integer operands
+		if a.isFloat() {
+			out := newFloatTensor(shape)
+			bf := b.floats()
+			forEachBroadcast(shape, strides, func(o int, offs []int) {
+				out.f[o] = ff(a.f[offs[0]], bf[offs[1]])
+			})
+			return []*tensor{out}, nil
+		}
+		if b.isFloat() {
+			return nil, errors.New("mixed integer and float operands")
+		}
+		out := newIntTensor(onnxInt64, shape)
+		forEachBroadcast(shape, strides, func(o int, offs []int) {
+			out.i[o] = fi(a.i[offs[0]], b.i[offs[1]])
+		})
+		return []*tensor{out}, nil
+	}
+}
+
+func compareOp(test func(c int) bool) onnxOpFunc {
+	return func(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+		if err := requireInputs(in, 2); err != nil {
+			return nil, err
+		}
+		a, b := in[0], in[1]
+		shape, err := broadcastShapes(a.shape, b.shape)
+		if err != nil {
+			return nil, err
+		}
+		strides := [][]int{broadcastStrides(a.shape, shape), broadcastStrides(b.shape, shape)}
+		out := newIntTensor(onnxBool, shape)
+		af, bf := a.floats(), b.floats()
+		forEachBroadcast(shape, strides, func(o int, offs []int) {
+			var c int
+			if a.isFloat() || b.isFloat() {
+				c = compareValues(af[offs[0]], bf[offs[1]])
+			} else {
+				c = compareValues(a.i[offs[0]], b.i[offs[1]])
+			}
+			if test(c) {
+				out.i[o] = 1
+			}
+		})
+		return []*tensor{out}, nil
+	}
+}
+
+func compareValues[T float32 | int64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func logicalOp(fn func(a, b bool) bool) onnxOpFunc {
+	return func(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+		if err := requireInputs(in, 2); err != nil {
+			return nil, err
+		}
+		a, b := in[0], in[1]
+		shape, err := broadcastShapes(a.shape, b.shape)
+		if err != nil {
+			return nil, err
+		}
+		strides := [][]int{broadcastStrides(a.shape, shape), broadcastStrides(b.shape, shape)}
+		out := newIntTensor(onnxBool, shape)
+		forEachBroadcast(shape, strides, func(o int, offs []int) {
+			if fn(a.i[offs[0]] != 0, b.i[offs[1]] != 0) {
+				out.i[o] = 1
+			}
+		})
+		return []*tensor{out}, nil
+	}
+}
+
+func opNot(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	out := newIntTensor(onnxBool, in[0].shape)
+	for k, v := range in[0].i {
+		if v == 0 {
+			out.i[k] = 1
+		}
+	}
+	return []*tensor{out}, nil
+}
+
+func opWhere(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 3); err != nil {
+		return nil, err
+	}
+	cond, x, y := in[0], in[1], in[2]
+	if x.isFloat() != y.isFloat() {
+		return nil, errors.New("mixed integer and float operands")
+	}
+	shape, err := broadcastShapes(cond.shape, x.shape, y.shape)
+	if err != nil {
+		return nil, err
+	}
+	strides := [][]int{
+		broadcastStrides(cond.shape, shape),
+		broadcastStrides(x.shape, shape),
+		broadcastStrides(y.shape, shape),
+	}
+	if x.isFloat() {
+		out := newFloatTensor(shape)
+		forEachBroadcast(shape, strides, func(o int, offs []int) {
+			if cond.i[offs[0]] != 0 {
+				out.f[o] = x.f[offs[1]]
+			} else {
+				out.f[o] = y.f[offs[2]]
+			}
+		})
+		return []*tensor{out}, nil
+	}
+	out := newIntTensor(x.dtype, shape)
+	forEachBroadcast(shape, strides, func(o int, offs []int) {
+		if cond.i[offs[0]] != 0 {
+			out.i[o] = x.i[offs[1]]
+		} else {
+			out.i[o] = y.i[offs[2]]
+		}
+	})
+	return []*tensor{out}, nil
+}
+
+func unaryOp(fn func(x float64) float64) onnxOpFunc {
+	return func(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+		if err := requireInputs(in, 1); err != nil {
+			return nil, err
+		}
+		x := in[0].floats()
+		out := newFloatTensor(in[0].shape)
+		for k, v := range x {
+			out.f[k] = float32(fn(float64(v)))
+		}
+		return []*tensor{out}, nil
+	}
+}
+
+func opNeg(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	if in[0].isFloat() {
+		out := newFloatTensor(in[0].shape)
+		for k, v := range in[0].f {
+			out.f[k] = -v
+		}
+		return []*tensor{out}, nil
+	}
+	out := newIntTensor(in[0].dtype, in[0].shape)
+	for k, v := range in[0].i {
+		out.i[k] = -v
+	}
+	return []*tensor{out}, nil
+}
+
+func opGelu(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	gelu := func(x float64) float64 { return 0.5 * x * (1 + math.Erf(x/math.Sqrt2)) }
+	if a, ok := node.attrs["approximate"]; ok && string(a.s) == "tanh" {
+		gelu = func(x float64) float64 {
+			return 0.5 * x * (1 + math.Tanh(math.Sqrt(2/math.Pi)*(x+0.044715*x*x*x)))
+		}
+	}
+	return unaryOp(gelu)(nil, node, in)
+}
+
+func opClip(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	lo := node.attrFloat("min", -math.MaxFloat32)
+	hi := node.attrFloat("max", math.MaxFloat32)
+	if len(in) > 1 && in[1] != nil {
+		lo = in[1].floats()[0]
+	}
+	if len(in) > 2 && in[2] != nil {
+		hi = in[2].floats()[0]
+	}
+	x := in[0].floats()
+	out := newFloatTensor(in[0].shape)
+	for k, v := range x {
+		out.f[k] = float32(math.Min(math.Max(float64(v), float64(lo)), float64(hi)))
+	}
+	return []*tensor{out}, nil
+}
+
+// Data movement ops
+
+func opIdentity(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	return []*tensor{in[0]}, nil
+}
+
+// opDropout is the identity at inference time. The optional mask output is all true.
+func opDropout(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	mask := newIntTensor(onnxBool, in[0].shape)
+	for k := range mask.i {
+		mask.i[k] = 1
+	}
+	return []*tensor{in[0], mask}, nil
+}
+
+func opCast(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	switch to := node.attrInt("to", 0); to {
+	case onnxFloat, onnxDouble:
+		out := newFloatTensor(x.shape)
+		copy(out.f, x.floats())
+		return []*tensor{out}, nil
+	case onnxInt64, onnxInt32, onnxInt8, onnxUint8:
+		out := newIntTensor(onnxInt64, x.shape)
+		copy(out.i, x.ints())
+		return []*tensor{out}, nil
+	case onnxBool:
+		out := newIntTensor(onnxBool, x.shape)
+		for k, v := range x.floats() {
+			if v != 0 {
+				out.i[k] = 1
+			}
+		}
+		return []*tensor{out}, nil
+	default:
+		return nil, fmt.Errorf("unsupported cast to type %d", to)
+	}
+}
+
+func opConstant(_ *execContext, node *onnxNode, _ []*tensor) ([]*tensor, error) {
+	if a, ok := node.attrs["value"]; ok && a.t != nil {
+		t, err := tensorFromProto(a.t)
+		if err != nil {
+			return nil, err
+		}
+		return []*tensor{t}, nil
+	}
+	if a, ok := node.attrs["value_float"]; ok {
+		return []*tensor{{dtype: onnxFloat, shape: []int{}, f: []float32{a.f}}}, nil
+	}
+	if a, ok := node.attrs["value_floats"]; ok {
+		return []*tensor{{dtype: onnxFloat, shape: []int{len(a.floats)}, f: a.floats}}, nil
+	}
+	if a, ok := node.attrs["value_int"]; ok {
+		return []*tensor{{dtype: onnxInt64, shape: []int{}, i: []int64{a.i}}}, nil
+	}
+	if a, ok := node.attrs["value_ints"]; ok {
+		return []*tensor{{dtype: onnxInt64, shape: []int{len(a.ints)}, i: a.ints}}, nil
+	}
+	return nil, errors.New("constant has no supported value attribute")
+}
+
+func opConstantOfShape(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	shape := intsToShape(in[0].ints())
+	value := &tensor{dtype: onnxFloat, shape: []int{1}, f: []float32{0}}
+	if a, ok := node.attrs["value"]; ok && a.t != nil {
+		v, err := tensorFromProto(a.t)
+		if err != nil {
+			return nil, err
+		}
+		value = v
+	}
+	if value.isFloat() {
+		out := newFloatTensor(shape)
+		for k := range out.f {
+			out.f[k] = value.f[0]
+		}
+		return []*tensor{out}, nil
+	}
+	out := newIntTensor(value.dtype, shape)
+	for k := range out.i {
+		out.i[k] = value.i[0]
+	}
+	return []*tensor{out}, nil
+}
+
+func intsToShape(dims []int64) []int {
+	shape := make([]int, len(dims))
+	for k, d := range dims {
+		shape[k] = int(d)
+	}
+	return shape
+}
+
+func opShape(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	rank := int64(in[0].rank())
+	start, end := node.attrInt("start", 0), node.attrInt("end", rank)
+	if start < 0 {
+		start += rank
+	}
+	if end < 0 {
+		end += rank
+	}
+	start, end = max64(0, min64(start, rank)), max64(0, min64(end, rank))
+	end = max64(start, end)
+
+	out := newIntTensor(onnxInt64, []int{int(end - start)})
+	for k := start; k < end; k++ {
+		out.i[k-start] = int64(in[0].shape[k])
+	}
+	return []*tensor{out}, nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func opGather(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	data, indices := in[0], in[1]
+	axis, err := normalizeAxis(node.attrInt("axis", 0), data.rank())
+	if err != nil {
+		return nil, err
+	}
+
+	outer := shapeSize(data.shape[:axis])
+	inner := shapeSize(data.shape[axis+1:])
+	dim := data.shape[axis]
+
+	shape := append(append(append([]int{}, data.shape[:axis]...), indices.shape...), data.shape[axis+1:]...)
+	out := &tensor{dtype: data.dtype, shape: shape}
+	if data.isFloat() {
+		out.f = make([]float32, shapeSize(shape))
+	} else {
+		out.i = make([]int64, shapeSize(shape))
+	}
+
+	idx := indices.ints()
+	for o := 0; o < outer; o++ {
+		for k, ix := range idx {
+			if ix < 0 {
+				ix += int64(dim)
+			}
+			if ix < 0 || ix >= int64(dim) {
+				return nil, fmt.Errorf("index %d out of range for axis of size %d", idx[k], dim)
+			}
+			src := (o*dim + int(ix)) * inner
+			dst := (o*len(idx) + k) * inner
+			if data.isFloat() {
+				copy(out.f[dst:dst+inner], data.f[src:src+inner])
+			} else {
+				copy(out.i[dst:dst+inner], data.i[src:src+inner])
+			}
+		}
+	}
+	return []*tensor{out}, nil
+}
+
+func opUnsqueeze(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	axes, ok := axesInput(node, in, 1)
+	if !ok {
+		return nil, errors.New("unsqueeze requires axes")
+	}
+	rank := in[0].rank() + len(axes)
+	inserted := make(map[int]bool, len(axes))
+	for _, a := range axes {
+		axis, err := normalizeAxis(a, rank)
+		if err != nil {
+			return nil, err
+		}
+		inserted[axis] = true
+	}
+	shape := make([]int, 0, rank)
+	src := 0
+	for d := 0; d < rank; d++ {
+		if inserted[d] {
+			shape = append(shape, 1)
+		} else {
+			shape = append(shape, in[0].shape[src])
+			src++
+		}
+	}
+	return []*tensor{in[0].withShape(shape)}, nil
+}
+
+func opSqueeze(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	removed := make(map[int]bool)
+	if axes, ok := axesInput(node, in, 1); ok {
+		for _, a := range axes {
+			axis, err := normalizeAxis(a, x.rank())
+			if err != nil {
+				return nil, err
+			}
+			if x.shape[axis] != 1 {
+				return nil, fmt.Errorf("cannot squeeze axis %d of size %d", axis, x.shape[axis])
+			}
+			removed[axis] = true
+		}
+	} else {
+		for d, size := range x.shape {
+			removed[d] = size == 1
+		}
+	}
+	shape := []int{}
+	for d, size := range x.shape {
+		if !removed[d] {
+			shape = append(shape, size)
+		}
+	}
+	return []*tensor{x.withShape(shape)}, nil
+}
+
+func opConcat(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	first := in[0]
+	axis, err := normalizeAxis(node.attrInt("axis", 0), first.rank())
+	if err != nil {
+		return nil, err
+	}
+
+	shape := append([]int{}, first.shape...)
+	shape[axis] = 0
+	for _, t := range in {
+		if t.rank() != first.rank() || t.isFloat() != first.isFloat() {
+			return nil, errors.New("concat inputs must have the same rank and type")
+		}
+		for d := range shape {
+			if d != axis && t.shape[d] != first.shape[d] {
+				return nil, fmt.Errorf("cannot concat shapes %v and %v on axis %d", first.shape, t.shape, axis)
+			}
+		}
+		shape[axis] += t.shape[axis]
+	}
+
+	out := &tensor{dtype: first.dtype, shape: shape}
+	if first.isFloat() {
+		out.f = make([]float32, 0, shapeSize(shape))
+	} else {
+		out.i = make([]int64, 0, shapeSize(shape))
+	}
+	outer := shapeSize(shape[:axis])
+	inner := shapeSize(shape[axis+1:])
+	for o := 0; o < outer; o++ {
+		for _, t := range in {
+			chunk := t.shape[axis] * inner
+			if first.isFloat() {
+				out.f = append(out.f, t.f[o*chunk:(o+1)*chunk]...)
+			} else {
+				out.i = append(out.i, t.i[o*chunk:(o+1)*chunk]...)
+			}
+		}
+	}
+	return []*tensor{out}, nil
+}
+
+func opReshape(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	dims := in[1].ints()
+	allowZero := node.attrInt("allowzero", 0) == 1
+
+	shape := make([]int, len(dims))
+	infer := -1
+	known := 1
+	for k, d := range dims {
+		switch {
+		case d == -1:
+			if infer >= 0 {
+				return nil, errors.New("reshape allows only one -1 dimension")
+			}
+			infer = k
+			continue
+		case d == 0 && !allowZero:
+			if k >= x.rank() {
+				return nil, fmt.Errorf("reshape dimension %d copies a missing input dimension", k)
+			}
+			shape[k] = x.shape[k]
+		default:
+			shape[k] = int(d)
+		}
+		known *= shape[k]
+	}
+	if infer >= 0 {
+		if known == 0 || x.size()%known != 0 {
+			return nil, fmt.Errorf("cannot reshape %v to %v", x.shape, dims)
+		}
+		shape[infer] = x.size() / known
+	}
+	if shapeSize(shape) != x.size() {
+		return nil, fmt.Errorf("cannot reshape %v to %v", x.shape, dims)
+	}
+	return []*tensor{x.withShape(shape)}, nil
+}
+
+func opFlatten(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axis := node.attrInt("axis", 1)
+	if axis < 0 {
+		axis += int64(x.rank())
+	}
+	if axis < 0 || axis > int64(x.rank()) {
+		return nil, fmt.Errorf("axis %d out of range for rank %d", axis, x.rank())
+	}
+	return []*tensor{x.withShape([]int{shapeSize(x.shape[:axis]), shapeSize(x.shape[axis:])})}, nil
+}
+
+func opTranspose(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	rank := x.rank()
+	perm, ok := node.attrInts("perm")
+	if !ok {
+		perm = make([]int64, rank)
+		for d := range perm {
+			perm[d] = int64(rank - 1 - d)
+		}
+	}
+	if len(perm) != rank {
+		return nil, fmt.Errorf("perm %v does not match rank %d", perm, rank)
+	}
+
+	shape := make([]int, rank)
+	srcStrides := shapeStrides(x.shape)
+	strides := make([]int, rank)
+	for d, p := range perm {
+		if p < 0 || p >= int64(rank) {
+			return nil, fmt.Errorf("invalid perm %v", perm)
+		}
+		shape[d] = x.shape[p]
+		strides[d] = srcStrides[p]
+	}
+
+	out := &tensor{dtype: x.dtype, shape: shape}
+	if x.isFloat() {
+		out.f = make([]float32, x.size())
+		forEachBroadcast(shape, [][]int{strides}, func(o int, offs []int) { out.f[o] = x.f[offs[0]] })
+	} else {
+		out.i = make([]int64, x.size())
+		forEachBroadcast(shape, [][]int{strides}, func(o int, offs []int) { out.i[o] = x.i[offs[0]] })
+	}
+	return []*tensor{out}, nil
+}
+
+func opSlice(ec *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	rank := x.rank()
+
+	var starts, ends, axes, steps []int64
+	if ec.opset < 10 {
+		starts, _ = node.attrInts("starts")
+		ends, _ = node.attrInts("ends")
+		axes, _ = node.attrInts("axes")
+	} else {
+		if err := requireInputs(in, 3); err != nil {
+			return nil, err
+		}
+		starts, ends = in[1].ints(), in[2].ints()
+		if len(in) > 3 && in[3] != nil {
+			axes = in[3].ints()
+		}
+		if len(in) > 4 && in[4] != nil {
+			steps = in[4].ints()
+		}
+	}
+	if len(starts) != len(ends) {
+		return nil, errors.New("slice starts and ends differ in length")
+	}
+	if axes == nil {
+		for d := range starts {
+			axes = append(axes, int64(d))
+		}
+	}
+
+	begin := make([]int, rank)
+	step := make([]int, rank)
+	shape := append([]int{}, x.shape...)
+	for d := range step {
+		step[d] = 1
+	}
+	for k, a := range axes {
+		axis, err := normalizeAxis(a, rank)
+		if err != nil {
+			return nil, err
+		}
+		dim := int64(x.shape[axis])
+		st := int64(1)
+		if k < len(steps) {
+			st = steps[k]
+		}
+		if st == 0 {
+			return nil, errors.New("slice step cannot be 0")
+		}
+		s, e := starts[k], ends[k]
+		if s < 0 {
+			s += dim
+		}
+		if e < 0 {
+			e += dim
+		}
+		var n int64
+		if st > 0 {
+			s, e = max64(0, min64(s, dim)), max64(0, min64(e, dim))
+			n = max64(0, (e-s+st-1)/st)
+		} else {
+			s, e = max64(-1, min64(s, dim-1)), max64(-1, min64(e, dim-1))
+			n = max64(0, (s-e-st-1)/-st)
+		}
+		begin[axis], step[axis], shape[axis] = int(s), int(st), int(n)
+	}
+
+	srcStrides := shapeStrides(x.shape)
+	base := 0
+	strides := make([]int, rank)
+	for d := range strides {
+		base += begin[d] * srcStrides[d]
+		strides[d] = step[d] * srcStrides[d]
+	}
+
+	out := &tensor{dtype: x.dtype, shape: shape}
+	if x.isFloat() {
+		out.f = make([]float32, shapeSize(shape))
+		forEachBroadcast(shape, [][]int{strides}, func(o int, offs []int) { out.f[o] = x.f[base+offs[0]] })
+	} else {
+		out.i = make([]int64, shapeSize(shape))
+		forEachBroadcast(shape, [][]int{strides}, func(o int, offs []int) { out.i[o] = x.i[base+offs[0]] })
+	}
+	return []*tensor{out}, nil
+}
+
+func opExpand(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	shape, err := broadcastShapes(x.shape, intsToShape(in[1].ints()))
+	if err != nil {
+		return nil, err
+	}
+	strides := [][]int{broadcastStrides(x.shape, shape)}
+	out := &tensor{dtype: x.dtype, shape: shape}
+	if x.isFloat() {
+		out.f = make([]float32, shapeSize(shape))
+		forEachBroadcast(shape, strides, func(o int, offs []int) { out.f[o] = x.f[offs[0]] })
+	} else {
+		out.i = make([]int64, shapeSize(shape))
+		forEachBroadcast(shape, strides, func(o int, offs []int) { out.i[o] = x.i[offs[0]] })
+	}
+	return []*tensor{out}, nil
+}
+
+func opRange(_ *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 3); err != nil {
+		return nil, err
+	}
+	start, limit, delta := in[0], in[1], in[2]
+	if start.isFloat() {
+		s, l, d := start.f[0], limit.floats()[0], delta.floats()[0]
+		if d == 0 {
+			return nil, errors.New("range delta cannot be 0")
+		}
+		n := int(math.Max(math.Ceil(float64((l-s)/d)), 0))
+		out := newFloatTensor([]int{n})
+		for k := range out.f {
+			out.f[k] = s + float32(k)*d
+		}
+		return []*tensor{out}, nil
+	}
+	s, l, d := start.i[0], limit.ints()[0], delta.ints()[0]
+	if d == 0 {
+		return nil, errors.New("range delta cannot be 0")
+	}
+	n := int(math.Max(math.Ceil(float64(l-s)/float64(d)), 0))
+	out := newIntTensor(onnxInt64, []int{n})
+	for k := range out.i {
+		out.i[k] = s + int64(k)*d
+	}
+	return []*tensor{out}, nil
+}
+
+// Linear algebra
+
+// opMatMul follows numpy matmul semantics, including broadcasting of batch
+// dimensions, so one graph serves any batch size and sequence length
+func opMatMul(ec *execContext, _ *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	a, b := in[0], in[1]
+	if !a.isFloat() || !b.isFloat() {
+		return nil, errors.New("matmul requires float operands")
+	}
+
+	aShape, bShape := a.shape, b.shape
+	if len(aShape) == 1 {
+		aShape = []int{1, aShape[0]}
+	}
+	if len(bShape) == 1 {
+		bShape = []int{bShape[0], 1}
+	}
+	if len(aShape) == 0 || len(bShape) == 0 {
+		return nil, errors.New("matmul operands must have rank 1 or more")
+	}
+	m, k := aShape[len(aShape)-2], aShape[len(aShape)-1]
+	k2, n := bShape[len(bShape)-2], bShape[len(bShape)-1]
+	if k != k2 {
+		return nil, fmt.Errorf("matmul shapes %v and %v do not align", a.shape, b.shape)
+	}
+
+	aBatch, bBatch := aShape[:len(aShape)-2], bShape[:len(bShape)-2]
+	batch, err := broadcastShapes(aBatch, bBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	out := newFloatTensor(append(append([]int{}, batch...), m, n))
+	strides := [][]int{broadcastStrides(aBatch, batch), broadcastStrides(bBatch, batch)}
+	type job struct{ o, ao, bo int }
+	jobs := make([]job, 0, shapeSize(batch))
+	forEachBroadcast(batch, strides, func(o int, offs []int) {
+		jobs = append(jobs, job{o * m * n, offs[0] * m * k, offs[1] * k * n})
+	})
+
+	// Rows are independent, so large products are split across goroutines
+	rows := len(jobs) * m
+	work := func(from, to int) {
+		for r := from; r < to; r++ {
+			j := jobs[r/m]
+			i := r % m
+			dst := out.f[j.o+i*n : j.o+(i+1)*n]
+			src := a.f[j.ao+i*k : j.ao+(i+1)*k]
+			for p, av := range src {
+				if av == 0 {
+					continue
+				}
+				row := b.f[j.bo+p*n : j.bo+(p+1)*n]
+				for c, bv := range row {
+					dst[c] += av * bv
+				}
+			}
+		}
+	}
+	parallelize(ec.threads, rows, rows*k*n, work)
+
+	// Drop the dimensions added for 1-D operands
+	shape := append([]int{}, batch...)
+	if len(a.shape) > 1 {
+		shape = append(shape, m)
+	}
+	if len(b.shape) > 1 {
+		shape = append(shape, n)
+	}
+	return []*tensor{out.withShape(shape)}, nil
+}
+
+// parallelize runs work over [0, n) in up to threads chunks when the total
+// cost is large enough to outweigh scheduling
+func parallelize(threads, n, cost int, work func(from, to int)) {
+	const minParallelCost = 1 << 16
+	if threads <= 1 || n < 2 || cost < minParallelCost {
+		work(0, n)
+		return
+	}
+	threads = min(threads, n)
+	chunk := (n + threads - 1) / threads
+	var wg sync.WaitGroup
+	for from := 0; from < n; from += chunk {
+		to := min(from+chunk, n)
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			work(from, to)
+		}(from, to)
+	}
+	wg.Wait()
+}
+
+func opGemm(ec *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	a, b := in[0], in[1]
+	if a.rank() != 2 || b.rank() != 2 {
+		return nil, errors.New("gemm requires 2-D operands")
+	}
+	if node.attrInt("transA", 0) == 1 {
+		t, err := opTranspose(ec, &onnxNode{}, []*tensor{a})
+		if err != nil {
+			return nil, err
+		}
+		a = t[0]
+	}
+	if node.attrInt("transB", 0) == 1 {
+		t, err := opTranspose(ec, &onnxNode{}, []*tensor{b})
+		if err != nil {
+			return nil, err
+		}
+		b = t[0]
+	}
+	prod, err := opMatMul(ec, node, []*tensor{a, b})
+	if err != nil {
+		return nil, err
+	}
+	out := prod[0]
+	alpha, beta := node.attrFloat("alpha", 1), node.attrFloat("beta", 1)
+	for k := range out.f {
+		out.f[k] *= alpha
+	}
+	if len(in) > 2 && in[2] != nil {
+		c := in[2]
+		strides := [][]int{broadcastStrides(c.shape, out.shape)}
+		cf := c.floats()
+		forEachBroadcast(out.shape, strides, func(o int, offs []int) {
+			out.f[o] += beta * cf[offs[0]]
+		})
+	}
+	return []*tensor{out}, nil
+}
+
+func opSoftmax(ec *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	def := int64(-1)
+	if ec.opset < 13 {
+		def = 1
+	}
+	axis, err := normalizeAxis(node.attrInt("axis", def), x.rank())
+	if err != nil {
+		return nil, err
+	}
+
+	// Before opset 13 the input is coerced to 2-D at axis
+	outer, dim, inner := shapeSize(x.shape[:axis]), x.shape[axis], shapeSize(x.shape[axis+1:])
+	if ec.opset < 13 {
+		dim, inner = shapeSize(x.shape[axis:]), 1
+	}
+
+	xf := x.floats()
+	out := newFloatTensor(x.shape)
+	for o := 0; o < outer; o++ {
+		for i := 0; i < inner; i++ {
+			base := o*dim*inner + i
+			mx := float32(math.Inf(-1))
+			for d := 0; d < dim; d++ {
+				mx = float32(math.Max(float64(mx), float64(xf[base+d*inner])))
+			}
+			var sum float64
+			for d := 0; d < dim; d++ {
+				e := math.Exp(float64(xf[base+d*inner] - mx))
+				out.f[base+d*inner] = float32(e)
+				sum += e
+			}
+			for d := 0; d < dim; d++ {
+				out.f[base+d*inner] = float32(float64(out.f[base+d*inner]) / sum)
+			}
+		}
+	}
+	return []*tensor{out}, nil
+}
+
+func reduceOp(finish func(sum float32, n int) float32) onnxOpFunc {
+	return func(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+		if err := requireInputs(in, 1); err != nil {
+			return nil, err
+		}
+		x := in[0]
+		keep := node.attrInt("keepdims", 1) == 1
+
+		reduced := make(map[int]bool)
+		axes, ok := axesInput(node, in, 1)
+		if !ok || len(axes) == 0 {
+			if node.attrInt("noop_with_empty_axes", 0) == 1 {
+				return []*tensor{x}, nil
+			}
+			for d := range x.shape {
+				reduced[d] = true
+			}
+		}
+		for _, a := range axes {
+			axis, err := normalizeAxis(a, x.rank())
+			if err != nil {
+				return nil, err
+			}
+			reduced[axis] = true
+		}
+
+		outShape := make([]int, 0, x.rank())
+		keptShape := make([]int, x.rank())
+		count := 1
+		for d, size := range x.shape {
+			if reduced[d] {
+				keptShape[d] = 1
+				count *= size
+				if keep {
+					outShape = append(outShape, 1)
+				}
+			} else {
+				keptShape[d] = size
+				outShape = append(outShape, size)
+			}
+		}
+
+		// Accumulate each input element into its reduced position
+		sums := newFloatTensor(keptShape)
+		dst := broadcastStrides(keptShape, x.shape)
+		xf := x.floats()
+		forEachBroadcast(x.shape, [][]int{dst}, func(o int, offs []int) {
+			sums.f[offs[0]] += xf[o]
+		})
+		for k, v := range sums.f {
+			sums.f[k] = finish(v, count)
+		}
+		return []*tensor{sums.withShape(outShape)}, nil
+	}
+}
+
+func opLayerNorm(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 2); err != nil {
+		return nil, err
+	}
+	x, scale := in[0], in[1]
+	var bias []float32
+	if len(in) > 2 && in[2] != nil {
+		bias = in[2].floats()
+	}
+	axis, err := normalizeAxis(node.attrInt("axis", -1), x.rank())
+	if err != nil {
+		return nil, err
+	}
+	eps := float64(node.attrFloat("epsilon", 1e-5))
+
+	norm := shapeSize(x.shape[axis:])
+	if scale.size() != norm || (bias != nil && len(bias) != norm) {
+		return nil, fmt.Errorf("layer norm scale/bias must have %d elements", norm)
+	}
+	xf, sf := x.floats(), scale.floats()
+	out := newFloatTensor(x.shape)
+	for base := 0; base < len(xf); base += norm {
+		row := xf[base : base+norm]
+		var mean, variance float64
+		for _, v := range row {
+			mean += float64(v)
+		}
+		mean /= float64(norm)
+		for _, v := range row {
+			d := float64(v) - mean
+			variance += d * d
+		}
+		inv := 1 / math.Sqrt(variance/float64(norm)+eps)
+		for k, v := range row {
+			y := (float64(v) - mean) * inv * float64(sf[k])
+			if bias != nil {
+				y += float64(bias[k])
+			}
+			out.f[base+k] = float32(y)
+		}
+	}
+	return []*tensor{out}, nil
+}
+
+func opArgMax(_ *execContext, node *onnxNode, in []*tensor) ([]*tensor, error) {
+	if err := requireInputs(in, 1); err != nil {
+		return nil, err
+	}
+	x := in[0]
+	axis, err := normalizeAxis(node.attrInt("axis", 0), x.rank())
+	if err != nil {
+		return nil, err
+	}
+	keep := node.attrInt("keepdims", 1) == 1
+	outer, dim, inner := shapeSize(x.shape[:axis]), x.shape[axis], shapeSize(x.shape[axis+1:])
+
+	shape := append([]int{}, x.shape[:axis]...)
+	if keep {
+		shape = append(shape, 1)
+	}
+	shape = append(shape, x.shape[axis+1:]...)
+
+	xf := x.floats()
+	out := newIntTensor(onnxInt64, shape)
+	for o := 0; o < outer; o++ {
+		for i := 0; i < inner; i++ {
+			best := 0
+			for d := 1; d < dim; d++ {
+				if xf[(o*dim+d)*inner+i] > xf[(o*dim+best)*inner+i] {
+					best = d
+				}
+			}
+			out.i[o*inner+i] = int64(best)
+		}
+	}
+	return []*tensor{out}, nil
+}
+
+// unsupportedOps lists op types in nodes that the executor cannot run
+func unsupportedOps(nodes []*onnxNode) []string {
+	seen := make(map[string]bool)
+	var missing []string
+	for _, node := range nodes {
+		key := node.opType
+		if node.domain != "" && node.domain != "ai.onnx" {
+			key = node.domain + "." + node.opType
+		} else if _, ok := onnxOps[node.opType]; ok {
+			continue
+		}
+		if !seen[key] {
+			seen[key] = true
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
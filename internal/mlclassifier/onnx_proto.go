@@ -0,0 +1,433 @@
+package mlclassifier
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// This file decodes the subset of the ONNX protobuf schema (onnx.proto3) that
+// the executor needs. Field numbers follow the upstream schema; unknown fields
+// are skipped, so models produced by newer exporters still load.
+
+// ONNX TensorProto.DataType values
+const (
+	onnxFloat  = 1
+	onnxUint8  = 2
+	onnxInt8   = 3
+	onnxInt32  = 6
+	onnxInt64  = 7
+	onnxBool   = 9
+	onnxDouble = 11
+)
+
+type onnxModelProto struct {
+	irVersion int64
+	opsets    map[string]int64
+	graph     *onnxGraphProto
+}
+
+type onnxGraphProto struct {
+	name         string
+	nodes        []*onnxNode
+	initializers []*onnxTensorProto
+	inputs       []onnxValueInfo
+	outputs      []onnxValueInfo
+}
+
+type onnxNode struct {
+	name    string
+	opType  string
+	domain  string
+	inputs  []string
+	outputs []string
+	attrs   map[string]*onnxAttribute
+}
+
+type onnxAttribute struct {
+	name   string
+	f      float32
+	i      int64
+	s      []byte
+	t      *onnxTensorProto
+	floats []float32
+	ints   []int64
+}
+
+type onnxTensorProto struct {
+	name         string
+	dims         []int64
+	dataType     int64
+	rawData      []byte
+	floatData    []float32
+	int32Data    []int64
+	int64Data    []int64
+	doubleData   []float64
+	externalData map[string]string
+	external     bool
+}
+
+// onnxValueInfo describes a graph input or output. A dimension of -1 is
+// dynamic; its symbolic name, if any, is kept in dimNames.
+type onnxValueInfo struct {
+	name     string
+	elemType int64
+	shape    []int64
+	dimNames []string
+}
+
+// readONNXModel reads and decodes a model file. Initializers stored as
+// external data are loaded relative to the model's directory.
+func readONNXModel(path string) (*onnxModelProto, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	model, err := decodeONNXModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	for _, init := range model.graph.initializers {
+		if init.external {
+			if err := init.loadExternal(filepath.Dir(path)); err != nil {
+				return nil, fmt.Errorf("initializer %s: %w", init.name, err)
+			}
+		}
+	}
+	return model, nil
+}
+
+func decodeONNXModel(b []byte) (*onnxModelProto, error) {
+	m := &onnxModelProto{opsets: make(map[string]int64)}
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			m.irVersion = int64(n)
+		case 7:
+			g, err := decodeONNXGraph(v)
+			if err != nil {
+				return err
+			}
+			m.graph = g
+		case 8:
+			var domain string
+			var version int64
+			err := walkFields(v, func(num protowire.Number, _ protowire.Type, v []byte, n uint64) error {
+				switch num {
+				case 1:
+					domain = string(v)
+				case 2:
+					version = int64(n)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			m.opsets[domain] = version
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if m.graph == nil {
+		return nil, errors.New("model has no graph")
+	}
+	return m, nil
+}
+
+func decodeONNXGraph(b []byte) (*onnxGraphProto, error) {
+	g := &onnxGraphProto{}
+	err := walkFields(b, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			node, err := decodeONNXNode(v)
+			if err != nil {
+				return err
+			}
+			g.nodes = append(g.nodes, node)
+		case 2:
+			g.name = string(v)
+		case 5:
+			t, err := decodeONNXTensor(v)
+			if err != nil {
+				return err
+			}
+			g.initializers = append(g.initializers, t)
+		case 11, 12:
+			info, err := decodeONNXValueInfo(v)
+			if err != nil {
+				return err
+			}
+			if num == 11 {
+				g.inputs = append(g.inputs, info)
+			} else {
+				g.outputs = append(g.outputs, info)
+			}
+		}
+		return nil
+	})
+	return g, err
+}
+
+func decodeONNXNode(b []byte) (*onnxNode, error) {
+	node := &onnxNode{attrs: make(map[string]*onnxAttribute)}
+	err := walkFields(b, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			node.inputs = append(node.inputs, string(v))
+		case 2:
+			node.outputs = append(node.outputs, string(v))
+		case 3:
+			node.name = string(v)
+		case 4:
+			node.opType = string(v)
+		case 5:
+			attr, err := decodeONNXAttribute(v)
+			if err != nil {
+				return err
+			}
+			node.attrs[attr.name] = attr
+		case 7:
+			node.domain = string(v)
+		}
+		return nil
+	})
+	return node, err
+}
+
+func decodeONNXAttribute(b []byte) (*onnxAttribute, error) {
+	a := &onnxAttribute{}
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			a.name = string(v)
+		case 2:
+			a.f = math.Float32frombits(uint32(n))
+		case 3:
+			a.i = int64(n)
+		case 4:
+			a.s = v
+		case 5:
+			t, err := decodeONNXTensor(v)
+			if err != nil {
+				return err
+			}
+			a.t = t
+		case 7:
+			a.floats = appendFloats(a.floats, typ, v, n)
+		case 8:
+			a.ints = appendInts(a.ints, typ, v, n)
+		}
+		return nil
+	})
+	return a, err
+}
+
+func decodeONNXTensor(b []byte) (*onnxTensorProto, error) {
+	t := &onnxTensorProto{}
+	err := walkFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			t.dims = appendInts(t.dims, typ, v, n)
+		case 2:
+			t.dataType = int64(n)
+		case 4:
+			t.floatData = appendFloats(t.floatData, typ, v, n)
+		case 5:
+			t.int32Data = appendInts(t.int32Data, typ, v, n)
+		case 7:
+			t.int64Data = appendInts(t.int64Data, typ, v, n)
+		case 8:
+			t.name = string(v)
+		case 9:
+			t.rawData = v
+		case 10:
+			t.doubleData = appendDoubles(t.doubleData, typ, v, n)
+		case 13:
+			if t.externalData == nil {
+				t.externalData = make(map[string]string)
+			}
+			var key, value string
+			err := walkFields(v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+				switch num {
+				case 1:
+					key = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			t.externalData[key] = value
+		case 14:
+			t.external = n == 1
+		}
+		return nil
+	})
+	return t, err
+}
+
+func decodeONNXValueInfo(b []byte) (onnxValueInfo, error) {
+	info := onnxValueInfo{}
+	err := walkFields(b, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			info.name = string(v)
+		case 2:
+			// TypeProto.tensor_type
+			return walkFields(v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+				if num != 1 {
+					return nil
+				}
+				return walkFields(v, func(num protowire.Number, _ protowire.Type, v []byte, n uint64) error {
+					switch num {
+					case 1:
+						info.elemType = int64(n)
+					case 2:
+						info.shape = []int64{}
+						return walkFields(v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+							if num != 1 {
+								return nil
+							}
+							dim, name := int64(-1), ""
+							err := walkFields(v, func(num protowire.Number, _ protowire.Type, v []byte, n uint64) error {
+								switch num {
+								case 1:
+									dim = int64(n)
+								case 2:
+									name = string(v)
+								}
+								return nil
+							})
+							info.shape = append(info.shape, dim)
+							info.dimNames = append(info.dimNames, name)
+							return err
+						})
+					}
+					return nil
+				})
+			})
+		}
+		return nil
+	})
+	return info, err
+}
+
+// loadExternal reads tensor data stored outside the model file
+func (t *onnxTensorProto) loadExternal(dir string) error {
+	location := t.externalData["location"]
+	if !filepath.IsLocal(location) {
+		return fmt.Errorf("invalid external data location %q", location)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, location))
+	if err != nil {
+		return err
+	}
+	offset, length := int64(0), int64(len(data))
+	if s, ok := t.externalData["offset"]; ok {
+		if offset, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return fmt.Errorf("invalid external data offset %q", s)
+		}
+	}
+	if s, ok := t.externalData["length"]; ok {
+		if length, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return fmt.Errorf("invalid external data length %q", s)
+		}
+	} else {
+		length -= offset
+	}
+	if offset < 0 || length < 0 || offset+length > int64(len(data)) {
+		return fmt.Errorf("external data range %d+%d exceeds %s", offset, length, location)
+	}
+	t.rawData = data[offset : offset+length]
+	t.external = false
+	return nil
+}
+
+// walkFields calls fn for every field in a protobuf message. Varint and
+// fixed-width values are passed in n; length-delimited values in v.
+func walkFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+
+		var v []byte
+		var n uint64
+		switch typ {
+		case protowire.VarintType:
+			n, l = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var x uint32
+			x, l = protowire.ConsumeFixed32(b)
+			n = uint64(x)
+		case protowire.Fixed64Type:
+			n, l = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, l = protowire.ConsumeBytes(b)
+		default:
+			l = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+
+		if err := fn(num, typ, v, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendInts decodes a repeated int64/int32 field, packed or not
+func appendInts(dst []int64, typ protowire.Type, v []byte, n uint64) []int64 {
+	if typ != protowire.BytesType {
+		return append(dst, int64(n))
+	}
+	for len(v) > 0 {
+		x, l := protowire.ConsumeVarint(v)
+		if l < 0 {
+			break
+		}
+		dst = append(dst, int64(x))
+		v = v[l:]
+	}
+	return dst
+}
+
+// appendFloats decodes a repeated float field, packed or not
+func appendFloats(dst []float32, typ protowire.Type, v []byte, n uint64) []float32 {
+	if typ != protowire.BytesType {
+		return append(dst, math.Float32frombits(uint32(n)))
+	}
+	for len(v) >= 4 {
+		dst = append(dst, math.Float32frombits(binary.LittleEndian.Uint32(v)))
+		v = v[4:]
+	}
+	return dst
+}
+
+// appendDoubles decodes a repeated double field, packed or not
+func appendDoubles(dst []float64, typ protowire.Type, v []byte, n uint64) []float64 {
+	if typ != protowire.BytesType {
+		return append(dst, math.Float64frombits(n))
+	}
+	for len(v) >= 8 {
+		dst = append(dst, math.Float64frombits(binary.LittleEndian.Uint64(v)))
+		v = v[8:]
+	}
+	return dst
+}
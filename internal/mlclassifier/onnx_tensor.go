@@ -0,0 +1,263 @@
+package mlclassifier
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// tensor is a dense row-major tensor used by the ONNX executor. Floating point
+// types are computed as float32 in f; integer types are carried as int64 in i.
+// Booleans use i with 0 and 1 and keep dtype onnxBool.
+type tensor struct {
+	dtype int64
+	shape []int
+	f     []float32
+	i     []int64
+}
+
+func newFloatTensor(shape []int) *tensor {
+	return &tensor{dtype: onnxFloat, shape: shape, f: make([]float32, shapeSize(shape))}
+}
+
+func newIntTensor(dtype int64, shape []int) *tensor {
+	return &tensor{dtype: dtype, shape: shape, i: make([]int64, shapeSize(shape))}
+}
+
+func (t *tensor) isFloat() bool {
+	return t.dtype == onnxFloat
+}
+
+func (t *tensor) size() int {
+	return shapeSize(t.shape)
+}
+
+func (t *tensor) rank() int {
+	return len(t.shape)
+}
+
+// ints returns the tensor's values as int64, converting floats
+func (t *tensor) ints() []int64 {
+	if !t.isFloat() {
+		return t.i
+	}
+	out := make([]int64, len(t.f))
+	for k, v := range t.f {
+		out[k] = int64(v)
+	}
+	return out
+}
+
+// floats returns the tensor's values as float32, converting integers
+func (t *tensor) floats() []float32 {
+	if t.isFloat() {
+		return t.f
+	}
+	return Int64ToFloat32(t.i)
+}
+
+// scalarInt returns the single value of a scalar or one-element tensor
+func (t *tensor) scalarInt() (int64, error) {
+	if t.size() != 1 {
+		return 0, fmt.Errorf("expected a scalar, got shape %v", t.shape)
+	}
+	return t.ints()[0], nil
+}
+
+// withShape returns a view of t with a different shape. Ops never modify
+// their inputs, so views can share data.
+func (t *tensor) withShape(shape []int) *tensor {
+	return &tensor{dtype: t.dtype, shape: shape, f: t.f, i: t.i}
+}
+
+func shapeSize(shape []int) int {
+	n := 1
+	for _, d := range shape {
+		n *= d
+	}
+	return n
+}
+
+func shapeStrides(shape []int) []int {
+	strides := make([]int, len(shape))
+	s := 1
+	for d := len(shape) - 1; d >= 0; d-- {
+		strides[d] = s
+		s *= shape[d]
+	}
+	return strides
+}
+
+func shapesEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeAxis maps a possibly negative axis into [0, rank)
+func normalizeAxis(axis int64, rank int) (int, error) {
+	if axis < 0 {
+		axis += int64(rank)
+	}
+	if axis < 0 || axis >= int64(rank) {
+		return 0, fmt.Errorf("axis %d out of range for rank %d", axis, rank)
+	}
+	return int(axis), nil
+}
+
+// broadcastShapes applies numpy-style multidirectional broadcasting
+func broadcastShapes(shapes ...[]int) ([]int, error) {
+	rank := 0
+	for _, s := range shapes {
+		rank = max(rank, len(s))
+	}
+	out := make([]int, rank)
+	for k := range out {
+		out[k] = 1
+	}
+	for _, s := range shapes {
+		offset := rank - len(s)
+		for k, d := range s {
+			switch {
+			case out[offset+k] == d || d == 1:
+			case out[offset+k] == 1:
+				out[offset+k] = d
+			default:
+				return nil, fmt.Errorf("shapes %v are not broadcastable", shapes)
+			}
+		}
+	}
+	return out, nil
+}
+
+// broadcastStrides returns strides of shape aligned to out, with zero strides
+// on broadcast dimensions
+func broadcastStrides(shape, out []int) []int {
+	strides := make([]int, len(out))
+	src := shapeStrides(shape)
+	offset := len(out) - len(shape)
+	for k, d := range shape {
+		if d != 1 {
+			strides[offset+k] = src[k]
+		}
+	}
+	return strides
+}
+
+// forEachBroadcast calls fn for every element of out with the flat offsets of
+// the corresponding elements of each broadcast input
+func forEachBroadcast(out []int, strides [][]int, fn func(o int, offs []int)) {
+	n := shapeSize(out)
+	offs := make([]int, len(strides))
+	idx := make([]int, len(out))
+	for o := 0; o < n; o++ {
+		fn(o, offs)
+		for d := len(out) - 1; d >= 0; d-- {
+			idx[d]++
+			for k := range strides {
+				offs[k] += strides[k][d]
+			}
+			if idx[d] < out[d] {
+				break
+			}
+			for k := range strides {
+				offs[k] -= strides[k][d] * out[d]
+			}
+			idx[d] = 0
+		}
+	}
+}
+
+// tensorFromProto converts an initializer or Constant value
+func tensorFromProto(p *onnxTensorProto) (*tensor, error) {
+	if p.external {
+		return nil, fmt.Errorf("tensor %s: external data was not loaded", p.name)
+	}
+	shape := make([]int, len(p.dims))
+	for k, d := range p.dims {
+		shape[k] = int(d)
+	}
+	n := shapeSize(shape)
+	raw := p.rawData
+
+	switch p.dataType {
+	case onnxFloat:
+		t := newFloatTensor(shape)
+		switch {
+		case raw != nil:
+			if len(raw) != 4*n {
+				return nil, fmt.Errorf("tensor %s: %d bytes of raw data for %d floats", p.name, len(raw), n)
+			}
+			for k := range t.f {
+				t.f[k] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*k:]))
+			}
+		case len(p.floatData) == n:
+			copy(t.f, p.floatData)
+		default:
+			return nil, fmt.Errorf("tensor %s: %d values for shape %v", p.name, len(p.floatData), shape)
+		}
+		return t, nil
+
+	case onnxDouble:
+		t := newFloatTensor(shape)
+		switch {
+		case raw != nil:
+			if len(raw) != 8*n {
+				return nil, fmt.Errorf("tensor %s: %d bytes of raw data for %d doubles", p.name, len(raw), n)
+			}
+			for k := range t.f {
+				t.f[k] = float32(math.Float64frombits(binary.LittleEndian.Uint64(raw[8*k:])))
+			}
+		case len(p.doubleData) == n:
+			for k, v := range p.doubleData {
+				t.f[k] = float32(v)
+			}
+		default:
+			return nil, fmt.Errorf("tensor %s: %d values for shape %v", p.name, len(p.doubleData), shape)
+		}
+		return t, nil
+
+	case onnxInt64, onnxInt32, onnxInt8, onnxUint8, onnxBool:
+		dtype := int64(onnxInt64)
+		if p.dataType == onnxBool {
+			dtype = onnxBool
+		}
+		t := newIntTensor(dtype, shape)
+		switch {
+		case raw != nil:
+			width := map[int64]int{onnxInt64: 8, onnxInt32: 4, onnxInt8: 1, onnxUint8: 1, onnxBool: 1}[p.dataType]
+			if len(raw) != width*n {
+				return nil, fmt.Errorf("tensor %s: %d bytes of raw data for %d values", p.name, len(raw), n)
+			}
+			for k := range t.i {
+				switch p.dataType {
+				case onnxInt64:
+					t.i[k] = int64(binary.LittleEndian.Uint64(raw[8*k:]))
+				case onnxInt32:
+					t.i[k] = int64(int32(binary.LittleEndian.Uint32(raw[4*k:])))
+				case onnxInt8:
+					t.i[k] = int64(int8(raw[k]))
+				default:
+					t.i[k] = int64(raw[k])
+				}
+			}
+		case p.dataType == onnxInt64 && len(p.int64Data) == n:
+			copy(t.i, p.int64Data)
+		case p.dataType != onnxInt64 && len(p.int32Data) == n:
+			for k, v := range p.int32Data {
+				t.i[k] = int64(int32(v))
+			}
+		default:
+			return nil, fmt.Errorf("tensor %s: missing data for shape %v", p.name, shape)
+		}
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("tensor %s: unsupported data type %d", p.name, p.dataType)
+}
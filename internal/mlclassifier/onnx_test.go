@@ -0,0 +1,340 @@
+package mlclassifier
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+)
+
+//go:generate go run testdata/gen_tiny_ner.go
+
+func loadTinyNER(t *testing.T) *ONNXRuntime {
+	t.Helper()
+	rt, err := NewONNXRuntime(ONNXConfig{ModelsDir: "testdata", NumThreads: 2}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewONNXRuntime: %v", err)
+	}
+	if err := rt.LoadModel("ner", "tiny_ner.onnx"); err != nil {
+		t.Fatalf("LoadModel: %v", err)
+	}
+	return rt
+}
+
+func runTinyNER(t *testing.T, rt *ONNXRuntime, ids, mask []int64, batch int) InferenceOutput {
+	t.Helper()
+	seq := int64(len(ids) / batch)
+	outputs, err := rt.RunInference(context.Background(), "ner", []InferenceInput{
+		{Name: "input_ids", Data: ids, Shape: []int64{int64(batch), seq}},
+		{Name: "attention_mask", Data: mask, Shape: []int64{int64(batch), seq}},
+	})
+	if err != nil {
+		t.Fatalf("RunInference: %v", err)
+	}
+	if len(outputs) != 1 {
+		t.Fatalf("expected 1 output, got %d", len(outputs))
+	}
+	return outputs[0]
+}
+
+func TestONNXRuntime_ModelInfo(t *testing.T) {
+	rt := loadTinyNER(t)
+	if !rt.IsAvailable() {
+		t.Fatal("expected runtime to be available")
+	}
+
+	info, err := rt.GetModelInfo("ner")
+	if err != nil {
+		t.Fatalf("GetModelInfo: %v", err)
+	}
+	if strings.Join(info.InputNames, ",") != "input_ids,attention_mask" {
+		t.Errorf("unexpected inputs %v", info.InputNames)
+	}
+	if strings.Join(info.OutputNames, ",") != "logits" {
+		t.Errorf("unexpected outputs %v", info.OutputNames)
+	}
+	if shape := info.InputShapes["input_ids"]; len(shape) != 2 || shape[0] != -1 || shape[1] != -1 {
+		t.Errorf("expected dynamic input shape, got %v", shape)
+	}
+	if shape := info.OutputShapes["logits"]; len(shape) != 3 || shape[2] != 3 {
+		t.Errorf("expected output shape [-1 -1 3], got %v", shape)
+	}
+	if info.Opset != 17 {
+		t.Errorf("expected opset 17, got %d", info.Opset)
+	}
+
+	if err := rt.LoadModel("ner", "tiny_ner.onnx"); err == nil {
+		t.Error("expected error loading a model name twice")
+	}
+}
+
+func TestONNXRuntime_TokenClassification(t *testing.T) {
+	rt := loadTinyNER(t)
+	labels := []string{"O", "B-PII", "I-PII"}
+
+	out := runTinyNER(t, rt, []int64{1, 2, 3, 3, 1, 5, 6, 7}, []int64{1, 1, 1, 1, 1, 1, 1, 1}, 1)
+	if len(out.Shape) != 3 || out.Shape[0] != 1 || out.Shape[1] != 8 || out.Shape[2] != 3 {
+		t.Fatalf("expected shape [1 8 3], got %v", out.Shape)
+	}
+
+	want := []string{"O", "B-PII", "I-PII", "I-PII", "O", "B-PII", "I-PII", "O"}
+	for pos := range want {
+		got := labels[Argmax(out.Data[pos*3:(pos+1)*3])]
+		if got != want[pos] {
+			t.Errorf("position %d: expected %s, got %s", pos, want[pos], got)
+		}
+	}
+}
+
+func TestONNXRuntime_BatchingAndPadding(t *testing.T) {
+	rt := loadTinyNER(t)
+
+	// The second sequence is padded to the first's length; masked positions
+	// must not change its logits
+	batched := runTinyNER(t, rt,
+		[]int64{1, 2, 3, 3, 1, 2, 3, 1, 0, 0},
+		[]int64{1, 1, 1, 1, 1, 1, 1, 1, 0, 0}, 2)
+	first := runTinyNER(t, rt, []int64{1, 2, 3, 3, 1}, []int64{1, 1, 1, 1, 1}, 1)
+	second := runTinyNER(t, rt, []int64{2, 3, 1}, []int64{1, 1, 1}, 1)
+
+	if len(batched.Shape) != 3 || batched.Shape[0] != 2 || batched.Shape[1] != 5 {
+		t.Fatalf("expected shape [2 5 3], got %v", batched.Shape)
+	}
+	if len(second.Shape) != 3 || second.Shape[1] != 3 {
+		t.Fatalf("expected dynamic sequence length 3, got %v", second.Shape)
+	}
+
+	assertClose(t, "first sequence", batched.Data[:15], first.Data)
+	assertClose(t, "second sequence", batched.Data[15:15+9], second.Data)
+}
+
+func TestONNXRuntime_InputValidation(t *testing.T) {
+	rt := loadTinyNER(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		inputs []InferenceInput
+		want   string
+	}{
+		{
+			name:   "missing input",
+			inputs: []InferenceInput{{Name: "input_ids", Data: []int64{1, 2}, Shape: []int64{1, 2}}},
+			want:   "missing input attention_mask",
+		},
+		{
+			name: "unknown input",
+			inputs: []InferenceInput{
+				{Name: "input_ids", Data: []int64{1}, Shape: []int64{1, 1}},
+				{Name: "token_type_ids", Data: []int64{0}, Shape: []int64{1, 1}},
+			},
+			want: "has no input token_type_ids",
+		},
+		{
+			name: "wrong rank",
+			inputs: []InferenceInput{
+				{Name: "input_ids", Data: []int64{1, 2}, Shape: []int64{2}},
+				{Name: "attention_mask", Data: []int64{1, 1}, Shape: []int64{2}},
+			},
+			want: "expected rank 2",
+		},
+		{
+			name: "shape mismatch",
+			inputs: []InferenceInput{
+				{Name: "input_ids", Data: []int64{1, 2, 3}, Shape: []int64{1, 2}},
+				{Name: "attention_mask", Data: []int64{1, 1}, Shape: []int64{1, 2}},
+			},
+			want: "do not fill shape",
+		},
+		{
+			name: "token out of vocabulary",
+			inputs: []InferenceInput{
+				{Name: "input_ids", Data: []int32{1, 99}, Shape: []int64{1, 2}},
+				{Name: "attention_mask", Data: []int32{1, 1}, Shape: []int64{1, 2}},
+			},
+			want: "out of range",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := rt.RunInference(ctx, "ner", tt.inputs)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if _, err := rt.RunInference(ctx, "missing", nil); err == nil {
+		t.Error("expected error for a model that is not loaded")
+	}
+}
+
+func TestONNXGraph_RejectsUnsupportedOperators(t *testing.T) {
+	model := &onnxModelProto{
+		opsets: map[string]int64{"": 17},
+		graph: &onnxGraphProto{
+			nodes: []*onnxNode{
+				{opType: "Conv", inputs: []string{"x"}, outputs: []string{"y"}},
+				{opType: "Relu", inputs: []string{"y"}, outputs: []string{"z"}},
+				{opType: "FusedGemm", domain: "com.microsoft", inputs: []string{"z"}, outputs: []string{"w"}},
+			},
+			outputs: []onnxValueInfo{{name: "w"}},
+		},
+	}
+	_, err := newONNXGraph(model, 1)
+	if err == nil || !strings.Contains(err.Error(), "Conv, com.microsoft.FusedGemm") {
+		t.Errorf("expected unsupported operator error, got %v", err)
+	}
+}
+
+func TestONNXOps(t *testing.T) {
+	ec := &execContext{opset: 17, threads: 1}
+	floats := func(shape []int, values ...float32) *tensor {
+		return &tensor{dtype: onnxFloat, shape: shape, f: values}
+	}
+	ints := func(shape []int, values ...int64) *tensor {
+		return &tensor{dtype: onnxInt64, shape: shape, i: values}
+	}
+
+	tests := []struct {
+		name  string
+		op    string
+		attrs map[string]*onnxAttribute
+		in    []*tensor
+		shape []int
+		want  []float32
+	}{
+		{
+			name:  "broadcast add",
+			op:    "Add",
+			in:    []*tensor{floats([]int{2, 2}, 1, 2, 3, 4), floats([]int{2}, 10, 20)},
+			shape: []int{2, 2},
+			want:  []float32{11, 22, 13, 24},
+		},
+		{
+			name:  "batched matmul with shared weights",
+			op:    "MatMul",
+			in:    []*tensor{floats([]int{2, 1, 2}, 1, 2, 3, 4), floats([]int{2, 2}, 1, 0, 1, 1)},
+			shape: []int{2, 1, 2},
+			want:  []float32{3, 2, 7, 4},
+		},
+		{
+			name:  "matmul vector",
+			op:    "MatMul",
+			in:    []*tensor{floats([]int{2}, 1, 2), floats([]int{2, 3}, 1, 2, 3, 4, 5, 6)},
+			shape: []int{3},
+			want:  []float32{9, 12, 15},
+		},
+		{
+			name:  "gemm transposed",
+			op:    "Gemm",
+			attrs: map[string]*onnxAttribute{"transB": {i: 1}},
+			in:    []*tensor{floats([]int{1, 2}, 1, 2), floats([]int{2, 2}, 1, 2, 3, 4), floats([]int{2}, 1, 1)},
+			shape: []int{1, 2},
+			want:  []float32{6, 12},
+		},
+		{
+			name:  "softmax last axis",
+			op:    "Softmax",
+			in:    []*tensor{floats([]int{1, 2}, 0, float32(math.Log(3)))},
+			shape: []int{1, 2},
+			want:  []float32{0.25, 0.75},
+		},
+		{
+			name:  "layer norm",
+			op:    "LayerNormalization",
+			attrs: map[string]*onnxAttribute{"epsilon": {f: 0}},
+			in:    []*tensor{floats([]int{1, 2}, 1, 3), floats([]int{2}, 1, 2), floats([]int{2}, 0, 1)},
+			shape: []int{1, 2},
+			want:  []float32{-1, 3},
+		},
+		{
+			name:  "gather rows",
+			op:    "Gather",
+			in:    []*tensor{floats([]int{3, 2}, 1, 2, 3, 4, 5, 6), ints([]int{2}, 2, -3)},
+			shape: []int{2, 2},
+			want:  []float32{5, 6, 1, 2},
+		},
+		{
+			name:  "transpose",
+			op:    "Transpose",
+			attrs: map[string]*onnxAttribute{"perm": {ints: []int64{1, 0}}},
+			in:    []*tensor{floats([]int{2, 3}, 1, 2, 3, 4, 5, 6)},
+			shape: []int{3, 2},
+			want:  []float32{1, 4, 2, 5, 3, 6},
+		},
+		{
+			name:  "reshape with inferred and copied dims",
+			op:    "Reshape",
+			in:    []*tensor{floats([]int{2, 3, 2}, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12), ints([]int{3}, 0, -1, 3)},
+			shape: []int{2, 2, 3},
+			want:  []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		},
+		{
+			name:  "slice with negative step",
+			op:    "Slice",
+			in:    []*tensor{floats([]int{5}, 1, 2, 3, 4, 5), ints([]int{1}, -1), ints([]int{1}, 0), ints([]int{1}, 0), ints([]int{1}, -2)},
+			shape: []int{2},
+			want:  []float32{5, 3},
+		},
+		{
+			name:  "reduce mean keepdims",
+			op:    "ReduceMean",
+			attrs: map[string]*onnxAttribute{"axes": {ints: []int64{-1}}},
+			in:    []*tensor{floats([]int{2, 2}, 1, 3, 5, 9)},
+			shape: []int{2, 1},
+			want:  []float32{2, 7},
+		},
+		{
+			name:  "concat",
+			op:    "Concat",
+			attrs: map[string]*onnxAttribute{"axis": {i: 1}},
+			in:    []*tensor{floats([]int{2, 1}, 1, 2), floats([]int{2, 2}, 3, 4, 5, 6)},
+			shape: []int{2, 3},
+			want:  []float32{1, 3, 4, 2, 5, 6},
+		},
+		{
+			name:  "where",
+			op:    "Where",
+			in:    []*tensor{{dtype: onnxBool, shape: []int{2}, i: []int64{1, 0}}, floats([]int{2}, 1, 2), floats([]int{}, -1)},
+			shape: []int{2},
+			want:  []float32{1, -1},
+		},
+		{
+			name:  "erf gelu",
+			op:    "Gelu",
+			in:    []*tensor{floats([]int{2}, 0, 1)},
+			shape: []int{2},
+			want:  []float32{0, 0.8413447},
+		},
+	}
+
+	for _, tt := range tests {
+		node := &onnxNode{opType: tt.op, attrs: tt.attrs}
+		out, err := onnxOps[tt.op](ec, node, tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !shapesEqual(out[0].shape, tt.shape) {
+			t.Errorf("%s: expected shape %v, got %v", tt.name, tt.shape, out[0].shape)
+			continue
+		}
+		assertClose(t, tt.name, out[0].floats(), tt.want)
+	}
+}
+
+func assertClose(t *testing.T, name string, got, want []float32) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: expected %d values, got %d", name, len(want), len(got))
+		return
+	}
+	for k := range want {
+		if math.Abs(float64(got[k]-want[k])) > 1e-5 {
+			t.Errorf("%s: value %d: expected %v, got %v", name, k, want[k], got[k])
+			return
+		}
+	}
+}
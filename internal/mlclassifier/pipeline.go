@@ -0,0 +1,181 @@
+package mlclassifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/classifier"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Scorer model registered for predictions made during scans
+const (
+	scanScorerName    = "heuristic-confidence-scorer"
+	scanScorerVersion = "1.0.0"
+)
+
+// PredictionTypeConfidence labels predictions that adjust a regex match's confidence
+const PredictionTypeConfidence = "CONFIDENCE_ADJUSTMENT"
+
+// EnhanceScanMatches scores the regex matches of one scanned object. The text
+// given to the ML signals is built from the matches' redacted sample context, so
+// raw values never leave the scanner. Matches without samples (suppressed
+// categories) are scored with neutral context.
+func (s *Service) EnhanceScanMatches(ctx context.Context, objectPath string, matches []classifier.Match) (*MLResult, error) {
+	var content strings.Builder
+	content.WriteString(objectPath)
+	content.WriteString("\n")
+
+	enhanced := make([]EnhancedMatch, 0, len(matches))
+	for _, m := range matches {
+		for _, sample := range m.SampleMatches {
+			content.WriteString(sample.Context)
+			content.WriteString("\n")
+		}
+		value := m.Value
+		if value == "" && len(m.SampleMatches) > 0 {
+			value = m.SampleMatches[0].MaskedValue
+		}
+		enhanced = append(enhanced, EnhancedMatch{
+			RuleName:        m.RuleName,
+			Category:        m.Category,
+			Sensitivity:     m.Sensitivity,
+			Value:           value,
+			Count:           m.Count,
+			LineNumbers:     m.LineNumbers,
+			RegexConfidence: m.Confidence,
+		})
+	}
+
+	return s.EnhanceClassification(ctx, content.String(), enhanced)
+}
+
+// RecordScanPredictions stores a prediction for each enhanced match and queues
+// matches for review according to the configured ConfidenceThresholds.
+// classificationIDs[i] is the saved classification for result.Matches[i].
+func (s *Service) RecordScanPredictions(ctx context.Context, result *MLResult, classificationIDs []uuid.UUID) error {
+	if len(classificationIDs) != len(result.Matches) {
+		return fmt.Errorf("got %d classification IDs for %d matches", len(classificationIDs), len(result.Matches))
+	}
+
+	modelID, err := s.scanScorerModel(ctx)
+	if err != nil {
+		return fmt.Errorf("registering scorer model: %w", err)
+	}
+
+	conflicting := len(result.Matches) > 1 && s.hasConflictingTypes(result.Matches)
+
+	for i, match := range result.Matches {
+		classificationID := classificationIDs[i]
+		if classificationID == uuid.Nil {
+			continue
+		}
+
+		status, reason := s.reviewDecision(match, conflicting)
+
+		label := string(match.Category)
+		if match.EntityType != "" {
+			label = match.EntityType
+		}
+		raw := models.JSONB{
+			"rule_name":        match.RuleName,
+			"regex_confidence": match.RegexConfidence,
+			"ml_confidence":    match.MLConfidence,
+			"context_score":    match.ContextScore,
+		}
+		if result.DocumentType != nil {
+			raw["document_type"] = result.DocumentType.Type
+		}
+		if reason != "" {
+			raw["review_reason"] = reason
+		}
+
+		prediction := &models.MLPrediction{
+			ID:                   uuid.New(),
+			ClassificationID:     classificationID,
+			ModelID:              modelID,
+			PredictionType:       PredictionTypeConfidence,
+			PredictedLabel:       label,
+			ConfidenceScore:      match.CombinedConfidence,
+			CalibratedConfidence: match.CalibratedConfidence,
+			RawOutput:            raw,
+			ReviewStatus:         status,
+			CreatedAt:            time.Now(),
+		}
+		if err := s.store.CreateMLPrediction(ctx, prediction); err != nil {
+			return fmt.Errorf("saving prediction for %s: %w", match.RuleName, err)
+		}
+		s.recordShadowScores(ctx, prediction.ID, match)
+
+		// The queue keeps the raw confidence, which calibration is fitted on
+		if reason != "" {
+			if err := s.QueueForReview(ctx, classificationID, &prediction.ID, reason, match.CombinedConfidence); err != nil {
+				return fmt.Errorf("queueing %s for review: %w", match.RuleName, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// reviewDecision maps a match's decision confidence onto the thresholds.
+// Confident matches are approved and very weak ones rejected without review;
+// everything in between, and any match in a conflicting result, is queued.
+func (s *Service) reviewDecision(match EnhancedMatch, conflicting bool) (models.ReviewStatus, string) {
+	thresholds := s.config.Thresholds
+	confidence := match.DecisionConfidence()
+
+	switch {
+	case conflicting:
+		return models.ReviewStatusPending, "CONFLICTING_PREDICTIONS"
+	case confidence >= thresholds.AutoApprove:
+		return models.ReviewStatusApproved, ""
+	case confidence < thresholds.AutoReject:
+		return models.ReviewStatusRejected, ""
+	case match.Sensitivity == models.SensitivityCritical:
+		return models.ReviewStatusPending, "SENSITIVE_DATA"
+	default:
+		return models.ReviewStatusPending, "LOW_CONFIDENCE"
+	}
+}
+
+// scanScorerModel returns the ID of the default confidence scorer model,
+// registering the built-in heuristic scorer the first time it is needed
+func (s *Service) scanScorerModel(ctx context.Context) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scorerModelID != uuid.Nil {
+		return s.scorerModelID, nil
+	}
+
+	model, err := s.store.GetDefaultMLModel(ctx, models.MLModelConfidenceScorer)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if model == nil {
+		now := time.Now()
+		model = &models.MLModel{
+			ID:          uuid.New(),
+			Name:        scanScorerName,
+			ModelType:   models.MLModelConfidenceScorer,
+			Version:     scanScorerVersion,
+			Description: "Weighted pattern, context, frequency and NER signals",
+			Framework:   "builtin",
+			Config:      models.JSONB{},
+			Status:      models.MLModelStatusActive,
+			IsDefault:   true,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := s.store.CreateMLModel(ctx, model); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	s.scorerModelID = model.ID
+	return model.ID, nil
+}
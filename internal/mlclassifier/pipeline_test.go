@@ -0,0 +1,543 @@
+package mlclassifier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/classifier"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// memStore is an in-memory Store for tests
+type memStore struct {
+	models             map[uuid.UUID]*models.MLModel
+	predictions        map[uuid.UUID]*models.MLPrediction
+	reviewQueue        []*models.ClassificationReviewQueue
+	calibrationSamples []*models.CalibrationSample
+	feedback           []*models.TrainingFeedback
+	shadowResults      []*models.MLShadowResult
+	classifications    map[uuid.UUID]*models.Classification
+	assets             map[uuid.UUID]*models.DataAsset
+	routingRules       []*models.ReviewRoutingRule
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		models:          make(map[uuid.UUID]*models.MLModel),
+		predictions:     make(map[uuid.UUID]*models.MLPrediction),
+		classifications: make(map[uuid.UUID]*models.Classification),
+		assets:          make(map[uuid.UUID]*models.DataAsset),
+	}
+}
+
+func (m *memStore) CreateMLModel(ctx context.Context, model *models.MLModel) error {
+	if model.ID == uuid.Nil {
+		model.ID = uuid.New()
+	}
+	copied := *model
+	m.models[model.ID] = &copied
+	return nil
+}
+
+func (m *memStore) UpdateMLModel(ctx context.Context, model *models.MLModel) error {
+	if _, ok := m.models[model.ID]; !ok {
+		return fmt.Errorf("model not found: %s", model.ID)
+	}
+	copied := *model
+	m.models[model.ID] = &copied
+	return nil
+}
+
+func (m *memStore) GetMLModel(ctx context.Context, id uuid.UUID) (*models.MLModel, error) {
+	model, ok := m.models[id]
+	if !ok {
+		return nil, fmt.Errorf("model not found: %s", id)
+	}
+	copied := *model
+	return &copied, nil
+}
+
+func (m *memStore) GetDefaultMLModel(ctx context.Context, modelType models.MLModelType) (*models.MLModel, error) {
+	for _, model := range m.models {
+		if model.ModelType == modelType && model.IsDefault && model.Status == models.MLModelStatusActive {
+			copied := *model
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memStore) ListMLModels(ctx context.Context) ([]*models.MLModel, error) {
+	var result []*models.MLModel
+	for _, model := range m.models {
+		copied := *model
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (m *memStore) ReplaceActiveMLModel(ctx context.Context, next, previous *models.MLModel) error {
+	if previous != nil {
+		if err := m.UpdateMLModel(ctx, previous); err != nil {
+			return err
+		}
+	}
+	return m.UpdateMLModel(ctx, next)
+}
+
+func (m *memStore) CreateShadowResult(ctx context.Context, result *models.MLShadowResult) error {
+	copied := *result
+	m.shadowResults = append(m.shadowResults, &copied)
+	return nil
+}
+
+func (m *memStore) ListShadowResults(ctx context.Context, shadowModelID uuid.UUID) ([]*models.MLShadowResult, error) {
+	var result []*models.MLShadowResult
+	for _, r := range m.shadowResults {
+		if r.ShadowModelID == shadowModelID {
+			copied := *r
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (m *memStore) CreateMLPrediction(ctx context.Context, prediction *models.MLPrediction) error {
+	copied := *prediction
+	m.predictions[prediction.ID] = &copied
+	return nil
+}
+
+func (m *memStore) UpdateMLPrediction(ctx context.Context, prediction *models.MLPrediction) error {
+	copied := *prediction
+	m.predictions[prediction.ID] = &copied
+	return nil
+}
+
+func (m *memStore) GetMLPrediction(ctx context.Context, id uuid.UUID) (*models.MLPrediction, error) {
+	prediction, ok := m.predictions[id]
+	if !ok {
+		return nil, fmt.Errorf("prediction not found: %s", id)
+	}
+	return prediction, nil
+}
+
+func (m *memStore) ListMLPredictionsByClassification(ctx context.Context, classificationID uuid.UUID) ([]*models.MLPrediction, error) {
+	var result []*models.MLPrediction
+	for _, p := range m.predictions {
+		if p.ClassificationID == classificationID {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (m *memStore) CreateReviewQueueItem(ctx context.Context, item *models.ClassificationReviewQueue) error {
+	m.reviewQueue = append(m.reviewQueue, item)
+	return nil
+}
+
+func (m *memStore) UpdateReviewQueueItem(ctx context.Context, item *models.ClassificationReviewQueue) error {
+	for i, existing := range m.reviewQueue {
+		if existing.ID == item.ID {
+			m.reviewQueue[i] = item
+			return nil
+		}
+	}
+	return fmt.Errorf("review item not found: %s", item.ID)
+}
+
+func (m *memStore) GetReviewQueueItem(ctx context.Context, id uuid.UUID) (*models.ClassificationReviewQueue, error) {
+	for _, item := range m.reviewQueue {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return nil, fmt.Errorf("review item not found: %s", id)
+}
+
+func (m *memStore) GetOpenReviewQueueItem(ctx context.Context, classificationID uuid.UUID) (*models.ClassificationReviewQueue, error) {
+	for _, item := range m.reviewQueue {
+		if item.ClassificationID == classificationID &&
+			(item.Status == models.ReviewQueueStatusPending || item.Status == models.ReviewQueueStatusInReview) {
+			return item, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memStore) ListReviewQueue(ctx context.Context, status models.ReviewQueueStatus, limit int) ([]*models.ClassificationReviewQueue, error) {
+	var result []*models.ClassificationReviewQueue
+	for _, item := range m.reviewQueue {
+		if item.Status == status {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (m *memStore) GetReviewQueueStats(ctx context.Context) (map[string]int, error) {
+	stats := make(map[string]int)
+	for _, item := range m.reviewQueue {
+		stats[string(item.Status)]++
+	}
+	return stats, nil
+}
+
+func (m *memStore) CreateCalibrationSample(ctx context.Context, sample *models.CalibrationSample) error {
+	m.calibrationSamples = append(m.calibrationSamples, sample)
+	return nil
+}
+
+// ListCalibrationSamples returns the most recently recorded samples first
+func (m *memStore) ListCalibrationSamples(ctx context.Context, limit int) ([]*models.CalibrationSample, error) {
+	var result []*models.CalibrationSample
+	for i := len(m.calibrationSamples) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, m.calibrationSamples[i])
+	}
+	return result, nil
+}
+
+func (m *memStore) GetReviewSubject(ctx context.Context, classificationID uuid.UUID, ownerTag string) (*models.ReviewSubject, error) {
+	classification, ok := m.classifications[classificationID]
+	if !ok {
+		return nil, nil
+	}
+	asset, ok := m.assets[classification.AssetID]
+	if !ok {
+		return nil, nil
+	}
+	owner, _ := asset.Tags[ownerTag].(string)
+	return &models.ReviewSubject{
+		RuleName:   classification.RuleName,
+		Category:   classification.Category,
+		ObjectPath: classification.ObjectPath,
+		AssetID:    asset.ID,
+		AssetName:  asset.Name,
+		AccountID:  asset.AccountID,
+		DataOwner:  owner,
+	}, nil
+}
+
+func (m *memStore) openEntries(ctx context.Context, ownerTag string, keep func(*models.ClassificationReviewQueue, *models.ReviewSubject) bool) []*models.ReviewQueueEntry {
+	var result []*models.ReviewQueueEntry
+	for _, item := range m.reviewQueue {
+		if item.Status != models.ReviewQueueStatusPending && item.Status != models.ReviewQueueStatusInReview {
+			continue
+		}
+		subject, _ := m.GetReviewSubject(ctx, item.ClassificationID, ownerTag)
+		if subject == nil || !keep(item, subject) {
+			continue
+		}
+		result = append(result, &models.ReviewQueueEntry{ClassificationReviewQueue: *item, ReviewSubject: *subject})
+	}
+	return result
+}
+
+func (m *memStore) ListOpenReviewEntries(ctx context.Context, ruleName, ownerTag string, limit int) ([]*models.ReviewQueueEntry, error) {
+	result := m.openEntries(ctx, ownerTag, func(_ *models.ClassificationReviewQueue, subject *models.ReviewSubject) bool {
+		return subject.RuleName == ruleName
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (m *memStore) ListOverdueReviewEntries(ctx context.Context, now time.Time, ownerTag string, limit int) ([]*models.ReviewQueueEntry, error) {
+	result := m.openEntries(ctx, ownerTag, func(item *models.ClassificationReviewQueue, _ *models.ReviewSubject) bool {
+		return item.EscalatedAt == nil && item.DueBy != nil && item.DueBy.Before(now)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (m *memStore) ListReviewItemsReviewedSince(ctx context.Context, since time.Time) ([]*models.ClassificationReviewQueue, error) {
+	var result []*models.ClassificationReviewQueue
+	for _, item := range m.reviewQueue {
+		if (item.ResolvedAt != nil && !item.ResolvedAt.Before(since)) || (item.FirstResolvedAt != nil && !item.FirstResolvedAt.Before(since)) {
+			copied := *item
+			result = append(result, &copied)
+		}
+	}
+	return result, nil
+}
+
+func (m *memStore) ListReviewerWorkloads(ctx context.Context, now time.Time) ([]*models.ReviewerWorkload, error) {
+	byReviewer := make(map[uuid.UUID]*models.ReviewerWorkload)
+	var result []*models.ReviewerWorkload
+	for _, item := range m.reviewQueue {
+		if item.AssignedTo == nil || (item.Status != models.ReviewQueueStatusPending && item.Status != models.ReviewQueueStatusInReview) {
+			continue
+		}
+		w, ok := byReviewer[*item.AssignedTo]
+		if !ok {
+			w = &models.ReviewerWorkload{ReviewerID: *item.AssignedTo}
+			byReviewer[*item.AssignedTo] = w
+			result = append(result, w)
+		}
+		w.Open++
+		if item.DueBy != nil && item.DueBy.Before(now) {
+			w.Overdue++
+		}
+	}
+	return result, nil
+}
+
+func (m *memStore) CreateReviewRoutingRule(ctx context.Context, rule *models.ReviewRoutingRule) error {
+	if rule.ID == uuid.Nil {
+		rule.ID = uuid.New()
+	}
+	copied := *rule
+	m.routingRules = append(m.routingRules, &copied)
+	return nil
+}
+
+func (m *memStore) ListReviewRoutingRules(ctx context.Context) ([]*models.ReviewRoutingRule, error) {
+	var result []*models.ReviewRoutingRule
+	for _, rule := range m.routingRules {
+		copied := *rule
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (m *memStore) DeleteReviewRoutingRule(ctx context.Context, id uuid.UUID) error {
+	for i, rule := range m.routingRules {
+		if rule.ID == id {
+			m.routingRules = append(m.routingRules[:i], m.routingRules[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *memStore) CreateTrainingFeedback(ctx context.Context, feedback *models.TrainingFeedback) error {
+	m.feedback = append(m.feedback, feedback)
+	return nil
+}
+
+func (m *memStore) ListTrainingFeedback(ctx context.Context, modelID uuid.UUID, incorporated bool) ([]*models.TrainingFeedback, error) {
+	var result []*models.TrainingFeedback
+	for _, f := range m.feedback {
+		if f.ModelID != nil && *f.ModelID == modelID && f.IncorporatedInTraining == incorporated {
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+func (m *memStore) ListFeedbackForPredictions(ctx context.Context, predictionIDs []uuid.UUID) ([]*models.TrainingFeedback, error) {
+	ids := make(map[uuid.UUID]bool, len(predictionIDs))
+	for _, id := range predictionIDs {
+		ids[id] = true
+	}
+	var result []*models.TrainingFeedback
+	for _, f := range m.feedback {
+		if f.PredictionID != nil && ids[*f.PredictionID] {
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+func (m *memStore) MarkFeedbackIncorporated(ctx context.Context, feedbackIDs []uuid.UUID, trainingRunID string) error {
+	ids := make(map[uuid.UUID]bool, len(feedbackIDs))
+	for _, id := range feedbackIDs {
+		ids[id] = true
+	}
+	for _, f := range m.feedback {
+		if ids[f.ID] {
+			f.IncorporatedInTraining = true
+			f.TrainingRunID = trainingRunID
+		}
+	}
+	return nil
+}
+
+func (m *memStore) GetClassification(ctx context.Context, id uuid.UUID) (*models.Classification, error) {
+	c, ok := m.classifications[id]
+	if !ok {
+		return nil, fmt.Errorf("classification not found: %s", id)
+	}
+	return c, nil
+}
+
+func (m *memStore) UpdateClassificationConfidence(ctx context.Context, id uuid.UUID, confidence float64, validated bool) error {
+	c, ok := m.classifications[id]
+	if !ok {
+		return fmt.Errorf("classification not found: %s", id)
+	}
+	c.ConfidenceScore = confidence
+	c.Validated = validated
+	return nil
+}
+
+func TestRecordScanPredictions_QueuesByThreshold(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	config := DefaultClassifierConfig()
+	config.Thresholds.AutoApprove = 0.75
+	svc := NewServiceWithConfig(store, config)
+
+	c := classifier.New()
+	strong := c.Classify("Patient record\nPatient SSN: 123-45-6789\nPatient SSN: 234-56-7890")
+	weak := c.Classify("sample test data 123-45-6789")
+
+	for _, tc := range []struct {
+		name       string
+		matches    []classifier.Match
+		wantQueued bool
+	}{
+		{"strong context", strong.Matches, false},
+		{"test data", weak.Matches, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			queued := len(store.reviewQueue)
+
+			result, err := svc.EnhanceScanMatches(ctx, "exports/people.csv", tc.matches)
+			if err != nil {
+				t.Fatalf("EnhanceScanMatches: %v", err)
+			}
+			ids := make([]uuid.UUID, len(result.Matches))
+			for i := range ids {
+				ids[i] = uuid.New()
+			}
+			if err := svc.RecordScanPredictions(ctx, result, ids); err != nil {
+				t.Fatalf("RecordScanPredictions: %v", err)
+			}
+
+			for i, id := range ids {
+				predictions, _ := store.ListMLPredictionsByClassification(ctx, id)
+				if len(predictions) != 1 {
+					t.Fatalf("expected 1 prediction for match %d, got %d", i, len(predictions))
+				}
+				if predictions[0].ConfidenceScore != result.Matches[i].CombinedConfidence {
+					t.Errorf("expected prediction confidence %v, got %v", result.Matches[i].CombinedConfidence, predictions[0].ConfidenceScore)
+				}
+			}
+
+			if got := len(store.reviewQueue) > queued; got != tc.wantQueued {
+				t.Errorf("expected queued=%v (confidence %v)", tc.wantQueued, result.Matches[0].CombinedConfidence)
+			}
+		})
+	}
+
+	// The scorer model is registered once and reused
+	if len(store.models) != 1 {
+		t.Errorf("expected one registered scorer model, got %d", len(store.models))
+	}
+	for _, p := range store.predictions {
+		if _, ok := store.models[p.ModelID]; !ok {
+			t.Errorf("prediction references unknown model %s", p.ModelID)
+		}
+	}
+}
+
+func TestReviewDecision(t *testing.T) {
+	svc := NewService(newMemStore())
+
+	tests := []struct {
+		name        string
+		confidence  float64
+		sensitivity models.Sensitivity
+		conflicting bool
+		wantStatus  models.ReviewStatus
+		wantReason  string
+	}{
+		{"confident", 0.9, models.SensitivityHigh, false, models.ReviewStatusApproved, ""},
+		{"very weak", 0.1, models.SensitivityHigh, false, models.ReviewStatusRejected, ""},
+		{"uncertain", 0.6, models.SensitivityHigh, false, models.ReviewStatusPending, "LOW_CONFIDENCE"},
+		{"uncertain critical", 0.6, models.SensitivityCritical, false, models.ReviewStatusPending, "SENSITIVE_DATA"},
+		{"conflicting", 0.9, models.SensitivityHigh, true, models.ReviewStatusPending, "CONFLICTING_PREDICTIONS"},
+	}
+
+	for _, tt := range tests {
+		match := EnhancedMatch{CombinedConfidence: tt.confidence, Sensitivity: tt.sensitivity}
+		status, reason := svc.reviewDecision(match, tt.conflicting)
+		if status != tt.wantStatus || reason != tt.wantReason {
+			t.Errorf("%s: expected %s/%q, got %s/%q", tt.name, tt.wantStatus, tt.wantReason, status, reason)
+		}
+	}
+}
+
+func TestRecordScanPredictions_SkipsUnsavedClassifications(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+
+	matches := classifier.New().Classify("SSN 123-45-6789\ncard 4532015112830366").Matches
+	result, err := svc.EnhanceScanMatches(ctx, "notes.txt", matches)
+	if err != nil {
+		t.Fatalf("EnhanceScanMatches: %v", err)
+	}
+	if len(result.Matches) < 2 {
+		t.Fatalf("expected at least 2 matches, got %d", len(result.Matches))
+	}
+
+	if err := svc.RecordScanPredictions(ctx, result, []uuid.UUID{uuid.New()}); err == nil {
+		t.Error("expected an error for mismatched classification IDs")
+	}
+
+	ids := make([]uuid.UUID, len(result.Matches))
+	ids[0] = uuid.New()
+	if err := svc.RecordScanPredictions(ctx, result, ids); err != nil {
+		t.Fatalf("RecordScanPredictions: %v", err)
+	}
+	if len(store.predictions) != 1 {
+		t.Errorf("expected 1 prediction, got %d", len(store.predictions))
+	}
+	for _, item := range store.reviewQueue {
+		if item.ClassificationID != ids[0] {
+			t.Errorf("unexpected review item for classification %s", item.ClassificationID)
+		}
+	}
+}
+
+func TestRecordScanPredictions_QueuesOncePerClassification(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+
+	matches := classifier.New().Classify("sample test data 123-45-6789").Matches
+	result, err := svc.EnhanceScanMatches(ctx, "exports/people.csv", matches)
+	if err != nil {
+		t.Fatalf("EnhanceScanMatches: %v", err)
+	}
+	ids := make([]uuid.UUID, len(result.Matches))
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+
+	if err := svc.RecordScanPredictions(ctx, result, ids); err != nil {
+		t.Fatalf("RecordScanPredictions: %v", err)
+	}
+	queued := len(store.reviewQueue)
+	if queued == 0 {
+		t.Fatal("expected the test data match to be queued")
+	}
+
+	// A rescan scoring the same classifications again leaves one open item each
+	if err := svc.RecordScanPredictions(ctx, result, ids); err != nil {
+		t.Fatalf("RecordScanPredictions: %v", err)
+	}
+	if len(store.reviewQueue) != queued {
+		t.Fatalf("expected %d review items after the rescan, got %d", queued, len(store.reviewQueue))
+	}
+
+	// Once resolved, a classification can be queued again
+	for _, item := range store.reviewQueue {
+		item.Status = models.ReviewQueueStatusResolved
+	}
+	if err := svc.RecordScanPredictions(ctx, result, ids); err != nil {
+		t.Fatalf("RecordScanPredictions: %v", err)
+	}
+	if len(store.reviewQueue) != 2*queued {
+		t.Errorf("expected %d review items after resolution, got %d", 2*queued, len(store.reviewQueue))
+	}
+}
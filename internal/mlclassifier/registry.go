@@ -0,0 +1,374 @@
+package mlclassifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/models"
+)
+
+var (
+	ErrModelNotFound     = errors.New("model not found")
+	ErrInvalidTransition = errors.New("invalid model lifecycle transition")
+	ErrPromotionBlocked  = errors.New("promotion gate not passed")
+	ErrNoPreviousVersion = errors.New("no previous version to roll back to")
+)
+
+// PromotionGate decides when a shadow model may replace the active model.
+// Shadow precision and recall on reviewer-labeled matches must each beat the
+// active model's by Margin; a metric the active model already scores 1.0 on
+// only has to be matched.
+type PromotionGate struct {
+	MinLabeled int     `json:"min_labeled"`
+	Margin     float64 `json:"margin"`
+}
+
+// DefaultPromotionGate returns the default promotion requirements
+func DefaultPromotionGate() PromotionGate {
+	return PromotionGate{
+		MinLabeled: 20,
+		Margin:     0.02,
+	}
+}
+
+// ModelMetrics are a model's scores on reviewer-labeled matches, treating a
+// confirmed match as the positive class
+type ModelMetrics struct {
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+}
+
+// ShadowEvaluation compares a shadow model with the active model on the
+// matches both scored
+type ShadowEvaluation struct {
+	ShadowModelID uuid.UUID     `json:"shadow_model_id"`
+	ActiveModelID *uuid.UUID    `json:"active_model_id,omitempty"`
+	Compared      int           `json:"compared"`   // Matches scored by both models
+	Agreement     float64       `json:"agreement"`  // Share of compared matches given the same decision
+	MeanDelta     float64       `json:"mean_delta"` // Mean shadow minus active confidence
+	Labeled       int           `json:"labeled"`    // Compared matches with reviewer feedback
+	Active        ModelMetrics  `json:"active"`
+	Shadow        ModelMetrics  `json:"shadow"`
+	Gate          PromotionGate `json:"gate"`
+	Passed        bool          `json:"passed"`
+	Reasons       []string      `json:"reasons,omitempty"` // Why the gate was not passed
+}
+
+// PromotionGate returns the configured promotion requirements
+func (s *Service) PromotionGate() PromotionGate {
+	return s.config.Promotion
+}
+
+// shadowScoringTypes are the model types the service can score in shadow
+var shadowScoringTypes = map[models.MLModelType]bool{
+	models.MLModelFeedbackFilter: true,
+}
+
+// recordShadowScores stores the shadow scores of a recorded match. Shadow
+// models must not affect scan results, so failures are dropped.
+func (s *Service) recordShadowScores(ctx context.Context, predictionID uuid.UUID, match EnhancedMatch) {
+	for _, score := range match.shadow {
+		_ = s.store.CreateShadowResult(ctx, &models.MLShadowResult{
+			ID:               uuid.New(),
+			ShadowModelID:    score.modelID,
+			ActiveModelID:    score.activeModelID,
+			PredictionID:     predictionID,
+			ShadowConfidence: score.confidence,
+			ActiveConfidence: match.CombinedConfidence,
+			CreatedAt:        time.Now(),
+		})
+	}
+}
+
+func (s *Service) getModel(ctx context.Context, id uuid.UUID) (*models.MLModel, error) {
+	model, err := s.store.GetMLModel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, id)
+	}
+	return model, nil
+}
+
+// ShadowModel starts scoring a candidate or retired model alongside the
+// active model of its type
+func (s *Service) ShadowModel(ctx context.Context, id uuid.UUID) (*models.MLModel, error) {
+	model, err := s.getModel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !shadowScoringTypes[model.ModelType] {
+		return nil, fmt.Errorf("%w: shadow scoring is not supported for %s models", ErrInvalidTransition, model.ModelType)
+	}
+	switch model.Status {
+	case models.MLModelStatusShadow:
+		return model, nil
+	case models.MLModelStatusCandidate, models.MLModelStatusRetired:
+	default:
+		return nil, fmt.Errorf("%w: cannot shadow a %s model", ErrInvalidTransition, model.Status)
+	}
+
+	model.Status = models.MLModelStatusShadow
+	model.IsDefault = false
+	model.RetiredAt = nil
+	if err := s.store.UpdateMLModel(ctx, model); err != nil {
+		return nil, err
+	}
+	s.loadFeedbackFilters(ctx)
+	return model, nil
+}
+
+// EvaluateShadow compares a shadow model's recorded scores with the active
+// model's. A match counts as kept by a model when its confidence reaches the
+// RequireReview threshold; reviewer feedback on the match's prediction is the
+// label, with the latest feedback winning.
+func (s *Service) EvaluateShadow(ctx context.Context, id uuid.UUID, gate PromotionGate) (*ShadowEvaluation, error) {
+	model, err := s.getModel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if model.Status != models.MLModelStatusShadow {
+		return nil, fmt.Errorf("%w: model %s is %s, not shadow", ErrInvalidTransition, model.Version, model.Status)
+	}
+	active, err := s.store.GetDefaultMLModel(ctx, model.ModelType)
+	if err != nil {
+		return nil, err
+	}
+
+	eval := &ShadowEvaluation{ShadowModelID: model.ID, Gate: gate}
+	if active != nil {
+		eval.ActiveModelID = &active.ID
+	}
+
+	results, err := s.store.ListShadowResults(ctx, model.ID)
+	if err != nil {
+		return nil, fmt.Errorf("listing shadow results: %w", err)
+	}
+	// Only scores recorded against the current active model are comparable
+	compared := results[:0]
+	for _, r := range results {
+		if sameModel(r.ActiveModelID, eval.ActiveModelID) {
+			compared = append(compared, r)
+		}
+	}
+
+	predictionIDs := make([]uuid.UUID, len(compared))
+	for i, r := range compared {
+		predictionIDs[i] = r.PredictionID
+	}
+	labels := map[uuid.UUID]bool{}
+	if len(predictionIDs) > 0 {
+		feedback, err := s.store.ListFeedbackForPredictions(ctx, predictionIDs)
+		if err != nil {
+			return nil, fmt.Errorf("listing feedback: %w", err)
+		}
+		for _, f := range feedback {
+			if f.PredictionID == nil {
+				continue
+			}
+			switch f.FeedbackType {
+			case FeedbackConfirmation:
+				labels[*f.PredictionID] = true
+			case FeedbackFalsePositive, FeedbackCorrection:
+				labels[*f.PredictionID] = false
+			}
+		}
+	}
+
+	threshold := s.config.Thresholds.RequireReview
+	var agree int
+	var delta float64
+	var activeCounts, shadowCounts confusion
+	for _, r := range compared {
+		activeKept := r.ActiveConfidence >= threshold
+		shadowKept := r.ShadowConfidence >= threshold
+		if activeKept == shadowKept {
+			agree++
+		}
+		delta += r.ShadowConfidence - r.ActiveConfidence
+
+		truePos, ok := labels[r.PredictionID]
+		if !ok {
+			continue
+		}
+		eval.Labeled++
+		activeCounts.add(activeKept, truePos)
+		shadowCounts.add(shadowKept, truePos)
+	}
+	eval.Compared = len(compared)
+	if eval.Compared > 0 {
+		eval.Agreement = ratio(agree, eval.Compared)
+		eval.MeanDelta = delta / float64(eval.Compared)
+	}
+	eval.Active = activeCounts.metrics()
+	eval.Shadow = shadowCounts.metrics()
+
+	if eval.Labeled < gate.MinLabeled {
+		eval.Reasons = append(eval.Reasons, fmt.Sprintf("%d labeled matches, need %d", eval.Labeled, gate.MinLabeled))
+	}
+	for _, m := range []struct {
+		name           string
+		shadow, active float64
+	}{
+		{"precision", eval.Shadow.Precision, eval.Active.Precision},
+		{"recall", eval.Shadow.Recall, eval.Active.Recall},
+	} {
+		if m.shadow < math.Min(m.active+gate.Margin, 1) {
+			eval.Reasons = append(eval.Reasons, fmt.Sprintf("shadow %s %.3f does not beat active %.3f by %.3f", m.name, m.shadow, m.active, gate.Margin))
+		}
+	}
+	eval.Passed = len(eval.Reasons) == 0
+	return eval, nil
+}
+
+func sameModel(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+type confusion struct {
+	tp, fp, fn int
+}
+
+func (c *confusion) add(kept, truePos bool) {
+	switch {
+	case kept && truePos:
+		c.tp++
+	case kept:
+		c.fp++
+	case truePos:
+		c.fn++
+	}
+}
+
+func (c confusion) metrics() ModelMetrics {
+	m := ModelMetrics{
+		Precision: ratio(c.tp, c.tp+c.fp),
+		Recall:    ratio(c.tp, c.tp+c.fn),
+	}
+	if m.Precision+m.Recall > 0 {
+		m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+	}
+	return m
+}
+
+// PromoteModel makes a model the active default of its type and retires the
+// model it replaces. Replacing an active model requires a shadow model that
+// passes gate; the evaluation is returned either way. A candidate may be
+// promoted directly only when nothing of its type is active.
+func (s *Service) PromoteModel(ctx context.Context, id uuid.UUID, gate PromotionGate) (*ShadowEvaluation, error) {
+	model, err := s.getModel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if model.Status != models.MLModelStatusShadow && model.Status != models.MLModelStatusCandidate {
+		return nil, fmt.Errorf("%w: cannot promote a %s model", ErrInvalidTransition, model.Status)
+	}
+	active, err := s.store.GetDefaultMLModel(ctx, model.ModelType)
+	if err != nil {
+		return nil, err
+	}
+
+	var eval *ShadowEvaluation
+	if active != nil {
+		if model.Status != models.MLModelStatusShadow {
+			return nil, fmt.Errorf("%w: a candidate must be shadowed before it can replace model %s", ErrInvalidTransition, active.Version)
+		}
+		eval, err = s.EvaluateShadow(ctx, id, gate)
+		if err != nil {
+			return nil, err
+		}
+		if !eval.Passed {
+			return eval, fmt.Errorf("%w: %s", ErrPromotionBlocked, strings.Join(eval.Reasons, "; "))
+		}
+	}
+
+	now := time.Now()
+	model.Status = models.MLModelStatusActive
+	model.IsDefault = true
+	model.PromotedAt = &now
+	model.RetiredAt = nil
+	if active != nil {
+		active.Status = models.MLModelStatusRetired
+		active.IsDefault = false
+		active.RetiredAt = &now
+	}
+	if err := s.store.ReplaceActiveMLModel(ctx, model, active); err != nil {
+		return nil, fmt.Errorf("promoting model %s: %w", model.Version, err)
+	}
+	s.afterLifecycleChange(ctx, model.ModelType)
+	return eval, nil
+}
+
+// RollbackModel retires the active model of modelType and reactivates the
+// version that was active before it
+func (s *Service) RollbackModel(ctx context.Context, modelType models.MLModelType) (*models.MLModel, error) {
+	active, err := s.store.GetDefaultMLModel(ctx, modelType)
+	if err != nil {
+		return nil, err
+	}
+	if active == nil {
+		return nil, fmt.Errorf("%w: no active %s model", ErrNoPreviousVersion, modelType)
+	}
+
+	registered, err := s.store.ListMLModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The previous version is the retired model promoted most recently
+	// before the active one. Retired shadows were never promoted.
+	var previous *models.MLModel
+	for _, m := range registered {
+		if m.ModelType != modelType || m.ID == active.ID || m.Status != models.MLModelStatusRetired || m.PromotedAt == nil {
+			continue
+		}
+		if active.PromotedAt != nil && !m.PromotedAt.Before(*active.PromotedAt) {
+			continue
+		}
+		if previous == nil || m.PromotedAt.After(*previous.PromotedAt) {
+			previous = m
+		}
+	}
+	if previous == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoPreviousVersion, modelType, active.Version)
+	}
+
+	// The previous version keeps its promotion time so a second rollback
+	// goes further back rather than returning here
+	now := time.Now()
+	previous.Status = models.MLModelStatusActive
+	previous.IsDefault = true
+	previous.RetiredAt = nil
+	active.Status = models.MLModelStatusRetired
+	active.IsDefault = false
+	active.RetiredAt = &now
+	if err := s.store.ReplaceActiveMLModel(ctx, previous, active); err != nil {
+		return nil, fmt.Errorf("rolling back to %s: %w", previous.Version, err)
+	}
+	s.afterLifecycleChange(ctx, modelType)
+	return previous, nil
+}
+
+// afterLifecycleChange makes this service use the new active model right
+// away; other processes pick it up on their next refresh
+func (s *Service) afterLifecycleChange(ctx context.Context, modelType models.MLModelType) {
+	switch modelType {
+	case models.MLModelFeedbackFilter:
+		s.loadFeedbackFilters(ctx)
+	case models.MLModelCalibrator:
+		s.loadCalibration(ctx)
+	case models.MLModelConfidenceScorer:
+		s.mu.Lock()
+		s.scorerModelID = uuid.Nil
+		s.mu.Unlock()
+	}
+}
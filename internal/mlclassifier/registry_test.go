@@ -0,0 +1,189 @@
+package mlclassifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// registerSSNFilter registers a feedback filter model with the given SSN weights
+func registerSSNFilter(t *testing.T, store *memStore, version string, status models.MLModelStatus, weights map[string]interface{}) *models.MLModel {
+	t.Helper()
+	now := time.Now()
+	model := &models.MLModel{
+		ID:        uuid.New(),
+		Name:      feedbackFilterName,
+		ModelType: models.MLModelFeedbackFilter,
+		Version:   version,
+		Config: models.JSONB{"rules": map[string]interface{}{
+			"SSN": map[string]interface{}{"bias": 0.0, "weights": weights},
+		}},
+		Status:    status,
+		IsDefault: status == models.MLModelStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if status == models.MLModelStatusActive {
+		model.PromotedAt = &now
+	}
+	if err := store.CreateMLModel(context.Background(), model); err != nil {
+		t.Fatalf("CreateMLModel: %v", err)
+	}
+	return model
+}
+
+// scanAndReview records a scanned SSN match in window and the reviewer's verdict on it
+func scanAndReview(t *testing.T, svc *Service, store *memStore, window, feedbackType string) EnhancedMatch {
+	t.Helper()
+	ctx := context.Background()
+	matches := []EnhancedMatch{{RuleName: "SSN", Category: models.CategoryPII, Value: "***-**-6789", Count: 1, RegexConfidence: 0.5}}
+	result, err := svc.EnhanceClassification(ctx, window, matches)
+	if err != nil {
+		t.Fatalf("EnhanceClassification: %v", err)
+	}
+	if err := svc.RecordScanPredictions(ctx, result, []uuid.UUID{uuid.New()}); err != nil {
+		t.Fatalf("RecordScanPredictions: %v", err)
+	}
+	if feedbackType != "" {
+		prediction := store.shadowResults[len(store.shadowResults)-1].PredictionID
+		err := svc.SubmitFeedback(ctx, &FeedbackSubmission{PredictionID: prediction, FeedbackType: feedbackType, ContextWindow: window})
+		if err != nil {
+			t.Fatalf("SubmitFeedback: %v", err)
+		}
+	}
+	return result.Matches[0]
+}
+
+// Reads like a real record, so only reviewer feedback reveals it as noise
+const vendorContext = "vendor import batch, ssn ***-**-6789"
+
+func TestModelRegistry_ShadowPromoteRollback(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	active := registerSSNFilter(t, store, "1.0.0", models.MLModelStatusActive, map[string]interface{}{})
+	candidate := registerSSNFilter(t, store, "1.0.1", models.MLModelStatusCandidate, map[string]interface{}{"w:vendor": -8.0, "w:payroll": 8.0})
+	svc := NewService(store)
+	gate := DefaultPromotionGate()
+
+	baseline := scanAndReviewNoShadow(t, svc, vendorContext)
+
+	if _, err := svc.PromoteModel(ctx, candidate.ID, gate); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected a candidate not to replace the active model, got %v", err)
+	}
+	if _, err := svc.ShadowModel(ctx, candidate.ID); err != nil {
+		t.Fatalf("ShadowModel: %v", err)
+	}
+
+	// Shadow scores are recorded but do not change the reported confidence
+	match := scanAndReview(t, svc, store, vendorContext, "")
+	if match.CombinedConfidence != baseline.CombinedConfidence {
+		t.Errorf("expected shadow scoring to leave confidence at %v, got %v", baseline.CombinedConfidence, match.CombinedConfidence)
+	}
+	recorded := store.shadowResults[0]
+	if recorded.ShadowModelID != candidate.ID || recorded.ActiveModelID == nil || *recorded.ActiveModelID != active.ID {
+		t.Errorf("unexpected shadow result %+v", recorded)
+	}
+	if recorded.ShadowConfidence >= recorded.ActiveConfidence {
+		t.Errorf("expected the shadow to score the vendor batch lower, got %v and %v", recorded.ShadowConfidence, recorded.ActiveConfidence)
+	}
+
+	// Too few labels to promote
+	eval, err := svc.PromoteModel(ctx, candidate.ID, gate)
+	if !errors.Is(err, ErrPromotionBlocked) || eval == nil || eval.Labeled != 0 {
+		t.Fatalf("expected promotion to be blocked without labels, got %v and %+v", err, eval)
+	}
+
+	for i := 0; i < 10; i++ {
+		scanAndReview(t, svc, store, vendorContext, FeedbackFalsePositive)
+		scanAndReview(t, svc, store, employeeContext, FeedbackConfirmation)
+	}
+	eval, err = svc.EvaluateShadow(ctx, candidate.ID, gate)
+	if err != nil {
+		t.Fatalf("EvaluateShadow: %v", err)
+	}
+	if eval.Compared != 21 || eval.Labeled != 20 {
+		t.Errorf("expected 21 compared and 20 labeled, got %d and %d", eval.Compared, eval.Labeled)
+	}
+	if eval.Active.Precision != 0.5 || eval.Shadow.Precision != 1 || eval.Shadow.Recall != 1 {
+		t.Errorf("unexpected metrics active=%+v shadow=%+v", eval.Active, eval.Shadow)
+	}
+	if !eval.Passed {
+		t.Errorf("expected the gate to pass, got %v", eval.Reasons)
+	}
+
+	if _, err := svc.PromoteModel(ctx, candidate.ID, PromotionGate{MinLabeled: 50, Margin: 0.02}); !errors.Is(err, ErrPromotionBlocked) {
+		t.Errorf("expected 50 required labels to block promotion, got %v", err)
+	}
+
+	if _, err := svc.PromoteModel(ctx, candidate.ID, gate); err != nil {
+		t.Fatalf("PromoteModel: %v", err)
+	}
+	if m := store.models[candidate.ID]; m.Status != models.MLModelStatusActive || !m.IsDefault || m.PromotedAt == nil {
+		t.Errorf("expected version 1.0.1 to be active, got %+v", m)
+	}
+	if m := store.models[active.ID]; m.Status != models.MLModelStatusRetired || m.IsDefault || m.RetiredAt == nil {
+		t.Errorf("expected version 1.0.0 to be retired, got %+v", m)
+	}
+	if f := svc.scorer.FeedbackFilter(); f == nil || f.ModelID != candidate.ID || len(svc.shadowFilters) != 0 {
+		t.Error("expected the service to score with the promoted filter and no shadows")
+	}
+
+	restored, err := svc.RollbackModel(ctx, models.MLModelFeedbackFilter)
+	if err != nil {
+		t.Fatalf("RollbackModel: %v", err)
+	}
+	if restored.ID != active.ID || store.models[candidate.ID].Status != models.MLModelStatusRetired {
+		t.Errorf("expected rollback to reactivate version 1.0.0, got %s", restored.Version)
+	}
+	if f := svc.scorer.FeedbackFilter(); f == nil || f.ModelID != active.ID {
+		t.Error("expected the service to score with the restored filter")
+	}
+	if _, err := svc.RollbackModel(ctx, models.MLModelFeedbackFilter); !errors.Is(err, ErrNoPreviousVersion) {
+		t.Errorf("expected no version before 1.0.0, got %v", err)
+	}
+}
+
+// scanAndReviewNoShadow scores a match without recording it
+func scanAndReviewNoShadow(t *testing.T, svc *Service, window string) EnhancedMatch {
+	t.Helper()
+	matches := []EnhancedMatch{{RuleName: "SSN", Category: models.CategoryPII, Value: "***-**-6789", Count: 1, RegexConfidence: 0.5}}
+	result, err := svc.EnhanceClassification(context.Background(), window, matches)
+	if err != nil {
+		t.Fatalf("EnhanceClassification: %v", err)
+	}
+	return result.Matches[0]
+}
+
+func TestModelRegistry_Transitions(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := NewService(store)
+
+	scorerID, err := svc.scanScorerModel(ctx)
+	if err != nil {
+		t.Fatalf("scanScorerModel: %v", err)
+	}
+	if _, err := svc.ShadowModel(ctx, scorerID); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected confidence scorers not to support shadowing, got %v", err)
+	}
+	if _, err := svc.RollbackModel(ctx, models.MLModelFeedbackFilter); !errors.Is(err, ErrNoPreviousVersion) {
+		t.Errorf("expected nothing to roll back, got %v", err)
+	}
+
+	// With nothing active a candidate is promoted without a gate
+	candidate := registerSSNFilter(t, store, "1.0.0", models.MLModelStatusCandidate, map[string]interface{}{})
+	eval, err := svc.PromoteModel(ctx, candidate.ID, DefaultPromotionGate())
+	if err != nil || eval != nil {
+		t.Fatalf("expected an ungated promotion, got %v and %+v", err, eval)
+	}
+	if _, err := svc.PromoteModel(ctx, candidate.ID, DefaultPromotionGate()); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected an active model not to be promoted again, got %v", err)
+	}
+	if _, err := svc.EvaluateShadow(ctx, candidate.ID, DefaultPromotionGate()); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("expected only shadow models to be evaluated, got %v", err)
+	}
+}
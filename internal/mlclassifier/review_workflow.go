@@ -0,0 +1,565 @@
+package mlclassifier
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// Review resolutions
+const (
+	ResolutionConfirmed = "CONFIRMED"
+	ResolutionRejected  = "REJECTED"
+	ResolutionModified  = "MODIFIED"
+)
+
+// Review workflow errors
+var (
+	ErrReviewItemNotFound    = errors.New("review item not found")
+	ErrReviewItemResolved    = errors.New("review item already resolved")
+	ErrInvalidResolution     = errors.New("invalid resolution")
+	ErrSameReviewer          = errors.New("second review must be by a different reviewer")
+	ErrInvalidRoutingRule    = errors.New("invalid routing rule")
+	ErrInvalidBulkResolution = errors.New("invalid bulk resolution")
+)
+
+// routingRefresh is how often a service reloads routing rules, so rules
+// created through other processes take effect
+const routingRefresh = time.Minute
+
+// maxBulkResolution caps the items one bulk resolution considers
+const maxBulkResolution = 5000
+
+// maxEscalations caps the overdue items one escalation run handles
+const maxEscalations = 1000
+
+// ReviewWorkflowConfig controls routing, SLAs and double review of queued items
+type ReviewWorkflowConfig struct {
+	// SLAs by queue reason; other reasons get DefaultSLA. The SLA of the
+	// routing rule that assigned an item takes precedence.
+	SLAs       map[string]time.Duration `json:"slas"`
+	DefaultSLA time.Duration            `json:"default_sla"`
+	// Share of items sampled for an independent second review
+	DoubleReviewRate float64 `json:"double_review_rate"`
+	// Asset tag holding the data owner that routing rules match on
+	DataOwnerTag string `json:"data_owner_tag"`
+	// Added to an item's priority when it misses its SLA
+	EscalationPriority int `json:"escalation_priority"`
+}
+
+// DefaultReviewWorkflowConfig returns default review workflow settings
+func DefaultReviewWorkflowConfig() ReviewWorkflowConfig {
+	return ReviewWorkflowConfig{
+		SLAs: map[string]time.Duration{
+			"SENSITIVE_DATA":          24 * time.Hour,
+			"CONFLICTING_PREDICTIONS": 48 * time.Hour,
+			"LOW_CONFIDENCE":          72 * time.Hour,
+		},
+		DefaultSLA:         72 * time.Hour,
+		DoubleReviewRate:   0.05,
+		DataOwnerTag:       "owner",
+		EscalationPriority: 100,
+	}
+}
+
+func validResolution(resolution string) bool {
+	switch resolution {
+	case ResolutionConfirmed, ResolutionRejected, ResolutionModified:
+		return true
+	}
+	return false
+}
+
+// reviewSLA returns how long a reviewer has for an item
+func (s *Service) reviewSLA(reason string, rule *models.ReviewRoutingRule) time.Duration {
+	if rule != nil && rule.SLAHours > 0 {
+		return time.Duration(rule.SLAHours) * time.Hour
+	}
+	if sla, ok := s.config.Review.SLAs[reason]; ok {
+		return sla
+	}
+	return s.config.Review.DefaultSLA
+}
+
+// sampledForDoubleReview picks items for double review from the random bits
+// of their ID, so the choice is stable and needs no shared state
+func sampledForDoubleReview(id uuid.UUID, rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint32(id[12:])) < rate*(1<<32)
+}
+
+// CreateRoutingRule validates and stores a routing rule
+func (s *Service) CreateRoutingRule(ctx context.Context, rule *models.ReviewRoutingRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRoutingRule)
+	}
+	if len(rule.Assignees) == 0 {
+		return fmt.Errorf("%w: at least one assignee is required", ErrInvalidRoutingRule)
+	}
+	for _, assignee := range rule.Assignees {
+		if _, err := uuid.Parse(assignee); err != nil {
+			return fmt.Errorf("%w: assignee %q is not a user ID", ErrInvalidRoutingRule, assignee)
+		}
+	}
+	if rule.SLAHours < 0 {
+		return fmt.Errorf("%w: sla_hours must not be negative", ErrInvalidRoutingRule)
+	}
+
+	if err := s.store.CreateReviewRoutingRule(ctx, rule); err != nil {
+		return fmt.Errorf("creating routing rule: %w", err)
+	}
+	s.invalidateRouting()
+	return nil
+}
+
+// ListRoutingRules returns all routing rules, highest priority first
+func (s *Service) ListRoutingRules(ctx context.Context) ([]*models.ReviewRoutingRule, error) {
+	rules, err := s.store.ListReviewRoutingRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing routing rules: %w", err)
+	}
+	return rules, nil
+}
+
+// DeleteRoutingRule deletes a routing rule. Items it routed keep their assignee.
+func (s *Service) DeleteRoutingRule(ctx context.Context, id uuid.UUID) error {
+	if err := s.store.DeleteReviewRoutingRule(ctx, id); err != nil {
+		return fmt.Errorf("deleting routing rule: %w", err)
+	}
+	s.invalidateRouting()
+	return nil
+}
+
+func (s *Service) invalidateRouting() {
+	s.mu.Lock()
+	s.routing = nil
+	s.mu.Unlock()
+}
+
+// routingRules returns the routing rules by descending priority, reloading
+// them at most once per routingRefresh
+func (s *Service) routingRules(ctx context.Context) ([]*models.ReviewRoutingRule, error) {
+	s.mu.Lock()
+	if s.routing != nil && time.Since(s.routingLoadedAt) < routingRefresh {
+		rules := s.routing
+		s.mu.Unlock()
+		return rules, nil
+	}
+	s.mu.Unlock()
+
+	rules, err := s.store.ListReviewRoutingRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing routing rules: %w", err)
+	}
+	if rules == nil {
+		rules = []*models.ReviewRoutingRule{}
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+
+	s.mu.Lock()
+	s.routing = rules
+	s.routingLoadedAt = time.Now()
+	s.mu.Unlock()
+	return rules, nil
+}
+
+// matchRoutingRule returns the first enabled rule matching subject
+func matchRoutingRule(rules []*models.ReviewRoutingRule, subject *models.ReviewSubject) *models.ReviewRoutingRule {
+	for _, rule := range rules {
+		switch {
+		case !rule.Enabled || len(rule.Assignees) == 0:
+		case rule.AccountID != nil && *rule.AccountID != subject.AccountID:
+		case rule.Category != "" && rule.Category != subject.Category:
+		case rule.DataOwner != "" && !strings.EqualFold(rule.DataOwner, subject.DataOwner):
+		default:
+			return rule
+		}
+	}
+	return nil
+}
+
+// routeReview assigns item according to the routing rules, to the rule's
+// assignee with the fewest open items other than exclude. The matching rule
+// is returned even when no assignee is left.
+func (s *Service) routeReview(ctx context.Context, item *models.ClassificationReviewQueue, exclude *uuid.UUID) (*models.ReviewRoutingRule, error) {
+	subject, err := s.store.GetReviewSubject(ctx, item.ClassificationID, s.config.Review.DataOwnerTag)
+	if err != nil {
+		return nil, fmt.Errorf("getting review subject: %w", err)
+	}
+	if subject == nil {
+		return nil, nil
+	}
+	rules, err := s.routingRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rule := matchRoutingRule(rules, subject)
+	if rule == nil {
+		return nil, nil
+	}
+
+	var candidates []uuid.UUID
+	for _, assignee := range rule.Assignees {
+		id, err := uuid.Parse(assignee)
+		if err != nil || (exclude != nil && id == *exclude) {
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+
+	item.RoutingRuleID = &rule.ID
+	if len(candidates) == 0 {
+		return rule, nil
+	}
+	assignee := candidates[0]
+	if len(candidates) > 1 {
+		workloads, err := s.store.ListReviewerWorkloads(ctx, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("getting reviewer workloads: %w", err)
+		}
+		open := make(map[uuid.UUID]int, len(workloads))
+		for _, w := range workloads {
+			open[w.ReviewerID] = w.Open
+		}
+		for _, c := range candidates[1:] {
+			if open[c] < open[assignee] {
+				assignee = c
+			}
+		}
+	}
+
+	now := time.Now()
+	item.AssignedTo = &assignee
+	item.AssignedAt = &now
+	return rule, nil
+}
+
+// resolveItem applies a reviewer's decision to an open item. The first
+// decision on an item sampled for double review is recorded and the item is
+// routed to another reviewer; the second decision resolves it.
+func (s *Service) resolveItem(ctx context.Context, item *models.ClassificationReviewQueue, resolution *ReviewResolution) error {
+	if item.Status == models.ReviewQueueStatusResolved {
+		return fmt.Errorf("%w: %s", ErrReviewItemResolved, item.ID)
+	}
+
+	now := time.Now()
+	var reviewer *uuid.UUID
+	if resolution.ReviewedBy != uuid.Nil {
+		id := resolution.ReviewedBy
+		reviewer = &id
+	}
+
+	if item.DoubleReview && item.FirstResolvedAt == nil {
+		item.FirstReviewer = reviewer
+		item.FirstResolution = resolution.Resolution
+		item.FirstResolvedAt = &now
+		item.Status = models.ReviewQueueStatusPending
+		item.AssignedTo, item.AssignedAt = nil, nil
+		if _, err := s.routeReview(ctx, item, reviewer); err != nil {
+			return err
+		}
+		if err := s.store.UpdateReviewQueueItem(ctx, item); err != nil {
+			return fmt.Errorf("updating review item: %w", err)
+		}
+		return nil
+	}
+	if item.DoubleReview && reviewer != nil && item.FirstReviewer != nil && *reviewer == *item.FirstReviewer {
+		return fmt.Errorf("%w: %s", ErrSameReviewer, item.ID)
+	}
+
+	item.Status = models.ReviewQueueStatusResolved
+	item.ResolvedAt = &now
+	item.ResolvedBy = reviewer
+	item.Resolution = resolution.Resolution
+	item.FinalLabel = resolution.FinalLabel
+	item.FinalConfidence = resolution.FinalConfidence
+
+	if err := s.store.UpdateReviewQueueItem(ctx, item); err != nil {
+		return fmt.Errorf("updating review item: %w", err)
+	}
+	if err := s.recordCalibrationSample(ctx, item); err != nil {
+		return fmt.Errorf("recording calibration sample: %w", err)
+	}
+
+	// Update classification confidence if confirmed
+	if resolution.Resolution == ResolutionConfirmed || resolution.Resolution == ResolutionModified {
+		if err := s.store.UpdateClassificationConfidence(ctx, item.ClassificationID, resolution.FinalConfidence, true); err != nil {
+			return fmt.Errorf("updating classification: %w", err)
+		}
+	}
+	return nil
+}
+
+// BulkResolution applies one decision to the open review items of a rule
+type BulkResolution struct {
+	RuleName        string    `json:"rule_name"`
+	AssetPattern    string    `json:"asset_pattern,omitempty"` // Glob matched against the asset name
+	Resolution      string    `json:"resolution"`
+	FinalLabel      string    `json:"final_label,omitempty"`
+	FinalConfidence float64   `json:"final_confidence"`
+	ReviewedBy      uuid.UUID `json:"reviewed_by"`
+	Limit           int       `json:"limit,omitempty"`
+	DryRun          bool      `json:"dry_run,omitempty"`
+}
+
+// BulkResolutionResult summarizes a bulk resolution. Items sampled for
+// double review still need a second reviewer after their first decision.
+type BulkResolutionResult struct {
+	Matched      int         `json:"matched"`
+	Resolved     int         `json:"resolved"`
+	FirstReviews int         `json:"first_reviews"`
+	Skipped      int         `json:"skipped"` // Second reviews of the reviewer's own first review
+	ItemIDs      []uuid.UUID `json:"item_ids"`
+	DryRun       bool        `json:"dry_run,omitempty"`
+}
+
+// BulkResolveReviewItems resolves the open items of a rule whose asset name
+// matches AssetPattern, highest priority first. At most Limit items of the
+// rule are considered per call, so large backlogs take several calls.
+func (s *Service) BulkResolveReviewItems(ctx context.Context, req *BulkResolution) (*BulkResolutionResult, error) {
+	if req.RuleName == "" {
+		return nil, fmt.Errorf("%w: rule_name is required", ErrInvalidBulkResolution)
+	}
+	if !validResolution(req.Resolution) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidResolution, req.Resolution)
+	}
+	if _, err := path.Match(req.AssetPattern, ""); err != nil {
+		return nil, fmt.Errorf("%w: asset_pattern: %v", ErrInvalidBulkResolution, err)
+	}
+	limit := req.Limit
+	if limit <= 0 || limit > maxBulkResolution {
+		limit = maxBulkResolution
+	}
+
+	entries, err := s.store.ListOpenReviewEntries(ctx, req.RuleName, s.config.Review.DataOwnerTag, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing review items: %w", err)
+	}
+
+	result := &BulkResolutionResult{ItemIDs: []uuid.UUID{}, DryRun: req.DryRun}
+	resolution := &ReviewResolution{
+		Resolution:      req.Resolution,
+		FinalLabel:      req.FinalLabel,
+		FinalConfidence: req.FinalConfidence,
+		ReviewedBy:      req.ReviewedBy,
+	}
+	for _, entry := range entries {
+		if req.AssetPattern != "" {
+			if ok, _ := path.Match(req.AssetPattern, entry.AssetName); !ok {
+				continue
+			}
+		}
+		item := &entry.ClassificationReviewQueue
+		result.Matched++
+		result.ItemIDs = append(result.ItemIDs, item.ID)
+		if req.DryRun {
+			continue
+		}
+
+		resolution.ItemID = item.ID
+		err := s.resolveItem(ctx, item, resolution)
+		switch {
+		case errors.Is(err, ErrSameReviewer):
+			result.Skipped++
+		case err != nil:
+			return result, fmt.Errorf("resolving %s: %w", item.ID, err)
+		case item.Status == models.ReviewQueueStatusResolved:
+			result.Resolved++
+		default:
+			result.FirstReviews++
+		}
+	}
+	return result, nil
+}
+
+// EscalationNotifier is told about review items that missed their SLA
+type EscalationNotifier func(ctx context.Context, entries []*models.ReviewQueueEntry) error
+
+// SetEscalationNotifier sets where escalations are reported
+func (s *Service) SetEscalationNotifier(notifier EscalationNotifier) {
+	s.escalationNotifier = notifier
+}
+
+// EscalateOverdueReviews raises the priority of open items past their due
+// time and reports them to the escalation notifier. Each item is escalated
+// once; items stay escalated if the notification fails.
+func (s *Service) EscalateOverdueReviews(ctx context.Context) ([]*models.ReviewQueueEntry, error) {
+	now := time.Now()
+	entries, err := s.store.ListOverdueReviewEntries(ctx, now, s.config.Review.DataOwnerTag, maxEscalations)
+	if err != nil {
+		return nil, fmt.Errorf("listing overdue review items: %w", err)
+	}
+
+	for _, entry := range entries {
+		entry.EscalatedAt = &now
+		entry.Priority += s.config.Review.EscalationPriority
+		if err := s.store.UpdateReviewQueueItem(ctx, &entry.ClassificationReviewQueue); err != nil {
+			return nil, fmt.Errorf("escalating review item %s: %w", entry.ID, err)
+		}
+	}
+
+	if len(entries) > 0 && s.escalationNotifier != nil {
+		if err := s.escalationNotifier(ctx, entries); err != nil {
+			return entries, fmt.Errorf("notifying escalation: %w", err)
+		}
+	}
+	return entries, nil
+}
+
+// ReviewerStats summarizes one reviewer's decisions in a time window
+type ReviewerStats struct {
+	ReviewerID uuid.UUID `json:"reviewer_id"`
+	Reviews    int       `json:"reviews"` // First and final decisions
+	PerDay     float64   `json:"per_day"`
+	// Median time from an item reaching the reviewer, when queued or after
+	// its first review, to the decision
+	MedianHours float64 `json:"median_hours"`
+	// Decisions on double-reviewed items and how many the other reviewer
+	// agreed with
+	DoubleReviewed int     `json:"double_reviewed"`
+	Agreed         int     `json:"agreed"`
+	Agreement      float64 `json:"agreement"`
+	Open           int     `json:"open"`
+	Overdue        int     `json:"overdue"`
+}
+
+// ReviewMetrics reports reviewer throughput and inter-reviewer agreement
+type ReviewMetrics struct {
+	Since          time.Time       `json:"since"`
+	Until          time.Time       `json:"until"`
+	Reviewers      []ReviewerStats `json:"reviewers"`
+	DoubleReviewed int             `json:"double_reviewed"`
+	Agreement      float64         `json:"agreement"`
+	// Cohen's kappa over double-reviewed items: agreement corrected for
+	// what the reviewers' resolution rates would produce by chance
+	Kappa float64 `json:"kappa"`
+}
+
+// ReviewMetrics computes per-reviewer throughput and accuracy, measured as
+// agreement with the other reviewer on double-reviewed items, for decisions
+// made since the given time
+func (s *Service) ReviewMetrics(ctx context.Context, since time.Time) (*ReviewMetrics, error) {
+	now := time.Now()
+	items, err := s.store.ListReviewItemsReviewedSince(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("listing reviewed items: %w", err)
+	}
+	workloads, err := s.store.ListReviewerWorkloads(ctx, now)
+	if err != nil {
+		return nil, fmt.Errorf("getting reviewer workloads: %w", err)
+	}
+
+	byReviewer := make(map[uuid.UUID]*ReviewerStats)
+	durations := make(map[uuid.UUID][]float64)
+	reviewerStats := func(id uuid.UUID) *ReviewerStats {
+		st, ok := byReviewer[id]
+		if !ok {
+			st = &ReviewerStats{ReviewerID: id}
+			byReviewer[id] = st
+		}
+		return st
+	}
+	decision := func(reviewer *uuid.UUID, from time.Time, at *time.Time) {
+		if reviewer == nil || at == nil || at.Before(since) {
+			return
+		}
+		reviewerStats(*reviewer).Reviews++
+		durations[*reviewer] = append(durations[*reviewer], at.Sub(from).Hours())
+	}
+
+	metrics := &ReviewMetrics{Since: since, Until: now, Reviewers: []ReviewerStats{}}
+	firstCounts := make(map[string]int)
+	finalCounts := make(map[string]int)
+	agreed := 0
+	for _, item := range items {
+		decision(item.FirstReviewer, item.CreatedAt, item.FirstResolvedAt)
+		if item.Status == models.ReviewQueueStatusResolved {
+			from := item.CreatedAt
+			if item.FirstResolvedAt != nil {
+				from = *item.FirstResolvedAt
+			}
+			decision(item.ResolvedBy, from, item.ResolvedAt)
+		}
+
+		if item.FirstResolution == "" || item.Status != models.ReviewQueueStatusResolved || item.ResolvedAt.Before(since) {
+			continue
+		}
+		match := item.FirstResolution == item.Resolution
+		metrics.DoubleReviewed++
+		firstCounts[item.FirstResolution]++
+		finalCounts[item.Resolution]++
+		if match {
+			agreed++
+		}
+		for _, reviewer := range []*uuid.UUID{item.FirstReviewer, item.ResolvedBy} {
+			if reviewer == nil {
+				continue
+			}
+			st := reviewerStats(*reviewer)
+			st.DoubleReviewed++
+			if match {
+				st.Agreed++
+			}
+		}
+	}
+	for _, w := range workloads {
+		st := reviewerStats(w.ReviewerID)
+		st.Open, st.Overdue = w.Open, w.Overdue
+	}
+
+	days := math.Max(now.Sub(since).Hours()/24, 1)
+	for id, st := range byReviewer {
+		st.PerDay = float64(st.Reviews) / days
+		st.MedianHours = median(durations[id])
+		if st.DoubleReviewed > 0 {
+			st.Agreement = float64(st.Agreed) / float64(st.DoubleReviewed)
+		}
+		metrics.Reviewers = append(metrics.Reviewers, *st)
+	}
+	sort.Slice(metrics.Reviewers, func(i, j int) bool {
+		a, b := metrics.Reviewers[i], metrics.Reviewers[j]
+		if a.Reviews != b.Reviews {
+			return a.Reviews > b.Reviews
+		}
+		return a.ReviewerID.String() < b.ReviewerID.String()
+	})
+
+	if metrics.DoubleReviewed > 0 {
+		n := float64(metrics.DoubleReviewed)
+		observed := float64(agreed) / n
+		var chance float64
+		for _, resolution := range []string{ResolutionConfirmed, ResolutionRejected, ResolutionModified} {
+			chance += float64(firstCounts[resolution]) / n * float64(finalCounts[resolution]) / n
+		}
+		metrics.Agreement = observed
+		metrics.Kappa = 1
+		if chance < 1 {
+			metrics.Kappa = (observed - chance) / (1 - chance)
+		}
+	}
+	return metrics, nil
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
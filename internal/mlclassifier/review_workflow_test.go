@@ -0,0 +1,343 @@
+package mlclassifier
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// addReviewSubject records an asset and a classification of rule on it and
+// returns the classification ID
+func addReviewSubject(store *memStore, rule, assetName string, accountID uuid.UUID, owner string) uuid.UUID {
+	asset := &models.DataAsset{ID: uuid.New(), AccountID: accountID, Name: assetName, Tags: models.JSONB{}}
+	if owner != "" {
+		asset.Tags["owner"] = owner
+	}
+	store.assets[asset.ID] = asset
+	classification := &models.Classification{ID: uuid.New(), AssetID: asset.ID, RuleName: rule, Category: models.CategoryPII}
+	store.classifications[classification.ID] = classification
+	return classification.ID
+}
+
+func newReviewService(store *memStore, doubleReviewRate float64) *Service {
+	config := DefaultClassifierConfig()
+	config.Review.DoubleReviewRate = doubleReviewRate
+	return NewServiceWithConfig(store, config)
+}
+
+func TestMatchRoutingRule(t *testing.T) {
+	account := uuid.New()
+	subject := &models.ReviewSubject{AccountID: account, Category: models.CategoryPII, DataOwner: "Payments"}
+
+	tests := []struct {
+		name string
+		rule models.ReviewRoutingRule
+		want bool
+	}{
+		{"catch-all", models.ReviewRoutingRule{}, true},
+		{"account", models.ReviewRoutingRule{AccountID: &account}, true},
+		{"other account", models.ReviewRoutingRule{AccountID: &uuid.UUID{1}}, false},
+		{"category", models.ReviewRoutingRule{Category: models.CategoryPII}, true},
+		{"other category", models.ReviewRoutingRule{Category: models.CategoryPHI}, false},
+		{"owner ignores case", models.ReviewRoutingRule{DataOwner: "payments"}, true},
+		{"other owner", models.ReviewRoutingRule{DataOwner: "hr"}, false},
+		{"disabled", models.ReviewRoutingRule{Enabled: false}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			rule.Enabled = tt.name != "disabled"
+			rule.Assignees = models.StringArray{uuid.NewString()}
+			got := matchRoutingRule([]*models.ReviewRoutingRule{&rule}, subject) != nil
+			if got != tt.want {
+				t.Errorf("expected match %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestService_QueueForReview_Routing(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := newReviewService(store, 0)
+
+	account := uuid.New()
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	if err := svc.CreateRoutingRule(ctx, &models.ReviewRoutingRule{
+		Name: "prod account", Priority: 10, AccountID: &account,
+		Assignees: models.StringArray{alice.String(), bob.String()}, Enabled: true,
+	}); err != nil {
+		t.Fatalf("CreateRoutingRule: %v", err)
+	}
+	if err := svc.CreateRoutingRule(ctx, &models.ReviewRoutingRule{
+		Name: "payments team", Priority: 20, DataOwner: "payments",
+		Assignees: models.StringArray{carol.String()}, SLAHours: 4, Enabled: true,
+	}); err != nil {
+		t.Fatalf("CreateRoutingRule: %v", err)
+	}
+	if err := svc.CreateRoutingRule(ctx, &models.ReviewRoutingRule{Name: "nobody", Enabled: true}); !errors.Is(err, ErrInvalidRoutingRule) {
+		t.Errorf("expected ErrInvalidRoutingRule without assignees, got %v", err)
+	}
+
+	// The owner rule has the higher priority and its own SLA
+	owned := addReviewSubject(store, "SSN", "billing-db", account, "Payments")
+	if err := svc.QueueForReview(ctx, owned, nil, "LOW_CONFIDENCE", 0.6); err != nil {
+		t.Fatalf("QueueForReview: %v", err)
+	}
+	item := store.reviewQueue[0]
+	if item.AssignedTo == nil || *item.AssignedTo != carol || item.AssignedAt == nil {
+		t.Errorf("expected the item to be assigned to the data owner's reviewer, got %+v", item)
+	}
+	if item.DueBy == nil || item.DueBy.Sub(item.CreatedAt) != 4*time.Hour {
+		t.Errorf("expected the rule's 4h SLA, got due %v", item.DueBy)
+	}
+
+	// Account items are balanced across the rule's assignees
+	for i := 0; i < 4; i++ {
+		id := addReviewSubject(store, "SSN", "hr-bucket", account, "")
+		if err := svc.QueueForReview(ctx, id, nil, "SENSITIVE_DATA", 0.9); err != nil {
+			t.Fatalf("QueueForReview: %v", err)
+		}
+	}
+	counts := make(map[uuid.UUID]int)
+	for _, item := range store.reviewQueue[1:] {
+		if item.AssignedTo != nil {
+			counts[*item.AssignedTo]++
+		}
+		if item.DueBy == nil || item.DueBy.Sub(item.CreatedAt) != 24*time.Hour {
+			t.Errorf("expected the SENSITIVE_DATA SLA of 24h, got due %v", item.DueBy)
+		}
+	}
+	if counts[alice] != 2 || counts[bob] != 2 {
+		t.Errorf("expected two items each for the account's reviewers, got %v", counts)
+	}
+
+	// Unmatched items are queued unassigned with the default SLA
+	other := addReviewSubject(store, "SSN", "dev", uuid.New(), "")
+	if err := svc.QueueForReview(ctx, other, nil, "OTHER", 0.9); err != nil {
+		t.Fatalf("QueueForReview: %v", err)
+	}
+	last := store.reviewQueue[len(store.reviewQueue)-1]
+	if last.AssignedTo != nil || last.RoutingRuleID != nil || last.DueBy.Sub(last.CreatedAt) != 72*time.Hour {
+		t.Errorf("expected an unassigned item with the default SLA, got %+v", last)
+	}
+}
+
+func TestService_DoubleReview(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := newReviewService(store, 1)
+
+	alice, bob := uuid.New(), uuid.New()
+	if err := svc.CreateRoutingRule(ctx, &models.ReviewRoutingRule{
+		Name: "all", Assignees: models.StringArray{alice.String(), bob.String()}, Enabled: true,
+	}); err != nil {
+		t.Fatalf("CreateRoutingRule: %v", err)
+	}
+	classificationID := addReviewSubject(store, "SSN", "db", uuid.New(), "")
+	if err := svc.QueueForReview(ctx, classificationID, nil, "LOW_CONFIDENCE", 0.6); err != nil {
+		t.Fatalf("QueueForReview: %v", err)
+	}
+	item := store.reviewQueue[0]
+	if !item.DoubleReview {
+		t.Fatal("expected the item to be sampled for double review")
+	}
+
+	first, err := svc.ResolveReviewItem(ctx, &ReviewResolution{ItemID: item.ID, Resolution: ResolutionConfirmed, FinalConfidence: 0.95, ReviewedBy: alice})
+	if err != nil {
+		t.Fatalf("ResolveReviewItem: %v", err)
+	}
+	if first.Status != models.ReviewQueueStatusPending || first.FirstResolution != ResolutionConfirmed {
+		t.Fatalf("expected the first review to be recorded, got %+v", first)
+	}
+	if first.AssignedTo == nil || *first.AssignedTo != bob {
+		t.Errorf("expected the second review to go to the other reviewer, got %v", first.AssignedTo)
+	}
+	if store.classifications[classificationID].Validated {
+		t.Error("expected the classification to wait for the second review")
+	}
+
+	if _, err := svc.ResolveReviewItem(ctx, &ReviewResolution{ItemID: item.ID, Resolution: ResolutionConfirmed, ReviewedBy: alice}); !errors.Is(err, ErrSameReviewer) {
+		t.Errorf("expected ErrSameReviewer, got %v", err)
+	}
+
+	final, err := svc.ResolveReviewItem(ctx, &ReviewResolution{ItemID: item.ID, Resolution: ResolutionConfirmed, FinalConfidence: 0.95, ReviewedBy: bob})
+	if err != nil {
+		t.Fatalf("ResolveReviewItem: %v", err)
+	}
+	if final.Status != models.ReviewQueueStatusResolved || final.ResolvedBy == nil || *final.ResolvedBy != bob {
+		t.Errorf("expected the second review to resolve the item, got %+v", final)
+	}
+	if !store.classifications[classificationID].Validated {
+		t.Error("expected the classification to be validated")
+	}
+
+	if _, err := svc.ResolveReviewItem(ctx, &ReviewResolution{ItemID: item.ID, Resolution: ResolutionRejected, ReviewedBy: bob}); !errors.Is(err, ErrReviewItemResolved) {
+		t.Errorf("expected ErrReviewItemResolved, got %v", err)
+	}
+	if _, err := svc.ResolveReviewItem(ctx, &ReviewResolution{ItemID: item.ID, Resolution: "MAYBE"}); !errors.Is(err, ErrInvalidResolution) {
+		t.Errorf("expected ErrInvalidResolution, got %v", err)
+	}
+}
+
+func TestService_BulkResolveReviewItems(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := newReviewService(store, 0)
+	account := uuid.New()
+	reviewer := uuid.New()
+
+	for _, name := range []string{"logs-2024", "logs-2025", "customers"} {
+		id := addReviewSubject(store, "EMAIL", name, account, "")
+		if err := svc.QueueForReview(ctx, id, nil, "LOW_CONFIDENCE", 0.6); err != nil {
+			t.Fatalf("QueueForReview: %v", err)
+		}
+	}
+	ssn := addReviewSubject(store, "SSN", "logs-2024", account, "")
+	if err := svc.QueueForReview(ctx, ssn, nil, "LOW_CONFIDENCE", 0.6); err != nil {
+		t.Fatalf("QueueForReview: %v", err)
+	}
+
+	req := &BulkResolution{RuleName: "EMAIL", AssetPattern: "logs-*", Resolution: ResolutionRejected, ReviewedBy: reviewer, DryRun: true}
+	result, err := svc.BulkResolveReviewItems(ctx, req)
+	if err != nil {
+		t.Fatalf("BulkResolveReviewItems: %v", err)
+	}
+	if result.Matched != 2 || result.Resolved != 0 || store.reviewQueue[0].Status != models.ReviewQueueStatusPending {
+		t.Fatalf("expected a dry run to match 2 items and change nothing, got %+v", result)
+	}
+
+	req.DryRun = false
+	result, err = svc.BulkResolveReviewItems(ctx, req)
+	if err != nil {
+		t.Fatalf("BulkResolveReviewItems: %v", err)
+	}
+	if result.Matched != 2 || result.Resolved != 2 {
+		t.Errorf("expected 2 items resolved, got %+v", result)
+	}
+	wantStatus := []models.ReviewQueueStatus{
+		models.ReviewQueueStatusResolved, models.ReviewQueueStatusResolved,
+		models.ReviewQueueStatusPending, models.ReviewQueueStatusPending,
+	}
+	for i, item := range store.reviewQueue {
+		if item.Status != wantStatus[i] {
+			t.Errorf("item %d: expected status %s, got %s", i, wantStatus[i], item.Status)
+		}
+	}
+	if resolved := store.reviewQueue[0]; resolved.Resolution != ResolutionRejected || resolved.ResolvedBy == nil || *resolved.ResolvedBy != reviewer {
+		t.Errorf("expected the bulk decision to be recorded, got %+v", resolved)
+	}
+
+	for _, bad := range []*BulkResolution{
+		{Resolution: ResolutionRejected},
+		{RuleName: "EMAIL", Resolution: "MAYBE"},
+		{RuleName: "EMAIL", AssetPattern: "[", Resolution: ResolutionRejected},
+	} {
+		if _, err := svc.BulkResolveReviewItems(ctx, bad); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestService_EscalateOverdueReviews(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := newReviewService(store, 0)
+
+	var notified []*models.ReviewQueueEntry
+	svc.SetEscalationNotifier(func(ctx context.Context, entries []*models.ReviewQueueEntry) error {
+		notified = entries
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		id := addReviewSubject(store, "SSN", "db", uuid.New(), "")
+		if err := svc.QueueForReview(ctx, id, nil, "SENSITIVE_DATA", 0.9); err != nil {
+			t.Fatalf("QueueForReview: %v", err)
+		}
+	}
+	overdue := store.reviewQueue[0]
+	past := time.Now().Add(-time.Hour)
+	overdue.DueBy = &past
+	priority := overdue.Priority
+
+	entries, err := svc.EscalateOverdueReviews(ctx)
+	if err != nil {
+		t.Fatalf("EscalateOverdueReviews: %v", err)
+	}
+	if len(entries) != 1 || len(notified) != 1 || notified[0].ID != overdue.ID || notified[0].RuleName != "SSN" {
+		t.Fatalf("expected the overdue item to be escalated and notified, got %d entries", len(entries))
+	}
+	if item := store.reviewQueue[0]; item.EscalatedAt == nil || item.Priority != priority+100 {
+		t.Errorf("expected the item to be escalated with priority %d, got %+v", priority+100, item)
+	}
+
+	// Escalated items are not reported again
+	notified = nil
+	if entries, err = svc.EscalateOverdueReviews(ctx); err != nil || len(entries) != 0 || notified != nil {
+		t.Errorf("expected no second escalation, got %d entries, err %v", len(entries), err)
+	}
+}
+
+func TestService_ReviewMetrics(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	svc := newReviewService(store, 0)
+	alice, bob := uuid.New(), uuid.New()
+	now := time.Now()
+
+	// Four double-reviewed items, alice first and bob second; they disagree once
+	pairs := [][2]string{
+		{ResolutionConfirmed, ResolutionConfirmed},
+		{ResolutionConfirmed, ResolutionConfirmed},
+		{ResolutionRejected, ResolutionRejected},
+		{ResolutionConfirmed, ResolutionRejected},
+	}
+	for _, pair := range pairs {
+		queued, first, resolved := now.Add(-10*time.Hour), now.Add(-8*time.Hour), now.Add(-2*time.Hour)
+		store.reviewQueue = append(store.reviewQueue, &models.ClassificationReviewQueue{
+			ID: uuid.New(), Status: models.ReviewQueueStatusResolved, DoubleReview: true, CreatedAt: queued,
+			FirstReviewer: &alice, FirstResolution: pair[0], FirstResolvedAt: &first,
+			ResolvedBy: &bob, Resolution: pair[1], ResolvedAt: &resolved,
+		})
+	}
+	// An open item of bob's past its due time
+	store.reviewQueue = append(store.reviewQueue, &models.ClassificationReviewQueue{
+		ID: uuid.New(), Status: models.ReviewQueueStatusInReview, AssignedTo: &bob, DueBy: &now, CreatedAt: now,
+	})
+
+	metrics, err := svc.ReviewMetrics(ctx, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("ReviewMetrics: %v", err)
+	}
+	if metrics.DoubleReviewed != 4 || metrics.Agreement != 0.75 {
+		t.Errorf("expected 4 double reviews with 0.75 agreement, got %+v", metrics)
+	}
+	// Observed 0.75, chance 0.75*0.5 + 0.25*0.5 = 0.5
+	if math.Abs(metrics.Kappa-0.5) > 1e-9 {
+		t.Errorf("expected kappa 0.5, got %v", metrics.Kappa)
+	}
+	if len(metrics.Reviewers) != 2 {
+		t.Fatalf("expected 2 reviewers, got %d", len(metrics.Reviewers))
+	}
+	for _, st := range metrics.Reviewers {
+		if st.Reviews != 4 || st.DoubleReviewed != 4 || st.Agreed != 3 || math.Abs(st.PerDay-4) > 1e-6 {
+			t.Errorf("unexpected stats %+v", st)
+		}
+		switch st.ReviewerID {
+		case alice:
+			if st.MedianHours != 2 || st.Open != 0 {
+				t.Errorf("expected alice to take 2h with nothing open, got %+v", st)
+			}
+		case bob:
+			if st.MedianHours != 6 || st.Open != 1 || st.Overdue != 1 {
+				t.Errorf("expected bob to take 6h with one overdue item, got %+v", st)
+			}
+		}
+	}
+}
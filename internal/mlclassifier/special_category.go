@@ -0,0 +1,37 @@
+package mlclassifier
+
+import (
+	"math"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+// identifyingEntityTypes are the NER entity types that identify a person
+var identifyingEntityTypes = map[string]bool{
+	"PERSON":  true,
+	"EMAIL":   true,
+	"PHONE":   true,
+	"SSN":     true,
+	"ADDRESS": true,
+}
+
+// AdjustForSpecialCategory adjusts the confidence of a GDPR special-category
+// match by whether NER found someone identifiable within window bytes of the
+// match at offset. Article 9 only covers data about identifiable people, so a
+// match with no identifier nearby is penalized when NER ran.
+func AdjustForSpecialCategory(confidence float64, category models.Category, offset, window int, entities []Entity, nerRan bool) float64 {
+	if !category.IsSpecial() || !nerRan {
+		return confidence
+	}
+	if offset >= 0 {
+		for _, entity := range entities {
+			if !identifyingEntityTypes[entity.Type] {
+				continue
+			}
+			if entity.EndOffset >= offset-window && entity.StartOffset <= offset+window {
+				return math.Min(confidence*1.15, 1.0)
+			}
+		}
+	}
+	return confidence * 0.7
+}
@@ -0,0 +1,254 @@
+//go:build ignore
+
+// gen_tiny_ner writes tiny_ner.onnx, a one-layer transformer token classifier
+// used by the ONNX runtime tests. Run from the package directory:
+//
+//	go run testdata/gen_tiny_ner.go
+//
+// The model maps input_ids [batch, sequence] and attention_mask [batch,
+// sequence] to logits [batch, sequence, 3] over the labels O, B-PII and I-PII.
+// Token 2 is tagged B-PII and token 3 I-PII; the embeddings are chosen so the
+// attention layer mixes context without changing those labels.
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	dim       = 4
+	vocabSize = 8
+	maxPos    = 16
+	numLabels = 3
+)
+
+func main() {
+	var graph []byte
+	for _, n := range nodes() {
+		graph = appendMessage(graph, 1, n)
+	}
+	graph = appendString(graph, 2, "tiny_ner")
+	for _, init := range initializers() {
+		graph = appendMessage(graph, 5, init)
+	}
+	graph = appendMessage(graph, 11, valueInfo("input_ids", 7, "batch", "sequence"))
+	graph = appendMessage(graph, 11, valueInfo("attention_mask", 7, "batch", "sequence"))
+	graph = appendMessage(graph, 12, valueInfo("logits", 1, "batch", "sequence", numLabels))
+
+	var opset []byte
+	opset = appendString(opset, 1, "")
+	opset = appendVarint(opset, 2, 17)
+
+	var model []byte
+	model = appendVarint(model, 1, 8)
+	model = appendString(model, 2, "dspm-testdata")
+	model = appendMessage(model, 7, graph)
+	model = appendMessage(model, 8, opset)
+
+	if err := os.WriteFile("testdata/tiny_ner.onnx", model, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func nodes() [][]byte {
+	return [][]byte{
+		// Token and position embeddings, sized to the runtime sequence length
+		node("Gather", []string{"word_embeddings", "input_ids"}, []string{"tok"}),
+		node("Shape", []string{"input_ids"}, []string{"ids_shape"}),
+		node("Gather", []string{"ids_shape", "one"}, []string{"seq_len"}, intAttr("axis", 0)),
+		node("Range", []string{"zero", "seq_len", "one"}, []string{"positions"}),
+		node("Gather", []string{"position_embeddings", "positions"}, []string{"pos"}),
+		node("Add", []string{"tok", "pos"}, []string{"embedded"}),
+		node("LayerNormalization", []string{"embedded", "ln_scale", "ln_bias"}, []string{"hidden"},
+			floatAttr("epsilon", 1e-5), intAttr("axis", -1)),
+
+		// Single-head self-attention with padding masked out
+		node("MatMul", []string{"hidden", "w_query"}, []string{"query"}),
+		node("MatMul", []string{"hidden", "w_key"}, []string{"key"}),
+		node("MatMul", []string{"hidden", "w_value"}, []string{"value"}),
+		node("Transpose", []string{"key"}, []string{"key_t"}, intsAttr("perm", 0, 2, 1)),
+		node("MatMul", []string{"query", "key_t"}, []string{"scores"}),
+		node("Mul", []string{"scores", "attn_scale"}, []string{"scaled"}),
+		node("Cast", []string{"attention_mask"}, []string{"mask_f"}, intAttr("to", 1)),
+		node("Sub", []string{"one_f", "mask_f"}, []string{"inverted"}),
+		node("Mul", []string{"inverted", "mask_penalty"}, []string{"mask_bias"}),
+		node("Unsqueeze", []string{"mask_bias", "axis_one"}, []string{"mask_bias_3d"}),
+		node("Add", []string{"scaled", "mask_bias_3d"}, []string{"masked"}),
+		node("Softmax", []string{"masked"}, []string{"weights"}, intAttr("axis", -1)),
+		node("MatMul", []string{"weights", "value"}, []string{"context"}),
+		node("Add", []string{"hidden", "context"}, []string{"residual"}),
+
+		// Token classification head
+		node("MatMul", []string{"residual", "w_out"}, []string{"projected"}),
+		node("Add", []string{"projected", "b_out"}, []string{"logits"}),
+	}
+}
+
+func initializers() [][]byte {
+	word := []float32{
+		0, 0, 3, 0, // 0 [PAD]
+		0, 0, 3, 0.5, // 1 O
+		3, 0, 0, 0, // 2 B-PII
+		0, 3, 0, 0, // 3 I-PII
+		0, 0, 3, 1, // 4 O
+		2.5, 0, 0.5, 0, // 5 B-PII
+		0, 2.5, 0, 0.5, // 6 I-PII
+		0, 0, 2, 2, // 7 O
+	}
+	pos := make([]float32, maxPos*dim)
+	for k := range pos {
+		pos[k] = 0.05 * float32(k%5-2)
+	}
+	query := []float32{
+		0.3, -0.2, 0.1, 0,
+		0.1, 0.4, -0.3, 0.2,
+		-0.2, 0.1, 0.3, -0.1,
+		0, 0.2, 0.1, 0.3,
+	}
+	key := []float32{
+		0.2, 0.1, -0.1, 0.3,
+		-0.3, 0.2, 0.4, 0,
+		0.1, -0.2, 0.2, 0.1,
+		0.2, 0, -0.1, 0.2,
+	}
+	value := []float32{
+		0.1, 0.02, 0, -0.02,
+		0, 0.1, 0.02, 0,
+		0.02, 0, 0.1, 0.02,
+		0, -0.02, 0, 0.1,
+	}
+	out := []float32{
+		0, 2, 0,
+		0, 0, 2,
+		2, 0, 0,
+		0.5, 0, 0,
+	}
+
+	return [][]byte{
+		floatTensor("word_embeddings", []int64{vocabSize, dim}, word),
+		floatTensor("position_embeddings", []int64{maxPos, dim}, pos),
+		floatTensor("ln_scale", []int64{dim}, []float32{1, 1, 1, 1}),
+		floatTensor("ln_bias", []int64{dim}, []float32{0, 0, 0, 0.1}),
+		floatTensor("w_query", []int64{dim, dim}, query),
+		floatTensor("w_key", []int64{dim, dim}, key),
+		floatTensor("w_value", []int64{dim, dim}, value),
+		floatTensor("attn_scale", nil, []float32{0.5}),
+		floatTensor("one_f", nil, []float32{1}),
+		floatTensor("mask_penalty", nil, []float32{-10000}),
+		floatTensor("w_out", []int64{dim, numLabels}, out),
+		floatTensor("b_out", []int64{numLabels}, []float32{0.1, 0, 0}),
+		int64Tensor("zero", nil, []int64{0}),
+		int64Tensor("one", nil, []int64{1}),
+		int64Tensor("axis_one", []int64{1}, []int64{1}),
+	}
+}
+
+func node(op string, inputs, outputs []string, attrs ...[]byte) []byte {
+	var b []byte
+	for _, in := range inputs {
+		b = appendString(b, 1, in)
+	}
+	for _, out := range outputs {
+		b = appendString(b, 2, out)
+	}
+	b = appendString(b, 3, op+"_"+outputs[0])
+	b = appendString(b, 4, op)
+	for _, a := range attrs {
+		b = appendMessage(b, 5, a)
+	}
+	return b
+}
+
+func intAttr(name string, v int64) []byte {
+	b := appendString(nil, 1, name)
+	b = appendVarint(b, 3, uint64(v))
+	return appendVarint(b, 20, 2)
+}
+
+func floatAttr(name string, v float32) []byte {
+	b := appendString(nil, 1, name)
+	b = protowire.AppendTag(b, 2, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, math.Float32bits(v))
+	return appendVarint(b, 20, 1)
+}
+
+func intsAttr(name string, vs ...int64) []byte {
+	b := appendString(nil, 1, name)
+	for _, v := range vs {
+		b = appendVarint(b, 8, uint64(v))
+	}
+	return appendVarint(b, 20, 7)
+}
+
+// floatTensor stores weights as raw little-endian data, as exporters do
+func floatTensor(name string, dims []int64, values []float32) []byte {
+	var b []byte
+	for _, d := range dims {
+		b = appendVarint(b, 1, uint64(d))
+	}
+	b = appendVarint(b, 2, 1)
+	b = appendString(b, 8, name)
+	raw := make([]byte, 4*len(values))
+	for k, v := range values {
+		binary.LittleEndian.PutUint32(raw[4*k:], math.Float32bits(v))
+	}
+	b = protowire.AppendTag(b, 9, protowire.BytesType)
+	return protowire.AppendBytes(b, raw)
+}
+
+// int64Tensor stores values in the packed int64_data field
+func int64Tensor(name string, dims []int64, values []int64) []byte {
+	var b []byte
+	for _, d := range dims {
+		b = appendVarint(b, 1, uint64(d))
+	}
+	b = appendVarint(b, 2, 7)
+	var packed []byte
+	for _, v := range values {
+		packed = protowire.AppendVarint(packed, uint64(v))
+	}
+	b = protowire.AppendTag(b, 7, protowire.BytesType)
+	b = protowire.AppendBytes(b, packed)
+	return appendString(b, 8, name)
+}
+
+// valueInfo declares a tensor; string dims are symbolic, int dims are fixed
+func valueInfo(name string, elemType uint64, dims ...interface{}) []byte {
+	var shape []byte
+	for _, d := range dims {
+		var dimension []byte
+		switch v := d.(type) {
+		case string:
+			dimension = appendString(dimension, 2, v)
+		case int:
+			dimension = appendVarint(dimension, 1, uint64(v))
+		}
+		shape = appendMessage(shape, 1, dimension)
+	}
+	tensorType := appendVarint(nil, 1, elemType)
+	tensorType = appendMessage(tensorType, 2, shape)
+	typeProto := appendMessage(nil, 1, tensorType)
+
+	b := appendString(nil, 1, name)
+	return appendMessage(b, 2, typeProto)
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
@@ -2,6 +2,7 @@ package mlclassifier
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"regexp"
 	"sort"
@@ -25,6 +26,66 @@ type Tokenizer struct {
 
 	// Pre-tokenization regex
 	preTokenizeRe *regexp.Regexp
+
+	// hf is set when the tokenizer was loaded from a HuggingFace tokenizer.json
+	hf *hfTokenizer
+}
+
+// Encoding is the tokenized form of one text. Offsets are byte ranges into
+// the original text; special tokens such as [CLS] have an empty range and a
+// WordIDs entry of -1.
+type Encoding struct {
+	IDs               []int32
+	Tokens            []string
+	Offsets           [][2]int
+	AttentionMask     []int32
+	WordIDs           []int
+	SpecialTokensMask []int32
+}
+
+// Len returns the number of tokens
+func (e *Encoding) Len() int {
+	return len(e.IDs)
+}
+
+func (e *Encoding) append(id int32, token string, offsets [2]int, word int, special bool) {
+	e.IDs = append(e.IDs, id)
+	e.Tokens = append(e.Tokens, token)
+	e.Offsets = append(e.Offsets, offsets)
+	e.AttentionMask = append(e.AttentionMask, 1)
+	e.WordIDs = append(e.WordIDs, word)
+	if special {
+		e.SpecialTokensMask = append(e.SpecialTokensMask, 1)
+	} else {
+		e.SpecialTokensMask = append(e.SpecialTokensMask, 0)
+	}
+}
+
+func (e *Encoding) truncate(limit int) {
+	if len(e.IDs) <= limit {
+		return
+	}
+	e.IDs = e.IDs[:limit]
+	e.Tokens = e.Tokens[:limit]
+	e.Offsets = e.Offsets[:limit]
+	e.AttentionMask = e.AttentionMask[:limit]
+	e.WordIDs = e.WordIDs[:limit]
+	e.SpecialTokensMask = e.SpecialTokensMask[:limit]
+}
+
+// wrap surrounds the tokens with special tokens
+func (e *Encoding) wrap(prefix, suffix []hfSpecialToken) {
+	wrapped := &Encoding{}
+	for _, sp := range prefix {
+		wrapped.append(sp.id, sp.token, [2]int{}, -1, true)
+	}
+	for i := range e.IDs {
+		wrapped.append(e.IDs[i], e.Tokens[i], e.Offsets[i], e.WordIDs[i], e.SpecialTokensMask[i] == 1)
+	}
+	for _, sp := range suffix {
+		wrapped.append(sp.id, sp.token, [2]int{}, -1, true)
+	}
+	*e = *wrapped
 }
 
 // BPEMerge represents a BPE merge operation
@@ -43,6 +104,10 @@ type TokenizerConfig struct {
 	ClsToken       string `json:"cls_token"`
 	SepToken       string `json:"sep_token"`
 	MaskToken      string `json:"mask_token"`
+
+	// TokenizerFile is a HuggingFace tokenizer.json. When set it replaces
+	// VocabFile and MergesFile.
+	TokenizerFile string `json:"tokenizer_file"`
 }
 
 // NewTokenizer creates a new BPE tokenizer
@@ -53,22 +118,36 @@ func NewTokenizer(config TokenizerConfig) (*Tokenizer, error) {
 		maxLength:     config.MaxLength,
 	}
 
-	if config.MaxLength == 0 {
+	if config.TokenizerFile != "" {
+		hf, err := loadHFTokenizer(config.TokenizerFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading tokenizer: %w", err)
+		}
+		t.hf = hf
+		t.vocab = hf.vocab
+		if config.MaxLength == 0 && hf.maxLength > 0 {
+			t.maxLength = hf.maxLength
+		}
+	}
+
+	if t.maxLength == 0 {
 		t.maxLength = 512
 	}
 
-	// Load vocabulary if provided
-	if config.VocabFile != "" {
+	// Load vocabulary if provided; tokenizer.json carries its own
+	switch {
+	case t.hf != nil:
+	case config.VocabFile != "":
 		if err := t.loadVocab(config.VocabFile); err != nil {
 			return nil, err
 		}
-	} else {
+	default:
 		// Initialize with basic vocabulary
 		t.initializeBasicVocab()
 	}
 
 	// Load merges if provided
-	if config.MergesFile != "" {
+	if config.MergesFile != "" && t.hf == nil {
 		if err := t.loadMerges(config.MergesFile); err != nil {
 			return nil, err
 		}
@@ -76,6 +155,16 @@ func NewTokenizer(config TokenizerConfig) (*Tokenizer, error) {
 
 	// Set special token IDs
 	t.setupSpecialTokens(config)
+	if t.hf != nil {
+		t.padToken = t.hf.padID
+		t.unkToken = t.hf.unkID
+		if len(t.hf.prefix) > 0 {
+			t.clsToken = t.hf.prefix[0].id
+		}
+		if len(t.hf.suffix) > 0 {
+			t.sepToken = t.hf.suffix[len(t.hf.suffix)-1].id
+		}
+	}
 
 	// Pre-tokenization pattern (splits on whitespace and punctuation)
 	t.preTokenizeRe = regexp.MustCompile(`'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+`)
@@ -209,43 +298,52 @@ func (t *Tokenizer) getOrAssignID(token string, defaultID int32) int32 {
 
 // Encode tokenizes text and returns input IDs and attention mask
 func (t *Tokenizer) Encode(text string) ([]int32, []int32) {
-	// Lowercase and clean text
-	text = strings.ToLower(strings.TrimSpace(text))
-
-	// Pre-tokenize
-	tokens := t.preTokenize(text)
+	enc := t.EncodeWithOffsets(text)
 
-	// Apply BPE
-	bpeTokens := t.applyBPE(tokens)
+	inputIDs := append(make([]int32, 0, t.maxLength), enc.IDs...)
+	attentionMask := append(make([]int32, 0, t.maxLength), enc.AttentionMask...)
 
-	// Convert to IDs
-	inputIDs := make([]int32, 0, len(bpeTokens)+2)
+	// Truncate or pad to max length
+	inputIDs, attentionMask = t.padOrTruncate(inputIDs, attentionMask)
 
-	// Add [CLS] token
-	inputIDs = append(inputIDs, t.clsToken)
+	return inputIDs, attentionMask
+}
 
-	// Add token IDs
-	for _, token := range bpeTokens {
-		if id, ok := t.vocab[token]; ok {
-			inputIDs = append(inputIDs, id)
-		} else {
-			inputIDs = append(inputIDs, t.unkToken)
-		}
+// EncodeWithOffsets tokenizes text without padding. Long texts are truncated
+// to the maximum length, keeping the [CLS] and [SEP] tokens.
+func (t *Tokenizer) EncodeWithOffsets(text string) *Encoding {
+	if t.hf != nil {
+		return t.hf.encode(text, t.maxLength)
 	}
 
-	// Add [SEP] token
-	inputIDs = append(inputIDs, t.sepToken)
-
-	// Create attention mask
-	attentionMask := make([]int32, len(inputIDs))
-	for i := range attentionMask {
-		attentionMask[i] = 1
+	// Lowercase and clean text
+	n := newNormalizedText(text, 0)
+	n.strip(true, true)
+	lowercase(n)
+	normalized := string(n.runes)
+
+	enc := &Encoding{}
+	pos, runeIdx := 0, 0
+	for word, loc := range t.preTokenizeRe.FindAllStringIndex(normalized, -1) {
+		runeIdx += utf8.RuneCountInString(normalized[pos:loc[0]])
+		pos = loc[0]
+
+		// Apply BPE, tracking how many characters each token covers
+		pieces, widths := t.bpeWord(normalized[loc[0]:loc[1]])
+		for k, piece := range pieces {
+			id, ok := t.vocab[piece]
+			if !ok {
+				id = t.unkToken
+			}
+			enc.append(id, piece, n.span(runeIdx, runeIdx+widths[k]), word, false)
+			runeIdx += widths[k]
+		}
+		pos = loc[1]
 	}
 
-	// Truncate or pad to max length
-	inputIDs, attentionMask = t.padOrTruncate(inputIDs, attentionMask)
-
-	return inputIDs, attentionMask
+	enc.truncate(max(t.maxLength-2, 0))
+	enc.wrap([]hfSpecialToken{{id: t.clsToken, token: "[CLS]"}}, []hfSpecialToken{{id: t.sepToken, token: "[SEP]"}})
+	return enc
 }
 
 // EncodeBatch tokenizes multiple texts
@@ -271,22 +369,33 @@ func (t *Tokenizer) applyBPE(tokens []string) []string {
 	var result []string
 
 	for _, token := range tokens {
-		if token == "" {
-			continue
-		}
+		pieces, _ := t.bpeWord(token)
+		result = append(result, pieces...)
+	}
+
+	return result
+}
 
-		// Split token into characters
-		chars := splitIntoChars(token)
+// bpeWord applies BPE merges to one pre-token, returning the pieces and the
+// number of characters of the token each piece covers
+func (t *Tokenizer) bpeWord(token string) ([]string, []int) {
+	if token == "" {
+		return nil, nil
+	}
 
-		// Apply merges
-		for _, merge := range t.merges {
-			chars = applyMerge(chars, merge.A, merge.B)
-		}
+	// Split token into characters
+	chars := splitIntoChars(token)
+	widths := make([]int, len(chars))
+	for i := range widths {
+		widths[i] = 1
+	}
 
-		result = append(result, chars...)
+	// Apply merges
+	for _, merge := range t.merges {
+		chars, widths = applyMerge(chars, widths, merge.A, merge.B)
 	}
 
-	return result
+	return chars, widths
 }
 
 // splitIntoChars splits a string into individual characters/runes
@@ -303,19 +412,22 @@ func splitIntoChars(s string) []string {
 }
 
 // applyMerge applies a single BPE merge operation
-func applyMerge(chars []string, a, b string) []string {
+func applyMerge(chars []string, widths []int, a, b string) ([]string, []int) {
 	var result []string
+	var resultWidths []int
 	i := 0
 	for i < len(chars) {
 		if i < len(chars)-1 && chars[i] == a && chars[i+1] == b {
 			result = append(result, a+b)
+			resultWidths = append(resultWidths, widths[i]+widths[i+1])
 			i += 2
 		} else {
 			result = append(result, chars[i])
+			resultWidths = append(resultWidths, widths[i])
 			i++
 		}
 	}
-	return result
+	return result, resultWidths
 }
 
 // padOrTruncate adjusts sequence to max length
@@ -357,6 +469,7 @@ func (t *Tokenizer) Decode(ids []int32) string {
 	// Join tokens and clean up
 	text := strings.Join(tokens, "")
 	text = strings.ReplaceAll(text, "##", "")
+	text = strings.ReplaceAll(text, "▁", " ")
 	text = strings.TrimSpace(text)
 
 	return text
@@ -0,0 +1,1072 @@
+package mlclassifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// hfTokenizer implements the HuggingFace tokenizers pipeline described by a
+// tokenizer.json file: added tokens, normalizer, pre-tokenizer, model
+// (WordPiece or Unigram, the SentencePiece algorithm) and post-processor.
+// Every step records where each character came from, so tokens carry byte
+// offsets into the original text.
+type hfTokenizer struct {
+	normalizer   hfNormalizer
+	preTokenizer hfPreTokenizer
+	model        hfModel
+	vocab        map[string]int32
+	addedTokens  []hfAddedToken
+	prefix       []hfSpecialToken
+	suffix       []hfSpecialToken
+	unkID        int32
+	padID        int32
+	maxLength    int
+}
+
+type hfSpecialToken struct {
+	id    int32
+	token string
+}
+
+type hfTokenizerFile struct {
+	Truncation *struct {
+		MaxLength int `json:"max_length"`
+	} `json:"truncation"`
+	Padding *struct {
+		PadID    int32  `json:"pad_id"`
+		PadToken string `json:"pad_token"`
+	} `json:"padding"`
+	AddedTokens   []hfAddedToken  `json:"added_tokens"`
+	Normalizer    json.RawMessage `json:"normalizer"`
+	PreTokenizer  json.RawMessage `json:"pre_tokenizer"`
+	PostProcessor json.RawMessage `json:"post_processor"`
+	Model         json.RawMessage `json:"model"`
+}
+
+type hfAddedToken struct {
+	ID         int32  `json:"id"`
+	Content    string `json:"content"`
+	SingleWord bool   `json:"single_word"`
+	Lstrip     bool   `json:"lstrip"`
+	Rstrip     bool   `json:"rstrip"`
+	Special    bool   `json:"special"`
+}
+
+// hfComponent holds the fields of any normalizer or pre-tokenizer; which ones
+// are set depends on Type
+type hfComponent struct {
+	Type          string            `json:"type"`
+	Normalizers   []json.RawMessage `json:"normalizers"`
+	Pretokenizers []json.RawMessage `json:"pretokenizers"`
+
+	CleanText          *bool `json:"clean_text"`
+	HandleChineseChars *bool `json:"handle_chinese_chars"`
+	StripAccents       *bool `json:"strip_accents"`
+	Lowercase          *bool `json:"lowercase"`
+
+	Pattern *struct {
+		String *string `json:"String"`
+		Regex  *string `json:"Regex"`
+	} `json:"pattern"`
+	Content  string `json:"content"`
+	Behavior string `json:"behavior"`
+	Invert   bool   `json:"invert"`
+
+	Prepend    string `json:"prepend"`
+	StripLeft  *bool  `json:"strip_left"`
+	StripRight *bool  `json:"strip_right"`
+
+	Replacement      string `json:"replacement"`
+	AddPrefixSpace   *bool  `json:"add_prefix_space"`
+	PrependScheme    string `json:"prepend_scheme"`
+	Split            *bool  `json:"split"`
+	IndividualDigits bool   `json:"individual_digits"`
+}
+
+// loadHFTokenizer reads a tokenizer.json file
+func loadHFTokenizer(path string) (*hfTokenizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file hfTokenizerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	h := &hfTokenizer{addedTokens: file.AddedTokens}
+	if h.normalizer, err = buildNormalizer(file.Normalizer); err != nil {
+		return nil, fmt.Errorf("normalizer: %w", err)
+	}
+	if h.preTokenizer, err = buildPreTokenizer(file.PreTokenizer); err != nil {
+		return nil, fmt.Errorf("pre_tokenizer: %w", err)
+	}
+	if err := h.buildModel(file.Model); err != nil {
+		return nil, fmt.Errorf("model: %w", err)
+	}
+	for _, added := range file.AddedTokens {
+		if _, ok := h.vocab[added.Content]; !ok {
+			h.vocab[added.Content] = added.ID
+		}
+	}
+	if err := h.buildPostProcessor(file.PostProcessor); err != nil {
+		return nil, fmt.Errorf("post_processor: %w", err)
+	}
+
+	if file.Truncation != nil {
+		h.maxLength = file.Truncation.MaxLength
+	}
+	if file.Padding != nil {
+		h.padID = file.Padding.PadID
+	} else {
+		for _, pad := range []string{"[PAD]", "<pad>"} {
+			if id, ok := h.vocab[pad]; ok {
+				h.padID = id
+				break
+			}
+		}
+	}
+
+	// Longest added tokens are matched first
+	sort.SliceStable(h.addedTokens, func(i, j int) bool {
+		return len(h.addedTokens[i].Content) > len(h.addedTokens[j].Content)
+	})
+	return h, nil
+}
+
+// encode tokenizes text, truncating to maxLength tokens including the
+// special tokens added by the post-processor. maxLength <= 0 disables truncation.
+func (h *hfTokenizer) encode(text string, maxLength int) *Encoding {
+	enc := &Encoding{}
+	word := 0
+	for i, section := range h.splitAddedTokens(text) {
+		if section.added != nil {
+			enc.append(section.added.ID, section.added.Content, [2]int{section.start, section.end}, word, false)
+			word++
+			continue
+		}
+
+		n := newNormalizedText(text[section.start:section.end], section.start)
+		if h.normalizer != nil {
+			h.normalizer(n)
+		}
+		pieces := []*normalizedText{n}
+		if h.preTokenizer != nil {
+			pieces = h.preTokenizer(pieces, i == 0)
+		}
+		for _, piece := range pieces {
+			if len(piece.runes) == 0 {
+				continue
+			}
+			for _, tok := range h.model.tokenize(piece.runes) {
+				enc.append(tok.id, tok.value, piece.span(tok.start, tok.end), word, false)
+			}
+			word++
+		}
+	}
+
+	if maxLength > 0 {
+		limit := max(maxLength-len(h.prefix)-len(h.suffix), 0)
+		enc.truncate(limit)
+	}
+	enc.wrap(h.prefix, h.suffix)
+	return enc
+}
+
+type textSection struct {
+	start, end int
+	added      *hfAddedToken
+}
+
+// splitAddedTokens separates occurrences of added tokens (such as [MASK])
+// from the text around them, which is normalized and tokenized as usual
+func (h *hfTokenizer) splitAddedTokens(text string) []textSection {
+	if len(h.addedTokens) == 0 {
+		return []textSection{{start: 0, end: len(text)}}
+	}
+
+	var sections []textSection
+	last := 0
+	for i := 0; i < len(text); {
+		added := h.matchAddedToken(text, i)
+		if added == nil {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+			continue
+		}
+		start, end := i, i+len(added.Content)
+		if added.Lstrip {
+			for start > last && unicode.IsSpace(rune(text[start-1])) {
+				start--
+			}
+		}
+		if added.Rstrip {
+			for end < len(text) && unicode.IsSpace(rune(text[end])) {
+				end++
+			}
+		}
+		if start > last {
+			sections = append(sections, textSection{start: last, end: start})
+		}
+		sections = append(sections, textSection{start: i, end: i + len(added.Content), added: added})
+		last, i = end, end
+	}
+	if last < len(text) {
+		sections = append(sections, textSection{start: last, end: len(text)})
+	}
+	return sections
+}
+
+func (h *hfTokenizer) matchAddedToken(text string, i int) *hfAddedToken {
+	for k := range h.addedTokens {
+		added := &h.addedTokens[k]
+		if added.Content == "" || !strings.HasPrefix(text[i:], added.Content) {
+			continue
+		}
+		if added.SingleWord {
+			before, _ := utf8.DecodeLastRuneInString(text[:i])
+			after, _ := utf8.DecodeRuneInString(text[i+len(added.Content):])
+			if i > 0 && isWordRune(before) || i+len(added.Content) < len(text) && isWordRune(after) {
+				continue
+			}
+		}
+		return added
+	}
+	return nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Models
+
+type hfModel interface {
+	// tokenize splits one pre-tokenized word. Token offsets are rune indexes
+	// into word.
+	tokenize(word []rune) []hfToken
+}
+
+type hfToken struct {
+	id         int32
+	value      string
+	start, end int
+}
+
+type hfModelConfig struct {
+	Type                    string          `json:"type"`
+	UnkToken                string          `json:"unk_token"`
+	UnkID                   *int32          `json:"unk_id"`
+	ContinuingSubwordPrefix *string         `json:"continuing_subword_prefix"`
+	MaxInputCharsPerWord    int             `json:"max_input_chars_per_word"`
+	Vocab                   json.RawMessage `json:"vocab"`
+}
+
+func (h *hfTokenizer) buildModel(raw json.RawMessage) error {
+	var cfg hfModelConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return err
+	}
+
+	switch cfg.Type {
+	case "WordPiece":
+		vocab := make(map[string]int32)
+		if err := json.Unmarshal(cfg.Vocab, &vocab); err != nil {
+			return fmt.Errorf("WordPiece vocab: %w", err)
+		}
+		m := &wordPieceModel{vocab: vocab, prefix: "##", maxChars: 100, unkToken: cfg.UnkToken}
+		if cfg.ContinuingSubwordPrefix != nil {
+			m.prefix = *cfg.ContinuingSubwordPrefix
+		}
+		if cfg.MaxInputCharsPerWord > 0 {
+			m.maxChars = cfg.MaxInputCharsPerWord
+		}
+		unk, ok := vocab[cfg.UnkToken]
+		if !ok {
+			return fmt.Errorf("unk_token %q is not in the vocabulary", cfg.UnkToken)
+		}
+		m.unkID = unk
+		h.model, h.vocab, h.unkID = m, vocab, unk
+
+	case "Unigram":
+		var pieces [][2]json.RawMessage
+		if err := json.Unmarshal(cfg.Vocab, &pieces); err != nil {
+			return fmt.Errorf("Unigram vocab: %w", err)
+		}
+		m := &unigramModel{vocab: make(map[string]int32, len(pieces)), scores: make([]float64, len(pieces))}
+		minScore := math.Inf(1)
+		for id, p := range pieces {
+			var piece string
+			var score float64
+			if err := json.Unmarshal(p[0], &piece); err != nil {
+				return fmt.Errorf("Unigram vocab entry %d: %w", id, err)
+			}
+			if err := json.Unmarshal(p[1], &score); err != nil {
+				return fmt.Errorf("Unigram vocab entry %d: %w", id, err)
+			}
+			m.vocab[piece] = int32(id)
+			m.scores[id] = score
+			m.maxPieceLen = max(m.maxPieceLen, utf8.RuneCountInString(piece))
+			minScore = math.Min(minScore, score)
+		}
+		if cfg.UnkID == nil || int(*cfg.UnkID) >= len(pieces) {
+			return fmt.Errorf("Unigram model needs a valid unk_id")
+		}
+		m.unkID = *cfg.UnkID
+		if err := json.Unmarshal(pieces[m.unkID][0], &m.unkToken); err != nil {
+			return err
+		}
+		// SentencePiece scores unknown characters below every known piece
+		m.unkScore = minScore - 10
+		h.model, h.vocab, h.unkID = m, m.vocab, m.unkID
+
+	default:
+		return fmt.Errorf("unsupported model type %q (supported: WordPiece, Unigram)", cfg.Type)
+	}
+	return nil
+}
+
+// wordPieceModel is the greedy longest-match-first algorithm used by BERT
+type wordPieceModel struct {
+	vocab    map[string]int32
+	prefix   string
+	maxChars int
+	unkToken string
+	unkID    int32
+}
+
+func (m *wordPieceModel) tokenize(word []rune) []hfToken {
+	unknown := []hfToken{{id: m.unkID, value: m.unkToken, start: 0, end: len(word)}}
+	if len(word) > m.maxChars {
+		return unknown
+	}
+
+	var tokens []hfToken
+	for start := 0; start < len(word); {
+		end := len(word)
+		found := false
+		for ; end > start; end-- {
+			sub := string(word[start:end])
+			if start > 0 {
+				sub = m.prefix + sub
+			}
+			if id, ok := m.vocab[sub]; ok {
+				tokens = append(tokens, hfToken{id: id, value: sub, start: start, end: end})
+				found = true
+				break
+			}
+		}
+		// A word with any unmatched part becomes a single unknown token
+		if !found {
+			return unknown
+		}
+		start = end
+	}
+	return tokens
+}
+
+// unigramModel picks the segmentation with the highest total piece score
+// (Viterbi), as SentencePiece does
+type unigramModel struct {
+	vocab       map[string]int32
+	scores      []float64
+	maxPieceLen int
+	unkID       int32
+	unkToken    string
+	unkScore    float64
+}
+
+func (m *unigramModel) tokenize(word []rune) []hfToken {
+	n := len(word)
+	best := make([]float64, n+1)
+	from := make([]int, n+1)
+	ids := make([]int32, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(-1)
+	}
+
+	for end := 1; end <= n; end++ {
+		for start := max(0, end-m.maxPieceLen); start < end; start++ {
+			if math.IsInf(best[start], -1) {
+				continue
+			}
+			id, ok := m.vocab[string(word[start:end])]
+			if !ok {
+				if start != end-1 {
+					continue
+				}
+				// Characters outside the vocabulary become unknown tokens
+				id = m.unkID
+			}
+			score := best[start] + m.scores[id]
+			if !ok {
+				score = best[start] + m.unkScore
+			}
+			if score > best[end] {
+				best[end], from[end], ids[end] = score, start, id
+			}
+		}
+	}
+
+	var tokens []hfToken
+	for end := n; end > 0; end = from[end] {
+		start := from[end]
+		tok := hfToken{id: ids[end], value: string(word[start:end]), start: start, end: end}
+		if tok.id == m.unkID {
+			tok.value = m.unkToken
+			// Consecutive unknown characters are fused into one token
+			if len(tokens) > 0 && tokens[len(tokens)-1].id == m.unkID {
+				tokens[len(tokens)-1].start = start
+				continue
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+	for i, j := 0, len(tokens)-1; i < j; i, j = i+1, j-1 {
+		tokens[i], tokens[j] = tokens[j], tokens[i]
+	}
+	return tokens
+}
+
+// Post-processors
+
+type hfPostProcessorConfig struct {
+	Type       string            `json:"type"`
+	Processors []json.RawMessage `json:"processors"`
+	Single     []struct {
+		SpecialToken *struct {
+			ID string `json:"id"`
+		} `json:"SpecialToken"`
+		Sequence *struct {
+			ID string `json:"id"`
+		} `json:"Sequence"`
+	} `json:"single"`
+	SpecialTokens map[string]struct {
+		IDs    []int32  `json:"ids"`
+		Tokens []string `json:"tokens"`
+	} `json:"special_tokens"`
+	Cls []json.RawMessage `json:"cls"`
+	Sep []json.RawMessage `json:"sep"`
+}
+
+// buildPostProcessor reads the special tokens added around a single sequence
+func (h *hfTokenizer) buildPostProcessor(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var cfg hfPostProcessorConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return err
+	}
+
+	switch cfg.Type {
+	case "TemplateProcessing":
+		seen := false
+		for _, item := range cfg.Single {
+			if item.Sequence != nil {
+				seen = true
+				continue
+			}
+			if item.SpecialToken == nil {
+				continue
+			}
+			special, ok := cfg.SpecialTokens[item.SpecialToken.ID]
+			if !ok || len(special.IDs) != len(special.Tokens) {
+				return fmt.Errorf("undefined special token %q", item.SpecialToken.ID)
+			}
+			for k, id := range special.IDs {
+				tok := hfSpecialToken{id: id, token: special.Tokens[k]}
+				if seen {
+					h.suffix = append(h.suffix, tok)
+				} else {
+					h.prefix = append(h.prefix, tok)
+				}
+			}
+		}
+	case "BertProcessing", "RobertaProcessing":
+		cls, err := parseSpecialPair(cfg.Cls)
+		if err != nil {
+			return fmt.Errorf("cls: %w", err)
+		}
+		sep, err := parseSpecialPair(cfg.Sep)
+		if err != nil {
+			return fmt.Errorf("sep: %w", err)
+		}
+		h.prefix, h.suffix = []hfSpecialToken{cls}, []hfSpecialToken{sep}
+	case "Sequence":
+		for _, p := range cfg.Processors {
+			if err := h.buildPostProcessor(p); err != nil {
+				return err
+			}
+		}
+	case "ByteLevel":
+		// Only adjusts offsets for byte-level models
+	default:
+		return fmt.Errorf("unsupported post-processor %q", cfg.Type)
+	}
+	return nil
+}
+
+// parseSpecialPair reads a ["[CLS]", 101] pair
+func parseSpecialPair(pair []json.RawMessage) (hfSpecialToken, error) {
+	var tok hfSpecialToken
+	if len(pair) != 2 {
+		return tok, fmt.Errorf("expected [token, id], got %d values", len(pair))
+	}
+	if err := json.Unmarshal(pair[0], &tok.token); err != nil {
+		return tok, err
+	}
+	err := json.Unmarshal(pair[1], &tok.id)
+	return tok, err
+}
+
+// Normalized text
+
+// normalizedText is text being transformed by normalizers and pre-tokenizers.
+// spans[i] is the byte range of the original text that runes[i] came from;
+// inserted characters have empty spans.
+type normalizedText struct {
+	runes []rune
+	spans [][2]int
+}
+
+func newNormalizedText(s string, base int) *normalizedText {
+	n := &normalizedText{
+		runes: make([]rune, 0, len(s)),
+		spans: make([][2]int, 0, len(s)),
+	}
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		n.runes = append(n.runes, r)
+		n.spans = append(n.spans, [2]int{base + i, base + i + size})
+		i += size
+	}
+	return n
+}
+
+// span returns the original byte range covered by runes [start, end)
+func (n *normalizedText) span(start, end int) [2]int {
+	if len(n.spans) == 0 {
+		return [2]int{}
+	}
+	if start >= end {
+		if start < len(n.spans) {
+			return [2]int{n.spans[start][0], n.spans[start][0]}
+		}
+		last := n.spans[len(n.spans)-1][1]
+		return [2]int{last, last}
+	}
+	s := [2]int{n.spans[start][0], n.spans[start][1]}
+	for _, sp := range n.spans[start+1 : end] {
+		s[0] = min(s[0], sp[0])
+		s[1] = max(s[1], sp[1])
+	}
+	return s
+}
+
+func (n *normalizedText) slice(start, end int) *normalizedText {
+	return &normalizedText{runes: n.runes[start:end], spans: n.spans[start:end]}
+}
+
+// mapRunes replaces each rune with zero or more runes that keep its span
+func (n *normalizedText) mapRunes(fn func(r rune, emit func(rune))) {
+	runes := make([]rune, 0, len(n.runes))
+	spans := make([][2]int, 0, len(n.spans))
+	for i, r := range n.runes {
+		fn(r, func(out rune) {
+			runes = append(runes, out)
+			spans = append(spans, n.spans[i])
+		})
+	}
+	n.runes, n.spans = runes, spans
+}
+
+// normalizeForm applies a Unicode normalization form. Each normalized segment
+// takes the span of the input characters it was produced from.
+func (n *normalizedText) normalizeForm(form norm.Form) {
+	s := string(n.runes)
+	runeAt := make([]int, len(s)+1)
+	k := 0
+	for i := range s {
+		runeAt[i] = k
+		k++
+	}
+	runeAt[len(s)] = k
+
+	runes := make([]rune, 0, len(n.runes))
+	spans := make([][2]int, 0, len(n.spans))
+	var it norm.Iter
+	it.InitString(form, s)
+	for !it.Done() {
+		start := it.Pos()
+		seg := string(it.Next())
+		span := n.span(runeAt[start], runeAt[it.Pos()])
+		for _, r := range seg {
+			runes = append(runes, r)
+			spans = append(spans, span)
+		}
+	}
+	n.runes, n.spans = runes, spans
+}
+
+// replace substitutes every match of re. Replacement characters take the
+// span of the text they replace.
+func (n *normalizedText) replace(re *regexp.Regexp, content string) {
+	s := string(n.runes)
+	matches := re.FindAllStringIndex(s, -1)
+	if len(matches) == 0 {
+		return
+	}
+	byteToRune := make(map[int]int, len(n.runes)+1)
+	k := 0
+	for i := range s {
+		byteToRune[i] = k
+		k++
+	}
+	byteToRune[len(s)] = k
+
+	runes := make([]rune, 0, len(n.runes))
+	spans := make([][2]int, 0, len(n.spans))
+	last := 0
+	for _, m := range matches {
+		start, end := byteToRune[m[0]], byteToRune[m[1]]
+		runes = append(runes, n.runes[last:start]...)
+		spans = append(spans, n.spans[last:start]...)
+		span := n.span(start, end)
+		for _, r := range content {
+			runes = append(runes, r)
+			spans = append(spans, span)
+		}
+		last = end
+	}
+	runes = append(runes, n.runes[last:]...)
+	spans = append(spans, n.spans[last:]...)
+	n.runes, n.spans = runes, spans
+}
+
+func (n *normalizedText) prepend(prefix string) {
+	if len(n.runes) == 0 || prefix == "" {
+		return
+	}
+	at := n.spans[0][0]
+	var runes []rune
+	var spans [][2]int
+	for _, r := range prefix {
+		runes = append(runes, r)
+		spans = append(spans, [2]int{at, at})
+	}
+	n.runes = append(runes, n.runes...)
+	n.spans = append(spans, n.spans...)
+}
+
+func (n *normalizedText) strip(left, right bool) {
+	start, end := 0, len(n.runes)
+	for left && start < end && unicode.IsSpace(n.runes[start]) {
+		start++
+	}
+	for right && end > start && unicode.IsSpace(n.runes[end-1]) {
+		end--
+	}
+	n.runes, n.spans = n.runes[start:end], n.spans[start:end]
+}
+
+// Normalizers
+
+type hfNormalizer func(n *normalizedText)
+
+func buildNormalizer(raw json.RawMessage) (hfNormalizer, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var c hfComponent
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+
+	switch c.Type {
+	case "Sequence":
+		var steps []hfNormalizer
+		for _, sub := range c.Normalizers {
+			step, err := buildNormalizer(sub)
+			if err != nil {
+				return nil, err
+			}
+			if step != nil {
+				steps = append(steps, step)
+			}
+		}
+		return func(n *normalizedText) {
+			for _, step := range steps {
+				step(n)
+			}
+		}, nil
+	case "BertNormalizer":
+		return bertNormalizer(c), nil
+	case "Lowercase":
+		return lowercase, nil
+	case "StripAccents":
+		return stripAccents, nil
+	case "NFD":
+		return func(n *normalizedText) { n.normalizeForm(norm.NFD) }, nil
+	case "NFKD":
+		return func(n *normalizedText) { n.normalizeForm(norm.NFKD) }, nil
+	case "NFC":
+		return func(n *normalizedText) { n.normalizeForm(norm.NFC) }, nil
+	case "NFKC", "Precompiled":
+		// Precompiled carries SentencePiece's character map, which is NFKC
+		// with a few extra rules; plain NFKC is used in its place
+		return func(n *normalizedText) { n.normalizeForm(norm.NFKC) }, nil
+	case "Replace":
+		re, err := componentPattern(c)
+		if err != nil {
+			return nil, err
+		}
+		return func(n *normalizedText) { n.replace(re, c.Content) }, nil
+	case "Prepend":
+		return func(n *normalizedText) { n.prepend(c.Prepend) }, nil
+	case "Strip":
+		left := c.StripLeft == nil || *c.StripLeft
+		right := c.StripRight == nil || *c.StripRight
+		return func(n *normalizedText) { n.strip(left, right) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported normalizer %q", c.Type)
+	}
+}
+
+func lowercase(n *normalizedText) {
+	for i, r := range n.runes {
+		n.runes[i] = unicode.ToLower(r)
+	}
+}
+
+func stripAccents(n *normalizedText) {
+	n.mapRunes(func(r rune, emit func(rune)) {
+		if !unicode.Is(unicode.Mn, r) {
+			emit(r)
+		}
+	})
+}
+
+// bertNormalizer cleans control characters, spaces out CJK characters,
+// strips accents and lowercases, as BERT's reference tokenizer does
+func bertNormalizer(c hfComponent) hfNormalizer {
+	clean := c.CleanText == nil || *c.CleanText
+	chinese := c.HandleChineseChars == nil || *c.HandleChineseChars
+	lower := c.Lowercase == nil || *c.Lowercase
+	accents := lower
+	if c.StripAccents != nil {
+		accents = *c.StripAccents
+	}
+
+	return func(n *normalizedText) {
+		if clean {
+			n.mapRunes(func(r rune, emit func(rune)) {
+				switch {
+				case r == 0 || r == utf8.RuneError || isControl(r):
+				case unicode.IsSpace(r):
+					emit(' ')
+				default:
+					emit(r)
+				}
+			})
+		}
+		if chinese {
+			n.mapRunes(func(r rune, emit func(rune)) {
+				if unicode.Is(unicode.Han, r) {
+					emit(' ')
+					emit(r)
+					emit(' ')
+				} else {
+					emit(r)
+				}
+			})
+		}
+		if accents {
+			n.normalizeForm(norm.NFD)
+			stripAccents(n)
+		}
+		if lower {
+			lowercase(n)
+		}
+	}
+}
+
+func isControl(r rune) bool {
+	if r == '\t' || r == '\n' || r == '\r' {
+		return false
+	}
+	return unicode.IsControl(r) || unicode.Is(unicode.Cf, r)
+}
+
+func componentPattern(c hfComponent) (*regexp.Regexp, error) {
+	switch {
+	case c.Pattern == nil:
+		return nil, fmt.Errorf("%s requires a pattern", c.Type)
+	case c.Pattern.String != nil:
+		return regexp.MustCompile(regexp.QuoteMeta(*c.Pattern.String)), nil
+	case c.Pattern.Regex != nil:
+		re, err := regexp.Compile(*c.Pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("%s pattern: %w", c.Type, err)
+		}
+		return re, nil
+	}
+	return nil, fmt.Errorf("%s pattern must be String or Regex", c.Type)
+}
+
+// Pre-tokenizers
+
+// hfPreTokenizer splits text into words. first is true for the text before
+// any added token, which matters for Metaspace's "first" prepend scheme.
+type hfPreTokenizer func(pieces []*normalizedText, first bool) []*normalizedText
+
+// Split behaviors, named as in tokenizer.json
+const (
+	splitRemoved            = "Removed"
+	splitIsolated           = "Isolated"
+	splitMergedWithPrevious = "MergedWithPrevious"
+	splitMergedWithNext     = "MergedWithNext"
+	splitContiguous         = "Contiguous"
+)
+
+var wordOrPunctRe = regexp.MustCompile(`[\p{L}\p{N}\p{M}_]+|[^\p{L}\p{N}\p{M}_\s]+`)
+
+func buildPreTokenizer(raw json.RawMessage) (hfPreTokenizer, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var c hfComponent
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+
+	switch c.Type {
+	case "Sequence":
+		var steps []hfPreTokenizer
+		for _, sub := range c.Pretokenizers {
+			step, err := buildPreTokenizer(sub)
+			if err != nil {
+				return nil, err
+			}
+			if step != nil {
+				steps = append(steps, step)
+			}
+		}
+		return func(pieces []*normalizedText, first bool) []*normalizedText {
+			for _, step := range steps {
+				pieces = step(pieces, first)
+			}
+			return pieces
+		}, nil
+	case "BertPreTokenizer":
+		return func(pieces []*normalizedText, _ bool) []*normalizedText {
+			pieces = splitEach(pieces, func(n *normalizedText) []*normalizedText {
+				return splitRunes(n, unicode.IsSpace, splitRemoved)
+			})
+			return splitEach(pieces, func(n *normalizedText) []*normalizedText {
+				return splitRunes(n, isPunctuation, splitIsolated)
+			})
+		}, nil
+	case "Whitespace":
+		return func(pieces []*normalizedText, _ bool) []*normalizedText {
+			return splitEach(pieces, func(n *normalizedText) []*normalizedText {
+				return splitRegexp(n, wordOrPunctRe, splitRemoved, true)
+			})
+		}, nil
+	case "WhitespaceSplit":
+		return func(pieces []*normalizedText, _ bool) []*normalizedText {
+			return splitEach(pieces, func(n *normalizedText) []*normalizedText {
+				return splitRunes(n, unicode.IsSpace, splitRemoved)
+			})
+		}, nil
+	case "Punctuation":
+		behavior := c.Behavior
+		if behavior == "" {
+			behavior = splitIsolated
+		}
+		return func(pieces []*normalizedText, _ bool) []*normalizedText {
+			return splitEach(pieces, func(n *normalizedText) []*normalizedText {
+				return splitRunes(n, isPunctuation, behavior)
+			})
+		}, nil
+	case "Digits":
+		behavior := splitContiguous
+		if c.IndividualDigits {
+			behavior = splitIsolated
+		}
+		return func(pieces []*normalizedText, _ bool) []*normalizedText {
+			return splitEach(pieces, func(n *normalizedText) []*normalizedText {
+				return splitRunes(n, unicode.IsDigit, behavior)
+			})
+		}, nil
+	case "Split":
+		re, err := componentPattern(c)
+		if err != nil {
+			return nil, err
+		}
+		return func(pieces []*normalizedText, _ bool) []*normalizedText {
+			return splitEach(pieces, func(n *normalizedText) []*normalizedText {
+				return splitRegexp(n, re, c.Behavior, c.Invert)
+			})
+		}, nil
+	case "Metaspace":
+		return metaspace(c), nil
+	default:
+		return nil, fmt.Errorf("unsupported pre-tokenizer %q", c.Type)
+	}
+}
+
+// metaspace replaces spaces with ▁ (or the configured replacement) and
+// splits before each one, as SentencePiece models expect
+func metaspace(c hfComponent) hfPreTokenizer {
+	replacement := '▁'
+	if c.Replacement != "" {
+		replacement, _ = utf8.DecodeRuneInString(c.Replacement)
+	}
+	scheme := c.PrependScheme
+	if scheme == "" {
+		scheme = "always"
+		if c.AddPrefixSpace != nil && !*c.AddPrefixSpace {
+			scheme = "never"
+		}
+	}
+	split := c.Split == nil || *c.Split
+
+	return func(pieces []*normalizedText, first bool) []*normalizedText {
+		var out []*normalizedText
+		for _, n := range pieces {
+			// The marker stands for the space but has an empty span at the
+			// start of the following word, so offsets exclude the space
+			for i, r := range n.runes {
+				if r == ' ' {
+					n.runes[i] = replacement
+					n.spans[i] = [2]int{n.spans[i][1], n.spans[i][1]}
+				}
+			}
+			if len(n.runes) > 0 && n.runes[0] != replacement && (scheme == "always" || scheme == "first" && first) {
+				n.prepend(string(replacement))
+			}
+			if !split {
+				out = append(out, n)
+				continue
+			}
+			out = append(out, splitRunes(n, func(r rune) bool { return r == replacement }, splitMergedWithNext)...)
+		}
+		return out
+	}
+}
+
+// isPunctuation matches BERT's definition: ASCII symbols and Unicode punctuation
+func isPunctuation(r rune) bool {
+	if r >= 33 && r <= 47 || r >= 58 && r <= 64 || r >= 91 && r <= 96 || r >= 123 && r <= 126 {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+func splitEach(pieces []*normalizedText, fn func(n *normalizedText) []*normalizedText) []*normalizedText {
+	var out []*normalizedText
+	for _, n := range pieces {
+		out = append(out, fn(n)...)
+	}
+	return out
+}
+
+// segment is a run of runes that either is or is not a delimiter
+type segment struct {
+	start, end int
+	delim      bool
+}
+
+// splitRunes splits where isDelim matches; each matching rune is its own delimiter
+func splitRunes(n *normalizedText, isDelim func(r rune) bool, behavior string) []*normalizedText {
+	var segs []segment
+	for i, r := range n.runes {
+		d := isDelim(r)
+		if !d && len(segs) > 0 && !segs[len(segs)-1].delim {
+			segs[len(segs)-1].end = i + 1
+			continue
+		}
+		segs = append(segs, segment{start: i, end: i + 1, delim: d})
+	}
+	return applySplit(n, segs, behavior)
+}
+
+// splitRegexp splits on matches of re; with invert, the matches are the
+// content and the text between them the delimiters
+func splitRegexp(n *normalizedText, re *regexp.Regexp, behavior string, invert bool) []*normalizedText {
+	s := string(n.runes)
+	runeAt := make([]int, len(s)+1)
+	k := 0
+	for i := range s {
+		runeAt[i] = k
+		k++
+	}
+	runeAt[len(s)] = k
+
+	var segs []segment
+	last := 0
+	for _, m := range re.FindAllStringIndex(s, -1) {
+		start, end := runeAt[m[0]], runeAt[m[1]]
+		if start == end {
+			continue
+		}
+		if start > last {
+			segs = append(segs, segment{start: last, end: start, delim: invert})
+		}
+		segs = append(segs, segment{start: start, end: end, delim: !invert})
+		last = end
+	}
+	if last < len(n.runes) {
+		segs = append(segs, segment{start: last, end: len(n.runes), delim: invert})
+	}
+	return applySplit(n, segs, behavior)
+}
+
+// applySplit turns segments into pieces according to the split behavior
+func applySplit(n *normalizedText, segs []segment, behavior string) []*normalizedText {
+	var merged []segment
+	for _, seg := range segs {
+		switch behavior {
+		case splitRemoved:
+			if !seg.delim {
+				merged = append(merged, seg)
+			}
+			continue
+		case splitMergedWithPrevious:
+			if seg.delim && len(merged) > 0 {
+				merged[len(merged)-1].end = seg.end
+				continue
+			}
+		case splitMergedWithNext:
+			if !seg.delim && len(merged) > 0 && merged[len(merged)-1].delim {
+				merged[len(merged)-1].end = seg.end
+				merged[len(merged)-1].delim = false
+				continue
+			}
+		case splitContiguous:
+			if seg.delim && len(merged) > 0 && merged[len(merged)-1].delim {
+				merged[len(merged)-1].end = seg.end
+				continue
+			}
+		}
+		merged = append(merged, seg)
+	}
+
+	out := make([]*normalizedText, 0, len(merged))
+	for _, seg := range merged {
+		if seg.end > seg.start {
+			out = append(out, n.slice(seg.start, seg.end))
+		}
+	}
+	return out
+}
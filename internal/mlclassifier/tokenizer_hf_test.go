@@ -0,0 +1,219 @@
+package mlclassifier
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func loadTestTokenizer(t *testing.T, file string) *Tokenizer {
+	t.Helper()
+	tok, err := NewTokenizer(TokenizerConfig{TokenizerFile: "testdata/" + file})
+	if err != nil {
+		t.Fatalf("NewTokenizer: %v", err)
+	}
+	return tok
+}
+
+// spanTexts returns the original text covered by each token
+func spanTexts(text string, enc *Encoding) []string {
+	texts := make([]string, enc.Len())
+	for i, off := range enc.Offsets {
+		texts[i] = text[off[0]:off[1]]
+	}
+	return texts
+}
+
+func TestHFTokenizer_WordPiece(t *testing.T) {
+	tok := loadTestTokenizer(t, "wordpiece_tokenizer.json")
+
+	tests := []struct {
+		name   string
+		text   string
+		tokens []string
+		ids    []int32
+		spans  []string
+		words  []int
+	}{
+		{
+			name:   "lowercase and continuation",
+			text:   "JANE roBERT",
+			tokens: []string{"[CLS]", "jane", "ro", "##bert", "[SEP]"},
+			ids:    []int32{7, 2, 5, 6, 4},
+			spans:  []string{"", "JANE", "ro", "BERT", ""},
+			words:  []int{-1, 0, 1, 1, -1},
+		},
+		{
+			name:   "accents map back to the original characters",
+			text:   "  Jāne\tDoé",
+			tokens: []string{"[CLS]", "jane", "doe", "[SEP]"},
+			ids:    []int32{7, 2, 3, 4},
+			spans:  []string{"", "Jāne", "Doé", ""},
+			words:  []int{-1, 0, 1, -1},
+		},
+		{
+			name:   "unknown words and punctuation",
+			text:   "jane, robot!",
+			tokens: []string{"[CLS]", "jane", "[UNK]", "[UNK]", "[UNK]", "[SEP]"},
+			ids:    []int32{7, 2, 1, 1, 1, 4},
+			spans:  []string{"", "jane", ",", "robot", "!", ""},
+			words:  []int{-1, 0, 1, 2, 3, -1},
+		},
+		{
+			name:   "added tokens are matched before normalization",
+			text:   "jane[SEP]doe",
+			tokens: []string{"[CLS]", "jane", "[SEP]", "doe", "[SEP]"},
+			ids:    []int32{7, 2, 4, 3, 4},
+			spans:  []string{"", "jane", "[SEP]", "doe", ""},
+			words:  []int{-1, 0, 1, 2, -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := tok.EncodeWithOffsets(tt.text)
+			if !reflect.DeepEqual(enc.Tokens, tt.tokens) {
+				t.Errorf("expected tokens %q, got %q", tt.tokens, enc.Tokens)
+			}
+			if !reflect.DeepEqual(enc.IDs, tt.ids) {
+				t.Errorf("expected ids %v, got %v", tt.ids, enc.IDs)
+			}
+			if got := spanTexts(tt.text, enc); !reflect.DeepEqual(got, tt.spans) {
+				t.Errorf("expected spans %q, got %q", tt.spans, got)
+			}
+			if !reflect.DeepEqual(enc.WordIDs, tt.words) {
+				t.Errorf("expected word ids %v, got %v", tt.words, enc.WordIDs)
+			}
+		})
+	}
+}
+
+func TestHFTokenizer_Unigram(t *testing.T) {
+	tok := loadTestTokenizer(t, "unigram_tokenizer.json")
+
+	text := "hello  the world"
+	enc := tok.EncodeWithOffsets(text)
+
+	wantTokens := []string{"▁hello", "▁the", "▁wor", "ld", "</s>"}
+	if !reflect.DeepEqual(enc.Tokens, wantTokens) {
+		t.Errorf("expected tokens %q, got %q", wantTokens, enc.Tokens)
+	}
+	wantIDs := []int32{4, 7, 5, 6, 1}
+	if !reflect.DeepEqual(enc.IDs, wantIDs) {
+		t.Errorf("expected ids %v, got %v", wantIDs, enc.IDs)
+	}
+	// The ▁ marker stands for a space but offsets exclude it
+	wantSpans := []string{"hello", "the", "wor", "ld", ""}
+	if got := spanTexts(text, enc); !reflect.DeepEqual(got, wantSpans) {
+		t.Errorf("expected spans %q, got %q", wantSpans, got)
+	}
+	if got := enc.SpecialTokensMask; !reflect.DeepEqual(got, []int32{0, 0, 0, 0, 1}) {
+		t.Errorf("expected only </s> to be special, got %v", got)
+	}
+
+	// Unknown characters fuse into one <unk> covering them all
+	enc = tok.EncodeWithOffsets("the ßß")
+	if want := []string{"▁the", "▁", "<unk>", "</s>"}; !reflect.DeepEqual(enc.Tokens, want) {
+		t.Errorf("expected tokens %q, got %q", want, enc.Tokens)
+	}
+	if got := spanTexts("the ßß", enc); got[2] != "ßß" {
+		t.Errorf("expected <unk> to cover ßß, got %q", got[2])
+	}
+
+	if got := tok.Decode(wantIDs); got != "hello the world" {
+		t.Errorf("expected decoded text %q, got %q", "hello the world", got)
+	}
+}
+
+func TestHFTokenizer_Truncation(t *testing.T) {
+	// max_length 16 comes from tokenizer.json
+	tok := loadTestTokenizer(t, "unigram_tokenizer.json")
+	enc := tok.EncodeWithOffsets("hello hello hello hello hello hello hello hello hello hello hello hello hello hello hello hello hello")
+	if enc.Len() != 16 {
+		t.Fatalf("expected 16 tokens, got %d", enc.Len())
+	}
+	if last := enc.Tokens[15]; last != "</s>" {
+		t.Errorf("expected truncation to keep </s>, got %q", last)
+	}
+
+	ids, mask := tok.Encode("hello")
+	if len(ids) != 16 || len(mask) != 16 {
+		t.Fatalf("expected Encode to pad to 16, got %d ids and %d mask", len(ids), len(mask))
+	}
+	if mask[1] != 1 || mask[2] != 0 || ids[2] != 0 {
+		t.Errorf("expected <pad> after the sequence, got ids %v mask %v", ids, mask)
+	}
+}
+
+func TestHFTokenizer_LoadErrors(t *testing.T) {
+	if _, err := NewTokenizer(TokenizerConfig{TokenizerFile: "testdata/missing.json"}); err == nil {
+		t.Error("expected error for a missing tokenizer file")
+	}
+	if _, err := NewTokenizer(TokenizerConfig{TokenizerFile: "testdata/tiny_ner.onnx"}); err == nil {
+		t.Error("expected error for a file that is not JSON")
+	}
+}
+
+func TestTokenizer_BasicOffsets(t *testing.T) {
+	tok, err := NewTokenizer(TokenizerConfig{MaxLength: 8})
+	if err != nil {
+		t.Fatalf("NewTokenizer: %v", err)
+	}
+
+	text := " Ab c"
+	enc := tok.EncodeWithOffsets(text)
+	wantTokens := []string{"[CLS]", "a", "##b", " ", "##c", "[SEP]"}
+	if !reflect.DeepEqual(enc.Tokens, wantTokens) {
+		t.Fatalf("expected tokens %q, got %q", wantTokens, enc.Tokens)
+	}
+	wantSpans := []string{"", "A", "b", " ", "c", ""}
+	if got := spanTexts(text, enc); !reflect.DeepEqual(got, wantSpans) {
+		t.Errorf("expected spans %q, got %q", wantSpans, got)
+	}
+
+	enc = tok.EncodeWithOffsets("abcdefghij")
+	if enc.Len() != 8 || enc.Tokens[7] != "[SEP]" {
+		t.Errorf("expected truncation to 8 tokens ending in [SEP], got %q", enc.Tokens)
+	}
+}
+
+func TestONNXEntityRecognizer_TokenizerOffsets(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rt := loadTinyNER(t)
+	n, err := NewONNXEntityRecognizer(ONNXNERConfig{
+		ModelPath:     "tiny_ner.onnx",
+		TokenizerPath: "testdata/wordpiece_tokenizer.json",
+		Labels:        []string{"O", "B-PII", "I-PII"},
+	}, rt, logger)
+	if err != nil {
+		t.Fatalf("NewONNXEntityRecognizer: %v", err)
+	}
+
+	text := "Email  Jane Doe or roBERT today"
+	entities, err := n.runONNXInference(context.Background(), text)
+	if err != nil {
+		t.Fatalf("runONNXInference: %v", err)
+	}
+
+	want := []struct {
+		text       string
+		start, end int
+	}{
+		{"Jane Doe", 7, 15},
+		{"roBERT", 19, 25},
+	}
+	if len(entities) != len(want) {
+		t.Fatalf("expected %d entities, got %+v", len(want), entities)
+	}
+	for i, w := range want {
+		e := entities[i]
+		if e.Text != w.text || e.StartOffset != w.start || e.EndOffset != w.end {
+			t.Errorf("expected %q at [%d,%d), got %q at [%d,%d)", w.text, w.start, w.end, e.Text, e.StartOffset, e.EndOffset)
+		}
+		if e.Type != "PII" {
+			t.Errorf("expected type PII, got %s", e.Type)
+		}
+	}
+}
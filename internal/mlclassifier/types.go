@@ -30,6 +30,27 @@ type EnhancedMatch struct {
 	CombinedConfidence float64          `json:"combined_confidence"`
 	EntityType        string            `json:"entity_type,omitempty"`
 	ContextScore      float64           `json:"context_score"`
+	// Probability a reviewer confirms the match, when a calibration is active
+	CalibratedConfidence *float64 `json:"calibrated_confidence,omitempty"`
+
+	// Scores from shadow models, recorded for evaluation but never reported
+	shadow []shadowScore
+}
+
+// DecisionConfidence is the confidence thresholds are applied to: the
+// calibrated confidence when available, the combined confidence otherwise
+func (m EnhancedMatch) DecisionConfidence() float64 {
+	if m.CalibratedConfidence != nil {
+		return *m.CalibratedConfidence
+	}
+	return m.CombinedConfidence
+}
+
+// shadowScore is a shadow model's combined confidence for a match
+type shadowScore struct {
+	modelID       uuid.UUID
+	activeModelID *uuid.UUID
+	confidence    float64
 }
 
 // Entity represents a named entity recognized by NER
@@ -112,6 +133,8 @@ type ClassifierConfig struct {
 	EnableDocClassifier bool                        `json:"enable_doc_classifier"`
 	ContextWindowSize   int                         `json:"context_window_size"`
 	MaxEntitiesPerDoc   int                         `json:"max_entities_per_doc"`
+	Promotion           PromotionGate               `json:"promotion"`
+	Review              ReviewWorkflowConfig        `json:"review"`
 }
 
 // DefaultClassifierConfig returns default configuration
@@ -122,6 +145,8 @@ func DefaultClassifierConfig() ClassifierConfig {
 		EnableDocClassifier: true,
 		ContextWindowSize:   200,
 		MaxEntitiesPerDoc:   1000,
+		Promotion:           DefaultPromotionGate(),
+		Review:              DefaultReviewWorkflowConfig(),
 	}
 }
 
@@ -137,6 +162,12 @@ func SupportedEntityTypes() []string {
 		"EMAIL",
 		"PHONE",
 		"ADDRESS",
+		"HEALTH_CONDITION",
+		"RELIGION",
+		"ETHNICITY",
+		"SEXUAL_ORIENTATION",
+		"BIOMETRIC",
+		"TRADE_UNION",
 	}
 }
 
@@ -161,7 +192,19 @@ func EntityTypeToCategory(entityType string) models.Category {
 		return models.CategoryPHI
 	case "FINANCIAL_TERM":
 		return models.CategoryPCI
+	case "HEALTH_CONDITION":
+		return models.CategoryHealth
+	case "RELIGION", "ETHNICITY", "SEXUAL_ORIENTATION", "BIOMETRIC", "TRADE_UNION":
+		return models.Category(entityType)
 	default:
 		return models.CategoryCustom
 	}
 }
+
+// SpecialCategoryEntityType maps a GDPR special category to its NER entity type
+func SpecialCategoryEntityType(category models.Category) string {
+	if category == models.CategoryHealth {
+		return "HEALTH_CONDITION"
+	}
+	return string(category)
+}
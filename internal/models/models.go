@@ -39,8 +39,36 @@ const (
 	CategoryPCI     Category = "PCI"
 	CategorySecrets Category = "SECRETS"
 	CategoryCustom  Category = "CUSTOM"
+
+	// GDPR Article 9 special categories of personal data
+	CategoryHealth            Category = "HEALTH"
+	CategoryReligion          Category = "RELIGION"
+	CategoryEthnicity         Category = "ETHNICITY"
+	CategorySexualOrientation Category = "SEXUAL_ORIENTATION"
+	CategoryBiometric         Category = "BIOMETRIC"
+	CategoryTradeUnion        Category = "TRADE_UNION"
 )
 
+// SpecialCategories lists the GDPR Article 9 special categories
+var SpecialCategories = []Category{
+	CategoryHealth,
+	CategoryReligion,
+	CategoryEthnicity,
+	CategorySexualOrientation,
+	CategoryBiometric,
+	CategoryTradeUnion,
+}
+
+// IsSpecial reports whether c is a GDPR Article 9 special category
+func (c Category) IsSpecial() bool {
+	for _, special := range SpecialCategories {
+		if c == special {
+			return true
+		}
+	}
+	return false
+}
+
 type ResourceType string
 
 const (
@@ -184,6 +212,7 @@ type Classification struct {
 	ObjectPath      string      `json:"object_path" db:"object_path"`
 	ObjectSize      int64       `json:"object_size" db:"object_size"`
 	RuleName        string      `json:"rule_name" db:"rule_name"`
+	RuleVersion     string      `json:"rule_version" db:"rule_version"`
 	Category        Category    `json:"category" db:"category"`
 	Sensitivity     Sensitivity `json:"sensitivity" db:"sensitivity"`
 	FindingCount    int         `json:"finding_count" db:"finding_count"`
@@ -194,6 +223,18 @@ type Classification struct {
 	DiscoveredAt    time.Time   `json:"discovered_at" db:"discovered_at"`
 }
 
+// SampleAccessLog records a reviewer viewing the encrypted original values of a classification
+type SampleAccessLog struct {
+	ID               uuid.UUID `json:"id" db:"id"`
+	ClassificationID uuid.UUID `json:"classification_id" db:"classification_id"`
+	UserID           string    `json:"user_id" db:"user_id"`
+	UserEmail        string    `json:"user_email" db:"user_email"`
+	UserRole         string    `json:"user_role" db:"user_role"`
+	Reason           string    `json:"reason" db:"reason"`
+	SampleCount      int       `json:"sample_count" db:"sample_count"`
+	AccessedAt       time.Time `json:"accessed_at" db:"accessed_at"`
+}
+
 type AccessPolicy struct {
 	ID                 uuid.UUID `json:"id" db:"id"`
 	AccountID          uuid.UUID `json:"account_id" db:"account_id"`
@@ -356,14 +397,21 @@ const (
 	MLModelNER                MLModelType = "NER"
 	MLModelDocumentClassifier MLModelType = "DOCUMENT_CLASSIFIER"
 	MLModelConfidenceScorer   MLModelType = "CONFIDENCE_SCORER"
+	MLModelFeedbackFilter     MLModelType = "FEEDBACK_FILTER"
+	MLModelCalibrator         MLModelType = "CALIBRATOR"
 )
 
 type MLModelStatus string
 
+// Registered models move candidate -> shadow -> active -> retired. Shadow
+// models score alongside the active model without affecting results.
 const (
+	MLModelStatusCandidate  MLModelStatus = "candidate"
+	MLModelStatusShadow     MLModelStatus = "shadow"
 	MLModelStatusActive     MLModelStatus = "active"
+	MLModelStatusRetired    MLModelStatus = "retired"
 	MLModelStatusTraining   MLModelStatus = "training"
-	MLModelStatusDeprecated MLModelStatus = "deprecated"
+	MLModelStatusDeprecated MLModelStatus = "deprecated" // Superseded by retired
 )
 
 type ReviewStatus string
@@ -400,26 +448,42 @@ type MLModel struct {
 	IsDefault           bool          `json:"is_default" db:"is_default"`
 	TrainedOnSamples    int           `json:"trained_on_samples" db:"trained_on_samples"`
 	TrainingDataVersion string        `json:"training_data_version" db:"training_data_version"`
+	PromotedAt          *time.Time    `json:"promoted_at,omitempty" db:"promoted_at"`
+	RetiredAt           *time.Time    `json:"retired_at,omitempty" db:"retired_at"`
 	CreatedAt           time.Time     `json:"created_at" db:"created_at"`
 	UpdatedAt           time.Time     `json:"updated_at" db:"updated_at"`
 }
 
+// MLShadowResult pairs a shadow model's score for a match with the score the
+// active model gave the same match
+type MLShadowResult struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	ShadowModelID    uuid.UUID  `json:"shadow_model_id" db:"shadow_model_id"`
+	ActiveModelID    *uuid.UUID `json:"active_model_id" db:"active_model_id"`
+	PredictionID     uuid.UUID  `json:"prediction_id" db:"prediction_id"`
+	ShadowConfidence float64    `json:"shadow_confidence" db:"shadow_confidence"`
+	ActiveConfidence float64    `json:"active_confidence" db:"active_confidence"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+
 type MLPrediction struct {
-	ID                uuid.UUID    `json:"id" db:"id"`
-	ClassificationID  uuid.UUID    `json:"classification_id" db:"classification_id"`
-	ModelID           uuid.UUID    `json:"model_id" db:"model_id"`
-	PredictionType    string       `json:"prediction_type" db:"prediction_type"`
-	PredictedLabel    string       `json:"predicted_label" db:"predicted_label"`
-	ConfidenceScore   float64      `json:"confidence_score" db:"confidence_score"`
-	EntityText        string       `json:"entity_text" db:"entity_text"`
-	EntityStartOffset int          `json:"entity_start_offset" db:"entity_start_offset"`
-	EntityEndOffset   int          `json:"entity_end_offset" db:"entity_end_offset"`
-	RawOutput         JSONB        `json:"raw_output" db:"raw_output"`
-	ReviewStatus      ReviewStatus `json:"review_status" db:"review_status"`
-	ReviewedBy        *uuid.UUID   `json:"reviewed_by" db:"reviewed_by"`
-	ReviewedAt        *time.Time   `json:"reviewed_at" db:"reviewed_at"`
-	ReviewNotes       string       `json:"review_notes" db:"review_notes"`
-	CreatedAt         time.Time    `json:"created_at" db:"created_at"`
+	ID                   uuid.UUID    `json:"id" db:"id"`
+	ClassificationID     uuid.UUID    `json:"classification_id" db:"classification_id"`
+	ModelID              uuid.UUID    `json:"model_id" db:"model_id"`
+	PredictionType       string       `json:"prediction_type" db:"prediction_type"`
+	PredictedLabel       string       `json:"predicted_label" db:"predicted_label"`
+	ConfidenceScore      float64      `json:"confidence_score" db:"confidence_score"`
+	CalibratedConfidence *float64     `json:"calibrated_confidence,omitempty" db:"calibrated_confidence"`
+	EntityText           string       `json:"entity_text" db:"entity_text"`
+	EntityStartOffset    int          `json:"entity_start_offset" db:"entity_start_offset"`
+	EntityEndOffset      int          `json:"entity_end_offset" db:"entity_end_offset"`
+	RawOutput            JSONB        `json:"raw_output" db:"raw_output"`
+	ReviewStatus         ReviewStatus `json:"review_status" db:"review_status"`
+	ReviewedBy           *uuid.UUID   `json:"reviewed_by" db:"reviewed_by"`
+	ReviewedAt           *time.Time   `json:"reviewed_at" db:"reviewed_at"`
+	ReviewNotes          string       `json:"review_notes" db:"review_notes"`
+	CreatedAt            time.Time    `json:"created_at" db:"created_at"`
 }
 
 type ClassificationReviewQueue struct {
@@ -437,9 +501,72 @@ type ClassificationReviewQueue struct {
 	Resolution         string            `json:"resolution" db:"resolution"`
 	FinalLabel         string            `json:"final_label" db:"final_label"`
 	FinalConfidence    float64           `json:"final_confidence" db:"final_confidence"`
+	ResolvedBy         *uuid.UUID        `json:"resolved_by,omitempty" db:"resolved_by"`
+	RoutingRuleID      *uuid.UUID        `json:"routing_rule_id,omitempty" db:"routing_rule_id"`
+	DoubleReview       bool              `json:"double_review" db:"double_review"`
+	FirstReviewer      *uuid.UUID        `json:"first_reviewer,omitempty" db:"first_reviewer"`
+	FirstResolution    string            `json:"first_resolution,omitempty" db:"first_resolution"`
+	FirstResolvedAt    *time.Time        `json:"first_resolved_at,omitempty" db:"first_resolved_at"`
+	EscalatedAt        *time.Time        `json:"escalated_at,omitempty" db:"escalated_at"`
 	CreatedAt          time.Time         `json:"created_at" db:"created_at"`
 }
 
+// ReviewSubject describes what a review item is about, for routing and bulk
+// resolution. DataOwner is read from an asset tag.
+type ReviewSubject struct {
+	RuleName   string    `json:"rule_name" db:"rule_name"`
+	Category   Category  `json:"category" db:"category"`
+	ObjectPath string    `json:"object_path" db:"object_path"`
+	AssetID    uuid.UUID `json:"asset_id" db:"asset_id"`
+	AssetName  string    `json:"asset_name" db:"asset_name"`
+	AccountID  uuid.UUID `json:"account_id" db:"account_id"`
+	DataOwner  string    `json:"data_owner" db:"data_owner"`
+}
+
+// ReviewQueueEntry is a review item with its subject
+type ReviewQueueEntry struct {
+	ClassificationReviewQueue
+	ReviewSubject
+}
+
+// ReviewRoutingRule assigns new review items to reviewers. Empty match
+// fields match anything; the enabled rule with the highest priority that
+// matches an item routes it.
+type ReviewRoutingRule struct {
+	ID        uuid.UUID   `json:"id" db:"id"`
+	Name      string      `json:"name" db:"name"`
+	Priority  int         `json:"priority" db:"priority"`
+	AccountID *uuid.UUID  `json:"account_id,omitempty" db:"account_id"`
+	Category  Category    `json:"category,omitempty" db:"category"`
+	DataOwner string      `json:"data_owner,omitempty" db:"data_owner"`
+	Assignees StringArray `json:"assignees" db:"assignees"` // User IDs; the least loaded gets the item
+	SLAHours  int         `json:"sla_hours,omitempty" db:"sla_hours"`
+	Enabled   bool        `json:"enabled" db:"enabled"`
+	CreatedAt time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// ReviewerWorkload counts a reviewer's open review items
+type ReviewerWorkload struct {
+	ReviewerID uuid.UUID `json:"reviewer_id" db:"reviewer_id"`
+	Open       int       `json:"open" db:"open"`
+	Overdue    int       `json:"overdue" db:"overdue"`
+}
+
+// CalibrationSample is the outcome of a resolved review item with the rule
+// it reviewed, used to fit and check confidence calibration. Samples are
+// kept apart from the review queue, which rescans clear.
+type CalibrationSample struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	ReviewItemID    *uuid.UUID `json:"review_item_id" db:"review_item_id"`
+	RuleName        string     `json:"rule_name" db:"rule_name"`
+	RawConfidence   float64    `json:"raw_confidence" db:"raw_confidence"`
+	Resolution      string     `json:"resolution" db:"resolution"`
+	FinalLabel      string     `json:"final_label" db:"final_label"`
+	FinalConfidence float64    `json:"final_confidence" db:"final_confidence"`
+	ResolvedAt      time.Time  `json:"resolved_at" db:"resolved_at"`
+}
+
 type TrainingFeedback struct {
 	ID                     uuid.UUID  `json:"id" db:"id"`
 	ModelID                *uuid.UUID `json:"model_id" db:"model_id"`
@@ -454,6 +581,12 @@ type TrainingFeedback struct {
 	TrainingRunID          string     `json:"training_run_id" db:"training_run_id"`
 	SubmittedBy            *uuid.UUID `json:"submitted_by" db:"submitted_by"`
 	SubmittedAt            time.Time  `json:"submitted_at" db:"submitted_at"`
+
+	// The rule, document type and confidence of the reviewed prediction,
+	// kept here since rescans delete predictions
+	RuleName     string  `json:"rule_name" db:"rule_name"`
+	DocumentType string  `json:"document_type" db:"document_type"`
+	Confidence   float64 `json:"confidence" db:"confidence"`
 }
 
 // =====================================================
@@ -24,6 +24,7 @@ const (
 	NotifyScanFailed      NotificationType = "scan_failed"
 	NotifyDailyDigest     NotificationType = "daily_digest"
 	NotifyWeeklyReport    NotificationType = "weekly_report"
+	NotifyReviewOverdue   NotificationType = "review_overdue"
 )
 
 type Channel string
@@ -510,3 +511,38 @@ func (s *Service) digestToSeverity(stats DigestStats) models.Sensitivity {
 	}
 	return models.SensitivityLow
 }
+
+// ReviewEscalationStats summarizes review items that breached their SLA
+type ReviewEscalationStats struct {
+	Overdue    int
+	Unassigned int
+	ByReason   map[string]int
+	ByReviewer map[string]int
+	OldestDue  time.Time
+}
+
+// NotifyReviewEscalation reports classification review items escalated for
+// missing their SLA. Overdue reviews of critical data are high severity.
+func (s *Service) NotifyReviewEscalation(ctx context.Context, stats ReviewEscalationStats) error {
+	severity := models.SensitivityMedium
+	if stats.ByReason["SENSITIVE_DATA"] > 0 {
+		severity = models.SensitivityHigh
+	}
+
+	notif := &Notification{
+		Type:     NotifyReviewOverdue,
+		Title:    "Classification Reviews Overdue",
+		Message:  fmt.Sprintf("%d review items missed their SLA, %d of them unassigned", stats.Overdue, stats.Unassigned),
+		Severity: severity,
+		Data: map[string]interface{}{
+			"overdue":     stats.Overdue,
+			"unassigned":  stats.Unassigned,
+			"by_reason":   stats.ByReason,
+			"by_reviewer": stats.ByReviewer,
+			"oldest_due":  stats.OldestDue.Format(time.RFC3339),
+		},
+		Timestamp: time.Now(),
+	}
+
+	return s.Send(ctx, notif)
+}
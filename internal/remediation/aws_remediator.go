@@ -2,10 +2,14 @@ package remediation
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -15,6 +19,7 @@ import (
 type AWSRemediator struct {
 	s3Client  *s3.Client
 	kmsClient *kms.Client
+	iamClient *iam.Client
 	logger    *slog.Logger
 }
 
@@ -23,6 +28,7 @@ func NewAWSRemediator(cfg aws.Config, logger *slog.Logger) *AWSRemediator {
 	return &AWSRemediator{
 		s3Client:  s3.NewFromConfig(cfg),
 		kmsClient: kms.NewFromConfig(cfg),
+		iamClient: iam.NewFromConfig(cfg),
 		logger:    logger,
 	}
 }
@@ -118,6 +124,32 @@ func (r *AWSRemediator) ValidateAction(ctx context.Context, action *Action) erro
 			return fmt.Errorf("target bucket %s not accessible: %w", targetBucket, err)
 		}
 
+	case ActionRestrictIAMPolicy:
+		policyARN, ok := action.Parameters["policy_arn"].(string)
+		if !ok || policyARN == "" {
+			return fmt.Errorf("policy_arn parameter is required")
+		}
+		document, ok := action.Parameters["new_policy_document"].(string)
+		if !ok || document == "" {
+			return fmt.Errorf("new_policy_document parameter is required")
+		}
+		// Inline policies are named by principal_arn and policy_name
+		_, err := r.getInlinePolicy(ctx, action)
+		switch {
+		case err == errNotInline:
+			if strings.HasPrefix(policyARN, "arn:aws:iam::aws:policy/") {
+				return fmt.Errorf("AWS managed policy %s cannot be modified", policyARN)
+			}
+			_, err := r.iamClient.GetPolicy(ctx, &iam.GetPolicyInput{
+				PolicyArn: aws.String(policyARN),
+			})
+			if err != nil {
+				return fmt.Errorf("policy %s not accessible: %w", policyARN, err)
+			}
+		case err != nil:
+			return err
+		}
+
 	default:
 		return fmt.Errorf("unsupported action type: %s", action.ActionType)
 	}
@@ -140,6 +172,8 @@ func (r *AWSRemediator) Execute(ctx context.Context, action *Action) (*ExecuteRe
 		return r.enableVersioning(ctx, action)
 	case ActionEnableLogging:
 		return r.enableLogging(ctx, action)
+	case ActionRestrictIAMPolicy:
+		return r.restrictIAMPolicy(ctx, action)
 	default:
 		return &ExecuteResult{
 			Success:      false,
@@ -159,6 +193,8 @@ func (r *AWSRemediator) Rollback(ctx context.Context, action *Action) (*Rollback
 		return r.rollbackPublicACL(ctx, action)
 	case ActionEnableLogging:
 		return r.rollbackLogging(ctx, action)
+	case ActionRestrictIAMPolicy:
+		return r.rollbackIAMPolicy(ctx, action)
 	default:
 		return &RollbackResult{
 			Success:      false,
@@ -694,6 +730,211 @@ func (r *AWSRemediator) rollbackLogging(ctx context.Context, action *Action) (*R
 	return &RollbackResult{Success: true}, nil
 }
 
+// errNotInline is returned by getInlinePolicy for managed policies
+var errNotInline = errors.New("not an inline policy")
+
+// getInlinePolicy returns the current document of the inline policy named
+// by the principal_arn and policy_name parameters
+func (r *AWSRemediator) getInlinePolicy(ctx context.Context, action *Action) (string, error) {
+	principalARN, _ := action.Parameters["principal_arn"].(string)
+	policyName, _ := action.Parameters["policy_name"].(string)
+	if principalARN == "" || policyName == "" {
+		return "", errNotInline
+	}
+	principalName := principalARN[strings.LastIndex(principalARN, "/")+1:]
+
+	var document *string
+	switch {
+	case strings.Contains(principalARN, ":role/"):
+		output, err := r.iamClient.GetRolePolicy(ctx, &iam.GetRolePolicyInput{
+			RoleName:   aws.String(principalName),
+			PolicyName: aws.String(policyName),
+		})
+		if err != nil {
+			return "", fmt.Errorf("inline policy %s of %s not accessible: %w", policyName, principalARN, err)
+		}
+		document = output.PolicyDocument
+	case strings.Contains(principalARN, ":user/"):
+		output, err := r.iamClient.GetUserPolicy(ctx, &iam.GetUserPolicyInput{
+			UserName:   aws.String(principalName),
+			PolicyName: aws.String(policyName),
+		})
+		if err != nil {
+			return "", fmt.Errorf("inline policy %s of %s not accessible: %w", policyName, principalARN, err)
+		}
+		document = output.PolicyDocument
+	case strings.Contains(principalARN, ":group/"):
+		output, err := r.iamClient.GetGroupPolicy(ctx, &iam.GetGroupPolicyInput{
+			GroupName:  aws.String(principalName),
+			PolicyName: aws.String(policyName),
+		})
+		if err != nil {
+			return "", fmt.Errorf("inline policy %s of %s not accessible: %w", policyName, principalARN, err)
+		}
+		document = output.PolicyDocument
+	default:
+		return "", fmt.Errorf("unsupported principal %s", principalARN)
+	}
+
+	// IAM returns policy documents URL-encoded
+	decoded, err := url.QueryUnescape(aws.ToString(document))
+	if err != nil {
+		return "", fmt.Errorf("decoding policy document: %w", err)
+	}
+	return decoded, nil
+}
+
+// putInlinePolicy replaces the document of the inline policy named by the
+// principal_arn and policy_name parameters
+func (r *AWSRemediator) putInlinePolicy(ctx context.Context, action *Action, document string) error {
+	principalARN, _ := action.Parameters["principal_arn"].(string)
+	policyName, _ := action.Parameters["policy_name"].(string)
+	principalName := principalARN[strings.LastIndex(principalARN, "/")+1:]
+
+	var err error
+	switch {
+	case strings.Contains(principalARN, ":role/"):
+		_, err = r.iamClient.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+			RoleName:       aws.String(principalName),
+			PolicyName:     aws.String(policyName),
+			PolicyDocument: aws.String(document),
+		})
+	case strings.Contains(principalARN, ":user/"):
+		_, err = r.iamClient.PutUserPolicy(ctx, &iam.PutUserPolicyInput{
+			UserName:       aws.String(principalName),
+			PolicyName:     aws.String(policyName),
+			PolicyDocument: aws.String(document),
+		})
+	case strings.Contains(principalARN, ":group/"):
+		_, err = r.iamClient.PutGroupPolicy(ctx, &iam.PutGroupPolicyInput{
+			GroupName:      aws.String(principalName),
+			PolicyName:     aws.String(policyName),
+			PolicyDocument: aws.String(document),
+		})
+	default:
+		err = fmt.Errorf("unsupported principal %s", principalARN)
+	}
+	return err
+}
+
+// restrictIAMPolicy replaces a policy's document. Managed policies get a new
+// default version, keeping the previous one for rollback; inline policies
+// are rewritten in place.
+func (r *AWSRemediator) restrictIAMPolicy(ctx context.Context, action *Action) (*ExecuteResult, error) {
+	policyARN := action.Parameters["policy_arn"].(string)
+	document := action.Parameters["new_policy_document"].(string)
+
+	current, err := r.getInlinePolicy(ctx, action)
+	if err == nil {
+		previousState := map[string]interface{}{
+			"policy_document": current,
+		}
+		if err := r.putInlinePolicy(ctx, action, document); err != nil {
+			return &ExecuteResult{
+				Success:       false,
+				PreviousState: previousState,
+				ErrorMessage:  err.Error(),
+			}, nil
+		}
+
+		r.logger.Info("inline IAM policy restricted",
+			"principal", action.Parameters["principal_arn"],
+			"policy_name", action.Parameters["policy_name"])
+
+		return &ExecuteResult{
+			Success:       true,
+			PreviousState: previousState,
+			NewState: map[string]interface{}{
+				"policy_document": document,
+			},
+		}, nil
+	}
+	if err != errNotInline {
+		return &ExecuteResult{
+			Success:      false,
+			ErrorMessage: err.Error(),
+		}, nil
+	}
+
+	policy, err := r.iamClient.GetPolicy(ctx, &iam.GetPolicyInput{
+		PolicyArn: aws.String(policyARN),
+	})
+	if err != nil {
+		return &ExecuteResult{
+			Success:      false,
+			ErrorMessage: fmt.Sprintf("failed to get policy: %s", err.Error()),
+		}, nil
+	}
+
+	previousState := map[string]interface{}{
+		"default_version_id": aws.ToString(policy.Policy.DefaultVersionId),
+	}
+
+	version, err := r.iamClient.CreatePolicyVersion(ctx, &iam.CreatePolicyVersionInput{
+		PolicyArn:      aws.String(policyARN),
+		PolicyDocument: aws.String(document),
+		SetAsDefault:   true,
+	})
+	if err != nil {
+		return &ExecuteResult{
+			Success:       false,
+			PreviousState: previousState,
+			ErrorMessage:  err.Error(),
+		}, nil
+	}
+
+	newState := map[string]interface{}{
+		"default_version_id": aws.ToString(version.PolicyVersion.VersionId),
+	}
+
+	r.logger.Info("IAM policy restricted",
+		"policy_arn", policyARN,
+		"version", newState["default_version_id"])
+
+	return &ExecuteResult{
+		Success:       true,
+		PreviousState: previousState,
+		NewState:      newState,
+	}, nil
+}
+
+// rollbackIAMPolicy restores the policy document in effect before the action
+func (r *AWSRemediator) rollbackIAMPolicy(ctx context.Context, action *Action) (*RollbackResult, error) {
+	policyARN := action.Parameters["policy_arn"].(string)
+
+	if document, ok := action.PreviousState["policy_document"].(string); ok {
+		if err := r.putInlinePolicy(ctx, action, document); err != nil {
+			return &RollbackResult{
+				Success:      false,
+				ErrorMessage: err.Error(),
+			}, nil
+		}
+	} else {
+		versionID, _ := action.PreviousState["default_version_id"].(string)
+		if versionID == "" {
+			return &RollbackResult{
+				Success:      false,
+				ErrorMessage: "previous policy version unknown",
+			}, nil
+		}
+		_, err := r.iamClient.SetDefaultPolicyVersion(ctx, &iam.SetDefaultPolicyVersionInput{
+			PolicyArn: aws.String(policyARN),
+			VersionId: aws.String(versionID),
+		})
+		if err != nil {
+			return &RollbackResult{
+				Success:      false,
+				ErrorMessage: err.Error(),
+			}, nil
+		}
+	}
+
+	r.logger.Info("IAM policy rolled back",
+		"policy_arn", policyARN)
+
+	return &RollbackResult{Success: true}, nil
+}
+
 // Helper function to get bool parameter from map
 func getBoolParam(m map[string]interface{}, key string) bool {
 	if m == nil {
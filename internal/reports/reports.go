@@ -611,7 +611,9 @@ func (g *Generator) mapFindingsToCompliance(findings []*ReportFinding) map[strin
 
 	for _, f := range findings {
 		switch f.Category {
-		case string(models.CategoryPII):
+		case string(models.CategoryPII), string(models.CategoryHealth), string(models.CategoryReligion),
+			string(models.CategoryEthnicity), string(models.CategorySexualOrientation),
+			string(models.CategoryBiometric), string(models.CategoryTradeUnion):
 			frameworks["GDPR"].Findings = append(frameworks["GDPR"].Findings, f)
 			frameworks["GDPR"].FailedChecks++
 		case string(models.CategoryPHI):
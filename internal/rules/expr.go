@@ -0,0 +1,624 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/qualys/dspm/internal/classifier"
+)
+
+// Rule conditions are boolean expressions evaluated over an object's content and
+// metadata. They refine a rule's patterns with proximity, counting and metadata logic:
+//
+//	(SSN OR /\bITIN\b/) WITHIN 50 CHARS OF ("name" OR DOB)
+//	    AND COUNT(MATCH) >= 5
+//	    AND NOT path MATCHES "/test/"
+//
+// Text terms:
+//
+//	MATCH           occurrences of the rule's own patterns (after validators and exclusions)
+//	CONTEXT         occurrences of the rule's context patterns
+//	SSN, EMAIL, ... occurrences of a built-in rule's patterns, validated by its validators
+//	/regex/         occurrences of a regular expression
+//	"text"          case-insensitive occurrences of literal text
+//
+// Operators, from loosest to tightest binding: OR, AND, NOT, WITHIN n [CHARS] OF.
+// COUNT(text) compares the number of occurrences with =, !=, <, <=, > or >=.
+// Metadata conditions compare path, bucket, size or tag.<key> with a value;
+// size accepts KB, MB and GB suffixes, and MATCHES tests a string field against a regex.
+
+// Expression is a compiled rule condition. It implements classifier.Condition.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// String returns the source the expression was compiled from
+func (x *Expression) String() string {
+	return x.source
+}
+
+// Evaluate reports whether the condition holds for the given content and metadata
+func (x *Expression) Evaluate(content string, meta *classifier.ObjectMetadata) bool {
+	if meta == nil {
+		meta = &classifier.ObjectMetadata{}
+	}
+	return x.root.truth(&evalContext{content: content, meta: meta})
+}
+
+type span struct{ start, end int }
+
+type evalContext struct {
+	content string
+	meta    *classifier.ObjectMetadata
+}
+
+type exprNode interface {
+	truth(ctx *evalContext) bool
+}
+
+// textNode is an expression that yields text occurrences, usable in WITHIN and COUNT
+type textNode interface {
+	exprNode
+	spans(ctx *evalContext) []span
+}
+
+// termNode finds occurrences of a set of patterns
+type termNode struct {
+	patterns []*regexp.Regexp
+	accept   func(content string, start, end int) bool
+}
+
+func (n *termNode) spans(ctx *evalContext) []span {
+	var result []span
+	for _, re := range n.patterns {
+		for _, idx := range re.FindAllStringIndex(ctx.content, -1) {
+			if n.accept == nil || n.accept(ctx.content, idx[0], idx[1]) {
+				result = append(result, span{idx[0], idx[1]})
+			}
+		}
+	}
+	return dedupeSpans(result)
+}
+
+func (n *termNode) truth(ctx *evalContext) bool { return len(n.spans(ctx)) > 0 }
+
+type orNode struct{ left, right exprNode }
+
+func (n *orNode) truth(ctx *evalContext) bool { return n.left.truth(ctx) || n.right.truth(ctx) }
+
+// textOrNode is an OR of text expressions; its occurrences are the union of both sides
+type textOrNode struct{ left, right textNode }
+
+func (n *textOrNode) spans(ctx *evalContext) []span {
+	return dedupeSpans(append(n.left.spans(ctx), n.right.spans(ctx)...))
+}
+
+func (n *textOrNode) truth(ctx *evalContext) bool { return len(n.spans(ctx)) > 0 }
+
+type andNode struct{ left, right exprNode }
+
+func (n *andNode) truth(ctx *evalContext) bool { return n.left.truth(ctx) && n.right.truth(ctx) }
+
+type notNode struct{ operand exprNode }
+
+func (n *notNode) truth(ctx *evalContext) bool { return !n.operand.truth(ctx) }
+
+// withinNode keeps occurrences of left that lie within distance characters of an occurrence of right
+type withinNode struct {
+	left, right textNode
+	distance    int
+}
+
+func (n *withinNode) spans(ctx *evalContext) []span {
+	anchors := n.right.spans(ctx)
+	if len(anchors) == 0 {
+		return nil
+	}
+	var result []span
+	for _, s := range n.left.spans(ctx) {
+		for _, a := range anchors {
+			if spanGap(s, a) <= n.distance {
+				result = append(result, s)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (n *withinNode) truth(ctx *evalContext) bool { return len(n.spans(ctx)) > 0 }
+
+type countNode struct {
+	operand textNode
+	op      string
+	value   int64
+}
+
+func (n *countNode) truth(ctx *evalContext) bool {
+	return compareInts(int64(len(n.operand.spans(ctx))), n.op, n.value)
+}
+
+// fieldNode compares an object metadata field with a literal
+type fieldNode struct {
+	field  string // path, bucket, size or tag
+	tagKey string
+	op     string
+	str    string
+	num    int64
+	re     *regexp.Regexp
+}
+
+func (n *fieldNode) truth(ctx *evalContext) bool {
+	if n.field == "size" {
+		return compareInts(ctx.meta.Size, n.op, n.num)
+	}
+
+	var actual string
+	switch n.field {
+	case "path":
+		actual = ctx.meta.Path
+	case "bucket":
+		actual = ctx.meta.Bucket
+	case "tag":
+		actual = ctx.meta.BucketTags[n.tagKey]
+	}
+
+	switch n.op {
+	case "MATCHES":
+		return n.re.MatchString(actual)
+	case "!=":
+		return actual != n.str
+	default:
+		return actual == n.str
+	}
+}
+
+func compareInts(actual int64, op string, expected int64) bool {
+	switch op {
+	case "=":
+		return actual == expected
+	case "!=":
+		return actual != expected
+	case "<":
+		return actual < expected
+	case "<=":
+		return actual <= expected
+	case ">":
+		return actual > expected
+	default:
+		return actual >= expected
+	}
+}
+
+// spanGap is the number of characters between two spans (0 if they overlap or touch)
+func spanGap(a, b span) int {
+	switch {
+	case a.end <= b.start:
+		return b.start - a.end
+	case b.end <= a.start:
+		return a.start - b.end
+	default:
+		return 0
+	}
+}
+
+func dedupeSpans(spans []span) []span {
+	if len(spans) < 2 {
+		return spans
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end < spans[j].end
+	})
+	result := spans[:1]
+	for _, s := range spans[1:] {
+		if s != result[len(result)-1] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// CompileExpression parses and type-checks a rule condition. rule supplies the
+// MATCH and CONTEXT terms; it may be nil when the condition does not use them.
+func CompileExpression(source string, rule *CompiledRule) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, rule: rule}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokRegex
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '"' || c == '/':
+			lit, n, err := scanDelimited(src[i:], byte(c))
+			if err != nil {
+				return nil, fmt.Errorf("%v at position %d", err, i)
+			}
+			kind := tokString
+			if c == '/' {
+				kind = tokRegex
+			}
+			tokens = append(tokens, token{kind, lit, i})
+			i += n
+		case strings.ContainsRune("<>=!", c):
+			op := string(c)
+			if i+1 < len(src) && src[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' at position %d", i)
+			}
+			if op == "==" {
+				op = "="
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+			if op == "=" && i < len(src) && src[i] == '=' {
+				i++
+			}
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(src) && unicode.IsDigit(rune(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, src[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || strings.ContainsRune("_.-", rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, src[start:i], start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at position %d", c, i)
+		}
+	}
+	return append(tokens, token{tokEOF, "end of expression", len(src)}), nil
+}
+
+// scanDelimited reads a literal enclosed in delim, where a backslash escapes the
+// delimiter. It returns the literal and the number of bytes consumed.
+func scanDelimited(src string, delim byte) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(src); i++ {
+		switch {
+		case src[i] == '\\' && i+1 < len(src) && src[i+1] == delim:
+			b.WriteByte(delim)
+			i++
+		case src[i] == delim:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated %c literal", delim)
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	rule   *CompiledRule
+}
+
+func (p *exprParser) peek() token { return p.tokens[p.pos] }
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// keyword consumes the next token if it is the given case-insensitive keyword
+func (p *exprParser) keyword(kw string) bool {
+	tok := p.peek()
+	if tok.kind == tokIdent && strings.EqualFold(tok.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(kind tokenKind, what string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, fmt.Errorf("expected %s at position %d, got %q", what, tok.pos, tok.text)
+	}
+	return tok, nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		lt, lok := left.(textNode)
+		rt, rok := right.(textNode)
+		if lok && rok {
+			left = &textOrNode{lt, rt}
+		} else {
+			left = &orNode{left, right}
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.keyword("NOT") {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	return p.parseWithin()
+}
+
+func (p *exprParser) parseWithin() (exprNode, error) {
+	start := p.peek()
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("WITHIN") {
+		distTok, err := p.expect(tokNumber, "a distance")
+		if err != nil {
+			return nil, err
+		}
+		distance, _ := strconv.Atoi(distTok.text)
+		p.keyword("CHARS")
+		if !p.keyword("OF") {
+			tok := p.peek()
+			return nil, fmt.Errorf("expected OF at position %d, got %q", tok.pos, tok.text)
+		}
+		rightStart := p.peek()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		lt, ok := left.(textNode)
+		if !ok {
+			return nil, fmt.Errorf("WITHIN requires a text expression at position %d", start.pos)
+		}
+		rt, ok := right.(textNode)
+		if !ok {
+			return nil, fmt.Errorf("WITHIN requires a text expression at position %d", rightStart.pos)
+		}
+		left = &withinNode{left: lt, right: rt, distance: distance}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return node, nil
+
+	case tokRegex:
+		re, err := regexp.Compile(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex at position %d: %w", tok.pos, err)
+		}
+		return &termNode{patterns: []*regexp.Regexp{re}}, nil
+
+	case tokString:
+		re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(tok.text))
+		return &termNode{patterns: []*regexp.Regexp{re}}, nil
+
+	case tokIdent:
+		if strings.EqualFold(tok.text, "COUNT") {
+			return p.parseCount(tok)
+		}
+		if field, tagKey, ok := metadataField(tok.text); ok {
+			return p.parseField(tok, field, tagKey)
+		}
+		return p.resolveTerm(tok)
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+func (p *exprParser) parseCount(countTok token) (exprNode, error) {
+	if _, err := p.expect(tokLParen, "'(' after COUNT"); err != nil {
+		return nil, err
+	}
+	operand, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+	text, ok := operand.(textNode)
+	if !ok {
+		return nil, fmt.Errorf("COUNT requires a text expression at position %d", countTok.pos)
+	}
+	opTok, err := p.expect(tokOp, "a comparison")
+	if err != nil {
+		return nil, err
+	}
+	numTok, err := p.expect(tokNumber, "a number")
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.ParseInt(numTok.text, 10, 64)
+	return &countNode{operand: text, op: opTok.text, value: n}, nil
+}
+
+func metadataField(name string) (field, tagKey string, ok bool) {
+	lower := strings.ToLower(name)
+	switch lower {
+	case "path", "bucket", "size":
+		return lower, "", true
+	}
+	if strings.HasPrefix(lower, "tag.") && len(name) > len("tag.") {
+		return "tag", name[len("tag."):], true
+	}
+	return "", "", false
+}
+
+var sizeUnits = map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30}
+
+func (p *exprParser) parseField(fieldTok token, field, tagKey string) (exprNode, error) {
+	node := &fieldNode{field: field, tagKey: tagKey}
+
+	if p.keyword("MATCHES") {
+		if field == "size" {
+			return nil, fmt.Errorf("MATCHES cannot be used with size at position %d", fieldTok.pos)
+		}
+		tok := p.next()
+		if tok.kind != tokString && tok.kind != tokRegex {
+			return nil, fmt.Errorf("expected a pattern at position %d, got %q", tok.pos, tok.text)
+		}
+		re, err := regexp.Compile(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex at position %d: %w", tok.pos, err)
+		}
+		node.op, node.re = "MATCHES", re
+		return node, nil
+	}
+
+	opTok, err := p.expect(tokOp, "a comparison or MATCHES")
+	if err != nil {
+		return nil, err
+	}
+	node.op = opTok.text
+
+	if field == "size" {
+		numTok, err := p.expect(tokNumber, "a size")
+		if err != nil {
+			return nil, err
+		}
+		node.num, _ = strconv.ParseInt(numTok.text, 10, 64)
+		if unit := p.peek(); unit.kind == tokIdent {
+			if mult, ok := sizeUnits[strings.ToUpper(unit.text)]; ok {
+				node.num *= mult
+				p.pos++
+			}
+		}
+		return node, nil
+	}
+
+	if node.op != "=" && node.op != "!=" {
+		return nil, fmt.Errorf("%s only supports =, != and MATCHES (position %d)", fieldTok.text, opTok.pos)
+	}
+	valTok, err := p.expect(tokString, "a quoted value")
+	if err != nil {
+		return nil, err
+	}
+	node.str = valTok.text
+	return node, nil
+}
+
+// resolveTerm maps an identifier to the patterns it stands for
+func (p *exprParser) resolveTerm(tok token) (exprNode, error) {
+	switch strings.ToUpper(tok.text) {
+	case "MATCH":
+		if p.rule == nil {
+			return nil, fmt.Errorf("MATCH is only available in rule conditions (position %d)", tok.pos)
+		}
+		return &termNode{patterns: p.rule.Patterns, accept: p.rule.accepts}, nil
+	case "CONTEXT":
+		if p.rule == nil {
+			return nil, fmt.Errorf("CONTEXT is only available in rule conditions (position %d)", tok.pos)
+		}
+		var patterns []*regexp.Regexp
+		for _, re := range p.rule.ContextPatterns {
+			patterns = append(patterns, regexp.MustCompile("(?i)"+re.String()))
+		}
+		return &termNode{patterns: patterns}, nil
+	}
+
+	for _, builtin := range classifier.DefaultRules() {
+		if strings.EqualFold(builtin.Name, tok.text) {
+			validators := builtin.Validators
+			return &termNode{
+				patterns: builtin.Patterns,
+				accept: func(content string, start, end int) bool {
+					for _, v := range validators {
+						if !v(content[start:end]) {
+							return false
+						}
+					}
+					return true
+				},
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown term %q at position %d (use MATCH, CONTEXT, a built-in rule name, /regex/ or \"text\")", tok.text, tok.pos)
+}
@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/qualys/dspm/internal/classifier"
+	"github.com/qualys/dspm/internal/models"
+)
+
+func compileTestRule(t *testing.T, rule *CustomRule) *CompiledRule {
+	t.Helper()
+	compiled, err := NewEngine(newMemStore()).compileRule(rule)
+	if err != nil {
+		t.Fatalf("compileRule: %v", err)
+	}
+	return compiled
+}
+
+func TestCompileExpression_Errors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`SSN AND`, "unexpected"},
+		{`(SSN OR DOB`, "expected ')'"},
+		{`UNKNOWN_RULE`, "unknown term"},
+		{`/[a-/`, "invalid regex"},
+		{`"unterminated`, "unterminated"},
+		{`path WITHIN 10 CHARS OF SSN`, "expected a comparison"},
+		{`size > 10 WITHIN 5 OF SSN`, "WITHIN requires a text expression"},
+		{`COUNT(size > 10) > 1`, "COUNT requires a text expression"},
+		{`path > "a"`, "only supports"},
+		{`size MATCHES "1"`, "MATCHES cannot be used with size"},
+		{`MATCH`, "only available in rule conditions"},
+	}
+
+	for _, tt := range tests {
+		_, err := CompileExpression(tt.expr, nil)
+		if err == nil {
+			t.Errorf("%q: expected error", tt.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected error containing %q, got %v", tt.expr, tt.want, err)
+		}
+	}
+}
+
+func TestExpression_Evaluate(t *testing.T) {
+	meta := &classifier.ObjectMetadata{
+		Bucket:     "hr-exports",
+		Path:       "exports/2024/patients.csv",
+		Size:       2 << 20,
+		BucketTags: map[string]string{"env": "prod"},
+	}
+
+	tests := []struct {
+		expr    string
+		content string
+		want    bool
+	}{
+		{`SSN WITHIN 20 CHARS OF "patient"`, "patient John, SSN 123-45-6789", true},
+		{`SSN WITHIN 5 CHARS OF "patient"`, "patient John Smith, SSN 123-45-6789", false},
+		{`SSN WITHIN 20 OF ("name" OR DOB)`, "name: Jane 123-45-6789", true},
+		{`SSN`, "SSN 000-12-3456", false}, // Rejected by the SSN validator
+		{`COUNT(SSN) >= 2`, "123-45-6789 and 234-56-7890", true},
+		{`COUNT(SSN) >= 2`, "123-45-6789 only", false},
+		{`COUNT(/\bID-\d+/ OR "badge") = 3`, "ID-1 ID-2 badge", true},
+		{`NOT path MATCHES "/test/" AND bucket = "hr-exports"`, "", true},
+		{`path MATCHES /\.csv$/ AND size > 1MB AND size <= 2MB`, "", true},
+		{`tag.env = "prod" AND tag.owner != "qa"`, "", true},
+		{`tag.env != "prod" OR size < 1KB`, "", false},
+		{`NOT (SSN OR "secret")`, "nothing here", true},
+		{`"CONFIDENTIAL" and not /draft/`, "confidential report", true},
+	}
+
+	for _, tt := range tests {
+		expr, err := CompileExpression(tt.expr, nil)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := expr.Evaluate(tt.content, meta); got != tt.want {
+			t.Errorf("%q on %q: expected %v, got %v", tt.expr, tt.content, tt.want, got)
+		}
+	}
+}
+
+func TestExpression_MatchUsesRuleExclusions(t *testing.T) {
+	compiled := compileTestRule(t, &CustomRule{
+		Name:             "Member ID",
+		Patterns:         []string{`\bMBR\d{6}\b`},
+		ContextPatterns:  []string{`member`},
+		NegativePatterns: []string{`sample`},
+	})
+
+	expr, err := CompileExpression(`MATCH WITHIN 15 CHARS OF CONTEXT`, compiled)
+	if err != nil {
+		t.Fatalf("CompileExpression: %v", err)
+	}
+	if !expr.Evaluate("Member: MBR123456", nil) {
+		t.Error("expected match near context")
+	}
+	if expr.Evaluate("Member: MBR123456 (sample data)", nil) {
+		t.Error("expected negative pattern to exclude the match")
+	}
+}
+
+func TestEngine_RuleConditionAppliedDuringClassification(t *testing.T) {
+	ctx := context.Background()
+	engine := NewEngine(newMemStore())
+
+	rule := &CustomRule{
+		Name:        "Patient Bulk Export",
+		Category:    models.CategoryPHI,
+		Sensitivity: models.SensitivityCritical,
+		Patterns:    []string{`\bPT-\d{5}\b`},
+		Condition:   `COUNT(MATCH) >= 2 AND MATCH WITHIN 30 CHARS OF DOB AND NOT path MATCHES "(^|/)test/"`,
+		Enabled:     true,
+	}
+	if err := engine.CreateRule(ctx, rule); err != nil {
+		t.Fatalf("CreateRule: %v", err)
+	}
+
+	c, err := engine.NewClassifier()
+	if err != nil {
+		t.Fatalf("NewClassifier: %v", err)
+	}
+
+	content := "PT-10001 DOB: 04/05/1975\nPT-10002 DOB: 01/02/1980"
+	if findMatch(c.ClassifyObject(content, &classifier.ObjectMetadata{Path: "exports/patients.csv"}), rule.Name) == nil {
+		t.Error("expected rule to match when the condition holds")
+	}
+	if findMatch(c.ClassifyObject(content, &classifier.ObjectMetadata{Path: "test/patients.csv"}), rule.Name) != nil {
+		t.Error("expected path condition to suppress the match")
+	}
+	if findMatch(c.Classify("PT-10001 DOB: 04/05/1975"), rule.Name) != nil {
+		t.Error("expected COUNT condition to suppress a single match")
+	}
+
+	invalid := *rule
+	invalid.Condition = `COUNT(MATCH) >=`
+	if err := engine.UpdateRule(ctx, &invalid); err == nil || !strings.Contains(err.Error(), "invalid condition") {
+		t.Errorf("expected invalid condition to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,536 @@
+package rules
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/qualys/dspm/internal/models"
+)
+
+var (
+	ErrInvalidPack        = errors.New("invalid rule pack")
+	ErrPackNotFound       = errors.New("rule pack not found")
+	ErrPackDowngrade      = errors.New("pack version is older than the installed version")
+	ErrPackVersionNotBump = errors.New("pack content changed without a version bump")
+	ErrPackRuleConflict   = errors.New("rule belongs to another pack")
+)
+
+// RulePack is the declarative, version-controlled form of a set of custom rules.
+// Packs are written as YAML or JSON and managed through import/export.
+type RulePack struct {
+	Name        string     `json:"name" yaml:"name"`
+	Version     string     `json:"version" yaml:"version"` // Semantic version, e.g. 1.4.0
+	Description string     `json:"description,omitempty" yaml:"description,omitempty"`
+	Rules       []PackRule `json:"rules" yaml:"rules"`
+}
+
+// PackRule is a single rule definition within a pack
+type PackRule struct {
+	Name             string             `json:"name" yaml:"name"`
+	Description      string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Category         models.Category    `json:"category" yaml:"category"`
+	Sensitivity      models.Sensitivity `json:"sensitivity" yaml:"sensitivity"`
+	Priority         int                `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Enabled          *bool              `json:"enabled,omitempty" yaml:"enabled,omitempty"` // Defaults to true
+	Patterns         []string           `json:"patterns" yaml:"patterns"`
+	ContextPatterns  []string           `json:"context_patterns,omitempty" yaml:"context_patterns,omitempty"`
+	ContextRequired  bool               `json:"context_required,omitempty" yaml:"context_required,omitempty"`
+	NegativePatterns []string           `json:"negative_patterns,omitempty" yaml:"negative_patterns,omitempty"`
+	Validators       []string           `json:"validators,omitempty" yaml:"validators,omitempty"`
+	Condition        string             `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Tests            RuleTestCases      `json:"tests,omitempty" yaml:"tests,omitempty"`
+}
+
+// PackInfo records the installed version of a rule pack
+type PackInfo struct {
+	Name        string    `json:"name" db:"name"`
+	Version     string    `json:"version" db:"version"`
+	Description string    `json:"description" db:"description"`
+	Checksum    string    `json:"checksum" db:"checksum"`
+	ImportedBy  string    `json:"imported_by" db:"imported_by"`
+	ImportedAt  time.Time `json:"imported_at" db:"imported_at"`
+}
+
+// PackDiff previews what importing a pack would change
+type PackDiff struct {
+	Pack           string     `json:"pack"`
+	CurrentVersion string     `json:"current_version,omitempty"`
+	NewVersion     string     `json:"new_version"`
+	Added          []RuleDiff `json:"added"`
+	Updated        []RuleDiff `json:"updated"`
+	Removed        []RuleDiff `json:"removed"`
+	Unchanged      []string   `json:"unchanged"`
+}
+
+// RuleDiff describes one added, updated or removed rule
+type RuleDiff struct {
+	Name             string          `json:"name"`
+	Category         models.Category `json:"category"`
+	PreviousCategory models.Category `json:"previous_category,omitempty"`
+	Changes          []FieldChange   `json:"changes,omitempty"`
+	// Widens is set when the update may match objects the rule did not, see Widens
+	Widens bool `json:"widens,omitempty"`
+}
+
+// FieldChange is a single field that differs between the installed and imported rule
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// HasChanges reports whether applying the diff would modify any rule
+func (d *PackDiff) HasChanges() bool {
+	return len(d.Added) > 0 || len(d.Updated) > 0 || len(d.Removed) > 0
+}
+
+// ImportOptions controls how ImportPack treats the installed pack version
+type ImportOptions struct {
+	DryRun         bool
+	AllowDowngrade bool   // Permit rolling back to an older pack version
+	ImportedBy     string // User recorded on the pack and on created rules
+}
+
+// ParsePack decodes a rule pack from YAML or JSON
+func ParsePack(data []byte) (*RulePack, error) {
+	var pack RulePack
+	// JSON is valid YAML, so one decoder handles both formats
+	if err := yaml.Unmarshal(data, &pack); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPack, err)
+	}
+	return &pack, nil
+}
+
+// MarshalPack encodes a rule pack as "yaml" (default) or "json"
+func MarshalPack(pack *RulePack, format string) ([]byte, error) {
+	if format == "json" {
+		return json.MarshalIndent(pack, "", "  ")
+	}
+	return yaml.Marshal(pack)
+}
+
+// Validate checks the pack structure, compiles every rule and runs each rule's
+// test cases, so a pack that fails its own tests is never installed.
+func (p *RulePack) Validate() error {
+	if p.Name == "" {
+		return errors.New("pack name is required")
+	}
+	if _, err := parseSemver(p.Version); err != nil {
+		return fmt.Errorf("pack version: %w", err)
+	}
+
+	seen := make(map[string]bool, len(p.Rules))
+	for i, pr := range p.Rules {
+		if pr.Name == "" {
+			return fmt.Errorf("rule %d: name is required", i)
+		}
+		if seen[pr.Name] {
+			return fmt.Errorf("rule %q: duplicate name", pr.Name)
+		}
+		seen[pr.Name] = true
+
+		if err := pr.validate(); err != nil {
+			return fmt.Errorf("rule %q: %w", pr.Name, err)
+		}
+	}
+	return nil
+}
+
+// LoadPack compiles the enabled rules of a validated pack in place of the
+// stored rules, for offline use such as evaluation. Nothing is written to the
+// store, so the engine may have been created without one.
+func (e *Engine) LoadPack(pack *RulePack) error {
+	if err := pack.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPack, err)
+	}
+
+	var rules []*CustomRule
+	for _, pr := range pack.Rules {
+		rule := pr.toRule(pack.Name)
+		if rule.Enabled {
+			rules = append(rules, rule)
+		}
+	}
+	// Same order as LoadRules: highest priority first
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority > rules[j].Priority })
+
+	compiledRules := make([]*CompiledRule, 0, len(rules))
+	for _, rule := range rules {
+		compiled, err := e.compileRule(rule)
+		if err != nil {
+			return fmt.Errorf("failed to compile rule %s: %w", rule.Name, err)
+		}
+		compiledRules = append(compiledRules, compiled)
+	}
+
+	e.mu.Lock()
+	e.compiledRules = compiledRules
+	e.mu.Unlock()
+	return nil
+}
+
+func (pr *PackRule) validate() error {
+	if pr.Category == "" {
+		return errors.New("category is required")
+	}
+	switch pr.Sensitivity {
+	case models.SensitivityCritical, models.SensitivityHigh, models.SensitivityMedium, models.SensitivityLow:
+	default:
+		return fmt.Errorf("invalid sensitivity %q", pr.Sensitivity)
+	}
+	if len(pr.Patterns) == 0 {
+		return errors.New("at least one pattern is required")
+	}
+	for _, pattern := range pr.Patterns {
+		if err := ValidatePattern(pattern); err != nil {
+			return err
+		}
+	}
+
+	return (&Engine{}).validateRule(pr.toRule(""))
+}
+
+func (pr *PackRule) toRule(pack string) *CustomRule {
+	enabled := true
+	if pr.Enabled != nil {
+		enabled = *pr.Enabled
+	}
+	return &CustomRule{
+		Name:             pr.Name,
+		Description:      pr.Description,
+		Category:         pr.Category,
+		Sensitivity:      pr.Sensitivity,
+		Patterns:         pr.Patterns,
+		ContextPatterns:  pr.ContextPatterns,
+		NegativePatterns: pr.NegativePatterns,
+		Validators:       pr.Validators,
+		Condition:        pr.Condition,
+		TestCases:        pr.Tests,
+		ContextRequired:  pr.ContextRequired,
+		Enabled:          enabled,
+		Priority:         pr.Priority,
+		Pack:             pack,
+	}
+}
+
+func packRuleFrom(rule *CustomRule) PackRule {
+	enabled := rule.Enabled
+	return PackRule{
+		Name:             rule.Name,
+		Description:      rule.Description,
+		Category:         rule.Category,
+		Sensitivity:      rule.Sensitivity,
+		Priority:         rule.Priority,
+		Enabled:          &enabled,
+		Patterns:         rule.Patterns,
+		ContextPatterns:  rule.ContextPatterns,
+		ContextRequired:  rule.ContextRequired,
+		NegativePatterns: rule.NegativePatterns,
+		Validators:       rule.Validators,
+		Condition:        rule.Condition,
+		Tests:            rule.TestCases,
+	}
+}
+
+// Checksum fingerprints the pack content, independent of rule order and version
+func (p *RulePack) Checksum() string {
+	rules := make([]PackRule, len(p.Rules))
+	for i, pr := range p.Rules {
+		rules[i] = packRuleFrom(pr.toRule(p.Name))
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+
+	data, _ := json.Marshal(struct {
+		Description string     `json:"description"`
+		Rules       []PackRule `json:"rules"`
+	}{p.Description, rules})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// importPlan is the set of store operations needed to install a pack
+type importPlan struct {
+	create []*CustomRule
+	update []*CustomRule
+	remove []*CustomRule
+}
+
+// PreviewImport validates a pack and reports what importing it would change
+func (e *Engine) PreviewImport(ctx context.Context, pack *RulePack, opts ImportOptions) (*PackDiff, error) {
+	_, diff, err := e.planImport(ctx, pack, opts)
+	return diff, err
+}
+
+// ImportPack installs a pack: rules are matched to the installed pack by name,
+// then created, updated or removed so the pack's rules match the definition.
+// Rules outside any pack are adopted by name; a name taken by another pack's
+// rule is a conflict. With opts.DryRun the diff is returned without changing
+// anything.
+func (e *Engine) ImportPack(ctx context.Context, pack *RulePack, opts ImportOptions) (*PackDiff, error) {
+	plan, diff, err := e.planImport(ctx, pack, opts)
+	if err != nil || opts.DryRun {
+		return diff, err
+	}
+
+	// The whole pack lands or none of it does
+	err = e.store.InTx(ctx, func(store Store) error {
+		for _, rule := range plan.create {
+			rule.CreatedBy = opts.ImportedBy
+			if err := store.CreateRule(ctx, rule); err != nil {
+				return fmt.Errorf("creating rule %q: %w", rule.Name, err)
+			}
+			if err := store.SetRulePatterns(ctx, rule.ID, rule.Patterns, rule.ContextPatterns); err != nil {
+				return fmt.Errorf("saving patterns for rule %q: %w", rule.Name, err)
+			}
+		}
+		for _, rule := range plan.update {
+			if err := store.UpdateRule(ctx, rule); err != nil {
+				return fmt.Errorf("updating rule %q: %w", rule.Name, err)
+			}
+			if err := store.SetRulePatterns(ctx, rule.ID, rule.Patterns, rule.ContextPatterns); err != nil {
+				return fmt.Errorf("saving patterns for rule %q: %w", rule.Name, err)
+			}
+		}
+		for _, rule := range plan.remove {
+			if err := store.DeleteRule(ctx, rule.ID); err != nil {
+				return fmt.Errorf("removing rule %q: %w", rule.Name, err)
+			}
+		}
+
+		if err := store.SavePack(ctx, &PackInfo{
+			Name:        pack.Name,
+			Version:     pack.Version,
+			Description: pack.Description,
+			Checksum:    pack.Checksum(),
+			ImportedBy:  opts.ImportedBy,
+		}); err != nil {
+			return fmt.Errorf("recording pack version: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return diff, e.LoadRules(ctx)
+}
+
+func (e *Engine) planImport(ctx context.Context, pack *RulePack, opts ImportOptions) (*importPlan, *PackDiff, error) {
+	if err := pack.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPack, err)
+	}
+
+	installed, err := e.store.GetPack(ctx, pack.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading installed pack: %w", err)
+	}
+
+	diff := &PackDiff{
+		Pack:       pack.Name,
+		NewVersion: pack.Version,
+		Added:      []RuleDiff{},
+		Updated:    []RuleDiff{},
+		Removed:    []RuleDiff{},
+		Unchanged:  []string{},
+	}
+
+	if installed != nil {
+		diff.CurrentVersion = installed.Version
+		cmp, err := compareSemver(pack.Version, installed.Version)
+		if err != nil {
+			return nil, nil, fmt.Errorf("installed pack version: %w", err)
+		}
+		switch {
+		case cmp < 0 && !opts.AllowDowngrade:
+			return nil, nil, fmt.Errorf("%w: %s < %s", ErrPackDowngrade, pack.Version, installed.Version)
+		case cmp == 0 && pack.Checksum() != installed.Checksum:
+			return nil, nil, fmt.Errorf("%w: version %s is already installed", ErrPackVersionNotBump, pack.Version)
+		}
+	}
+
+	all, err := e.GetRules(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading rules: %w", err)
+	}
+	var existing []*CustomRule
+	byName := make(map[string]*CustomRule)
+	// others holds the rules outside this pack, which may be adopted or conflict
+	others := make(map[string]*CustomRule)
+	for _, rule := range all {
+		if rule.Pack == pack.Name {
+			existing = append(existing, rule)
+			byName[rule.Name] = rule
+		} else {
+			others[rule.Name] = rule
+		}
+	}
+
+	plan := &importPlan{}
+	for _, pr := range pack.Rules {
+		desired := pr.toRule(pack.Name)
+		current, ok := byName[pr.Name]
+		if ok {
+			delete(byName, pr.Name)
+		} else if current, ok = others[pr.Name]; ok && current.Pack != "" {
+			return nil, nil, fmt.Errorf("%w: %q is in pack %q", ErrPackRuleConflict, pr.Name, current.Pack)
+		}
+		if !ok {
+			plan.create = append(plan.create, desired)
+			diff.Added = append(diff.Added, RuleDiff{Name: desired.Name, Category: desired.Category})
+			continue
+		}
+
+		changes := diffRules(current, desired)
+		if len(changes) == 0 {
+			diff.Unchanged = append(diff.Unchanged, desired.Name)
+			continue
+		}
+
+		desired.ID = current.ID
+		desired.CreatedBy = current.CreatedBy
+		plan.update = append(plan.update, desired)
+		change := RuleDiff{Name: desired.Name, Category: desired.Category, Changes: changes, Widens: Widens(current, desired)}
+		if current.Category != desired.Category {
+			change.PreviousCategory = current.Category
+		}
+		diff.Updated = append(diff.Updated, change)
+	}
+
+	for _, rule := range existing {
+		if _, stale := byName[rule.Name]; stale {
+			plan.remove = append(plan.remove, rule)
+			diff.Removed = append(diff.Removed, RuleDiff{Name: rule.Name, Category: rule.Category})
+		}
+	}
+
+	return plan, diff, nil
+}
+
+// packRules returns the installed rules belonging to a pack, with their patterns.
+// An empty pack name selects the rules outside any pack.
+func (e *Engine) packRules(ctx context.Context, pack string) ([]*CustomRule, error) {
+	all, err := e.GetRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading rules: %w", err)
+	}
+	var result []*CustomRule
+	for _, rule := range all {
+		if rule.Pack == pack {
+			result = append(result, rule)
+		}
+	}
+	return result, nil
+}
+
+// ExportPack returns the installed rules of a pack in declarative form.
+// With an empty name the rules outside any pack are exported as a single
+// unversioned pack, which is the starting point for bringing existing rules
+// under version control: importing it adopts them.
+func (e *Engine) ExportPack(ctx context.Context, name string) (*RulePack, error) {
+	pack := &RulePack{Name: "custom-rules", Version: "0.0.0"}
+	if name != "" {
+		installed, err := e.store.GetPack(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if installed == nil {
+			return nil, ErrPackNotFound
+		}
+		pack.Name = installed.Name
+		pack.Version = installed.Version
+		pack.Description = installed.Description
+	}
+
+	rules, err := e.packRules(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return rules[i].Name < rules[j].Name
+	})
+
+	pack.Rules = make([]PackRule, 0, len(rules))
+	for _, rule := range rules {
+		pack.Rules = append(pack.Rules, packRuleFrom(rule))
+	}
+	return pack, nil
+}
+
+// diffRules lists the declarative fields that differ between two rules
+func diffRules(current, desired *CustomRule) []FieldChange {
+	var changes []FieldChange
+	add := func(field string, old, new interface{}) {
+		if !reflect.DeepEqual(old, new) {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+
+	add("description", current.Description, desired.Description)
+	add("category", current.Category, desired.Category)
+	add("sensitivity", current.Sensitivity, desired.Sensitivity)
+	add("priority", current.Priority, desired.Priority)
+	add("enabled", current.Enabled, desired.Enabled)
+	add("patterns", nonNil(current.Patterns), nonNil(desired.Patterns))
+	add("context_patterns", nonNil(current.ContextPatterns), nonNil(desired.ContextPatterns))
+	add("context_required", current.ContextRequired, desired.ContextRequired)
+	add("negative_patterns", nonNil(current.NegativePatterns), nonNil(desired.NegativePatterns))
+	add("validators", nonNil(current.Validators), nonNil(desired.Validators))
+	add("condition", current.Condition, desired.Condition)
+	add("pack", current.Pack, desired.Pack)
+	add("tests.match", nonNil(current.TestCases.Match), nonNil(desired.TestCases.Match))
+	add("tests.no_match", nonNil(current.TestCases.NoMatch), nonNil(desired.TestCases.NoMatch))
+	return changes
+}
+
+// parseSemver parses MAJOR.MINOR.PATCH, with an optional leading "v".
+// Pre-release and build suffixes are not supported.
+func parseSemver(v string) ([3]int, error) {
+	var parsed [3]int
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(parts) != 3 {
+		return parsed, fmt.Errorf("%q is not a semantic version (MAJOR.MINOR.PATCH)", v)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, fmt.Errorf("%q is not a semantic version (MAJOR.MINOR.PATCH)", v)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+// compareSemver returns -1, 0 or 1 as a is older than, equal to or newer than b
+func compareSemver(a, b string) (int, error) {
+	pa, err := parseSemver(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parseSemver(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
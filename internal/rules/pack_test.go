@@ -0,0 +1,271 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const testPackV1 = `
+name: finance
+version: 1.0.0
+description: Finance identifiers
+rules:
+  - name: Employee ID
+    category: PII
+    sensitivity: HIGH
+    priority: 50
+    patterns: ['\bEMP-\d{6}\b']
+    context_patterns: [employee]
+    context_required: true
+    tests:
+      match: ["employee EMP-123456"]
+      no_match: ["ticket EMP-123456"]
+  - name: Card Number
+    category: PCI
+    sensitivity: CRITICAL
+    patterns: ['\b\d{16}\b']
+    validators: [luhn]
+    negative_patterns: [test card]
+    tests:
+      match: ["card 4111111111111111"]
+      no_match: ["card 4111111111111112", "test card 4111111111111111"]
+`
+
+func importPack(t *testing.T, engine *Engine, data string, opts ImportOptions) *PackDiff {
+	t.Helper()
+	pack, err := ParsePack([]byte(data))
+	if err != nil {
+		t.Fatalf("ParsePack: %v", err)
+	}
+	diff, err := engine.ImportPack(context.Background(), pack, opts)
+	if err != nil {
+		t.Fatalf("ImportPack: %v", err)
+	}
+	return diff
+}
+
+func TestImportPack_CreatesRules(t *testing.T) {
+	engine := NewEngine(newMemStore())
+
+	diff := importPack(t, engine, testPackV1, ImportOptions{})
+	if len(diff.Added) != 2 || len(diff.Updated) != 0 || len(diff.Removed) != 0 {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+
+	rules, err := engine.GetRules(context.Background())
+	if err != nil {
+		t.Fatalf("GetRules: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	for _, rule := range rules {
+		if rule.Pack != "finance" {
+			t.Errorf("rule %q: expected pack finance, got %q", rule.Name, rule.Pack)
+		}
+		if !rule.Enabled {
+			t.Errorf("rule %q: expected enabled by default", rule.Name)
+		}
+	}
+
+	c, err := engine.NewClassifier()
+	if err != nil {
+		t.Fatalf("NewClassifier: %v", err)
+	}
+	if findMatch(c.Classify("card 4111111111111112"), "Card Number") != nil {
+		t.Error("expected luhn validator to reject invalid card")
+	}
+	if findMatch(c.Classify("card 4111111111111111"), "Card Number") == nil {
+		t.Error("expected valid card to match")
+	}
+}
+
+func TestImportPack_DryRunDiff(t *testing.T) {
+	store := newMemStore()
+	engine := NewEngine(store)
+	importPack(t, engine, testPackV1, ImportOptions{})
+
+	v2 := `
+name: finance
+version: 1.1.0
+rules:
+  - name: Employee ID
+    category: PII
+    sensitivity: CRITICAL
+    priority: 50
+    patterns: ['\bEMP-\d{6}\b']
+    context_patterns: [employee]
+    context_required: true
+  - name: Vendor ID
+    category: CUSTOM
+    sensitivity: LOW
+    patterns: ['\bVND-\d{4}\b']
+`
+	diff := importPack(t, engine, v2, ImportOptions{DryRun: true})
+	if diff.CurrentVersion != "1.0.0" || diff.NewVersion != "1.1.0" {
+		t.Errorf("unexpected versions: %s -> %s", diff.CurrentVersion, diff.NewVersion)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Name != "Vendor ID" {
+		t.Errorf("expected Vendor ID added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "Card Number" {
+		t.Errorf("expected Card Number removed, got %+v", diff.Removed)
+	}
+	if len(diff.Updated) != 1 || diff.Updated[0].Name != "Employee ID" {
+		t.Fatalf("expected Employee ID updated, got %+v", diff.Updated)
+	}
+	fields := map[string]bool{}
+	for _, change := range diff.Updated[0].Changes {
+		fields[change.Field] = true
+	}
+	if !fields["sensitivity"] || !fields["tests.match"] {
+		t.Errorf("expected sensitivity and tests.match changes, got %+v", diff.Updated[0].Changes)
+	}
+
+	// Dry run must not modify anything
+	if store.packs["finance"].Version != "1.0.0" || len(store.rules) != 2 {
+		t.Error("dry run modified the installed pack")
+	}
+
+	importPack(t, engine, v2, ImportOptions{})
+	if store.packs["finance"].Version != "1.1.0" {
+		t.Errorf("expected installed version 1.1.0, got %s", store.packs["finance"].Version)
+	}
+	exported, err := engine.ExportPack(context.Background(), "finance")
+	if err != nil {
+		t.Fatalf("ExportPack: %v", err)
+	}
+	if len(exported.Rules) != 2 || exported.Rules[0].Name != "Employee ID" {
+		t.Errorf("unexpected exported rules: %+v", exported.Rules)
+	}
+}
+
+func TestImportPack_VersionChecks(t *testing.T) {
+	engine := NewEngine(newMemStore())
+	importPack(t, engine, testPackV1, ImportOptions{})
+
+	// Re-importing the same version with identical content is a no-op
+	if diff := importPack(t, engine, testPackV1, ImportOptions{}); diff.HasChanges() {
+		t.Errorf("expected no changes, got %+v", diff)
+	}
+
+	changed, _ := ParsePack([]byte(testPackV1))
+	changed.Rules[0].Priority = 10
+	if _, err := engine.ImportPack(context.Background(), changed, ImportOptions{}); !errors.Is(err, ErrPackVersionNotBump) {
+		t.Errorf("expected ErrPackVersionNotBump, got %v", err)
+	}
+
+	older, _ := ParsePack([]byte(testPackV1))
+	older.Version = "0.9.0"
+	if _, err := engine.ImportPack(context.Background(), older, ImportOptions{}); !errors.Is(err, ErrPackDowngrade) {
+		t.Errorf("expected ErrPackDowngrade, got %v", err)
+	}
+	if _, err := engine.ImportPack(context.Background(), older, ImportOptions{AllowDowngrade: true}); err != nil {
+		t.Errorf("expected downgrade to be allowed, got %v", err)
+	}
+}
+
+func TestImportPack_RejectsFailingTests(t *testing.T) {
+	engine := NewEngine(newMemStore())
+	pack, _ := ParsePack([]byte(testPackV1))
+	pack.Rules[0].Tests.Match = append(pack.Rules[0].Tests.Match, "no identifier here")
+
+	if _, err := engine.ImportPack(context.Background(), pack, ImportOptions{}); !errors.Is(err, ErrInvalidPack) {
+		t.Errorf("expected ErrInvalidPack, got %v", err)
+	}
+}
+
+func TestImportPack_RollsBackOnFailure(t *testing.T) {
+	store := newMemStore()
+	engine := NewEngine(store)
+	store.savePackErr = errors.New("connection reset")
+
+	pack, _ := ParsePack([]byte(testPackV1))
+	if _, err := engine.ImportPack(context.Background(), pack, ImportOptions{}); err == nil {
+		t.Fatal("expected the import to fail")
+	}
+	if len(store.rules) != 0 || len(store.patterns) != 0 {
+		t.Errorf("expected no rules left behind, got %d rules and %d pattern sets", len(store.rules), len(store.patterns))
+	}
+
+	store.savePackErr = nil
+	if diff := importPack(t, engine, testPackV1, ImportOptions{}); len(diff.Added) != 2 {
+		t.Errorf("expected the retry to add 2 rules, got %+v", diff)
+	}
+}
+
+func TestImportPack_ExportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	engine := NewEngine(store)
+	importPack(t, engine, testPackV1, ImportOptions{})
+	for _, rule := range []*CustomRule{
+		{Name: "Badge Number", Category: "PII", Sensitivity: "MEDIUM", Patterns: []string{`\bBDG-\d{5}\b`}, Enabled: true},
+		{Name: "Project Code", Category: "CUSTOM", Sensitivity: "LOW", Patterns: []string{`\bPRJ-\d{3}\b`}, Enabled: true},
+	} {
+		if err := engine.CreateRule(ctx, rule); err != nil {
+			t.Fatalf("CreateRule: %v", err)
+		}
+	}
+
+	// Only the rules outside a pack are exported
+	exported, err := engine.ExportPack(ctx, "")
+	if err != nil {
+		t.Fatalf("ExportPack: %v", err)
+	}
+	if len(exported.Rules) != 2 {
+		t.Fatalf("expected the 2 unpacked rules, got %+v", exported.Rules)
+	}
+	data, err := MarshalPack(exported, "yaml")
+	if err != nil {
+		t.Fatalf("MarshalPack: %v", err)
+	}
+
+	// Importing the export adopts the rules instead of duplicating them
+	diff := importPack(t, engine, string(data), ImportOptions{})
+	if len(diff.Added) != 0 || len(diff.Updated) != 2 || len(diff.Removed) != 0 {
+		t.Errorf("expected 2 rules adopted, got %+v", diff)
+	}
+	if len(store.rules) != 4 {
+		t.Errorf("expected 4 rules, got %d", len(store.rules))
+	}
+	for _, rule := range store.rules {
+		if rule.Pack == "" {
+			t.Errorf("rule %q: expected it to be adopted into a pack", rule.Name)
+		}
+	}
+	if diff := importPack(t, engine, string(data), ImportOptions{}); diff.HasChanges() {
+		t.Errorf("expected the second import to change nothing, got %+v", diff)
+	}
+
+	// A name held by another pack is a conflict
+	conflicting, _ := ParsePack(data)
+	conflicting.Name = "hr"
+	if _, err := engine.ImportPack(ctx, conflicting, ImportOptions{}); !errors.Is(err, ErrPackRuleConflict) {
+		t.Errorf("expected ErrPackRuleConflict, got %v", err)
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.2.0", "1.10.0", -1},
+		{"v2.0.0", "1.9.9", 1},
+	}
+	for _, tt := range tests {
+		got, err := compareSemver(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("compareSemver(%s, %s): %v", tt.a, tt.b, err)
+		}
+		if got != tt.want {
+			t.Errorf("compareSemver(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if _, err := parseSemver("1.0"); err == nil {
+		t.Error("expected error for incomplete version")
+	}
+}
@@ -6,31 +6,52 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/qualys/dspm/internal/classifier"
 	"github.com/qualys/dspm/internal/models"
 )
 
 type CustomRule struct {
-	ID              string             `json:"id" db:"id"`
-	Name            string             `json:"name" db:"name"`
-	Description     string             `json:"description" db:"description"`
-	Category        models.Category    `json:"category" db:"category"`
-	Sensitivity     models.Sensitivity `json:"sensitivity" db:"sensitivity"`
-	Patterns        []string           `json:"patterns" db:"-"`
-	ContextPatterns []string           `json:"context_patterns,omitempty" db:"-"`
-	ContextRequired bool               `json:"context_required" db:"context_required"`
-	Enabled         bool               `json:"enabled" db:"enabled"`
-	Priority        int                `json:"priority" db:"priority"` // Higher priority runs first
-	CreatedBy       string             `json:"created_by" db:"created_by"`
-	CreatedAt       time.Time          `json:"created_at" db:"created_at"`
-	UpdatedAt       time.Time          `json:"updated_at" db:"updated_at"`
+	ID               string             `json:"id" db:"id"`
+	Name             string             `json:"name" db:"name"`
+	Description      string             `json:"description" db:"description"`
+	Category         models.Category    `json:"category" db:"category"`
+	Sensitivity      models.Sensitivity `json:"sensitivity" db:"sensitivity"`
+	Patterns         []string           `json:"patterns" db:"-"`
+	ContextPatterns  []string           `json:"context_patterns,omitempty" db:"-"`
+	NegativePatterns []string           `json:"negative_patterns,omitempty" db:"negative_patterns"` // Exclusions checked around each match
+	Validators       []string           `json:"validators,omitempty" db:"validators"`               // Names from classifier.ValidatorNames
+	TestCases        RuleTestCases      `json:"test_cases" db:"test_cases"`
+	ContextRequired  bool               `json:"context_required" db:"context_required"`
+	Enabled          bool               `json:"enabled" db:"enabled"`
+	Priority         int                `json:"priority" db:"priority"`             // Higher priority runs first
+	Version          int                `json:"version" db:"version"`               // Incremented on every update
+	Condition        string             `json:"condition,omitempty" db:"condition"` // Expression that must also hold, see CompileExpression
+	Pack             string             `json:"pack,omitempty" db:"pack_name"`
+	CreatedBy        string             `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at" db:"updated_at"`
 }
 
+// RuleTestCases are sample inputs a rule must (Match) or must not (NoMatch) classify
+type RuleTestCases struct {
+	Match   []string `json:"match,omitempty" yaml:"match,omitempty"`
+	NoMatch []string `json:"no_match,omitempty" yaml:"no_match,omitempty"`
+}
+
+// ErrFixturesFailed is returned when a rule does not classify its own test cases correctly
+var ErrFixturesFailed = errors.New("rule test cases failed")
+
 type CompiledRule struct {
-	Rule            *CustomRule
-	Patterns        []*regexp.Regexp
-	ContextPatterns []*regexp.Regexp
+	Rule             *CustomRule
+	Patterns         []*regexp.Regexp
+	ContextPatterns  []*regexp.Regexp
+	NegativePatterns []*regexp.Regexp
+	Validators       []classifier.Validator
+	Condition        *Expression
 }
 
 type Store interface {
@@ -41,10 +62,15 @@ type Store interface {
 	DeleteRule(ctx context.Context, id string) error
 	GetRulePatterns(ctx context.Context, ruleID string) ([]string, []string, error)
 	SetRulePatterns(ctx context.Context, ruleID string, patterns, contextPatterns []string) error
+	GetPack(ctx context.Context, name string) (*PackInfo, error) // Returns nil if the pack is not installed
+	SavePack(ctx context.Context, pack *PackInfo) error
+	// InTx runs fn against a store whose writes commit together when fn succeeds
+	InTx(ctx context.Context, fn func(Store) error) error
 }
 
 type Engine struct {
 	store         Store
+	mu            sync.RWMutex
 	compiledRules []*CompiledRule
 }
 
@@ -61,7 +87,7 @@ func (e *Engine) LoadRules(ctx context.Context) error {
 		return fmt.Errorf("failed to load rules: %w", err)
 	}
 
-	e.compiledRules = make([]*CompiledRule, 0, len(rules))
+	compiledRules := make([]*CompiledRule, 0, len(rules))
 
 	for _, rule := range rules {
 		patterns, contextPatterns, err := e.store.GetRulePatterns(ctx, rule.ID)
@@ -75,9 +101,13 @@ func (e *Engine) LoadRules(ctx context.Context) error {
 		if err != nil {
 			return fmt.Errorf("failed to compile rule %s: %w", rule.ID, err)
 		}
-		e.compiledRules = append(e.compiledRules, compiled)
+		compiledRules = append(compiledRules, compiled)
 	}
 
+	e.mu.Lock()
+	e.compiledRules = compiledRules
+	e.mu.Unlock()
+
 	return nil
 }
 
@@ -104,9 +134,37 @@ func (e *Engine) compileRule(rule *CustomRule) (*CompiledRule, error) {
 		compiled.ContextPatterns = append(compiled.ContextPatterns, re)
 	}
 
+	// Negative patterns are checked case-insensitively, as in the classifier
+	for _, p := range rule.NegativePatterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid negative pattern %q: %w", p, err)
+		}
+		compiled.NegativePatterns = append(compiled.NegativePatterns, re)
+	}
+
+	for _, name := range rule.Validators {
+		v, ok := classifier.ValidatorByName(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown validator %q (available: %s)", name, strings.Join(classifier.ValidatorNames(), ", "))
+		}
+		compiled.Validators = append(compiled.Validators, v)
+	}
+
+	if strings.TrimSpace(rule.Condition) != "" {
+		cond, err := CompileExpression(rule.Condition, compiled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition: %w", err)
+		}
+		compiled.Condition = cond
+	}
+
 	return compiled, nil
 }
 
+// negativeWindow is how many characters around a match are checked for negative patterns
+const negativeWindow = 100
+
 type Match struct {
 	RuleID      string
 	RuleName    string
@@ -120,8 +178,11 @@ type Match struct {
 func (e *Engine) Classify(content string) []*Match {
 	var matches []*Match
 
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	for _, compiled := range e.compiledRules {
-		match := e.matchRule(compiled, content)
+		match := e.matchRule(compiled, content, nil)
 		if match != nil {
 			matches = append(matches, match)
 		}
@@ -130,13 +191,15 @@ func (e *Engine) Classify(content string) []*Match {
 	return matches
 }
 
-func (e *Engine) matchRule(compiled *CompiledRule, content string) *Match {
+func (e *Engine) matchRule(compiled *CompiledRule, content string, meta *classifier.ObjectMetadata) *Match {
 	var foundMatches []string
 	var contextMatches []string
 
 	for _, re := range compiled.Patterns {
-		if matches := re.FindAllString(content, -1); len(matches) > 0 {
-			foundMatches = append(foundMatches, matches...)
+		for _, idx := range re.FindAllStringIndex(content, -1) {
+			if compiled.accepts(content, idx[0], idx[1]) {
+				foundMatches = append(foundMatches, content[idx[0]:idx[1]])
+			}
 		}
 	}
 
@@ -157,6 +220,10 @@ func (e *Engine) matchRule(compiled *CompiledRule, content string) *Match {
 		}
 	}
 
+	if compiled.Condition != nil && !compiled.Condition.Evaluate(content, meta) {
+		return nil
+	}
+
 	confidence := e.calculateConfidence(len(foundMatches), len(contextMatches), compiled.Rule.ContextRequired)
 
 	return &Match{
@@ -170,6 +237,157 @@ func (e *Engine) matchRule(compiled *CompiledRule, content string) *Match {
 	}
 }
 
+// accepts reports whether the match at content[start:end] passes the rule's
+// validators and is not excluded by a nearby negative pattern
+func (c *CompiledRule) accepts(content string, start, end int) bool {
+	value := content[start:end]
+	for _, v := range c.Validators {
+		if !v(value) {
+			return false
+		}
+	}
+	if len(c.NegativePatterns) == 0 {
+		return true
+	}
+
+	windowStart := max(start-negativeWindow, 0)
+	windowEnd := min(end+negativeWindow, len(content))
+	window := content[windowStart:windowEnd]
+	for _, re := range c.NegativePatterns {
+		if re.MatchString(window) {
+			return false
+		}
+	}
+	return true
+}
+
+// ClassifierRules converts the loaded custom rules into classifier rules so they
+// run alongside the built-in rules during scans. Rules are returned in priority order.
+func (e *Engine) ClassifierRules() ([]*classifier.Rule, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	result := make([]*classifier.Rule, 0, len(e.compiledRules))
+	for _, compiled := range e.compiledRules {
+		rule, err := toClassifierRule(compiled)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert rule %s: %w", compiled.Rule.ID, err)
+		}
+		result = append(result, rule)
+	}
+	return result, nil
+}
+
+// NewClassifier builds a classifier from the built-in rules plus every loaded custom rule.
+func (e *Engine) NewClassifier() (*classifier.Classifier, error) {
+	custom, err := e.ClassifierRules()
+	if err != nil {
+		return nil, err
+	}
+	return classifier.NewWithRules(append(classifier.DefaultRules(), custom...)), nil
+}
+
+func toClassifierRule(compiled *CompiledRule) (*classifier.Rule, error) {
+	rule := &classifier.Rule{
+		Name:             compiled.Rule.Name,
+		Category:         compiled.Rule.Category,
+		Sensitivity:      compiled.Rule.Sensitivity,
+		Patterns:         compiled.Patterns,
+		NegativePatterns: compiled.NegativePatterns,
+		Validators:       compiled.Validators,
+		ContextRequired:  compiled.Rule.ContextRequired && len(compiled.ContextPatterns) > 0,
+		Version:          VersionTag(compiled.Rule),
+		Fixtures: classifier.Fixtures{
+			Positive: compiled.Rule.TestCases.Match,
+			Negative: compiled.Rule.TestCases.NoMatch,
+		},
+	}
+	if compiled.Condition != nil {
+		rule.Condition = compiled.Condition
+	}
+
+	// The classifier checks context against lowercased content, so context
+	// patterns are made case-insensitive to keep the engine's semantics.
+	for _, p := range compiled.Rule.ContextPatterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid context pattern %q: %w", p, err)
+		}
+		rule.ContextPatterns = append(rule.ContextPatterns, re)
+	}
+
+	return rule, nil
+}
+
+// validateRule compiles a rule and runs it against its own test cases the way a
+// scan would, so an edit that breaks a rule's fixtures is rejected before it is saved.
+func (e *Engine) validateRule(rule *CustomRule) error {
+	compiled, err := e.compileRule(rule)
+	if err != nil {
+		return err
+	}
+	converted, err := toClassifierRule(compiled)
+	if err != nil {
+		return err
+	}
+	if err := classifier.CheckFixtures(converted); err != nil {
+		return fmt.Errorf("%w: %v", ErrFixturesFailed, err)
+	}
+	return nil
+}
+
+// EvaluateFixtures runs the built-in rules and every loaded custom rule against
+// all rule fixtures and reports precision and recall per rule.
+func (e *Engine) EvaluateFixtures() (*classifier.FixtureReport, error) {
+	custom, err := e.ClassifierRules()
+	if err != nil {
+		return nil, err
+	}
+	return classifier.EvaluateFixtures(append(classifier.DefaultRules(), custom...)), nil
+}
+
+// VersionTag identifies the revision of a custom rule recorded on classifications.
+func VersionTag(rule *CustomRule) string {
+	return fmt.Sprintf("custom:%s@v%d", rule.ID, rule.Version)
+}
+
+// Widens reports whether after may match content before did not, in which case
+// objects never classified by the rule have to be rescanned as well. Edits that
+// only narrow a rule can be rescanned from the objects it classified before.
+func Widens(before, after *CustomRule) bool {
+	if !after.Enabled {
+		return false
+	}
+	if !before.Enabled {
+		return true
+	}
+	if !isSubset(after.Patterns, before.Patterns) {
+		return true
+	}
+	if before.ContextRequired && (!after.ContextRequired || !isSubset(after.ContextPatterns, before.ContextPatterns)) {
+		return true
+	}
+	// Negative patterns and validators exclude matches, so dropping one widens the rule
+	if !isSubset(before.NegativePatterns, after.NegativePatterns) || !isSubset(before.Validators, after.Validators) {
+		return true
+	}
+	return before.Condition != "" && after.Condition != before.Condition
+}
+
+// isSubset reports whether every value in a is also in b
+func isSubset(a, b []string) bool {
+	set := make(map[string]bool, len(b))
+	for _, v := range b {
+		set[v] = true
+	}
+	for _, v := range a {
+		if !set[v] {
+			return false
+		}
+	}
+	return true
+}
+
 func (e *Engine) calculateConfidence(matchCount, contextCount int, contextRequired bool) float64 {
 	base := 0.5
 	if matchCount > 1 {
@@ -185,15 +403,8 @@ func (e *Engine) calculateConfidence(matchCount, contextCount int, contextRequir
 }
 
 func (e *Engine) CreateRule(ctx context.Context, rule *CustomRule) error {
-	for _, p := range rule.Patterns {
-		if _, err := regexp.Compile(p); err != nil {
-			return fmt.Errorf("invalid pattern %q: %w", p, err)
-		}
-	}
-	for _, p := range rule.ContextPatterns {
-		if _, err := regexp.Compile(p); err != nil {
-			return fmt.Errorf("invalid context pattern %q: %w", p, err)
-		}
+	if err := e.validateRule(rule); err != nil {
+		return err
 	}
 
 	if err := e.store.CreateRule(ctx, rule); err != nil {
@@ -212,15 +423,8 @@ func (e *Engine) CreateRule(ctx context.Context, rule *CustomRule) error {
 }
 
 func (e *Engine) UpdateRule(ctx context.Context, rule *CustomRule) error {
-	for _, p := range rule.Patterns {
-		if _, err := regexp.Compile(p); err != nil {
-			return fmt.Errorf("invalid pattern %q: %w", p, err)
-		}
-	}
-	for _, p := range rule.ContextPatterns {
-		if _, err := regexp.Compile(p); err != nil {
-			return fmt.Errorf("invalid context pattern %q: %w", p, err)
-		}
+	if err := e.validateRule(rule); err != nil {
+		return err
 	}
 
 	if err := e.store.UpdateRule(ctx, rule); err != nil {
@@ -265,12 +469,14 @@ func (e *Engine) DisableRule(ctx context.Context, id string) error {
 	return e.LoadRules(ctx)
 }
 
-func (e *Engine) TestRule(ctx context.Context, rule *CustomRule, content string) (*Match, error) {
+// TestRule runs an unsaved rule against sample content. meta describes the object
+// the content came from for conditions on path, size or tags; it may be nil.
+func (e *Engine) TestRule(ctx context.Context, rule *CustomRule, content string, meta *classifier.ObjectMetadata) (*Match, error) {
 	compiled, err := e.compileRule(rule)
 	if err != nil {
 		return nil, err
 	}
-	return e.matchRule(compiled, content), nil
+	return e.matchRule(compiled, content, meta), nil
 }
 
 func (e *Engine) GetRules(ctx context.Context) ([]*CustomRule, error) {
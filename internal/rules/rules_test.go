@@ -0,0 +1,325 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/qualys/dspm/internal/classifier"
+	"github.com/qualys/dspm/internal/models"
+)
+
+// memStore is an in-memory Store for tests
+type memStore struct {
+	rules    map[string]*CustomRule
+	patterns map[string][2][]string
+	packs    map[string]*PackInfo
+	nextID   int
+	// savePackErr, when set, fails SavePack
+	savePackErr error
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		rules:    make(map[string]*CustomRule),
+		patterns: make(map[string][2][]string),
+		packs:    make(map[string]*PackInfo),
+	}
+}
+
+func (m *memStore) GetRule(ctx context.Context, id string) (*CustomRule, error) {
+	rule, ok := m.rules[id]
+	if !ok {
+		return nil, fmt.Errorf("rule not found: %s", id)
+	}
+	copied := *rule
+	return &copied, nil
+}
+
+func (m *memStore) ListRules(ctx context.Context, enabledOnly bool) ([]*CustomRule, error) {
+	var result []*CustomRule
+	for _, rule := range m.rules {
+		if enabledOnly && !rule.Enabled {
+			continue
+		}
+		copied := *rule
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Priority > result[j].Priority })
+	return result, nil
+}
+
+func (m *memStore) CreateRule(ctx context.Context, rule *CustomRule) error {
+	m.nextID++
+	rule.ID = fmt.Sprintf("rule-%d", m.nextID)
+	rule.Version = 1
+	copied := *rule
+	m.rules[rule.ID] = &copied
+	return nil
+}
+
+func (m *memStore) UpdateRule(ctx context.Context, rule *CustomRule) error {
+	existing, ok := m.rules[rule.ID]
+	if !ok {
+		return fmt.Errorf("rule not found: %s", rule.ID)
+	}
+	rule.Version = existing.Version + 1
+	copied := *rule
+	m.rules[rule.ID] = &copied
+	return nil
+}
+
+func (m *memStore) DeleteRule(ctx context.Context, id string) error {
+	delete(m.rules, id)
+	delete(m.patterns, id)
+	return nil
+}
+
+func (m *memStore) GetRulePatterns(ctx context.Context, ruleID string) ([]string, []string, error) {
+	p := m.patterns[ruleID]
+	return p[0], p[1], nil
+}
+
+func (m *memStore) SetRulePatterns(ctx context.Context, ruleID string, patterns, contextPatterns []string) error {
+	m.patterns[ruleID] = [2][]string{patterns, contextPatterns}
+	return nil
+}
+
+func (m *memStore) GetPack(ctx context.Context, name string) (*PackInfo, error) {
+	return m.packs[name], nil
+}
+
+func (m *memStore) SavePack(ctx context.Context, pack *PackInfo) error {
+	if m.savePackErr != nil {
+		return m.savePackErr
+	}
+	copied := *pack
+	m.packs[pack.Name] = &copied
+	return nil
+}
+
+// InTx restores the store's contents when fn fails
+func (m *memStore) InTx(ctx context.Context, fn func(Store) error) error {
+	rules := make(map[string]*CustomRule, len(m.rules))
+	for id, rule := range m.rules {
+		copied := *rule
+		rules[id] = &copied
+	}
+	patterns := make(map[string][2][]string, len(m.patterns))
+	for id, p := range m.patterns {
+		patterns[id] = p
+	}
+	packs := make(map[string]*PackInfo, len(m.packs))
+	for name, pack := range m.packs {
+		packs[name] = pack
+	}
+
+	if err := fn(m); err != nil {
+		m.rules, m.patterns, m.packs = rules, patterns, packs
+		return err
+	}
+	return nil
+}
+
+func findMatch(result *classifier.Result, ruleName string) *classifier.Match {
+	for i := range result.Matches {
+		if result.Matches[i].RuleName == ruleName {
+			return &result.Matches[i]
+		}
+	}
+	return nil
+}
+
+func TestEngine_NewClassifierIncludesCustomRules(t *testing.T) {
+	ctx := context.Background()
+	engine := NewEngine(newMemStore())
+
+	rule := &CustomRule{
+		Name:            "Employee ID",
+		Category:        models.CategoryPII,
+		Sensitivity:     models.SensitivityHigh,
+		Patterns:        []string{`\bEMP-\d{6}\b`},
+		ContextPatterns: []string{`employee`},
+		ContextRequired: true,
+		Enabled:         true,
+	}
+	if err := engine.CreateRule(ctx, rule); err != nil {
+		t.Fatalf("CreateRule: %v", err)
+	}
+
+	c, err := engine.NewClassifier()
+	if err != nil {
+		t.Fatalf("NewClassifier: %v", err)
+	}
+
+	result := c.Classify("Employee record: EMP-123456, SSN 123-45-6789")
+	match := findMatch(result, "Employee ID")
+	if match == nil {
+		t.Fatal("expected custom rule to match")
+	}
+	if match.RuleVersion != "custom:rule-1@v1" {
+		t.Errorf("expected rule version custom:rule-1@v1, got %q", match.RuleVersion)
+	}
+
+	builtin := findMatch(result, "SSN")
+	if builtin == nil {
+		t.Fatal("expected built-in SSN rule to still match")
+	}
+	if builtin.RuleVersion != classifier.BuiltinRulesVersion {
+		t.Errorf("expected built-in rule version %q, got %q", classifier.BuiltinRulesVersion, builtin.RuleVersion)
+	}
+
+	// Context is required, so the identifier alone is not a match
+	if findMatch(c.Classify("ticket EMP-123456"), "Employee ID") != nil {
+		t.Error("expected no match without context")
+	}
+}
+
+func TestEngine_UpdateRuleBumpsVersion(t *testing.T) {
+	ctx := context.Background()
+	engine := NewEngine(newMemStore())
+
+	rule := &CustomRule{
+		Name:        "Project Code",
+		Category:    models.CategoryCustom,
+		Sensitivity: models.SensitivityMedium,
+		Patterns:    []string{`\bPRJ-[A-Z]{4}\b`},
+		Enabled:     true,
+	}
+	if err := engine.CreateRule(ctx, rule); err != nil {
+		t.Fatalf("CreateRule: %v", err)
+	}
+
+	rule.Patterns = []string{`\bPROJ-[A-Z]{4}\b`}
+	if err := engine.UpdateRule(ctx, rule); err != nil {
+		t.Fatalf("UpdateRule: %v", err)
+	}
+
+	c, err := engine.NewClassifier()
+	if err != nil {
+		t.Fatalf("NewClassifier: %v", err)
+	}
+
+	if findMatch(c.Classify("code PRJ-ABCD"), "Project Code") != nil {
+		t.Error("expected old pattern to no longer match")
+	}
+	match := findMatch(c.Classify("code PROJ-ABCD"), "Project Code")
+	if match == nil {
+		t.Fatal("expected updated pattern to match")
+	}
+	if match.RuleVersion != "custom:rule-1@v2" {
+		t.Errorf("expected rule version custom:rule-1@v2, got %q", match.RuleVersion)
+	}
+}
+
+func TestEngine_DisabledRulesNotInClassifier(t *testing.T) {
+	ctx := context.Background()
+	engine := NewEngine(newMemStore())
+
+	rule := &CustomRule{
+		Name:        "Disabled",
+		Category:    models.CategoryPII,
+		Sensitivity: models.SensitivityLow,
+		Patterns:    []string{`\bDIS-\d{4}\b`},
+		Enabled:     false,
+	}
+	if err := engine.CreateRule(ctx, rule); err != nil {
+		t.Fatalf("CreateRule: %v", err)
+	}
+	if err := engine.LoadRules(ctx); err != nil {
+		t.Fatalf("LoadRules: %v", err)
+	}
+
+	custom, err := engine.ClassifierRules()
+	if err != nil {
+		t.Fatalf("ClassifierRules: %v", err)
+	}
+	if len(custom) != 0 {
+		t.Errorf("expected no classifier rules for disabled rule, got %d", len(custom))
+	}
+}
+
+func TestEngine_UpdateRuleBlockedByFailingTestCases(t *testing.T) {
+	ctx := context.Background()
+	store := newMemStore()
+	engine := NewEngine(store)
+
+	rule := &CustomRule{
+		Name:        "Ticket ID",
+		Category:    models.CategoryCustom,
+		Sensitivity: models.SensitivityLow,
+		Patterns:    []string{`\bTKT-\d{5}\b`},
+		TestCases: RuleTestCases{
+			Match:   []string{"see TKT-12345"},
+			NoMatch: []string{"see TKT-123"},
+		},
+		Enabled: true,
+	}
+	if err := engine.CreateRule(ctx, rule); err != nil {
+		t.Fatalf("CreateRule: %v", err)
+	}
+
+	// A broadened pattern now matches the negative example
+	edited := *rule
+	edited.Patterns = []string{`\bTKT-\d+\b`}
+	err := engine.UpdateRule(ctx, &edited)
+	if !errors.Is(err, ErrFixturesFailed) {
+		t.Fatalf("expected ErrFixturesFailed, got %v", err)
+	}
+	if got := store.patterns[rule.ID][0][0]; got != `\bTKT-\d{5}\b` {
+		t.Errorf("expected stored pattern to be unchanged, got %q", got)
+	}
+
+	report, err := engine.EvaluateFixtures()
+	if err != nil {
+		t.Fatalf("EvaluateFixtures: %v", err)
+	}
+	if !report.Passed {
+		t.Errorf("expected stored rules to pass their fixtures: %+v", report)
+	}
+}
+
+func TestWidens(t *testing.T) {
+	before := CustomRule{
+		Patterns:         []string{`\bEMP-\d{6}\b`},
+		NegativePatterns: []string{`(?i)example`},
+		Validators:       []string{"luhn"},
+		Condition:        `object.size < 1000`,
+		Enabled:          true,
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(r *CustomRule)
+		wants bool
+	}{
+		{"unchanged", func(r *CustomRule) {}, false},
+		{"pattern changed", func(r *CustomRule) { r.Patterns = []string{`\bEMP-\d{6,7}\b`} }, true},
+		{"pattern added", func(r *CustomRule) { r.Patterns = append(r.Patterns, `\bE\d{6}\b`) }, true},
+		{"negative pattern added", func(r *CustomRule) { r.NegativePatterns = append(r.NegativePatterns, `test`) }, false},
+		{"negative pattern removed", func(r *CustomRule) { r.NegativePatterns = nil }, true},
+		{"validator removed", func(r *CustomRule) { r.Validators = nil }, true},
+		{"condition changed", func(r *CustomRule) { r.Condition = `object.size < 2000` }, true},
+		{"context now required", func(r *CustomRule) { r.ContextRequired = true }, false},
+		{"disabled", func(r *CustomRule) { r.Enabled = false; r.Patterns = []string{`.`} }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := before
+			after.Patterns = append([]string(nil), before.Patterns...)
+			after.NegativePatterns = append([]string(nil), before.NegativePatterns...)
+			tt.edit(&after)
+			if got := Widens(&before, &after); got != tt.wants {
+				t.Errorf("expected Widens %v, got %v", tt.wants, got)
+			}
+		})
+	}
+
+	disabled := before
+	disabled.Enabled = false
+	if !Widens(&disabled, &before) {
+		t.Errorf("expected enabling a rule to widen it")
+	}
+}
@@ -3,56 +3,117 @@ package rules
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/qualys/dspm/internal/models"
 )
 
+// queryer is the part of *sqlx.DB and *sqlx.Tx the store runs statements on
+type queryer interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+}
+
 type PostgresStore struct {
 	db *sqlx.DB
+	// q is db, or tx within InTx
+	q  queryer
+	tx *sqlx.Tx
 }
 
 func NewPostgresStore(db *sqlx.DB) *PostgresStore {
-	return &PostgresStore{db: db}
+	return &PostgresStore{db: db, q: db}
+}
+
+// InTx runs fn against a store whose writes commit together when fn succeeds
+func (s *PostgresStore) InTx(ctx context.Context, fn func(Store) error) error {
+	return s.withTx(ctx, func(tx *sqlx.Tx) error {
+		return fn(&PostgresStore{db: s.db, q: tx, tx: tx})
+	})
+}
+
+// withTx runs fn in the store's transaction, or in a new one outside InTx
+func (s *PostgresStore) withTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 type ruleRow struct {
-	ID              string    `db:"id"`
-	Name            string    `db:"name"`
-	Description     string    `db:"description"`
-	Category        string    `db:"category"`
-	Sensitivity     string    `db:"sensitivity"`
-	ContextRequired bool      `db:"context_required"`
-	Enabled         bool      `db:"enabled"`
-	Priority        int       `db:"priority"`
-	CreatedBy       string    `db:"created_by"`
-	CreatedAt       time.Time `db:"created_at"`
-	UpdatedAt       time.Time `db:"updated_at"`
+	ID               string         `db:"id"`
+	Name             string         `db:"name"`
+	Description      string         `db:"description"`
+	Category         string         `db:"category"`
+	Sensitivity      string         `db:"sensitivity"`
+	NegativePatterns pq.StringArray `db:"negative_patterns"`
+	Validators       pq.StringArray `db:"validators"`
+	TestCases        []byte         `db:"test_cases"`
+	ContextRequired  bool           `db:"context_required"`
+	Enabled          bool           `db:"enabled"`
+	Priority         int            `db:"priority"`
+	Version          int            `db:"version"`
+	Pack             string         `db:"pack_name"`
+	Condition        string         `db:"condition"`
+	CreatedBy        string         `db:"created_by"`
+	CreatedAt        time.Time      `db:"created_at"`
+	UpdatedAt        time.Time      `db:"updated_at"`
 }
 
 func (r *ruleRow) toRule() *CustomRule {
-	return &CustomRule{
-		ID:              r.ID,
-		Name:            r.Name,
-		Description:     r.Description,
-		Category:        models.Category(r.Category),
-		Sensitivity:     models.Sensitivity(r.Sensitivity),
-		ContextRequired: r.ContextRequired,
-		Enabled:         r.Enabled,
-		Priority:        r.Priority,
-		CreatedBy:       r.CreatedBy,
-		CreatedAt:       r.CreatedAt,
-		UpdatedAt:       r.UpdatedAt,
+	rule := &CustomRule{
+		ID:               r.ID,
+		Name:             r.Name,
+		Description:      r.Description,
+		Category:         models.Category(r.Category),
+		Sensitivity:      models.Sensitivity(r.Sensitivity),
+		NegativePatterns: []string(r.NegativePatterns),
+		Validators:       []string(r.Validators),
+		ContextRequired:  r.ContextRequired,
+		Enabled:          r.Enabled,
+		Priority:         r.Priority,
+		Version:          r.Version,
+		Pack:             r.Pack,
+		Condition:        r.Condition,
+		CreatedBy:        r.CreatedBy,
+		CreatedAt:        r.CreatedAt,
+		UpdatedAt:        r.UpdatedAt,
 	}
+	if len(r.TestCases) > 0 {
+		_ = json.Unmarshal(r.TestCases, &rule.TestCases)
+	}
+	return rule
+}
+
+// nonNil keeps NOT NULL array columns from receiving NULL
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
 }
 
 func (s *PostgresStore) GetRule(ctx context.Context, id string) (*CustomRule, error) {
 	var row ruleRow
-	err := s.db.GetContext(ctx, &row, `
-		SELECT id, name, description, category, sensitivity, context_required, enabled, priority, created_by, created_at, updated_at
+	err := s.q.GetContext(ctx, &row, `
+		SELECT id, name, description, category, sensitivity, negative_patterns, validators, test_cases, context_required, enabled, priority, version, pack_name, condition, created_by, created_at, updated_at
 		FROM custom_rules WHERE id = $1
 	`, id)
 	if err != nil {
@@ -69,13 +130,13 @@ func (s *PostgresStore) ListRules(ctx context.Context, enabledOnly bool) ([]*Cus
 	var err error
 
 	if enabledOnly {
-		err = s.db.SelectContext(ctx, &rows, `
-			SELECT id, name, description, category, sensitivity, context_required, enabled, priority, created_by, created_at, updated_at
+		err = s.q.SelectContext(ctx, &rows, `
+			SELECT id, name, description, category, sensitivity, negative_patterns, validators, test_cases, context_required, enabled, priority, version, pack_name, condition, created_by, created_at, updated_at
 			FROM custom_rules WHERE enabled = true ORDER BY priority DESC, created_at DESC
 		`)
 	} else {
-		err = s.db.SelectContext(ctx, &rows, `
-			SELECT id, name, description, category, sensitivity, context_required, enabled, priority, created_by, created_at, updated_at
+		err = s.q.SelectContext(ctx, &rows, `
+			SELECT id, name, description, category, sensitivity, negative_patterns, validators, test_cases, context_required, enabled, priority, version, pack_name, condition, created_by, created_at, updated_at
 			FROM custom_rules ORDER BY priority DESC, created_at DESC
 		`)
 	}
@@ -98,49 +159,55 @@ func (s *PostgresStore) CreateRule(ctx context.Context, rule *CustomRule) error
 	now := time.Now()
 	rule.CreatedAt = now
 	rule.UpdatedAt = now
+	rule.Version = 1
+
+	testCases, err := json.Marshal(rule.TestCases)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO custom_rules (id, name, description, category, sensitivity, context_required, enabled, priority, created_by, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	_, err = s.q.ExecContext(ctx, `
+		INSERT INTO custom_rules (id, name, description, category, sensitivity, negative_patterns, validators, test_cases, context_required, enabled, priority, version, pack_name, condition, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 	`, rule.ID, rule.Name, rule.Description, string(rule.Category), string(rule.Sensitivity),
-		rule.ContextRequired, rule.Enabled, rule.Priority, rule.CreatedBy, rule.CreatedAt, rule.UpdatedAt)
+		pq.Array(nonNil(rule.NegativePatterns)), pq.Array(nonNil(rule.Validators)), testCases,
+		rule.ContextRequired, rule.Enabled, rule.Priority, rule.Version, rule.Pack, rule.Condition, rule.CreatedBy, rule.CreatedAt, rule.UpdatedAt)
 	return err
 }
 
 func (s *PostgresStore) UpdateRule(ctx context.Context, rule *CustomRule) error {
 	rule.UpdatedAt = time.Now()
-	_, err := s.db.ExecContext(ctx, `
+	testCases, err := json.Marshal(rule.TestCases)
+	if err != nil {
+		return err
+	}
+	return s.q.QueryRowContext(ctx, `
 		UPDATE custom_rules SET
 			name = $2, description = $3, category = $4, sensitivity = $5,
-			context_required = $6, enabled = $7, priority = $8, updated_at = $9
+			context_required = $6, enabled = $7, priority = $8, updated_at = $9,
+			negative_patterns = $10, validators = $11, test_cases = $12, pack_name = $13,
+			condition = $14, version = version + 1
 		WHERE id = $1
+		RETURNING version
 	`, rule.ID, rule.Name, rule.Description, string(rule.Category), string(rule.Sensitivity),
-		rule.ContextRequired, rule.Enabled, rule.Priority, rule.UpdatedAt)
-	return err
+		rule.ContextRequired, rule.Enabled, rule.Priority, rule.UpdatedAt,
+		pq.Array(nonNil(rule.NegativePatterns)), pq.Array(nonNil(rule.Validators)), testCases, rule.Pack, rule.Condition).Scan(&rule.Version)
 }
 
 func (s *PostgresStore) DeleteRule(ctx context.Context, id string) error {
-	tx, err := s.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = tx.Rollback() }()
-
-	if _, err := tx.ExecContext(ctx, `DELETE FROM rule_patterns WHERE rule_id = $1`, id); err != nil {
-		return err
-	}
-
-	if _, err := tx.ExecContext(ctx, `DELETE FROM custom_rules WHERE id = $1`, id); err != nil {
+	return s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM rule_patterns WHERE rule_id = $1`, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM custom_rules WHERE id = $1`, id)
 		return err
-	}
-
-	return tx.Commit()
+	})
 }
 
 func (s *PostgresStore) GetRulePatterns(ctx context.Context, ruleID string) ([]string, []string, error) {
 	var patterns, contextPatterns []string
 
-	rows, err := s.db.QueryxContext(ctx, `
+	rows, err := s.q.QueryxContext(ctx, `
 		SELECT pattern, is_context FROM rule_patterns WHERE rule_id = $1 ORDER BY id
 	`, ruleID)
 	if err != nil {
@@ -165,31 +232,56 @@ func (s *PostgresStore) GetRulePatterns(ctx context.Context, ruleID string) ([]s
 }
 
 func (s *PostgresStore) SetRulePatterns(ctx context.Context, ruleID string, patterns, contextPatterns []string) error {
-	tx, err := s.db.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = tx.Rollback() }()
+	return s.withTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM rule_patterns WHERE rule_id = $1`, ruleID); err != nil {
+			return err
+		}
 
-	if _, err := tx.ExecContext(ctx, `DELETE FROM rule_patterns WHERE rule_id = $1`, ruleID); err != nil {
-		return err
-	}
+		for _, p := range patterns {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO rule_patterns (id, rule_id, pattern, is_context) VALUES ($1, $2, $3, false)
+			`, uuid.New().String(), ruleID, p); err != nil {
+				return err
+			}
+		}
 
-	for _, p := range patterns {
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO rule_patterns (id, rule_id, pattern, is_context) VALUES ($1, $2, $3, false)
-		`, uuid.New().String(), ruleID, p); err != nil {
-			return err
+		for _, p := range contextPatterns {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO rule_patterns (id, rule_id, pattern, is_context) VALUES ($1, $2, $3, true)
+			`, uuid.New().String(), ruleID, p); err != nil {
+				return err
+			}
 		}
-	}
+		return nil
+	})
+}
 
-	for _, p := range contextPatterns {
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO rule_patterns (id, rule_id, pattern, is_context) VALUES ($1, $2, $3, true)
-		`, uuid.New().String(), ruleID, p); err != nil {
-			return err
+func (s *PostgresStore) GetPack(ctx context.Context, name string) (*PackInfo, error) {
+	var pack PackInfo
+	err := s.q.GetContext(ctx, &pack, `
+		SELECT name, version, description, checksum, imported_by, imported_at
+		FROM rule_packs WHERE name = $1
+	`, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
 		}
+		return nil, err
 	}
+	return &pack, nil
+}
 
-	return tx.Commit()
+func (s *PostgresStore) SavePack(ctx context.Context, pack *PackInfo) error {
+	pack.ImportedAt = time.Now()
+	_, err := s.q.ExecContext(ctx, `
+		INSERT INTO rule_packs (name, version, description, checksum, imported_by, imported_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE SET
+			version = EXCLUDED.version,
+			description = EXCLUDED.description,
+			checksum = EXCLUDED.checksum,
+			imported_by = EXCLUDED.imported_by,
+			imported_at = EXCLUDED.imported_at
+	`, pack.Name, pack.Version, pack.Description, pack.Checksum, pack.ImportedBy, pack.ImportedAt)
+	return err
 }
@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/google/uuid"
+
+	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/metadata"
+)
+
+// metadataReadBlock is the minimum size of a ranged read past the sampled
+// head of an object, so that nearby metadata reads share one request
+const metadataReadBlock = 64 * 1024
+
+// objectReaderAt reads an object through ranged GetObject calls, serving
+// reads inside the already sampled head and the last fetched block from
+// memory. Metadata parsers only touch a few blocks of an object, so large
+// images and documents are inspected without downloading them.
+type objectReaderAt struct {
+	ctx    context.Context
+	conn   connectors.StorageConnector
+	bucket string
+	key    string
+	size   int64
+
+	head       []byte
+	block      []byte
+	blockStart int64
+	fetched    int64 // bytes read past the head
+}
+
+func (o *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	want := int64(len(p))
+	if off+want > o.size {
+		want = o.size - off
+	}
+
+	if off+want <= int64(len(o.head)) {
+		return fillRead(p, o.head[off:off+want], want)
+	}
+	if o.block != nil && off >= o.blockStart && off+want <= o.blockStart+int64(len(o.block)) {
+		start := off - o.blockStart
+		return fillRead(p, o.block[start:start+want], want)
+	}
+
+	end := min(o.size, off+max(want, metadataReadBlock))
+	reader, err := o.conn.GetObject(o.ctx, o.bucket, o.key, &connectors.ByteRange{Start: off, End: end - 1})
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	block, err := io.ReadAll(io.LimitReader(reader, end-off))
+	if err != nil {
+		return 0, err
+	}
+	o.fetched += int64(len(block))
+	o.block, o.blockStart = block, off
+	if int64(len(block)) < want {
+		n := copy(p, block)
+		return n, io.ErrUnexpectedEOF
+	}
+	return fillRead(p, block[:want], want)
+}
+
+// fillRead copies src into p, reporting io.EOF when the read was cut short
+// by the end of the object
+func fillRead(p, src []byte, want int64) (int, error) {
+	n := copy(p, src)
+	if want < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// scanObjectMetadata classifies the personal data in the metadata of an
+// image or document, given the sampled head of the object
+func (s *Scanner) scanObjectMetadata(ctx context.Context, conn connectors.StorageConnector, bucketName string, obj connectors.ObjectInfo, head []byte, assetID uuid.UUID, progress *ScanProgress) {
+	reader := &objectReaderAt{
+		ctx:    ctx,
+		conn:   conn,
+		bucket: bucketName,
+		key:    obj.Key,
+		size:   obj.Size,
+		head:   head,
+	}
+	md, err := metadata.Extract(reader, obj.Size)
+	if errors.Is(err, metadata.ErrUnsupportedFormat) {
+		log.Printf("[SCANNER] scanObjectMetadata: %s/%s is not in a supported format", bucketName, obj.Key)
+		return
+	}
+	if err != nil {
+		s.errorCh <- &ScanError{
+			AssetARN: fmt.Sprintf("%s/%s", bucketName, obj.Key),
+			Phase:    "extract_metadata",
+			Error:    err,
+		}
+		return
+	}
+
+	result := s.classifier.ClassifyMetadata(md.Fields)
+	if len(result.Matches) > 0 {
+		s.classifyCh <- &ClassificationResult{
+			AssetID:      assetID,
+			ObjectPath:   obj.Key,
+			ObjectSize:   obj.Size,
+			Matches:      result.Matches,
+			ScannedBytes: int64(len(head)) + reader.fetched,
+		}
+
+		progress.mu.Lock()
+		progress.ClassificationsFound += result.TotalFindings
+		progress.mu.Unlock()
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/qualys/dspm/internal/classifier"
 	"github.com/qualys/dspm/internal/connectors"
+	"github.com/qualys/dspm/internal/metadata"
 	"github.com/qualys/dspm/internal/models"
 )
 
@@ -60,6 +61,80 @@ type ClassificationResult struct {
 	ScannedBytes int64
 }
 
+// HasOriginals reports whether any match keeps originals that must be sealed
+// to their classification's ID
+func (r *ClassificationResult) HasOriginals() bool {
+	for i := range r.Matches {
+		if r.Matches[i].HasOriginals() {
+			return true
+		}
+	}
+	return false
+}
+
+// Classifications converts each match, in order, into a classification of
+// the asset assetID holding the match's redacted samples and locations.
+// Classifications the object already has, by rule name in existing, keep their
+// ID; new ones are given one here, and originals are sealed to that ID.
+func (r *ClassificationResult) Classifications(assetID uuid.UUID, existing map[string]uuid.UUID, redaction *classifier.RedactionPolicy) []*models.Classification {
+	classifications := make([]*models.Classification, 0, len(r.Matches))
+	for i := range r.Matches {
+		match := &r.Matches[i]
+		id, ok := existing[match.RuleName]
+		if !ok {
+			id = uuid.New()
+		}
+		redaction.SealOriginals(match, id.String())
+
+		// Build sample matches for the API/UI
+		var sampleMatches []map[string]interface{}
+		for _, sm := range match.SampleMatches {
+			sample := map[string]interface{}{
+				"line":        sm.LineNumber,
+				"column":      sm.ColumnNumber,
+				"column_name": sm.ColumnName,
+				"value":       sm.MaskedValue,
+				"context":     sm.Context,
+			}
+			if sm.SealedOriginal != "" {
+				sample["sealed_original"] = sm.SealedOriginal
+			}
+			sampleMatches = append(sampleMatches, sample)
+		}
+
+		// Build match locations (line numbers)
+		var matchLocations []map[string]interface{}
+		for i, lineNum := range match.LineNumbers {
+			loc := map[string]interface{}{
+				"line": lineNum,
+			}
+			if i < len(match.SampleMatches) {
+				loc["column"] = match.SampleMatches[i].ColumnNumber
+				if match.SampleMatches[i].ColumnName != "" {
+					loc["column_name"] = match.SampleMatches[i].ColumnName
+				}
+			}
+			matchLocations = append(matchLocations, loc)
+		}
+
+		classifications = append(classifications, &models.Classification{
+			ID:              id,
+			AssetID:         assetID,
+			ObjectPath:      r.ObjectPath,
+			ObjectSize:      r.ObjectSize,
+			RuleName:        match.RuleName,
+			RuleVersion:     match.RuleVersion,
+			Category:        match.Category,
+			Sensitivity:     match.Sensitivity,
+			FindingCount:    match.Count,
+			ConfidenceScore: match.Confidence,
+			SampleMatches:   models.JSONB{"samples": sampleMatches},
+			MatchLocations:  models.JSONB{"locations": matchLocations},
+		})
+	}
+	return classifications
+}
+
 type FindingResult struct {
 	Finding *models.Finding
 }
@@ -82,6 +157,8 @@ type ScanScope struct {
 	Regions  []string // Specific regions (empty = all)
 	Prefixes []string // Object prefixes to include
 	MaxDepth int      // Max directory depth
+	// Objects restricts content scanning to specific keys per bucket (targeted rescans)
+	Objects map[string][]string
 }
 
 type ScanProgress struct {
@@ -97,9 +174,15 @@ type ScanProgress struct {
 }
 
 func New(config Config) *Scanner {
+	return NewWithClassifier(config, classifier.New())
+}
+
+// NewWithClassifier creates a scanner that classifies object contents with c,
+// typically built from the built-in rules plus the custom rules loaded at scan start.
+func NewWithClassifier(config Config, c *classifier.Classifier) *Scanner {
 	return &Scanner{
 		config:     config,
-		classifier: classifier.New(),
+		classifier: c,
 		assetCh:    make(chan *AssetResult, 100),
 		classifyCh: make(chan *ClassificationResult, 100),
 		findingCh:  make(chan *FindingResult, 100),
@@ -238,7 +321,11 @@ func (s *Scanner) scanBucket(ctx context.Context, conn connectors.StorageConnect
 	}
 
 	if job.ScanType == models.ScanTypeFull || job.ScanType == models.ScanTypeClassification {
-		s.scanBucketContents(ctx, conn, bucket.Name, asset.ID, job, progress)
+		if job.Scope != nil && job.Scope.Objects != nil {
+			s.scanTargetedObjects(ctx, conn, bucket.Name, metadata.Tags, job.Scope.Objects[bucket.Name], asset.ID, progress)
+		} else {
+			s.scanBucketContents(ctx, conn, bucket.Name, metadata.Tags, asset.ID, job, progress)
+		}
 	}
 
 	progress.mu.Lock()
@@ -246,7 +333,7 @@ func (s *Scanner) scanBucket(ctx context.Context, conn connectors.StorageConnect
 	progress.mu.Unlock()
 }
 
-func (s *Scanner) scanBucketContents(ctx context.Context, conn connectors.StorageConnector, bucketName string, assetID uuid.UUID, job *ScanJob, progress *ScanProgress) {
+func (s *Scanner) scanBucketContents(ctx context.Context, conn connectors.StorageConnector, bucketName string, bucketTags map[string]string, assetID uuid.UUID, job *ScanJob, progress *ScanProgress) {
 	log.Printf("[SCANNER] scanBucketContents: listing objects for bucket %s", bucketName)
 	objects, err := conn.ListObjects(ctx, bucketName, "", s.config.FilesPerBucket)
 	if err != nil {
@@ -280,7 +367,7 @@ func (s *Scanner) scanBucketContents(ctx context.Context, conn connectors.Storag
 		go func() {
 			defer wg.Done()
 			for obj := range objectCh {
-				s.scanObject(ctx, conn, bucketName, obj, assetID, progress)
+				s.scanObject(ctx, conn, bucketName, bucketTags, obj, assetID, progress)
 			}
 		}()
 	}
@@ -298,7 +385,41 @@ func (s *Scanner) scanBucketContents(ctx context.Context, conn connectors.Storag
 	wg.Wait()
 }
 
-func (s *Scanner) scanObject(ctx context.Context, conn connectors.StorageConnector, bucketName string, obj connectors.ObjectInfo, assetID uuid.UUID, progress *ScanProgress) {
+// scanTargetedObjects rescans only the given keys, skipping any that no longer exist
+func (s *Scanner) scanTargetedObjects(ctx context.Context, conn connectors.StorageConnector, bucketName string, bucketTags map[string]string, keys []string, assetID uuid.UUID, progress *ScanProgress) {
+	log.Printf("[SCANNER] scanTargetedObjects: rescanning %d objects in bucket %s", len(keys), bucketName)
+
+	var objects []connectors.ObjectInfo
+	for _, key := range keys {
+		// Listing with the key as prefix returns the object itself first, with its size
+		listed, err := conn.ListObjects(ctx, bucketName, key, 1)
+		if err != nil {
+			s.errorCh <- &ScanError{
+				AssetARN: fmt.Sprintf("%s/%s", bucketName, key),
+				Phase:    "list_objects",
+				Error:    err,
+			}
+			continue
+		}
+		if len(listed) == 0 || listed[0].Key != key {
+			continue
+		}
+		objects = append(objects, listed[0])
+	}
+
+	progress.mu.Lock()
+	progress.TotalObjects += len(objects)
+	progress.mu.Unlock()
+
+	for _, obj := range objects {
+		if ctx.Err() != nil {
+			return
+		}
+		s.scanObject(ctx, conn, bucketName, bucketTags, obj, assetID, progress)
+	}
+}
+
+func (s *Scanner) scanObject(ctx context.Context, conn connectors.StorageConnector, bucketName string, bucketTags map[string]string, obj connectors.ObjectInfo, assetID uuid.UUID, progress *ScanProgress) {
 	log.Printf("[SCANNER] scanObject: scanning %s/%s (size: %d)", bucketName, obj.Key, obj.Size)
 	defer func() {
 		progress.mu.Lock()
@@ -335,7 +456,18 @@ func (s *Scanner) scanObject(ctx context.Context, conn connectors.StorageConnect
 		return
 	}
 
-	result := s.classifier.Classify(string(content))
+	// Images and documents are classified by their metadata, not their bytes
+	if metadata.Supported(obj.Key) {
+		s.scanObjectMetadata(ctx, conn, bucketName, obj, content, assetID, progress)
+		return
+	}
+
+	result := s.classifier.ClassifyObject(string(content), &classifier.ObjectMetadata{
+		Bucket:     bucketName,
+		Path:       obj.Key,
+		Size:       obj.Size,
+		BucketTags: bucketTags,
+	})
 
 	if len(result.Matches) > 0 {
 		s.classifyCh <- &ClassificationResult{
@@ -359,12 +491,14 @@ func (s *Scanner) filterScannable(objects []connectors.ObjectInfo) []connectors.
 		".tsv": true, ".xml": true, ".yaml": true, ".yml": true,
 	}
 
+	// Images and Office or PDF documents are not skipped: their metadata is
+	// scanned instead of their content (see metadata.Supported)
 	skip := map[string]bool{
-		".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+		".gif": true,
 		".mp4": true, ".mp3": true, ".wav": true, ".avi": true,
 		".zip": true, ".gz": true, ".tar": true, ".rar": true,
 		".exe": true, ".dll": true, ".so": true, ".bin": true,
-		".pdf": true, ".doc": true, ".docx": true,
+		".doc": true,
 	}
 
 	var high, medium []connectors.ObjectInfo
@@ -400,6 +534,10 @@ func (s *Scanner) filterScannable(objects []connectors.ObjectInfo) []connectors.
 	return result
 }
 
+// BucketFindingTypes are the findings raised for every bucket scanned, including
+// buckets visited by a targeted rescan
+var BucketFindingTypes = []string{"PUBLIC_BUCKET", "UNENCRYPTED_STORAGE", "VERSIONING_DISABLED", "LOGGING_DISABLED"}
+
 func (s *Scanner) generateBucketFindings(asset *models.DataAsset, metadata *connectors.BucketMetadata, accountID uuid.UUID) {
 	now := time.Now()
 
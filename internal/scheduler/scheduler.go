@@ -32,6 +32,9 @@ const (
 	JobTypeCleanupOld      JobType = "cleanup_old"
 	JobTypeGenerateReport  JobType = "generate_report"
 	JobTypeSyncAccessGraph JobType = "sync_access_graph"
+	JobTypeTrainFeedback   JobType = "train_feedback_filter"
+	JobTypeFitCalibration  JobType = "fit_calibration"
+	JobTypeEscalateReviews JobType = "escalate_reviews"
 )
 
 type JobExecution struct {
@@ -320,6 +323,9 @@ type DefaultHandlers struct {
 	CleanupFunc    func(ctx context.Context, olderThan time.Duration) error
 	ReportFunc     func(ctx context.Context, config map[string]string) error
 	SyncAccessFunc func(ctx context.Context) error
+	TrainFunc      func(ctx context.Context) error
+	CalibrateFunc  func(ctx context.Context) error
+	EscalateFunc   func(ctx context.Context) error
 }
 
 func (h *DefaultHandlers) Register(s *Scheduler) {
@@ -360,4 +366,22 @@ func (h *DefaultHandlers) Register(s *Scheduler) {
 			return h.SyncAccessFunc(ctx)
 		})
 	}
+
+	if h.TrainFunc != nil {
+		s.RegisterHandler(JobTypeTrainFeedback, func(ctx context.Context, job *Job) error {
+			return h.TrainFunc(ctx)
+		})
+	}
+
+	if h.CalibrateFunc != nil {
+		s.RegisterHandler(JobTypeFitCalibration, func(ctx context.Context, job *Job) error {
+			return h.CalibrateFunc(ctx)
+		})
+	}
+
+	if h.EscalateFunc != nil {
+		s.RegisterHandler(JobTypeEscalateReviews, func(ctx context.Context, job *Job) error {
+			return h.EscalateFunc(ctx)
+		})
+	}
 }
@@ -281,17 +281,112 @@ func (s *Store) DeleteFindingsForAsset(ctx context.Context, assetID uuid.UUID) e
 	return err
 }
 
+// DeleteClassificationsForObjects removes classifications for specific objects ahead of a targeted rescan
+func (s *Store) DeleteClassificationsForObjects(ctx context.Context, assetID uuid.UUID, objectPaths []string) error {
+	query := `DELETE FROM classifications WHERE asset_id = $1 AND object_path = ANY($2)`
+	_, err := s.db.ExecContext(ctx, query, assetID, pq.Array(objectPaths))
+	return err
+}
+
+// DeleteFindingsForObjects removes an asset's findings of findingTypes and the findings
+// raised on specific objects ahead of a targeted rescan
+func (s *Store) DeleteFindingsForObjects(ctx context.Context, assetID uuid.UUID, findingTypes, objectPaths []string) error {
+	query := `DELETE FROM findings WHERE asset_id = $1 AND (finding_type = ANY($2) OR evidence->>'object_path' = ANY($3))`
+	_, err := s.db.ExecContext(ctx, query, assetID, pq.Array(findingTypes), pq.Array(objectPaths))
+	return err
+}
+
+// RefreshAssetClassificationSummary recomputes an asset's denormalized classification
+// summary from its stored classifications
+func (s *Store) RefreshAssetClassificationSummary(ctx context.Context, assetID uuid.UUID) error {
+	query := `
+		UPDATE data_assets a SET
+			sensitivity_level = COALESCE((
+				SELECT c.sensitivity FROM classifications c WHERE c.asset_id = a.id
+				ORDER BY CASE c.sensitivity
+					WHEN 'CRITICAL' THEN 4 WHEN 'HIGH' THEN 3 WHEN 'MEDIUM' THEN 2 WHEN 'LOW' THEN 1 ELSE 0
+				END DESC
+				LIMIT 1
+			), 'UNKNOWN'),
+			data_categories = COALESCE((
+				SELECT array_agg(DISTINCT c.category) FROM classifications c WHERE c.asset_id = a.id
+			), '{}'),
+			classification_count = COALESCE((
+				SELECT SUM(c.finding_count) FROM classifications c WHERE c.asset_id = a.id
+			), 0),
+			updated_at = $1
+		WHERE a.id = $2
+	`
+	_, err := s.db.ExecContext(ctx, query, time.Now(), assetID)
+	return err
+}
+
+// CategoryRollup is the data of one category found in an asset: the highest
+// sensitivity and total findings across its classifications
+type CategoryRollup struct {
+	AssetID     uuid.UUID          `db:"asset_id"`
+	Category    models.Category    `db:"category"`
+	Sensitivity models.Sensitivity `db:"sensitivity"`
+	Count       int                `db:"count"`
+}
+
+// ListCategoryRollups rolls up the classifications of an account's assets by
+// asset and category
+func (s *Store) ListCategoryRollups(ctx context.Context, accountID uuid.UUID) ([]CategoryRollup, error) {
+	var rollups []CategoryRollup
+	query := `
+		SELECT c.asset_id, c.category,
+			(ARRAY['UNKNOWN', 'LOW', 'MEDIUM', 'HIGH', 'CRITICAL'])[MAX(CASE c.sensitivity
+				WHEN 'CRITICAL' THEN 5 WHEN 'HIGH' THEN 4 WHEN 'MEDIUM' THEN 3 WHEN 'LOW' THEN 2 ELSE 1
+			END)] AS sensitivity,
+			COALESCE(SUM(c.finding_count), 0) AS count
+		FROM classifications c
+		JOIN data_assets a ON a.id = c.asset_id
+		WHERE a.account_id = $1
+		GROUP BY c.asset_id, c.category
+		ORDER BY c.asset_id, c.category
+	`
+	err := s.db.SelectContext(ctx, &rollups, query, accountID)
+	return rollups, err
+}
+
+// RescanTarget is a previously classified object selected for a targeted rescan
+type RescanTarget struct {
+	AssetID    uuid.UUID `db:"asset_id"`
+	AccountID  uuid.UUID `db:"account_id"`
+	BucketName string    `db:"bucket_name"`
+	ObjectPath string    `db:"object_path"`
+}
+
+// ListRescanTargets returns objects that were classified by any of the given rules
+// or that hold data in any of the given categories
+func (s *Store) ListRescanTargets(ctx context.Context, ruleNames, categories []string, limit int) ([]RescanTarget, error) {
+	var targets []RescanTarget
+	query := `
+		SELECT DISTINCT c.asset_id, a.account_id, a.name AS bucket_name, c.object_path
+		FROM classifications c
+		JOIN data_assets a ON a.id = c.asset_id
+		WHERE c.rule_name = ANY($1) OR c.category = ANY($2)
+		ORDER BY a.account_id, a.name, c.object_path
+		LIMIT $3
+	`
+	err := s.db.SelectContext(ctx, &targets, query, pq.Array(ruleNames), pq.Array(categories), limit)
+	return targets, err
+}
+
 func (s *Store) CreateClassification(ctx context.Context, classification *models.Classification) error {
 	query := `
 		INSERT INTO classifications (
-			id, asset_id, object_path, object_size, rule_name, category, sensitivity,
+			id, asset_id, object_path, object_size, rule_name, rule_version, category, sensitivity,
 			finding_count, sample_matches, match_locations, confidence_score, validated, discovered_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		ON CONFLICT (asset_id, object_path, rule_name) DO UPDATE SET
+			rule_version = EXCLUDED.rule_version,
 			finding_count = EXCLUDED.finding_count,
 			sample_matches = EXCLUDED.sample_matches,
 			match_locations = EXCLUDED.match_locations,
 			confidence_score = EXCLUDED.confidence_score
+		RETURNING id
 	`
 
 	if classification.ID == uuid.Nil {
@@ -299,13 +394,14 @@ func (s *Store) CreateClassification(ctx context.Context, classification *models
 	}
 	classification.DiscoveredAt = time.Now()
 
-	_, err := s.db.ExecContext(ctx, query,
+	// On conflict the existing row keeps its ID, which is returned so that
+	// predictions and review items can reference it
+	return s.db.QueryRowContext(ctx, query,
 		classification.ID, classification.AssetID, classification.ObjectPath, classification.ObjectSize,
-		classification.RuleName, classification.Category, classification.Sensitivity,
+		classification.RuleName, classification.RuleVersion, classification.Category, classification.Sensitivity,
 		classification.FindingCount, classification.SampleMatches, classification.MatchLocations,
 		classification.ConfidenceScore, classification.Validated, classification.DiscoveredAt,
-	)
-	return err
+	).Scan(&classification.ID)
 }
 
 // BatchCreateClassifications inserts multiple classifications at once using COPY for maximum performance.
@@ -325,7 +421,7 @@ func (s *Store) BatchCreateClassifications(ctx context.Context, classifications
 	_, err = tx.ExecContext(ctx, `
 		CREATE TEMP TABLE temp_classifications (
 			id UUID, asset_id UUID, object_path TEXT, object_size BIGINT,
-			rule_name TEXT, category TEXT, sensitivity TEXT,
+			rule_name TEXT, rule_version TEXT, category TEXT, sensitivity TEXT,
 			finding_count INT, sample_matches JSONB, match_locations JSONB,
 			confidence_score FLOAT, validated BOOLEAN, discovered_at TIMESTAMP
 		) ON COMMIT DROP
@@ -337,7 +433,7 @@ func (s *Store) BatchCreateClassifications(ctx context.Context, classifications
 	// Use COPY for bulk insert into temp table
 	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("temp_classifications",
 		"id", "asset_id", "object_path", "object_size",
-		"rule_name", "category", "sensitivity",
+		"rule_name", "rule_version", "category", "sensitivity",
 		"finding_count", "sample_matches", "match_locations",
 		"confidence_score", "validated", "discovered_at",
 	))
@@ -367,7 +463,7 @@ func (s *Store) BatchCreateClassifications(ctx context.Context, classifications
 
 		_, err = stmt.ExecContext(ctx,
 			c.ID, c.AssetID, c.ObjectPath, c.ObjectSize,
-			c.RuleName, string(c.Category), string(c.Sensitivity),
+			c.RuleName, c.RuleVersion, string(c.Category), string(c.Sensitivity),
 			c.FindingCount, string(sampleMatchesJSON), string(matchLocationsJSON),
 			c.ConfidenceScore, c.Validated, c.DiscoveredAt,
 		)
@@ -381,25 +477,53 @@ func (s *Store) BatchCreateClassifications(ctx context.Context, classifications
 		return fmt.Errorf("close copy: %w", err)
 	}
 
-	// Upsert from temp table to main table
-	_, err = tx.ExecContext(ctx, `
+	// Upsert from temp table to main table. Rows that already existed keep their
+	// IDs; the returned IDs are copied back onto the inputs.
+	rows, err := tx.QueryContext(ctx, `
 		INSERT INTO classifications (
 			id, asset_id, object_path, object_size,
-			rule_name, category, sensitivity,
+			rule_name, rule_version, category, sensitivity,
 			finding_count, sample_matches, match_locations,
 			confidence_score, validated, discovered_at
 		)
 		SELECT * FROM temp_classifications
 		ON CONFLICT (asset_id, object_path, rule_name) DO UPDATE SET
+			rule_version = EXCLUDED.rule_version,
 			finding_count = EXCLUDED.finding_count,
 			sample_matches = EXCLUDED.sample_matches,
 			match_locations = EXCLUDED.match_locations,
 			confidence_score = EXCLUDED.confidence_score
+		RETURNING id, asset_id, object_path, rule_name
 	`)
 	if err != nil {
 		return fmt.Errorf("upsert from temp: %w", err)
 	}
 
+	type classificationKey struct {
+		assetID    uuid.UUID
+		objectPath string
+		ruleName   string
+	}
+	byKey := make(map[classificationKey]*models.Classification, len(classifications))
+	for _, c := range classifications {
+		byKey[classificationKey{c.AssetID, c.ObjectPath, c.RuleName}] = c
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		var key classificationKey
+		if err := rows.Scan(&id, &key.assetID, &key.objectPath, &key.ruleName); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan upserted id: %w", err)
+		}
+		if c, ok := byKey[key]; ok {
+			c.ID = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("upsert from temp: %w", err)
+	}
+	rows.Close()
+
 	return tx.Commit()
 }
 
@@ -410,6 +534,23 @@ func (s *Store) ListClassificationsByAsset(ctx context.Context, assetID uuid.UUI
 	return classifications, err
 }
 
+// ClassificationIDs returns the IDs of an object's classifications by rule name
+func (s *Store) ClassificationIDs(ctx context.Context, assetID uuid.UUID, objectPath string) (map[string]uuid.UUID, error) {
+	var rows []struct {
+		ID       uuid.UUID `db:"id"`
+		RuleName string    `db:"rule_name"`
+	}
+	query := `SELECT id, rule_name FROM classifications WHERE asset_id = $1 AND object_path = $2`
+	if err := s.db.SelectContext(ctx, &rows, query, assetID, objectPath); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]uuid.UUID, len(rows))
+	for _, row := range rows {
+		ids[row.RuleName] = row.ID
+	}
+	return ids, nil
+}
+
 // ClassificationWithAsset is a classification with asset name included
 type ClassificationWithAsset struct {
 	models.Classification
@@ -448,6 +589,37 @@ func (s *Store) GetClassification(ctx context.Context, id uuid.UUID) (*models.Cl
 	return &classification, err
 }
 
+// LogSampleAccess records a reviewer viewing a classification's original values
+func (s *Store) LogSampleAccess(ctx context.Context, entry *models.SampleAccessLog) error {
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	if entry.AccessedAt.IsZero() {
+		entry.AccessedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO sample_access_log (id, classification_id, user_id, user_email, user_role, reason, sample_count, accessed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, entry.ID, entry.ClassificationID, entry.UserID, entry.UserEmail, entry.UserRole, entry.Reason, entry.SampleCount, entry.AccessedAt)
+	return err
+}
+
+// ListSampleAccessLog returns recent original-value accesses, optionally for one classification
+func (s *Store) ListSampleAccessLog(ctx context.Context, classificationID *uuid.UUID, limit int) ([]models.SampleAccessLog, error) {
+	var entries []models.SampleAccessLog
+	var err error
+	if classificationID != nil {
+		err = s.db.SelectContext(ctx, &entries, `
+			SELECT * FROM sample_access_log WHERE classification_id = $1 ORDER BY accessed_at DESC LIMIT $2
+		`, *classificationID, limit)
+	} else {
+		err = s.db.SelectContext(ctx, &entries, `
+			SELECT * FROM sample_access_log ORDER BY accessed_at DESC LIMIT $1
+		`, limit)
+	}
+	return entries, err
+}
+
 func (s *Store) GetClassificationStats(ctx context.Context, accountID *uuid.UUID) (map[string]int, error) {
 	query := `
 		SELECT category, SUM(finding_count) as count
@@ -507,6 +679,29 @@ func (s *Store) CreateFinding(ctx context.Context, finding *models.Finding) erro
 	return err
 }
 
+// RefreshFinding updates a stored finding that a scan raised again. Its ID,
+// creation and first sighting are kept; LastSeenAt is set to now.
+func (s *Store) RefreshFinding(ctx context.Context, finding *models.Finding) error {
+	query := `
+		UPDATE findings SET
+			asset_id = $2, severity = $3, title = $4, description = $5, remediation = $6,
+			status = $7, status_reason = $8, compliance_frameworks = $9, evidence = $10,
+			resolved_at = $11, updated_at = $12, last_seen_at = $12
+		WHERE id = $1
+	`
+
+	now := time.Now()
+	finding.UpdatedAt = now
+	finding.LastSeenAt = now
+
+	_, err := s.db.ExecContext(ctx, query,
+		finding.ID, finding.AssetID, finding.Severity, finding.Title, finding.Description, finding.Remediation,
+		finding.Status, finding.StatusReason, pq.Array(finding.ComplianceFrameworks), finding.Evidence,
+		finding.ResolvedAt, now,
+	)
+	return err
+}
+
 func (s *Store) GetFinding(ctx context.Context, id uuid.UUID) (*models.Finding, error) {
 	var finding models.Finding
 	query := `SELECT * FROM findings WHERE id = $1`
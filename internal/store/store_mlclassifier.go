@@ -30,6 +30,7 @@ func (s *Store) CreateMLModel(ctx context.Context, model *models.MLModel) error
 			recall_score = EXCLUDED.recall_score,
 			f1_score = EXCLUDED.f1_score,
 			updated_at = EXCLUDED.updated_at
+		RETURNING id
 	`
 
 	if model.ID == uuid.Nil {
@@ -41,30 +42,63 @@ func (s *Store) CreateMLModel(ctx context.Context, model *models.MLModel) error
 	}
 	model.UpdatedAt = now
 
-	_, err := s.db.ExecContext(ctx, query,
+	// A re-registered name and version keeps the existing row's ID
+	return s.db.QueryRowContext(ctx, query,
 		model.ID, model.Name, model.ModelType, model.Version, model.Description,
 		model.Framework, model.ModelPath, model.Config, model.Accuracy,
 		model.PrecisionScore, model.RecallScore, model.F1Score, model.Status,
 		model.IsDefault, model.TrainedOnSamples, model.TrainingDataVersion,
 		model.CreatedAt, model.UpdatedAt,
-	)
-	return err
+	).Scan(&model.ID)
 }
 
 func (s *Store) UpdateMLModel(ctx context.Context, model *models.MLModel) error {
 	query := `
 		UPDATE ml_models SET
 			status = $1, accuracy = $2, precision_score = $3, recall_score = $4,
-			f1_score = $5, is_default = $6, updated_at = $7
-		WHERE id = $8
+			f1_score = $5, is_default = $6, promoted_at = $7, retired_at = $8,
+			updated_at = $9
+		WHERE id = $10
 	`
 	_, err := s.db.ExecContext(ctx, query,
 		model.Status, model.Accuracy, model.PrecisionScore, model.RecallScore,
-		model.F1Score, model.IsDefault, time.Now(), model.ID,
+		model.F1Score, model.IsDefault, model.PromotedAt, model.RetiredAt,
+		time.Now(), model.ID,
 	)
 	return err
 }
 
+// ReplaceActiveMLModel makes next the active default model of its type and
+// retires previous, in one transaction so there is never zero or two
+// defaults. previous may be nil when nothing of the type is active yet.
+func (s *Store) ReplaceActiveMLModel(ctx context.Context, next, previous *models.MLModel) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	query := `
+		UPDATE ml_models SET
+			status = $1, is_default = $2, promoted_at = $3, retired_at = $4, updated_at = $5
+		WHERE id = $6
+	`
+	if previous != nil {
+		if _, err := tx.ExecContext(ctx, query,
+			previous.Status, previous.IsDefault, previous.PromotedAt, previous.RetiredAt, now, previous.ID,
+		); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, query,
+		next.Status, next.IsDefault, next.PromotedAt, next.RetiredAt, now, next.ID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (s *Store) GetMLModel(ctx context.Context, id uuid.UUID) (*models.MLModel, error) {
 	var model models.MLModel
 	query := `SELECT * FROM ml_models WHERE id = $1`
@@ -92,6 +126,39 @@ func (s *Store) ListMLModels(ctx context.Context) ([]*models.MLModel, error) {
 	return models, err
 }
 
+// =====================================================
+// Shadow Evaluation Store Methods
+// =====================================================
+
+func (s *Store) CreateShadowResult(ctx context.Context, result *models.MLShadowResult) error {
+	query := `
+		INSERT INTO ml_shadow_results (
+			id, shadow_model_id, active_model_id, prediction_id,
+			shadow_confidence, active_confidence, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	if result.ID == uuid.Nil {
+		result.ID = uuid.New()
+	}
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.ExecContext(ctx, query,
+		result.ID, result.ShadowModelID, result.ActiveModelID, result.PredictionID,
+		result.ShadowConfidence, result.ActiveConfidence, result.CreatedAt,
+	)
+	return err
+}
+
+func (s *Store) ListShadowResults(ctx context.Context, shadowModelID uuid.UUID) ([]*models.MLShadowResult, error) {
+	var results []*models.MLShadowResult
+	query := `SELECT * FROM ml_shadow_results WHERE shadow_model_id = $1 ORDER BY created_at DESC`
+	err := s.db.SelectContext(ctx, &results, query, shadowModelID)
+	return results, err
+}
+
 // =====================================================
 // ML Predictions Store Methods
 // =====================================================
@@ -100,10 +167,10 @@ func (s *Store) CreateMLPrediction(ctx context.Context, prediction *models.MLPre
 	query := `
 		INSERT INTO ml_predictions (
 			id, classification_id, model_id, prediction_type, predicted_label,
-			confidence_score, entity_text, entity_start_offset, entity_end_offset,
-			raw_output, review_status, reviewed_by, reviewed_at, review_notes,
-			created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			confidence_score, calibrated_confidence, entity_text, entity_start_offset,
+			entity_end_offset, raw_output, review_status, reviewed_by, reviewed_at,
+			review_notes, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 
 	if prediction.ID == uuid.Nil {
@@ -116,7 +183,7 @@ func (s *Store) CreateMLPrediction(ctx context.Context, prediction *models.MLPre
 	_, err := s.db.ExecContext(ctx, query,
 		prediction.ID, prediction.ClassificationID, prediction.ModelID,
 		prediction.PredictionType, prediction.PredictedLabel, prediction.ConfidenceScore,
-		prediction.EntityText, prediction.EntityStartOffset, prediction.EntityEndOffset,
+		prediction.CalibratedConfidence, prediction.EntityText, prediction.EntityStartOffset, prediction.EntityEndOffset,
 		prediction.RawOutput, prediction.ReviewStatus, prediction.ReviewedBy,
 		prediction.ReviewedAt, prediction.ReviewNotes, prediction.CreatedAt,
 	)
@@ -163,8 +230,9 @@ func (s *Store) CreateReviewQueueItem(ctx context.Context, item *models.Classifi
 			id, classification_id, prediction_id, priority, reason,
 			original_confidence, assigned_to, assigned_at, due_by,
 			status, resolved_at, resolution, final_label, final_confidence,
-			created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			routing_rule_id, double_review, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		ON CONFLICT DO NOTHING
 	`
 
 	if item.ID == uuid.Nil {
@@ -178,7 +246,8 @@ func (s *Store) CreateReviewQueueItem(ctx context.Context, item *models.Classifi
 		item.ID, item.ClassificationID, item.PredictionID, item.Priority,
 		item.Reason, item.OriginalConfidence, item.AssignedTo, item.AssignedAt,
 		item.DueBy, item.Status, item.ResolvedAt, item.Resolution,
-		item.FinalLabel, item.FinalConfidence, item.CreatedAt,
+		item.FinalLabel, item.FinalConfidence, item.RoutingRuleID, item.DoubleReview,
+		item.CreatedAt,
 	)
 	return err
 }
@@ -187,12 +256,16 @@ func (s *Store) UpdateReviewQueueItem(ctx context.Context, item *models.Classifi
 	query := `
 		UPDATE classification_review_queue SET
 			assigned_to = $1, assigned_at = $2, status = $3, resolved_at = $4,
-			resolution = $5, final_label = $6, final_confidence = $7
-		WHERE id = $8
+			resolution = $5, final_label = $6, final_confidence = $7,
+			priority = $8, resolved_by = $9, first_reviewer = $10,
+			first_resolution = $11, first_resolved_at = $12, escalated_at = $13
+		WHERE id = $14
 	`
 	_, err := s.db.ExecContext(ctx, query,
 		item.AssignedTo, item.AssignedAt, item.Status, item.ResolvedAt,
-		item.Resolution, item.FinalLabel, item.FinalConfidence, item.ID,
+		item.Resolution, item.FinalLabel, item.FinalConfidence,
+		item.Priority, item.ResolvedBy, item.FirstReviewer,
+		item.FirstResolution, item.FirstResolvedAt, item.EscalatedAt, item.ID,
 	)
 	return err
 }
@@ -207,6 +280,19 @@ func (s *Store) GetReviewQueueItem(ctx context.Context, id uuid.UUID) (*models.C
 	return &item, err
 }
 
+// GetOpenReviewQueueItem returns the pending or in-review item of a classification, or nil
+func (s *Store) GetOpenReviewQueueItem(ctx context.Context, classificationID uuid.UUID) (*models.ClassificationReviewQueue, error) {
+	var item models.ClassificationReviewQueue
+	query := `SELECT * FROM classification_review_queue
+		WHERE classification_id = $1 AND status IN ($2, $3)
+		ORDER BY created_at LIMIT 1`
+	err := s.db.GetContext(ctx, &item, query, classificationID, models.ReviewQueueStatusPending, models.ReviewQueueStatusInReview)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &item, err
+}
+
 func (s *Store) ListReviewQueue(ctx context.Context, status models.ReviewQueueStatus, limit int) ([]*models.ClassificationReviewQueue, error) {
 	var items []*models.ClassificationReviewQueue
 	query := `SELECT * FROM classification_review_queue WHERE status = $1 ORDER BY priority DESC, created_at ASC LIMIT $2`
@@ -214,6 +300,149 @@ func (s *Store) ListReviewQueue(ctx context.Context, status models.ReviewQueueSt
 	return items, err
 }
 
+// reviewSubjectColumns selects a ReviewSubject from classifications c joined
+// with data_assets a; $1 is the asset tag holding the data owner
+const reviewSubjectColumns = `
+	c.rule_name, c.category, c.object_path, a.id AS asset_id, a.name AS asset_name,
+	a.account_id, COALESCE(a.tags->>$1, '') AS data_owner`
+
+// GetReviewSubject returns what a review of the classification is about
+func (s *Store) GetReviewSubject(ctx context.Context, classificationID uuid.UUID, ownerTag string) (*models.ReviewSubject, error) {
+	var subject models.ReviewSubject
+	query := `SELECT` + reviewSubjectColumns + `
+		FROM classifications c
+		JOIN data_assets a ON a.id = c.asset_id
+		WHERE c.id = $2`
+	err := s.db.GetContext(ctx, &subject, query, ownerTag, classificationID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &subject, err
+}
+
+// ListOpenReviewEntries returns pending and in-review items for a rule,
+// highest priority first
+func (s *Store) ListOpenReviewEntries(ctx context.Context, ruleName, ownerTag string, limit int) ([]*models.ReviewQueueEntry, error) {
+	var entries []*models.ReviewQueueEntry
+	query := `SELECT q.*,` + reviewSubjectColumns + `
+		FROM classification_review_queue q
+		JOIN classifications c ON c.id = q.classification_id
+		JOIN data_assets a ON a.id = c.asset_id
+		WHERE q.status IN ('pending', 'in_review') AND c.rule_name = $2
+		ORDER BY q.priority DESC, q.created_at ASC
+		LIMIT $3`
+	err := s.db.SelectContext(ctx, &entries, query, ownerTag, ruleName, limit)
+	return entries, err
+}
+
+// ListOverdueReviewEntries returns open items past their due time that have
+// not been escalated yet
+func (s *Store) ListOverdueReviewEntries(ctx context.Context, now time.Time, ownerTag string, limit int) ([]*models.ReviewQueueEntry, error) {
+	var entries []*models.ReviewQueueEntry
+	query := `SELECT q.*,` + reviewSubjectColumns + `
+		FROM classification_review_queue q
+		JOIN classifications c ON c.id = q.classification_id
+		JOIN data_assets a ON a.id = c.asset_id
+		WHERE q.status IN ('pending', 'in_review') AND q.escalated_at IS NULL AND q.due_by < $2
+		ORDER BY q.due_by ASC
+		LIMIT $3`
+	err := s.db.SelectContext(ctx, &entries, query, ownerTag, now, limit)
+	return entries, err
+}
+
+// ListReviewItemsReviewedSince returns items with a first or final review
+// at or after since
+func (s *Store) ListReviewItemsReviewedSince(ctx context.Context, since time.Time) ([]*models.ClassificationReviewQueue, error) {
+	var items []*models.ClassificationReviewQueue
+	query := `
+		SELECT * FROM classification_review_queue
+		WHERE resolved_at >= $1 OR first_resolved_at >= $1
+		ORDER BY COALESCE(resolved_at, first_resolved_at)
+	`
+	err := s.db.SelectContext(ctx, &items, query, since)
+	return items, err
+}
+
+// ListReviewerWorkloads counts open and overdue items per assigned reviewer
+func (s *Store) ListReviewerWorkloads(ctx context.Context, now time.Time) ([]*models.ReviewerWorkload, error) {
+	var workloads []*models.ReviewerWorkload
+	query := `
+		SELECT assigned_to AS reviewer_id, COUNT(*) AS open,
+			COUNT(*) FILTER (WHERE due_by < $1) AS overdue
+		FROM classification_review_queue
+		WHERE status IN ('pending', 'in_review') AND assigned_to IS NOT NULL
+		GROUP BY assigned_to
+	`
+	err := s.db.SelectContext(ctx, &workloads, query, now)
+	return workloads, err
+}
+
+func (s *Store) CreateReviewRoutingRule(ctx context.Context, rule *models.ReviewRoutingRule) error {
+	query := `
+		INSERT INTO review_routing_rules (
+			id, name, priority, account_id, category, data_owner, assignees,
+			sla_hours, enabled, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	if rule.ID == uuid.Nil {
+		rule.ID = uuid.New()
+	}
+	now := time.Now()
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = now
+	}
+	rule.UpdatedAt = now
+
+	_, err := s.db.ExecContext(ctx, query,
+		rule.ID, rule.Name, rule.Priority, rule.AccountID, rule.Category, rule.DataOwner,
+		rule.Assignees, rule.SLAHours, rule.Enabled, rule.CreatedAt, rule.UpdatedAt,
+	)
+	return err
+}
+
+func (s *Store) ListReviewRoutingRules(ctx context.Context) ([]*models.ReviewRoutingRule, error) {
+	var rules []*models.ReviewRoutingRule
+	query := `SELECT * FROM review_routing_rules ORDER BY priority DESC, created_at ASC`
+	err := s.db.SelectContext(ctx, &rules, query)
+	return rules, err
+}
+
+func (s *Store) DeleteReviewRoutingRule(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM review_routing_rules WHERE id = $1`
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// CreateCalibrationSample records the outcome of a review item once
+func (s *Store) CreateCalibrationSample(ctx context.Context, sample *models.CalibrationSample) error {
+	query := `
+		INSERT INTO calibration_samples (
+			id, review_item_id, rule_name, raw_confidence, resolution,
+			final_label, final_confidence, resolved_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (review_item_id) DO NOTHING
+	`
+
+	if sample.ID == uuid.Nil {
+		sample.ID = uuid.New()
+	}
+
+	_, err := s.db.ExecContext(ctx, query,
+		sample.ID, sample.ReviewItemID, sample.RuleName, sample.RawConfidence,
+		sample.Resolution, sample.FinalLabel, sample.FinalConfidence, sample.ResolvedAt,
+	)
+	return err
+}
+
+// ListCalibrationSamples returns the most recently resolved review outcomes
+func (s *Store) ListCalibrationSamples(ctx context.Context, limit int) ([]*models.CalibrationSample, error) {
+	var samples []*models.CalibrationSample
+	query := `SELECT * FROM calibration_samples ORDER BY resolved_at DESC LIMIT $1`
+	err := s.db.SelectContext(ctx, &samples, query, limit)
+	return samples, err
+}
+
 func (s *Store) GetReviewQueueStats(ctx context.Context) (map[string]int, error) {
 	query := `SELECT status, COUNT(*) as count FROM classification_review_queue GROUP BY status`
 	rows, err := s.db.QueryContext(ctx, query)
@@ -243,8 +472,9 @@ func (s *Store) CreateTrainingFeedback(ctx context.Context, feedback *models.Tra
 		INSERT INTO training_feedback (
 			id, model_id, prediction_id, original_prediction, corrected_label,
 			feedback_type, sample_content, sample_hash, context_window,
+			rule_name, document_type, confidence,
 			incorporated_in_training, training_run_id, submitted_by, submitted_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 
 	if feedback.ID == uuid.Nil {
@@ -258,6 +488,7 @@ func (s *Store) CreateTrainingFeedback(ctx context.Context, feedback *models.Tra
 		feedback.ID, feedback.ModelID, feedback.PredictionID,
 		feedback.OriginalPrediction, feedback.CorrectedLabel, feedback.FeedbackType,
 		feedback.SampleContent, feedback.SampleHash, feedback.ContextWindow,
+		feedback.RuleName, feedback.DocumentType, feedback.Confidence,
 		feedback.IncorporatedInTraining, feedback.TrainingRunID,
 		feedback.SubmittedBy, feedback.SubmittedAt,
 	)
@@ -271,6 +502,15 @@ func (s *Store) ListTrainingFeedback(ctx context.Context, modelID uuid.UUID, inc
 	return feedbacks, err
 }
 
+// ListFeedbackForPredictions returns reviewer feedback on any of the given
+// predictions, oldest first
+func (s *Store) ListFeedbackForPredictions(ctx context.Context, predictionIDs []uuid.UUID) ([]*models.TrainingFeedback, error) {
+	var feedbacks []*models.TrainingFeedback
+	query := `SELECT * FROM training_feedback WHERE prediction_id = ANY($1) ORDER BY submitted_at`
+	err := s.db.SelectContext(ctx, &feedbacks, query, pq.Array(predictionIDs))
+	return feedbacks, err
+}
+
 func (s *Store) MarkFeedbackIncorporated(ctx context.Context, feedbackIDs []uuid.UUID, trainingRunID string) error {
 	query := `
 		UPDATE training_feedback SET
@@ -46,6 +46,20 @@ func (s *Store) CreateRemediationAction(ctx context.Context, action *remediation
 	return nil
 }
 
+// DeletePendingRemediationActions removes an account's pending actions of one
+// type proposed by source, ahead of proposing them again. Actions already
+// approved or executed are kept.
+func (s *Store) DeletePendingRemediationActions(ctx context.Context, accountID uuid.UUID, actionType remediation.ActionType, source string) error {
+	query := `
+		DELETE FROM remediation_actions
+		WHERE account_id = $1 AND action_type = $2 AND status = $3 AND parameters->>'source' = $4
+	`
+	if _, err := s.db.ExecContext(ctx, query, accountID, actionType, remediation.StatusPending, source); err != nil {
+		return fmt.Errorf("deleting pending remediation actions: %w", err)
+	}
+	return nil
+}
+
 // GetRemediationAction retrieves a remediation action by ID
 func (s *Store) GetRemediationAction(ctx context.Context, id uuid.UUID) (*remediation.Action, error) {
 	query := `
@@ -354,6 +354,75 @@ func TestStore_Findings(t *testing.T) {
 	}
 }
 
+func TestStore_DeleteFindingsForObjects(t *testing.T) {
+	store := skipIfNoTestDB(t)
+	if store == nil {
+		return
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	account := &models.CloudAccount{
+		Provider:        models.ProviderAWS,
+		ExternalID:      "test-object-findings-" + uuid.New().String()[:8],
+		ConnectorConfig: models.JSONB{},
+	}
+	_ = store.CreateAccount(ctx, account)
+	defer func() { _ = store.DeleteAccount(ctx, account.ID) }()
+
+	asset := &models.DataAsset{
+		AccountID:    account.ID,
+		ResourceType: models.ResourceTypeS3Bucket,
+		ResourceARN:  "arn:aws:s3:::" + account.ExternalID,
+		Region:       "us-east-1",
+		Name:         account.ExternalID,
+	}
+	if err := store.UpsertAsset(ctx, asset); err != nil {
+		t.Fatalf("UpsertAsset failed: %v", err)
+	}
+
+	create := func(findingType string, evidence models.JSONB) *models.Finding {
+		t.Helper()
+		finding := &models.Finding{
+			AccountID:   account.ID,
+			AssetID:     &asset.ID,
+			FindingType: findingType,
+			Severity:    models.SeverityHigh,
+			Title:       findingType,
+			Status:      models.FindingStatusOpen,
+			Evidence:    evidence,
+		}
+		if err := store.CreateFinding(ctx, finding); err != nil {
+			t.Fatalf("CreateFinding failed: %v", err)
+		}
+		return finding
+	}
+	public := create("PUBLIC_BUCKET", models.JSONB{})
+	rescanned := create("SENSITIVE_OBJECT", models.JSONB{"object_path": "a.csv"})
+	untouched := create("SENSITIVE_OBJECT", models.JSONB{"object_path": "b.csv"})
+	access := create("UNUSED_DATA_ACCESS", models.JSONB{"principal_arn": "arn:aws:iam::111111111111:role/reader"})
+
+	if err := store.DeleteFindingsForObjects(ctx, asset.ID, []string{"PUBLIC_BUCKET"}, []string{"a.csv"}); err != nil {
+		t.Fatalf("DeleteFindingsForObjects failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		finding *models.Finding
+		kept    bool
+	}{
+		{public, false},
+		{rescanned, false},
+		{untouched, true},
+		{access, true},
+	} {
+		retrieved, _ := store.GetFinding(ctx, tc.finding.ID)
+		if kept := retrieved != nil; kept != tc.kept {
+			t.Errorf("Expected %s %v kept=%v, got %v", tc.finding.FindingType, tc.finding.Evidence, tc.kept, kept)
+		}
+	}
+}
+
 func TestStore_ScanJobs(t *testing.T) {
 	store := skipIfNoTestDB(t)
 	if store == nil {
@@ -0,0 +1,9 @@
+-- Migration: Version custom rules and record the rule revision on each classification
+
+ALTER TABLE custom_rules
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE classifications
+    ADD COLUMN IF NOT EXISTS rule_version VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_class_rule_version ON classifications(rule_version);
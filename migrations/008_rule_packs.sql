@@ -0,0 +1,20 @@
+-- Migration: Declarative rule packs with semantic versioning
+
+CREATE TABLE IF NOT EXISTS rule_packs (
+    name VARCHAR(255) PRIMARY KEY,
+    version VARCHAR(50) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    checksum VARCHAR(64) NOT NULL,
+    imported_by VARCHAR(255) NOT NULL DEFAULT '',
+    imported_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE custom_rules
+    ADD COLUMN IF NOT EXISTS pack_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS negative_patterns TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS validators TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS test_cases JSONB NOT NULL DEFAULT '{}';
+
+-- Rule names are unique within a pack; ad-hoc rules (no pack) are unconstrained
+CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_rules_pack_name
+    ON custom_rules(pack_name, name) WHERE pack_name <> '';
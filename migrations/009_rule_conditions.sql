@@ -0,0 +1,4 @@
+-- Migration: Boolean/proximity condition expressions on custom rules
+
+ALTER TABLE custom_rules
+    ADD COLUMN IF NOT EXISTS condition TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,15 @@
+-- Migration: Audit log for access to encrypted original match samples
+
+CREATE TABLE IF NOT EXISTS sample_access_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    classification_id UUID NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    user_email VARCHAR(255) NOT NULL DEFAULT '',
+    user_role VARCHAR(50) NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    sample_count INT NOT NULL DEFAULT 0,
+    accessed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sample_access_classification ON sample_access_log(classification_id);
+CREATE INDEX IF NOT EXISTS idx_sample_access_time ON sample_access_log(accessed_at DESC);
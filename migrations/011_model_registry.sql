@@ -0,0 +1,23 @@
+-- Migration: Model lifecycle states and shadow evaluation
+
+ALTER TABLE ml_models ADD COLUMN IF NOT EXISTS promoted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE ml_models ADD COLUMN IF NOT EXISTS retired_at TIMESTAMP WITH TIME ZONE;
+
+-- deprecated is superseded by retired
+UPDATE ml_models SET status = 'retired', retired_at = updated_at WHERE status = 'deprecated';
+UPDATE ml_models SET promoted_at = created_at WHERE status = 'active' AND promoted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_ml_models_type_status ON ml_models(model_type, status);
+
+CREATE TABLE IF NOT EXISTS ml_shadow_results (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    shadow_model_id UUID NOT NULL REFERENCES ml_models(id) ON DELETE CASCADE,
+    active_model_id UUID REFERENCES ml_models(id) ON DELETE SET NULL,
+    prediction_id UUID NOT NULL REFERENCES ml_predictions(id) ON DELETE CASCADE,
+    shadow_confidence DECIMAL(5,4) NOT NULL,
+    active_confidence DECIMAL(5,4) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ml_shadow_results_model ON ml_shadow_results(shadow_model_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ml_shadow_results_prediction ON ml_shadow_results(prediction_id);
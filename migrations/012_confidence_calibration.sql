@@ -0,0 +1,6 @@
+-- Migration: Calibrated confidence alongside raw confidence
+
+ALTER TABLE ml_predictions ADD COLUMN IF NOT EXISTS calibrated_confidence DECIMAL(5,4);
+
+-- Calibration is fitted on the most recently resolved review items
+CREATE INDEX IF NOT EXISTS idx_review_queue_resolved ON classification_review_queue(resolved_at DESC) WHERE status = 'resolved';
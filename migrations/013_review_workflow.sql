@@ -0,0 +1,41 @@
+-- Migration: Review queue routing, SLAs, double review and reviewer metrics
+
+CREATE TABLE IF NOT EXISTS review_routing_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    account_id UUID REFERENCES cloud_accounts(id) ON DELETE CASCADE,
+    category VARCHAR(50) NOT NULL DEFAULT '',
+    data_owner VARCHAR(255) NOT NULL DEFAULT '',
+    assignees TEXT[] NOT NULL DEFAULT '{}',
+    sla_hours INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_routing_rules_priority ON review_routing_rules(priority DESC) WHERE enabled;
+
+ALTER TABLE classification_review_queue
+    ADD COLUMN IF NOT EXISTS resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS routing_rule_id UUID REFERENCES review_routing_rules(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS double_review BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS first_reviewer UUID REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS first_resolution VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS first_resolved_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMPTZ;
+
+UPDATE classification_review_queue SET resolution = '' WHERE resolution IS NULL;
+UPDATE classification_review_queue SET final_label = '' WHERE final_label IS NULL;
+UPDATE classification_review_queue SET final_confidence = 0 WHERE final_confidence IS NULL;
+
+ALTER TABLE classification_review_queue
+    ALTER COLUMN resolution SET DEFAULT '',
+    ALTER COLUMN final_label SET DEFAULT '',
+    ALTER COLUMN final_confidence SET DEFAULT 0;
+
+-- Open items past their SLA that have not been escalated yet
+CREATE INDEX IF NOT EXISTS idx_review_queue_due ON classification_review_queue(due_by)
+    WHERE status IN ('pending', 'in_review') AND escalated_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_review_queue_first_resolved ON classification_review_queue(first_resolved_at DESC)
+    WHERE first_resolved_at IS NOT NULL;
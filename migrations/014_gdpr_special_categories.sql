@@ -0,0 +1,7 @@
+-- Migration: GDPR Article 9 special categories of personal data
+
+INSERT INTO compliance_controls (framework, control_id, control_name, finding_types, data_categories) VALUES
+    ('GDPR', 'Art.9', 'Processing of Special Categories of Personal Data',
+     ARRAY['PUBLIC_BUCKET', 'UNENCRYPTED_STORAGE', 'OVERPRIVILEGED_ACCESS'],
+     ARRAY['HEALTH', 'RELIGION', 'ETHNICITY', 'SEXUAL_ORIENTATION', 'BIOMETRIC', 'TRADE_UNION'])
+ON CONFLICT (framework, control_id) DO NOTHING;
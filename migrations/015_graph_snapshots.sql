@@ -0,0 +1,7 @@
+-- Migration: Snapshots of the embedded access graph backend
+
+CREATE TABLE IF NOT EXISTS graph_snapshots (
+    name VARCHAR(255) PRIMARY KEY,
+    data JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,10 @@
+-- Migration: Keep remediation actions when their finding is deleted
+--
+-- Scans replace their findings, which a remediation action proposed for a
+-- finding would otherwise block.
+
+ALTER TABLE remediation_actions
+    DROP CONSTRAINT IF EXISTS remediation_actions_finding_id_fkey;
+ALTER TABLE remediation_actions
+    ADD CONSTRAINT remediation_actions_finding_id_fkey
+    FOREIGN KEY (finding_id) REFERENCES findings(id) ON DELETE SET NULL;
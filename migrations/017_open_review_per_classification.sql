@@ -0,0 +1,17 @@
+-- Migration: At most one open review per classification
+--
+-- Rescans queued a classification again while an earlier review of it was
+-- still open. Older duplicates are skipped, keeping the first item queued.
+
+UPDATE classification_review_queue q
+SET status = 'skipped'
+FROM classification_review_queue o
+WHERE q.classification_id = o.classification_id
+  AND q.id <> o.id
+  AND q.status IN ('pending', 'in_review')
+  AND o.status IN ('pending', 'in_review')
+  AND (q.created_at, q.id) > (o.created_at, o.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_review_queue_open_classification
+    ON classification_review_queue(classification_id)
+    WHERE status IN ('pending', 'in_review');
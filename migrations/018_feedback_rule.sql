@@ -0,0 +1,18 @@
+-- Migration: Keep the reviewed rule on training feedback
+--
+-- Rescans delete classifications and, by cascade, their ML predictions,
+-- which cleared prediction_id and left feedback without the rule it labels.
+
+ALTER TABLE training_feedback
+    ADD COLUMN IF NOT EXISTS rule_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS document_type VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS confidence DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+UPDATE training_feedback f
+SET rule_name = COALESCE(p.raw_output->>'rule_name', ''),
+    document_type = COALESCE(p.raw_output->>'document_type', ''),
+    confidence = p.confidence_score
+FROM ml_predictions p
+WHERE p.id = f.prediction_id;
+
+CREATE INDEX IF NOT EXISTS idx_training_feedback_rule ON training_feedback(rule_name);
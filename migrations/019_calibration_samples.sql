@@ -0,0 +1,31 @@
+-- Migration: Calibration samples outlive the review items they come from
+--
+-- Rescans delete classifications, cascading to their review items, which
+-- calibration used to read its samples from.
+
+CREATE TABLE IF NOT EXISTS calibration_samples (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    review_item_id UUID UNIQUE,
+    rule_name VARCHAR(255) NOT NULL,
+    raw_confidence DOUBLE PRECISION NOT NULL,
+    resolution VARCHAR(50) NOT NULL,
+    final_label VARCHAR(100) NOT NULL DEFAULT '',
+    final_confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+    resolved_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_calibration_samples_resolved ON calibration_samples(resolved_at DESC);
+
+INSERT INTO calibration_samples (
+    review_item_id, rule_name, raw_confidence, resolution,
+    final_label, final_confidence, resolved_at
+)
+SELECT q.id, c.rule_name, q.original_confidence, q.resolution,
+       COALESCE(q.final_label, ''), COALESCE(q.final_confidence, 0), q.resolved_at
+FROM classification_review_queue q
+JOIN classifications c ON c.id = q.classification_id
+WHERE q.status = 'resolved'
+  AND q.resolution IN ('CONFIRMED', 'MODIFIED', 'REJECTED')
+  AND q.original_confidence IS NOT NULL
+  AND q.resolved_at IS NOT NULL
+ON CONFLICT (review_item_id) DO NOTHING;